@@ -53,7 +53,7 @@ var config = Config{
 		"github.com/restic/restic/internal/...",
 		"github.com/restic/restic/cmd/...",
 	},
-	MinVersion: GoVersion{Major: 1, Minor: 8, Patch: 0}, // minimum Go version supported
+	MinVersion: GoVersion{Major: 1, Minor: 16, Patch: 0}, // minimum Go version supported
 }
 
 // Config configures the build.
@@ -253,22 +253,14 @@ func cleanEnv() (env []string) {
 }
 
 // build runs "go build args..." with GOPATH set to gopath.
-func build(cwd string, ver GoVersion, goos, goarch, goarm, gopath string, args ...string) error {
+func build(cwd string, goos, goarch, goarm, gopath string, args ...string) error {
 	a := []string{"build"}
-
-	if ver.AtLeast(GoVersion{1, 10, 0}) {
-		verbosePrintf("Go version is at least 1.10, using new syntax for -gcflags\n")
-		// use new prefix
-		a = append(a, "-asmflags", fmt.Sprintf("all=-trimpath=%s", gopath))
-		a = append(a, "-gcflags", fmt.Sprintf("all=-trimpath=%s", gopath))
-	} else {
-		a = append(a, "-asmflags", fmt.Sprintf("-trimpath=%s", gopath))
-		a = append(a, "-gcflags", fmt.Sprintf("-trimpath=%s", gopath))
-	}
+	a = append(a, "-asmflags", fmt.Sprintf("all=-trimpath=%s", gopath))
+	a = append(a, "-gcflags", fmt.Sprintf("all=-trimpath=%s", gopath))
 
 	a = append(a, args...)
 	cmd := exec.Command("go", a...)
-	cmd.Env = append(cleanEnv(), "GOPATH="+gopath, "GOARCH="+goarch, "GOOS="+goos)
+	cmd.Env = append(cleanEnv(), "GOPATH="+gopath, "GO111MODULE=off", "GOARCH="+goarch, "GOOS="+goos)
 	if goarm != "" {
 		cmd.Env = append(cmd.Env, "GOARM="+goarm)
 	}
@@ -288,7 +280,7 @@ func build(cwd string, ver GoVersion, goos, goarch, goarm, gopath string, args .
 func test(cwd, gopath string, args ...string) error {
 	args = append([]string{"test"}, args...)
 	cmd := exec.Command("go", args...)
-	cmd.Env = append(cleanEnv(), "GOPATH="+gopath)
+	cmd.Env = append(cleanEnv(), "GOPATH="+gopath, "GO111MODULE=off")
 	cmd.Dir = cwd
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -583,7 +575,7 @@ func main() {
 		"-o", output, config.Main,
 	}
 
-	err = build(filepath.Join(gopath, "src"), ver, targetGOOS, targetGOARCH, targetGOARM, gopath, args...)
+	err = build(filepath.Join(gopath, "src"), targetGOOS, targetGOARCH, targetGOARM, gopath, args...)
 	if err != nil {
 		die("build failed: %v\n", err)
 	}
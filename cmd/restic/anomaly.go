@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// anomalyHistory is the maximum number of previous snapshots the changes of
+// a backup are compared with.
+const anomalyHistory = 20
+
+// anomalyMinHistory is the number of previous snapshots with a summary which
+// are needed before anomalies are reported.
+const anomalyMinHistory = 3
+
+// anomalyMetric is a value taken from the summary of a snapshot which is
+// checked for unusual changes.
+type anomalyMetric struct {
+	name string
+	// minSpread is the smallest deviation considered normal, so that a
+	// history of (almost) identical values does not cause warnings for
+	// minor changes.
+	minSpread float64
+	value     func(s restic.SnapshotSummary) float64
+	format    func(v float64) string
+}
+
+func formatCount(v float64) string {
+	return fmt.Sprintf("%.0f", v)
+}
+
+func formatByteCount(v float64) string {
+	return formatBytes(uint64(v))
+}
+
+var anomalyMetrics = []anomalyMetric{
+	{
+		name:      "data added",
+		minSpread: 64 * 1024 * 1024,
+		value:     func(s restic.SnapshotSummary) float64 { return float64(s.DataAdded) },
+		format:    formatByteCount,
+	},
+	{
+		name:      "files changed",
+		minSpread: 100,
+		value:     func(s restic.SnapshotSummary) float64 { return float64(s.FilesChanged) },
+		format:    formatCount,
+	},
+	{
+		name:      "files removed",
+		minSpread: 100,
+		value:     func(s restic.SnapshotSummary) float64 { return float64(s.FilesRemoved) },
+		format:    formatCount,
+	},
+}
+
+// anomaly describes a value in the summary of a new snapshot which deviates
+// from the previous snapshots.
+type anomaly struct {
+	metric anomalyMetric
+	value  float64
+	mean   float64
+	score  float64
+}
+
+func (a anomaly) String() string {
+	return fmt.Sprintf("%v: %v, the average of the previous snapshots is %v (%.1f standard deviations)",
+		a.metric.name, a.metric.format(a.value), a.metric.format(a.mean), a.score)
+}
+
+// loadSummaryHistory returns the summaries of the latest snapshots for the
+// same host and paths, newest first.
+func loadSummaryHistory(ctx context.Context, repo restic.Repository, targets []string, hostname string) ([]restic.SnapshotSummary, error) {
+	var snapshots restic.Snapshots
+	err := restic.ForAllSnapshots(ctx, repo, func(id restic.ID, sn *restic.Snapshot, err error) error {
+		if err != nil {
+			return errors.Errorf("Error loading snapshot %v: %v", id.Str(), err)
+		}
+
+		if sn.Summary == nil || sn.Hostname != hostname || !sn.HasPaths(targets) {
+			return nil
+		}
+
+		snapshots = append(snapshots, sn)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(snapshots)
+	if len(snapshots) > anomalyHistory {
+		snapshots = snapshots[:anomalyHistory]
+	}
+
+	summaries := make([]restic.SnapshotSummary, 0, len(snapshots))
+	for _, sn := range snapshots {
+		summaries = append(summaries, *sn.Summary)
+	}
+
+	return summaries, nil
+}
+
+// detectAnomalies compares the summary of a new snapshot with the history
+// and returns all values which exceed the mean of the history by more than
+// threshold standard deviations.
+func detectAnomalies(history []restic.SnapshotSummary, current restic.SnapshotSummary, threshold float64) []anomaly {
+	if len(history) < anomalyMinHistory {
+		return nil
+	}
+
+	var anomalies []anomaly
+	for _, metric := range anomalyMetrics {
+		var sum float64
+		for _, s := range history {
+			sum += metric.value(s)
+		}
+		mean := sum / float64(len(history))
+
+		var variance float64
+		for _, s := range history {
+			d := metric.value(s) - mean
+			variance += d * d
+		}
+		spread := math.Max(math.Sqrt(variance/float64(len(history))), metric.minSpread)
+
+		value := metric.value(current)
+		score := (value - mean) / spread
+		if score > threshold {
+			anomalies = append(anomalies, anomaly{metric: metric, value: value, mean: mean, score: score})
+		}
+	}
+
+	return anomalies
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+func TestDetectAnomalies(t *testing.T) {
+	var history []restic.SnapshotSummary
+	for i := 0; i < 10; i++ {
+		history = append(history, restic.SnapshotSummary{
+			FilesChanged: 50 + i*10,
+			FilesRemoved: i,
+			DataAdded:    uint64(100+i*10) * 1024 * 1024,
+		})
+	}
+
+	var tests = []struct {
+		summary restic.SnapshotSummary
+		metrics []string
+	}{
+		{
+			summary: restic.SnapshotSummary{FilesChanged: 120, FilesRemoved: 5, DataAdded: 150 * 1024 * 1024},
+		},
+		{
+			summary: restic.SnapshotSummary{FilesChanged: 20000, FilesRemoved: 3, DataAdded: 180 * 1024 * 1024},
+			metrics: []string{"files changed"},
+		},
+		{
+			summary: restic.SnapshotSummary{FilesChanged: 20000, FilesRemoved: 20000, DataAdded: 20 * 1024 * 1024 * 1024},
+			metrics: []string{"data added", "files changed", "files removed"},
+		},
+	}
+
+	for i, test := range tests {
+		anomalies := detectAnomalies(history, test.summary, 3)
+		if len(anomalies) != len(test.metrics) {
+			t.Errorf("test %d: wrong number of anomalies, want %v, got %v", i, test.metrics, anomalies)
+			continue
+		}
+
+		for j, a := range anomalies {
+			if a.metric.name != test.metrics[j] {
+				t.Errorf("test %d: wrong metric, want %q, got %q", i, test.metrics[j], a.metric.name)
+			}
+		}
+	}
+
+	// not enough history
+	if anomalies := detectAnomalies(history[:2], tests[2].summary, 3); len(anomalies) != 0 {
+		t.Errorf("anomalies reported without enough history: %v", anomalies)
+	}
+}
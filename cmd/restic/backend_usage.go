@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/restic"
+)
+
+// usageBackends holds all backends opened or created by the command, so that
+// the requests sent to them can be reported.
+var usageBackends struct {
+	sync.Mutex
+	list []*backend.UsageBackend
+}
+
+// trackUsage wraps be so that the requests sent to it are counted. s is the
+// location the backend was opened with.
+func trackUsage(be restic.Backend, s string) restic.Backend {
+	ube := backend.NewUsageBackend(be, stripPassword(s))
+
+	usageBackends.Lock()
+	usageBackends.list = append(usageBackends.list, ube)
+	usageBackends.Unlock()
+
+	return ube
+}
+
+// backendUsage returns the requests sent to all backends so far.
+func backendUsage() []restic.BackendUsage {
+	usageBackends.Lock()
+	defer usageBackends.Unlock()
+
+	var usage []restic.BackendUsage
+	for _, be := range usageBackends.list {
+		usage = append(usage, be.Usage())
+	}
+	return usage
+}
+
+// stripPassword replaces the password in a location which contains an URL,
+// such as the one for the rest backend.
+func stripPassword(s string) string {
+	idx := strings.Index(s, "://")
+	if idx < 0 {
+		return s
+	}
+
+	start := strings.LastIndex(s[:idx], ":") + 1
+	u, err := url.Parse(s[start:])
+	if err != nil || u.User == nil {
+		return s
+	}
+
+	if _, ok := u.User.Password(); !ok {
+		return s
+	}
+
+	u.User = url.UserPassword(u.User.Username(), "***")
+	return s[:start] + u.String()
+}
+
+// formatBackendUsage returns a description of the requests sent to a backend.
+func formatBackendUsage(u restic.BackendUsage) string {
+	return fmt.Sprintf("%s uploaded, %s downloaded, %d PUT, %d GET, %d HEAD, %d LIST, %d DELETE requests",
+		formatBytes(u.BytesUploaded), formatBytes(u.BytesDownloaded),
+		u.PutRequests, u.GetRequests, u.HeadRequests, u.ListRequests, u.DeleteRequests)
+}
+
+// printBackendUsage prints the requests sent to the backends.
+func printBackendUsage(usage []restic.BackendUsage) {
+	if len(usage) == 1 {
+		Verbosef("Backend: %s\n", formatBackendUsage(usage[0]))
+		Verbosef("\n")
+		return
+	}
+
+	Verbosef("Backends:\n")
+	for _, u := range usage {
+		Verbosef("  %v: %s\n", u.Location, formatBackendUsage(u))
+	}
+	Verbosef("\n")
+}
+
+// reportBackendUsage prints the requests sent to all backends to stderr, as
+// JSON if requested. It is run when restic exits with --show-usage.
+func reportBackendUsage() error {
+	usage := backendUsage()
+	if len(usage) == 0 {
+		return nil
+	}
+
+	if globalOptions.JSON {
+		return json.NewEncoder(globalOptions.stderr).Encode(struct {
+			BackendUsage []restic.BackendUsage `json:"backend_usage"`
+		}{usage})
+	}
+
+	for _, u := range usage {
+		Warnf("backend usage for %v: %s\n", u.Location, formatBackendUsage(u))
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/restic/restic/internal/backend/sftp"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/source"
+)
+
+// isRemoteTarget returns true if the backup target is read from another host,
+// given as sftp:user@host:/path or sftp://user@host//path.
+func isRemoteTarget(target string) bool {
+	return strings.HasPrefix(target, "sftp:")
+}
+
+// remoteTargetHost returns the host the targets are read from, or the empty
+// string if the first target is a local path.
+func remoteTargetHost(targets []string) string {
+	if len(targets) == 0 || !isRemoteTarget(targets[0]) {
+		return ""
+	}
+
+	cfg, err := sftp.ParseConfig(targets[0])
+	if err != nil {
+		return ""
+	}
+	return cfg.(sftp.Config).Host
+}
+
+// openBackupSource returns the file system the targets are read from,
+// together with the paths of the targets in that file system. The file
+// system must be closed with the returned function.
+func openBackupSource(opts BackupOptions, gopts GlobalOptions, targets []string) (fs.FS, []string, func() error, error) {
+	if opts.Source != "" {
+		return openPluginSource(opts, gopts, targets)
+	}
+
+	var remote int
+	for _, t := range targets {
+		if isRemoteTarget(t) {
+			remote++
+		}
+	}
+
+	if remote == 0 {
+		paths := make([]string, 0, len(targets))
+		for _, d := range targets {
+			if a, err := filepath.Abs(d); err == nil {
+				d = a
+			}
+			paths = append(paths, d)
+		}
+
+		if opts.UseFSSnapshot {
+			Verbosef("creating shadow copies of the volumes\n")
+			vss, err := fs.NewLocalVSS(paths)
+			if err != nil {
+				return nil, nil, nil, errors.Fatalf("unable to create shadow copies: %v", err)
+			}
+			return vss, paths, vss.Close, nil
+		}
+
+		if opts.FollowSymlinks {
+			return fs.FollowSymlinks{}, paths, func() error { return nil }, nil
+		}
+		return fs.Local{}, paths, func() error { return nil }, nil
+	}
+
+	if remote != len(targets) {
+		return nil, nil, nil, errors.Fatal("local and remote targets cannot be saved in the same snapshot")
+	}
+
+	switch {
+	case opts.ExcludeOtherFS:
+		return nil, nil, nil, errors.Fatal("--one-file-system is not supported for remote targets")
+	case opts.FollowSymlinks:
+		return nil, nil, nil, errors.Fatal("--follow-symlinks is not supported for remote targets")
+	case opts.ChangeJournal:
+		return nil, nil, nil, errors.Fatal("--use-change-journal is not supported for remote targets")
+	case opts.UseFSSnapshot:
+		return nil, nil, nil, errors.Fatal("--use-fs-snapshot is not supported for remote targets")
+	}
+
+	var cfg sftp.Config
+	paths := make([]string, 0, len(targets))
+	for i, t := range targets {
+		c, err := sftp.ParseConfig(t)
+		if err != nil {
+			return nil, nil, nil, errors.Fatalf("invalid target %q: %v", t, err)
+		}
+		tcfg := c.(sftp.Config)
+
+		if i > 0 && (tcfg.User != cfg.User || tcfg.Host != cfg.Host) {
+			return nil, nil, nil, errors.Fatal("all remote targets must be on the same host")
+		}
+		if !path.IsAbs(tcfg.Path) {
+			return nil, nil, nil, errors.Fatalf("the path of the remote target %q must be absolute", t)
+		}
+
+		cfg = tcfg
+		paths = append(paths, tcfg.Path)
+	}
+
+	Verbosef("reading files from %v over sftp\n", cfg.Host)
+	sfs, err := openRemoteSource(gopts, cfg)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return sfs, paths, sfs.Close, nil
+}
+
+// openRemoteSource connects to the host in cfg to read files from it. The
+// options for the sftp backend given with -o also apply to the connection.
+func openRemoteSource(gopts GlobalOptions, cfg sftp.Config) (*sftp.SourceFS, error) {
+	err := gopts.extended.Extract("sftp").Apply("sftp", &cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	sfs, err := sftp.OpenSourceFS(cfg)
+	if err != nil {
+		return nil, errors.Fatalf("unable to connect to %v: %v", cfg.Host, err)
+	}
+
+	return sfs, nil
+}
+
+// parseSourceOptions parses the options for a source plugin, given as
+// key=value.
+func parseSourceOptions(list []string) (map[string]string, error) {
+	options := make(map[string]string)
+	for _, opt := range list {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, errors.Fatalf("invalid source option %q, must be key=value", opt)
+		}
+		options[kv[0]] = kv[1]
+	}
+	return options, nil
+}
+
+// openPluginSource returns a file system with the data provided by the source
+// plugin. The targets select paths in it, by default the whole source is
+// saved.
+func openPluginSource(opts BackupOptions, gopts GlobalOptions, targets []string) (fs.FS, []string, func() error, error) {
+	switch {
+	case opts.ExcludeOtherFS:
+		return nil, nil, nil, errors.Fatal("--one-file-system is not supported for --source")
+	case opts.FollowSymlinks:
+		return nil, nil, nil, errors.Fatal("--follow-symlinks is not supported for --source")
+	case opts.ChangeJournal:
+		return nil, nil, nil, errors.Fatal("--use-change-journal is not supported for --source")
+	case opts.UseFSSnapshot:
+		return nil, nil, nil, errors.Fatal("--use-fs-snapshot is not supported for --source")
+	}
+
+	options, err := parseSourceOptions(opts.SourceOptions)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	root := "/" + opts.Source
+	paths := make([]string, 0, len(targets))
+	for _, t := range targets {
+		p := path.Clean("/" + filepath.ToSlash(t))
+		if p != root && !strings.HasPrefix(p, root+"/") {
+			return nil, nil, nil, errors.Fatalf("target %q is not located in %v", t, root)
+		}
+		paths = append(paths, p)
+	}
+	if len(paths) == 0 {
+		paths = append(paths, root)
+	}
+
+	src, err := source.New(opts.Source, options)
+	if err != nil {
+		var names []string
+		for _, p := range source.All() {
+			names = append(names, p.Name)
+		}
+		return nil, nil, nil, errors.Fatalf("unable to open source %v: %v (available sources: %v)", opts.Source, err, strings.Join(names, ", "))
+	}
+
+	Verbosef("reading the items of source %v\n", opts.Source)
+	sfs, err := source.NewFS(gopts.ctx, opts.Source, src)
+	if err != nil {
+		_ = src.Close()
+		return nil, nil, nil, errors.Fatalf("unable to read source %v: %v", opts.Source, err)
+	}
+
+	return sfs, paths, sfs.Close, nil
+}
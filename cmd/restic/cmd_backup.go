@@ -2,12 +2,15 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -16,7 +19,10 @@ import (
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/source"
+	"github.com/restic/restic/internal/status"
 )
 
 var cmdBackup = &cobra.Command{
@@ -25,9 +31,23 @@ var cmdBackup = &cobra.Command{
 	Long: `
 The "backup" command creates a new snapshot and saves the files and directories
 given as the arguments.
+
+With --source, the data provided by a source plugin, e.g. exports of
+containers, is saved instead. The arguments then select paths within the
+files of the source, by default all of them are saved.
+
+Files on another host which runs an sftp server can be saved by passing the
+targets as sftp:user@host:/path. The snapshot is then saved with the name of
+the remote host, unless --hostname is given.
 `,
 	PreRun: func(cmd *cobra.Command, args []string) {
 		if backupOptions.Hostname == "" {
+			// files read from another host are saved under its name
+			if host := remoteTargetHost(args); host != "" {
+				backupOptions.Hostname = host
+				return
+			}
+
 			hostname, err := os.Hostname()
 			if err != nil {
 				debug.Log("os.Hostname() returned err: %v", err)
@@ -38,10 +58,14 @@ given as the arguments.
 	},
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if backupOptions.Stdin && backupOptions.FilesFrom == "-" {
+		if backupOptions.Stdin && filesFromStdin(backupOptions) {
 			return errors.Fatal("cannot use both `--stdin` and `--files-from -`")
 		}
 
+		if err := applyPriority(backupOptions); err != nil {
+			return err
+		}
+
 		if backupOptions.Stdin {
 			return readBackupFromStdin(backupOptions, globalOptions, args)
 		}
@@ -52,24 +76,57 @@ given as the arguments.
 
 // BackupOptions bundles all options for the backup command.
 type BackupOptions struct {
-	Parent           string
-	Force            bool
-	Excludes         []string
-	ExcludeFiles     []string
-	ExcludeOtherFS   bool
-	ExcludeIfPresent []string
-	ExcludeCaches    bool
-	Stdin            bool
-	StdinFilename    string
-	Tags             []string
-	Hostname         string
-	FilesFrom        string
-	TimeStamp        string
-	WithAtime        bool
+	Parent            string
+	Force             bool
+	Excludes          []string
+	ExcludeFiles      []string
+	ExcludeOtherFS    bool
+	ExcludeIfPresent  []string
+	ExcludeCaches     bool
+	FollowSymlinks    bool
+	Stdin             bool
+	StdinFilename     string
+	StdinResumed      bool
+	Tags              []string
+	Hostname          string
+	FilesFrom         []string
+	FilesFromVerbatim []string
+	FilesFromRaw      []string
+	TimeStamp         string
+	WithAtime         bool
+	Nice              int
+	IONiceClass       int
+	IONiceLevel       int
+	ChangeJournal     bool
+	UseFSSnapshot     bool
+	SkipUnchangedDirs bool
+	IgnoreCtime       bool
+	IgnoreInode       bool
+	FullWalkInterval  time.Duration
+	AnomalyThreshold  float64
+	FileHash          bool
+	InlineSize        string
+	Compression       string
+	Canary            bool
+	ReadConcurrency   uint
+	Checkpoint        time.Duration
+	MaxGrowthFiles    uint64
+	MaxGrowthSize     string
+	MaxGrowthWarn     bool
+	AbortOnError      bool
+	Probes            []string
+	DropPrivileges    bool
+	MaxDuration       time.Duration
+	Source            string
+	SourceOptions     []string
 }
 
 var backupOptions BackupOptions
 
+// maxInlineSize is the largest file size for which the content may be stored
+// in the tree, larger files would make loading the trees expensive.
+const maxInlineSize = 64 * 1024
+
 func init() {
 	cmdRoot.AddCommand(cmdBackup)
 
@@ -81,23 +138,100 @@ func init() {
 	f.BoolVarP(&backupOptions.ExcludeOtherFS, "one-file-system", "x", false, "exclude other file systems")
 	f.StringArrayVar(&backupOptions.ExcludeIfPresent, "exclude-if-present", nil, "takes filename[:header], exclude contents of directories containing filename (except filename itself) if header of that file is as provided (can be specified multiple times)")
 	f.BoolVar(&backupOptions.ExcludeCaches, "exclude-caches", false, `excludes cache directories that are marked with a CACHEDIR.TAG file`)
+	f.BoolVar(&backupOptions.FollowSymlinks, "follow-symlinks", false, "save the files and directories symbolic links point to instead of the links")
 	f.BoolVar(&backupOptions.Stdin, "stdin", false, "read backup from stdin")
 	f.StringVar(&backupOptions.StdinFilename, "stdin-filename", "stdin", "file name to use when reading from stdin")
+	f.BoolVar(&backupOptions.StdinResumed, "stdin-resumed", false, "the data on stdin starts at the offset of the checkpoint which is resumed instead of at the beginning")
 	f.StringArrayVar(&backupOptions.Tags, "tag", nil, "add a `tag` for the new snapshot (can be specified multiple times)")
 	f.StringVar(&backupOptions.Hostname, "hostname", "", "set the `hostname` for the snapshot manually. To prevent an expensive rescan use the \"parent\" flag")
-	f.StringVar(&backupOptions.FilesFrom, "files-from", "", "read the files to backup from file (can be combined with file args)")
+	f.StringArrayVar(&backupOptions.FilesFrom, "files-from", nil, "read the files to backup from `file`, one per line, glob patterns are expanded (can be combined with file args; can be specified multiple times)")
+	f.StringArrayVar(&backupOptions.FilesFromVerbatim, "files-from-verbatim", nil, "read the files to backup from `file`, one per line, taken as they are (can be combined with file args; can be specified multiple times)")
+	f.StringArrayVar(&backupOptions.FilesFromRaw, "files-from-raw", nil, "read the files to backup from `file`, separated by null bytes (can be combined with file args; can be specified multiple times)")
 	f.StringVar(&backupOptions.TimeStamp, "time", "", "time of the backup (ex. '2012-11-01 22:08:41') (default: now)")
 	f.BoolVar(&backupOptions.WithAtime, "with-atime", false, "store the atime for all files and directories")
+	f.IntVar(&backupOptions.Nice, "nice", 0, "lower the CPU priority of the backup process by `n` (0-19)")
+	f.IntVar(&backupOptions.IONiceClass, "ionice-class", 0, "set the I/O scheduling `class` of the backup process: 2 (best-effort) or 3 (idle)")
+	f.IntVar(&backupOptions.IONiceLevel, "ionice-level", 0, "set the I/O priority `level` within the best-effort class (0-7, 7 is the lowest)")
+	f.BoolVar(&backupOptions.ChangeJournal, "use-change-journal", false, "use the NTFS change journal to skip unmodified directories (Windows only, requires administrator privileges)")
+	f.BoolVar(&backupOptions.UseFSSnapshot, "use-fs-snapshot", false, "read the files from a Volume Shadow Copy created before the backup (Windows only, requires administrator privileges)")
+	f.BoolVar(&backupOptions.IgnoreCtime, "ignore-ctime", false, "ignore the change time when comparing files with the parent snapshot")
+	f.BoolVar(&backupOptions.IgnoreInode, "ignore-inode", false, "ignore the inode number when comparing files with the parent snapshot")
+	f.BoolVar(&backupOptions.SkipUnchangedDirs, "skip-unchanged-dirs", false, "do not read directories again whose metadata and entries are unchanged since the parent snapshot (modified files further below are missed until the next full walk)")
+	f.DurationVar(&backupOptions.FullWalkInterval, "full-walk-interval", 7*24*time.Hour, "with --skip-unchanged-dirs, read all directories again when the last full walk is older than `duration` (0 means never)")
+	f.StringArrayVar(&backupOptions.Probes, "probe", nil, "run `name=command` before the backup and store its output as label name in the snapshot (can be specified multiple times)")
+	f.BoolVar(&backupOptions.FileHash, "file-hash", false, "compute the SHA-256 hash of each file which is read and store it in the snapshot")
+	f.StringVar(&backupOptions.InlineSize, "inline-size", "", "store the content of files up to `size` (e.g. 256) in the tree instead of a blob, at most 64K")
+	f.StringVar(&backupOptions.Compression, "compression", "auto", "compress the new blobs with `mode` auto, off or max, if the repository supports it (repository version 3)")
+	f.UintVar(&backupOptions.ReadConcurrency, "read-concurrency", 0, "read and chunk up to `n` files at the same time (default: 10)")
+	f.DurationVar(&backupOptions.Checkpoint, "checkpoint-interval", 0, "save a checkpoint with the files saved so far every `duration` (e.g. 15m), an interrupted backup is resumed from it (0 disables checkpoints)")
+	f.BoolVar(&backupOptions.Canary, "canary", false, "save a small blob with known content with the snapshot, which is verified by 'restic check'")
+	f.BoolVar(&backupOptions.DropPrivileges, "drop-privileges", false, "drop all privileges except reading all files after the repository has been opened (Linux only)")
+	f.DurationVar(&backupOptions.MaxDuration, "max-duration", 0, "stop reading new files after `duration` (e.g. 6h) and save a partial snapshot tagged \"partial\" (0 means no limit)")
+	f.StringVar(&backupOptions.Source, "source", "", "save the data provided by the source plugin `name` instead of local files")
+	f.StringArrayVar(&backupOptions.SourceOptions, "source-option", nil, "set `key=value` for the source plugin (can be specified multiple times)")
+	f.Uint64Var(&backupOptions.MaxGrowthFiles, "max-growth-files", 0, "abort if the targets contain more than `n` files more than the previous snapshot (0 means no limit)")
+	f.StringVar(&backupOptions.MaxGrowthSize, "max-growth-size", "", "abort if the files in the targets are larger than in the previous snapshot by more than `size`, e.g. 100G")
+	f.BoolVar(&backupOptions.AbortOnError, "abort-on-error", false, "abort the backup when a file or directory cannot be read, instead of leaving it out of the snapshot")
+	f.BoolVar(&backupOptions.MaxGrowthWarn, "max-growth-warn", false, "only warn and exit with status 3 when --max-growth-files or --max-growth-size is exceeded")
+	f.Float64Var(&backupOptions.AnomalyThreshold, "anomaly-threshold", 0, "warn and exit with status 3 if the changes exceed the average of the previous snapshots by more than `n` standard deviations (0 disables the check)")
+}
+
+// applyPriority lowers the CPU and I/O priority of the process as requested
+// in opts. Failing to set the priority is not fatal.
+func applyPriority(opts BackupOptions) error {
+	if opts.Nice < 0 || opts.Nice > 19 {
+		return errors.Fatal("--nice must be between 0 and 19")
+	}
+
+	if opts.IONiceClass != 0 && opts.IONiceClass != 2 && opts.IONiceClass != 3 {
+		return errors.Fatal("--ionice-class must be 2 (best-effort) or 3 (idle)")
+	}
+
+	if opts.IONiceLevel < 0 || opts.IONiceLevel > 7 {
+		return errors.Fatal("--ionice-level must be between 0 and 7")
+	}
+
+	ioClass := opts.IONiceClass
+	if ioClass == 0 && opts.IONiceLevel != 0 {
+		// a level without a class selects the best-effort class
+		ioClass = 2
+	}
+
+	if err := setPriority(opts.Nice, ioClass, opts.IONiceLevel); err != nil {
+		Warnf("unable to lower the priority: %v\n", err)
+	}
+
+	return nil
+}
+
+// hideProgress returns true if the progress should not be printed to stdout.
+// When the status socket is used, the progress is updated every second even
+// if stdout is not a terminal, these updates are not printed.
+func hideProgress(gopts GlobalOptions, ticker bool) bool {
+	return gopts.Quiet || IsProcessBackground() || (ticker && !stdoutIsTerminal())
 }
 
 func newScanProgress(gopts GlobalOptions) *restic.Progress {
-	if gopts.Quiet {
+	if gopts.Quiet && statusServer == nil {
 		return nil
 	}
 
 	p := restic.NewProgress()
+	if statusServer != nil {
+		p.SetInterval(time.Second)
+	}
+
 	p.OnUpdate = func(s restic.Stat, d time.Duration, ticker bool) {
-		if IsProcessBackground() {
+		statusServer.Send(status.Event{
+			Type:           "scan",
+			Command:        "backup",
+			SecondsElapsed: uint64(d / time.Second),
+			TotalFiles:     s.Files,
+			TotalBytes:     s.Bytes,
+			ErrorCount:     s.Errors,
+		})
+
+		if hideProgress(gopts, ticker) {
 			return
 		}
 
@@ -105,48 +239,192 @@ func newScanProgress(gopts GlobalOptions) *restic.Progress {
 	}
 
 	p.OnDone = func(s restic.Stat, d time.Duration, ticker bool) {
+		if gopts.Quiet {
+			return
+		}
+
 		PrintProgress("scanned %d directories, %d files in %s\n", s.Dirs, s.Files, formatDuration(d))
 	}
 
 	return p
 }
 
-func newArchiveProgress(gopts GlobalOptions, todo restic.Stat) *restic.Progress {
-	if gopts.Quiet {
+// backupTotal holds the number of items and bytes which the backup will
+// process. It is updated by the scanner, which runs concurrently with the
+// archiver.
+type backupTotal struct {
+	m    sync.Mutex
+	stat restic.Stat
+	done bool
+}
+
+// newBackupTotal returns a backupTotal for a scan which has already finished.
+func newBackupTotal(stat restic.Stat) *backupTotal {
+	return &backupTotal{stat: stat, done: true}
+}
+
+func (t *backupTotal) update(item string, s restic.Stat, done bool) {
+	t.m.Lock()
+	t.stat = s
+	t.done = done
+	t.m.Unlock()
+}
+
+// get returns the totals found so far and whether the scan is complete.
+func (t *backupTotal) get() (restic.Stat, bool) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	return t.stat, t.done
+}
+
+// startScan runs a scanner for the targets in the background, which updates
+// total. The returned function stops the scanner and waits for it to return,
+// it may be called more than once.
+func startScan(ctx context.Context, fsys fs.FS, targets []string, filter func(string, os.FileInfo) bool, total *backupTotal) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	scanner := archiver.NewScanner(fsys)
+	scanner.SelectFilter = filter
+	scanner.Result = total.update
+
+	go func() {
+		defer close(done)
+		err := scanner.Scan(ctx, targets)
+		if err != nil {
+			debug.Log("scan returned error: %v", err)
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// archiveStatus returns the event sent to the status socket during a backup.
+func archiveStatus(tpe string, s, todo restic.Stat, d time.Duration, eta uint64, files []restic.FileProgress) status.Event {
+	ev := status.Event{
+		Type:             tpe,
+		Command:          "backup",
+		SecondsElapsed:   uint64(d / time.Second),
+		SecondsRemaining: eta,
+		TotalFiles:       todo.Files,
+		FilesDone:        s.Files,
+		TotalBytes:       todo.Bytes,
+		BytesDone:        s.Bytes,
+		BytesAdded:       s.Uploaded,
+		ErrorCount:       s.Errors,
+
+		FilesNew:          s.FilesNew,
+		FilesChanged:      s.FilesChanged,
+		FilesUnmodified:   s.FilesUnmodified,
+		BytesDeduplicated: s.Deduplicated,
+	}
+
+	if todo.Bytes > 0 {
+		ev.PercentDone = float64(s.Bytes) / float64(todo.Bytes)
+		if ev.PercentDone > 1 {
+			ev.PercentDone = 1
+		}
+	}
+
+	for _, f := range files {
+		ev.CurrentFiles = append(ev.CurrentFiles, f.Path)
+	}
+
+	return ev
+}
+
+// fileStatus returns the event sent to the status socket for a single file.
+func fileStatus(ev restic.FileEvent) status.Event {
+	sev := status.Event{
+		Type:       "file_" + ev.Type,
+		Command:    "backup",
+		Path:       ev.Path,
+		Action:     string(ev.Action),
+		TotalBytes: ev.Size,
+		BytesDone:  ev.Bytes,
+		BytesAdded: ev.Added,
+	}
+
+	if ev.Err != nil {
+		sev.Message = ev.Err.Error()
+	}
+
+	return sev
+}
+
+func newArchiveProgress(gopts GlobalOptions, total *backupTotal) *restic.Progress {
+	if gopts.Quiet && statusServer == nil {
 		return nil
 	}
 
 	archiveProgress := restic.NewProgress()
+	if statusServer != nil {
+		archiveProgress.SetInterval(time.Second)
+	}
 
-	var bps, eta uint64
-	itemsTodo := todo.Files + todo.Dirs
+	var eta uint64
+	var lines int
+	estimator := newETAEstimator(0)
+
+	// the files currently being read are shown below the status line, this
+	// needs a terminal which understands ANSI escape sequences
+	showFiles := stdoutIsTerminal() && runtime.GOOS != "windows"
 
 	archiveProgress.OnUpdate = func(s restic.Stat, d time.Duration, ticker bool) {
-		if IsProcessBackground() {
-			return
+		todo, scanned := total.get()
+
+		// the throughput is sampled once per second, it already accounts for
+		// data which is skipped because it is in the repository
+		if ticker {
+			estimator.update(s.Bytes, d)
 		}
 
-		sec := uint64(d / time.Second)
-		if todo.Bytes > 0 && sec > 0 && ticker {
-			bps = s.Bytes / sec
-			if s.Bytes >= todo.Bytes {
-				eta = 0
-			} else if bps > 0 {
-				eta = (todo.Bytes - s.Bytes) / bps
-			}
+		// while the scanner is still running, the totals are too low for a
+		// meaningful percentage and ETA
+		estimator.total = todo.Bytes
+		eta = 0
+		if scanned {
+			eta = estimator.eta(s.Bytes)
+		}
+
+		files := archiveProgress.ActiveFiles()
+		ev := archiveStatus("status", s, todo, d, eta, files)
+		if !scanned {
+			ev.PercentDone = 0
+		}
+		statusServer.Send(ev)
+
+		if hideProgress(gopts, ticker) {
+			return
 		}
 
 		itemsDone := s.Files + s.Dirs
 
-		status1 := fmt.Sprintf("[%s] %s  %s / %s  %d / %d items  %d errors  ",
-			formatDuration(d),
-			formatPercent(s.Bytes, todo.Bytes),
-			formatBytes(s.Bytes), formatBytes(todo.Bytes),
-			itemsDone, itemsTodo,
-			s.Errors)
-		status2 := fmt.Sprintf("ETA %s ", formatSeconds(eta))
+		var status1, status2 string
+		if scanned {
+			status1 = fmt.Sprintf("[%s] %s  %s / %s  added %s  %d / %d items  %d errors  ",
+				formatDuration(d),
+				formatPercent(s.Bytes, todo.Bytes),
+				formatBytes(s.Bytes), formatBytes(todo.Bytes),
+				formatBytes(s.Uploaded),
+				itemsDone, todo.Files+todo.Dirs,
+				s.Errors)
+			status2 = fmt.Sprintf("ETA %s ", formatSeconds(eta))
+		} else {
+			status1 = fmt.Sprintf("[%s] %s  added %s  %d items  %d errors  ",
+				formatDuration(d),
+				formatBytes(s.Bytes),
+				formatBytes(s.Uploaded),
+				itemsDone,
+				s.Errors)
+			status2 = fmt.Sprintf("scanning (%d files, %s) ", todo.Files, formatBytes(todo.Bytes))
+		}
 
-		if w := stdoutTerminalWidth(); w > 0 {
+		w := stdoutTerminalWidth()
+		if w > 0 {
 			maxlen := w - len(status2) - 1
 
 			if maxlen < 4 {
@@ -157,16 +435,63 @@ func newArchiveProgress(gopts GlobalOptions, todo restic.Stat) *restic.Progress
 			}
 		}
 
-		PrintProgress("%s%s", status1, status2)
+		if !showFiles {
+			PrintProgress("%s%s", status1, status2)
+			return
+		}
+
+		statusLines := []string{status1 + status2}
+		for _, f := range files {
+			statusLines = append(statusLines, formatFileProgress(f, w))
+		}
+		lines = PrintProgressLines(lines, statusLines)
+	}
+
+	if statusServer != nil {
+		archiveProgress.OnFile = func(ev restic.FileEvent) {
+			statusServer.Send(fileStatus(ev))
+		}
 	}
 
 	archiveProgress.OnDone = func(s restic.Stat, d time.Duration, ticker bool) {
-		fmt.Printf("\nduration: %s\n", formatDuration(d))
+		todo, _ := total.get()
+		statusServer.Send(archiveStatus("summary", s, todo, d, 0, nil))
+
+		if gopts.Quiet {
+			return
+		}
+
+		fmt.Printf("\nduration: %s, processed %s, added %s to the repository\n",
+			formatDuration(d), formatBytes(s.Bytes), formatBytes(s.Uploaded))
 	}
 
 	return archiveProgress
 }
 
+// formatFileProgress returns a status line for a file which is currently
+// being read. The beginning of the path is cut off if the line does not fit
+// into width characters.
+func formatFileProgress(f restic.FileProgress, width int) string {
+	rate := "-"
+	if d := time.Since(f.Start); d > 0 {
+		rate = formatRate(f.Bytes, d)
+	}
+
+	prefix := fmt.Sprintf("  %7s %11s  ", formatPercent(f.Bytes, f.Size), rate)
+	name := f.Path
+
+	if width > 0 {
+		maxlen := width - len(prefix) - 1
+		if maxlen < 4 {
+			name = ""
+		} else if len(name) > maxlen {
+			name = "..." + name[len(name)-maxlen+3:]
+		}
+	}
+
+	return prefix + name
+}
+
 func newArchiveStdinProgress(gopts GlobalOptions) *restic.Progress {
 	if gopts.Quiet {
 		return nil
@@ -213,9 +538,9 @@ func newArchiveStdinProgress(gopts GlobalOptions) *restic.Progress {
 
 // filterExisting returns a slice of all existing items, or an error if no
 // items exist at all.
-func filterExisting(items []string) (result []string, err error) {
+func filterExisting(fsys fs.FS, items []string) (result []string, err error) {
 	for _, item := range items {
-		_, err := fs.Lstat(item)
+		_, err := fsys.Lstat(item)
 		if err != nil && os.IsNotExist(errors.Cause(err)) {
 			Warnf("%v does not exist, skipping\n", item)
 			continue
@@ -236,6 +561,11 @@ func readBackupFromStdin(opts BackupOptions, gopts GlobalOptions, args []string)
 		return errors.Fatal("when reading from stdin, no additional files can be specified")
 	}
 
+	compression, err := repository.ParseCompressionMode(opts.Compression)
+	if err != nil {
+		return errors.Fatalf("invalid --compression: %v", err)
+	}
+
 	fn := opts.StdinFilename
 
 	if fn == "" {
@@ -250,26 +580,105 @@ func readBackupFromStdin(opts BackupOptions, gopts GlobalOptions, args []string)
 		return errors.Fatal("unable to read password from stdin when data is to be read from stdin, use --password-file or $RESTIC_PASSWORD")
 	}
 
+	probes, err := parseProbes(opts.Probes)
+	if err != nil {
+		return err
+	}
+
 	repo, err := OpenRepository(gopts)
 	if err != nil {
 		return err
 	}
 
+	if err = checkNotSealed(repo); err != nil {
+		return err
+	}
+
+	repo.SetCompression(compression)
+
 	lock, err := lockRepo(repo)
 	defer unlockRepo(lock)
 	if err != nil {
 		return err
 	}
 
+	if opts.DropPrivileges {
+		err = dropPrivileges()
+		if err != nil {
+			return err
+		}
+	}
+
 	err = repo.LoadIndex(gopts.ctx)
 	if err != nil {
 		return err
 	}
 
+	var parentSnapshotID *restic.ID
+	if !opts.Force && opts.Parent != "" {
+		id, err := restic.FindSnapshot(repo, opts.Parent)
+		if err != nil {
+			return errors.Fatalf("invalid id %q: %v", opts.Parent, err)
+		}
+
+		parentSnapshotID = &id
+	}
+
+	if !opts.Force && parentSnapshotID == nil {
+		id, err := restic.FindLatestSnapshot(gopts.ctx, repo, []string{fn}, []restic.TagList{}, opts.Hostname)
+		if err == nil {
+			parentSnapshotID = &id
+		} else if err != restic.ErrNoSnapshotFound {
+			return err
+		}
+	}
+
+	if parentSnapshotID != nil {
+		Verbosef("using parent snapshot %v\n", parentSnapshotID.Str())
+	}
+
+	// resume an interrupted backup of the same stream
+	var resume *archiver.StreamCheckpoint
+	if !opts.Force {
+		id, err := restic.FindLatestCheckpoint(gopts.ctx, repo, []string{fn}, opts.Hostname)
+		if err == nil {
+			resume, err = archiver.LoadStreamCheckpoint(gopts.ctx, repo, id, fn)
+			if err != nil {
+				return err
+			}
+			Verbosef("resuming from checkpoint %v at offset %d\n", id.Str(), resume.Offset)
+		} else if err != restic.ErrNoSnapshotFound {
+			return err
+		}
+	}
+
+	if opts.StdinResumed && resume == nil {
+		return errors.Fatal("--stdin-resumed given, but there is no checkpoint to resume from")
+	}
+
+	var timeStamp time.Time
+	if opts.TimeStamp != "" {
+		timeStamp, err = time.Parse(TimeFormat, opts.TimeStamp)
+		if err != nil {
+			return errors.Fatalf("error in time option: %v\n", err)
+		}
+	}
+
 	r := &archiver.Reader{
 		Repository: repo,
 		Tags:       opts.Tags,
 		Hostname:   opts.Hostname,
+		Labels:     runProbes(gopts.ctx, probes),
+		Time:       timeStamp,
+		Parent:     parentSnapshotID,
+		SaveCanary: opts.Canary,
+
+		CheckpointInterval: opts.Checkpoint,
+		OnCheckpoint: func(id restic.ID, offset uint64) {
+			Verbosef("checkpoint %v saved at offset %d\n", id.Str(), offset)
+		},
+		Resume:        resume,
+		ResumedStream: opts.StdinResumed,
 	}
 
 	_, id, err := r.Archive(gopts.ctx, fn, os.Stdin, newArchiveStdinProgress(gopts))
@@ -278,6 +687,7 @@ func readBackupFromStdin(opts BackupOptions, gopts GlobalOptions, args []string)
 	}
 
 	Verbosef("archived as %v\n", id.Str())
+	recordRepositoryStats(gopts.ctx, repo, "backup")
 	return nil
 }
 
@@ -324,11 +734,13 @@ func readLinesFromFile(filename string) ([]string, error) {
 }
 
 func runBackup(opts BackupOptions, gopts GlobalOptions, args []string) error {
-	if opts.FilesFrom == "-" && gopts.password == "" {
+	start := time.Now()
+
+	if filesFromStdin(opts) && gopts.password == "" {
 		return errors.Fatal("unable to read password from stdin when data is to be read from stdin, use --password-file or $RESTIC_PASSWORD")
 	}
 
-	fromfile, err := readLinesFromFile(opts.FilesFrom)
+	fromfile, err := readFilesFrom(opts)
 	if err != nil {
 		return err
 	}
@@ -337,19 +749,71 @@ func runBackup(opts BackupOptions, gopts GlobalOptions, args []string) error {
 	// args checks and have the ability to use both files-from and args at the
 	// same time
 	args = append(args, fromfile...)
-	if len(args) == 0 {
+	if len(args) == 0 && opts.Source == "" {
 		return errors.Fatal("nothing to backup, please specify target files/dirs")
 	}
 
-	target := make([]string, 0, len(args))
-	for _, d := range args {
-		if a, err := filepath.Abs(d); err == nil {
-			d = a
+	if opts.AnomalyThreshold < 0 {
+		return errors.Fatal("--anomaly-threshold must not be negative")
+	}
+
+	if opts.MaxDuration < 0 {
+		return errors.Fatal("--max-duration must not be negative")
+	}
+
+	compression, err := repository.ParseCompressionMode(opts.Compression)
+	if err != nil {
+		return errors.Fatalf("invalid --compression: %v", err)
+	}
+
+	var inlineSize uint64
+	if opts.InlineSize != "" {
+		inlineSize, err = parseSize(opts.InlineSize)
+		if err != nil {
+			return err
 		}
-		target = append(target, d)
+
+		if inlineSize > maxInlineSize {
+			return errors.Fatalf("--inline-size must not be larger than %v", formatBytes(maxInlineSize))
+		}
+	}
+
+	limits := growthLimits{files: opts.MaxGrowthFiles}
+	if opts.MaxGrowthSize != "" {
+		limits.bytes, err = parseSize(opts.MaxGrowthSize)
+		if err != nil {
+			return err
+		}
+	}
+
+	if limits != (growthLimits{}) && (opts.ChangeJournal || opts.SkipUnchangedDirs) {
+		return errors.Fatal("--max-growth-files and --max-growth-size need to scan the targets, they cannot be used with --use-change-journal or --skip-unchanged-dirs")
 	}
 
-	target, err = filterExisting(target)
+	if opts.SkipUnchangedDirs && opts.ChangeJournal {
+		return errors.Fatal("--skip-unchanged-dirs cannot be used with --use-change-journal")
+	}
+
+	if opts.FollowSymlinks && opts.ChangeJournal {
+		return errors.Fatal("--follow-symlinks cannot be used with --use-change-journal")
+	}
+
+	if opts.FollowSymlinks && opts.UseFSSnapshot {
+		return errors.Fatal("--follow-symlinks cannot be used with --use-fs-snapshot")
+	}
+
+	probes, err := parseProbes(opts.Probes)
+	if err != nil {
+		return err
+	}
+
+	srcFS, target, closeSource, err := openBackupSource(opts, gopts, args)
+	if err != nil {
+		return err
+	}
+	defer closeSource()
+
+	target, err = filterExisting(srcFS, target)
 	if err != nil {
 		return err
 	}
@@ -359,7 +823,7 @@ func runBackup(opts BackupOptions, gopts GlobalOptions, args []string) error {
 
 	// allowed devices
 	if opts.ExcludeOtherFS {
-		f, err := rejectByDevice(target)
+		f, err := rejectByDevice(srcFS, target)
 		if err != nil {
 			return err
 		}
@@ -376,11 +840,11 @@ func runBackup(opts BackupOptions, gopts GlobalOptions, args []string) error {
 	}
 
 	if opts.ExcludeCaches {
-		opts.ExcludeIfPresent = append(opts.ExcludeIfPresent, "CACHEDIR.TAG:Signature: 8a477f597d28d172789f06886806bc55")
+		opts.ExcludeIfPresent = append(opts.ExcludeIfPresent, cacheDirTagSpec)
 	}
 
 	for _, spec := range opts.ExcludeIfPresent {
-		f, err := rejectIfPresent(spec)
+		f, err := rejectIfPresent(srcFS, spec)
 		if err != nil {
 			return err
 		}
@@ -393,12 +857,25 @@ func runBackup(opts BackupOptions, gopts GlobalOptions, args []string) error {
 		return err
 	}
 
+	if err = checkNotSealed(repo); err != nil {
+		return err
+	}
+
+	repo.SetCompression(compression)
+
 	lock, err := lockRepo(repo)
 	defer unlockRepo(lock)
 	if err != nil {
 		return err
 	}
 
+	if opts.DropPrivileges {
+		err = dropPrivileges()
+		if err != nil {
+			return err
+		}
+	}
+
 	// exclude restic cache
 	if repo.Cache != nil {
 		f, err := rejectResticCache(repo)
@@ -440,7 +917,25 @@ func runBackup(opts BackupOptions, gopts GlobalOptions, args []string) error {
 		Verbosef("using parent snapshot %v\n", parentSnapshotID.Str())
 	}
 
-	Verbosef("scan %v\n", target)
+	// resume an interrupted backup of the same targets
+	var resumeID *restic.ID
+	if !opts.Force {
+		id, err := restic.FindLatestCheckpoint(gopts.ctx, repo, target, opts.Hostname)
+		if err == nil {
+			resumeID = &id
+			Verbosef("resuming from checkpoint %v\n", id.Str())
+		} else if err != restic.ErrNoSnapshotFound {
+			return err
+		}
+	}
+
+	var history []restic.SnapshotSummary
+	if opts.AnomalyThreshold > 0 {
+		history, err = loadSummaryHistory(gopts.ctx, repo, target, opts.Hostname)
+		if err != nil {
+			return err
+		}
+	}
 
 	selectFilter := func(item string, fi os.FileInfo) bool {
 		for _, reject := range rejectFuncs {
@@ -451,21 +946,135 @@ func runBackup(opts BackupOptions, gopts GlobalOptions, args []string) error {
 		return true
 	}
 
-	stat, err := archiver.Scan(target, selectFilter, newScanProgress(gopts))
-	if err != nil {
-		return err
+	// scanning all files would defeat the purpose of the change journal and
+	// of skipping unchanged directories. The growth limits need the totals
+	// before the backup starts, otherwise the targets are scanned while the
+	// backup is running.
+	var stat restic.Stat
+	total := newBackupTotal(stat)
+	stopScan := func() {}
+	switch {
+	case opts.ChangeJournal || opts.SkipUnchangedDirs:
+	case limits != (growthLimits{}):
+		Verbosef("scan %v\n", target)
+
+		stat, err = archiver.ScanFS(srcFS, target, selectFilter, newScanProgress(gopts))
+		if err != nil {
+			return err
+		}
+		total = newBackupTotal(stat)
+	default:
+		total = &backupTotal{}
+		stopScan = startScan(gopts.ctx, srcFS, target, selectFilter, total)
+		defer stopScan()
+	}
+
+	// the growth is compared to the previous snapshot of the targets, which
+	// is the parent unless --force is used or the parent is partial
+	var (
+		previousID *restic.ID
+		previous   *restic.Snapshot
+	)
+	if limits != (growthLimits{}) {
+		previousID, previous, err = findGrowthBaseline(gopts.ctx, repo, parentSnapshotID, target, opts.Hostname)
+		if err != nil {
+			return err
+		}
+	}
+
+	var growthExceeded bool
+	if previous != nil {
+
+		before, err := restic.LoadSnapshotStats(gopts.ctx, repo, repo.Cache, *previousID, previous)
+		if err != nil {
+			return err
+		}
+
+		for _, v := range checkGrowth(before, stat, limits) {
+			growthExceeded = true
+			Warnf("warning: the targets grew too much, %v\n", v)
+			statusServer.Send(status.Event{
+				Type:    "growth",
+				Command: "backup",
+				Message: fmt.Sprintf("the targets grew too much, %v", v),
+			})
+		}
+
+		if growthExceeded && !opts.MaxGrowthWarn {
+			return errors.Fatalf("backup aborted, the targets grew more than allowed compared to snapshot %v", previousID.Str())
+		}
 	}
 
 	arch := archiver.New(repo)
+	arch.FS = srcFS
 	arch.Excludes = opts.Excludes
 	arch.SelectFilter = selectFilter
 	arch.WithAccessTime = opts.WithAtime
+	arch.UseChangeJournal = opts.ChangeJournal
+	arch.SkipUnchangedDirs = opts.SkipUnchangedDirs
+	if opts.IgnoreCtime {
+		arch.ChangeIgnoreFlags |= restic.ChangeIgnoreCtime
+	}
+	if opts.IgnoreInode {
+		arch.ChangeIgnoreFlags |= restic.ChangeIgnoreInode
+	} else if targetsOnNFS(srcFS, target) {
+		// inode numbers on NFS mounts may change, e.g. when the export is
+		// mounted again
+		Verbosef("targets on NFS found, inode numbers are not compared with the parent snapshot\n")
+		arch.ChangeIgnoreFlags |= restic.ChangeIgnoreInode
+	}
+	arch.FullWalkInterval = opts.FullWalkInterval
+	arch.StoreFileHash = opts.FileHash
+	arch.InlineSize = inlineSize
+	arch.SaveCanary = opts.Canary
+	if opts.ReadConcurrency > 0 {
+		arch.Concurrency = opts.ReadConcurrency
+	}
+	if opts.MaxDuration > 0 {
+		arch.Deadline = start.Add(opts.MaxDuration)
+	}
+	arch.CheckpointInterval = opts.Checkpoint
+	arch.Resume = resumeID
 
 	arch.Warn = func(dir string, fi os.FileInfo, err error) {
-		// TODO: make ignoring errors configurable
 		Warnf("%s\rwarning for %s: %v\n", ClearLine(), dir, err)
 	}
 
+	arch.Error = func(item string, fi os.FileInfo, err error) error {
+		Warnf("%s\rerror for %s: %v\n", ClearLine(), item, err)
+		if opts.AbortOnError {
+			return errors.Fatalf("backup aborted, unable to read %v: %v", item, err)
+		}
+		return nil
+	}
+
+	// run the probes right before the files are read, so that the labels
+	// describe the state at the start of the backup
+	labels := runProbes(gopts.ctx, probes)
+
+	if sfs, ok := srcFS.(*source.FS); ok {
+		meta, err := sfs.Metadata()
+		if err != nil {
+			Warnf("unable to get the metadata of source %v: %v\n", opts.Source, err)
+		}
+
+		for k, v := range meta {
+			if labels == nil {
+				labels = make(map[string]string)
+			}
+			labels[k] = v
+		}
+	}
+
+	arch.BeforeSave = func(ctx context.Context, sn *restic.Snapshot) error {
+		sn.Labels = labels
+		sn.Summary = summarizeSnapshot(ctx, repo, parentSnapshotID, sn)
+		if sn.Summary != nil {
+			sn.Summary.BackendUsage = backendUsage()
+		}
+		return nil
+	}
+
 	timeStamp := time.Now()
 	if opts.TimeStamp != "" {
 		timeStamp, err = time.Parse(TimeFormat, opts.TimeStamp)
@@ -474,16 +1083,128 @@ func runBackup(opts BackupOptions, gopts GlobalOptions, args []string) error {
 		}
 	}
 
-	_, id, err := arch.Snapshot(gopts.ctx, newArchiveProgress(gopts, stat), target, opts.Tags, opts.Hostname, parentSnapshotID, timeStamp)
+	sn, id, err := arch.Snapshot(gopts.ctx, newArchiveProgress(gopts, total), target, opts.Tags, opts.Hostname, parentSnapshotID, timeStamp)
+	stopScan()
 	if err != nil {
 		return err
 	}
 
+	if sn.Summary != nil {
+		printSnapshotSummary(sn.Summary)
+	}
+	printDedupStats(arch.DedupStats)
+	printBackendUsage(backendUsage())
+
 	Verbosef("snapshot %s saved\n", id.Str())
+	if sn.ErrorCount > 0 {
+		Warnf("warning: %d files or directories could not be read and are missing in snapshot %s\n", sn.ErrorCount, id.Str())
+	}
+	recordRepositoryStats(gopts.ctx, repo, "backup")
+
+	if sn.HasTags([]string{archiver.PartialTag}) {
+		Warnf("backup stopped after %v, snapshot %s is incomplete, the next backup continues with the remaining files\n", opts.MaxDuration, id.Str())
+		return errAttention
+	}
+
+	if opts.AnomalyThreshold > 0 && sn.Summary != nil {
+		anomalies := detectAnomalies(history, *sn.Summary, opts.AnomalyThreshold)
+		for _, a := range anomalies {
+			Warnf("warning: unusual changes in snapshot %s, %v\n", id.Str(), a)
+			statusServer.Send(status.Event{
+				Type:    "anomaly",
+				Command: "backup",
+				Message: fmt.Sprintf("unusual changes in snapshot %s, %v", id.Str(), a),
+			})
+		}
+
+		if len(anomalies) > 0 {
+			return errAttention
+		}
+	}
+
+	if growthExceeded {
+		return errAttention
+	}
 
 	return nil
 }
 
+// targetsOnNFS returns true if one of the targets in the local file system is
+// stored on an NFS mount.
+func targetsOnNFS(fsys fs.FS, targets []string) bool {
+	if _, ok := fsys.(fs.Local); !ok {
+		return false
+	}
+
+	for _, target := range targets {
+		nfs, err := fs.IsNFS(target)
+		if err != nil {
+			debug.Log("unable to find the file system type of %v: %v", target, err)
+			continue
+		}
+		if nfs {
+			return true
+		}
+	}
+
+	return false
+}
+
+// summarizeSnapshot compares the new snapshot sn with its parent. Errors are
+// printed as warnings, and nil is returned.
+func summarizeSnapshot(ctx context.Context, repo restic.Repository, parentID *restic.ID, sn *restic.Snapshot) *restic.SnapshotSummary {
+	var parentTree restic.ID
+	if parentID != nil {
+		parent, err := restic.LoadSnapshot(ctx, repo, *parentID)
+		if err != nil {
+			Warnf("unable to load parent snapshot for the summary: %v\n", err)
+			return nil
+		}
+		parentTree = *parent.Tree
+	}
+
+	summary, err := diffSummary(ctx, repo, parentTree, *sn.Tree)
+	if err != nil {
+		Warnf("unable to compute the summary of changes: %v\n", err)
+		return nil
+	}
+
+	return summary
+}
+
+func printSnapshotSummary(s *restic.SnapshotSummary) {
+	Verbosef("\n")
+	Verbosef("Files:  %5d new, %5d removed, %5d changed\n", s.FilesNew, s.FilesRemoved, s.FilesChanged)
+	Verbosef("Dirs:   %5d new, %5d removed\n", s.DirsNew, s.DirsRemoved)
+	Verbosef("Added:  %s\n", formatBytes(s.DataAdded))
+	Verbosef("\n")
+}
+
+// printDedupStats prints how many of the chunks read were new and how many
+// were already stored in the repository, for each backup target.
+func printDedupStats(stats *archiver.DedupStats) {
+	total := stats.Total()
+	if total.NewChunks+total.KnownChunks == 0 {
+		return
+	}
+
+	format := func(c archiver.DedupCounter) string {
+		return fmt.Sprintf("%d new (%s), %d already stored (%s), %s deduplicated",
+			c.NewChunks, formatBytes(c.NewBytes), c.KnownChunks, formatBytes(c.KnownBytes),
+			formatPercent(c.KnownBytes, c.NewBytes+c.KnownBytes))
+	}
+
+	Verbosef("Chunks: %s\n", format(total))
+
+	dirs := stats.Dirs()
+	if len(dirs) > 1 {
+		for _, dir := range dirs {
+			Verbosef("  %v: %s\n", dir.Path, format(dir.DedupCounter))
+		}
+	}
+	Verbosef("\n")
+}
+
 func readExcludePatternsFromFiles(excludeFiles []string) []string {
 	var excludes []string
 	for _, filename := range excludeFiles {
@@ -0,0 +1,671 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+)
+
+var cmdBrowse = &cobra.Command{
+	Use:   "browse [flags] [snapshotID ...]",
+	Short: "Browse snapshots interactively",
+	Long: `
+The "browse" command shows an interactive view of the snapshots in the
+repository. Snapshots and directories are opened with Enter and left with
+Backspace, files and directories can be marked with Space and then be restored
+to a directory. A single file can be saved to another file.
+
+Keys:
+
+  Up/Down, PgUp/PgDn     move the cursor
+  Enter, Right           open the snapshot or directory
+  Backspace, Left        go back to the parent directory
+  Space                  mark or unmark the file or directory
+  r                      restore the marked items (or the item at the cursor)
+  d                      save the file at the cursor to another file
+  q                      quit
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runBrowse(browseOptions, globalOptions, args)
+	},
+}
+
+// BrowseOptions collects all options for the browse command.
+type BrowseOptions struct {
+	Host  string
+	Tags  restic.TagLists
+	Paths []string
+}
+
+var browseOptions BrowseOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdBrowse)
+
+	flags := cmdBrowse.Flags()
+	flags.StringVarP(&browseOptions.Host, "host", "H", "", "only consider snapshots for this `host`")
+	flags.Var(&browseOptions.Tags, "tag", "only consider snapshots which include this `taglist`")
+	flags.StringArrayVar(&browseOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path`")
+}
+
+func runBrowse(opts BrowseOptions, gopts GlobalOptions, args []string) error {
+	if !stdinIsTerminal() || !stdoutIsTerminal() {
+		return errors.Fatal("the browse command needs to be run in a terminal")
+	}
+
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		lock, err := lockRepo(repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = repo.LoadIndex(gopts.ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(gopts.ctx)
+	defer cancel()
+
+	var snapshots []*restic.Snapshot
+	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, args) {
+		snapshots = append(snapshots, sn)
+	}
+
+	if len(snapshots) == 0 {
+		return errors.Fatal("no snapshots found")
+	}
+
+	// show the most recent snapshots first
+	sort.Sort(restic.Snapshots(snapshots))
+
+	fd := int(os.Stdin.Fd())
+	state, err := terminal.MakeRaw(fd)
+	if err != nil {
+		return errors.Wrap(err, "MakeRaw")
+	}
+	defer terminal.Restore(fd, state)
+
+	// use the alternate screen and hide the cursor
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+
+	b := newBrowser(ctx, repo, snapshots)
+	return b.run(bufio.NewReader(os.Stdin), os.Stdout)
+}
+
+// browseEntry is a line in the browser, either a snapshot or a node within a
+// snapshot.
+type browseEntry struct {
+	sn   *restic.Snapshot
+	node *restic.Node
+}
+
+// browseView is a list of entries, either the list of snapshots or the
+// contents of a directory within a snapshot.
+type browseView struct {
+	sn      *restic.Snapshot
+	path    string
+	entries []browseEntry
+
+	cursor, offset int
+}
+
+// browser is the state of the browse command.
+type browser struct {
+	ctx  context.Context
+	repo *repository.Repository
+
+	views   []*browseView
+	marked  map[restic.ID]map[string]struct{}
+	message string
+
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func newBrowser(ctx context.Context, repo *repository.Repository, snapshots []*restic.Snapshot) *browser {
+	v := &browseView{}
+	for _, sn := range snapshots {
+		v.entries = append(v.entries, browseEntry{sn: sn})
+	}
+
+	return &browser{
+		ctx:     ctx,
+		repo:    repo,
+		views:   []*browseView{v},
+		marked:  make(map[restic.ID]map[string]struct{}),
+		message: "Enter: open, Space: mark, r: restore, d: save file, q: quit",
+	}
+}
+
+func (b *browser) view() *browseView {
+	return b.views[len(b.views)-1]
+}
+
+func (b *browser) current() (browseEntry, bool) {
+	v := b.view()
+	if len(v.entries) == 0 {
+		return browseEntry{}, false
+	}
+	return v.entries[v.cursor], true
+}
+
+// entryPath returns the path of the entry within the snapshot.
+func (v *browseView) entryPath(e browseEntry) string {
+	return filepath.Join(v.path, e.node.Name)
+}
+
+// markedPaths returns the sorted list of paths marked in the snapshot sn.
+func (b *browser) markedPaths(sn *restic.Snapshot) []string {
+	var paths []string
+	for p := range b.marked[*sn.ID()] {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (b *browser) isMarked(sn *restic.Snapshot, path string) bool {
+	_, ok := b.marked[*sn.ID()][path]
+	return ok
+}
+
+func (b *browser) toggleMark(sn *restic.Snapshot, path string) {
+	id := *sn.ID()
+	if b.marked[id] == nil {
+		b.marked[id] = make(map[string]struct{})
+	}
+
+	if _, ok := b.marked[id][path]; ok {
+		delete(b.marked[id], path)
+		return
+	}
+	b.marked[id][path] = struct{}{}
+}
+
+// open loads the snapshot or directory at the cursor.
+func (b *browser) open() error {
+	e, ok := b.current()
+	if !ok {
+		return nil
+	}
+
+	var (
+		sn   *restic.Snapshot
+		path string
+		id   restic.ID
+	)
+
+	switch {
+	case e.node == nil:
+		sn = e.sn
+		path = string(filepath.Separator)
+		id = *sn.Tree
+	case e.node.Type == "dir" && e.node.Subtree != nil:
+		sn = b.view().sn
+		path = b.view().entryPath(e)
+		id = *e.node.Subtree
+	default:
+		return nil
+	}
+
+	tree, err := b.repo.LoadTree(b.ctx, id)
+	if err != nil {
+		return err
+	}
+
+	v := &browseView{sn: sn, path: path}
+	for _, node := range tree.Nodes {
+		v.entries = append(v.entries, browseEntry{node: node})
+	}
+
+	b.views = append(b.views, v)
+	return nil
+}
+
+// back returns to the parent directory or the list of snapshots.
+func (b *browser) back() {
+	if len(b.views) > 1 {
+		b.views = b.views[:len(b.views)-1]
+	}
+}
+
+// move moves the cursor by n lines.
+func (b *browser) move(n int) {
+	v := b.view()
+	v.cursor += n
+	if v.cursor >= len(v.entries) {
+		v.cursor = len(v.entries) - 1
+	}
+	if v.cursor < 0 {
+		v.cursor = 0
+	}
+}
+
+// selectPaths returns a filter for the restorer which selects the given
+// paths including all their contents.
+func selectPaths(paths []string) func(item string, dstpath string, node *restic.Node) (bool, bool) {
+	return func(item string, dstpath string, node *restic.Node) (bool, bool) {
+		for _, p := range paths {
+			if item == p || fs.HasPathPrefix(p, item) {
+				return true, node.Type == "dir"
+			}
+		}
+
+		// descend into the parent directories of the selected paths
+		for _, p := range paths {
+			if fs.HasPathPrefix(item, p) {
+				return false, node.Type == "dir"
+			}
+		}
+
+		return false, false
+	}
+}
+
+// restore restores the marked items, or the item at the cursor if nothing is
+// marked, to a directory.
+func (b *browser) restore() error {
+	v := b.view()
+
+	e, ok := b.current()
+	if !ok {
+		return nil
+	}
+
+	// in the list of snapshots, the snapshot at the cursor is restored
+	sn := v.sn
+	if sn == nil {
+		sn = e.sn
+	}
+
+	paths := b.markedPaths(sn)
+	if len(paths) == 0 && v.sn != nil {
+		paths = []string{v.entryPath(e)}
+	}
+
+	what := fmt.Sprintf("snapshot %v", sn.ID().Str())
+	if len(paths) > 0 {
+		what = fmt.Sprintf("%d items of %s", len(paths), what)
+	}
+
+	target, ok, err := b.prompt(fmt.Sprintf("restore %s to directory: ", what))
+	if err != nil || !ok {
+		return err
+	}
+
+	res, err := restic.NewRestorer(b.repo, *sn.ID())
+	if err != nil {
+		return err
+	}
+
+	var errs int
+	res.Error = func(dir string, node *restic.Node, err error) error {
+		debug.Log("error restoring %v: %v", dir, err)
+		errs++
+		return nil
+	}
+
+	if len(paths) > 0 {
+		res.SelectFilter = selectPaths(paths)
+	}
+
+	b.message = fmt.Sprintf("restoring %s to %s", what, target)
+	b.render()
+
+	err = res.RestoreTo(b.ctx, target)
+	if err != nil {
+		return err
+	}
+
+	b.message = fmt.Sprintf("restored %s to %s, %d errors", what, target, errs)
+	return nil
+}
+
+// dump saves the file at the cursor to another file.
+func (b *browser) dump() error {
+	e, ok := b.current()
+	if !ok || e.node == nil || e.node.Type != "file" {
+		b.message = "only files can be saved"
+		return nil
+	}
+
+	filename, ok, err := b.prompt(fmt.Sprintf("save %s to file: ", e.node.Name))
+	if err != nil || !ok {
+		return err
+	}
+
+	f, err := fs.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = dumpNode(b.ctx, b.repo, e.node, f)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	b.message = fmt.Sprintf("saved %s to %s", e.node.Name, filename)
+	return nil
+}
+
+// prompt asks the user for a line of text. It returns false if the input is
+// empty or has been cancelled.
+func (b *browser) prompt(msg string) (string, bool, error) {
+	var line []rune
+	for {
+		b.message = msg + string(line)
+		b.render()
+
+		key, r, err := readKey(b.in)
+		if err != nil {
+			return "", false, err
+		}
+
+		switch key {
+		case keyEnter:
+			b.message = ""
+			return string(line), len(line) > 0, nil
+		case keyEscape, keyCtrlC:
+			b.message = ""
+			return "", false, nil
+		case keyBackspace:
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+			}
+		case keyRune:
+			line = append(line, r)
+		}
+	}
+}
+
+// run handles input until the user quits.
+func (b *browser) run(in *bufio.Reader, out io.Writer) error {
+	b.in = in
+	b.out = out
+
+	for {
+		b.render()
+
+		key, r, err := readKey(in)
+		if err != nil {
+			return err
+		}
+
+		if key == keyRune {
+			switch r {
+			case 'q':
+				return nil
+			case 'k':
+				key = keyUp
+			case 'j':
+				key = keyDown
+			case 'l':
+				key = keyRight
+			case 'h':
+				key = keyLeft
+			case ' ':
+				key = keySpace
+			}
+		}
+
+		var actionErr error
+		switch key {
+		case keyCtrlC:
+			return nil
+		case keyUp:
+			b.move(-1)
+		case keyDown:
+			b.move(1)
+		case keyPageUp:
+			b.move(-b.listHeight())
+		case keyPageDown:
+			b.move(b.listHeight())
+		case keyHome:
+			b.move(-len(b.view().entries))
+		case keyEnd:
+			b.move(len(b.view().entries))
+		case keyEnter, keyRight:
+			actionErr = b.open()
+		case keyBackspace, keyLeft:
+			b.back()
+		case keySpace:
+			v := b.view()
+			if e, ok := b.current(); ok && v.sn != nil {
+				b.toggleMark(v.sn, v.entryPath(e))
+				b.move(1)
+			}
+		case keyRune:
+			switch r {
+			case 'r':
+				actionErr = b.restore()
+			case 'd':
+				actionErr = b.dump()
+			}
+		}
+
+		if actionErr != nil {
+			debug.Log("error: %v", actionErr)
+			b.message = fmt.Sprintf("error: %v", actionErr)
+		}
+	}
+}
+
+// terminalSize returns the size of the terminal with a sane default.
+func terminalSize() (width, height int) {
+	width, height, err := terminal.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		return 80, 24
+	}
+	return width, height
+}
+
+// listHeight returns the number of lines available for entries, the
+// remaining lines are used for the header and the message.
+func (b *browser) listHeight() int {
+	_, height := terminalSize()
+	if height < 4 {
+		return 1
+	}
+	return height - 3
+}
+
+// formatEntry returns the line shown for an entry.
+func (b *browser) formatEntry(v *browseView, e browseEntry) string {
+	if e.node == nil {
+		return fmt.Sprintf("  %s  %s  %-20s  %s", e.sn.ID().Str(), e.sn.Time.Format(TimeFormat),
+			e.sn.Hostname, strings.Join(e.sn.Paths, ", "))
+	}
+
+	mark := " "
+	if b.isMarked(v.sn, v.entryPath(e)) {
+		mark = "*"
+	}
+
+	name := e.node.Name
+	if e.node.Type == "dir" {
+		name += "/"
+	}
+
+	return fmt.Sprintf("%s %-7s %10s  %s  %s", mark, e.node.Type, formatBytes(e.node.Size),
+		e.node.ModTime.Format(TimeFormat), name)
+}
+
+// fitLine cuts s so that it fits into a line of the given width.
+func fitLine(s string, width int) string {
+	r := []rune(s)
+	if len(r) >= width {
+		r = r[:width-1]
+	}
+	return string(r)
+}
+
+// render draws the current view.
+func (b *browser) render() {
+	width, _ := terminalSize()
+	height := b.listHeight()
+	v := b.view()
+
+	// keep the cursor visible
+	if v.cursor < v.offset {
+		v.offset = v.cursor
+	}
+	if v.cursor >= v.offset+height {
+		v.offset = v.cursor - height + 1
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("\x1b[H\x1b[2J")
+
+	header := fmt.Sprintf("%d snapshots", len(v.entries))
+	if v.sn != nil {
+		header = fmt.Sprintf("snapshot %s of %s at %s: %s, %d marked", v.sn.ID().Str(), v.sn.Hostname,
+			v.sn.Time.Format(TimeFormat), v.path, len(b.marked[*v.sn.ID()]))
+	}
+	buf.WriteString("\x1b[1m" + fitLine(header, width) + "\x1b[0m\r\n")
+
+	for i := v.offset; i < len(v.entries) && i < v.offset+height; i++ {
+		line := fitLine(b.formatEntry(v, v.entries[i]), width)
+		if i == v.cursor {
+			line = "\x1b[7m" + line + "\x1b[0m"
+		}
+		buf.WriteString(line + "\r\n")
+	}
+
+	fmt.Fprintf(&buf, "\x1b[%d;1H%s", height+3, fitLine(b.message, width))
+	_, _ = io.WriteString(b.out, buf.String())
+}
+
+// key is a key pressed by the user.
+type key int
+
+const (
+	keyRune key = iota
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyPageUp
+	keyPageDown
+	keyHome
+	keyEnd
+	keyEnter
+	keySpace
+	keyBackspace
+	keyEscape
+	keyCtrlC
+	keyUnknown
+)
+
+// readKey reads a key press from a terminal in raw mode. For printable
+// characters, keyRune and the character are returned.
+func readKey(rd *bufio.Reader) (key, rune, error) {
+	r, _, err := rd.ReadRune()
+	if err != nil {
+		return keyUnknown, 0, err
+	}
+
+	switch r {
+	case '\r', '\n':
+		return keyEnter, 0, nil
+	case 0x7f, 0x08:
+		return keyBackspace, 0, nil
+	case 0x03:
+		return keyCtrlC, 0, nil
+	case 0x1b:
+		// a lone escape is sent without any further bytes
+		if rd.Buffered() == 0 {
+			return keyEscape, 0, nil
+		}
+		return readEscapeSequence(rd)
+	}
+
+	if r < ' ' {
+		return keyUnknown, 0, nil
+	}
+
+	return keyRune, r, nil
+}
+
+// readEscapeSequence parses the rest of an escape sequence, e.g. "[A" for the
+// up arrow.
+func readEscapeSequence(rd *bufio.Reader) (key, rune, error) {
+	c, err := rd.ReadByte()
+	if err != nil {
+		return keyUnknown, 0, err
+	}
+
+	if c != '[' && c != 'O' {
+		return keyUnknown, 0, nil
+	}
+
+	var param []byte
+	for {
+		c, err = rd.ReadByte()
+		if err != nil {
+			return keyUnknown, 0, err
+		}
+
+		if c < '0' || c > '9' {
+			break
+		}
+		param = append(param, c)
+	}
+
+	switch c {
+	case 'A':
+		return keyUp, 0, nil
+	case 'B':
+		return keyDown, 0, nil
+	case 'C':
+		return keyRight, 0, nil
+	case 'D':
+		return keyLeft, 0, nil
+	case 'H':
+		return keyHome, 0, nil
+	case 'F':
+		return keyEnd, 0, nil
+	case '~':
+		switch string(param) {
+		case "1", "7":
+			return keyHome, 0, nil
+		case "4", "8":
+			return keyEnd, 0, nil
+		case "5":
+			return keyPageUp, 0, nil
+		case "6":
+			return keyPageDown, 0, nil
+		}
+	}
+
+	return keyUnknown, 0, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestBrowseSelectPaths(t *testing.T) {
+	p := func(s string) string {
+		return filepath.FromSlash(s)
+	}
+
+	filter := selectPaths([]string{p("/home/user/work"), p("/etc/fstab")})
+
+	var tests = []struct {
+		item     string
+		dir      bool
+		selected bool
+		descend  bool
+	}{
+		{"/home", true, false, true},
+		{"/home/user", true, false, true},
+		{"/home/user/work", true, true, true},
+		{"/home/user/work/foo.txt", false, true, false},
+		{"/home/user/workspace", true, false, false},
+		{"/home/other", true, false, false},
+		{"/etc", true, false, true},
+		{"/etc/fstab", false, true, false},
+		{"/etc/hosts", false, false, false},
+		{"/usr", true, false, false},
+	}
+
+	for _, test := range tests {
+		node := &restic.Node{Type: "file"}
+		if test.dir {
+			node.Type = "dir"
+		}
+
+		selected, descend := filter(p(test.item), "", node)
+		if selected != test.selected || descend != test.descend {
+			t.Errorf("%v: want (%v, %v), got (%v, %v)", test.item, test.selected, test.descend, selected, descend)
+		}
+	}
+}
+
+func TestBrowseReadKey(t *testing.T) {
+	rd := bufio.NewReader(strings.NewReader("\x1b[A\x1b[B\x1bOC\x1b[5~\x1b[6~x\r\x7f\x03"))
+
+	want := []key{keyUp, keyDown, keyRight, keyPageUp, keyPageDown, keyRune, keyEnter, keyBackspace, keyCtrlC}
+	for _, w := range want {
+		k, r, err := readKey(rd)
+		rtest.OK(t, err)
+		rtest.Equals(t, w, k)
+		if k == keyRune {
+			rtest.Equals(t, 'x', r)
+		}
+	}
+}
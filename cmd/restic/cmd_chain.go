@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/spf13/cobra"
+)
+
+var cmdChain = &cobra.Command{
+	Use:   "chain [flags] [snapshotID ...]",
+	Short: "Show the chain of parent snapshots",
+	Long: `
+The "chain" command follows the parent links of a snapshot and prints the
+snapshots the backup was based on, starting with the given snapshot. For each
+snapshot, it shows how unchanged files were detected:
+
+  none     all files were read, no parent was used (first backup or --force)
+  parent   files with the same metadata as in the parent were not read again
+  journal  only the files reported by the change journal were read
+
+Without a snapshot ID, the chain of the latest snapshot for each host and
+path is printed. The special snapshot ID "latest" can be used as well.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runChain(chainOptions, globalOptions, args)
+	},
+}
+
+// ChainOptions bundles all options for the chain command.
+type ChainOptions struct {
+	Host  string
+	Tags  restic.TagLists
+	Paths []string
+	Max   int
+}
+
+var chainOptions ChainOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdChain)
+
+	f := cmdChain.Flags()
+	f.StringVarP(&chainOptions.Host, "host", "H", "", "only consider snapshots for this `host`")
+	f.Var(&chainOptions.Tags, "tag", "only consider snapshots which include this `taglist` (can be specified multiple times)")
+	f.StringArrayVar(&chainOptions.Paths, "path", nil, "only consider snapshots for this `path` (can be specified multiple times)")
+	f.IntVar(&chainOptions.Max, "max", 0, "print at most `n` snapshots of each chain (0 means no limit)")
+}
+
+// snapshotChain is a snapshot and its ancestors, starting with the snapshot
+// itself.
+type snapshotChain struct {
+	Snapshots []Snapshot `json:"snapshots"`
+
+	// MissingParent is set when the chain ends because the parent of the
+	// last snapshot has been removed, e.g. by forget.
+	MissingParent *restic.ID `json:"missing_parent,omitempty"`
+}
+
+// loadChain follows the parent links starting at sn. At most max snapshots
+// are returned, zero means no limit. The chain ends at a parent which does
+// not exist any more.
+func loadChain(ctx context.Context, repo *repository.Repository, sn *restic.Snapshot, max int) (snapshotChain, error) {
+	var chain snapshotChain
+	seen := restic.NewIDSet()
+
+	for {
+		chain.Snapshots = append(chain.Snapshots, Snapshot{Snapshot: sn, ID: sn.ID(), ShortID: sn.ID().Str()})
+		seen.Insert(*sn.ID())
+
+		if sn.Parent == nil || seen.Has(*sn.Parent) || (max > 0 && len(chain.Snapshots) >= max) {
+			return chain, nil
+		}
+
+		// loading a missing file is retried by the backend, so test first
+		h := restic.Handle{Type: restic.SnapshotFile, Name: sn.Parent.String()}
+		found, err := repo.Backend().Test(ctx, h)
+		if err != nil {
+			return chain, err
+		}
+		if !found {
+			chain.MissingParent = sn.Parent
+			return chain, nil
+		}
+
+		parent, err := restic.LoadSnapshot(ctx, repo, *sn.Parent)
+		if err != nil {
+			return chain, errors.Fatalf("unable to load parent snapshot %v: %v", sn.Parent.Str(), err)
+		}
+		sn = parent
+	}
+}
+
+func runChain(opts ChainOptions, gopts GlobalOptions, args []string) error {
+	if opts.Max < 0 {
+		return errors.Fatal("--max must not be negative")
+	}
+
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		lock, err := lockRepo(repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(gopts.ctx)
+	defer cancel()
+
+	var list restic.Snapshots
+	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, args) {
+		list = append(list, sn)
+	}
+
+	if len(args) == 0 {
+		list = FilterLastSnapshots(list)
+	}
+
+	chains := []snapshotChain{}
+	for _, sn := range list {
+		chain, err := loadChain(ctx, repo, sn, opts.Max)
+		if err != nil {
+			return err
+		}
+		chains = append(chains, chain)
+	}
+
+	if gopts.JSON {
+		return json.NewEncoder(gopts.stdout).Encode(chains)
+	}
+
+	for i, chain := range chains {
+		if i > 0 {
+			Printf("\n")
+		}
+		printChain(gopts.stdout, chain)
+	}
+
+	return nil
+}
+
+// printChain prints a text table of the snapshots in chain.
+func printChain(stdout io.Writer, chain snapshotChain) {
+	sn := chain.Snapshots[0]
+	fmt.Fprintf(stdout, "chain of snapshot %v (host %v, paths %v):\n", sn.ShortID, sn.Hostname, sn.Paths)
+
+	tab := NewTable()
+	tab.Header = fmt.Sprintf("%-8s  %-19s  %-8s  %-9s  %7s  %7s  %7s  %10s", "ID", "Date", "Parent", "Detection", "New", "Changed", "Removed", "Added")
+	tab.RowFormat = "%-8s  %-19s  %-8s  %-9s  %7v  %7v  %7v  %10s"
+
+	for _, sn := range chain.Snapshots {
+		parent := ""
+		if sn.Parent != nil {
+			parent = sn.Parent.Str()
+		}
+
+		detection := sn.ChangeDetection
+		if detection == "" {
+			// created by an older version of restic
+			detection = "?"
+		}
+
+		if sn.Summary == nil {
+			tab.Rows = append(tab.Rows, []interface{}{sn.ShortID, sn.Time.Format(TimeFormat), parent, detection, "", "", "", ""})
+			continue
+		}
+
+		s := sn.Summary
+		tab.Rows = append(tab.Rows, []interface{}{sn.ShortID, sn.Time.Format(TimeFormat), parent, detection,
+			s.FilesNew, s.FilesChanged, s.FilesRemoved, formatBytes(s.DataAdded)})
+	}
+
+	tab.Footer = fmt.Sprintf("%d snapshots", len(chain.Snapshots))
+	if chain.MissingParent != nil {
+		tab.Footer += fmt.Sprintf(", parent %v has been removed", chain.MissingParent.Str())
+	}
+
+	tab.Write(stdout)
+}
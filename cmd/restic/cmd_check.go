@@ -1,14 +1,18 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/restic/restic/internal/backend/location"
+	"github.com/restic/restic/internal/backend/s3"
 	"github.com/restic/restic/internal/checker"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
@@ -23,6 +27,17 @@ finds. It can also be used to read all data and therefore simulate a restore.
 
 By default, the "check" command will always load all data directly from the
 repository and not use a local cache.
+
+When data is read, the time each pack file was verified is recorded in a
+ledger in the repository, and the pack files which have never been verified or
+were verified the longest time ago are read first. With --read-data-limit, only
+about the given amount of data is read on each run, so that all data is read
+progressively over several runs. The check reports how many of the pack files
+have been verified and since when all data was verified.
+
+For each host and set of paths, the canary of the latest snapshot which has
+one (see "restic backup --canary") is downloaded and compared to its expected
+content.
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -37,8 +52,10 @@ repository and not use a local cache.
 type CheckOptions struct {
 	ReadData       bool
 	ReadDataSubset string
+	ReadDataLimit  string
 	CheckUnused    bool
 	WithCache      bool
+	Inventory      string
 }
 
 var checkOptions CheckOptions
@@ -49,8 +66,10 @@ func init() {
 	f := cmdCheck.Flags()
 	f.BoolVar(&checkOptions.ReadData, "read-data", false, "read all data blobs")
 	f.StringVar(&checkOptions.ReadDataSubset, "read-data-subset", "", "read subset of data packs")
+	f.StringVar(&checkOptions.ReadDataLimit, "read-data-limit", "", "read the least recently verified data packs up to `size`")
 	f.BoolVar(&checkOptions.CheckUnused, "check-unused", false, "find unused blobs")
 	f.BoolVar(&checkOptions.WithCache, "with-cache", false, "use the cache")
+	f.StringVar(&checkOptions.Inventory, "inventory", "", "compare the index with the S3 Inventory report in `file` (manifest.json or CSV) instead of listing all pack files")
 }
 
 func checkFlags(opts CheckOptions) error {
@@ -66,6 +85,14 @@ func checkFlags(opts CheckOptions) error {
 			return errors.Fatalf("check flag --read-data-subset=n/t values must be positive integers, and n <= t, e.g. --read-data-subset=1/2")
 		}
 	}
+	if opts.ReadDataLimit != "" {
+		if opts.ReadData || opts.ReadDataSubset != "" {
+			return errors.Fatalf("check flag --read-data-limit cannot be used together with --read-data or --read-data-subset")
+		}
+		if _, err := parseSize(opts.ReadDataLimit); err != nil {
+			return errors.Fatalf("check flag --read-data-limit: %v", err)
+		}
+	}
 
 	return nil
 }
@@ -117,6 +144,31 @@ func newReadProgress(gopts GlobalOptions, todo restic.Stat) *restic.Progress {
 	return readProgress
 }
 
+// readInventory returns the pack files of the repository listed in the S3
+// Inventory report in the file name.
+func readInventory(gopts GlobalOptions, name string) (restic.IDSet, error) {
+	loc, err := location.Parse(gopts.Repo)
+	if err != nil {
+		return nil, errors.Fatalf("parsing repository location failed: %v", err)
+	}
+
+	cfg, ok := loc.Config.(s3.Config)
+	if !ok {
+		return nil, errors.Fatal("--inventory can only be used with an s3 repository")
+	}
+
+	inv, err := s3.ReadInventory(name, cfg.Bucket, cfg.Prefix)
+	if err != nil {
+		return nil, errors.Fatalf("unable to read inventory: %v", err)
+	}
+
+	if !inv.Created.IsZero() {
+		Verbosef("inventory created at %v\n", inv.Created.Local().Format(TimeFormat))
+	}
+
+	return inv.DataFiles, nil
+}
+
 func runCheck(opts CheckOptions, gopts GlobalOptions, args []string) error {
 	if len(args) != 0 {
 		return errors.Fatal("check has no arguments")
@@ -168,8 +220,18 @@ func runCheck(opts CheckOptions, gopts GlobalOptions, args []string) error {
 	errorsFound := false
 	errChan := make(chan error)
 
-	Verbosef("check all packs\n")
-	go chkr.Packs(gopts.ctx, errChan)
+	if opts.Inventory != "" {
+		packs, err := readInventory(gopts, opts.Inventory)
+		if err != nil {
+			return err
+		}
+
+		Verbosef("check all packs against the inventory (%d packs)\n", len(packs))
+		go chkr.PacksFromList(gopts.ctx, packs, errChan)
+	} else {
+		Verbosef("check all packs\n")
+		go chkr.Packs(gopts.ctx, errChan)
+	}
 
 	for err := range errChan {
 		errorsFound = true
@@ -177,6 +239,7 @@ func runCheck(opts CheckOptions, gopts GlobalOptions, args []string) error {
 	}
 
 	Verbosef("check snapshots, trees and blobs\n")
+	chkr.CheckMetadata = opts.ReadData || opts.ReadDataSubset != "" || opts.ReadDataLimit != ""
 	errChan = make(chan error)
 	go chkr.Structure(gopts.ctx, errChan)
 
@@ -199,40 +262,90 @@ func runCheck(opts CheckOptions, gopts GlobalOptions, args []string) error {
 		}
 	}
 
-	doReadData := func(bucket, totalBuckets uint) {
-		packs := restic.IDSet{}
-		for pack := range chkr.GetPacks() {
-			if (uint(pack[0]) % totalBuckets) == (bucket - 1) {
-				packs.Insert(pack)
-			}
-		}
-		packCount := uint64(len(packs))
+	ledger, obsoleteLedgers, err := restic.LoadLedger(gopts.ctx, repo)
+	if err != nil {
+		Warnf("unable to load the verification ledger: %v\n", err)
+		ledger, obsoleteLedgers = restic.NewLedger(), nil
+	}
 
-		if packCount < chkr.CountPacks() {
-			Verbosef(fmt.Sprintf("read group #%d of %d data packs (out of total %d packs in %d groups)\n", bucket, packCount, chkr.CountPacks(), totalBuckets))
-		} else {
-			Verbosef("read all data\n")
+	doReadData := func(packs restic.IDs) {
+		// read the packs which have not been verified for the longest time first
+		ledger.Order(packs)
+
+		var m sync.Mutex
+		verified := 0
+		chkr.OnPackVerified = func(id restic.ID) {
+			m.Lock()
+			ledger.Verified(id, time.Now())
+			verified++
+			m.Unlock()
 		}
 
-		p := newReadProgress(gopts, restic.Stat{Blobs: packCount})
+		p := newReadProgress(gopts, restic.Stat{Blobs: uint64(len(packs))})
 		errChan := make(chan error)
 
-		go chkr.ReadPacks(gopts.ctx, packs, p, errChan)
+		go chkr.ReadPackList(gopts.ctx, packs, p, errChan)
 
 		for err := range errChan {
 			errorsFound = true
 			fmt.Fprintf(os.Stderr, "%v\n", err)
 		}
+
+		if verified == 0 || repo.Config().Seal != nil {
+			// a sealed repository cannot be modified
+			return
+		}
+
+		_, err := restic.SaveLedger(gopts.ctx, repo, ledger, chkr.GetPacks(), obsoleteLedgers)
+		if err != nil {
+			Warnf("unable to save the verification ledger: %v\n", err)
+		}
+	}
+
+	if err := verifySeal(gopts, repo); err != nil {
+		errorsFound = true
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+	}
+
+	for _, err := range verifyCanaries(gopts.ctx, repo) {
+		errorsFound = true
+		fmt.Fprintf(os.Stderr, "%v\n", err)
 	}
 
 	switch {
 	case opts.ReadData:
-		doReadData(1, 1)
+		Verbosef("read all data\n")
+		doReadData(chkr.GetPacks().List())
 	case opts.ReadDataSubset != "":
 		dataSubset, _ := stringToIntSlice(opts.ReadDataSubset)
-		doReadData(dataSubset[0], dataSubset[1])
+		bucket, totalBuckets := dataSubset[0], dataSubset[1]
+
+		packs := restic.IDs{}
+		for pack := range chkr.GetPacks() {
+			if (uint(pack[0]) % totalBuckets) == (bucket - 1) {
+				packs = append(packs, pack)
+			}
+		}
+
+		if uint64(len(packs)) < chkr.CountPacks() {
+			Verbosef(fmt.Sprintf("read group #%d of %d data packs (out of total %d packs in %d groups)\n", bucket, len(packs), chkr.CountPacks(), totalBuckets))
+		} else {
+			Verbosef("read all data\n")
+		}
+		doReadData(packs)
+	case opts.ReadDataLimit != "":
+		limit, _ := parseSize(opts.ReadDataLimit)
+		packs, err := selectLeastVerified(gopts.ctx, repo, ledger, chkr.GetPacks(), limit)
+		if err != nil {
+			return err
+		}
+
+		Verbosef("read %d least recently verified data packs (out of total %d packs)\n", len(packs), chkr.CountPacks())
+		doReadData(packs)
 	}
 
+	printVerificationCoverage(ledger.Coverage(chkr.GetPacks()))
+
 	if errorsFound {
 		return errors.Fatal("repository contains errors")
 	}
@@ -241,3 +354,80 @@ func runCheck(opts CheckOptions, gopts GlobalOptions, args []string) error {
 
 	return nil
 }
+
+// selectLeastVerified returns the packs which have not been verified for the
+// longest time, until their total size reaches limit.
+func selectLeastVerified(ctx context.Context, repo restic.Repository, ledger *restic.Ledger, packs restic.IDSet, limit uint64) (restic.IDs, error) {
+	sizes := make(map[restic.ID]uint64, len(packs))
+	err := repo.List(ctx, restic.DataFile, func(id restic.ID, size int64) error {
+		sizes[id] = uint64(size)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	list := packs.List()
+	ledger.Order(list)
+
+	var total uint64
+	for i, id := range list {
+		if total >= limit {
+			return list[:i], nil
+		}
+		total += sizes[id]
+	}
+
+	return list, nil
+}
+
+// printVerificationCoverage prints how many of the packs have been verified
+// by reading their data, and since when all data was verified.
+func printVerificationCoverage(c restic.LedgerCoverage) {
+	if c.Verified == 0 {
+		Verbosef("the data of the packs has never been read by check\n")
+		return
+	}
+
+	Verbosef("%d of %d data packs (%s) have been verified by reading their data\n",
+		c.Verified, c.Packs, formatPercent(uint64(c.Verified), uint64(c.Packs)))
+	if c.Verified == c.Packs {
+		Verbosef("all data has been verified since %s\n", c.Oldest.Format(TimeFormat))
+	} else {
+		Verbosef("%d data packs have never been verified, the oldest verification was at %s\n",
+			c.Packs-c.Verified, c.Oldest.Format(TimeFormat))
+	}
+}
+
+// verifyCanaries loads the canary of the latest snapshot which has one for
+// each host and set of paths, and compares it to the expected content.
+func verifyCanaries(ctx context.Context, repo restic.Repository) (errs []error) {
+	snapshots, err := restic.LoadAllSnapshots(ctx, repo)
+	if err != nil {
+		return []error{err}
+	}
+
+	var list restic.Snapshots
+	for _, sn := range snapshots {
+		if sn.Canary != nil {
+			list = append(list, sn)
+		}
+	}
+
+	if len(list) == 0 {
+		return nil
+	}
+
+	Verbosef("verify canaries\n")
+	for _, sn := range FilterLastSnapshots(list) {
+		err := restic.VerifyCanary(ctx, repo, sn.Canary)
+		if err != nil {
+			errs = append(errs, errors.Errorf("canary of snapshot %v: %v", sn.ID().Str(), err))
+			continue
+		}
+
+		Verbosef("canary of snapshot %v verified\n", sn.ID().Str())
+	}
+
+	return errs
+}
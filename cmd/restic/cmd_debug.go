@@ -75,6 +75,8 @@ type Blob struct {
 	Length uint            `json:"length"`
 	ID     restic.ID       `json:"id"`
 	Offset uint            `json:"offset"`
+
+	UncompressedLength uint `json:"uncompressed_length,omitempty"`
 }
 
 func printPacks(repo *repository.Repository, wr io.Writer) error {
@@ -82,7 +84,7 @@ func printPacks(repo *repository.Repository, wr io.Writer) error {
 	return repo.List(context.TODO(), restic.DataFile, func(id restic.ID, size int64) error {
 		h := restic.Handle{Type: restic.DataFile, Name: id.String()}
 
-		blobs, err := pack.List(repo.Key(), restic.ReaderAt(repo.Backend(), h), size)
+		blobs, err := pack.List(repo.Key(), restic.ReaderAt(repo.Backend(), h), size, repo.Config().Compresses())
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error for pack %v: %v\n", id.Str(), err)
 			return nil
@@ -98,6 +100,8 @@ func printPacks(repo *repository.Repository, wr io.Writer) error {
 				Length: blob.Length,
 				ID:     blob.ID,
 				Offset: blob.Offset,
+
+				UncompressedLength: blob.UncompressedLength,
 			}
 		}
 
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"path"
 	"reflect"
@@ -60,6 +61,9 @@ func loadSnapshot(ctx context.Context, repo *repository.Repository, desc string)
 type Comparer struct {
 	repo restic.Repository
 	opts DiffOptions
+
+	// quiet suppresses printing the changed items
+	quiet bool
 }
 
 // DiffStat collects stats for all types of items.
@@ -100,6 +104,11 @@ func addBlobs(bs restic.BlobSet, node *restic.Node) {
 			}
 			bs.Insert(h)
 		}
+		for _, stream := range node.Streams {
+			for _, blob := range stream.Content {
+				bs.Insert(restic.BlobHandle{ID: blob, Type: restic.DataBlob})
+			}
+		}
 	case "dir":
 		h := restic.BlobHandle{
 			ID:   *node.Subtree,
@@ -145,6 +154,14 @@ func updateBlobs(repo restic.Repository, blobs restic.BlobSet, stats *DiffStat)
 	}
 }
 
+// printChange prints a line for an item which has been changed.
+func (c *Comparer) printChange(mode, name string) {
+	if c.quiet {
+		return
+	}
+	Printf("%-5s%v\n", mode, name)
+}
+
 func (c *Comparer) printDir(ctx context.Context, mode string, stats *DiffStat, blobs restic.BlobSet, prefix string, id restic.ID) error {
 	debug.Log("print %v tree %v", mode, id)
 	tree, err := c.repo.LoadTree(ctx, id)
@@ -157,7 +174,7 @@ func (c *Comparer) printDir(ctx context.Context, mode string, stats *DiffStat, b
 		if node.Type == "dir" {
 			name += "/"
 		}
-		Printf("%-5s%v\n", mode, name)
+		c.printChange(mode, name)
 		stats.Add(node)
 		addBlobs(blobs, node)
 
@@ -195,9 +212,18 @@ func uniqueNodeNames(tree1, tree2 *restic.Tree) (tree1Nodes, tree2Nodes map[stri
 	return tree1Nodes, tree2Nodes, uniqueNames
 }
 
+// loadTree returns the tree with the given ID, or an empty tree for the null
+// ID.
+func (c *Comparer) loadTree(ctx context.Context, id restic.ID) (*restic.Tree, error) {
+	if id.IsNull() {
+		return restic.NewTree(), nil
+	}
+	return c.repo.LoadTree(ctx, id)
+}
+
 func (c *Comparer) diffTree(ctx context.Context, stats *DiffStats, prefix string, id1, id2 restic.ID) error {
 	debug.Log("diffing %v to %v", id1, id2)
-	tree1, err := c.repo.LoadTree(ctx, id1)
+	tree1, err := c.loadTree(ctx, id1)
 	if err != nil {
 		return err
 	}
@@ -231,15 +257,15 @@ func (c *Comparer) diffTree(ctx context.Context, stats *DiffStats, prefix string
 
 			if node1.Type == "file" &&
 				node2.Type == "file" &&
-				!reflect.DeepEqual(node1.Content, node2.Content) {
+				(!reflect.DeepEqual(node1.Content, node2.Content) || !bytes.Equal(node1.Inline, node2.Inline)) {
 				mod += "M"
 				stats.ChangedFiles++
-			} else if c.opts.ShowMetadata && !node1.Equals(*node2) {
+			} else if c.opts.ShowMetadata && !node1.SameMetadata(*node2) {
 				mod += "U"
 			}
 
 			if mod != "" {
-				Printf("%-5s%v\n", mod, name)
+				c.printChange(mod, name)
 			}
 
 			if node1.Type == "dir" && node2.Type == "dir" {
@@ -253,7 +279,7 @@ func (c *Comparer) diffTree(ctx context.Context, stats *DiffStats, prefix string
 			if node1.Type == "dir" {
 				prefix += "/"
 			}
-			Printf("%-5s%v\n", "-", prefix)
+			c.printChange("-", prefix)
 			stats.Removed.Add(node1)
 
 			if node1.Type == "dir" {
@@ -267,7 +293,7 @@ func (c *Comparer) diffTree(ctx context.Context, stats *DiffStats, prefix string
 			if node2.Type == "dir" {
 				prefix += "/"
 			}
-			Printf("%-5s%v\n", "+", prefix)
+			c.printChange("+", prefix)
 			stats.Added.Add(node2)
 
 			if node2.Type == "dir" {
@@ -282,6 +308,42 @@ func (c *Comparer) diffTree(ctx context.Context, stats *DiffStats, prefix string
 	return nil
 }
 
+// diff compares the trees and updates the stats, including the blobs which
+// have been added or removed.
+func (c *Comparer) diff(ctx context.Context, stats *DiffStats, id1, id2 restic.ID) error {
+	err := c.diffTree(ctx, stats, "/", id1, id2)
+	if err != nil {
+		return err
+	}
+
+	both := stats.BlobsBefore.Intersect(stats.BlobsAfter)
+	updateBlobs(c.repo, stats.BlobsBefore.Sub(both), &stats.Removed)
+	updateBlobs(c.repo, stats.BlobsAfter.Sub(both), &stats.Added)
+	return nil
+}
+
+// diffSummary compares the tree of a snapshot with the tree of its parent
+// without printing the changes. For the null ID as the parent, all items
+// are new.
+func diffSummary(ctx context.Context, repo restic.Repository, parent, tree restic.ID) (*restic.SnapshotSummary, error) {
+	c := &Comparer{repo: repo, quiet: true}
+
+	stats := NewDiffStats()
+	err := c.diff(ctx, stats, parent, tree)
+	if err != nil {
+		return nil, err
+	}
+
+	return &restic.SnapshotSummary{
+		FilesNew:     stats.Added.Files,
+		FilesRemoved: stats.Removed.Files,
+		FilesChanged: stats.ChangedFiles,
+		DirsNew:      stats.Added.Dirs,
+		DirsRemoved:  stats.Removed.Dirs,
+		DataAdded:    uint64(stats.Added.Bytes),
+	}, nil
+}
+
 func runDiff(opts DiffOptions, gopts GlobalOptions, args []string) error {
 	if len(args) != 2 {
 		return errors.Fatalf("specify two snapshot IDs")
@@ -334,15 +396,11 @@ func runDiff(opts DiffOptions, gopts GlobalOptions, args []string) error {
 
 	stats := NewDiffStats()
 
-	err = c.diffTree(ctx, stats, "/", *sn1.Tree, *sn2.Tree)
+	err = c.diff(ctx, stats, *sn1.Tree, *sn2.Tree)
 	if err != nil {
 		return err
 	}
 
-	both := stats.BlobsBefore.Intersect(stats.BlobsAfter)
-	updateBlobs(repo, stats.BlobsBefore.Sub(both), &stats.Removed)
-	updateBlobs(repo, stats.BlobsAfter.Sub(both), &stats.Added)
-
 	Printf("\n")
 	Printf("Files:       %5d new, %5d removed, %5d changed\n", stats.Added.Files, stats.Removed.Files, stats.ChangedFiles)
 	Printf("Dirs:        %5d new, %5d removed\n", stats.Added.Dirs, stats.Removed.Dirs)
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
@@ -22,6 +23,9 @@ prints its contents to stdout.
 
 The special snapshot "latest" can be used to use the latest snapshot in the
 repository.
+
+With --offset and --length, only a part of the file is printed. Only the data
+needed for this part is loaded from the repository.
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -31,9 +35,11 @@ repository.
 
 // DumpOptions collects all options for the dump command.
 type DumpOptions struct {
-	Host  string
-	Paths []string
-	Tags  restic.TagLists
+	Host   string
+	Paths  []string
+	Tags   restic.TagLists
+	Offset int64
+	Length int64
 }
 
 var dumpOptions DumpOptions
@@ -45,6 +51,8 @@ func init() {
 	flags.StringVarP(&dumpOptions.Host, "host", "H", "", `only consider snapshots for this host when the snapshot ID is "latest"`)
 	flags.Var(&dumpOptions.Tags, "tag", "only consider snapshots which include this `taglist` for snapshot ID \"latest\"")
 	flags.StringArrayVar(&dumpOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path` for snapshot ID \"latest\"")
+	flags.Int64Var(&dumpOptions.Offset, "offset", 0, "start printing the file at this `byte` offset")
+	flags.Int64Var(&dumpOptions.Length, "length", 0, "print at most this number of `bytes` (default: until the end of the file)")
 }
 
 func splitPath(path string) []string {
@@ -56,34 +64,25 @@ func splitPath(path string) []string {
 	return append(s, f)
 }
 
-func dumpNode(ctx context.Context, repo restic.Repository, node *restic.Node) error {
-	var buf []byte
-	for _, id := range node.Content {
-		size, found := repo.LookupBlobSize(id, restic.DataBlob)
-		if !found {
-			return errors.Errorf("id %v not found in repository", id)
-		}
-
-		buf = buf[:cap(buf)]
-		if len(buf) < restic.CiphertextLength(int(size)) {
-			buf = restic.NewBlobBuffer(int(size))
-		}
+func dumpNode(ctx context.Context, repo restic.Repository, node *restic.Node, w io.Writer) error {
+	return node.WriteContentRange(ctx, repo, 0, -1, w)
+}
 
-		n, err := repo.LoadBlob(ctx, restic.DataBlob, id, buf)
-		if err != nil {
-			return err
-		}
-		buf = buf[:n]
+// dumpNodeRange prints the part of the file selected by the options.
+func dumpNodeRange(ctx context.Context, repo restic.Repository, node *restic.Node, opts DumpOptions, w io.Writer) error {
+	if opts.Offset > 0 && uint64(opts.Offset) >= node.Size {
+		return errors.Errorf("offset %d is beyond the end of the file (%d bytes)", opts.Offset, node.Size)
+	}
 
-		_, err = os.Stdout.Write(buf)
-		if err != nil {
-			return errors.Wrap(err, "Write")
-		}
+	length := opts.Length
+	if length == 0 {
+		length = -1
 	}
-	return nil
+
+	return node.WriteContentRange(ctx, repo, opts.Offset, length, w)
 }
 
-func printFromTree(ctx context.Context, tree *restic.Tree, repo restic.Repository, prefix string, pathComponents []string) error {
+func printFromTree(ctx context.Context, tree *restic.Tree, repo restic.Repository, prefix string, pathComponents []string, opts DumpOptions) error {
 	if tree == nil {
 		return fmt.Errorf("called with a nil tree")
 	}
@@ -99,13 +98,13 @@ func printFromTree(ctx context.Context, tree *restic.Tree, repo restic.Repositor
 		if node.Name == pathComponents[0] {
 			switch {
 			case l == 1 && node.Type == "file":
-				return dumpNode(ctx, repo, node)
+				return dumpNodeRange(ctx, repo, node, opts, os.Stdout)
 			case l > 1 && node.Type == "dir":
 				subtree, err := repo.LoadTree(ctx, *node.Subtree)
 				if err != nil {
 					return errors.Wrapf(err, "cannot load subtree for %q", item)
 				}
-				return printFromTree(ctx, subtree, repo, item, pathComponents[1:])
+				return printFromTree(ctx, subtree, repo, item, pathComponents[1:], opts)
 			case l > 1:
 				return fmt.Errorf("%q should be a dir, but s a %q", item, node.Type)
 			case node.Type != "file":
@@ -123,6 +122,10 @@ func runDump(opts DumpOptions, gopts GlobalOptions, args []string) error {
 		return errors.Fatal("no file and no snapshot ID specified")
 	}
 
+	if opts.Offset < 0 || opts.Length < 0 {
+		return errors.Fatal("--offset and --length must not be negative")
+	}
+
 	snapshotIDString := args[0]
 	pathToPrint := args[1]
 
@@ -135,6 +138,11 @@ func runDump(opts DumpOptions, gopts GlobalOptions, args []string) error {
 		return err
 	}
 
+	_, err = useDataCache(repo, gopts)
+	if err != nil {
+		return err
+	}
+
 	if !gopts.NoLock {
 		lock, err := lockRepo(repo)
 		defer unlockRepo(lock)
@@ -172,7 +180,7 @@ func runDump(opts DumpOptions, gopts GlobalOptions, args []string) error {
 		Exitf(2, "loading tree for snapshot %q failed: %v", snapshotIDString, err)
 	}
 
-	err = printFromTree(ctx, tree, repo, "", splittedPath)
+	err = printFromTree(ctx, tree, repo, "", splittedPath, opts)
 	if err != nil {
 		Exitf(2, "cannot dump file: %v", err)
 	}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/restic/restic/internal/backend/archive"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/spf13/cobra"
+)
+
+var cmdExport = &cobra.Command{
+	Use:   "export --output file [snapshotID ...]",
+	Short: "Export snapshots to an archive file",
+	Long: `
+The "export" command writes the given snapshots together with all data they
+reference to a single archive file. When no snapshot is given, all snapshots
+are exported.
+
+The archive is a tar file which contains a new, encrypted repository with its
+own master key. It uses the repository password given with --password-file or
+$RESTIC_PASSWORD, otherwise a password for the archive is requested. The
+archive is written sequentially, so it can be stored on tapes or write-once
+media. Use "restic import" to copy the snapshots from an archive into a
+repository again.
+
+With --volume-size, the archive is split into volumes of a limited size, which
+are named after the output file with a sequence number appended. The output
+file itself then contains the volume index, which lists the files within each
+volume and needs to be passed to "restic import".
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runExport(exportOptions, globalOptions, args)
+	},
+}
+
+// ExportOptions bundles all options for the export command.
+type ExportOptions struct {
+	Output     string
+	VolumeSize int
+	Host       string
+	Tags       restic.TagLists
+	Paths      []string
+}
+
+var exportOptions ExportOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdExport)
+
+	f := cmdExport.Flags()
+	f.StringVar(&exportOptions.Output, "output", "", "write the archive to `file`")
+	f.IntVar(&exportOptions.VolumeSize, "volume-size", 0, "split the archive into volumes of at most `n` MiB")
+	f.StringVarP(&exportOptions.Host, "host", "H", "", "only consider snapshots for this `host`")
+	f.Var(&exportOptions.Tags, "tag", "only consider snapshots which include this `taglist` (can be specified multiple times)")
+	f.StringArrayVar(&exportOptions.Paths, "path", nil, "only consider snapshots for this `path` (can be specified multiple times)")
+}
+
+// getArchivePassword returns the password for an archive. When the repository
+// password has been passed with --password-file or $RESTIC_PASSWORD, it is
+// used for the archive as well, otherwise the user is prompted.
+func getArchivePassword(gopts GlobalOptions, twice bool) (string, error) {
+	if twice {
+		return ReadPasswordTwice(gopts,
+			"enter password for the archive: ",
+			"enter password again: ")
+	}
+
+	return ReadPassword(gopts, "enter password for the archive: ")
+}
+
+// copyBlob copies the blob from src to dst, unless it has already been copied
+// or is already present in dst.
+func copyBlob(ctx context.Context, src, dst restic.Repository, t restic.BlobType, id restic.ID, seen restic.BlobSet) error {
+	h := restic.BlobHandle{ID: id, Type: t}
+	if seen.Has(h) || dst.Index().Has(id, t) {
+		return nil
+	}
+	seen.Insert(h)
+
+	size, ok := src.LookupBlobSize(id, t)
+	if !ok {
+		return errors.Errorf("blob %v not found", id.Str())
+	}
+
+	buf := make([]byte, restic.CiphertextLength(int(size)))
+	n, err := src.LoadBlob(ctx, t, id, buf)
+	if err != nil {
+		return err
+	}
+
+	_, err = dst.SaveBlob(ctx, t, buf[:n], id)
+	return err
+}
+
+// copyTree copies the tree with the given ID and all data it references from
+// src to dst.
+func copyTree(ctx context.Context, src, dst restic.Repository, id restic.ID, seen restic.BlobSet) error {
+	h := restic.BlobHandle{ID: id, Type: restic.TreeBlob}
+	if seen.Has(h) || dst.Index().Has(id, restic.TreeBlob) {
+		return nil
+	}
+
+	tree, err := src.LoadTree(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range tree.Nodes {
+		switch node.Type {
+		case "file":
+			for _, blob := range node.Content {
+				err = copyBlob(ctx, src, dst, restic.DataBlob, blob, seen)
+				if err != nil {
+					return err
+				}
+			}
+		case "dir":
+			if node.Subtree == nil {
+				return errors.Errorf("dir %v has no subtree", node.Name)
+			}
+
+			err = copyTree(ctx, src, dst, *node.Subtree, seen)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return copyBlob(ctx, src, dst, restic.TreeBlob, id, seen)
+}
+
+// copySnapshots copies the snapshots and all data they reference from src to
+// dst. The original ID of each snapshot is recorded.
+func copySnapshots(ctx context.Context, src, dst restic.Repository, snapshots []*restic.Snapshot) error {
+	seen := restic.NewBlobSet()
+	for _, sn := range snapshots {
+		err := copyTree(ctx, src, dst, *sn.Tree, seen)
+		if err != nil {
+			return errors.Wrapf(err, "snapshot %v", sn.ID().Str())
+		}
+
+		if sn.Canary != nil {
+			err = copyBlob(ctx, src, dst, restic.DataBlob, sn.Canary.Blob, seen)
+			if err != nil {
+				return errors.Wrapf(err, "canary of snapshot %v", sn.ID().Str())
+			}
+		}
+	}
+
+	err := dst.Flush(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = dst.SaveIndex(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, sn := range snapshots {
+		if sn.Original == nil {
+			sn.Original = sn.ID()
+		}
+
+		id, err := dst.SaveJSONUnpacked(ctx, restic.SnapshotFile, sn)
+		if err != nil {
+			return err
+		}
+
+		Verbosef("copied snapshot %v as %v\n", sn.Original.Str(), id.Str())
+	}
+
+	return nil
+}
+
+func runExport(opts ExportOptions, gopts GlobalOptions, args []string) error {
+	if opts.Output == "" {
+		return errors.Fatal("please specify the archive file with --output")
+	}
+
+	if opts.VolumeSize < 0 {
+		return errors.Fatal("--volume-size must not be negative")
+	}
+
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		lock, err := lockRepo(repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = repo.LoadIndex(gopts.ctx); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(gopts.ctx)
+	defer cancel()
+
+	var snapshots []*restic.Snapshot
+	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, args) {
+		snapshots = append(snapshots, sn)
+	}
+
+	if len(snapshots) == 0 {
+		return errors.Fatal("no snapshots to export")
+	}
+
+	password, err := getArchivePassword(gopts, true)
+	if err != nil {
+		return err
+	}
+
+	var (
+		be *archive.Writer
+		f  *os.File
+	)
+
+	if opts.VolumeSize > 0 {
+		be, err = archive.CreateVolumes(opts.Output, int64(opts.VolumeSize)*1024*1024)
+	} else {
+		f, err = fs.OpenFile(opts.Output, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err == nil {
+			be = archive.Create(f)
+		}
+	}
+
+	if err != nil {
+		return errors.Fatalf("unable to create archive: %v", err)
+	}
+
+	dst := repository.New(be)
+
+	err = dst.Init(ctx, password, nil)
+	if err == nil {
+		err = copySnapshots(ctx, repo, dst, snapshots)
+	}
+
+	if err == nil {
+		err = be.Close()
+	}
+
+	if f != nil {
+		if cerr := f.Close(); err == nil {
+			err = errors.Wrap(cerr, "Close")
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	Verbosef("exported %d snapshots to %v\n", len(snapshots), opts.Output)
+	return nil
+}
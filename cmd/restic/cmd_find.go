@@ -36,6 +36,7 @@ type FindOptions struct {
 	Host            string
 	Paths           []string
 	Tags            restic.TagLists
+	Federate        []string
 }
 
 var findOptions FindOptions
@@ -53,6 +54,7 @@ func init() {
 	f.StringVarP(&findOptions.Host, "host", "H", "", "only consider snapshots for this `host`, when no snapshot ID is given")
 	f.Var(&findOptions.Tags, "tag", "only consider snapshots which include this `taglist`, when no snapshot-ID is given")
 	f.StringArrayVar(&findOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path`, when no snapshot-ID is given")
+	f.StringArrayVar(&findOptions.Federate, "federate", nil, "also read snapshots and data from the `repository`, e.g. an archived repository (can be specified multiple times)")
 }
 
 type findPattern struct {
@@ -268,19 +270,24 @@ func runFind(opts FindOptions, gopts GlobalOptions, args []string) error {
 		}
 	}
 
-	repo, err := OpenRepository(gopts)
+	mainRepo, err := OpenRepository(gopts)
 	if err != nil {
 		return err
 	}
 
 	if !gopts.NoLock {
-		lock, err := lockRepo(repo)
+		lock, err := lockRepo(mainRepo)
 		defer unlockRepo(lock)
 		if err != nil {
 			return err
 		}
 	}
 
+	repo, err := openFederation(gopts, mainRepo, opts.Federate)
+	if err != nil {
+		return err
+	}
+
 	if err = repo.LoadIndex(gopts.ctx); err != nil {
 		return err
 	}
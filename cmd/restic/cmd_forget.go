@@ -3,8 +3,11 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
@@ -18,7 +21,14 @@ var cmdForget = &cobra.Command{
 The "forget" command removes snapshots according to a policy. Please note that
 this command really only deletes the snapshot object in the repository, which
 is a reference to data stored there. In order to remove this (now unreferenced)
-data after 'forget' was run successfully, see the 'prune' command. `,
+data after 'forget' was run successfully, see the 'prune' command.
+
+Removed snapshots are moved to the trash, from where they are deleted by the
+'purge-trash' command. Pass --no-trash to delete them immediately. The b2 and
+rest backends have no way to move a file without downloading and uploading it
+again, there files are deleted immediately unless --trash-copy is passed.
+
+Snapshots which have been pinned with the 'pin' command are never removed. `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return runForget(forgetOptions, globalOptions, args)
@@ -35,15 +45,20 @@ type ForgetOptions struct {
 	Yearly   int
 	KeepTags restic.TagLists
 
+	KeepAtLeast      int
+	MaxRemovePercent int
+
 	Host    string
 	Tags    restic.TagLists
 	Paths   []string
 	Compact bool
 
 	// Grouping
-	GroupBy string
-	DryRun  bool
-	Prune   bool
+	GroupBy   string
+	DryRun    bool
+	Prune     bool
+	NoTrash   bool
+	TrashCopy bool
 }
 
 var forgetOptions ForgetOptions
@@ -60,6 +75,8 @@ func init() {
 	f.IntVarP(&forgetOptions.Yearly, "keep-yearly", "y", 0, "keep the last `n` yearly snapshots")
 
 	f.Var(&forgetOptions.KeepTags, "keep-tag", "keep snapshots with this `taglist` (can be specified multiple times)")
+	f.IntVar(&forgetOptions.KeepAtLeast, "keep-at-least", 0, "always keep at least the `n` most recent snapshots of each group")
+	f.IntVar(&forgetOptions.MaxRemovePercent, "max-remove-percent", 50, "abort if the policy would remove more than `percent` of the snapshots (100 disables the check)")
 	// Sadly the commonly used shortcut `H` is already used.
 	f.StringVar(&forgetOptions.Host, "host", "", "only consider snapshots with the given `host`")
 	// Deprecated since 2017-03-07.
@@ -71,6 +88,8 @@ func init() {
 	f.StringVarP(&forgetOptions.GroupBy, "group-by", "g", "host,paths", "string for grouping snapshots by host,paths,tags")
 	f.BoolVarP(&forgetOptions.DryRun, "dry-run", "n", false, "do not delete anything, just print what would be done")
 	f.BoolVar(&forgetOptions.Prune, "prune", false, "automatically run the 'prune' command if snapshots have been removed")
+	f.BoolVar(&forgetOptions.NoTrash, "no-trash", false, "delete snapshots (and pack files with --prune) immediately instead of moving them to the trash")
+	f.BoolVar(&forgetOptions.TrashCopy, "trash-copy", false, "copy files into the trash on backends which cannot move them (b2, rest)")
 
 	f.SortFlags = false
 }
@@ -81,6 +100,12 @@ func runForget(opts ForgetOptions, gopts GlobalOptions, args []string) error {
 		return err
 	}
 
+	if !opts.DryRun {
+		if err = checkNotSealed(repo); err != nil {
+			return err
+		}
+	}
+
 	lock, err := lockRepoExclusive(repo)
 	defer unlockRepo(lock)
 	if err != nil {
@@ -117,15 +142,19 @@ func runForget(opts ForgetOptions, gopts GlobalOptions, args []string) error {
 	}
 
 	removeSnapshots := 0
+	skippedPinned := 0
 
 	ctx, cancel := context.WithCancel(gopts.ctx)
 	defer cancel()
 	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, args) {
 		if len(args) > 0 {
 			// When explicit snapshots args are given, remove them immediately.
-			if !opts.DryRun {
+			if sn.Pinned {
+				Warnf("snapshot %v is pinned and will not be removed, run 'restic unpin' first\n", sn.ID().Str())
+				skippedPinned++
+			} else if !opts.DryRun {
 				h := restic.Handle{Type: restic.SnapshotFile, Name: sn.ID().String()}
-				if err = repo.Backend().Remove(gopts.ctx, h); err != nil {
+				if err = removeFile(gopts.ctx, repo, h, opts.NoTrash, opts.TrashCopy); err != nil {
 					return err
 				}
 				Verbosef("removed snapshot %v\n", sn.ID().Str())
@@ -173,10 +202,16 @@ func runForget(opts ForgetOptions, gopts GlobalOptions, args []string) error {
 		Tags:    opts.KeepTags,
 	}
 
-	if policy.Empty() && len(args) == 0 {
+	if policy.Empty() && len(args) == 0 && !gopts.JSON {
 		Verbosef("no policy was specified, no snapshots will be removed\n")
 	}
 
+	var (
+		toRemove   restic.Snapshots
+		total      int
+		jsonGroups []forgetGroup
+	)
+
 	if !policy.Empty() {
 		for k, snapshotGroup := range snapshotGroups {
 			var key key
@@ -184,6 +219,16 @@ func runForget(opts ForgetOptions, gopts GlobalOptions, args []string) error {
 				return err
 			}
 
+			total += len(snapshotGroup)
+			keep, remove, reasons := restic.ApplyPolicyReasons(snapshotGroup, policy)
+			keep, remove = restic.KeepAtLeast(keep, remove, opts.KeepAtLeast)
+			toRemove = append(toRemove, remove...)
+
+			if gopts.JSON {
+				jsonGroups = append(jsonGroups, newForgetGroup(key.Hostname, key.Paths, key.Tags, policy, keep, remove, reasons))
+				continue
+			}
+
 			// Info
 			Verbosef("snapshots")
 			var infoStrings []string
@@ -201,8 +246,6 @@ func runForget(opts ForgetOptions, gopts GlobalOptions, args []string) error {
 			}
 			Verbosef(":\n\n")
 
-			keep, remove := restic.ApplyPolicy(snapshotGroup, policy)
-
 			if len(keep) != 0 && !gopts.Quiet {
 				Printf("keep %d snapshots:\n", len(keep))
 				PrintSnapshots(globalOptions.stdout, keep, opts.Compact)
@@ -214,17 +257,33 @@ func runForget(opts ForgetOptions, gopts GlobalOptions, args []string) error {
 				PrintSnapshots(globalOptions.stdout, remove, opts.Compact)
 				Printf("\n")
 			}
+		}
+	}
 
-			removeSnapshots += len(remove)
+	if gopts.JSON {
+		err = printForgetJSON(globalOptions.stdout, jsonGroups)
+		if err != nil {
+			return err
+		}
+	}
 
-			if !opts.DryRun {
-				for _, sn := range remove {
-					h := restic.Handle{Type: restic.SnapshotFile, Name: sn.ID().String()}
-					err = repo.Backend().Remove(gopts.ctx, h)
-					if err != nil {
-						return err
-					}
-				}
+	if total > 0 && len(toRemove)*100 > total*opts.MaxRemovePercent {
+		msg := fmt.Sprintf("policy would remove %d of %d snapshots, which is more than the limit of %d%% (--max-remove-percent)",
+			len(toRemove), total, opts.MaxRemovePercent)
+		if !opts.DryRun {
+			return errors.Fatal(msg)
+		}
+		Warnf("%s\n", msg)
+	}
+
+	removeSnapshots += len(toRemove)
+
+	if !opts.DryRun {
+		for _, sn := range toRemove {
+			h := restic.Handle{Type: restic.SnapshotFile, Name: sn.ID().String()}
+			err = removeFile(gopts.ctx, repo, h, opts.NoTrash, opts.TrashCopy)
+			if err != nil {
+				return err
 			}
 		}
 	}
@@ -232,9 +291,136 @@ func runForget(opts ForgetOptions, gopts GlobalOptions, args []string) error {
 	if removeSnapshots > 0 && opts.Prune {
 		Verbosef("%d snapshots have been removed, running prune\n", removeSnapshots)
 		if !opts.DryRun {
-			return pruneRepository(gopts, repo)
+			err = pruneRepository(gopts, PruneOptions{NoTrash: opts.NoTrash, TrashCopy: opts.TrashCopy}, repo)
+			if err != nil {
+				return err
+			}
+
+			err = recordPruneStats(gopts.ctx, repo)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
+	if skippedPinned > 0 {
+		return errAttention
+	}
+
 	return nil
 }
+
+// forgetGroup is the JSON representation of the decisions of the policy for
+// one group of snapshots.
+type forgetGroup struct {
+	Host    string         `json:"host"`
+	Paths   []string       `json:"paths"`
+	Tags    []string       `json:"tags"`
+	Keep    []Snapshot     `json:"keep"`
+	Remove  []Snapshot     `json:"remove"`
+	Rules   []forgetRule   `json:"rules"`
+	Reasons []forgetReason `json:"reasons"`
+}
+
+// forgetRule describes the buckets which are filled for one of the --keep-*
+// options. Remaining is the number of buckets which are still free, these are
+// filled by new snapshots before old ones are removed.
+type forgetRule struct {
+	Rule      string   `json:"rule"`
+	Count     int      `json:"count"`
+	Buckets   []string `json:"buckets"`
+	Remaining int      `json:"remaining"`
+}
+
+// forgetReason explains why a snapshot is kept or removed.
+type forgetReason struct {
+	ID      *restic.ID        `json:"id"`
+	ShortID string            `json:"short_id"`
+	Time    time.Time         `json:"time"`
+	Action  string            `json:"action"`
+	Matches []string          `json:"matches"`
+	Buckets map[string]string `json:"buckets"`
+}
+
+func newSnapshotList(list restic.Snapshots) []Snapshot {
+	res := []Snapshot{}
+	for _, sn := range list {
+		res = append(res, Snapshot{Snapshot: sn, ID: sn.ID(), ShortID: sn.ID().Str()})
+	}
+	return res
+}
+
+func newForgetGroup(host string, paths, tags []string, policy restic.ExpirePolicy, keep, remove restic.Snapshots, reasons []restic.KeepReason) forgetGroup {
+	g := forgetGroup{
+		Host:    host,
+		Paths:   paths,
+		Tags:    tags,
+		Keep:    newSnapshotList(keep),
+		Remove:  newSnapshotList(remove),
+		Rules:   []forgetRule{},
+		Reasons: []forgetReason{},
+	}
+
+	kept := restic.NewIDSet()
+	for _, sn := range keep {
+		kept.Insert(*sn.ID())
+	}
+
+	for _, r := range []struct {
+		name  string
+		count int
+	}{
+		{"last", policy.Last},
+		{"hourly", policy.Hourly},
+		{"daily", policy.Daily},
+		{"weekly", policy.Weekly},
+		{"monthly", policy.Monthly},
+		{"yearly", policy.Yearly},
+	} {
+		if r.count <= 0 {
+			continue
+		}
+
+		rule := forgetRule{Rule: r.name, Count: r.count, Buckets: []string{}}
+		for _, reason := range reasons {
+			for _, m := range reason.Matches {
+				if m == r.name {
+					rule.Buckets = append(rule.Buckets, reason.Buckets[r.name])
+				}
+			}
+		}
+		rule.Remaining = r.count - len(rule.Buckets)
+		g.Rules = append(g.Rules, rule)
+	}
+
+	for _, reason := range reasons {
+		sn := reason.Snapshot
+		fr := forgetReason{
+			ID:      sn.ID(),
+			ShortID: sn.ID().Str(),
+			Time:    sn.Time,
+			Action:  "remove",
+			Matches: reason.Matches,
+			Buckets: reason.Buckets,
+		}
+
+		if kept.Has(*sn.ID()) {
+			fr.Action = "keep"
+			if !reason.Keep() {
+				fr.Matches = []string{"keep-at-least"}
+			}
+		}
+
+		g.Reasons = append(g.Reasons, fr)
+	}
+
+	return g
+}
+
+// printForgetJSON writes the decisions for all groups as JSON to stdout.
+func printForgetJSON(stdout io.Writer, groups []forgetGroup) error {
+	if groups == nil {
+		groups = []forgetGroup{}
+	}
+	return json.NewEncoder(stdout).Encode(groups)
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdGCStats = &cobra.Command{
+	Use:   "gc-stats",
+	Short: "Show how much data in the repository is unused",
+	Long: `
+The "gc-stats" command finds the blobs which are still referenced by a snapshot
+and reports how much of the data in the repository is unused, how much is
+stored more than once and how much is only referenced by each snapshot.
+
+Unlike "prune", it only reads the index and the trees, and takes a
+non-exclusive lock, so it can run regularly next to backups to monitor how
+much garbage accumulates. The exclusive size of a snapshot is the data which
+would become unused if only this snapshot were forgotten.
+
+Blobs uploaded by backups which are still running are not referenced by a
+snapshot yet, so they are reported as unused.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runGCStats(globalOptions, args)
+	},
+}
+
+func init() {
+	cmdRoot.AddCommand(cmdGCStats)
+}
+
+// blobRefs records how many snapshots reference a blob, and which one did
+// first.
+type blobRefs struct {
+	snapshot int
+	count    int
+}
+
+// gcSnapshot is the size of the data only referenced by a snapshot.
+type gcSnapshot struct {
+	ID             *restic.ID `json:"id"`
+	ShortID        string     `json:"short_id"`
+	Time           time.Time  `json:"time"`
+	Hostname       string     `json:"hostname,omitempty"`
+	Paths          []string   `json:"paths"`
+	ExclusiveBlobs int        `json:"exclusive_blobs"`
+	ExclusiveSize  uint64     `json:"exclusive_size"`
+}
+
+// gcReport describes how much of the data in a repository is still used.
+type gcReport struct {
+	Packs          int          `json:"packs"`
+	Blobs          int          `json:"blobs"`
+	Size           uint64       `json:"size"`
+	UsedBlobs      int          `json:"used_blobs"`
+	UsedSize       uint64       `json:"used_size"`
+	UnusedBlobs    int          `json:"unused_blobs"`
+	UnusedSize     uint64       `json:"unused_size"`
+	DuplicateBlobs int          `json:"duplicate_blobs"`
+	DuplicateSize  uint64       `json:"duplicate_size"`
+	Snapshots      []gcSnapshot `json:"snapshots"`
+}
+
+// buildGCReport sorts the blobs stored in the repository into used, unused
+// and duplicate ones, according to refs. For each blob referenced by a single
+// snapshot, its size is added to the exclusive size of the snapshot.
+func buildGCReport(blobs []restic.PackedBlob, snapshots restic.Snapshots, refs map[restic.BlobHandle]blobRefs) gcReport {
+	var report gcReport
+
+	for _, sn := range snapshots {
+		report.Snapshots = append(report.Snapshots, gcSnapshot{
+			ID:       sn.ID(),
+			ShortID:  sn.ID().Str(),
+			Time:     sn.Time,
+			Hostname: sn.Hostname,
+			Paths:    sn.Paths,
+		})
+	}
+
+	type copyHandle struct {
+		restic.BlobHandle
+		pack restic.ID
+	}
+
+	packs := restic.NewIDSet()
+	seenCopies := make(map[copyHandle]struct{})
+	seen := restic.NewBlobSet()
+
+	for _, pb := range blobs {
+		h := restic.BlobHandle{ID: pb.ID, Type: pb.Type}
+
+		// a pack may be listed in more than one index file
+		c := copyHandle{BlobHandle: h, pack: pb.PackID}
+		if _, ok := seenCopies[c]; ok {
+			continue
+		}
+		seenCopies[c] = struct{}{}
+		packs.Insert(pb.PackID)
+
+		size := uint64(pb.Length)
+		report.Blobs++
+		report.Size += size
+
+		r, used := refs[h]
+		switch {
+		case !used:
+			report.UnusedBlobs++
+			report.UnusedSize += size
+		case seen.Has(h):
+			report.DuplicateBlobs++
+			report.DuplicateSize += size
+		default:
+			report.UsedBlobs++
+			report.UsedSize += size
+
+			if r.count == 1 {
+				report.Snapshots[r.snapshot].ExclusiveBlobs++
+				report.Snapshots[r.snapshot].ExclusiveSize += size
+			}
+		}
+		seen.Insert(h)
+	}
+
+	report.Packs = len(packs)
+	return report
+}
+
+func runGCStats(gopts GlobalOptions, args []string) error {
+	if len(args) > 0 {
+		return errors.Fatal("the gc-stats command has no arguments")
+	}
+
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		lock, err := lockRepo(repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx := gopts.ctx
+
+	if err = repo.LoadIndex(ctx); err != nil {
+		return err
+	}
+
+	snapshots, err := restic.LoadAllSnapshots(ctx, repo)
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+
+	Verbosef("find data that is still in use for %d snapshots\n", len(snapshots))
+
+	refs := make(map[restic.BlobHandle]blobRefs)
+	bar := newProgressMax(!gopts.Quiet && !gopts.JSON, uint64(len(snapshots)), "snapshots")
+	bar.Start()
+	for i, sn := range snapshots {
+		debug.Log("process snapshot %v", sn.ID())
+
+		blobs := restic.NewBlobSet()
+		err = restic.FindUsedBlobs(ctx, repo, *sn.Tree, blobs, restic.NewBlobSet())
+		if err != nil {
+			return err
+		}
+
+		if sn.Canary != nil {
+			blobs.Insert(restic.BlobHandle{ID: sn.Canary.Blob, Type: restic.DataBlob})
+		}
+
+		for h := range blobs {
+			r, ok := refs[h]
+			if !ok {
+				r.snapshot = i
+			}
+			r.count++
+			refs[h] = r
+		}
+
+		bar.Report(restic.Stat{Blobs: 1})
+	}
+	bar.Done()
+
+	var blobs []restic.PackedBlob
+	for pb := range repo.Index().Each(ctx) {
+		blobs = append(blobs, pb)
+	}
+
+	report := buildGCReport(blobs, snapshots, refs)
+
+	if gopts.JSON {
+		return json.NewEncoder(gopts.stdout).Encode(report)
+	}
+
+	printGCReport(gopts.stdout, report)
+	return nil
+}
+
+// printGCReport prints the summary and a table with the exclusive size of
+// each snapshot.
+func printGCReport(stdout io.Writer, report gcReport) {
+	line := func(name string, blobs int, size uint64) {
+		fmt.Fprintf(stdout, "%-10s  %8d blobs  %12s  %7s\n", name, blobs, formatBytes(size), formatPercent(size, report.Size))
+	}
+
+	fmt.Fprintf(stdout, "repository contains %d packs, %d blobs, %s\n\n", report.Packs, report.Blobs, formatBytes(report.Size))
+	line("used", report.UsedBlobs, report.UsedSize)
+	line("unused", report.UnusedBlobs, report.UnusedSize)
+	line("duplicate", report.DuplicateBlobs, report.DuplicateSize)
+	fmt.Fprintln(stdout)
+
+	maxHost := 10
+	for _, s := range report.Snapshots {
+		if len(s.Hostname) > maxHost {
+			maxHost = len(s.Hostname)
+		}
+	}
+
+	tab := NewTable()
+	tab.Header = fmt.Sprintf("%-8s  %-19s  %-*s  %10s  %12s", "ID", "Date", -maxHost, "Host", "Blobs", "Exclusive")
+	tab.RowFormat = fmt.Sprintf("%%-8s  %%-19s  %%%ds  %%10d  %%12s", -maxHost)
+
+	var total uint64
+	for _, s := range report.Snapshots {
+		tab.Rows = append(tab.Rows, []interface{}{s.ShortID, s.Time.Format(TimeFormat), s.Hostname,
+			s.ExclusiveBlobs, formatBytes(s.ExclusiveSize)})
+		total += s.ExclusiveSize
+	}
+
+	tab.Footer = fmt.Sprintf("%d snapshots, %s exclusive data in total", len(report.Snapshots), formatBytes(total))
+	tab.Write(stdout)
+}
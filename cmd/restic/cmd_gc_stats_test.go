@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+func TestBuildGCReport(t *testing.T) {
+	var snapshots restic.Snapshots
+	for i := 0; i < 2; i++ {
+		sn, err := restic.NewSnapshot([]string{"/home"}, nil, "localhost", time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		snapshots = append(snapshots, sn)
+	}
+
+	pack1, pack2 := restic.NewRandomID(), restic.NewRandomID()
+	shared, only0, only1, unused := restic.NewRandomID(), restic.NewRandomID(), restic.NewRandomID(), restic.NewRandomID()
+
+	blob := func(id restic.ID, pack restic.ID, length uint) restic.PackedBlob {
+		return restic.PackedBlob{Blob: restic.Blob{ID: id, Type: restic.DataBlob, Length: length}, PackID: pack}
+	}
+
+	blobs := []restic.PackedBlob{
+		blob(shared, pack1, 100),
+		blob(only0, pack1, 200),
+		blob(only1, pack1, 300),
+		blob(unused, pack2, 400),
+		// a second copy of a blob, and the same copy listed twice
+		blob(only0, pack2, 200),
+		blob(only0, pack2, 200),
+	}
+
+	handle := func(id restic.ID) restic.BlobHandle {
+		return restic.BlobHandle{ID: id, Type: restic.DataBlob}
+	}
+
+	refs := map[restic.BlobHandle]blobRefs{
+		handle(shared): {snapshot: 0, count: 2},
+		handle(only0):  {snapshot: 0, count: 1},
+		handle(only1):  {snapshot: 1, count: 1},
+	}
+
+	report := buildGCReport(blobs, snapshots, refs)
+
+	want := gcReport{
+		Packs:          2,
+		Blobs:          5,
+		Size:           1200,
+		UsedBlobs:      3,
+		UsedSize:       600,
+		UnusedBlobs:    1,
+		UnusedSize:     400,
+		DuplicateBlobs: 1,
+		DuplicateSize:  200,
+	}
+
+	got := report
+	got.Snapshots = nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong report, want\n  %+v\ngot\n  %+v", want, got)
+	}
+
+	for i, size := range []uint64{200, 300} {
+		s := report.Snapshots[i]
+		if s.ExclusiveBlobs != 1 || s.ExclusiveSize != size {
+			t.Errorf("snapshot %d: wrong exclusive size, want 1 blob with %d bytes, got %d blobs with %d bytes",
+				i, size, s.ExclusiveBlobs, s.ExclusiveSize)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+
+	"github.com/restic/restic/internal/backend/archive"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/spf13/cobra"
+)
+
+var cmdImport = &cobra.Command{
+	Use:   "import file",
+	Short: "Import snapshots from an archive file",
+	Long: `
+The "import" command copies all snapshots from an archive file written by
+"restic export" into the repository. Snapshots which have been imported before
+are skipped. Only the data that is not yet present in the repository is added.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runImport(globalOptions, args)
+	},
+}
+
+func init() {
+	cmdRoot.AddCommand(cmdImport)
+}
+
+// snapshotOrigin returns the ID of the snapshot a copy was made from, or the
+// ID of the snapshot itself.
+func snapshotOrigin(sn *restic.Snapshot) restic.ID {
+	if sn.Original != nil {
+		return *sn.Original
+	}
+	return *sn.ID()
+}
+
+func runImport(gopts GlobalOptions, args []string) error {
+	if len(args) != 1 {
+		return errors.Fatal("please specify exactly one archive file")
+	}
+
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		lock, err := lockRepo(repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = repo.LoadIndex(gopts.ctx); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(gopts.ctx)
+	defer cancel()
+
+	be, err := archive.Open(args[0])
+	if err != nil {
+		return errors.Fatalf("unable to open archive: %v", err)
+	}
+	defer be.Close()
+
+	password, err := getArchivePassword(gopts, false)
+	if err != nil {
+		return err
+	}
+
+	src := repository.New(be)
+	err = src.SearchKey(ctx, password, maxKeys)
+	if err != nil {
+		return errors.Fatalf("unable to open archive: %v", err)
+	}
+
+	if err = src.LoadIndex(ctx); err != nil {
+		return err
+	}
+
+	present := restic.NewIDSet()
+	for sn := range FindFilteredSnapshots(ctx, repo, "", nil, nil, nil) {
+		present.Insert(snapshotOrigin(sn))
+	}
+
+	var snapshots []*restic.Snapshot
+	for sn := range FindFilteredSnapshots(ctx, src, "", nil, nil, nil) {
+		origin := snapshotOrigin(sn)
+		if present.Has(origin) {
+			Verbosef("snapshot %v has already been imported, skipping\n", origin.Str())
+			continue
+		}
+
+		snapshots = append(snapshots, sn)
+	}
+
+	if len(snapshots) == 0 {
+		Verbosef("no new snapshots found in archive\n")
+		return nil
+	}
+
+	err = copySnapshots(ctx, src, repo, snapshots)
+	if err != nil {
+		return err
+	}
+
+	Verbosef("imported %d snapshots from %v\n", len(snapshots), args[0])
+	return nil
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"github.com/restic/chunker"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
 
 	"github.com/spf13/cobra"
 )
@@ -12,26 +14,115 @@ var cmdInit = &cobra.Command{
 	Short: "Initialize a new repository",
 	Long: `
 The "init" command initializes a new repository.
+
+With --copy-chunker-params, the new repository uses the same chunker
+parameters as the repository given with --from-repo. Files are then split into
+the same blobs in both repositories, so that data can be transferred between
+them without storing it twice.
+
+With --repository-version 2, all data in the new repository is bound to the
+repository ID, so that data cannot be moved between repositories which share
+the same key. Older versions of restic cannot access such repositories.
+Existing repositories can be upgraded with "restic migrate bind_repo_id".
+
+With --repository-version 3, data and tree blobs are additionally compressed
+with zstd before they are encrypted, see the --compression option of the
+"backup" command. Repositories of version 2 can be upgraded with "restic
+migrate enable_compression".
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runInit(globalOptions, args)
+		return runInit(initOptions, globalOptions, args)
 	},
 }
 
+// InitOptions collects all options for the init command.
+type InitOptions struct {
+	InsecureNoEncryption bool
+	CopyChunkerParams    bool
+	FromRepo             string
+	FromPasswordFile     string
+	RepositoryVersion    uint
+
+	InsecureAllowWeakPassword bool
+}
+
+var initOptions InitOptions
+
 func init() {
 	cmdRoot.AddCommand(cmdInit)
+
+	f := cmdInit.Flags()
+	f.BoolVar(&initOptions.InsecureNoEncryption, "insecure-no-encryption", false, "store the data in plaintext, only authenticated (INSECURE, only for storage which is already encrypted)")
+	f.BoolVar(&initOptions.CopyChunkerParams, "copy-chunker-params", false, "copy chunker parameters from the repository given with --from-repo")
+	f.StringVar(&initOptions.FromRepo, "from-repo", "", "`repository` to copy the chunker parameters from")
+	f.BoolVar(&initOptions.InsecureAllowWeakPassword, "insecure-allow-weak-password", false, "allow a password which is easy to guess (INSECURE)")
+	f.UintVar(&initOptions.RepositoryVersion, "repository-version", 0, "create a repository of this `version` (1, 2 or 3, default 1, or 2 with --insecure-no-encryption)")
+	f.StringVar(&initOptions.FromPasswordFile, "from-password-file", "", "read the password for the repository given with --from-repo from a `file`")
 }
 
-func runInit(gopts GlobalOptions, args []string) error {
+// loadChunkerPolynomial opens the repository given by opts.FromRepo and
+// returns its chunker polynomial.
+func loadChunkerPolynomial(opts InitOptions, gopts GlobalOptions) (*chunker.Pol, error) {
+	if opts.FromRepo == "" {
+		return nil, errors.Fatal("--copy-chunker-params requires --from-repo")
+	}
+
+	otherOpts := gopts
+	otherOpts.Repo = opts.FromRepo
+	otherOpts.PasswordFile = opts.FromPasswordFile
+	otherOpts.password = ""
+	if opts.FromPasswordFile != "" {
+		var err error
+		otherOpts.password, err = resolvePassword(otherOpts, "")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	repo, err := OpenRepository(otherOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	pol := repo.Config().ChunkerPolynomial
+	return &pol, nil
+}
+
+func runInit(opts InitOptions, gopts GlobalOptions, args []string) error {
 	if gopts.Repo == "" {
 		return errors.Fatal("Please specify repository location (-r)")
 	}
 
-	be, err := create(gopts.Repo, gopts.extended)
+	if opts.RepositoryVersion == 0 {
+		opts.RepositoryVersion = restic.RepoVersion
+		if opts.InsecureNoEncryption {
+			opts.RepositoryVersion = restic.RepoVersionNoEncryption
+		}
+	}
+	if opts.RepositoryVersion < restic.RepoVersion || opts.RepositoryVersion > restic.MaxRepoVersion {
+		return errors.Fatalf("unsupported repository version %d", opts.RepositoryVersion)
+	}
+	if opts.InsecureNoEncryption && opts.RepositoryVersion < restic.RepoVersionNoEncryption {
+		return errors.Fatalf("--insecure-no-encryption requires at least repository version %d", restic.RepoVersionNoEncryption)
+	}
+
+	var chunkerPolynomial *chunker.Pol
+	if opts.CopyChunkerParams {
+		var err error
+		chunkerPolynomial, err = loadChunkerPolynomial(opts, gopts)
+		if err != nil {
+			return err
+		}
+	} else if opts.FromRepo != "" {
+		return errors.Fatal("--from-repo is only used with --copy-chunker-params")
+	}
+
+	be, err := create(gopts.Repo, gopts, gopts.extended)
 	if err != nil {
 		return errors.Fatalf("create repository at %s failed: %v\n", gopts.Repo, err)
 	}
+	be = trackUsage(be, gopts.Repo)
 
 	gopts.password, err = ReadPasswordTwice(gopts,
 		"enter password for new repository: ",
@@ -40,9 +131,19 @@ func runInit(gopts GlobalOptions, args []string) error {
 		return err
 	}
 
+	err = checkPasswordStrength(gopts.password, opts.InsecureAllowWeakPassword)
+	if err != nil {
+		return err
+	}
+
 	s := repository.New(be)
 
-	err = s.Init(gopts.ctx, gopts.password)
+	encryption := ""
+	if opts.InsecureNoEncryption {
+		encryption = restic.EncryptionNone
+	}
+
+	err = s.InitVersion(gopts.ctx, opts.RepositoryVersion, gopts.password, chunkerPolynomial, encryption)
 	if err != nil {
 		return errors.Fatalf("create key in repository at %s failed: %v\n", gopts.Repo, err)
 	}
@@ -53,5 +154,12 @@ func runInit(gopts GlobalOptions, args []string) error {
 	Verbosef("the repository. Losing your password means that your data is\n")
 	Verbosef("irrecoverably lost.\n")
 
+	if opts.InsecureNoEncryption {
+		Warnf("\n")
+		Warnf("WARNING: the data in this repository is NOT encrypted. Anybody with\n")
+		Warnf("access to the storage can read the contents of all backups, only\n")
+		Warnf("modifications are detected. This cannot be changed later.\n")
+	}
+
 	return nil
 }
@@ -16,15 +16,29 @@ var cmdKey = &cobra.Command{
 	Short: "Manage keys (passwords)",
 	Long: `
 The "key" command manages keys (passwords) for accessing the repository.
+
+New passwords for "add" and "passwd" are checked for their strength, passwords
+which are easy to guess are refused unless --insecure-allow-weak-password is
+given.
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runKey(globalOptions, args)
+		return runKey(keyOptions, globalOptions, args)
 	},
 }
 
+// KeyOptions collects all options for the key command.
+type KeyOptions struct {
+	InsecureAllowWeakPassword bool
+}
+
+var keyOptions KeyOptions
+
 func init() {
 	cmdRoot.AddCommand(cmdKey)
+
+	f := cmdKey.Flags()
+	f.BoolVar(&keyOptions.InsecureAllowWeakPassword, "insecure-allow-weak-password", false, "allow a new password which is easy to guess (INSECURE)")
 }
 
 func listKeys(ctx context.Context, s *repository.Repository) error {
@@ -59,23 +73,33 @@ func listKeys(ctx context.Context, s *repository.Repository) error {
 // testKeyNewPassword is used to set a new password during integration testing.
 var testKeyNewPassword string
 
-func getNewPassword(gopts GlobalOptions) (string, error) {
-	if testKeyNewPassword != "" {
-		return testKeyNewPassword, nil
+func getNewPassword(opts KeyOptions, gopts GlobalOptions) (string, error) {
+	pw := testKeyNewPassword
+	if pw == "" {
+		// Since we already have an open repository, temporary remove the password
+		// to prompt the user for the passwd.
+		newopts := gopts
+		newopts.password = ""
+
+		var err error
+		pw, err = ReadPasswordTwice(newopts,
+			"enter password for new key: ",
+			"enter password again: ")
+		if err != nil {
+			return "", err
+		}
 	}
 
-	// Since we already have an open repository, temporary remove the password
-	// to prompt the user for the passwd.
-	newopts := gopts
-	newopts.password = ""
+	err := checkPasswordStrength(pw, opts.InsecureAllowWeakPassword)
+	if err != nil {
+		return "", err
+	}
 
-	return ReadPasswordTwice(newopts,
-		"enter password for new key: ",
-		"enter password again: ")
+	return pw, nil
 }
 
-func addKey(gopts GlobalOptions, repo *repository.Repository) error {
-	pw, err := getNewPassword(gopts)
+func addKey(opts KeyOptions, gopts GlobalOptions, repo *repository.Repository) error {
+	pw, err := getNewPassword(opts, gopts)
 	if err != nil {
 		return err
 	}
@@ -105,8 +129,8 @@ func deleteKey(ctx context.Context, repo *repository.Repository, name string) er
 	return nil
 }
 
-func changePassword(gopts GlobalOptions, repo *repository.Repository) error {
-	pw, err := getNewPassword(gopts)
+func changePassword(opts KeyOptions, gopts GlobalOptions, repo *repository.Repository) error {
+	pw, err := getNewPassword(opts, gopts)
 	if err != nil {
 		return err
 	}
@@ -127,7 +151,7 @@ func changePassword(gopts GlobalOptions, repo *repository.Repository) error {
 	return nil
 }
 
-func runKey(gopts GlobalOptions, args []string) error {
+func runKey(opts KeyOptions, gopts GlobalOptions, args []string) error {
 	if len(args) < 1 || (args[0] == "remove" && len(args) != 2) || (args[0] != "remove" && len(args) != 1) {
 		return errors.Fatal("wrong number of arguments")
 	}
@@ -156,7 +180,7 @@ func runKey(gopts GlobalOptions, args []string) error {
 			return err
 		}
 
-		return addKey(gopts, repo)
+		return addKey(opts, gopts, repo)
 	case "remove":
 		lock, err := lockRepoExclusive(repo)
 		defer unlockRepo(lock)
@@ -177,7 +201,7 @@ func runKey(gopts GlobalOptions, args []string) error {
 			return err
 		}
 
-		return changePassword(gopts, repo)
+		return changePassword(opts, gopts, repo)
 	}
 
 	return nil
@@ -11,7 +11,7 @@ import (
 )
 
 var cmdList = &cobra.Command{
-	Use:   "list [blobs|packs|index|snapshots|keys|locks]",
+	Use:   "list [blobs|packs|index|snapshots|keys|locks|stats]",
 	Short: "List objects in the repository",
 	Long: `
 The "list" command allows listing objects in the repository based on type.
@@ -56,6 +56,22 @@ func runList(opts GlobalOptions, args []string) error {
 		t = restic.KeyFile
 	case "locks":
 		t = restic.LockFile
+	case "stats":
+		t = restic.StatsFile
+	case "ledger":
+		t = restic.LedgerFile
+	case "trash":
+		// the names of files in the trash are not IDs
+		list, err := restic.ListTrash(opts.ctx, repo.Backend())
+		if err != nil {
+			return err
+		}
+
+		for _, e := range list {
+			Printf("%s\n", e.Name)
+		}
+
+		return nil
 	case "blobs":
 		idx, err := index.Load(opts.ctx, repo, nil)
 		if err != nil {
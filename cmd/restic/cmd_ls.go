@@ -7,7 +7,6 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/restic/restic/internal/errors"
-	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 )
 
@@ -31,6 +30,7 @@ type LsOptions struct {
 	Host     string
 	Tags     restic.TagLists
 	Paths    []string
+	Federate []string
 }
 
 var lsOptions LsOptions
@@ -44,9 +44,10 @@ func init() {
 	flags.StringVarP(&lsOptions.Host, "host", "H", "", "only consider snapshots for this `host`, when no snapshot ID is given")
 	flags.Var(&lsOptions.Tags, "tag", "only consider snapshots which include this `taglist`, when no snapshot ID is given")
 	flags.StringArrayVar(&lsOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path`, when no snapshot ID is given")
+	flags.StringArrayVar(&lsOptions.Federate, "federate", nil, "also read snapshots and data from the `repository`, e.g. an archived repository (can be specified multiple times)")
 }
 
-func printTree(ctx context.Context, repo *repository.Repository, id *restic.ID, prefix string) error {
+func printTree(ctx context.Context, repo restic.Repository, id *restic.ID, prefix string) error {
 	tree, err := repo.LoadTree(ctx, *id)
 	if err != nil {
 		return err
@@ -70,7 +71,12 @@ func runLs(opts LsOptions, gopts GlobalOptions, args []string) error {
 		return errors.Fatal("Invalid arguments, either give one or more snapshot IDs or set filters.")
 	}
 
-	repo, err := OpenRepository(gopts)
+	mainRepo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	repo, err := openFederation(gopts, mainRepo, opts.Federate)
 	if err != nil {
 		return err
 	}
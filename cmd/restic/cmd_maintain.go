@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+var cmdMaintain = &cobra.Command{
+	Use:   "maintain [flags]",
+	Short: "Run the maintenance tasks which are due",
+	Long: `
+The "maintain" command runs the maintenance tasks for the repository which are
+due according to the policy given by the flags. It is meant to be called
+regularly, e.g. once a day, so that no separate schedules for "check" and
+"prune" are needed:
+
+ * "check" runs every --check-interval (default: weekly) and reads the
+   fraction of the data given by --check-read-data (default: 5%). Each run
+   reads another part of the data, so that all data is read eventually.
+ * "prune" runs every --prune-interval (default: every 30 days) and rewrites
+   at most --prune-max-repack (default: 50G) of pack files. It is skipped when
+   the check found errors.
+ * Old cache directories are removed on each run, unless --cleanup-cache=false
+   is passed.
+
+The time of each run is recorded in the repository statistics (see "restic
+stats --history"), so it does not matter on which host "maintain" runs. Set an
+interval to zero to disable a task. With --dry-run, only the tasks which are
+due are printed.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runMaintain(maintainOptions, globalOptions, args)
+	},
+}
+
+// MaintainOptions collects all options for the maintain command.
+type MaintainOptions struct {
+	CheckInterval  time.Duration
+	CheckReadData  string
+	PruneInterval  time.Duration
+	PruneMaxRepack string
+	CleanupCache   bool
+	DryRun         bool
+}
+
+var maintainOptions MaintainOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdMaintain)
+
+	f := cmdMaintain.Flags()
+	f.DurationVar(&maintainOptions.CheckInterval, "check-interval", 7*24*time.Hour, "run check if the last check is older than `duration`")
+	f.StringVar(&maintainOptions.CheckReadData, "check-read-data", "5%", "read this `percentage` of the data packs on each check")
+	f.DurationVar(&maintainOptions.PruneInterval, "prune-interval", 30*24*time.Hour, "run prune if the last prune is older than `duration`")
+	f.StringVar(&maintainOptions.PruneMaxRepack, "prune-max-repack", "50G", "rewrite at most `size` of pack files on each prune (empty for no limit)")
+	f.BoolVar(&maintainOptions.CleanupCache, "cleanup-cache", true, "remove old cache directories")
+	f.BoolVarP(&maintainOptions.DryRun, "dry-run", "n", false, "only print which tasks are due")
+}
+
+// maintenancePlan lists the maintenance tasks which are due.
+type maintenancePlan struct {
+	Check bool
+	// CheckSubset is the subset of the data read by check in the format of
+	// --read-data-subset, it is empty if no data is read.
+	CheckSubset string
+	Prune       bool
+}
+
+// parseReadDataPercentage returns the number of groups the data packs are
+// split into so that each check reads about the percentage p of the data, e.g.
+// 20 for "5%". Zero means that no data is read.
+func parseReadDataPercentage(p string) (uint, error) {
+	str := strings.TrimSuffix(strings.TrimSpace(p), "%")
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil || value < 0 || value > 100 {
+		return 0, errors.Fatalf("invalid percentage %q", p)
+	}
+
+	if value == 0 {
+		return 0, nil
+	}
+
+	return uint(math.Ceil(100 / value)), nil
+}
+
+// lastRun returns the time of the latest record for command and the number of
+// records for it.
+func lastRun(records []restic.RepositoryStats, command string) (last time.Time, count int) {
+	for _, rec := range records {
+		if rec.Command != command {
+			continue
+		}
+		count++
+		if rec.Time.After(last) {
+			last = rec.Time
+		}
+	}
+	return last, count
+}
+
+// due returns true if a task with the given interval which last ran at last
+// is due at now.
+func due(last time.Time, interval time.Duration, now time.Time) bool {
+	if interval <= 0 {
+		return false
+	}
+	return last.IsZero() || now.Sub(last) >= interval
+}
+
+// planMaintenance returns the tasks which are due at now, based on the
+// records of earlier runs.
+func planMaintenance(opts MaintainOptions, records []restic.RepositoryStats, now time.Time) (maintenancePlan, error) {
+	var plan maintenancePlan
+
+	groups, err := parseReadDataPercentage(opts.CheckReadData)
+	if err != nil {
+		return plan, err
+	}
+
+	lastCheck, checks := lastRun(records, "check")
+	if due(lastCheck, opts.CheckInterval, now) {
+		plan.Check = true
+		if groups > 0 {
+			// read the next group of data packs after the one read by the
+			// previous check
+			plan.CheckSubset = fmt.Sprintf("%d/%d", uint(checks)%groups+1, groups)
+		}
+	}
+
+	lastPrune, _ := lastRun(records, "prune")
+	plan.Prune = due(lastPrune, opts.PruneInterval, now)
+
+	return plan, nil
+}
+
+// loadMaintenanceRecords opens the repository and returns the records of the
+// repository statistics. When requested, old cache directories are removed
+// while the repository is opened.
+func loadMaintenanceRecords(opts MaintainOptions, gopts GlobalOptions) ([]restic.RepositoryStats, error) {
+	gopts.CleanupCache = gopts.CleanupCache || opts.CleanupCache
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return nil, err
+	}
+
+	if !gopts.NoLock {
+		lock, err := lockRepo(repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return restic.LoadRepositoryStats(gopts.ctx, repo)
+}
+
+// recordMaintenance saves a record of the repository statistics for command,
+// so that the next run of maintain knows when the task was run.
+func recordMaintenance(gopts GlobalOptions, command string) error {
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		lock, err := lockRepo(repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = repo.LoadIndex(gopts.ctx); err != nil {
+		return err
+	}
+
+	recordRepositoryStats(gopts.ctx, repo, command)
+	return nil
+}
+
+func runMaintain(opts MaintainOptions, gopts GlobalOptions, args []string) error {
+	if len(args) != 0 {
+		return errors.Fatal("maintain has no arguments")
+	}
+
+	if opts.PruneMaxRepack != "" {
+		if _, err := parseSize(opts.PruneMaxRepack); err != nil {
+			return err
+		}
+	}
+
+	records, err := loadMaintenanceRecords(opts, gopts)
+	if err != nil {
+		return err
+	}
+
+	plan, err := planMaintenance(opts, records, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if !plan.Check && !plan.Prune {
+		Verbosef("no maintenance tasks are due\n")
+		return nil
+	}
+
+	if opts.DryRun {
+		if plan.Check {
+			subset := plan.CheckSubset
+			if subset == "" {
+				subset = "none"
+			}
+			Printf("would run check, reading data subset %v\n", subset)
+		}
+		if plan.Prune {
+			Printf("would run prune\n")
+		}
+		return nil
+	}
+
+	if plan.Check {
+		Verbosef("running check\n")
+		err = runCheck(CheckOptions{ReadDataSubset: plan.CheckSubset}, gopts, nil)
+		if err != nil {
+			return errors.Fatalf("check failed, skipping the remaining tasks: %v", err)
+		}
+
+		if err = recordMaintenance(gopts, "check"); err != nil {
+			return err
+		}
+	}
+
+	if plan.Prune {
+		Verbosef("running prune\n")
+		err = runPrune(PruneOptions{MaxRepackSize: opts.PruneMaxRepack}, gopts)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
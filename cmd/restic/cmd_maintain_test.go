@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestPlanMaintenance(t *testing.T) {
+	now := time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+	opts := MaintainOptions{
+		CheckInterval: 7 * 24 * time.Hour,
+		CheckReadData: "5%",
+		PruneInterval: 30 * 24 * time.Hour,
+	}
+
+	var tests = []struct {
+		records []restic.RepositoryStats
+		want    maintenancePlan
+	}{
+		{
+			records: nil,
+			want:    maintenancePlan{Check: true, CheckSubset: "1/20", Prune: true},
+		},
+		{
+			records: []restic.RepositoryStats{
+				{Time: now.Add(-8 * 24 * time.Hour), Command: "check"},
+				{Time: now.Add(-2 * 24 * time.Hour), Command: "backup"},
+				{Time: now.Add(-40 * 24 * time.Hour), Command: "check"},
+				{Time: now.Add(-10 * 24 * time.Hour), Command: "prune"},
+			},
+			want: maintenancePlan{Check: true, CheckSubset: "3/20"},
+		},
+		{
+			records: []restic.RepositoryStats{
+				{Time: now.Add(-1 * 24 * time.Hour), Command: "check"},
+				{Time: now.Add(-31 * 24 * time.Hour), Command: "prune"},
+			},
+			want: maintenancePlan{Prune: true},
+		},
+	}
+
+	for _, test := range tests {
+		plan, err := planMaintenance(opts, test.records, now)
+		rtest.OK(t, err)
+		rtest.Equals(t, test.want, plan)
+	}
+
+	// a zero interval disables the task, a zero percentage the reading of data
+	opts.PruneInterval = 0
+	opts.CheckReadData = "0"
+	plan, err := planMaintenance(opts, nil, now)
+	rtest.OK(t, err)
+	rtest.Equals(t, maintenancePlan{Check: true}, plan)
+
+	opts.CheckReadData = "120%"
+	_, err = planMaintenance(opts, nil, now)
+	rtest.Assert(t, err != nil, "invalid percentage was accepted")
+}
+
+func TestLimitRepack(t *testing.T) {
+	ids := []restic.ID{restic.NewRandomID(), restic.NewRandomID(), restic.NewRandomID()}
+	usages := map[restic.ID]packUsage{
+		ids[0]: {size: 100, unused: 10},
+		ids[1]: {size: 100, unused: 80},
+		ids[2]: {size: 50, duplicate: 25},
+	}
+
+	selected := limitRepack(restic.NewIDSet(ids...), usages, 160)
+	rtest.Equals(t, restic.NewIDSet(ids[1], ids[2]), selected)
+
+	selected = limitRepack(restic.NewIDSet(ids...), usages, 120)
+	rtest.Equals(t, restic.NewIDSet(ids[1]), selected)
+}
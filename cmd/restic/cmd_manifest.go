@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/spf13/cobra"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+var cmdManifest = &cobra.Command{
+	Use:   "manifest [flags] snapshotID",
+	Short: "Print a list of all files in a snapshot with their hashes",
+	Long: `
+The "manifest" command prints all files and directories in a snapshot together
+with their size, mode, modification time and the SHA-256 hash of the content
+of each file. The manifest can be compared against checksum lists from other
+sources, for example to audit that a snapshot contains the expected data.
+
+Hashes stored during backup with --file-hash are used directly, all other
+hashes are computed from the data in the repository, which requires reading
+the file contents.
+
+With --sha256sum, only files are listed in the format of the sha256sum tool,
+so that "sha256sum --check" can verify the original files against the
+snapshot.
+
+The special snapshot "latest" can be used to use the latest snapshot in the
+repository.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runManifest(manifestOptions, globalOptions, args)
+	},
+}
+
+// ManifestOptions collects all options for the manifest command.
+type ManifestOptions struct {
+	Host      string
+	Paths     []string
+	Tags      restic.TagLists
+	SHA256Sum bool
+}
+
+var manifestOptions ManifestOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdManifest)
+
+	flags := cmdManifest.Flags()
+	flags.BoolVar(&manifestOptions.SHA256Sum, "sha256sum", false, "only list files, in the output format of sha256sum")
+	flags.StringVarP(&manifestOptions.Host, "host", "H", "", `only consider snapshots for this host when the snapshot ID is "latest"`)
+	flags.Var(&manifestOptions.Tags, "tag", "only consider snapshots which include this `taglist` for snapshot ID \"latest\"")
+	flags.StringArrayVar(&manifestOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path` for snapshot ID \"latest\"")
+}
+
+func runManifest(opts ManifestOptions, gopts GlobalOptions, args []string) error {
+	ctx := gopts.ctx
+
+	switch {
+	case len(args) == 0:
+		return errors.Fatal("no snapshot ID specified")
+	case len(args) > 1:
+		return errors.Fatalf("more than one snapshot ID specified: %v", args)
+	}
+
+	if opts.SHA256Sum && gopts.JSON {
+		return errors.Fatal("--sha256sum and --json are mutually exclusive")
+	}
+
+	snapshotIDString := args[0]
+	debug.Log("manifest for %v", snapshotIDString)
+
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		lock, err := lockRepo(repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = repo.LoadIndex(ctx)
+	if err != nil {
+		return err
+	}
+
+	var id restic.ID
+
+	if snapshotIDString == "latest" {
+		id, err = restic.FindLatestSnapshot(ctx, repo, opts.Paths, opts.Tags, opts.Host)
+		if err != nil {
+			Exitf(1, "latest snapshot for criteria not found: %v Paths:%v Host:%v", err, opts.Paths, opts.Host)
+		}
+	} else {
+		id, err = restic.FindSnapshot(repo, snapshotIDString)
+		if err != nil {
+			Exitf(1, "invalid id %q: %v", snapshotIDString, err)
+		}
+	}
+
+	sn, err := restic.LoadSnapshot(ctx, repo, id)
+	if err != nil {
+		Exitf(2, "loading snapshot %q failed: %v", snapshotIDString, err)
+	}
+
+	if gopts.JSON {
+		Printf("[")
+	}
+
+	first := true
+	err = restic.WalkManifest(ctx, repo, *sn.Tree, "/", func(entry restic.ManifestEntry) error {
+		switch {
+		case gopts.JSON:
+			buf, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			if !first {
+				Printf(",")
+			}
+			Printf("%s", buf)
+		case opts.SHA256Sum:
+			if entry.Type == "file" {
+				Printf("%s  %s\n", entry.SHA256, entry.Path)
+			}
+		default:
+			hash := entry.SHA256
+			if hash == "" {
+				hash = "-"
+			}
+			Printf("%-64s %10v %12d %s %s\n", hash, entry.Mode, entry.Size,
+				entry.ModTime.Format(TimeFormat), entry.Path)
+		}
+		first = false
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if gopts.JSON {
+		Printf("]\n")
+	}
+
+	return nil
+}
@@ -6,6 +6,9 @@ package main
 
 import (
 	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -43,6 +46,40 @@ You need to specify a sample format for exactly the following timestamp:
 
 For details please see the documentation for time.Format() at:
   https://godoc.org/time#Time.Format
+
+Access for other users
+======================
+
+By default, only the user running restic can access the mounted directory.
+When restic is run as root, a single unprivileged user can be given access to
+all files with --owner and --allow-other. All files and directories are then
+shown as owned by that user and can be read by the user regardless of the
+permissions they had when the backup was made:
+
+    --owner alice --allow-other
+
+The permissions of files and directories are checked by the kernel, so other
+users can only access data that was readable for them in the original file
+system.
+
+Restoring with a file manager
+=============================
+
+With --restore-target, the mount contains a writable directory "restore".
+Files and directories copied from a snapshot into it are restored to the
+target directory in the local file system, with the metadata from the
+snapshot (e.g. modification time and permissions).
+
+Comparing snapshots with the local file system
+==============================================
+
+With --diff-root, the directories "snapshots" and "ids" contain a file
+"<snapshot>.diff" next to each snapshot. Reading it lists the changes made to
+the backed up files since the snapshot was created, using the same markers as
+the "diff" command. The paths of the snapshot are interpreted relative to the
+given directory, so pass "/" to compare with the current state of the files:
+
+    --diff-root /
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -53,12 +90,16 @@ For details please see the documentation for time.Format() at:
 // MountOptions collects all options for the mount command.
 type MountOptions struct {
 	OwnerRoot        bool
+	Owner            string
 	AllowRoot        bool
 	AllowOther       bool
 	Host             string
 	Tags             restic.TagLists
 	Paths            []string
 	SnapshotTemplate string
+	RestoreTarget    string
+	DiffRoot         string
+	Federate         []string
 }
 
 var mountOptions MountOptions
@@ -68,31 +109,140 @@ func init() {
 
 	mountFlags := cmdMount.Flags()
 	mountFlags.BoolVar(&mountOptions.OwnerRoot, "owner-root", false, "use 'root' as the owner of files and dirs")
+	mountFlags.StringVar(&mountOptions.Owner, "owner", "", "use `user[:group]` as the owner of files and dirs and allow it to read all files")
 	mountFlags.BoolVar(&mountOptions.AllowRoot, "allow-root", false, "allow root user to access the data in the mounted directory")
 	mountFlags.BoolVar(&mountOptions.AllowOther, "allow-other", false, "allow other users to access the data in the mounted directory")
 
 	mountFlags.StringVarP(&mountOptions.Host, "host", "H", "", `only consider snapshots for this host`)
 	mountFlags.Var(&mountOptions.Tags, "tag", "only consider snapshots which include this `taglist`")
 	mountFlags.StringArrayVar(&mountOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path`")
+	mountFlags.StringArrayVar(&mountOptions.Federate, "federate", nil, "also read snapshots and data from the `repository`, e.g. an archived repository (can be specified multiple times)")
 
+	mountFlags.StringVar(&mountOptions.RestoreTarget, "restore-target", "", "restore files copied to the directory 'restore' in the mount to `dir`")
+	mountFlags.StringVar(&mountOptions.DiffRoot, "diff-root", "", "add files '<snapshot>.diff' which compare the snapshot with the files below `dir`")
 	mountFlags.StringVar(&mountOptions.SnapshotTemplate, "snapshot-template", time.RFC3339, "set `template` to use for snapshot dirs")
 }
 
+// parseOwner returns the user and group ID for owner, which is a user name or
+// ID, optionally followed by a colon and a group name or ID. Without a group,
+// the primary group of the user is used.
+func parseOwner(owner string) (uid, gid uint32, err error) {
+	userName, groupName := owner, ""
+	if i := strings.Index(owner, ":"); i >= 0 {
+		userName, groupName = owner[:i], owner[i+1:]
+	}
+
+	u, err := user.Lookup(userName)
+	if err != nil {
+		u, err = user.LookupId(userName)
+	}
+	if err != nil {
+		return 0, 0, errors.Fatalf("unknown user %q", userName)
+	}
+
+	id, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return 0, 0, errors.Fatalf("invalid user ID %q", u.Uid)
+	}
+	uid = uint32(id)
+
+	groupID := u.Gid
+	if groupName != "" {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			g, err = user.LookupGroupId(groupName)
+		}
+		if err != nil {
+			return 0, 0, errors.Fatalf("unknown group %q", groupName)
+		}
+		groupID = g.Gid
+	}
+
+	id, err = strconv.ParseUint(groupID, 10, 32)
+	if err != nil {
+		return 0, 0, errors.Fatalf("invalid group ID %q", groupID)
+	}
+	gid = uint32(id)
+
+	return uid, gid, nil
+}
+
 func mount(opts MountOptions, gopts GlobalOptions, mountpoint string) error {
 	debug.Log("start mount")
 	defer debug.Log("finish mount")
 
-	repo, err := OpenRepository(gopts)
+	cfg := fuse.Config{
+		OwnerIsRoot:      opts.OwnerRoot,
+		Host:             opts.Host,
+		Tags:             opts.Tags,
+		Paths:            opts.Paths,
+		SnapshotTemplate: opts.SnapshotTemplate,
+	}
+
+	if opts.RestoreTarget != "" {
+		target, err := filepath.Abs(opts.RestoreTarget)
+		if err != nil {
+			return errors.Wrap(err, "Abs")
+		}
+
+		fi, err := resticfs.Stat(target)
+		if err != nil || !fi.IsDir() {
+			return errors.Fatalf("restore target %v is not a directory", opts.RestoreTarget)
+		}
+
+		cfg.RestoreTarget = target
+	}
+
+	if opts.DiffRoot != "" {
+		root, err := filepath.Abs(opts.DiffRoot)
+		if err != nil {
+			return errors.Wrap(err, "Abs")
+		}
+
+		fi, err := resticfs.Stat(root)
+		if err != nil || !fi.IsDir() {
+			return errors.Fatalf("diff root %v is not a directory", opts.DiffRoot)
+		}
+
+		cfg.DiffRoot = root
+	}
+
+	if opts.Owner != "" {
+		uid, gid, err := parseOwner(opts.Owner)
+		if err != nil {
+			return err
+		}
+
+		if uid != uint32(os.Getuid()) && !opts.AllowOther {
+			return errors.Fatal("--owner needs --allow-other so that the user can access the mounted directory")
+		}
+
+		cfg.OverrideOwner = true
+		cfg.UID = uid
+		cfg.GID = gid
+	}
+
+	mainRepo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	_, err = useDataCache(mainRepo, gopts)
 	if err != nil {
 		return err
 	}
 
-	lock, err := lockRepo(repo)
+	lock, err := lockRepo(mainRepo)
 	defer unlockRepo(lock)
 	if err != nil {
 		return err
 	}
 
+	repo, err := openFederation(gopts, mainRepo, opts.Federate)
+	if err != nil {
+		return err
+	}
+
 	err = repo.LoadIndex(gopts.ctx)
 	if err != nil {
 		return err
@@ -107,10 +257,14 @@ func mount(opts MountOptions, gopts GlobalOptions, mountpoint string) error {
 	}
 
 	mountOptions := []systemFuse.MountOption{
-		systemFuse.ReadOnly(),
 		systemFuse.FSName("restic"),
 	}
 
+	// only the restore directory is writable, the snapshots stay read-only
+	if cfg.RestoreTarget == "" {
+		mountOptions = append(mountOptions, systemFuse.ReadOnly())
+	}
+
 	if opts.AllowRoot {
 		mountOptions = append(mountOptions, systemFuse.AllowRoot())
 	}
@@ -119,6 +273,12 @@ func mount(opts MountOptions, gopts GlobalOptions, mountpoint string) error {
 		mountOptions = append(mountOptions, systemFuse.AllowOther())
 	}
 
+	// let the kernel check the permissions, so that other users cannot read
+	// the files which are made readable for the owner
+	if opts.Owner != "" {
+		mountOptions = append(mountOptions, systemFuse.DefaultPermissions())
+	}
+
 	c, err := systemFuse.Mount(mountpoint, mountOptions...)
 	if err != nil {
 		return err
@@ -128,13 +288,6 @@ func mount(opts MountOptions, gopts GlobalOptions, mountpoint string) error {
 		debug.Log("fuse: %v", msg)
 	}
 
-	cfg := fuse.Config{
-		OwnerIsRoot:      opts.OwnerRoot,
-		Host:             opts.Host,
-		Tags:             opts.Tags,
-		Paths:            opts.Paths,
-		SnapshotTemplate: opts.SnapshotTemplate,
-	}
 	root, err := fuse.NewRoot(gopts.ctx, repo, cfg)
 	if err != nil {
 		return err
@@ -166,6 +319,10 @@ func runMount(opts MountOptions, gopts GlobalOptions, args []string) error {
 		return errors.Fatal("snapshot template string contains a slash (/) or backslash (\\) character")
 	}
 
+	if opts.OwnerRoot && opts.Owner != "" {
+		return errors.Fatal("--owner-root and --owner cannot be used together")
+	}
+
 	if len(args) == 0 {
 		return errors.Fatal("wrong number of parameters")
 	}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+var cmdPin = &cobra.Command{
+	Use:   "pin [flags] [snapshot-ID ...]",
+	Short: "Protect snapshots from being removed",
+	Long: `
+The "pin" command marks snapshots as pinned. Pinned snapshots are always kept
+by the "forget" command, regardless of the policy, and cannot be removed by
+passing their ID to "forget" either. Use "unpin" to remove the mark.
+
+When no snapshot-ID is given, all snapshots matching the host, tag and path
+filter criteria are pinned. At least one snapshot-ID or filter is required.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runPin(pinOptions, globalOptions, args, true)
+	},
+}
+
+var cmdUnpin = &cobra.Command{
+	Use:   "unpin [flags] [snapshot-ID ...]",
+	Short: "Allow pinned snapshots to be removed again",
+	Long: `
+The "unpin" command removes the mark set by "pin" from snapshots, so that they
+are handled by the "forget" command as usual.
+
+When no snapshot-ID is given, all snapshots matching the host, tag and path
+filter criteria are unpinned. At least one snapshot-ID or filter is required.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runPin(pinOptions, globalOptions, args, false)
+	},
+}
+
+// PinOptions bundles all options for the 'pin' and 'unpin' commands.
+type PinOptions struct {
+	Host  string
+	Paths []string
+	Tags  restic.TagLists
+}
+
+var pinOptions PinOptions
+
+func init() {
+	for _, cmd := range []*cobra.Command{cmdPin, cmdUnpin} {
+		cmdRoot.AddCommand(cmd)
+
+		f := cmd.Flags()
+		f.StringVarP(&pinOptions.Host, "host", "H", "", "only consider snapshots for this `host`, when no snapshot ID is given")
+		f.Var(&pinOptions.Tags, "tag", "only consider snapshots which include this `taglist`, when no snapshot-ID is given")
+		f.StringArrayVar(&pinOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path`, when no snapshot-ID is given")
+	}
+}
+
+func runPin(opts PinOptions, gopts GlobalOptions, args []string, pin bool) error {
+	// without this check, a typo could (un)pin all snapshots at once
+	if len(args) == 0 && opts.Host == "" && len(opts.Tags) == 0 && len(opts.Paths) == 0 {
+		return errors.Fatal("no snapshots given, pass at least one snapshot ID or a --host, --tag or --path filter")
+	}
+
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		Verbosef("create exclusive lock for repository\n")
+		lock, err := lockRepoExclusive(repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	changeCnt := 0
+	ctx, cancel := context.WithCancel(gopts.ctx)
+	defer cancel()
+	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, args) {
+		if sn.Pinned == pin {
+			continue
+		}
+
+		sn.Pinned = pin
+		if err := replaceSnapshot(ctx, repo, sn); err != nil {
+			Warnf("unable to modify snapshot ID %q, ignoring: %v\n", sn.ID(), err)
+			continue
+		}
+		changeCnt++
+	}
+
+	action := "pinned"
+	if !pin {
+		action = "unpinned"
+	}
+
+	if changeCnt == 0 {
+		Verbosef("no snapshots were modified\n")
+	} else {
+		Verbosef("%v %v snapshots\n", action, changeCnt)
+	}
+	return nil
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/restic/restic/internal/debug"
@@ -19,15 +22,96 @@ var cmdPrune = &cobra.Command{
 	Long: `
 The "prune" command checks the repository and removes data that is not
 referenced and therefore not needed any more.
+
+With --dry-run, nothing is modified. Instead, restic reports how much space
+would be freed and which pack files would be removed or rewritten.
+
+For backends where storing data for a short time or downloading it again costs
+extra, the options --repack-min-age, --repack-max-age and
+--repack-skip-storage-class exclude pack files from being rewritten. Pack
+files younger than --repack-min-age are not removed either. The unused data in
+these files is kept and revisited by a later run of prune.
+
+To spread the work over several runs, --max-repack-size limits the total size
+of the pack files which are rewritten. The pack files with the largest share of
+unused data are rewritten first.
+
+Pack files which are no longer needed are moved to the trash, the space is
+only freed when the trash is purged with "restic purge-trash". Pass --no-trash
+to delete them immediately. Most backends move the files on the server. The
+b2 and rest backends cannot do that, there unneeded pack files are deleted
+immediately unless --trash-copy is passed. With --trash-copy, each pack file
+is downloaded and uploaded again to move it, which takes about as long as
+downloading all unneeded data and may incur traffic costs.
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runPrune(globalOptions)
+		return runPrune(pruneOptions, globalOptions)
 	},
 }
 
+// PruneOptions collects all options for the prune command.
+type PruneOptions struct {
+	DryRun bool
+
+	RepackMinAge       time.Duration
+	RepackMaxAge       time.Duration
+	RepackStorageClass []string
+	MaxRepackSize      string
+
+	NoTrash   bool
+	TrashCopy bool
+}
+
+var pruneOptions PruneOptions
+
 func init() {
 	cmdRoot.AddCommand(cmdPrune)
+
+	f := cmdPrune.Flags()
+	f.BoolVarP(&pruneOptions.DryRun, "dry-run", "n", false, "do not modify the repository, just print what would be done")
+	f.DurationVar(&pruneOptions.RepackMinAge, "repack-min-age", 0, "do not rewrite or remove pack files younger than `duration` (e.g. 2160h)")
+	f.DurationVar(&pruneOptions.RepackMaxAge, "repack-max-age", 0, "do not rewrite pack files older than `duration` (e.g. 720h)")
+	f.BoolVar(&pruneOptions.NoTrash, "no-trash", false, "delete unneeded pack files immediately instead of moving them to the trash")
+	f.BoolVar(&pruneOptions.TrashCopy, "trash-copy", false, "copy pack files into the trash on backends which cannot move them (b2, rest)")
+	f.StringArrayVar(&pruneOptions.RepackStorageClass, "repack-skip-storage-class", nil, "do not rewrite pack files stored in storage `class` (e.g. GLACIER, can be specified multiple times)")
+	f.StringVar(&pruneOptions.MaxRepackSize, "max-repack-size", "", "rewrite at most `size` (e.g. 50G) of pack files, the rest is left for later runs")
+}
+
+// filterPacks returns true if any of the options which exclude pack files
+// from being rewritten is set.
+func (opts PruneOptions) filterPacks() bool {
+	return opts.RepackMinAge > 0 || opts.RepackMaxAge > 0 || len(opts.RepackStorageClass) > 0
+}
+
+// tooYoung returns true if the pack file described by fi must neither be
+// rewritten nor removed.
+func (opts PruneOptions) tooYoung(fi restic.FileInfo, now time.Time) bool {
+	if opts.RepackMinAge == 0 || fi.ModTime.IsZero() {
+		return false
+	}
+
+	return now.Sub(fi.ModTime) < opts.RepackMinAge
+}
+
+// skipRepack returns true if the pack file described by fi must not be
+// rewritten.
+func (opts PruneOptions) skipRepack(fi restic.FileInfo, now time.Time) bool {
+	if opts.tooYoung(fi, now) {
+		return true
+	}
+
+	if opts.RepackMaxAge > 0 && !fi.ModTime.IsZero() && now.Sub(fi.ModTime) > opts.RepackMaxAge {
+		return true
+	}
+
+	for _, class := range opts.RepackStorageClass {
+		if fi.StorageClass != "" && strings.EqualFold(class, fi.StorageClass) {
+			return true
+		}
+	}
+
+	return false
 }
 
 func shortenStatus(maxLength int, s string) string {
@@ -70,19 +154,78 @@ func newProgressMax(show bool, max uint64, description string) *restic.Progress
 	return p
 }
 
-func runPrune(gopts GlobalOptions) error {
+// limitRepack returns the packs from rewritePacks which are rewritten when at
+// most maxSize bytes of pack files may be rewritten. The packs with the
+// largest share of unused or duplicate data are selected first.
+func limitRepack(rewritePacks restic.IDSet, usages map[restic.ID]packUsage, maxSize int64) restic.IDSet {
+	ids := rewritePacks.List()
+	sort.SliceStable(ids, func(i, j int) bool {
+		ui, uj := usages[ids[i]], usages[ids[j]]
+		// compare (unused+duplicate)/size without dividing
+		return (ui.unused+ui.duplicate)*uj.size > (uj.unused+uj.duplicate)*ui.size
+	})
+
+	selected := restic.NewIDSet()
+	var size int64
+	for _, id := range ids {
+		if size+usages[id].size > maxSize {
+			continue
+		}
+		size += usages[id].size
+		selected.Insert(id)
+	}
+
+	return selected
+}
+
+func runPrune(opts PruneOptions, gopts GlobalOptions) error {
+	if opts.MaxRepackSize != "" {
+		if _, err := parseSize(opts.MaxRepackSize); err != nil {
+			return err
+		}
+	}
+
 	repo, err := OpenRepository(gopts)
 	if err != nil {
 		return err
 	}
 
-	lock, err := lockRepoExclusive(repo)
+	if !opts.DryRun {
+		if err = checkNotSealed(repo); err != nil {
+			return err
+		}
+	}
+
+	var lock *restic.Lock
+	if opts.DryRun {
+		// nothing is modified, so a non-exclusive lock is sufficient
+		lock, err = lockRepo(repo)
+	} else {
+		lock, err = lockRepoExclusive(repo)
+	}
 	defer unlockRepo(lock)
 	if err != nil {
 		return err
 	}
 
-	return pruneRepository(gopts, repo)
+	err = pruneRepository(gopts, opts, repo)
+	if err != nil || opts.DryRun {
+		return err
+	}
+
+	return recordPruneStats(gopts.ctx, repo)
+}
+
+// recordPruneStats reloads the index, which has been rewritten by prune, and
+// saves the stats of the repository.
+func recordPruneStats(ctx context.Context, repo *repository.Repository) error {
+	repo.SetIndex(repository.NewMasterIndex())
+	if err := repo.LoadIndex(ctx); err != nil {
+		return err
+	}
+
+	recordRepositoryStats(ctx, repo, "prune")
+	return nil
 }
 
 func mixedBlobs(list []restic.Blob) bool {
@@ -104,7 +247,64 @@ func mixedBlobs(list []restic.Blob) bool {
 	return false
 }
 
-func pruneRepository(gopts GlobalOptions, repo restic.Repository) error {
+// packUsage describes how much of the data in a pack file is still needed.
+type packUsage struct {
+	size      int64
+	unused    int64
+	duplicate int64
+}
+
+// usage returns the usage of pack p, given the set of used blobs and the
+// number of packs each blob is stored in.
+func usage(p *index.Pack, usedBlobs restic.BlobSet, blobCount map[restic.BlobHandle]int) packUsage {
+	u := packUsage{size: p.Size}
+	for _, blob := range p.Entries {
+		h := restic.BlobHandle{ID: blob.ID, Type: blob.Type}
+		switch {
+		case !usedBlobs.Has(h):
+			u.unused += int64(blob.Length)
+		case blobCount[h] > 1:
+			u.duplicate += int64(blob.Length)
+		}
+	}
+
+	return u
+}
+
+// printPrunePlan prints what prune would do with the packs in removePacks and
+// rewritePacks, without modifying anything.
+func printPrunePlan(idx *index.Index, usedBlobs restic.BlobSet, blobCount map[restic.BlobHandle]int,
+	removePacks, rewritePacks restic.IDSet, invalidFiles restic.IDs, removeBytes, totalBytes int64) {
+
+	var removeSize, rewriteSize int64
+
+	for id := range removePacks {
+		p, ok := idx.Packs[id]
+		if !ok {
+			// invalid files are not contained in the index
+			continue
+		}
+		removeSize += p.Size
+	}
+
+	Printf("\npack files that would be rewritten:\n")
+	for id := range rewritePacks {
+		p := idx.Packs[id]
+		u := usage(&p, usedBlobs, blobCount)
+		rewriteSize += u.size
+		Printf("  %v  %10s  %8s unused  %8s duplicate\n", id.Str(), formatBytes(uint64(u.size)),
+			formatPercent(uint64(u.unused), uint64(u.size)),
+			formatPercent(uint64(u.duplicate), uint64(u.size)))
+	}
+
+	Printf("\nwould remove %d invalid files, delete %d packs (%s) and rewrite %d packs (%s)\n",
+		len(invalidFiles), len(removePacks)-len(invalidFiles), formatBytes(uint64(removeSize)),
+		len(rewritePacks), formatBytes(uint64(rewriteSize)))
+	Printf("this would free %s (%s of the repository)\n", formatBytes(uint64(removeBytes)),
+		formatPercent(uint64(removeBytes), uint64(totalBytes)))
+}
+
+func pruneRepository(gopts GlobalOptions, opts PruneOptions, repo *repository.Repository) error {
 	ctx := gopts.ctx
 
 	err := repo.LoadIndex(ctx)
@@ -119,19 +319,43 @@ func pruneRepository(gopts GlobalOptions, repo restic.Repository) error {
 		bytes     int64
 	}
 
+	// packInfo is only filled when pack files need to be filtered
+	packInfo := make(map[restic.ID]restic.FileInfo)
+	missingModTime := false
+
 	Verbosef("counting files in repo\n")
-	err = repo.List(ctx, restic.DataFile, func(restic.ID, int64) error {
+	err = repo.Backend().List(ctx, restic.DataFile, func(fi restic.FileInfo) error {
 		stats.packs++
+
+		if !opts.filterPacks() {
+			return nil
+		}
+
+		id, err := restic.ParseID(fi.Name)
+		if err != nil {
+			debug.Log("unable to parse %v as an ID", fi.Name)
+			return nil
+		}
+
+		if fi.ModTime.IsZero() {
+			missingModTime = true
+		}
+
+		packInfo[id] = fi
 		return nil
 	})
 	if err != nil {
 		return err
 	}
 
+	if missingModTime && (opts.RepackMinAge > 0 || opts.RepackMaxAge > 0) {
+		Warnf("the backend does not report the age of pack files, --repack-min-age and --repack-max-age are ignored\n")
+	}
+
 	Verbosef("building new index for repo\n")
 
 	bar := newProgressMax(!gopts.Quiet, uint64(stats.packs), "packs")
-	idx, invalidFiles, err := index.New(ctx, repo, restic.NewIDSet(), bar)
+	idx, invalidFiles, err := index.New(ctx, repo.ReverseIndex().Lister(repo), restic.NewIDSet(), bar)
 	if err != nil {
 		return err
 	}
@@ -140,6 +364,8 @@ func pruneRepository(gopts GlobalOptions, repo restic.Repository) error {
 		Warnf("incomplete pack file (will be removed): %v\n", id)
 	}
 
+	saveReverseIndex(repo, idx)
+
 	blobs := 0
 	for _, pack := range idx.Packs {
 		stats.bytes += pack.Size
@@ -178,17 +404,22 @@ func pruneRepository(gopts GlobalOptions, repo restic.Repository) error {
 
 	stats.snapshots = len(snapshots)
 
+	// process the newest snapshots first, so that their blobs come first in
+	// the order used for repacking
+	sort.Sort(restic.Snapshots(snapshots))
+
 	Verbosef("find data that is still in use for %d snapshots\n", stats.snapshots)
 
 	usedBlobs := restic.NewBlobSet()
 	seenBlobs := restic.NewBlobSet()
+	blobOrder := restic.NewBlobOrder()
 
 	bar = newProgressMax(!gopts.Quiet, uint64(len(snapshots)), "snapshots")
 	bar.Start()
 	for _, sn := range snapshots {
 		debug.Log("process snapshot %v", sn.ID())
 
-		err = restic.FindUsedBlobs(ctx, repo, *sn.Tree, usedBlobs, seenBlobs)
+		err = restic.FindUsedBlobsOrdered(ctx, repo, *sn.Tree, usedBlobs, seenBlobs, blobOrder)
 		if err != nil {
 			if repo.Backend().IsNotExist(err) {
 				return errors.Fatal("unable to load a tree from the repo: " + err.Error())
@@ -197,6 +428,13 @@ func pruneRepository(gopts GlobalOptions, repo restic.Repository) error {
 			return err
 		}
 
+		// the canary is referenced by the snapshot itself, not by its tree
+		if sn.Canary != nil {
+			h := restic.BlobHandle{ID: sn.Canary.Blob, Type: restic.DataBlob}
+			usedBlobs.Insert(h)
+			blobOrder.Insert(h)
+		}
+
 		debug.Log("processed snapshot %v", sn.ID())
 		bar.Report(restic.Stat{Blobs: 1})
 	}
@@ -268,6 +506,74 @@ func pruneRepository(gopts GlobalOptions, repo restic.Repository) error {
 		rewritePacks.Delete(packID)
 	}
 
+	if opts.filterPacks() {
+		now := time.Now()
+		invalid := restic.NewIDSet(invalidFiles...)
+
+		var keptPacks int
+		var keptBytes int64
+		for packID := range rewritePacks {
+			if !opts.skipRepack(packInfo[packID], now) {
+				continue
+			}
+
+			p := idx.Packs[packID]
+			keptPacks++
+			keptBytes += usage(&p, usedBlobs, blobCount).unused
+			rewritePacks.Delete(packID)
+		}
+
+		for packID := range removePacks {
+			if invalid.Has(packID) || !opts.tooYoung(packInfo[packID], now) {
+				continue
+			}
+
+			p := idx.Packs[packID]
+			keptPacks++
+			keptBytes += usage(&p, usedBlobs, blobCount).unused
+			removePacks.Delete(packID)
+		}
+
+		if keptPacks > 0 {
+			Verbosef("keeping %d packs with %s of unused data because of their age or storage class\n",
+				keptPacks, formatBytes(uint64(keptBytes)))
+			removeBytes -= int(keptBytes)
+		}
+	}
+
+	if opts.MaxRepackSize != "" {
+		maxSize, err := parseSize(opts.MaxRepackSize)
+		if err != nil {
+			return err
+		}
+
+		usages := make(map[restic.ID]packUsage, len(rewritePacks))
+		for packID := range rewritePacks {
+			p := idx.Packs[packID]
+			usages[packID] = usage(&p, usedBlobs, blobCount)
+		}
+
+		selected := limitRepack(rewritePacks, usages, int64(maxSize))
+		if len(selected) < len(rewritePacks) {
+			var deferredBytes int64
+			for packID := range rewritePacks {
+				if !selected.Has(packID) {
+					deferredBytes += usages[packID].unused
+				}
+			}
+
+			Verbosef("rewriting only %d of %d packs because of --max-repack-size, %s of unused data are left for later runs\n",
+				len(selected), len(rewritePacks), formatBytes(uint64(deferredBytes)))
+			removeBytes -= int(deferredBytes)
+			rewritePacks = selected
+		}
+	}
+
+	if opts.DryRun {
+		printPrunePlan(idx, usedBlobs, blobCount, removePacks, rewritePacks, invalidFiles, int64(removeBytes), stats.bytes)
+		return nil
+	}
+
 	Verbosef("will delete %d packs and rewrite %d packs, this frees %s\n",
 		len(removePacks), len(rewritePacks), formatBytes(uint64(removeBytes)))
 
@@ -275,7 +581,7 @@ func pruneRepository(gopts GlobalOptions, repo restic.Repository) error {
 	if len(rewritePacks) != 0 {
 		bar = newProgressMax(!gopts.Quiet, uint64(len(rewritePacks)), "packs rewritten")
 		bar.Start()
-		obsoletePacks, err = repository.Repack(ctx, repo, rewritePacks, usedBlobs, bar)
+		obsoletePacks, err = repository.Repack(ctx, repo, rewritePacks, usedBlobs, blobOrder, bar)
 		if err != nil {
 			return err
 		}
@@ -293,9 +599,9 @@ func pruneRepository(gopts GlobalOptions, repo restic.Repository) error {
 		bar.Start()
 		for packID := range removePacks {
 			h := restic.Handle{Type: restic.DataFile, Name: packID.String()}
-			err = repo.Backend().Remove(ctx, h)
+			err = removeFile(ctx, repo, h, opts.NoTrash, opts.TrashCopy)
 			if err != nil {
-				Warnf("unable to remove file %v from the repository\n", packID.Str())
+				Warnf("unable to remove file %v from the repository: %v\n", packID.Str(), err)
 			}
 			bar.Report(restic.Stat{Blobs: 1})
 		}
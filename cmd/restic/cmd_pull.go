@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/backend/sftp"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/pipe"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdPull = &cobra.Command{
+	Use:   "pull [flags] --hosts file",
+	Short: "Back up several hosts over sftp",
+	Long: `
+The "pull" command backs up files from several other hosts, which only need to
+run an sftp server, so restic does not have to be installed on them. The hosts
+and directories are read from a file with one host per line:
+
+  # [user@]host  path [path ...]
+  root@web1      /etc /var/www
+  backup@db1     /var/backups/postgres
+
+Empty lines and lines starting with '#' are ignored. The hosts are read
+concurrently, each one is saved in a separate snapshot with the hostname set
+to the host and the tag "pull". Afterwards a report for all hosts is printed.
+
+The exit code is 0 if all hosts have been saved and 1 if at least one host
+failed.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runPull(pullOptions, globalOptions, args)
+	},
+}
+
+// PullOptions bundles all options for the pull command.
+type PullOptions struct {
+	HostsFile        string
+	Tags             []string
+	Excludes         []string
+	ExcludeFiles     []string
+	ExcludeIfPresent []string
+	ExcludeCaches    bool
+	Force            bool
+	Canary           bool
+	Concurrency      uint
+}
+
+var pullOptions PullOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdPull)
+
+	f := cmdPull.Flags()
+	f.StringVar(&pullOptions.HostsFile, "hosts", "", "read the hosts and paths to back up from `file`")
+	f.StringArrayVar(&pullOptions.Tags, "tag", nil, "add a `tag` to the new snapshots in addition to \"pull\" (can be specified multiple times)")
+	f.StringArrayVarP(&pullOptions.Excludes, "exclude", "e", nil, "exclude a `pattern` on all hosts (can be specified multiple times)")
+	f.StringArrayVar(&pullOptions.ExcludeFiles, "exclude-file", nil, "read exclude patterns from a `file` (can be specified multiple times)")
+	f.StringArrayVar(&pullOptions.ExcludeIfPresent, "exclude-if-present", nil, "takes filename[:header], exclude contents of directories containing filename (except filename itself) if header of that file is as provided (can be specified multiple times)")
+	f.BoolVar(&pullOptions.ExcludeCaches, "exclude-caches", false, `excludes cache directories that are marked with a CACHEDIR.TAG file`)
+	f.BoolVarP(&pullOptions.Force, "force", "f", false, `force re-reading the target files/directories (overrides the "parent" flag)`)
+	f.BoolVar(&pullOptions.Canary, "canary", false, "save a small blob with known content with each snapshot, which is verified by 'restic check'")
+	f.UintVar(&pullOptions.Concurrency, "concurrency", 4, "back up at most `n` hosts at the same time")
+}
+
+// pullTag is added to all snapshots created by the pull command.
+const pullTag = "pull"
+
+// pullHost is a host to back up, as listed in the hosts file.
+type pullHost struct {
+	User  string
+	Host  string
+	Paths []string
+}
+
+// parsePullHosts parses the lines of a hosts file.
+func parsePullHosts(lines []string) ([]pullHost, error) {
+	var hosts []pullHost
+	seen := make(map[string]struct{})
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, errors.Fatalf("invalid line %q in hosts file: no paths specified", line)
+		}
+
+		var h pullHost
+		h.Host = fields[0]
+		if i := strings.LastIndex(h.Host, "@"); i >= 0 {
+			h.User, h.Host = h.Host[:i], h.Host[i+1:]
+		}
+		if h.Host == "" {
+			return nil, errors.Fatalf("invalid line %q in hosts file: no host specified", line)
+		}
+
+		if _, ok := seen[h.Host]; ok {
+			return nil, errors.Fatalf("host %v is listed more than once in the hosts file", h.Host)
+		}
+		seen[h.Host] = struct{}{}
+
+		for _, p := range fields[1:] {
+			if !path.IsAbs(p) {
+				return nil, errors.Fatalf("the path %q for host %v must be absolute", p, h.Host)
+			}
+			h.Paths = append(h.Paths, path.Clean(p))
+		}
+
+		hosts = append(hosts, h)
+	}
+
+	return hosts, nil
+}
+
+// pullResult is the outcome of backing up one host.
+type pullResult struct {
+	Host     string                  `json:"host"`
+	Paths    []string                `json:"paths"`
+	Success  bool                    `json:"success"`
+	Error    string                  `json:"error,omitempty"`
+	Snapshot *restic.ID              `json:"snapshot,omitempty"`
+	Parent   *restic.ID              `json:"parent,omitempty"`
+	Summary  *restic.SnapshotSummary `json:"summary,omitempty"`
+	Warnings int                     `json:"warnings"`
+	Duration float64                 `json:"duration"`
+}
+
+// pullFromHost saves the paths of h in a new snapshot.
+func pullFromHost(ctx context.Context, repo *repository.Repository, opts PullOptions, gopts GlobalOptions, h pullHost, selectFilter pipe.SelectFunc) (res pullResult) {
+	res = pullResult{Host: h.Host, Paths: h.Paths}
+
+	start := time.Now()
+	defer func() {
+		res.Duration = time.Since(start).Seconds()
+	}()
+
+	fail := func(err error) pullResult {
+		debug.Log("pull from %v failed: %v", h.Host, err)
+		if errors.IsFatal(errors.Cause(err)) {
+			// the message is meant for the user, drop the "Fatal" prefix
+			err = errors.Cause(err)
+		}
+		res.Error = err.Error()
+		return res
+	}
+
+	sfs, err := openRemoteSource(gopts, sftp.Config{User: h.User, Host: h.Host})
+	if err != nil {
+		return fail(err)
+	}
+	defer func() {
+		_ = sfs.Close()
+	}()
+
+	// the exclusion files are read from the host, so these filters are built
+	// for each host separately
+	for _, spec := range opts.ExcludeIfPresent {
+		reject, err := rejectIfPresent(sfs, spec)
+		if err != nil {
+			return fail(err)
+		}
+		filter := selectFilter
+		selectFilter = func(item string, fi os.FileInfo) bool {
+			return !reject(item, fi) && filter(item, fi)
+		}
+	}
+
+	var parentSnapshotID *restic.ID
+	if !opts.Force {
+		id, err := restic.FindLatestSnapshot(ctx, repo, h.Paths, []restic.TagList{}, h.Host)
+		if err == nil {
+			parentSnapshotID = &id
+			res.Parent = &id
+		} else if err != restic.ErrNoSnapshotFound {
+			return fail(err)
+		}
+	}
+
+	Verbosef("%v: reading %v\n", h.Host, strings.Join(h.Paths, ", "))
+
+	var warnings int
+	var m sync.Mutex
+
+	arch := archiver.New(repo)
+	arch.FS = sfs
+	arch.Excludes = opts.Excludes
+	arch.SelectFilter = selectFilter
+	arch.SaveCanary = opts.Canary
+	arch.Warn = func(dir string, fi os.FileInfo, err error) {
+		m.Lock()
+		warnings++
+		m.Unlock()
+		Warnf("%v: warning for %s: %v\n", h.Host, dir, err)
+	}
+	arch.Error = func(item string, fi os.FileInfo, err error) error {
+		m.Lock()
+		warnings++
+		m.Unlock()
+		Warnf("%v: error for %s: %v\n", h.Host, item, err)
+		return nil
+	}
+	arch.BeforeSave = func(ctx context.Context, sn *restic.Snapshot) error {
+		sn.Summary = summarizeSnapshot(ctx, repo, parentSnapshotID, sn)
+		return nil
+	}
+
+	tags := append([]string{pullTag}, opts.Tags...)
+	sn, id, err := arch.Snapshot(ctx, nil, h.Paths, tags, h.Host, parentSnapshotID, time.Now())
+	if err != nil {
+		return fail(err)
+	}
+
+	Verbosef("%v: snapshot %s saved\n", h.Host, id.Str())
+
+	res.Success = true
+	res.Snapshot = &id
+	res.Summary = sn.Summary
+	res.Warnings = warnings
+	return res
+}
+
+func runPull(opts PullOptions, gopts GlobalOptions, args []string) error {
+	if len(args) > 0 {
+		return errors.Fatal("the pull command does not take arguments, the hosts are read from the file given with --hosts")
+	}
+
+	if opts.HostsFile == "" {
+		return errors.Fatal("no hosts file specified, use --hosts")
+	}
+
+	if opts.Concurrency == 0 {
+		return errors.Fatal("--concurrency must be at least 1")
+	}
+
+	lines, err := readLinesFromFile(opts.HostsFile)
+	if err != nil {
+		return errors.Fatalf("unable to read the hosts file: %v", err)
+	}
+
+	hosts, err := parsePullHosts(lines)
+	if err != nil {
+		return err
+	}
+
+	if len(hosts) == 0 {
+		return errors.Fatalf("no hosts listed in %v", opts.HostsFile)
+	}
+
+	if len(opts.ExcludeFiles) > 0 {
+		opts.Excludes = append(opts.Excludes, readExcludePatternsFromFiles(opts.ExcludeFiles)...)
+	}
+
+	if opts.ExcludeCaches {
+		opts.ExcludeIfPresent = append(opts.ExcludeIfPresent, cacheDirTagSpec)
+	}
+
+	// check the exclusion files before connecting to the hosts
+	for _, spec := range opts.ExcludeIfPresent {
+		if _, err := rejectIfPresent(nil, spec); err != nil {
+			return err
+		}
+	}
+
+	selectFilter := func(item string, fi os.FileInfo) bool {
+		return true
+	}
+	if len(opts.Excludes) > 0 {
+		reject := rejectByPattern(opts.Excludes)
+		selectFilter = func(item string, fi os.FileInfo) bool {
+			return !reject(item, fi)
+		}
+	}
+
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	lock, err := lockRepo(repo)
+	defer unlockRepo(lock)
+	if err != nil {
+		return err
+	}
+
+	err = repo.LoadIndex(gopts.ctx)
+	if err != nil {
+		return err
+	}
+
+	results := make([]pullResult, len(hosts))
+	sem := make(chan struct{}, opts.Concurrency)
+
+	var wg sync.WaitGroup
+	for i, h := range hosts {
+		wg.Add(1)
+		go func(i int, h pullHost) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i] = pullFromHost(gopts.ctx, repo, opts, gopts, h, selectFilter)
+		}(i, h)
+	}
+	wg.Wait()
+
+	var failed int
+	for _, res := range results {
+		if !res.Success {
+			failed++
+		}
+	}
+
+	if gopts.JSON {
+		err = json.NewEncoder(gopts.stdout).Encode(results)
+		if err != nil {
+			return err
+		}
+	} else {
+		printPullReport(gopts.stdout, results)
+	}
+
+	recordRepositoryStats(gopts.ctx, repo, "pull")
+
+	if failed > 0 {
+		return errors.Fatalf("%d of %d hosts could not be saved", failed, len(results))
+	}
+
+	return nil
+}
+
+// printPullReport prints a text table with the results for all hosts.
+func printPullReport(stdout io.Writer, results []pullResult) {
+	tab := NewTable()
+	tab.Header = fmt.Sprintf("%-20s  %-6s  %-8s  %7s  %7s  %7s  %10s  %8s  %8s", "Host", "Status", "Snapshot", "New", "Changed", "Removed", "Added", "Warnings", "Duration")
+	tab.RowFormat = "%-20s  %-6s  %-8s  %7v  %7v  %7v  %10s  %8v  %8s"
+
+	var failed int
+	for _, res := range results {
+		duration := formatDuration(time.Duration(res.Duration * float64(time.Second)))
+
+		if !res.Success {
+			failed++
+			tab.Rows = append(tab.Rows, []interface{}{res.Host, "failed", "", "", "", "", "", "", duration})
+			continue
+		}
+
+		if res.Summary == nil {
+			tab.Rows = append(tab.Rows, []interface{}{res.Host, "ok", res.Snapshot.Str(), "", "", "", "", res.Warnings, duration})
+			continue
+		}
+
+		s := res.Summary
+		tab.Rows = append(tab.Rows, []interface{}{res.Host, "ok", res.Snapshot.Str(),
+			s.FilesNew, s.FilesChanged, s.FilesRemoved, formatBytes(s.DataAdded), res.Warnings, duration})
+	}
+
+	tab.Footer = fmt.Sprintf("%d hosts, %d failed", len(results), failed)
+	tab.Write(stdout)
+
+	for _, res := range results {
+		if !res.Success {
+			fmt.Fprintf(stdout, "%v: %v\n", res.Host, res.Error)
+		}
+	}
+}
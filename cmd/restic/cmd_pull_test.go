@@ -0,0 +1,43 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePullHosts(t *testing.T) {
+	hosts, err := parsePullHosts([]string{
+		"root@web1 /etc /var/www/",
+		"db1\t/var/backups",
+		"user@domain@files /srv",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []pullHost{
+		{User: "root", Host: "web1", Paths: []string{"/etc", "/var/www"}},
+		{Host: "db1", Paths: []string{"/var/backups"}},
+		{User: "user@domain", Host: "files", Paths: []string{"/srv"}},
+	}
+
+	if !reflect.DeepEqual(hosts, want) {
+		t.Fatalf("wrong hosts returned, want:\n  %v\ngot:\n  %v", want, hosts)
+	}
+}
+
+func TestParsePullHostsInvalid(t *testing.T) {
+	var tests = [][]string{
+		{"web1"},
+		{"root@ /etc"},
+		{"web1 etc"},
+		{"web1 /etc", "root@web1 /var"},
+	}
+
+	for _, lines := range tests {
+		_, err := parsePullHosts(lines)
+		if err == nil {
+			t.Errorf("no error returned for %q", lines)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+var cmdPurgeTrash = &cobra.Command{
+	Use:   "purge-trash [flags]",
+	Short: "Remove files from the trash",
+	Long: `
+The "purge-trash" command removes files which the "forget" and "prune" commands
+have moved to the trash. Only files which have been in the trash for longer
+than --older-than are removed, so there is time to notice and undo a mistake
+before the data is gone for good.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runPurgeTrash(purgeTrashOptions, globalOptions, args)
+	},
+}
+
+// PurgeTrashOptions collects all options for the purge-trash command.
+type PurgeTrashOptions struct {
+	OlderThan time.Duration
+	DryRun    bool
+}
+
+var purgeTrashOptions PurgeTrashOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdPurgeTrash)
+
+	f := cmdPurgeTrash.Flags()
+	f.DurationVar(&purgeTrashOptions.OlderThan, "older-than", 7*24*time.Hour, "only remove files which have been moved to the trash at least `duration` ago (0 removes all files)")
+	f.BoolVarP(&purgeTrashOptions.DryRun, "dry-run", "n", false, "do not remove anything, just print what would be done")
+}
+
+// trashCopyWarning makes sure that the warning about backends which cannot
+// rename files is only printed once.
+var trashCopyWarning sync.Once
+
+// removeFile removes the file h from the repository. Unless noTrash is set,
+// the file is moved to the trash instead, so it can be restored until the
+// trash is purged. Backends which cannot rename files only copy the file into
+// the trash when trashCopy is set, otherwise it is removed directly.
+func removeFile(ctx context.Context, repo restic.Repository, h restic.Handle, noTrash, trashCopy bool) error {
+	if noTrash {
+		return repo.Backend().Remove(ctx, h)
+	}
+
+	err := restic.MoveToTrash(ctx, repo.Backend(), h, trashCopy)
+	if errors.Cause(err) != restic.ErrRenameUnsupported {
+		return err
+	}
+
+	trashCopyWarning.Do(func() {
+		Warnf("the backend cannot rename files, removing them instead of moving them to the trash (pass --trash-copy to copy them)\n")
+	})
+	return repo.Backend().Remove(ctx, h)
+}
+
+func runPurgeTrash(opts PurgeTrashOptions, gopts GlobalOptions, args []string) error {
+	if len(args) > 0 {
+		return errors.Fatal("the purge-trash command expects no arguments")
+	}
+
+	if opts.OlderThan < 0 {
+		return errors.Fatal("--older-than must not be negative")
+	}
+
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		lock, err := lockRepoExclusive(repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx := gopts.ctx
+	list, err := restic.ListTrash(ctx, repo.Backend())
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-opts.OlderThan)
+
+	var (
+		count, kept int
+		size        int64
+	)
+	for _, e := range list {
+		if e.Deleted.After(cutoff) {
+			kept++
+			continue
+		}
+
+		if opts.DryRun {
+			Verbosef("would remove %v %v, deleted at %v\n", e.Handle.Type, e.Handle.Name, e.Deleted.Format(TimeFormat))
+		} else {
+			h := restic.Handle{Type: restic.TrashFile, Name: e.Name}
+			err = repo.Backend().Remove(ctx, h)
+			if err != nil {
+				Warnf("unable to remove %v from the trash: %v\n", e.Name, err)
+				continue
+			}
+		}
+
+		count++
+		size += e.Size
+	}
+
+	if opts.DryRun {
+		Verbosef("would remove %d files (%s) from the trash, %d files are kept\n", count, formatBytes(uint64(size)), kept)
+		return nil
+	}
+
+	Verbosef("removed %d files (%s) from the trash, %d files are kept\n", count, formatBytes(uint64(size)), kept)
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/index"
+	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 
 	"github.com/spf13/cobra"
@@ -44,7 +45,25 @@ func runRebuildIndex(gopts GlobalOptions) error {
 	return rebuildIndex(ctx, repo, restic.NewIDSet())
 }
 
-func rebuildIndex(ctx context.Context, repo restic.Repository, ignorePacks restic.IDSet) error {
+// saveReverseIndex removes all packs which are not contained in idx from the
+// reverse index of the repository and saves it in the cache.
+func saveReverseIndex(repo *repository.Repository, idx *index.Index) {
+	packs := restic.NewIDSet()
+	for id := range idx.Packs {
+		packs.Insert(id)
+	}
+	repo.ReverseIndex().Retain(packs)
+
+	err := repo.SaveReverseIndex()
+	if err != nil {
+		Warnf("unable to save the reverse index in the cache: %v\n", err)
+	}
+}
+
+// rebuildIndex reads the headers of all pack files except for ignorePacks and
+// replaces all index files with a new index. Pack headers which are contained
+// in the reverse index in the cache are not read again.
+func rebuildIndex(ctx context.Context, repo *repository.Repository, ignorePacks restic.IDSet) error {
 	Verbosef("counting files in repo\n")
 
 	var packs uint64
@@ -57,11 +76,13 @@ func rebuildIndex(ctx context.Context, repo restic.Repository, ignorePacks resti
 	}
 
 	bar := newProgressMax(!globalOptions.Quiet, packs-uint64(len(ignorePacks)), "packs")
-	idx, _, err := index.New(ctx, repo, ignorePacks, bar)
+	idx, _, err := index.New(ctx, repo.ReverseIndex().Lister(repo), ignorePacks, bar)
 	if err != nil {
 		return err
 	}
 
+	saveReverseIndex(repo, idx)
+
 	Verbosef("finding old index files\n")
 
 	var supersedes restic.IDs
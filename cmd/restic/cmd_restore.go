@@ -1,6 +1,11 @@
 package main
 
 import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/restic/restic/internal/backend/sftp"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/filter"
@@ -18,6 +23,31 @@ a directory.
 
 The special snapshot "latest" can be used to restore the latest snapshot in the
 repository.
+
+With --archive, the selected files are not written to a directory but to
+stdout as a tar or zip archive. Tar archives use the pax format and include
+ownership, extended attributes, symlinks and hard links. The items are
+written in a deterministic order with bounded memory, so the archive can be
+piped directly into "tar -x", e.g. on another host via ssh. "--target -" is a
+shorthand for "--archive tar".
+
+Instead of a local directory, the target can also be an archive file or a
+directory on another host via SFTP: "--target zip:/path/file.zip" and
+"--target tar:/path/file.tar" write an archive file, "--target
+sftp:user@host:/path" restores files, directories and symlinks to the
+directory on the server.
+
+When restoring snapshots from less-trusted sources, --harden makes sure that
+no symlink in the target directory is followed, so nothing is written outside
+of it. On Linux, --sandbox additionally resolves all paths with
+openat2(RESOLVE_BENEATH), which also guards against symlinks created by other
+processes while the restore is running.
+
+Restored files can be checked, e.g. by a virus scanner, before they are put
+into place: each file is written to a temporary file next to its target and
+passed to the program given with --scan-command, or to the scanner listening
+on the unix socket given with --scan-socket. Files which are not accepted are
+removed, or moved to the directory given with --quarantine-dir.
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -27,12 +57,20 @@ repository.
 
 // RestoreOptions collects all options for the restore command.
 type RestoreOptions struct {
-	Exclude []string
-	Include []string
-	Target  string
-	Host    string
-	Paths   []string
-	Tags    restic.TagLists
+	Exclude  []string
+	Include  []string
+	Target   string
+	Host     string
+	Paths    []string
+	Tags     restic.TagLists
+	Archive  string
+	Harden   bool
+	Sandbox  bool
+	Federate []string
+
+	ScanCommand   string
+	ScanSocket    string
+	QuarantineDir string
 }
 
 var restoreOptions RestoreOptions
@@ -43,11 +81,18 @@ func init() {
 	flags := cmdRestore.Flags()
 	flags.StringArrayVarP(&restoreOptions.Exclude, "exclude", "e", nil, "exclude a `pattern` (can be specified multiple times)")
 	flags.StringArrayVarP(&restoreOptions.Include, "include", "i", nil, "include a `pattern`, exclude everything else (can be specified multiple times)")
-	flags.StringVarP(&restoreOptions.Target, "target", "t", "", "directory to extract data to")
+	flags.StringVarP(&restoreOptions.Target, "target", "t", "", "directory to extract data to, or zip:file, tar:file or sftp:user@host:/dir")
+	flags.BoolVar(&restoreOptions.Harden, "harden", false, "do not follow symlinks below the target directory")
+	flags.BoolVar(&restoreOptions.Sandbox, "sandbox", false, "resolve all paths beneath the target directory with openat2 (Linux only, implies --harden)")
+	flags.StringVar(&restoreOptions.ScanCommand, "scan-command", "", "run `command` with the path of each restored file appended, before it is put into place (exit code 0: accept, 1: quarantine)")
+	flags.StringVar(&restoreOptions.ScanSocket, "scan-socket", "", "ask the scanner listening on the unix `socket` about each restored file before it is put into place")
+	flags.StringVar(&restoreOptions.QuarantineDir, "quarantine-dir", "", "move files rejected by the scanner to `directory` instead of removing them")
+	flags.StringVar(&restoreOptions.Archive, "archive", "", "write an archive in this `format` (tar or zip) to stdout instead of extracting the data to a directory")
 
 	flags.StringVarP(&restoreOptions.Host, "host", "H", "", `only consider snapshots for this host when the snapshot ID is "latest"`)
 	flags.Var(&restoreOptions.Tags, "tag", "only consider snapshots which include this `taglist` for snapshot ID \"latest\"")
 	flags.StringArrayVar(&restoreOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path` for snapshot ID \"latest\"")
+	flags.StringArrayVar(&restoreOptions.Federate, "federate", nil, "also read snapshots and data from the `repository`, e.g. an archived repository (can be specified multiple times)")
 }
 
 func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
@@ -60,8 +105,47 @@ func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
 		return errors.Fatalf("more than one snapshot ID specified: %v", args)
 	}
 
-	if opts.Target == "" {
+	if opts.Target == "-" && opts.Archive == "" {
+		opts.Target = ""
+		opts.Archive = string(restic.ArchiveTar)
+	}
+
+	switch {
+	case opts.Archive != "" && opts.Target != "":
+		return errors.Fatal("--archive and --target are mutually exclusive")
+	case opts.Archive != "":
+		format := restic.ArchiveFormat(opts.Archive)
+		if format != restic.ArchiveTar && format != restic.ArchiveZip {
+			return errors.Fatalf("invalid archive format %q, must be tar or zip", opts.Archive)
+		}
+		if stdoutIsTerminal() {
+			return errors.Fatal("refusing to write an archive to a terminal, please redirect stdout")
+		}
+	case opts.Target == "":
 		return errors.Fatal("please specify a directory to restore to (--target)")
+	case targetScheme(opts.Target) != "" && (opts.Harden || opts.Sandbox):
+		return errors.Fatal("--harden and --sandbox can only be used for a local target directory")
+	}
+
+	scan := opts.ScanCommand != "" || opts.ScanSocket != ""
+	switch {
+	case opts.ScanCommand != "" && opts.ScanSocket != "":
+		return errors.Fatal("--scan-command and --scan-socket are mutually exclusive")
+	case scan && (opts.Archive != "" || targetScheme(opts.Target) != ""):
+		return errors.Fatal("restored files can only be scanned for a local target directory")
+	case opts.QuarantineDir != "" && !scan:
+		return errors.Fatal("--quarantine-dir requires --scan-command or --scan-socket")
+	}
+
+	var scanFunc restic.ScanFunc
+	if opts.ScanCommand != "" {
+		f, err := scanCommand(opts.ScanCommand)
+		if err != nil {
+			return err
+		}
+		scanFunc = f
+	} else if opts.ScanSocket != "" {
+		scanFunc = scanSocket(opts.ScanSocket)
 	}
 
 	if len(opts.Exclude) > 0 && len(opts.Include) > 0 {
@@ -72,19 +156,29 @@ func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
 
 	debug.Log("restore %v to %v", snapshotIDString, opts.Target)
 
-	repo, err := OpenRepository(gopts)
+	mainRepo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	dataCache, err := useDataCache(mainRepo, gopts)
 	if err != nil {
 		return err
 	}
 
 	if !gopts.NoLock {
-		lock, err := lockRepo(repo)
+		lock, err := lockRepo(mainRepo)
 		defer unlockRepo(lock)
 		if err != nil {
 			return err
 		}
 	}
 
+	repo, err := openFederation(gopts, mainRepo, opts.Federate)
+	if err != nil {
+		return err
+	}
+
 	err = repo.LoadIndex(ctx)
 	if err != nil {
 		return err
@@ -109,6 +203,11 @@ func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
 		Exitf(2, "creating restorer failed: %v\n", err)
 	}
 
+	res.Harden = opts.Harden || opts.Sandbox
+	res.Sandbox = opts.Sandbox
+	res.Scan = scanFunc
+	res.QuarantineDir = opts.QuarantineDir
+
 	totalErrors := 0
 	res.Error = func(dir string, node *restic.Node, err error) error {
 		Warnf("ignoring error for %s: %s\n", dir, err)
@@ -150,11 +249,89 @@ func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
 		res.SelectFilter = selectIncludeFilter
 	}
 
+	if opts.Archive != "" {
+		// stdout is used for the archive, so messages are printed to stderr
+		err = res.RestoreToArchive(ctx, os.Stdout, restic.ArchiveFormat(opts.Archive))
+		if err == nil && totalErrors > 0 {
+			// the archive may be piped into another program, make sure the
+			// errors are not missed
+			return errors.Fatalf("There were %d errors", totalErrors)
+		}
+		return err
+	}
+
 	Verbosef("restoring %s to %s\n", res.Snapshot(), opts.Target)
 
-	err = res.RestoreTo(ctx, opts.Target)
+	if targetScheme(opts.Target) != "" {
+		err = restoreToTarget(ctx, res, repo, opts.Target, gopts)
+	} else {
+		err = res.RestoreTo(ctx, opts.Target)
+	}
+	if dataCache != nil {
+		hits, misses := dataCache.Stats()
+		Verbosef("data cache: %d packs downloaded, %d loads served from the cache\n", misses, hits)
+	}
 	if totalErrors > 0 {
 		Printf("There were %d errors\n", totalErrors)
 	}
 	return err
 }
+
+// targetScheme returns the scheme of a restore target which is not a local
+// directory, or an empty string otherwise.
+func targetScheme(target string) string {
+	for _, scheme := range []string{"zip", "tar", "sftp"} {
+		if strings.HasPrefix(target, scheme+":") {
+			return scheme
+		}
+	}
+	return ""
+}
+
+// restoreToTarget restores the snapshot to an archive file or a directory on
+// an sftp server.
+func restoreToTarget(ctx context.Context, res *restic.Restorer, repo restic.Repository, target string, gopts GlobalOptions) error {
+	scheme := targetScheme(target)
+	switch scheme {
+	case "zip", "tar":
+		filename := target[len(scheme)+1:]
+		f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return errors.Fatalf("unable to create archive: %v", err)
+		}
+
+		err = res.RestoreToArchive(ctx, f, restic.ArchiveFormat(scheme))
+		if err != nil {
+			_ = f.Close()
+			return err
+		}
+		return f.Close()
+
+	case "sftp":
+		c, err := sftp.ParseConfig(target)
+		if err != nil {
+			return errors.Fatalf("invalid target: %v", err)
+		}
+		cfg := c.(sftp.Config)
+
+		// the options for the sftp backend also apply to the target
+		err = gopts.extended.Extract("sftp").Apply("sftp", &cfg)
+		if err != nil {
+			return err
+		}
+
+		fs, err := sftp.OpenTargetFS(cfg)
+		if err != nil {
+			return err
+		}
+
+		err = res.RestoreToTarget(ctx, restic.NewFSTarget(repo, fs))
+		if err != nil {
+			_ = fs.Close()
+			return err
+		}
+		return fs.Close()
+	}
+
+	return errors.Fatalf("invalid target %q", target)
+}
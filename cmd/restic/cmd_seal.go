@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/location"
+	"github.com/restic/restic/internal/backend/s3"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+var cmdSeal = &cobra.Command{
+	Use:   "seal [flags]",
+	Short: "Mark the repository as read-only",
+	Long: `
+The "seal" command marks a repository as read-only, e.g. when it contains the
+finished archive of a project. The seal is recorded in the config of the
+repository together with a manifest, which lists the number, the total size
+and a hash of the snapshots, index and data files. Afterwards, restic refuses
+to modify the repository: backup, forget and prune fail, and no files other
+than locks, keys and the config can be saved or removed. "restic check"
+verifies that the files still match the manifest.
+
+Older versions of restic do not know about the seal. With --print-policy, a
+bucket policy for S3 is printed which denies modifying the files of the
+repository, so that the provider enforces the seal as well.
+
+A seal can be removed again with --unseal.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runSeal(sealOptions, globalOptions, args)
+	},
+}
+
+// SealOptions collects all options for the seal command.
+type SealOptions struct {
+	Unseal      bool
+	PrintPolicy bool
+}
+
+var sealOptions SealOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdSeal)
+
+	f := cmdSeal.Flags()
+	f.BoolVar(&sealOptions.Unseal, "unseal", false, "remove the seal from the repository")
+	f.BoolVar(&sealOptions.PrintPolicy, "print-policy", false, "only print a bucket policy which enforces the seal (S3 only)")
+}
+
+// checkNotSealed returns an error if the repository has been sealed, so that
+// commands which would modify it fail early.
+func checkNotSealed(repo restic.Repository) error {
+	seal := repo.Config().Seal
+	if seal == nil {
+		return nil
+	}
+
+	return errors.Fatalf("repository was sealed at %s and cannot be modified, remove the seal with \"restic seal --unseal\" first",
+		seal.Time.Format(TimeFormat))
+}
+
+// verifySeal compares the files in a sealed repository with the manifest
+// recorded in the seal.
+func verifySeal(gopts GlobalOptions, repo restic.Repository) error {
+	seal := repo.Config().Seal
+	if seal == nil {
+		return nil
+	}
+
+	Verbosef("verify seal from %s\n", seal.Time.Format(TimeFormat))
+	m, err := restic.NewSealManifest(gopts.ctx, repo.Backend())
+	if err != nil {
+		return err
+	}
+
+	var changed []string
+	if m.Snapshots != seal.Manifest.Snapshots {
+		changed = append(changed, "snapshots")
+	}
+	if m.Index != seal.Manifest.Index {
+		changed = append(changed, "index")
+	}
+	if m.Data != seal.Manifest.Data {
+		changed = append(changed, "data")
+	}
+
+	if len(changed) > 0 {
+		return errors.Errorf("the %s files in the repository do not match the manifest of the seal from %s",
+			strings.Join(changed, ", "), seal.Time.Format(TimeFormat))
+	}
+
+	return nil
+}
+
+func printSealManifest(m restic.SealManifest) {
+	for _, f := range []struct {
+		name  string
+		files restic.SealedFiles
+	}{
+		{"snapshots", m.Snapshots},
+		{"index", m.Index},
+		{"data", m.Data},
+	} {
+		Printf("  %-10s %6d files  %10s  %v\n", f.name, f.files.Count, formatBytes(f.files.Size), f.files.Hash)
+	}
+}
+
+// s3Policy is a bucket policy in the format of AWS S3.
+type s3Policy struct {
+	Version   string
+	Statement []s3PolicyStatement
+}
+
+type s3PolicyStatement struct {
+	Sid       string
+	Effect    string
+	Principal string
+	Action    []string
+	Resource  []string
+}
+
+// sealPolicy returns a bucket policy which denies saving and removing the
+// config, snapshots, index and data files of the repository in gopts.Repo.
+func sealPolicy(gopts GlobalOptions) (string, error) {
+	loc, err := location.Parse(gopts.Repo)
+	if err != nil {
+		return "", err
+	}
+
+	if loc.Scheme != "s3" {
+		return "", errors.Fatalf("policies are only available for the s3 backend, not for %v", loc.Scheme)
+	}
+
+	c, err := parseConfig(loc, gopts.extended)
+	if err != nil {
+		return "", err
+	}
+	cfg := c.(s3.Config)
+
+	var layout backend.Layout = &backend.DefaultLayout{Path: cfg.Prefix, Join: path.Join}
+	if cfg.Layout == "s3legacy" {
+		layout = &backend.S3LegacyLayout{Path: cfg.Prefix, Join: path.Join}
+	}
+
+	arn := "arn:aws:s3:::" + cfg.Bucket + "/"
+	resources := []string{arn + layout.Filename(restic.Handle{Type: restic.ConfigFile})}
+	for _, t := range []restic.FileType{restic.SnapshotFile, restic.IndexFile, restic.DataFile} {
+		resources = append(resources, arn+layout.Dirname(restic.Handle{Type: t})+"*")
+	}
+
+	policy := s3Policy{
+		Version: "2012-10-17",
+		Statement: []s3PolicyStatement{
+			{
+				Sid:       "DenyModifyingSealedResticRepository",
+				Effect:    "Deny",
+				Principal: "*",
+				Action:    []string{"s3:PutObject", "s3:DeleteObject", "s3:DeleteObjectVersion"},
+				Resource:  resources,
+			},
+		},
+	}
+
+	buf, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(buf), nil
+}
+
+func runSeal(opts SealOptions, gopts GlobalOptions, args []string) error {
+	if len(args) != 0 {
+		return errors.Fatal("seal has no arguments")
+	}
+
+	if opts.PrintPolicy {
+		if opts.Unseal {
+			return errors.Fatal("--print-policy and --unseal cannot be used together")
+		}
+
+		policy, err := sealPolicy(gopts)
+		if err != nil {
+			return err
+		}
+
+		Printf("%s\n", policy)
+		return nil
+	}
+
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	lock, err := lockRepoExclusive(repo)
+	defer unlockRepo(lock)
+	if err != nil {
+		return err
+	}
+
+	cfg := repo.Config()
+
+	if opts.Unseal {
+		if cfg.Seal == nil {
+			return errors.Fatal("repository is not sealed")
+		}
+
+		cfg.Seal = nil
+		if err = repo.SaveConfig(gopts.ctx, cfg); err != nil {
+			return err
+		}
+
+		Verbosef("removed the seal from repository %v\n", cfg.ID[:10])
+		return nil
+	}
+
+	if cfg.Seal != nil {
+		Printf("repository was sealed at %s by %s@%s:\n", cfg.Seal.Time.Format(TimeFormat), cfg.Seal.Username, cfg.Seal.Hostname)
+		printSealManifest(cfg.Seal.Manifest)
+		return errors.Fatal("repository is already sealed")
+	}
+
+	cfg.Seal, err = restic.NewSeal(gopts.ctx, repo.Backend())
+	if err != nil {
+		return err
+	}
+
+	if err = repo.SaveConfig(gopts.ctx, cfg); err != nil {
+		return err
+	}
+
+	Printf("sealed repository %v, manifest:\n", cfg.ID[:10])
+	printSealManifest(cfg.Seal.Manifest)
+	return nil
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/spf13/cobra"
+)
+
+var cmdStats = &cobra.Command{
+	Use:   "stats [snapshotID ...]",
+	Short: "Show the restore size of snapshots",
+	Long: `
+The "stats" command prints the size of the data and the number of files and
+directories a restore of each snapshot would yield.
+
+Snapshots never change, so the stats are stored in the local cache after they
+have been computed once. Subsequent calls for the same snapshots return the
+stats immediately instead of walking all trees again.
+
+With --by-path, the size of each top-level file and directory within the
+snapshots is shown, together with how much of the data is unique to it and how
+much is shared with other top-level entries after deduplication.
+
+After each backup and prune, the size of the repository, the number of blobs
+and the deduplication ratio are recorded in the repository. With --history,
+these records are shown together with the growth of the repository. If the
+size of the storage is passed with --capacity, the time when it will be full
+is estimated.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runStats(statsOptions, globalOptions, args)
+	},
+}
+
+// StatsOptions bundles all options for the stats command.
+type StatsOptions struct {
+	Host     string
+	Tags     restic.TagLists
+	Paths    []string
+	ByPath   bool
+	History  bool
+	Capacity string
+}
+
+var statsOptions StatsOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdStats)
+
+	f := cmdStats.Flags()
+	f.StringVarP(&statsOptions.Host, "host", "H", "", "only consider snapshots for this `host`")
+	f.Var(&statsOptions.Tags, "tag", "only consider snapshots which include this `taglist` (can be specified multiple times)")
+	f.StringArrayVar(&statsOptions.Paths, "path", nil, "only consider snapshots for this `path` (can be specified multiple times)")
+	f.BoolVar(&statsOptions.ByPath, "by-path", false, "show unique and shared sizes for each top-level entry of the snapshots")
+	f.BoolVar(&statsOptions.History, "history", false, "show the recorded size of the repository over time and forecast its growth")
+	f.StringVar(&statsOptions.Capacity, "capacity", "", "estimate when the repository reaches this `size` (e.g. 2T), used with --history")
+}
+
+// snapshotStats combines a snapshot with its stats.
+type snapshotStats struct {
+	*restic.Snapshot
+	restic.SnapshotStats
+
+	ID      *restic.ID `json:"id"`
+	ShortID string     `json:"short_id"`
+}
+
+// snapshotPathStats combines a snapshot with the stats of its top-level
+// entries.
+type snapshotPathStats struct {
+	*restic.Snapshot
+
+	ID      *restic.ID         `json:"id"`
+	ShortID string             `json:"short_id"`
+	Entries []restic.PathStats `json:"entries"`
+}
+
+func runStats(opts StatsOptions, gopts GlobalOptions, args []string) error {
+	if opts.Capacity != "" && !opts.History {
+		return errors.Fatal("--capacity can only be used together with --history")
+	}
+
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		lock, err := lockRepo(repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.History {
+		return runStatsHistory(gopts.ctx, opts, gopts, repo)
+	}
+
+	if err = repo.LoadIndex(gopts.ctx); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(gopts.ctx)
+	defer cancel()
+
+	if opts.ByPath {
+		return runStatsByPath(ctx, opts, gopts, repo, args)
+	}
+
+	var list []snapshotStats
+	valid := restic.NewIDSet()
+	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, args) {
+		id := sn.ID()
+		stats, err := restic.LoadSnapshotStats(ctx, repo, repo.Cache, *id, sn)
+		if err != nil {
+			return errors.Wrapf(err, "stats for snapshot %v", id.Str())
+		}
+
+		valid.Insert(*id)
+		list = append(list, snapshotStats{
+			Snapshot:      sn,
+			SnapshotStats: stats,
+			ID:            id,
+			ShortID:       id.Str(),
+		})
+	}
+
+	// remove the stats of snapshots which do not exist any more, this is only
+	// possible when all snapshots have been considered
+	unfiltered := len(args) == 0 && opts.Host == "" && len(opts.Tags) == 0 && len(opts.Paths) == 0
+	if repo.Cache != nil && unfiltered {
+		if err = repo.Cache.ClearStats(valid); err != nil {
+			Warnf("unable to clear stats in the cache: %v\n", err)
+		}
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Time.Before(list[j].Time)
+	})
+
+	if gopts.JSON {
+		return json.NewEncoder(gopts.stdout).Encode(list)
+	}
+
+	printStats(gopts.stdout, list)
+	return nil
+}
+
+// printStats prints a text table of the stats in list.
+func printStats(stdout io.Writer, list []snapshotStats) {
+	maxHost := 10
+	for _, s := range list {
+		if len(s.Hostname) > maxHost {
+			maxHost = len(s.Hostname)
+		}
+	}
+
+	tab := NewTable()
+	tab.Header = fmt.Sprintf("%-8s  %-19s  %-*s  %10s  %8s  %12s", "ID", "Date", -maxHost, "Host", "Files", "Dirs", "Size")
+	tab.RowFormat = fmt.Sprintf("%%-8s  %%-19s  %%%ds  %%10d  %%8d  %%12s", -maxHost)
+
+	var total restic.SnapshotStats
+	for _, s := range list {
+		tab.Rows = append(tab.Rows, []interface{}{s.ShortID, s.Time.Format(TimeFormat), s.Hostname,
+			s.TotalFileCount, s.TotalDirCount, formatBytes(s.TotalSize)})
+
+		total.TotalFileCount += s.TotalFileCount
+		total.TotalDirCount += s.TotalDirCount
+		total.TotalSize += s.TotalSize
+	}
+
+	tab.Footer = fmt.Sprintf("%d snapshots, %d files, %d dirs, %s in total",
+		len(list), total.TotalFileCount, total.TotalDirCount, formatBytes(total.TotalSize))
+
+	tab.Write(stdout)
+}
+
+func runStatsByPath(ctx context.Context, opts StatsOptions, gopts GlobalOptions, repo *repository.Repository, args []string) error {
+	var list []snapshotPathStats
+	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, args) {
+		id := sn.ID()
+		stats, err := restic.ComputePathStats(ctx, repo, *sn.Tree)
+		if err != nil {
+			return errors.Wrapf(err, "stats for snapshot %v", id.Str())
+		}
+
+		list = append(list, snapshotPathStats{
+			Snapshot: sn,
+			ID:       id,
+			ShortID:  id.Str(),
+			Entries:  stats,
+		})
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Time.Before(list[j].Time)
+	})
+
+	if gopts.JSON {
+		return json.NewEncoder(gopts.stdout).Encode(list)
+	}
+
+	for i, s := range list {
+		if i > 0 {
+			fmt.Fprintln(gopts.stdout)
+		}
+
+		fmt.Fprintf(gopts.stdout, "snapshot %s of %v at %s:\n", s.ShortID, s.Paths, s.Time.Format(TimeFormat))
+		printPathStats(gopts.stdout, s.Entries)
+	}
+
+	return nil
+}
+
+// printPathStats prints a text table of the stats in list, largest unique
+// size first.
+func printPathStats(stdout io.Writer, list []restic.PathStats) {
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].UniqueSize > list[j].UniqueSize
+	})
+
+	tab := NewTable()
+	tab.Header = fmt.Sprintf("%12s  %12s  %12s  %s", "Size", "Unique", "Shared", "Path")
+	tab.RowFormat = "%12s  %12s  %12s  %s"
+
+	var total uint64
+	for _, s := range list {
+		tab.Rows = append(tab.Rows, []interface{}{formatBytes(s.TotalSize),
+			formatBytes(s.UniqueSize), formatBytes(s.SharedSize), s.Path})
+		total += s.TotalSize
+	}
+
+	// shared data is contained in several entries, so only the total size
+	// can be summed up
+	tab.Footer = fmt.Sprintf("%d entries, %s in total", len(list), formatBytes(total))
+
+	tab.Write(stdout)
+}
+
+// statsHistory is printed by "stats --history --json".
+type statsHistory struct {
+	History  []restic.RepositoryStats `json:"history"`
+	Forecast *growthForecast          `json:"forecast,omitempty"`
+}
+
+func runStatsHistory(ctx context.Context, opts StatsOptions, gopts GlobalOptions, repo *repository.Repository) error {
+	var capacity uint64
+	if opts.Capacity != "" {
+		var err error
+		capacity, err = parseSize(opts.Capacity)
+		if err != nil {
+			return err
+		}
+	}
+
+	history, err := restic.LoadRepositoryStats(ctx, repo)
+	if err != nil {
+		return err
+	}
+
+	var forecast *growthForecast
+	if f, ok := forecastGrowth(history, capacity); ok {
+		forecast = &f
+	}
+
+	if gopts.JSON {
+		return json.NewEncoder(gopts.stdout).Encode(statsHistory{History: history, Forecast: forecast})
+	}
+
+	if len(history) == 0 {
+		Printf("no statistics have been recorded yet, they are saved after each backup and prune\n")
+		return nil
+	}
+
+	tab := NewTable()
+	tab.Header = fmt.Sprintf("%-19s  %-7s  %12s  %8s  %10s  %9s  %6s", "Date", "Command", "Size", "Packs", "Blobs", "Snapshots", "Dedup")
+	tab.RowFormat = "%-19s  %-7s  %12s  %8d  %10d  %9d  %6s"
+	for _, s := range history {
+		dedup := ""
+		if s.DedupRatio > 0 {
+			dedup = fmt.Sprintf("%.2fx", s.DedupRatio)
+		}
+
+		tab.Rows = append(tab.Rows, []interface{}{s.Time.Format(TimeFormat), s.Command,
+			formatBytes(s.TotalSize), s.PackCount, s.DataBlobs + s.TreeBlobs, s.SnapshotCount, dedup})
+	}
+	tab.Footer = fmt.Sprintf("%d records", len(history))
+	tab.Write(gopts.stdout)
+
+	if forecast == nil {
+		Printf("\nat least two records are needed to forecast the growth\n")
+		return nil
+	}
+
+	Printf("\n")
+	if forecast.BytesPerDay < 0 {
+		Printf("the repository shrinks by %s per day (%d records of the last %d days)\n",
+			formatBytes(uint64(-forecast.BytesPerDay)), forecast.Records, int(forecastWindow.Hours()/24))
+		return nil
+	}
+
+	Printf("the repository grows by %s per day (%d records of the last %d days)\n",
+		formatBytes(uint64(forecast.BytesPerDay)), forecast.Records, int(forecastWindow.Hours()/24))
+
+	if forecast.Full != nil {
+		Printf("the capacity of %s will be reached around %s\n", formatBytes(capacity), forecast.Full.Format("2006-01-02"))
+	}
+
+	return nil
+}
+
+// recordRepositoryStats saves the current stats of the repository, which are
+// shown by "stats --history". Errors are only printed as warnings, the index
+// must be loaded.
+func recordRepositoryStats(ctx context.Context, repo *repository.Repository, command string) {
+	stats, err := restic.ComputeRepositoryStats(ctx, repo, repo.Cache, command)
+	if err != nil {
+		Warnf("unable to compute the repository statistics: %v\n", err)
+		return
+	}
+
+	_, err = restic.SaveRepositoryStats(ctx, repo, stats)
+	if err != nil {
+		Warnf("unable to save the repository statistics: %v\n", err)
+	}
+}
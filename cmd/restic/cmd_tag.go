@@ -53,6 +53,36 @@ func init() {
 	tagFlags.StringArrayVar(&tagOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path`, when no snapshot-ID is given")
 }
 
+// replaceSnapshot saves the modified snapshot sn and removes the old one. The
+// ID of the original snapshot is retained over all changes.
+func replaceSnapshot(ctx context.Context, repo *repository.Repository, sn *restic.Snapshot) error {
+	// Retain the original snapshot id over all changes.
+	if sn.Original == nil {
+		sn.Original = sn.ID()
+	}
+
+	// Save the new snapshot.
+	id, err := repo.SaveJSONUnpacked(ctx, restic.SnapshotFile, sn)
+	if err != nil {
+		return err
+	}
+
+	debug.Log("new snapshot saved as %v", id)
+
+	if err = repo.Flush(ctx); err != nil {
+		return err
+	}
+
+	// Remove the old snapshot.
+	h := restic.Handle{Type: restic.SnapshotFile, Name: sn.ID().String()}
+	if err = repo.Backend().Remove(ctx, h); err != nil {
+		return err
+	}
+
+	debug.Log("old snapshot %v removed", sn.ID())
+	return nil
+}
+
 func changeTags(ctx context.Context, repo *repository.Repository, sn *restic.Snapshot, setTags, addTags, removeTags []string) (bool, error) {
 	var changed bool
 
@@ -71,30 +101,9 @@ func changeTags(ctx context.Context, repo *repository.Repository, sn *restic.Sna
 	}
 
 	if changed {
-		// Retain the original snapshot id over all tag changes.
-		if sn.Original == nil {
-			sn.Original = sn.ID()
-		}
-
-		// Save the new snapshot.
-		id, err := repo.SaveJSONUnpacked(ctx, restic.SnapshotFile, sn)
-		if err != nil {
+		if err := replaceSnapshot(ctx, repo, sn); err != nil {
 			return false, err
 		}
-
-		debug.Log("new snapshot saved as %v", id)
-
-		if err = repo.Flush(ctx); err != nil {
-			return false, err
-		}
-
-		// Remove the old snapshot.
-		h := restic.Handle{Type: restic.SnapshotFile, Name: sn.ID().String()}
-		if err = repo.Backend().Remove(ctx, h); err != nil {
-			return false, err
-		}
-
-		debug.Log("old snapshot %v removed", sn.ID())
 	}
 	return changed, nil
 }
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+var cmdUndelete = &cobra.Command{
+	Use:   "undelete [flags] [snapshotID ...]",
+	Short: "Restore removed snapshots from the trash",
+	Long: `
+The "undelete" command moves snapshots which have been removed by "forget"
+back from the trash into the repository. Either pass the IDs of the snapshots,
+or use --within to restore all snapshots removed within the given duration.
+
+The pack files which "prune" moved to the trash after the first of these
+snapshots was removed are restored as well, and the index is rebuilt, so that
+the data referenced by the snapshots is available again. Snapshots and pack
+files which have already been removed by "purge-trash" cannot be restored.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runUndelete(undeleteOptions, globalOptions, args)
+	},
+}
+
+// UndeleteOptions collects all options for the undelete command.
+type UndeleteOptions struct {
+	Within time.Duration
+	DryRun bool
+}
+
+var undeleteOptions UndeleteOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdUndelete)
+
+	f := cmdUndelete.Flags()
+	f.DurationVar(&undeleteOptions.Within, "within", 0, "restore all snapshots removed within `duration` (e.g. 24h)")
+	f.BoolVarP(&undeleteOptions.DryRun, "dry-run", "n", false, "do not modify the repository, just print what would be done")
+}
+
+// selectTrashedSnapshots returns the snapshots in the trash which match one
+// of the IDs, or which have been removed after since when no ID is given.
+func selectTrashedSnapshots(list []restic.TrashEntry, ids []string, since time.Time) ([]restic.TrashEntry, error) {
+	var selected []restic.TrashEntry
+
+	if len(ids) == 0 {
+		for _, e := range list {
+			if e.Handle.Type == restic.SnapshotFile && !e.Deleted.Before(since) {
+				selected = append(selected, e)
+			}
+		}
+		return selected, nil
+	}
+
+	for _, id := range ids {
+		var match *restic.TrashEntry
+		for i, e := range list {
+			if e.Handle.Type != restic.SnapshotFile || !strings.HasPrefix(e.Handle.Name, id) {
+				continue
+			}
+
+			if match != nil && match.Handle.Name != e.Handle.Name {
+				return nil, errors.Fatalf("snapshot ID %q is ambiguous", id)
+			}
+			match = &list[i]
+		}
+
+		if match == nil {
+			return nil, errors.Fatalf("snapshot %q not found in the trash", id)
+		}
+		selected = append(selected, *match)
+	}
+
+	return selected, nil
+}
+
+// shortName returns the first eight characters of name, like ID.Str.
+func shortName(name string) string {
+	if len(name) > 8 {
+		return name[:8]
+	}
+	return name
+}
+
+func runUndelete(opts UndeleteOptions, gopts GlobalOptions, args []string) error {
+	if len(args) == 0 && opts.Within <= 0 {
+		return errors.Fatal("please specify snapshot IDs or --within")
+	}
+	if len(args) > 0 && opts.Within > 0 {
+		return errors.Fatal("snapshot IDs and --within are mutually exclusive")
+	}
+
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	lock, err := lockRepoExclusive(repo)
+	defer unlockRepo(lock)
+	if err != nil {
+		return err
+	}
+
+	ctx := gopts.ctx
+	list, err := restic.ListTrash(ctx, repo.Backend())
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := selectTrashedSnapshots(list, args, time.Now().Add(-opts.Within))
+	if err != nil {
+		return err
+	}
+
+	if len(snapshots) == 0 {
+		Verbosef("no snapshots found in the trash\n")
+		return nil
+	}
+
+	// the data of the snapshots may have been removed by any prune which
+	// ran after the first snapshot was removed
+	first := snapshots[0].Deleted
+	for _, e := range snapshots {
+		if e.Deleted.Before(first) {
+			first = e.Deleted
+		}
+	}
+
+	var packs []restic.TrashEntry
+	for _, e := range list {
+		if e.Handle.Type == restic.DataFile && !e.Deleted.Before(first) {
+			packs = append(packs, e)
+		}
+	}
+
+	if opts.DryRun {
+		for _, e := range snapshots {
+			Verbosef("would restore snapshot %v, removed at %v\n", shortName(e.Handle.Name), e.Deleted.Format(TimeFormat))
+		}
+		Verbosef("would restore %d snapshots and %d pack files\n", len(snapshots), len(packs))
+		return nil
+	}
+
+	// restore the packs first, so that the snapshots never reference missing
+	// data
+	for _, e := range packs {
+		err = restic.RestoreFromTrash(ctx, repo.Backend(), e)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(packs) > 0 {
+		err = rebuildIndex(ctx, repo, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, e := range snapshots {
+		err = restic.RestoreFromTrash(ctx, repo.Backend(), e)
+		if err != nil {
+			return err
+		}
+		Verbosef("restored snapshot %v\n", shortName(e.Handle.Name))
+	}
+
+	Verbosef("restored %d snapshots and %d pack files\n", len(snapshots), len(packs))
+	return nil
+}
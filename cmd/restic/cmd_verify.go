@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/restic/chunker"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdVerify = &cobra.Command{
+	Use:   "verify [flags] snapshotID file",
+	Short: "Compare a file on disk with its backed-up version",
+	Long: `
+The "verify" command checks whether a file on disk is identical to the version
+stored in a snapshot. The file is split into blobs with the chunker parameters
+of the repository and the IDs of the blobs are compared to the ones recorded
+for the file in the snapshot, so no data needs to be downloaded. The command
+also checks that all blobs of the backed-up version are contained in the
+repository index.
+
+The file is looked up below the directories which were saved in the snapshot,
+e.g. /home/user/work/report.txt in a snapshot of /home/user. The special
+snapshot "latest" can be used to use the latest snapshot in the repository.
+
+The exit code is 0 if the file is identical and 1 if it differs.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runVerify(verifyOptions, globalOptions, args)
+	},
+}
+
+// VerifyOptions collects all options for the verify command.
+type VerifyOptions struct {
+	Host  string
+	Paths []string
+	Tags  restic.TagLists
+}
+
+var verifyOptions VerifyOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdVerify)
+
+	flags := cmdVerify.Flags()
+	flags.StringVarP(&verifyOptions.Host, "host", "H", "", `only consider snapshots for this host when the snapshot ID is "latest"`)
+	flags.Var(&verifyOptions.Tags, "tag", "only consider snapshots which include this `taglist` for snapshot ID \"latest\"")
+	flags.StringArrayVar(&verifyOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path` for snapshot ID \"latest\"")
+}
+
+// snapshotPath returns the path of the file filename within sn, relative to
+// the root tree of the snapshot.
+func snapshotPath(sn *restic.Snapshot, filename string) (string, error) {
+	for _, p := range sn.Paths {
+		p = filepath.Clean(p)
+		if filename == p {
+			return filepath.Base(p), nil
+		}
+
+		prefix := p
+		if !strings.HasSuffix(prefix, string(filepath.Separator)) {
+			prefix += string(filepath.Separator)
+		}
+		if strings.HasPrefix(filename, prefix) {
+			return filepath.Join(filepath.Base(p), filename[len(prefix):]), nil
+		}
+	}
+
+	return "", errors.Fatalf("%v is not contained in the paths %v of snapshot %v", filename, sn.Paths, sn.ID().Str())
+}
+
+// findNode returns the node at the path described by pathComponents.
+func findNode(ctx context.Context, repo restic.Repository, tree *restic.Tree, prefix string, pathComponents []string) (*restic.Node, error) {
+	item := filepath.Join(prefix, pathComponents[0])
+	for _, node := range tree.Nodes {
+		if node.Name != pathComponents[0] {
+			continue
+		}
+
+		if len(pathComponents) == 1 {
+			return node, nil
+		}
+
+		if node.Type != "dir" {
+			return nil, errors.Fatalf("%q should be a dir, but is a %q", item, node.Type)
+		}
+
+		subtree, err := repo.LoadTree(ctx, *node.Subtree)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot load subtree for %q", item)
+		}
+		return findNode(ctx, repo, subtree, item, pathComponents[1:])
+	}
+
+	return nil, errors.Fatalf("path %q not found in snapshot", item)
+}
+
+// byteRange is a part of a file.
+type byteRange struct {
+	start, length uint64
+}
+
+// fileComparison is the result of splitting a file into blobs and comparing
+// them to the content of a node.
+type fileComparison struct {
+	size uint64
+
+	// changed contains the parts of the file whose blobs are not part of the
+	// backed-up version, adjacent blobs are merged
+	changed []byteRange
+
+	// identical is true if the file consists of exactly the same blobs
+	identical bool
+
+	// missing is the number of blobs of the backed-up version which do not
+	// occur in the file
+	missing int
+}
+
+// compareContent splits rd into blobs with the polynomial pol and compares the
+// blob IDs to content.
+func compareContent(rd io.Reader, pol chunker.Pol, content restic.IDs) (fileComparison, error) {
+	var res fileComparison
+
+	stored := restic.NewIDSet(content...)
+	seen := restic.NewIDSet()
+	var ids restic.IDs
+
+	chnker := chunker.New(rd, pol)
+	buf := make([]byte, chunker.MinSize)
+	for {
+		chunk, err := chnker.Next(buf)
+		if errors.Cause(err) == io.EOF {
+			break
+		}
+		if err != nil {
+			return res, errors.Wrap(err, "chunker.Next")
+		}
+		buf = chunk.Data
+
+		id := restic.Hash(chunk.Data)
+		ids = append(ids, id)
+		seen.Insert(id)
+		res.size += uint64(chunk.Length)
+
+		if stored.Has(id) {
+			continue
+		}
+
+		n := len(res.changed)
+		if n > 0 && res.changed[n-1].start+res.changed[n-1].length == uint64(chunk.Start) {
+			res.changed[n-1].length += uint64(chunk.Length)
+			continue
+		}
+		res.changed = append(res.changed, byteRange{start: uint64(chunk.Start), length: uint64(chunk.Length)})
+	}
+
+	res.identical = len(ids) == len(content)
+	for i := 0; res.identical && i < len(ids); i++ {
+		res.identical = ids[i] == content[i]
+	}
+
+	for id := range stored {
+		if !seen.Has(id) {
+			res.missing++
+		}
+	}
+
+	return res, nil
+}
+
+func runVerify(opts VerifyOptions, gopts GlobalOptions, args []string) error {
+	ctx := gopts.ctx
+
+	if len(args) != 2 {
+		return errors.Fatal("no file and no snapshot ID specified")
+	}
+
+	snapshotIDString := args[0]
+	filename, err := filepath.Abs(args[1])
+	if err != nil {
+		return errors.Wrap(err, "Abs")
+	}
+
+	debug.Log("verify file %q against %q", filename, snapshotIDString)
+
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		lock, err := lockRepo(repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = repo.LoadIndex(ctx)
+	if err != nil {
+		return err
+	}
+
+	var id restic.ID
+	if snapshotIDString == "latest" {
+		id, err = restic.FindLatestSnapshot(ctx, repo, opts.Paths, opts.Tags, opts.Host)
+		if err != nil {
+			return errors.Fatalf("latest snapshot for criteria not found: %v Paths:%v Host:%v", err, opts.Paths, opts.Host)
+		}
+	} else {
+		id, err = restic.FindSnapshot(repo, snapshotIDString)
+		if err != nil {
+			return errors.Fatalf("invalid id %q: %v", snapshotIDString, err)
+		}
+	}
+
+	sn, err := restic.LoadSnapshot(ctx, repo, id)
+	if err != nil {
+		return err
+	}
+
+	item, err := snapshotPath(sn, filename)
+	if err != nil {
+		return err
+	}
+	snPath := "/" + filepath.ToSlash(item)
+
+	tree, err := repo.LoadTree(ctx, *sn.Tree)
+	if err != nil {
+		return err
+	}
+
+	node, err := findNode(ctx, repo, tree, "/", splitPath(item))
+	if err != nil {
+		return err
+	}
+
+	if node.Type != "file" {
+		return errors.Fatalf("%q is a %v, only files can be verified", snPath, node.Type)
+	}
+
+	for _, blob := range node.Content {
+		if !repo.Index().Has(blob, restic.DataBlob) {
+			return errors.Fatalf("blob %v of %q in snapshot %v is not contained in the repository, run 'restic check'",
+				blob.Str(), snPath, sn.ID().Str())
+		}
+	}
+
+	f, err := fs.OpenNoAtime(filename)
+	if err != nil {
+		return errors.Fatalf("unable to open %v: %v", filename, err)
+	}
+	defer f.Close()
+
+	if node.Inline != nil {
+		// the content is stored in the tree, compare it directly
+		data, err := ioutil.ReadAll(io.LimitReader(f, int64(len(node.Inline))+1))
+		if err != nil {
+			return errors.Fatalf("unable to read %v: %v", filename, err)
+		}
+
+		if !bytes.Equal(data, node.Inline) {
+			Printf("%v differs from %q in snapshot %v\n", filename, snPath, sn.ID().Str())
+			return errors.Fatal("the file differs from the backed-up version")
+		}
+
+		Printf("%v is identical to %q in snapshot %v (stored inline)\n", filename, snPath, sn.ID().Str())
+		return nil
+	}
+
+	res, err := compareContent(f, repo.Config().ChunkerPolynomial, node.Content)
+	if err != nil {
+		return errors.Fatalf("unable to read %v: %v", filename, err)
+	}
+
+	if res.identical {
+		Printf("%v is identical to %q in snapshot %v (%d blobs)\n", filename, snPath, sn.ID().Str(), len(node.Content))
+		return nil
+	}
+
+	printComparison(gopts.stdout, filename, snPath, sn, node, res)
+	return errors.Fatal("the file differs from the backed-up version")
+}
+
+func printComparison(w io.Writer, filename, item string, sn *restic.Snapshot, node *restic.Node, res fileComparison) {
+	fmt.Fprintf(w, "%v differs from %q in snapshot %v:\n", filename, item, sn.ID().Str())
+	if res.size != node.Size {
+		fmt.Fprintf(w, "  size on disk %d bytes, in the snapshot %d bytes\n", res.size, node.Size)
+	}
+
+	for _, r := range res.changed {
+		fmt.Fprintf(w, "  changed: bytes %d-%d (%v)\n", r.start, r.start+r.length-1, formatBytes(r.length))
+	}
+
+	if len(res.changed) == 0 {
+		fmt.Fprintf(w, "  all blobs are part of the backed-up version, but their order differs\n")
+	}
+
+	if res.missing > 0 {
+		fmt.Fprintf(w, "  %d of %d blobs of the backed-up version do not occur in the file on disk\n", res.missing, len(restic.NewIDSet(node.Content...)))
+	}
+}
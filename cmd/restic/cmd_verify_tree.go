@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/spf13/cobra"
+)
+
+var cmdVerifyTree = &cobra.Command{
+	Use:   "verify-tree [flags] [snapshotID ...]",
+	Short: "Recompute the trees of snapshots from their nodes",
+	Long: `
+The "verify-tree" command decodes all trees of the given snapshots, encodes
+the nodes again as this version of restic would save them and recomputes the
+tree IDs bottom-up, independently of the stored data. A tree is reported when
+its recomputed form differs from the stored one, for example because it
+contains fields this version does not know and would drop, because the
+encoding or the metadata digest of a node changed between restic versions or
+architectures, or because the nodes are not sorted.
+
+For each snapshot, the recomputed ID of the root tree is printed. It matches
+the stored ID if all trees are canonical, and can be compared between
+machines and restic versions. Without a snapshot ID, all snapshots are
+verified.
+
+The exit code is 0 if all trees match and 1 otherwise.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runVerifyTree(verifyTreeOptions, globalOptions, args)
+	},
+}
+
+// VerifyTreeOptions collects all options for the verify-tree command.
+type VerifyTreeOptions struct {
+	Host  string
+	Tags  restic.TagLists
+	Paths []string
+}
+
+var verifyTreeOptions VerifyTreeOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdVerifyTree)
+
+	f := cmdVerifyTree.Flags()
+	f.StringVarP(&verifyTreeOptions.Host, "host", "H", "", "only consider snapshots for this `host`")
+	f.Var(&verifyTreeOptions.Tags, "tag", "only consider snapshots which include this `taglist` (can be specified multiple times)")
+	f.StringArrayVar(&verifyTreeOptions.Paths, "path", nil, "only consider snapshots for this `path` (can be specified multiple times)")
+}
+
+// verifiedSnapshot is the result of recomputing the trees of a snapshot.
+type verifiedSnapshot struct {
+	ID         restic.ID      `json:"id"`
+	Tree       restic.ID      `json:"tree"`
+	Recomputed restic.ID      `json:"recomputed_tree"`
+	Mismatches []treeMismatch `json:"mismatches,omitempty"`
+}
+
+// treeMismatch is used to print a restic.TreeMismatch as JSON.
+type treeMismatch struct {
+	ID         restic.ID `json:"id"`
+	Recomputed restic.ID `json:"recomputed"`
+	Reason     string    `json:"reason"`
+}
+
+// verifySnapshotTrees recomputes the trees of sn with v. Trees which have
+// already been verified for another snapshot are not reported again.
+func verifySnapshotTrees(ctx context.Context, v *restic.TreeVerifier, sn *restic.Snapshot) (verifiedSnapshot, error) {
+	res := verifiedSnapshot{ID: *sn.ID(), Tree: *sn.Tree}
+
+	known := len(v.Mismatches)
+	recomputed, err := v.Verify(ctx, *sn.Tree)
+	if err != nil {
+		return res, err
+	}
+	res.Recomputed = recomputed
+
+	for _, m := range v.Mismatches[known:] {
+		res.Mismatches = append(res.Mismatches, treeMismatch{ID: m.ID, Recomputed: m.Computed, Reason: m.Reason})
+	}
+
+	return res, nil
+}
+
+// printVerifiedSnapshot prints the result for a snapshot as text.
+func printVerifiedSnapshot(w io.Writer, res verifiedSnapshot) {
+	if res.Tree.Equal(res.Recomputed) {
+		fmt.Fprintf(w, "snapshot %v: tree %v\n", res.ID.Str(), res.Tree.Str())
+	} else {
+		fmt.Fprintf(w, "snapshot %v: tree %v, recomputed as %v\n", res.ID.Str(), res.Tree.Str(), res.Recomputed.Str())
+	}
+
+	for _, m := range res.Mismatches {
+		fmt.Fprintf(w, "  tree %v (recomputed as %v): %v\n", m.ID.Str(), m.Recomputed.Str(), m.Reason)
+	}
+}
+
+func runVerifyTree(opts VerifyTreeOptions, gopts GlobalOptions, args []string) error {
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		lock, err := lockRepo(repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(gopts.ctx)
+	defer cancel()
+
+	err = repo.LoadIndex(ctx)
+	if err != nil {
+		return err
+	}
+
+	v := restic.NewTreeVerifier(repo)
+	results := []verifiedSnapshot{}
+	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, args) {
+		res, err := verifySnapshotTrees(ctx, v, sn)
+		if err != nil {
+			return errors.Fatalf("unable to verify snapshot %v: %v", sn.ID().Str(), err)
+		}
+
+		if !gopts.JSON {
+			printVerifiedSnapshot(gopts.stdout, res)
+		}
+		results = append(results, res)
+	}
+
+	if gopts.JSON {
+		err = json.NewEncoder(gopts.stdout).Encode(results)
+		if err != nil {
+			return err
+		}
+	} else {
+		Verbosef("verified %d trees of %d snapshots, %d differences found\n", v.Verified(), len(results), len(v.Mismatches))
+	}
+
+	if len(v.Mismatches) > 0 {
+		return errors.Fatal("some trees differ from the form this version of restic saves")
+	}
+
+	return nil
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+var cmdWeb = &cobra.Command{
+	Use:   "web [flags] [snapshotID ...]",
+	Short: "Browse snapshots in a web browser",
+	Long: `
+The "web" command serves a web interface on localhost which lists the
+snapshots, shows the files and directories in them and offers the files for
+download. With --allow-restore, snapshots and directories can also be restored
+to a directory on this computer.
+
+Every request needs to carry the access token, which is printed together with
+the address when the command starts. It is generated randomly unless given
+with --token. The repository is not modified.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runWeb(webOptions, globalOptions, args)
+	},
+}
+
+// WebOptions collects all options for the web command.
+type WebOptions struct {
+	Listen       string
+	Token        string
+	AllowRestore bool
+	Host         string
+	Tags         restic.TagLists
+	Paths        []string
+}
+
+var webOptions WebOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdWeb)
+
+	flags := cmdWeb.Flags()
+	flags.StringVar(&webOptions.Listen, "listen", "localhost:8087", "serve the web interface on `address`, which must be a loopback address")
+	flags.StringVar(&webOptions.Token, "token", "", "use `token` to authenticate requests (default: generate a random token)")
+	flags.BoolVar(&webOptions.AllowRestore, "allow-restore", false, "allow restoring snapshots and directories to local directories")
+	flags.StringVarP(&webOptions.Host, "host", "H", "", "only consider snapshots for this `host`")
+	flags.Var(&webOptions.Tags, "tag", "only consider snapshots which include this `taglist`")
+	flags.StringArrayVar(&webOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path`")
+}
+
+// webTokenCookie is the name of the cookie which stores the token after the
+// first request.
+const webTokenCookie = "restic-token"
+
+// checkLoopback returns an error if addr is not a loopback address.
+func checkLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return errors.Fatalf("invalid address %q: %v", addr, err)
+	}
+
+	if host == "localhost" {
+		return nil
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsLoopback() {
+		return errors.Fatalf("the web interface can only be served on a loopback address, not on %q", host)
+	}
+
+	return nil
+}
+
+func runWeb(opts WebOptions, gopts GlobalOptions, args []string) error {
+	if err := checkLoopback(opts.Listen); err != nil {
+		return err
+	}
+
+	token := opts.Token
+	if token == "" {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			return errors.Wrap(err, "rand.Read")
+		}
+		token = hex.EncodeToString(buf)
+	}
+
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		lock, err := lockRepo(repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = repo.LoadIndex(gopts.ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(gopts.ctx)
+	defer cancel()
+
+	var snapshots restic.Snapshots
+	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, args) {
+		snapshots = append(snapshots, sn)
+	}
+
+	// show the most recent snapshots first
+	sort.Sort(snapshots)
+
+	ln, err := net.Listen("tcp", opts.Listen)
+	if err != nil {
+		return errors.Fatalf("unable to listen on %v: %v", opts.Listen, err)
+	}
+
+	srv := &http.Server{Handler: newWebServer(ctx, repo, snapshots, token, opts.AllowRestore)}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+
+	Printf("serving %d snapshots at http://%v/?token=%v\n", len(snapshots), ln.Addr(), token)
+
+	err = srv.Serve(ln)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// webServer serves the web interface.
+type webServer struct {
+	ctx          context.Context
+	repo         restic.Repository
+	snapshots    restic.Snapshots
+	token        string
+	allowRestore bool
+
+	// restoreMu allows only one restore at a time.
+	restoreMu sync.Mutex
+}
+
+func newWebServer(ctx context.Context, repo restic.Repository, snapshots restic.Snapshots, token string, allowRestore bool) *webServer {
+	return &webServer{
+		ctx:          ctx,
+		repo:         repo,
+		snapshots:    snapshots,
+		token:        token,
+		allowRestore: allowRestore,
+	}
+}
+
+// validToken returns true if token is the access token.
+func (s *webServer) validToken(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+func (s *webServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	debug.Log("%v %v", r.Method, r.URL.Path)
+
+	// the token is passed in the URL of the first request and then stored in
+	// a cookie, so it does not need to be added to all links
+	if token := r.URL.Query().Get("token"); token != "" && s.validToken(token) {
+		http.SetCookie(w, &http.Cookie{Name: webTokenCookie, Value: token, Path: "/", HttpOnly: true})
+	} else if c, err := r.Cookie(webTokenCookie); err != nil || !s.validToken(c.Value) {
+		http.Error(w, "invalid or missing token", http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/":
+		s.serveSnapshots(w, r)
+	case strings.HasPrefix(r.URL.Path, "/snapshot/"):
+		s.serveSnapshot(w, r, strings.TrimPrefix(r.URL.Path, "/snapshot/"))
+	case r.URL.Path == "/restore":
+		s.serveRestore(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// findSnapshot returns the snapshot with the (short) ID.
+func (s *webServer) findSnapshot(id string) *restic.Snapshot {
+	for _, sn := range s.snapshots {
+		if sn.ID().String() == id || sn.ID().Str() == id {
+			return sn
+		}
+	}
+	return nil
+}
+
+// snapshotURL returns the URL of the directory or file dir within the
+// snapshot sn.
+func snapshotURL(sn *restic.Snapshot, dir string) string {
+	u := "/snapshot/" + sn.ID().Str()
+	for _, name := range strings.Split(dir, "/") {
+		if name != "" {
+			u += "/" + url.PathEscape(name)
+		}
+	}
+	return u
+}
+
+var webTemplates = template.Must(template.New("").Funcs(template.FuncMap{
+	"bytes":       formatBytes,
+	"snapshotURL": snapshotURL,
+	"join":        strings.Join,
+}).Parse(`
+{{define "header"}}<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>restic: {{.}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { text-align: left; padding: 0.2em 1em 0.2em 0; }
+td.size { text-align: right; }
+</style></head><body>
+<h1>{{.}}</h1>
+{{end}}
+
+{{define "footer"}}</body></html>
+{{end}}
+
+{{define "restore"}}{{if .AllowRestore}}
+<form method="post" action="/restore">
+<input type="hidden" name="token" value="{{.Token}}">
+<input type="hidden" name="snapshot" value="{{.Snapshot.ID}}">
+<input type="hidden" name="path" value="{{.Path}}">
+Restore {{if .Path}}{{.Path}}{{else}}the snapshot{{end}} to directory
+<input type="text" name="target" size="40">
+<input type="submit" value="Restore">
+</form>
+{{end}}{{end}}
+
+{{define "snapshots"}}{{template "header" "snapshots"}}
+<table>
+<tr><th>ID</th><th>Time</th><th>Host</th><th>Tags</th><th>Paths</th></tr>
+{{range .}}<tr>
+<td><a href="{{snapshotURL . ""}}">{{.ID.Str}}</a></td>
+<td>{{.Time.Format "2006-01-02 15:04:05"}}</td>
+<td>{{.Hostname}}</td>
+<td>{{join .Tags ", "}}</td>
+<td>{{join .Paths ", "}}</td>
+</tr>{{else}}<tr><td colspan="5">no snapshots found</td></tr>{{end}}
+</table>
+{{template "footer"}}{{end}}
+
+{{define "dir"}}{{template "header" printf "snapshot %v: /%v" .Snapshot.ID.Str .Path}}
+<p><a href="/">all snapshots</a>{{if .Path}} | <a href="{{snapshotURL .Snapshot .Parent}}">parent directory</a>{{end}}</p>
+{{template "restore" .}}
+<table>
+<tr><th>Name</th><th>Type</th><th>Size</th><th>Modified</th></tr>
+{{range .Nodes}}<tr>
+<td>{{if or (eq .Type "dir") (eq .Type "file")}}<a href="{{snapshotURL $.Snapshot (printf "%v/%v" $.Path .Name)}}">{{.Name}}</a>{{else}}{{.Name}}{{end}}</td>
+<td>{{.Type}}</td>
+<td class="size">{{if eq .Type "file"}}{{bytes .Size}}{{end}}</td>
+<td>{{.ModTime.Format "2006-01-02 15:04:05"}}</td>
+</tr>{{end}}
+</table>
+{{template "footer"}}{{end}}
+
+{{define "restored"}}{{template "header" "restore"}}
+<p>{{.}}</p>
+<p><a href="/">all snapshots</a></p>
+{{template "footer"}}{{end}}
+`))
+
+// webDir is the data for the template which lists a directory.
+type webDir struct {
+	Snapshot     *restic.Snapshot
+	Path         string
+	Parent       string
+	Nodes        []*restic.Node
+	AllowRestore bool
+	Token        string
+}
+
+func (s *webServer) render(w http.ResponseWriter, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := webTemplates.ExecuteTemplate(w, name, data); err != nil {
+		debug.Log("rendering %v failed: %v", name, err)
+	}
+}
+
+func (s *webServer) serveSnapshots(w http.ResponseWriter, r *http.Request) {
+	s.render(w, "snapshots", s.snapshots)
+}
+
+// serveSnapshot lists a directory in a snapshot, or sends the content of a
+// file. p is the ID of the snapshot followed by the path.
+func (s *webServer) serveSnapshot(w http.ResponseWriter, r *http.Request, p string) {
+	parts := strings.SplitN(p, "/", 2)
+	sn := s.findSnapshot(parts[0])
+	if sn == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var dir string
+	if len(parts) > 1 {
+		dir = strings.Trim(path.Clean("/"+parts[1]), "/")
+	}
+
+	tree, err := s.repo.LoadTree(s.ctx, *sn.Tree)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if dir != "" {
+		node, err := findNode(s.ctx, s.repo, tree, "/", strings.Split(dir, "/"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		switch {
+		case node.Type == "file":
+			s.serveFile(w, node)
+			return
+		case node.Type != "dir" || node.Subtree == nil:
+			http.Error(w, fmt.Sprintf("%v is a %v", dir, node.Type), http.StatusBadRequest)
+			return
+		}
+
+		tree, err = s.repo.LoadTree(s.ctx, *node.Subtree)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	parent := path.Dir(dir)
+	if parent == "." {
+		parent = ""
+	}
+
+	s.render(w, "dir", webDir{
+		Snapshot:     sn,
+		Path:         dir,
+		Parent:       parent,
+		Nodes:        tree.Nodes,
+		AllowRestore: s.allowRestore,
+		Token:        s.token,
+	})
+}
+
+// serveFile sends the content of the file node as a download.
+func (s *webServer) serveFile(w http.ResponseWriter, node *restic.Node) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", node.Name))
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", node.Size))
+
+	if err := dumpNode(s.ctx, s.repo, node, w); err != nil {
+		// the headers have already been sent
+		debug.Log("sending %v failed: %v", node.Name, err)
+	}
+}
+
+// serveRestore restores a snapshot or a directory in it to a local
+// directory. The token must be passed in the form, so that other web sites
+// cannot start a restore.
+func (s *webServer) serveRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "restores must be started with POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !s.allowRestore {
+		http.Error(w, "restores are not allowed, use --allow-restore", http.StatusForbidden)
+		return
+	}
+
+	if !s.validToken(r.PostFormValue("token")) {
+		http.Error(w, "invalid or missing token", http.StatusForbidden)
+		return
+	}
+
+	sn := s.findSnapshot(r.PostFormValue("snapshot"))
+	if sn == nil {
+		http.Error(w, "snapshot not found", http.StatusNotFound)
+		return
+	}
+
+	target := r.PostFormValue("target")
+	if target == "" {
+		http.Error(w, "no target directory given", http.StatusBadRequest)
+		return
+	}
+
+	res, err := restic.NewRestorer(s.repo, *sn.ID())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var errs int
+	res.Error = func(dir string, node *restic.Node, err error) error {
+		Warnf("error restoring %v: %v\n", dir, err)
+		errs++
+		return nil
+	}
+
+	what := fmt.Sprintf("snapshot %v", sn.ID().Str())
+	if dir := strings.Trim(path.Clean("/"+r.PostFormValue("path")), "/"); dir != "" {
+		res.SelectFilter = selectPaths([]string{filepath.FromSlash("/" + dir)})
+		what = fmt.Sprintf("/%v from %v", dir, what)
+	}
+
+	s.restoreMu.Lock()
+	defer s.restoreMu.Unlock()
+
+	Verbosef("restoring %v to %v\n", what, target)
+	err = res.RestoreTo(s.ctx, target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.render(w, "restored", fmt.Sprintf("Restored %v to %v, %d errors.", what, target, errs))
+}
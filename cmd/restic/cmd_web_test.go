@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestWebCheckLoopback(t *testing.T) {
+	var tests = []struct {
+		addr string
+		ok   bool
+	}{
+		{"localhost:8087", true},
+		{"127.0.0.1:8087", true},
+		{"[::1]:8087", true},
+		{":8087", false},
+		{"0.0.0.0:8087", false},
+		{"192.168.1.1:8087", false},
+		{"example.com:8087", false},
+		{"localhost", false},
+	}
+
+	for _, test := range tests {
+		err := checkLoopback(test.addr)
+		if test.ok != (err == nil) {
+			t.Errorf("%v: unexpected result %v", test.addr, err)
+		}
+	}
+}
+
+func TestWebServer(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	sn := restic.TestCreateSnapshot(t, repo, time.Unix(1460289341, 207401672), 2, 0)
+
+	srv := newWebServer(context.TODO(), repo, restic.Snapshots{sn}, "secret", false)
+
+	get := func(target string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rtest.Equals(t, http.StatusUnauthorized, get("/", nil).Code)
+	rtest.Equals(t, http.StatusUnauthorized, get("/?token=wrong", nil).Code)
+
+	rec := get("/?token=secret", nil)
+	rtest.Equals(t, http.StatusOK, rec.Code)
+	rtest.Assert(t, strings.Contains(rec.Body.String(), sn.ID().Str()),
+		"snapshot %v not listed", sn.ID().Str())
+
+	cookies := rec.Result().Cookies()
+	rtest.Equals(t, 1, len(cookies))
+	rtest.Equals(t, webTokenCookie, cookies[0].Name)
+
+	// the root directory of the snapshot is listed with the cookie
+	rec = get("/snapshot/"+sn.ID().Str(), cookies[0])
+	rtest.Equals(t, http.StatusOK, rec.Code)
+
+	rtest.Equals(t, http.StatusNotFound, get("/snapshot/00000000", cookies[0]).Code)
+
+	// restores are not allowed
+	form := url.Values{"token": {"secret"}, "snapshot": {sn.ID().String()}, "target": {"/tmp/restore"}}
+	req := httptest.NewRequest("POST", "/restore", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	rtest.Equals(t, http.StatusForbidden, rec.Code)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// etaWindow is the time span over which the throughput is averaged.
+const etaWindow = 30 * time.Second
+
+// etaEstimator computes the remaining time of an operation from a moving
+// average of the throughput, so that bursts of data which is already in the
+// repository (and is therefore processed much faster than new data) do not
+// make the estimate swing back and forth.
+type etaEstimator struct {
+	total uint64
+
+	rate      float64 // bytes per second
+	lastBytes uint64
+	lastTime  time.Duration
+}
+
+func newETAEstimator(total uint64) *etaEstimator {
+	return &etaEstimator{total: total}
+}
+
+// update adds a sample: bytes have been processed after the duration d.
+func (e *etaEstimator) update(bytes uint64, d time.Duration) {
+	if d <= e.lastTime || bytes < e.lastBytes {
+		return
+	}
+
+	dt := d - e.lastTime
+	rate := float64(bytes-e.lastBytes) / dt.Seconds()
+
+	if e.lastTime == 0 {
+		e.rate = rate
+	} else {
+		// weigh the new sample depending on the time it covers
+		alpha := 1 - math.Exp(-dt.Seconds()/etaWindow.Seconds())
+		e.rate = alpha*rate + (1-alpha)*e.rate
+	}
+
+	e.lastBytes = bytes
+	e.lastTime = d
+}
+
+// eta returns the estimated remaining time in seconds after bytes have been
+// processed. When no estimate is possible, zero is returned.
+func (e *etaEstimator) eta(bytes uint64) uint64 {
+	if bytes >= e.total || e.rate < 1 {
+		return 0
+	}
+
+	return uint64(float64(e.total-bytes) / e.rate)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestETAEstimator(t *testing.T) {
+	e := newETAEstimator(1000 * 1000)
+
+	// constant rate of 1000 bytes per second
+	for i := 1; i <= 10; i++ {
+		e.update(uint64(i*1000), time.Duration(i)*time.Second)
+	}
+
+	if eta := e.eta(10 * 1000); eta != 990 {
+		t.Fatalf("wrong ETA for constant rate, want 990, got %v", eta)
+	}
+
+	// a short burst of known data must not change the estimate much
+	e.update(110*1000, 11*time.Second)
+	e.update(111*1000, 12*time.Second)
+
+	eta := e.eta(111 * 1000)
+	if eta < 200 || eta > 889 {
+		t.Fatalf("ETA changed too much after a burst: %v", eta)
+	}
+
+	if eta := e.eta(1000 * 1000); eta != 0 {
+		t.Fatalf("expected zero ETA when done, got %v", eta)
+	}
+}
@@ -83,14 +83,17 @@ func rejectByPattern(patterns []string) RejectFunc {
 	}
 }
 
+// cacheDirTagSpec is the exclusion file used by --exclude-caches, a
+// CACHEDIR.TAG file as described in https://bford.info/cachedir/.
+const cacheDirTagSpec = "CACHEDIR.TAG:Signature: 8a477f597d28d172789f06886806bc55"
+
 // rejectIfPresent returns a RejectFunc which itself returns whether a path
 // should be excluded. The RejectFunc considers a file to be excluded when
 // it resides in a directory with an exclusion file, that is specified by
 // excludeFileSpec in the form "filename[:content]". The returned error is
-// non-nil if the filename component of excludeFileSpec is empty. If rc is
-// non-nil, it is going to be used in the RejectFunc to expedite the evaluation
-// of a directory based on previous visits.
-func rejectIfPresent(excludeFileSpec string) (RejectFunc, error) {
+// non-nil if the filename component of excludeFileSpec is empty. The
+// exclusion files are read from fsys.
+func rejectIfPresent(fsys fs.FS, excludeFileSpec string) (RejectFunc, error) {
 	if excludeFileSpec == "" {
 		return nil, errors.New("name for exclusion tagfile is empty")
 	}
@@ -108,7 +111,7 @@ func rejectIfPresent(excludeFileSpec string) (RejectFunc, error) {
 	debug.Log("using %q as exclusion tagfile", tf)
 	rc := &rejectionCache{}
 	fn := func(filename string, _ os.FileInfo) bool {
-		return isExcludedByFile(filename, tf, tc, rc)
+		return isExcludedByFile(fsys, filename, tf, tc, rc)
 	}
 	return fn, nil
 }
@@ -118,7 +121,7 @@ func rejectIfPresent(excludeFileSpec string) (RejectFunc, error) {
 // tagfile which bears the name specified in tagFilename and starts with
 // header. If rc is non-nil, it is used to expedite the evaluation of a
 // directory based on previous visits.
-func isExcludedByFile(filename, tagFilename, header string, rc *rejectionCache) bool {
+func isExcludedByFile(fsys fs.FS, filename, tagFilename, header string, rc *rejectionCache) bool {
 	if tagFilename == "" {
 		return false
 	}
@@ -133,14 +136,14 @@ func isExcludedByFile(filename, tagFilename, header string, rc *rejectionCache)
 	if visited {
 		return rejected
 	}
-	rejected = isDirExcludedByFile(dir, tagFilename, header)
+	rejected = isDirExcludedByFile(fsys, dir, tagFilename, header)
 	rc.Store(dir, rejected)
 	return rejected
 }
 
-func isDirExcludedByFile(dir, tagFilename, header string) bool {
+func isDirExcludedByFile(fsys fs.FS, dir, tagFilename, header string) bool {
 	tf := filepath.Join(dir, tagFilename)
-	_, err := fs.Lstat(tf)
+	_, err := fsys.Lstat(tf)
 	if os.IsNotExist(err) {
 		return false
 	}
@@ -156,7 +159,7 @@ func isDirExcludedByFile(dir, tagFilename, header string) bool {
 	// From this stage, errors mean tagFilename exists but it is malformed.
 	// Warnings will be generated so that the user is informed that the
 	// indented ignore-action is not performed.
-	f, err := os.Open(tf)
+	f, err := fsys.Open(tf)
 	if err != nil {
 		Warnf("could not open exclusion tagfile: %v", err)
 		return false
@@ -181,11 +184,11 @@ func isDirExcludedByFile(dir, tagFilename, header string) bool {
 }
 
 // gatherDevices returns the set of unique device ids of the files and/or
-// directory paths listed in "items".
-func gatherDevices(items []string) (deviceMap map[string]uint64, err error) {
+// directory paths listed in "items", as seen by fsys.
+func gatherDevices(fsys fs.FS, items []string) (deviceMap map[string]uint64, err error) {
 	deviceMap = make(map[string]uint64)
 	for _, item := range items {
-		fi, err := fs.Lstat(item)
+		fi, err := fsys.Lstat(item)
 		if err != nil {
 			return nil, err
 		}
@@ -203,8 +206,8 @@ func gatherDevices(items []string) (deviceMap map[string]uint64, err error) {
 
 // rejectByDevice returns a RejectFunc that rejects files which are on a
 // different file systems than the files/dirs in samples.
-func rejectByDevice(samples []string) (RejectFunc, error) {
-	allowed, err := gatherDevices(samples)
+func rejectByDevice(fsys fs.FS, samples []string) (RejectFunc, error) {
+	allowed, err := gatherDevices(fsys, samples)
 	if err != nil {
 		return nil, err
 	}
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/test"
 )
 
@@ -77,7 +78,7 @@ func TestIsExcludedByFile(t *testing.T) {
 			if tc.content == "" {
 				h = ""
 			}
-			if got := isExcludedByFile(foo, tagFilename, h, nil); tc.want != got {
+			if got := isExcludedByFile(fs.Local{}, foo, tagFilename, h, nil); tc.want != got {
 				t.Fatalf("expected %v, got %v", tc.want, got)
 			}
 		})
@@ -129,8 +130,8 @@ func TestMultipleIsExcludedByFile(t *testing.T) {
 
 	// create two rejection functions, one that tests for the NOFOO file
 	// and one for the NOBAR file
-	fooExclude, _ := rejectIfPresent("NOFOO")
-	barExclude, _ := rejectIfPresent("NOBAR")
+	fooExclude, _ := rejectIfPresent(fs.Local{}, "NOFOO")
+	barExclude, _ := rejectIfPresent(fs.Local{}, "NOBAR")
 
 	// To mock the archiver scanning walk, we create filepath.WalkFn
 	// that tests against the two rejection functions and stores
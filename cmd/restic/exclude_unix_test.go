@@ -0,0 +1,49 @@
+//+build !windows
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/test"
+)
+
+// deviceFileInfo is an os.FileInfo with a different device ID.
+type deviceFileInfo struct {
+	os.FileInfo
+	st syscall.Stat_t
+}
+
+func (fi deviceFileInfo) Sys() interface{} {
+	return &fi.st
+}
+
+func TestRejectByDevice(t *testing.T) {
+	tempDir, cleanup := test.TempDir(t)
+	defer cleanup()
+
+	dir := filepath.Join(tempDir, "dir")
+	test.OK(t, os.Mkdir(dir, 0755))
+	file := filepath.Join(dir, "file")
+	test.OK(t, ioutil.WriteFile(file, []byte("foo"), 0644))
+
+	reject, err := rejectByDevice(fs.Local{}, []string{tempDir})
+	test.OK(t, err)
+
+	fi, err := fs.Lstat(file)
+	test.OK(t, err)
+	test.Assert(t, !reject(file, fi), "file on the same device was rejected")
+
+	// a directory mounted below the target is on another device
+	st := *fi.Sys().(*syscall.Stat_t)
+	st.Dev++
+	other := deviceFileInfo{FileInfo: fi, st: st}
+	test.Assert(t, reject(file, other), "file on another device was not rejected")
+
+	test.Assert(t, !reject(dir, nil), "item without file info was rejected")
+}
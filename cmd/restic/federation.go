@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+)
+
+// openFederation opens the repositories at locations in the same way as the
+// main repository and returns them together with repo as a read-only
+// federation, in which snapshots and data are looked up in repo first. If no
+// locations are given, repo is returned.
+func openFederation(gopts GlobalOptions, repo *repository.Repository, locations []string) (restic.Repository, error) {
+	if len(locations) == 0 {
+		return repo, nil
+	}
+
+	repos := []restic.Repository{repo}
+	for _, location := range locations {
+		opts := gopts
+		opts.Repo = location
+
+		r, err := OpenRepository(opts)
+		if err != nil {
+			return nil, errors.Fatalf("unable to open federated repository %v: %v", location, err)
+		}
+
+		// the lock is removed by unlockAll when restic exits
+		if !gopts.NoLock {
+			if _, err := lockRepo(r); err != nil {
+				return nil, err
+			}
+		}
+
+		repos = append(repos, r)
+	}
+
+	return repository.NewFederation(repos...), nil
+}
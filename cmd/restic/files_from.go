@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// readFileOrStdin returns the content of the file filename, or of stdin if
+// filename is "-".
+func readFileOrStdin(filename string) ([]byte, error) {
+	var r io.Reader = os.Stdin
+	if filename != "-" {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	return ioutil.ReadAll(r)
+}
+
+// readVerbatimLines returns the lines of the file filename exactly as they
+// are, only empty lines are skipped.
+func readVerbatimLines(filename string) ([]string, error) {
+	data, err := readFileOrStdin(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// readRawNames returns the names in the file filename which are separated by
+// null bytes, as written by `find -print0`.
+func readRawNames(filename string) ([]string, error) {
+	data, err := readFileOrStdin(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, name := range bytes.Split(data, []byte{0}) {
+		if len(name) > 0 {
+			names = append(names, string(name))
+		}
+	}
+	return names, nil
+}
+
+// expandTargetPatterns replaces glob patterns in the targets by the files
+// they match. Patterns which do not match anything and remote targets are
+// kept as they are.
+func expandTargetPatterns(targets []string) ([]string, error) {
+	var result []string
+	for _, target := range targets {
+		if isRemoteTarget(target) {
+			result = append(result, target)
+			continue
+		}
+
+		matches, err := filepath.Glob(target)
+		if err != nil {
+			return nil, errors.Fatalf("invalid pattern %q: %v", target, err)
+		}
+
+		if len(matches) == 0 {
+			result = append(result, target)
+			continue
+		}
+		result = append(result, matches...)
+	}
+
+	return result, nil
+}
+
+// readFilesFrom returns the targets listed in the files given with
+// --files-from, --files-from-verbatim and --files-from-raw. "-" reads the
+// list from stdin.
+func readFilesFrom(opts BackupOptions) ([]string, error) {
+	var targets []string
+
+	for _, filename := range opts.FilesFrom {
+		lines, err := readLinesFromFile(filename)
+		if err != nil {
+			return nil, errors.Fatalf("unable to read %v: %v", filename, err)
+		}
+
+		lines, err = expandTargetPatterns(lines)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, lines...)
+	}
+
+	for _, filename := range opts.FilesFromVerbatim {
+		lines, err := readVerbatimLines(filename)
+		if err != nil {
+			return nil, errors.Fatalf("unable to read %v: %v", filename, err)
+		}
+		targets = append(targets, lines...)
+	}
+
+	for _, filename := range opts.FilesFromRaw {
+		names, err := readRawNames(filename)
+		if err != nil {
+			return nil, errors.Fatalf("unable to read %v: %v", filename, err)
+		}
+		targets = append(targets, names...)
+	}
+
+	return targets, nil
+}
+
+// filesFromStdin returns true if one of the lists of targets is read from
+// stdin.
+func filesFromStdin(opts BackupOptions) bool {
+	for _, list := range [][]string{opts.FilesFrom, opts.FilesFromVerbatim, opts.FilesFromRaw} {
+		for _, filename := range list {
+			if filename == "-" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestReadFilesFrom(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	for _, name := range []string{"a.txt", "b.txt", "c.log"} {
+		rtest.OK(t, ioutil.WriteFile(filepath.Join(tempdir, name), []byte(name), 0644))
+	}
+
+	write := func(name, content string) string {
+		filename := filepath.Join(tempdir, name)
+		rtest.OK(t, ioutil.WriteFile(filename, []byte(content), 0644))
+		return filename
+	}
+
+	opts := BackupOptions{
+		FilesFrom: []string{write("list", "# comment\n"+
+			filepath.Join(tempdir, "*.txt")+"\n"+
+			"  "+filepath.Join(tempdir, "missing*")+"  \n"+
+			"\n"+
+			"sftp:user@host:/srv/*\n")},
+		FilesFromVerbatim: []string{write("verbatim", " leading space\n# not a comment\n\n"+filepath.Join(tempdir, "*.log")+"\n")},
+		FilesFromRaw:      []string{write("raw", "line\nbreak\x00"+filepath.Join(tempdir, "c.log")+"\x00")},
+	}
+
+	targets, err := readFilesFrom(opts)
+	rtest.OK(t, err)
+
+	want := []string{
+		filepath.Join(tempdir, "a.txt"),
+		filepath.Join(tempdir, "b.txt"),
+		filepath.Join(tempdir, "missing*"),
+		"sftp:user@host:/srv/*",
+		" leading space",
+		"# not a comment",
+		filepath.Join(tempdir, "*.log"),
+		"line\nbreak",
+		filepath.Join(tempdir, "c.log"),
+	}
+	if !reflect.DeepEqual(targets, want) {
+		t.Errorf("wrong targets\nwant %q\n got %q", want, targets)
+	}
+
+	rtest.Assert(t, !filesFromStdin(opts), "stdin detected")
+	opts.FilesFromRaw = append(opts.FilesFromRaw, "-")
+	rtest.Assert(t, filesFromStdin(opts), "stdin not detected")
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// forecastWindow is the period of the history which is used to compute the
+// growth of the repository, so that the forecast follows recent changes.
+const forecastWindow = 90 * 24 * time.Hour
+
+// growthForecast describes how fast a repository grows, and when it reaches
+// the capacity of the storage.
+type growthForecast struct {
+	BytesPerDay float64    `json:"bytes_per_day"`
+	Records     int        `json:"records"`
+	Capacity    uint64     `json:"capacity,omitempty"`
+	Full        *time.Time `json:"full,omitempty"`
+}
+
+// forecastGrowth fits a line through the sizes of the repository recorded
+// within forecastWindow before the latest record. At least two records at
+// different times are needed, otherwise false is returned. If capacity is
+// not zero and the repository grows, the time when the capacity is reached
+// is estimated.
+func forecastGrowth(history []restic.RepositoryStats, capacity uint64) (growthForecast, bool) {
+	if len(history) == 0 {
+		return growthForecast{}, false
+	}
+
+	latest := history[len(history)-1]
+	start := latest.Time.Add(-forecastWindow)
+
+	var n, sumX, sumY, sumXY, sumXX float64
+	for _, s := range history {
+		if s.Time.Before(start) {
+			continue
+		}
+
+		x := s.Time.Sub(start).Hours() / 24
+		y := float64(s.TotalSize)
+		n++
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+
+	d := n*sumXX - sumX*sumX
+	if n < 2 || d <= 0 {
+		return growthForecast{}, false
+	}
+
+	f := growthForecast{
+		BytesPerDay: (n*sumXY - sumX*sumY) / d,
+		Records:     int(n),
+		Capacity:    capacity,
+	}
+
+	if capacity > 0 && f.BytesPerDay > 0 {
+		var days float64
+		if capacity > latest.TotalSize {
+			days = float64(capacity-latest.TotalSize) / f.BytesPerDay
+		}
+		full := latest.Time.Add(time.Duration(days * 24 * float64(time.Hour)))
+		f.Full = &full
+	}
+
+	return f, true
+}
+
+// parseSize parses a size like "500G" or "2TiB". The suffixes K, M, G and T
+// use powers of 1024, a missing suffix means bytes.
+func parseSize(s string) (uint64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	str = strings.TrimSuffix(str, "IB")
+	str = strings.TrimSuffix(str, "B")
+
+	var shift uint
+	if len(str) > 0 {
+		switch str[len(str)-1] {
+		case 'K':
+			shift = 10
+		case 'M':
+			shift = 20
+		case 'G':
+			shift = 30
+		case 'T':
+			shift = 40
+		}
+	}
+	if shift > 0 {
+		str = str[:len(str)-1]
+	}
+
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil || value < 0 {
+		return 0, errors.Fatalf("invalid size %q", s)
+	}
+
+	return uint64(value * float64(uint64(1)<<shift)), nil
+}
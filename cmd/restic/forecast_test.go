@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+func TestForecastGrowth(t *testing.T) {
+	start := time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	var history []restic.RepositoryStats
+	// an old record which is outside of the forecast window
+	history = append(history, restic.RepositoryStats{Time: start.Add(-200 * 24 * time.Hour), TotalSize: 1 << 40})
+	for i := 0; i < 10; i++ {
+		history = append(history, restic.RepositoryStats{
+			Time:      start.Add(time.Duration(i) * 24 * time.Hour),
+			TotalSize: uint64(100+i*10) << 30,
+		})
+	}
+
+	f, ok := forecastGrowth(history, 200<<30)
+	if !ok {
+		t.Fatal("no forecast returned")
+	}
+
+	if f.Records != 10 {
+		t.Errorf("wrong number of records used, want 10, got %v", f.Records)
+	}
+
+	if f.BytesPerDay < 9.99*(1<<30) || f.BytesPerDay > 10.01*(1<<30) {
+		t.Errorf("wrong growth, want 10 GiB per day, got %v", formatBytes(uint64(f.BytesPerDay)))
+	}
+
+	// 190 GiB are used after 9 days, so the storage is full one day later
+	want := start.Add(10 * 24 * time.Hour)
+	if f.Full == nil || f.Full.Sub(want) > time.Minute || want.Sub(*f.Full) > time.Minute {
+		t.Errorf("wrong time when the storage is full, want %v, got %v", want, f.Full)
+	}
+
+	if _, ok := forecastGrowth(history[len(history)-1:], 0); ok {
+		t.Errorf("forecast returned for a single record")
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	var tests = []struct {
+		input string
+		size  uint64
+	}{
+		{"1024", 1024},
+		{"2k", 2048},
+		{"1.5M", 3 << 19},
+		{"500G", 500 << 30},
+		{"2TiB", 2 << 40},
+		{"10GB", 10 << 30},
+	}
+
+	for _, test := range tests {
+		size, err := parseSize(test.input)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", test.input, err)
+			continue
+		}
+
+		if size != test.size {
+			t.Errorf("%q: want %d, got %d", test.input, test.size, size)
+		}
+	}
+
+	for _, input := range []string{"", "G", "-1G", "10X"} {
+		if _, err := parseSize(input); err == nil {
+			t.Errorf("%q: expected an error", input)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -18,6 +19,7 @@ import (
 	"github.com/restic/restic/internal/backend/gs"
 	"github.com/restic/restic/internal/backend/local"
 	"github.com/restic/restic/internal/backend/location"
+	"github.com/restic/restic/internal/backend/mem"
 	"github.com/restic/restic/internal/backend/rest"
 	"github.com/restic/restic/internal/backend/s3"
 	"github.com/restic/restic/internal/backend/sftp"
@@ -49,9 +51,17 @@ type GlobalOptions struct {
 	CACerts       []string
 	TLSClientCert string
 	CleanupCache  bool
+	DataCacheDir  string
+	DataCacheSize string
 
-	LimitUploadKb   int
-	LimitDownloadKb int
+	LimitUploadKb         int
+	LimitDownloadKb       int
+	LimitUploadSchedule   string
+	LimitDownloadSchedule string
+
+	StatusSocket string
+	Notify       string
+	ShowUsage    bool
 
 	ctx      context.Context
 	password string
@@ -87,8 +97,15 @@ func init() {
 	f.StringSliceVar(&globalOptions.CACerts, "cacert", nil, "path to load root certificates from (default: use system certificates)")
 	f.StringVar(&globalOptions.TLSClientCert, "tls-client-cert", "", "path to a file containing PEM encoded TLS client certificate and private key")
 	f.BoolVar(&globalOptions.CleanupCache, "cleanup-cache", false, "auto remove old cache directories")
+	f.StringVar(&globalOptions.DataCacheSize, "data-cache-size", "", "keep up to `size` (e.g. 20G) of data packs in a local cache for restore, mount and dump (default: disabled)")
+	f.StringVar(&globalOptions.DataCacheDir, "data-cache-dir", "", "set the directory for the data cache (default: the cache directory)")
 	f.IntVar(&globalOptions.LimitUploadKb, "limit-upload", 0, "limits uploads to a maximum rate in KiB/s. (default: unlimited)")
 	f.IntVar(&globalOptions.LimitDownloadKb, "limit-download", 0, "limits downloads to a maximum rate in KiB/s. (default: unlimited)")
+	f.StringVar(&globalOptions.LimitUploadSchedule, "limit-upload-schedule", "", "use other upload rates in KiB/s during time windows, e.g. `01:00-06:00=0` (0 is unlimited, separate several windows by commas)")
+	f.StringVar(&globalOptions.LimitDownloadSchedule, "limit-download-schedule", "", "use other download rates in KiB/s during time windows, e.g. `01:00-06:00=0` (0 is unlimited, separate several windows by commas)")
+	f.StringVar(&globalOptions.StatusSocket, "status-socket", "", "send the progress of the operation as JSON messages to clients connecting to the unix socket at `path`")
+	f.StringVar(&globalOptions.Notify, "notify", os.Getenv("RESTIC_NOTIFY"), "show a desktop notification when a command fails (`level` error), also needs attention (attention) or always (all) (default: $RESTIC_NOTIFY)")
+	f.BoolVar(&globalOptions.ShowUsage, "show-usage", false, "print the bytes transferred and the requests sent to the backend when the command exits")
 	f.StringSliceVarP(&globalOptions.Options, "option", "o", []string{}, "set extended option (`key=value`, can be specified multiple times)")
 
 	restoreTerminal()
@@ -204,6 +221,33 @@ func PrintProgress(format string, args ...interface{}) {
 	fmt.Print(message)
 }
 
+// PrintProgressLines prints a status consisting of several lines to the
+// terminal, replacing the prev lines printed by the previous call. It returns
+// the number of lines printed, which must be passed to the next call.
+func PrintProgressLines(prev int, lines []string) int {
+	var buf bytes.Buffer
+
+	if prev > 1 {
+		fmt.Fprintf(&buf, "\x1b[%dA", prev-1)
+	}
+
+	for i, line := range lines {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString("\r" + ClearLine() + line)
+	}
+
+	// clear the remaining lines of the previous status
+	if extra := prev - len(lines); extra > 0 {
+		buf.WriteString(strings.Repeat("\n\r"+ClearLine(), extra))
+		fmt.Fprintf(&buf, "\x1b[%dA", extra)
+	}
+
+	fmt.Print(buf.String())
+	return len(lines)
+}
+
 // Warnf writes the message to the configured stderr stream.
 func Warnf(format string, args ...interface{}) {
 	_, err := fmt.Fprintf(globalOptions.stderr, format, args...)
@@ -394,6 +438,45 @@ func OpenRepository(opts GlobalOptions) (*repository.Repository, error) {
 	return s, nil
 }
 
+// useDataCache loads the data packs of repo through a local cache if a size
+// has been set with --data-cache-size. The cache is returned, or nil if it is
+// disabled.
+func useDataCache(repo *repository.Repository, opts GlobalOptions) (*cache.DataCache, error) {
+	if opts.DataCacheSize == "" {
+		return nil, nil
+	}
+
+	size, err := parseSize(opts.DataCacheSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if size == 0 {
+		return nil, nil
+	}
+
+	base := opts.DataCacheDir
+	if base == "" {
+		base = opts.CacheDir
+	}
+	if base == "" {
+		base, err = cache.DefaultDir()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	dir := filepath.Join(base, repo.Config().ID, "packs")
+	c, err := cache.NewDataCache(dir, int64(size))
+	if err != nil {
+		return nil, errors.Fatalf("unable to open the data cache: %v", err)
+	}
+
+	debug.Log("using data cache at %v, %d bytes", dir, size)
+	repo.UseDataCache(c)
+	return c, nil
+}
+
 func parseConfig(loc location.Location, opts options.Options) (interface{}, error) {
 	// only apply options for a particular backend here
 	opts = opts.Extract(loc.Scheme)
@@ -523,11 +606,52 @@ func parseConfig(loc location.Location, opts options.Options) (interface{}, erro
 
 		debug.Log("opening rest repository at %#v", cfg)
 		return cfg, nil
+
+	case "mem":
+		cfg := loc.Config.(mem.Config)
+		if err := opts.Apply(loc.Scheme, &cfg); err != nil {
+			return nil, err
+		}
+
+		if cfg.Size != "" {
+			size, err := parseSize(cfg.Size)
+			if err != nil {
+				return nil, err
+			}
+			cfg.MaxSize = size
+		}
+
+		debug.Log("opening memory repository %#v", cfg)
+		return cfg, nil
 	}
 
 	return nil, errors.Fatalf("invalid backend: %q", loc.Scheme)
 }
 
+// newLimiter returns the limiter for the rates given in gopts. When a schedule
+// is set, the rate is selected by the time of day.
+func newLimiter(gopts GlobalOptions) (limiter.Limiter, error) {
+	if gopts.LimitUploadKb < 0 || gopts.LimitDownloadKb < 0 {
+		return nil, errors.Fatal("--limit-upload and --limit-download must not be negative")
+	}
+
+	if gopts.LimitUploadSchedule == "" && gopts.LimitDownloadSchedule == "" {
+		return limiter.NewStaticLimiter(gopts.LimitUploadKb, gopts.LimitDownloadKb), nil
+	}
+
+	upload, err := limiter.ParseSchedule(gopts.LimitUploadSchedule)
+	if err != nil {
+		return nil, errors.Fatalf("invalid --limit-upload-schedule: %v", err)
+	}
+
+	download, err := limiter.ParseSchedule(gopts.LimitDownloadSchedule)
+	if err != nil {
+		return nil, errors.Fatalf("invalid --limit-download-schedule: %v", err)
+	}
+
+	return limiter.NewScheduledLimiter(gopts.LimitUploadKb, gopts.LimitDownloadKb, upload, download), nil
+}
+
 // Open the backend specified by a location config.
 func open(s string, gopts GlobalOptions, opts options.Options) (restic.Backend, error) {
 	debug.Log("parsing location %v", s)
@@ -552,18 +676,23 @@ func open(s string, gopts GlobalOptions, opts options.Options) (restic.Backend,
 		return nil, err
 	}
 
+	lim, err := newLimiter(gopts)
+	if err != nil {
+		return nil, err
+	}
+
 	// wrap the transport so that the throughput via HTTP is limited
-	rt = limiter.NewStaticLimiter(gopts.LimitUploadKb, gopts.LimitDownloadKb).Transport(rt)
+	rt = lim.Transport(rt)
 
 	switch loc.Scheme {
 	case "local":
 		be, err = local.Open(cfg.(local.Config))
 		// wrap the backend in a LimitBackend so that the throughput is limited
-		be = limiter.LimitBackend(be, limiter.NewStaticLimiter(gopts.LimitUploadKb, gopts.LimitDownloadKb))
+		be = limiter.LimitBackend(be, lim)
 	case "sftp":
 		be, err = sftp.Open(cfg.(sftp.Config))
 		// wrap the backend in a LimitBackend so that the throughput is limited
-		be = limiter.LimitBackend(be, limiter.NewStaticLimiter(gopts.LimitUploadKb, gopts.LimitDownloadKb))
+		be = limiter.LimitBackend(be, lim)
 	case "s3":
 		be, err = s3.Open(cfg.(s3.Config), rt)
 	case "gs":
@@ -576,6 +705,8 @@ func open(s string, gopts GlobalOptions, opts options.Options) (restic.Backend,
 		be, err = b2.Open(globalOptions.ctx, cfg.(b2.Config), rt)
 	case "rest":
 		be, err = rest.Open(cfg.(rest.Config), rt)
+	case "mem":
+		be, err = openMemBackend(cfg.(mem.Config), mem.Open)
 
 	default:
 		return nil, errors.Fatalf("invalid backend: %q", loc.Scheme)
@@ -585,8 +716,18 @@ func open(s string, gopts GlobalOptions, opts options.Options) (restic.Backend,
 		return nil, errors.Fatalf("unable to open repo at %v: %v", s, err)
 	}
 
+	// count the requests, including the ones to check the config file
+	be = trackUsage(be, s)
+
 	// check if config is there
 	fi, err := be.Stat(globalOptions.ctx, restic.Handle{Type: restic.ConfigFile})
+	if err != nil && be.IsNotExist(err) {
+		// replacing the config was interrupted, the new config is used instead
+		found, lerr := repository.HasNewConfig(globalOptions.ctx, be)
+		if lerr == nil && found {
+			return be, nil
+		}
+	}
 	if err != nil {
 		return nil, errors.Fatalf("unable to open config file: %v\nIs there a repository at the following location?\n%v", err, s)
 	}
@@ -598,8 +739,23 @@ func open(s string, gopts GlobalOptions, opts options.Options) (restic.Backend,
 	return be, nil
 }
 
+// openMemBackend opens a memory backend with fn. When a snapshot file is
+// configured, the data is saved to it when restic exits.
+func openMemBackend(cfg mem.Config, fn func(mem.Config) (*mem.MemoryBackend, error)) (restic.Backend, error) {
+	be, err := fn(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Snapshot != "" {
+		AddCleanupHandler(be.Close)
+	}
+
+	return be, nil
+}
+
 // Create the backend specified by URI.
-func create(s string, opts options.Options) (restic.Backend, error) {
+func create(s string, gopts GlobalOptions, opts options.Options) (restic.Backend, error) {
 	debug.Log("parsing location %v", s)
 	loc, err := location.Parse(s)
 	if err != nil {
@@ -620,11 +776,25 @@ func create(s string, opts options.Options) (restic.Backend, error) {
 		return nil, err
 	}
 
+	lim, err := newLimiter(gopts)
+	if err != nil {
+		return nil, err
+	}
+	rt = lim.Transport(rt)
+
 	switch loc.Scheme {
 	case "local":
-		return local.Create(cfg.(local.Config))
+		be, err := local.Create(cfg.(local.Config))
+		if err != nil {
+			return nil, err
+		}
+		return limiter.LimitBackend(be, lim), nil
 	case "sftp":
-		return sftp.Create(cfg.(sftp.Config))
+		be, err := sftp.Create(cfg.(sftp.Config))
+		if err != nil {
+			return nil, err
+		}
+		return limiter.LimitBackend(be, lim), nil
 	case "s3":
 		return s3.Create(cfg.(s3.Config), rt)
 	case "gs":
@@ -637,6 +807,8 @@ func create(s string, opts options.Options) (restic.Backend, error) {
 		return b2.Create(globalOptions.ctx, cfg.(b2.Config), rt)
 	case "rest":
 		return rest.Create(cfg.(rest.Config), rt)
+	case "mem":
+		return openMemBackend(cfg.(mem.Config), mem.Create)
 	}
 
 	debug.Log("invalid repository scheme: %v", s)
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// growthLimits is the number of files and bytes a backup may contain in
+// addition to the previous snapshot, zero means no limit.
+type growthLimits struct {
+	files uint64
+	bytes uint64
+}
+
+// growthViolation describes a value of a backup which exceeds the value of
+// the previous snapshot by more than the limit.
+type growthViolation struct {
+	name            string
+	current, before uint64
+	limit           uint64
+	format          func(uint64) string
+}
+
+func (v growthViolation) String() string {
+	return fmt.Sprintf("%v: %v, %v more than the previous snapshot (%v), the limit is %v",
+		v.name, v.format(v.current), v.format(v.current-v.before), v.format(v.before), v.format(v.limit))
+}
+
+func formatUint(v uint64) string {
+	return fmt.Sprintf("%d", v)
+}
+
+// checkGrowth compares the files and bytes found by the scan of a backup with
+// the stats of the previous snapshot and returns the values which grew by
+// more than the limits.
+func checkGrowth(before restic.SnapshotStats, scan restic.Stat, limits growthLimits) (violations []growthViolation) {
+	if limits.files > 0 && scan.Files > before.TotalFileCount+limits.files {
+		violations = append(violations, growthViolation{
+			name:    "files",
+			current: scan.Files,
+			before:  before.TotalFileCount,
+			limit:   limits.files,
+			format:  formatUint,
+		})
+	}
+
+	if limits.bytes > 0 && scan.Bytes > before.TotalSize+limits.bytes {
+		violations = append(violations, growthViolation{
+			name:    "size",
+			current: scan.Bytes,
+			before:  before.TotalSize,
+			limit:   limits.bytes,
+			format:  formatBytes,
+		})
+	}
+
+	return violations
+}
+
+// findGrowthBaseline returns the snapshot the growth of a backup of targets
+// is compared to. This is the parent if it is complete, otherwise the latest
+// snapshot of the targets which is not partial (see backup --max-duration).
+// A partial snapshot does not contain all files, so the growth would seem
+// larger than it is. When no snapshot is found, nil is returned.
+func findGrowthBaseline(ctx context.Context, repo restic.Repository, parentID *restic.ID, targets []string, hostname string) (*restic.ID, *restic.Snapshot, error) {
+	if parentID != nil {
+		sn, err := restic.LoadSnapshot(ctx, repo, *parentID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if !sn.HasTags([]string{archiver.PartialTag}) {
+			return parentID, sn, nil
+		}
+	}
+
+	var (
+		latestID restic.ID
+		latest   *restic.Snapshot
+	)
+
+	err := restic.ForAllSnapshots(ctx, repo, func(id restic.ID, sn *restic.Snapshot, err error) error {
+		if err != nil {
+			return errors.Errorf("Error loading snapshot %v: %v", id.Str(), err)
+		}
+
+		if sn.Checkpoint || (hostname != "" && hostname != sn.Hostname) || !sn.HasPaths(targets) || sn.HasTags([]string{archiver.PartialTag}) {
+			return nil
+		}
+
+		if latest == nil || sn.Time.After(latest.Time) {
+			latestID, latest = id, sn
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if latest == nil {
+		return nil, nil, nil
+	}
+
+	return &latestID, latest, nil
+}
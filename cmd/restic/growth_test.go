@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+func TestCheckGrowth(t *testing.T) {
+	before := restic.SnapshotStats{TotalFileCount: 1000, TotalSize: 1 << 30}
+
+	var tests = []struct {
+		scan   restic.Stat
+		limits growthLimits
+		names  []string
+	}{
+		{
+			scan: restic.Stat{Files: 100000, Bytes: 1 << 40},
+		},
+		{
+			scan:   restic.Stat{Files: 1500, Bytes: 1 << 30},
+			limits: growthLimits{files: 500, bytes: 1 << 20},
+		},
+		{
+			scan:   restic.Stat{Files: 1501, Bytes: 1 << 30},
+			limits: growthLimits{files: 500, bytes: 1 << 20},
+			names:  []string{"files"},
+		},
+		{
+			scan:   restic.Stat{Files: 10, Bytes: 2 << 30},
+			limits: growthLimits{files: 500, bytes: 1 << 20},
+			names:  []string{"size"},
+		},
+		{
+			scan:   restic.Stat{Files: 5000, Bytes: 2 << 30},
+			limits: growthLimits{files: 500, bytes: 1 << 20},
+			names:  []string{"files", "size"},
+		},
+	}
+
+	for i, test := range tests {
+		violations := checkGrowth(before, test.scan, test.limits)
+		if len(violations) != len(test.names) {
+			t.Errorf("test %d: wrong number of violations, want %v, got %v", i, test.names, violations)
+			continue
+		}
+
+		for j, v := range violations {
+			if v.name != test.names[j] {
+				t.Errorf("test %d: wrong violation %d, want %v, got %v", i, j, test.names[j], v.name)
+			}
+		}
+	}
+}
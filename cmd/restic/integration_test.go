@@ -4,12 +4,15 @@ import (
 	"bufio"
 	"bytes"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	mrand "math/rand"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -46,7 +49,7 @@ func testRunInit(t testing.TB, opts GlobalOptions) {
 	repository.TestUseLowSecurityKDFParameters(t)
 	restic.TestSetLockTimeout(t, 0)
 
-	rtest.OK(t, runInit(opts, nil))
+	rtest.OK(t, runInit(InitOptions{InsecureAllowWeakPassword: true}, opts, nil))
 	t.Logf("repository initialized at %v", opts.Repo)
 }
 
@@ -196,7 +199,7 @@ func testRunForget(t testing.TB, gopts GlobalOptions, args ...string) {
 }
 
 func testRunPrune(t testing.TB, gopts GlobalOptions) {
-	rtest.OK(t, runPrune(gopts))
+	rtest.OK(t, runPrune(PruneOptions{}, gopts))
 }
 
 func TestBackup(t *testing.T) {
@@ -528,6 +531,365 @@ var backupExcludeFilenames = []string{
 	"work/source/test.c",
 }
 
+func TestBackupSummary(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	datadir := filepath.Join(env.base, "testdata")
+	rtest.OK(t, os.MkdirAll(filepath.Join(datadir, "subdir"), 0755))
+	for _, filename := range []string{"foo", "bar", "subdir/baz"} {
+		rtest.OK(t, ioutil.WriteFile(filepath.Join(datadir, filename), []byte(filename), 0600))
+	}
+
+	opts := BackupOptions{}
+	testRunBackup(t, []string{datadir}, opts, env.gopts)
+
+	newest, _ := testRunSnapshots(t, env.gopts)
+	rtest.Assert(t, newest.Summary != nil, "first snapshot has no summary")
+	rtest.Equals(t, 3, newest.Summary.FilesNew)
+	rtest.Equals(t, 2, newest.Summary.DirsNew)
+
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(datadir, "foo"), []byte("modified foo"), 0600))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(datadir, "new"), []byte("new file"), 0600))
+	rtest.OK(t, os.Remove(filepath.Join(datadir, "subdir", "baz")))
+
+	testRunBackup(t, []string{datadir}, opts, env.gopts)
+
+	newest, _ = testRunSnapshots(t, env.gopts)
+	rtest.Assert(t, newest.Summary != nil, "second snapshot has no summary")
+	rtest.Equals(t, restic.SnapshotSummary{
+		FilesNew:     1,
+		FilesRemoved: 1,
+		FilesChanged: 1,
+		DataAdded:    newest.Summary.DataAdded,
+		BackendUsage: newest.Summary.BackendUsage,
+	}, *newest.Summary)
+	rtest.Assert(t, newest.Summary.DataAdded > 0, "no data added")
+
+	usage := newest.Summary.BackendUsage
+	rtest.Assert(t, len(usage) > 0, "no backend usage recorded")
+	rtest.Assert(t, usage[len(usage)-1].PutRequests > 0, "no PUT requests recorded")
+}
+
+func testRunChain(t testing.TB, gopts GlobalOptions, args ...string) []snapshotChain {
+	buf := bytes.NewBuffer(nil)
+	globalOptions.stdout = buf
+	globalOptions.JSON = true
+	defer func() {
+		globalOptions.stdout = os.Stdout
+		globalOptions.JSON = gopts.JSON
+	}()
+
+	rtest.OK(t, runChain(ChainOptions{}, globalOptions, args))
+
+	var chains []snapshotChain
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &chains))
+	return chains
+}
+
+func TestChain(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	datadir := filepath.Join(env.base, "testdata")
+	rtest.OK(t, os.MkdirAll(datadir, 0755))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(datadir, "foo"), []byte("foo"), 0600))
+
+	testRunBackup(t, []string{datadir}, BackupOptions{}, env.gopts)
+	first, _ := testRunSnapshots(t, env.gopts)
+	testRunBackup(t, []string{datadir}, BackupOptions{}, env.gopts)
+	second, _ := testRunSnapshots(t, env.gopts)
+
+	chains := testRunChain(t, env.gopts)
+	rtest.Equals(t, 1, len(chains))
+	chain := chains[0]
+	rtest.Equals(t, 2, len(chain.Snapshots))
+	rtest.Equals(t, *second.ID, *chain.Snapshots[0].ID)
+	rtest.Equals(t, restic.ChangeDetectionParent, chain.Snapshots[0].ChangeDetection)
+	rtest.Equals(t, *first.ID, *chain.Snapshots[0].Parent)
+	rtest.Equals(t, *first.ID, *chain.Snapshots[1].ID)
+	rtest.Equals(t, restic.ChangeDetectionNone, chain.Snapshots[1].ChangeDetection)
+	rtest.Assert(t, chain.MissingParent == nil, "unexpected missing parent %v", chain.MissingParent)
+
+	// a forced backup starts a new chain
+	testRunBackup(t, []string{datadir}, BackupOptions{Force: true}, env.gopts)
+	chains = testRunChain(t, env.gopts, "latest")
+	rtest.Equals(t, 1, len(chains[0].Snapshots))
+	rtest.Equals(t, restic.ChangeDetectionNone, chains[0].Snapshots[0].ChangeDetection)
+
+	// the chain ends at a forgotten parent
+	testRunForget(t, env.gopts, first.ID.String())
+	chains = testRunChain(t, env.gopts, second.ID.String())
+	rtest.Equals(t, 1, len(chains[0].Snapshots))
+	rtest.Assert(t, chains[0].MissingParent != nil && *chains[0].MissingParent == *first.ID,
+		"wrong missing parent %v", chains[0].MissingParent)
+}
+
+func TestVerify(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	datadir := filepath.Join(env.base, "testdata")
+	rtest.OK(t, os.MkdirAll(filepath.Join(datadir, "subdir"), 0755))
+	filename := filepath.Join(datadir, "subdir", "file")
+	data := rtest.Random(23, 5*1024*1024)
+	rtest.OK(t, ioutil.WriteFile(filename, data, 0600))
+
+	testRunBackup(t, []string{datadir}, BackupOptions{}, env.gopts)
+
+	globalOptions.stdout = ioutil.Discard
+	defer func() {
+		globalOptions.stdout = os.Stdout
+	}()
+
+	rtest.OK(t, runVerify(VerifyOptions{}, globalOptions, []string{"latest", filename}))
+
+	data[len(data)/2] ^= 0xff
+	rtest.OK(t, ioutil.WriteFile(filename, data, 0600))
+	err := runVerify(VerifyOptions{}, globalOptions, []string{"latest", filename})
+	rtest.Assert(t, err != nil, "modified file was not detected")
+
+	err = runVerify(VerifyOptions{}, globalOptions, []string{"latest", filepath.Join(datadir, "subdir")})
+	rtest.Assert(t, err != nil, "verifying a directory did not fail")
+
+	err = runVerify(VerifyOptions{}, globalOptions, []string{"latest", env.base})
+	rtest.Assert(t, err != nil, "verifying a path outside of the snapshot did not fail")
+}
+
+func TestVerifyTree(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	datadir := filepath.Join(env.base, "testdata")
+	rtest.OK(t, os.MkdirAll(filepath.Join(datadir, "subdir"), 0755))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(datadir, "subdir", "file"), []byte("foo"), 0600))
+	rtest.OK(t, os.Symlink("subdir/file", filepath.Join(datadir, "link")))
+
+	testRunBackup(t, []string{datadir}, BackupOptions{}, env.gopts)
+	sn, _ := testRunSnapshots(t, env.gopts)
+
+	buf := bytes.NewBuffer(nil)
+	globalOptions.stdout = buf
+	globalOptions.JSON = true
+	defer func() {
+		globalOptions.stdout = os.Stdout
+		globalOptions.JSON = env.gopts.JSON
+	}()
+
+	rtest.OK(t, runVerifyTree(VerifyTreeOptions{}, globalOptions, nil))
+
+	var results []verifiedSnapshot
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &results))
+	rtest.Equals(t, 1, len(results))
+	rtest.Equals(t, *sn.Tree, results[0].Tree)
+	rtest.Equals(t, *sn.Tree, results[0].Recomputed)
+	rtest.Equals(t, 0, len(results[0].Mismatches))
+}
+
+func TestBackupCanary(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	datadir := filepath.Join(env.base, "testdata")
+	rtest.OK(t, os.MkdirAll(datadir, 0755))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(datadir, "foo"), []byte("foo"), 0600))
+
+	testRunBackup(t, []string{datadir}, BackupOptions{Canary: true}, env.gopts)
+	sn, _ := testRunSnapshots(t, env.gopts)
+	rtest.Assert(t, sn.Canary != nil, "snapshot has no canary")
+
+	// the canary blob is only referenced by the snapshot, it must not be
+	// reported as unused or removed by prune
+	testRunCheck(t, env.gopts)
+	testRunPrune(t, env.gopts)
+	testRunCheck(t, env.gopts)
+
+	// replace the snapshot with one whose canary has a different seed
+	repo, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+	sn.Canary.Seed = restic.NewRandomID()
+	_, err = repo.SaveJSONUnpacked(env.gopts.ctx, restic.SnapshotFile, sn.Snapshot)
+	rtest.OK(t, err)
+	testRunForget(t, env.gopts, sn.ID.String())
+
+	globalOptions.stderr = ioutil.Discard
+	defer func() {
+		globalOptions.stderr = os.Stderr
+	}()
+
+	_, err = testRunCheckOutput(env.gopts)
+	rtest.Assert(t, err != nil, "check did not detect the wrong canary")
+}
+
+func TestManifest(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	datadir := filepath.Join(env.base, "testdata")
+	rtest.OK(t, os.MkdirAll(filepath.Join(datadir, "subdir"), 0755))
+	files := map[string][]byte{
+		"foo":        []byte("foo"),
+		"subdir/bar": bytes.Repeat([]byte("bar"), 100000),
+		"empty":      nil,
+	}
+	for filename, data := range files {
+		rtest.OK(t, ioutil.WriteFile(filepath.Join(datadir, filepath.FromSlash(filename)), data, 0600))
+	}
+
+	testRunBackup(t, []string{datadir}, BackupOptions{}, env.gopts)
+
+	buf := bytes.NewBuffer(nil)
+	globalOptions.stdout = buf
+	globalOptions.JSON = true
+	defer func() {
+		globalOptions.stdout = os.Stdout
+		globalOptions.JSON = false
+	}()
+
+	rtest.OK(t, runManifest(ManifestOptions{}, globalOptions, []string{"latest"}))
+
+	var entries []restic.ManifestEntry
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &entries))
+
+	hashes := make(map[string]string)
+	for _, entry := range entries {
+		if entry.Type == "file" {
+			hashes[path.Base(entry.Path)] = entry.SHA256
+		}
+	}
+
+	for filename, data := range files {
+		hash := sha256.Sum256(data)
+		rtest.Equals(t, hex.EncodeToString(hash[:]), hashes[path.Base(filename)])
+	}
+	rtest.Equals(t, len(files), len(hashes))
+}
+
+func TestInitCopyChunkerParams(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	passwordFile := filepath.Join(env.base, "password")
+	rtest.OK(t, ioutil.WriteFile(passwordFile, []byte(rtest.TestPassword), 0600))
+
+	gopts := env.gopts
+	gopts.Repo = filepath.Join(env.base, "repo2")
+
+	rtest.Assert(t, runInit(InitOptions{CopyChunkerParams: true}, gopts, nil) != nil,
+		"no error for --copy-chunker-params without --from-repo")
+
+	opts := InitOptions{
+		CopyChunkerParams: true,
+		FromRepo:          env.repo,
+		FromPasswordFile:  passwordFile,
+
+		InsecureAllowWeakPassword: true,
+	}
+	rtest.OK(t, runInit(opts, gopts, nil))
+
+	repo, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+	repo2, err := OpenRepository(gopts)
+	rtest.OK(t, err)
+
+	rtest.Equals(t, repo.Config().ChunkerPolynomial, repo2.Config().ChunkerPolynomial)
+	rtest.Assert(t, repo.Config().ID != repo2.Config().ID, "repositories have the same ID")
+}
+
+func TestInitWithoutEncryption(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	repository.TestUseLowSecurityKDFParameters(t)
+	restic.TestSetLockTimeout(t, 0)
+	err := runInit(InitOptions{InsecureNoEncryption: true, InsecureAllowWeakPassword: true, RepositoryVersion: restic.RepoVersion}, env.gopts, nil)
+	rtest.Assert(t, err != nil, "repository version 1 without encryption was accepted")
+
+	rtest.OK(t, runInit(InitOptions{InsecureNoEncryption: true, InsecureAllowWeakPassword: true}, env.gopts, nil))
+
+	repo, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+	rtest.Equals(t, uint(restic.RepoVersionNoEncryption), repo.Config().Version)
+
+	marker := []byte("this text is stored without encryption")
+	datadir := filepath.Join(env.base, "testdata")
+	rtest.OK(t, os.MkdirAll(datadir, 0755))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(datadir, "file"), marker, 0600))
+
+	testRunBackup(t, []string{datadir}, BackupOptions{}, env.gopts)
+	testRunCheck(t, env.gopts)
+
+	found := false
+	err = filepath.Walk(filepath.Join(env.repo, "data"), func(path string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.Mode().IsRegular() {
+			return err
+		}
+
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(buf, marker) {
+			found = true
+		}
+		return nil
+	})
+	rtest.OK(t, err)
+	rtest.Assert(t, found, "file content not found in plaintext in the repository")
+
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+
+	restoredir := filepath.Join(env.base, "restore")
+	testRunRestore(t, env.gopts, restoredir, snapshotIDs[0])
+	buf, err := ioutil.ReadFile(filepath.Join(restoredir, "testdata", "file"))
+	rtest.OK(t, err)
+	rtest.Equals(t, marker, buf)
+}
+
+func TestMigrateBindRepoID(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	testRunInit(t, env.gopts)
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+
+	testRunBackup(t, []string{env.testdata}, BackupOptions{}, env.gopts)
+	rtest.OK(t, runMigrate(MigrateOptions{}, env.gopts, []string{"bind_repo_id"}))
+
+	repo, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+	rtest.Equals(t, uint(restic.RepoVersionAssociatedData), repo.Config().Version)
+
+	testRunBackup(t, []string{env.testdata}, BackupOptions{}, env.gopts)
+	testRunCheck(t, env.gopts)
+
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 2, "expected two snapshots, got %v", snapshotIDs)
+
+	for i, snapshotID := range snapshotIDs {
+		restoredir := filepath.Join(env.base, fmt.Sprintf("restore%d", i))
+		testRunRestore(t, env.gopts, restoredir, snapshotID)
+		rtest.Assert(t, directoriesEqualContents(env.testdata, filepath.Join(restoredir, "testdata")),
+			"directories are not equal")
+	}
+}
+
 func TestBackupExclude(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -745,6 +1107,86 @@ func TestTag(t *testing.T) {
 		"expected original ID to be set to the first snapshot id")
 }
 
+func TestForgetMaxRemovePercent(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	testRunInit(t, env.gopts)
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+
+	for i := 0; i < 3; i++ {
+		testRunBackup(t, []string{env.testdata}, BackupOptions{}, env.gopts)
+	}
+
+	// by default, the policy must not remove more than half of the snapshots
+	opts := forgetOptions
+	rtest.Equals(t, 50, opts.MaxRemovePercent)
+	opts.Last = 1
+	rtest.Assert(t, runForget(opts, env.gopts, nil) != nil,
+		"expected an error when removing two of three snapshots")
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 3, "snapshots were removed, remaining %v", snapshotIDs)
+
+	opts.MaxRemovePercent = 100
+	rtest.OK(t, runForget(opts, env.gopts, nil))
+	snapshotIDs = testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+}
+
+func TestPin(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	testRunInit(t, env.gopts)
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+
+	testRunBackup(t, []string{env.testdata}, BackupOptions{}, env.gopts)
+	testRunBackup(t, []string{env.testdata}, BackupOptions{}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 2, "expected two snapshots, got %v", snapshotIDs)
+
+	_, snapmap := testRunSnapshots(t, env.gopts)
+	var oldest restic.ID
+	for id, sn := range snapmap {
+		if oldest.IsNull() || sn.Time.Before(snapmap[oldest].Time) {
+			oldest = id
+		}
+	}
+
+	rtest.Assert(t, runPin(PinOptions{}, env.gopts, nil, true) != nil,
+		"expected error when neither snapshot ID nor filter is given")
+	rtest.OK(t, runPin(PinOptions{}, env.gopts, []string{oldest.String()}, true))
+	testRunCheck(t, env.gopts)
+
+	_, snapmap = testRunSnapshots(t, env.gopts)
+	var pinned restic.ID
+	for id, sn := range snapmap {
+		if sn.Pinned {
+			pinned = id
+		}
+	}
+	rtest.Assert(t, *snapmap[pinned].Original == oldest, "wrong snapshot pinned")
+
+	// the policy must not remove the pinned snapshot
+	forgetOpts := ForgetOptions{Last: 1, MaxRemovePercent: 100}
+	rtest.OK(t, runForget(forgetOpts, env.gopts, nil))
+	snapshotIDs = testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 2, "pinned snapshot was removed, remaining %v", snapshotIDs)
+
+	// neither must removing it explicitly
+	err := runForget(ForgetOptions{}, env.gopts, []string{pinned.String()})
+	rtest.Assert(t, err == errAttention, "expected errAttention, got %v", err)
+	snapshotIDs = testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 2, "pinned snapshot was removed, remaining %v", snapshotIDs)
+
+	rtest.OK(t, runPin(PinOptions{}, env.gopts, []string{pinned.String()}, false))
+	rtest.OK(t, runForget(forgetOpts, env.gopts, nil))
+	snapshotIDs = testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot after unpin, got %v", snapshotIDs)
+}
+
 func testRunKeyListOtherIDs(t testing.TB, gopts GlobalOptions) []string {
 	buf := bytes.NewBuffer(nil)
 
@@ -753,7 +1195,7 @@ func testRunKeyListOtherIDs(t testing.TB, gopts GlobalOptions) []string {
 		globalOptions.stdout = os.Stdout
 	}()
 
-	rtest.OK(t, runKey(gopts, []string{"list"}))
+	rtest.OK(t, runKey(KeyOptions{}, gopts, []string{"list"}))
 
 	scanner := bufio.NewScanner(buf)
 	exp := regexp.MustCompile(`^ ([a-f0-9]+) `)
@@ -774,7 +1216,7 @@ func testRunKeyAddNewKey(t testing.TB, newPassword string, gopts GlobalOptions)
 		testKeyNewPassword = ""
 	}()
 
-	rtest.OK(t, runKey(gopts, []string{"add"}))
+	rtest.OK(t, runKey(KeyOptions{}, gopts, []string{"add"}))
 }
 
 func testRunKeyPasswd(t testing.TB, newPassword string, gopts GlobalOptions) {
@@ -783,13 +1225,13 @@ func testRunKeyPasswd(t testing.TB, newPassword string, gopts GlobalOptions) {
 		testKeyNewPassword = ""
 	}()
 
-	rtest.OK(t, runKey(gopts, []string{"passwd"}))
+	rtest.OK(t, runKey(KeyOptions{InsecureAllowWeakPassword: true}, gopts, []string{"passwd"}))
 }
 
 func testRunKeyRemove(t testing.TB, gopts GlobalOptions, IDs []string) {
 	t.Logf("remove %d keys: %q\n", len(IDs), IDs)
 	for _, id := range IDs {
-		rtest.OK(t, runKey(gopts, []string{"remove", id}))
+		rtest.OK(t, runKey(KeyOptions{}, gopts, []string{"remove", id}))
 	}
 }
 
@@ -804,6 +1246,11 @@ func TestKeyAddRemove(t *testing.T) {
 
 	testRunInit(t, env.gopts)
 
+	testKeyNewPassword = "password1"
+	rtest.Assert(t, runKey(KeyOptions{}, env.gopts, []string{"passwd"}) != nil,
+		"weak password was accepted")
+	testKeyNewPassword = ""
+
 	testRunKeyPasswd(t, "geheim2", env.gopts)
 	env.gopts.password = "geheim2"
 	t.Logf("changed password to %q", env.gopts.password)
@@ -817,7 +1264,7 @@ func TestKeyAddRemove(t *testing.T) {
 
 	env.gopts.password = passwordList[len(passwordList)-1]
 	t.Logf("testing access with last password %q\n", env.gopts.password)
-	rtest.OK(t, runKey(env.gopts, []string{"list"}))
+	rtest.OK(t, runKey(KeyOptions{}, env.gopts, []string{"list"}))
 	testRunCheck(t, env.gopts)
 }
 
@@ -1210,8 +1657,103 @@ func TestPrune(t *testing.T) {
 		"expected 3 snapshot, got %v", snapshotIDs)
 
 	testRunForget(t, env.gopts, firstSnapshot[0].String())
+
+	packsBefore := testRunList(t, "packs", env.gopts)
+	rtest.OK(t, runPrune(PruneOptions{DryRun: true}, env.gopts))
+	packsAfter := testRunList(t, "packs", env.gopts)
+	rtest.Assert(t, restic.NewIDSet(packsBefore...).Equals(restic.NewIDSet(packsAfter...)),
+		"prune --dry-run modified the repository: packs before %v, after %v", packsBefore, packsAfter)
+
+	// all packs have just been created, so nothing must be removed
+	rtest.OK(t, runPrune(PruneOptions{RepackMinAge: time.Hour}, env.gopts))
+	packsAfter = testRunList(t, "packs", env.gopts)
+	rtest.Assert(t, restic.NewIDSet(packsBefore...).Equals(restic.NewIDSet(packsAfter...)),
+		"prune --repack-min-age modified young packs: packs before %v, after %v", packsBefore, packsAfter)
+
+	testRunPrune(t, env.gopts)
+	testRunCheck(t, env.gopts)
+}
+
+func TestTrash(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	listTrash := func() []restic.TrashEntry {
+		repo, err := OpenRepository(env.gopts)
+		rtest.OK(t, err)
+		list, err := restic.ListTrash(env.gopts.ctx, repo.Backend())
+		rtest.OK(t, err)
+		return list
+	}
+
+	datadir := filepath.Join(env.base, "testdata")
+	rtest.OK(t, os.MkdirAll(datadir, 0755))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(datadir, "file"), rtest.Random(1, 1024*1024), 0600))
+	testRunBackup(t, []string{datadir}, BackupOptions{}, env.gopts)
+	firstSnapshot := testRunList(t, "snapshots", env.gopts)
+
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(datadir, "file"), rtest.Random(2, 1024*1024), 0600))
+	testRunBackup(t, []string{datadir}, BackupOptions{}, env.gopts)
+
+	testRunForget(t, env.gopts, firstSnapshot[0].String())
+	list := listTrash()
+	rtest.Equals(t, 1, len(list))
+	rtest.Equals(t, restic.Handle{Type: restic.SnapshotFile, Name: firstSnapshot[0].String()}, list[0].Handle)
+
 	testRunPrune(t, env.gopts)
+	list = listTrash()
+	packs := 0
+	for _, e := range list {
+		if e.Handle.Type == restic.DataFile {
+			packs++
+		}
+	}
+	rtest.Assert(t, packs > 0, "no pack files moved to the trash: %v", list)
+	rtest.Equals(t, len(list)-1, packs)
+	testRunCheck(t, env.gopts)
+
+	// the files have just been moved to the trash, so nothing is removed
+	rtest.OK(t, runPurgeTrash(PurgeTrashOptions{OlderThan: time.Hour}, env.gopts, nil))
+	rtest.Equals(t, len(list), len(listTrash()))
+
+	rtest.OK(t, runPurgeTrash(PurgeTrashOptions{}, env.gopts, nil))
+	rtest.Equals(t, 0, len(listTrash()))
+	testRunCheck(t, env.gopts)
+}
+
+func TestUndelete(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	datadir := filepath.Join(env.base, "testdata")
+	rtest.OK(t, os.MkdirAll(datadir, 0755))
+	data := rtest.Random(1, 1024*1024)
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(datadir, "file"), data, 0600))
+	testRunBackup(t, []string{datadir}, BackupOptions{}, env.gopts)
+	firstSnapshot := testRunList(t, "snapshots", env.gopts)
+
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(datadir, "file"), rtest.Random(2, 1024*1024), 0600))
+	testRunBackup(t, []string{datadir}, BackupOptions{}, env.gopts)
+
+	rtest.OK(t, runForget(ForgetOptions{Prune: true}, env.gopts, []string{firstSnapshot[0].String()}))
+	rtest.Equals(t, 1, len(testRunList(t, "snapshots", env.gopts)))
+
+	rtest.Assert(t, runUndelete(UndeleteOptions{}, env.gopts, []string{"1234"}) != nil,
+		"no error for a snapshot which is not in the trash")
+
+	rtest.OK(t, runUndelete(UndeleteOptions{}, env.gopts, []string{firstSnapshot[0].Str()}))
+	rtest.Equals(t, 2, len(testRunList(t, "snapshots", env.gopts)))
 	testRunCheck(t, env.gopts)
+
+	restoredir := filepath.Join(env.base, "restore")
+	testRunRestore(t, env.gopts, restoredir, firstSnapshot[0])
+	buf, err := ioutil.ReadFile(filepath.Join(restoredir, "testdata", "file"))
+	rtest.OK(t, err)
+	rtest.Assert(t, bytes.Equal(data, buf), "restored file has wrong content")
 }
 
 func TestHardLink(t *testing.T) {
@@ -1311,3 +1853,67 @@ func linkEqual(source, dest []string) bool {
 
 	return true
 }
+
+func TestExportImport(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	fd, err := os.Open(datafile)
+	if os.IsNotExist(errors.Cause(err)) {
+		t.Skipf("unable to find data file %q, skipping", datafile)
+		return
+	}
+	rtest.OK(t, err)
+	rtest.OK(t, fd.Close())
+
+	testRunInit(t, env.gopts)
+
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+	testRunBackup(t, []string{filepath.Join(env.testdata, "0", "0", "2")}, BackupOptions{}, env.gopts)
+	testRunBackup(t, []string{filepath.Join(env.testdata, "0", "0", "3")}, BackupOptions{}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+
+	archiveFile := filepath.Join(env.base, "export.tar")
+	rtest.OK(t, runExport(ExportOptions{Output: archiveFile}, env.gopts, []string{snapshotIDs[0].String()}))
+
+	gopts2 := env.gopts
+	gopts2.Repo = filepath.Join(env.base, "repo2")
+	testRunInit(t, gopts2)
+
+	rtest.OK(t, runImport(gopts2, []string{archiveFile}))
+	imported := testRunList(t, "snapshots", gopts2)
+	rtest.Assert(t, len(imported) == 1,
+		"expected one imported snapshot, got %v", imported)
+	testRunCheck(t, gopts2)
+
+	// importing the same archive again must not add anything
+	rtest.OK(t, runImport(gopts2, []string{archiveFile}))
+	imported = testRunList(t, "snapshots", gopts2)
+	rtest.Assert(t, len(imported) == 1,
+		"expected one snapshot after importing twice, got %v", imported)
+
+	restoredir := filepath.Join(env.base, "restore")
+	testRunRestore(t, gopts2, restoredir, imported[0])
+
+	repo, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+	sn, err := restic.LoadSnapshot(env.gopts.ctx, repo, snapshotIDs[0])
+	rtest.OK(t, err)
+	name := filepath.Base(sn.Paths[0])
+	rtest.Assert(t, directoriesEqualContents(filepath.Join(env.testdata, "0", "0", name), filepath.Join(restoredir, name)),
+		"directories are not equal")
+
+	// export the other snapshot split into volumes
+	volumeIndex := filepath.Join(env.base, "export-volumes.tar")
+	rtest.OK(t, runExport(ExportOptions{Output: volumeIndex, VolumeSize: 1}, env.gopts, []string{snapshotIDs[1].String()}))
+	volumes, err := filepath.Glob(volumeIndex + ".*")
+	rtest.OK(t, err)
+	rtest.Assert(t, len(volumes) > 1, "expected several volumes, got %v", volumes)
+
+	rtest.OK(t, runImport(gopts2, []string{volumeIndex}))
+	imported = testRunList(t, "snapshots", gopts2)
+	rtest.Assert(t, len(imported) == 2,
+		"expected two imported snapshots, got %v", imported)
+	testRunCheck(t, gopts2)
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/options"
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/status"
 
 	"github.com/spf13/cobra"
 
@@ -36,6 +37,9 @@ directories in an encrypted repository stored on different backends.
 			return err
 		}
 		globalOptions.extended = opts
+		if _, err := parseNotifyLevel(globalOptions.Notify); err != nil {
+			return err
+		}
 		if c.Name() == "version" {
 			return nil
 		}
@@ -46,6 +50,18 @@ directories in an encrypted repository stored on different backends.
 		}
 		globalOptions.password = pwd
 
+		if globalOptions.StatusSocket != "" {
+			statusServer, err = status.Listen(globalOptions.StatusSocket)
+			if err != nil {
+				return errors.Fatalf("unable to create status socket: %v", err)
+			}
+			AddCleanupHandler(statusServer.Close)
+		}
+
+		if globalOptions.ShowUsage {
+			AddCleanupHandler(reportBackendUsage)
+		}
+
 		// run the debug functions for all subcommands (if build tag "debug" is
 		// enabled)
 		if err := runDebug(); err != nil {
@@ -56,6 +72,15 @@ directories in an encrypted repository stored on different backends.
 	},
 }
 
+// errAttention is returned by commands which completed successfully but found
+// something the user should look at, the warnings have already been printed.
+// restic exits with status 3 in this case.
+var errAttention = errors.New("attention required")
+
+// statusServer sends the progress to the clients of the status socket, it is
+// nil unless --status-socket is used.
+var statusServer *status.Server
+
 var logBuffer = bytes.NewBuffer(nil)
 
 func init() {
@@ -68,9 +93,10 @@ func main() {
 	debug.Log("main %#v", os.Args)
 	debug.Log("restic %s, compiled with %v on %v/%v",
 		version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
-	err := cmdRoot.Execute()
+	cmd, err := cmdRoot.ExecuteC()
 
 	switch {
+	case err == errAttention:
 	case restic.IsAlreadyLocked(errors.Cause(err)):
 		fmt.Fprintf(os.Stderr, "%v\nthe `unlock` command can be used to remove stale locks\n", err)
 	case errors.IsFatal(errors.Cause(err)):
@@ -87,8 +113,15 @@ func main() {
 		}
 	}
 
+	if cmd != nil && cmd != cmdRoot && cmd.Name() != "version" && cmd.Name() != "help" {
+		notifyResult(globalOptions, cmd.Name(), err)
+	}
+
 	var exitCode int
-	if err != nil {
+	switch {
+	case err == errAttention:
+		exitCode = 3
+	case err != nil:
 		exitCode = 1
 	}
 
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// notifyLevel selects the runs for which a desktop notification is shown.
+type notifyLevel int
+
+const (
+	notifyNever notifyLevel = iota
+	// notifyError shows a notification when a command fails.
+	notifyError
+	// notifyAttention additionally shows a notification when a command
+	// completed, but found something the user should look at.
+	notifyAttention
+	// notifyAll shows a notification for every run.
+	notifyAll
+)
+
+// parseNotifyLevel parses the value of --notify.
+func parseNotifyLevel(s string) (notifyLevel, error) {
+	switch s {
+	case "":
+		return notifyNever, nil
+	case "error":
+		return notifyError, nil
+	case "attention":
+		return notifyAttention, nil
+	case "all":
+		return notifyAll, nil
+	}
+
+	return notifyNever, errors.Fatalf("invalid value %q for --notify, use error, attention or all", s)
+}
+
+// notification returns the title and the message of the notification for
+// the result err of the command name, and whether it is shown at level.
+func notification(level notifyLevel, name string, err error) (title, message string, show bool) {
+	switch {
+	case err == nil:
+		return fmt.Sprintf("restic %v completed", name), "The command completed successfully.", level >= notifyAll
+	case err == errAttention:
+		return fmt.Sprintf("restic %v needs attention", name), "The command completed with warnings, please check its output.", level >= notifyAttention
+	default:
+		// the first line of the error is enough for a notification
+		message = strings.SplitN(err.Error(), "\n", 2)[0]
+		return fmt.Sprintf("restic %v failed", name), message, level >= notifyError
+	}
+}
+
+// notifyResult shows a desktop notification for the result err of the
+// command name, if requested by --notify.
+func notifyResult(gopts GlobalOptions, name string, err error) {
+	level, perr := parseNotifyLevel(gopts.Notify)
+	if perr != nil {
+		return
+	}
+
+	title, message, show := notification(level, name, err)
+	if !show {
+		return
+	}
+
+	debug.Log("showing notification %q: %v", title, message)
+	if nerr := showNotification(title, message, err != nil && err != errAttention); nerr != nil {
+		Warnf("unable to show notification: %v\n", nerr)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os/exec"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// notifyScript displays a notification with the title and the message passed
+// as arguments, so that they do not need to be quoted.
+var notifyScript = []string{
+	"on run argv",
+	"display notification (item 2 of argv) with title (item 1 of argv)",
+	"end run",
+}
+
+// showNotification shows a notification in the macOS notification center.
+func showNotification(title, message string, urgent bool) error {
+	var args []string
+	for _, line := range notifyScript {
+		args = append(args, "-e", line)
+	}
+	args = append(args, title, message)
+
+	out, err := exec.Command("osascript", args...).CombinedOutput()
+	if err != nil {
+		return errors.Errorf("osascript: %v: %s", err, out)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNotification(t *testing.T) {
+	failed := errors.New("unable to open repository\nmore details")
+
+	var tests = []struct {
+		level   string
+		err     error
+		show    bool
+		title   string
+		message string
+	}{
+		{"", failed, false, "restic backup failed", "unable to open repository"},
+		{"error", failed, true, "restic backup failed", "unable to open repository"},
+		{"error", errAttention, false, "restic backup needs attention", ""},
+		{"error", nil, false, "restic backup completed", ""},
+		{"attention", errAttention, true, "restic backup needs attention", ""},
+		{"attention", nil, false, "restic backup completed", ""},
+		{"all", failed, true, "restic backup failed", "unable to open repository"},
+		{"all", nil, true, "restic backup completed", ""},
+	}
+
+	for _, test := range tests {
+		level, err := parseNotifyLevel(test.level)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		title, message, show := notification(level, "backup", test.err)
+		if show != test.show {
+			t.Errorf("level %q, error %v: want show %v, got %v", test.level, test.err, test.show, show)
+		}
+		if title != test.title {
+			t.Errorf("level %q, error %v: want title %q, got %q", test.level, test.err, test.title, title)
+		}
+		if test.message != "" && message != test.message {
+			t.Errorf("level %q, error %v: want message %q, got %q", test.level, test.err, test.message, message)
+		}
+	}
+
+	if _, err := parseNotifyLevel("warning"); err == nil {
+		t.Errorf("invalid level accepted")
+	}
+}
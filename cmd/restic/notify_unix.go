@@ -0,0 +1,24 @@
+// +build !windows,!darwin
+
+package main
+
+import (
+	"os/exec"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// showNotification shows a desktop notification with notify-send, which
+// talks to the notification daemon of the desktop session.
+func showNotification(title, message string, urgent bool) error {
+	urgency := "normal"
+	if urgent {
+		urgency = "critical"
+	}
+
+	out, err := exec.Command("notify-send", "--app-name=restic", "--urgency="+urgency, title, message).CombinedOutput()
+	if err != nil {
+		return errors.Errorf("notify-send: %v: %s", err, out)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// notifyScript shows a balloon notification with the title and the message
+// passed in environment variables, so that they do not need to be quoted.
+const notifyScript = `Add-Type -AssemblyName System.Windows.Forms, System.Drawing
+$n = New-Object System.Windows.Forms.NotifyIcon
+$n.Icon = [System.Drawing.SystemIcons]::Information
+if ($env:RESTIC_NOTIFY_ICON -eq "Error") { $n.Icon = [System.Drawing.SystemIcons]::Error }
+$n.Visible = $true
+$n.ShowBalloonTip(10000, $env:RESTIC_NOTIFY_TITLE, $env:RESTIC_NOTIFY_MESSAGE, $env:RESTIC_NOTIFY_ICON)
+Start-Sleep -Seconds 10
+$n.Dispose()`
+
+// showNotification shows a notification in the notification area.
+func showNotification(title, message string, urgent bool) error {
+	icon := "Info"
+	if urgent {
+		icon = "Error"
+	}
+
+	cmd := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-WindowStyle", "Hidden", "-Command", notifyScript)
+	cmd.Env = append(os.Environ(),
+		"RESTIC_NOTIFY_TITLE="+title,
+		"RESTIC_NOTIFY_MESSAGE="+message,
+		"RESTIC_NOTIFY_ICON="+icon,
+	)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.Errorf("powershell: %v: %s", err, out)
+	}
+	return nil
+}
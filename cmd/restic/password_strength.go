@@ -0,0 +1,219 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+const (
+	// minPasswordBits is the estimated entropy below which a new password is
+	// refused, unless --insecure-allow-weak-password is given.
+	minPasswordBits = 28
+
+	// recommendedPasswordBits is the estimated entropy below which a warning
+	// is printed for a new password.
+	recommendedPasswordBits = 50
+)
+
+// commonPasswords contains some of the most frequent passwords found in
+// leaked password lists, most frequent first.
+var commonPasswords = []string{
+	"123456", "password", "12345678", "qwerty", "123456789", "12345", "1234",
+	"111111", "1234567", "dragon", "123123", "baseball", "abc123", "football",
+	"monkey", "letmein", "696969", "shadow", "master", "666666", "qwertyuiop",
+	"123321", "mustang", "1234567890", "michael", "654321", "superman",
+	"1qaz2wsx", "7777777", "121212", "000000", "qazwsx", "123qwe", "killer",
+	"trustno1", "jordan", "jennifer", "zxcvbnm", "asdfgh", "hunter", "buster",
+	"soccer", "harley", "batman", "andrew", "tigger", "sunshine", "iloveyou",
+	"fuckme", "2000", "charlie", "robert", "thomas", "hockey", "ranger",
+	"daniel", "starwars", "klaster", "112233", "george", "computer", "michelle",
+	"jessica", "pepper", "1111", "zxcvbn", "555555", "11111111", "131313",
+	"freedom", "777777", "pass", "maggie", "159753", "aaaaaa", "ginger",
+	"princess", "joshua", "cheese", "amanda", "summer", "love", "ashley",
+	"nicole", "chelsea", "biteme", "matthew", "access", "yankees", "987654321",
+	"dallas", "austin", "thunder", "taylor", "matrix", "admin", "welcome",
+	"login", "secret", "passw0rd", "changeme", "default", "root", "test",
+	"guest", "winter", "hello", "whatever", "cookie", "flower", "internet",
+	"pokemon", "backup", "restic", "passwort", "geheim", "hallo", "motdepasse",
+}
+
+// keyboardRows contains the rows of common keyboard layouts, for detecting
+// passwords like "asdfgh".
+var keyboardRows = []string{
+	"qwertyuiop", "asdfghjkl", "zxcvbnm", "qwertzuiop", "yxcvbnm", "azertyuiop",
+	"qsdfghjklm", "wxcvbn", "1234567890", "!@#$%^&*()",
+}
+
+// leetReplacements maps characters commonly used instead of letters back to
+// the letters.
+var leetReplacements = strings.NewReplacer(
+	"0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s", "!", "i",
+)
+
+// passwordCardinality returns the size of the alphabet an attacker needs to
+// try for a password which uses the same classes of characters as pw.
+func passwordCardinality(pw []rune) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range pw {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	var n float64
+	for _, c := range []struct {
+		used bool
+		size float64
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if c.used {
+			n += c.size
+		}
+	}
+	return n
+}
+
+// matchDictionary returns the length of the longest common password which
+// starts at the beginning of s, and the number of bits needed to guess it.
+func matchDictionary(s string) (n int, bits float64) {
+	lower := strings.ToLower(s)
+	plain := leetReplacements.Replace(lower)
+
+	for rank, word := range commonPasswords {
+		if len(word) <= n || len(word) < 3 {
+			continue
+		}
+
+		var extra float64
+		switch {
+		case strings.HasPrefix(lower, word):
+		case len(plain) == len(lower) && strings.HasPrefix(plain, word):
+			// one bit for the replacements
+			extra = 1
+		default:
+			continue
+		}
+
+		if len(s) >= len(word) && lower[:len(word)] != s[:len(word)] {
+			// one bit for upper case letters
+			extra++
+		}
+
+		n = len(word)
+		bits = math.Log2(float64(rank+1)) + extra
+	}
+
+	return n, bits
+}
+
+// matchPattern returns the length of a repeated character, a sequence like
+// "abcd" or "4321" or a keyboard row at the beginning of pw, and the number of
+// bits needed to guess it.
+func matchPattern(pw []rune, cardinality float64) (n int, bits float64) {
+	// repeated character
+	for n = 1; n < len(pw) && pw[n] == pw[0]; n++ {
+	}
+	if n >= 3 {
+		return n, math.Log2(cardinality) + math.Log2(float64(n))
+	}
+
+	// sequence with a constant step of one
+	if len(pw) >= 3 {
+		delta := pw[1] - pw[0]
+		if delta == 1 || delta == -1 {
+			for n = 2; n < len(pw) && pw[n]-pw[n-1] == delta; n++ {
+			}
+			if n >= 3 {
+				return n, math.Log2(26) + math.Log2(float64(n)) + 1
+			}
+		}
+	}
+
+	// keyboard row
+	lower := strings.ToLower(string(pw))
+	n = 0
+	for _, row := range keyboardRows {
+		for i := range row {
+			l := 0
+			for l < len(row)-i && l < len(lower) && lower[l] == row[i+l] {
+				l++
+			}
+			if l > n {
+				n = l
+			}
+		}
+	}
+	if n >= 4 {
+		return n, math.Log2(float64(len(keyboardRows)*10)) + math.Log2(float64(n))
+	}
+
+	return 0, 0
+}
+
+// estimatePasswordBits estimates the entropy of pw in bits, similar to
+// zxcvbn: common passwords, repeated characters, sequences and keyboard rows
+// only count as much as it takes to guess them, all other characters count as
+// random characters from the classes used in the password. The second return
+// value is true if pw is one of the common passwords.
+func estimatePasswordBits(pw string) (bits float64, common bool) {
+	runes := []rune(pw)
+	cardinality := passwordCardinality(runes)
+
+	for i := 0; i < len(runes); {
+		n, b := matchDictionary(string(runes[i:]))
+		if n == len(runes) {
+			common = true
+		}
+
+		if pn, pb := matchPattern(runes[i:], cardinality); pn > n {
+			n, b = pn, pb
+		}
+
+		if n == 0 {
+			n, b = 1, math.Log2(cardinality)
+		}
+
+		bits += b
+		i += n
+	}
+
+	return bits, common
+}
+
+// checkPasswordStrength returns an error if pw is too weak to be used as a
+// repository password, unless allowWeak is set. For passwords which are not
+// refused but still weak, a warning is printed.
+func checkPasswordStrength(pw string, allowWeak bool) error {
+	bits, common := estimatePasswordBits(pw)
+
+	var reason string
+	if common {
+		reason = ", it is one of the most common passwords found in leaked password lists"
+	}
+
+	if bits < minPasswordBits {
+		if !allowWeak {
+			return errors.Fatalf("the password is too weak (about %.0f bits of entropy%s), please use a longer password or pass --insecure-allow-weak-password", bits, reason)
+		}
+
+		Warnf("WARNING: the password is very weak (about %.0f bits of entropy%s)\n", bits, reason)
+		return nil
+	}
+
+	if bits < recommendedPasswordBits {
+		Warnf("the password is weak (about %.0f bits of entropy), consider using a longer passphrase\n", bits)
+	}
+
+	return nil
+}
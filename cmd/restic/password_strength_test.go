@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCheckPasswordStrength(t *testing.T) {
+	var tests = []struct {
+		password string
+		weak     bool
+	}{
+		{"", true},
+		{"password", true},
+		{"Passw0rd", true},
+		{"geheim", true},
+		{"aaaaaaaaaaaa", true},
+		{"abcdefghijkl", true},
+		{"qwertyuiop123456", true},
+		{"x7!Q", true},
+		{"rEx7!pq", false},
+		{"correct horse battery staple", false},
+		{"OnnyiasyatvodsEvVodyawit", false},
+		{"raicneirvOjEfEigonOmLasOd", false},
+	}
+
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			err := checkPasswordStrength(test.password, false)
+			if test.weak && err == nil {
+				t.Errorf("password %q was not refused", test.password)
+			}
+			if !test.weak && err != nil {
+				t.Errorf("password %q was refused: %v", test.password, err)
+			}
+
+			err = checkPasswordStrength(test.password, true)
+			if err != nil {
+				t.Errorf("password %q was refused with allowWeak: %v", test.password, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io/ioutil"
+	"strconv"
+	"syscall"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+const (
+	ioprioClassShift = 13
+	ioprioWhoProcess = 1
+
+	// maxNice is the lowest CPU priority.
+	maxNice = 19
+)
+
+// threadIDs returns the IDs of all threads of the current process. If they
+// cannot be determined, only the calling thread (0) is returned.
+func threadIDs() []int {
+	entries, err := ioutil.ReadDir("/proc/self/task")
+	if err != nil {
+		debug.Log("unable to list threads: %v", err)
+		return []int{0}
+	}
+
+	tids := make([]int, 0, len(entries))
+	for _, entry := range entries {
+		tid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		tids = append(tids, tid)
+	}
+
+	return tids
+}
+
+// lowerNice adds n to the nice value of the thread tid, like the nice
+// command does.
+func lowerNice(tid, n int) error {
+	// the system call returns 20-nice, so that the result is never negative
+	prio, err := syscall.Getpriority(syscall.PRIO_PROCESS, tid)
+	if err != nil {
+		return errors.Wrap(err, "Getpriority")
+	}
+
+	nice := 20 - prio + n
+	if nice > maxNice {
+		nice = maxNice
+	}
+
+	return errors.Wrap(syscall.Setpriority(syscall.PRIO_PROCESS, tid, nice), "Setpriority")
+}
+
+// setPriority lowers the CPU and I/O priority of the process. On Linux, both
+// are set per thread, so they are applied to all threads of the process. New
+// threads inherit the priority of the thread which creates them.
+func setPriority(nice, ioClass, ioLevel int) error {
+	for _, tid := range threadIDs() {
+		if nice != 0 {
+			err := lowerNice(tid, nice)
+			if err != nil {
+				return err
+			}
+		}
+
+		if ioClass != 0 {
+			prio := ioClass<<ioprioClassShift | ioLevel
+			_, _, e := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), uintptr(prio))
+			if e != 0 {
+				return errors.Wrap(e, "ioprio_set")
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,14 @@
+// +build !linux,!windows,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package main
+
+import "github.com/restic/restic/internal/errors"
+
+// setPriority is not supported on this platform.
+func setPriority(nice, ioClass, ioLevel int) error {
+	if nice != 0 || ioClass != 0 {
+		return errors.New("setting the priority is not supported on this platform")
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package main
+
+import (
+	"syscall"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// maxNice is the lowest CPU priority.
+const maxNice = 20
+
+// setPriority lowers the CPU priority of the process by adding nice to the
+// current nice value, like the nice command does. Setting the I/O priority
+// is not supported.
+func setPriority(nice, ioClass, ioLevel int) error {
+	if ioClass != 0 {
+		return errors.New("setting the I/O priority is not supported on this platform")
+	}
+
+	if nice == 0 {
+		return nil
+	}
+
+	cur, err := syscall.Getpriority(syscall.PRIO_PROCESS, 0)
+	if err != nil {
+		return errors.Wrap(err, "Getpriority")
+	}
+
+	nice += cur
+	if nice > maxNice {
+		nice = maxNice
+	}
+
+	return errors.Wrap(syscall.Setpriority(syscall.PRIO_PROCESS, 0, nice), "Setpriority")
+}
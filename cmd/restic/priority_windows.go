@@ -0,0 +1,44 @@
+package main
+
+import (
+	"syscall"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+const (
+	belowNormalPriorityClass   = 0x00004000
+	processModeBackgroundBegin = 0x00100000
+)
+
+var procSetPriorityClass = syscall.NewLazyDLL("kernel32.dll").NewProc("SetPriorityClass")
+
+func setPriorityClass(class uintptr) error {
+	handle, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return errors.Wrap(err, "GetCurrentProcess")
+	}
+
+	r, _, err := procSetPriorityClass.Call(uintptr(handle), class)
+	if r == 0 {
+		return errors.Wrap(err, "SetPriorityClass")
+	}
+
+	return nil
+}
+
+// setPriority lowers the priority of the process. When an I/O priority is
+// requested, the process is put into background mode, which lowers the CPU,
+// I/O and memory priority. Otherwise, a nice value larger than zero selects
+// the below normal priority class.
+func setPriority(nice, ioClass, ioLevel int) error {
+	if ioClass != 0 {
+		return setPriorityClass(processModeBackgroundBegin)
+	}
+
+	if nice > 0 {
+		return setPriorityClass(belowNormalPriorityClass)
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+// +build go1.16
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// capDacReadSearch allows reading all files and listing all directories
+	// regardless of their permissions.
+	capDacReadSearch = 2
+	// capSetpcap allows changing the capability bounding set.
+	capSetpcap = 8
+
+	// capLast is larger than the highest capability supported by any kernel,
+	// PR_CAPBSET_DROP fails with EINVAL for capabilities which do not exist.
+	capLast = 63
+
+	linuxCapabilityVersion3 = 0x20080522
+)
+
+type capHeader struct {
+	version uint32
+	pid     int32
+}
+
+type capData struct {
+	effective   uint32
+	permitted   uint32
+	inheritable uint32
+}
+
+// allThreadsPrctl calls prctl for all threads of the process, capabilities
+// and the no_new_privs flag are attributes of a thread.
+func allThreadsPrctl(option, arg uintptr) error {
+	_, _, e := syscall.AllThreadsSyscall6(unix.SYS_PRCTL, option, arg, 0, 0, 0, 0)
+	if e != 0 {
+		return e
+	}
+	return nil
+}
+
+// dropPrivileges removes all capabilities of the process except
+// CAP_DAC_READ_SEARCH, which is needed to read all files for the backup. The
+// user ID is not changed, so files created by the process (e.g. in the cache)
+// still belong to the same user. This also means that a process running as
+// root can still modify all files owned by root whose permissions allow
+// writing for the owner. Commands started afterwards, e.g. for probes, cannot
+// regain any privileges.
+func dropPrivileges() error {
+	err := allThreadsPrctl(unix.PR_SET_NO_NEW_PRIVS, 1)
+	if err == syscall.ENOTSUP {
+		// AllThreadsSyscall is not available for binaries using cgo
+		return errors.Fatal("dropping privileges is not supported by this restic binary (built with cgo)")
+	}
+	if err != nil {
+		return errors.Wrap(err, "prctl(PR_SET_NO_NEW_PRIVS)")
+	}
+
+	hdr := capHeader{version: linuxCapabilityVersion3}
+	var data [2]capData
+	_, _, e := syscall.RawSyscall(unix.SYS_CAPGET, uintptr(unsafe.Pointer(&hdr)), uintptr(unsafe.Pointer(&data[0])), 0)
+	if e != 0 {
+		return errors.Wrap(e, "capget")
+	}
+
+	// the bounding set can only be changed while CAP_SETPCAP is effective,
+	// processes without it have nothing to drop there
+	if data[0].effective&(1<<capSetpcap) != 0 {
+		for c := uintptr(0); c <= capLast; c++ {
+			if c == capDacReadSearch {
+				continue
+			}
+
+			err = allThreadsPrctl(unix.PR_CAPBSET_DROP, c)
+			if err == syscall.EINVAL {
+				// c is not supported by the kernel, and neither are all following
+				break
+			}
+			if err != nil {
+				return errors.Wrapf(err, "prctl(PR_CAPBSET_DROP, %d)", c)
+			}
+		}
+	}
+
+	err = allThreadsPrctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL)
+	if err != nil && err != syscall.EINVAL {
+		return errors.Wrap(err, "prctl(PR_CAP_AMBIENT_CLEAR_ALL)")
+	}
+
+	const keep = 1 << capDacReadSearch
+	data[0].effective &= keep
+	data[0].permitted &= keep
+	data[0].inheritable = 0
+	data[1] = capData{}
+
+	_, _, e = syscall.AllThreadsSyscall(unix.SYS_CAPSET, uintptr(unsafe.Pointer(&hdr)), uintptr(unsafe.Pointer(&data[0])), 0)
+	if e != 0 {
+		return errors.Wrap(e, "capset")
+	}
+
+	debug.Log("dropped privileges, CAP_DAC_READ_SEARCH is kept: %v", data[0].permitted&keep != 0)
+	return nil
+}
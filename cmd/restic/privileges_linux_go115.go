@@ -0,0 +1,11 @@
+// +build !go1.16
+
+package main
+
+import "github.com/restic/restic/internal/errors"
+
+// dropPrivileges needs syscall.AllThreadsSyscall to change the capabilities
+// of all threads, which is only available since Go 1.16.
+func dropPrivileges() error {
+	return errors.Fatal("dropping privileges requires restic to be built with Go 1.16 or newer")
+}
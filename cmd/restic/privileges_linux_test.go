@@ -0,0 +1,100 @@
+// +build go1.16
+
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// dropPrivilegesEnv is set for the test binary started by
+// TestDropPrivileges, which then drops its privileges in
+// TestDropPrivilegesHelper.
+const dropPrivilegesEnv = "RESTIC_TEST_DROP_PRIVILEGES_DIR"
+
+// effectiveCapabilities returns the effective capabilities of the process.
+func effectiveCapabilities(t testing.TB) uint64 {
+	f, err := os.Open("/proc/self/status")
+	rtest.OK(t, err)
+	defer func() {
+		_ = f.Close()
+	}()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if !strings.HasPrefix(line, "CapEff:") {
+			continue
+		}
+
+		caps, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "CapEff:")), 16, 64)
+		rtest.OK(t, err)
+		return caps
+	}
+	rtest.OK(t, sc.Err())
+
+	t.Fatal("CapEff not found in /proc/self/status")
+	return 0
+}
+
+func TestDropPrivilegesHelper(t *testing.T) {
+	dir := os.Getenv(dropPrivilegesEnv)
+	if dir == "" {
+		t.Skip("only run by TestDropPrivileges")
+	}
+
+	err := dropPrivileges()
+	if err != nil && strings.Contains(err.Error(), "cgo") {
+		t.Skip(err)
+	}
+	rtest.OK(t, err)
+
+	rtest.Equals(t, uint64(1<<capDacReadSearch), effectiveCapabilities(t))
+
+	// the user ID is not changed
+	rtest.Equals(t, 0, os.Getuid())
+
+	// files owned by other users cannot be modified any more, but still read
+	other := filepath.Join(dir, "other")
+	rtest.Assert(t, ioutil.WriteFile(other, []byte("foo"), 0644) != nil, "file of another user was modified")
+	rtest.Assert(t, os.Chown(other, 0, 0) != nil, "file of another user was chowned")
+	buf, err := ioutil.ReadFile(other)
+	rtest.OK(t, err)
+	rtest.Equals(t, "other", string(buf))
+
+	// files owned by root are still writable
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "root"), []byte("foo"), 0600))
+}
+
+func TestDropPrivileges(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("test requires root")
+	}
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	// a file which is only readable for its owner, and a directory which
+	// root can write to without CAP_DAC_OVERRIDE
+	other := filepath.Join(tempdir, "other")
+	rtest.OK(t, ioutil.WriteFile(other, []byte("other"), 0400))
+	rtest.OK(t, os.Chown(other, 1000, 1000))
+	rtest.OK(t, os.Chmod(tempdir, 0755))
+
+	// dropping privileges cannot be undone, so it is tested in a new process
+	cmd := exec.Command(os.Args[0], "-test.run=^TestDropPrivilegesHelper$", "-test.v")
+	cmd.Env = append(os.Environ(), dropPrivilegesEnv+"="+tempdir)
+	out, err := cmd.CombinedOutput()
+	t.Logf("output:\n%s", out)
+	rtest.OK(t, err)
+	rtest.Assert(t, strings.Contains(string(out), "--- PASS: TestDropPrivilegesHelper") ||
+		strings.Contains(string(out), "--- SKIP: TestDropPrivilegesHelper"), "helper did not run")
+}
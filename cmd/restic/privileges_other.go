@@ -0,0 +1,10 @@
+// +build !linux
+
+package main
+
+import "github.com/restic/restic/internal/errors"
+
+// dropPrivileges is not supported on this platform.
+func dropPrivileges() error {
+	return errors.Fatal("dropping privileges is only supported on Linux")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// probe is a command which is run before a backup, its output is stored as a
+// label in the snapshot.
+type probe struct {
+	name    string
+	command string
+}
+
+// parseProbes parses probes in the form "name=command".
+func parseProbes(list []string) ([]probe, error) {
+	probes := make([]probe, 0, len(list))
+	seen := make(map[string]struct{})
+
+	for _, s := range list {
+		data := strings.SplitN(s, "=", 2)
+		if len(data) != 2 || strings.TrimSpace(data[0]) == "" || strings.TrimSpace(data[1]) == "" {
+			return nil, errors.Fatalf("invalid probe %q, must be name=command", s)
+		}
+
+		name := strings.TrimSpace(data[0])
+		if _, ok := seen[name]; ok {
+			return nil, errors.Fatalf("probe %q specified more than once", name)
+		}
+		seen[name] = struct{}{}
+
+		probes = append(probes, probe{name: name, command: data[1]})
+	}
+
+	return probes, nil
+}
+
+// shellCommand returns a command which runs command with the shell of the
+// operating system.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// runProbes runs all probes and returns their output as labels. The output is
+// trimmed of surrounding white space. A probe which exits with a non-zero
+// status does not add a label, a warning is printed instead.
+func runProbes(ctx context.Context, probes []probe) map[string]string {
+	if len(probes) == 0 {
+		return nil
+	}
+
+	labels := make(map[string]string, len(probes))
+	for _, p := range probes {
+		debug.Log("run probe %v: %q", p.name, p.command)
+
+		var stdout bytes.Buffer
+		cmd := shellCommand(ctx, p.command)
+		cmd.Stdout = &stdout
+		cmd.Stderr = os.Stderr
+
+		err := cmd.Run()
+		if err != nil {
+			Warnf("probe %v failed: %v\n", p.name, err)
+			continue
+		}
+
+		labels[p.name] = strings.TrimSpace(stdout.String())
+	}
+
+	return labels
+}
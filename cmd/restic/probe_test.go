@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestParseProbes(t *testing.T) {
+	probes, err := parseProbes([]string{"version=git describe", " lsn = psql -c 'select 1=1'"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []probe{
+		{name: "version", command: "git describe"},
+		{name: "lsn", command: " psql -c 'select 1=1'"},
+	}
+	if !reflect.DeepEqual(probes, want) {
+		t.Errorf("wrong probes, want %v, got %v", want, probes)
+	}
+
+	for _, list := range [][]string{
+		{"version"},
+		{"=git describe"},
+		{"version="},
+		{"a=true", "a=false"},
+	} {
+		if _, err := parseProbes(list); err == nil {
+			t.Errorf("%q: expected an error", list)
+		}
+	}
+}
+
+func TestRunProbes(t *testing.T) {
+	probes := []probe{
+		{name: "version", command: "echo v1.2.3"},
+		{name: "failed", command: "exit 3"},
+	}
+
+	labels := runProbes(context.TODO(), probes)
+
+	want := map[string]string{"version": "v1.2.3"}
+	if !reflect.DeepEqual(labels, want) {
+		t.Errorf("wrong labels, want %v, got %v", want, labels)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/backend/sftp"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// scanCommand returns a function which scans restored files by running the
+// command, which is split like the sftp command, with the path of the file appended as the last argument. Exit code
+// 0 accepts the file, 1 rejects or quarantines it, as reported by virus
+// scanners like clamscan. Other exit codes are errors.
+func scanCommand(command string) (restic.ScanFunc, error) {
+	name, args, err := sftp.SplitShellArgs(command)
+	if err != nil {
+		return nil, errors.Fatalf("invalid scan command: %v", err)
+	}
+
+	return func(ctx context.Context, location, path string) (restic.ScanVerdict, string, error) {
+		cmd := exec.CommandContext(ctx, name, append(args, path)...)
+		var out bytes.Buffer
+		cmd.Stdout = &out
+		cmd.Stderr = &out
+
+		err := cmd.Run()
+		if err == nil {
+			return restic.ScanAccept, "", nil
+		}
+
+		reason := strings.TrimSpace(out.String())
+		if ee, ok := err.(*exec.ExitError); ok && ee.ExitCode() == 1 {
+			debug.Log("scan command rejected %v: %v", location, reason)
+			return restic.ScanQuarantine, reason, nil
+		}
+
+		return restic.ScanReject, "", errors.Errorf("%v: %v: %s", name, err, reason)
+	}, nil
+}
+
+// scanSocketTimeout is the time the scanner listening on a unix socket may
+// take for a file.
+const scanSocketTimeout = 10 * time.Minute
+
+// scanSocket returns a function which asks a scanner listening on the unix
+// socket about restored files. For each file a new connection is opened, the
+// absolute path of the file is sent, followed by a newline. The scanner
+// answers with a single line: "OK" accepts the file, "REJECT reason" removes
+// it and "QUARANTINE reason" moves it to the quarantine directory.
+func scanSocket(socket string) restic.ScanFunc {
+	return func(ctx context.Context, location, path string) (restic.ScanVerdict, string, error) {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "unix", socket)
+		if err != nil {
+			return restic.ScanReject, "", errors.Wrap(err, "Dial")
+		}
+		defer conn.Close()
+
+		_ = conn.SetDeadline(time.Now().Add(scanSocketTimeout))
+
+		if _, err := fmt.Fprintf(conn, "%s\n", path); err != nil {
+			return restic.ScanReject, "", errors.Wrap(err, "Write")
+		}
+
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			return restic.ScanReject, "", errors.Wrap(err, "Read")
+		}
+
+		return parseScanAnswer(line)
+	}
+}
+
+// parseScanAnswer parses the answer of a scanner listening on a unix socket.
+func parseScanAnswer(line string) (restic.ScanVerdict, string, error) {
+	line = strings.TrimSpace(line)
+	answer := strings.SplitN(line, " ", 2)
+
+	var reason string
+	if len(answer) > 1 {
+		reason = strings.TrimSpace(answer[1])
+	}
+
+	switch answer[0] {
+	case "OK":
+		return restic.ScanAccept, "", nil
+	case "REJECT":
+		return restic.ScanReject, reason, nil
+	case "QUARANTINE":
+		return restic.ScanQuarantine, reason, nil
+	}
+
+	return restic.ScanReject, "", errors.Errorf("invalid answer from scanner: %q", line)
+}
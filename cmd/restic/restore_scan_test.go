@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseScanAnswer(t *testing.T) {
+	var tests = []struct {
+		line    string
+		verdict restic.ScanVerdict
+		reason  string
+		err     bool
+	}{
+		{"OK\n", restic.ScanAccept, "", false},
+		{"REJECT Eicar-Test-Signature\n", restic.ScanReject, "Eicar-Test-Signature", false},
+		{"QUARANTINE suspicious macro\n", restic.ScanQuarantine, "suspicious macro", false},
+		{"MAYBE\n", restic.ScanReject, "", true},
+		{"\n", restic.ScanReject, "", true},
+	}
+
+	for _, test := range tests {
+		verdict, reason, err := parseScanAnswer(test.line)
+		if test.err != (err != nil) {
+			t.Errorf("%q: unexpected error %v", test.line, err)
+			continue
+		}
+		rtest.Equals(t, test.verdict, verdict)
+		rtest.Equals(t, test.reason, reason)
+	}
+}
+
+func TestScanSocket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets are not available on all versions of Windows")
+	}
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	socket := filepath.Join(tempdir, "scan.sock")
+	ln, err := net.Listen("unix", socket)
+	rtest.OK(t, err)
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			path, _ := bufio.NewReader(conn).ReadString('\n')
+			if strings.Contains(path, "infected") {
+				_, _ = conn.Write([]byte("QUARANTINE found something\n"))
+			} else {
+				_, _ = conn.Write([]byte("OK\n"))
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	scan := scanSocket(socket)
+
+	verdict, _, err := scan(context.TODO(), "/file", "/tmp/file")
+	rtest.OK(t, err)
+	rtest.Equals(t, restic.ScanAccept, verdict)
+
+	verdict, reason, err := scan(context.TODO(), "/infected", "/tmp/infected")
+	rtest.OK(t, err)
+	rtest.Equals(t, restic.ScanQuarantine, verdict)
+	rtest.Equals(t, "found something", reason)
+}
+
+func TestScanCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test needs sh")
+	}
+
+	scan, err := scanCommand(`sh -c 'case "$0" in *infected*) echo found; exit 1;; *broken*) exit 2;; esac'`)
+	rtest.OK(t, err)
+
+	verdict, _, err := scan(context.TODO(), "/file", "/tmp/file")
+	rtest.OK(t, err)
+	rtest.Equals(t, restic.ScanAccept, verdict)
+
+	verdict, reason, err := scan(context.TODO(), "/infected", "/tmp/infected")
+	rtest.OK(t, err)
+	rtest.Equals(t, restic.ScanQuarantine, verdict)
+	rtest.Equals(t, "found", reason)
+
+	_, _, err = scan(context.TODO(), "/broken", "/tmp/broken")
+	rtest.Assert(t, err != nil, "no error for exit code 2")
+}
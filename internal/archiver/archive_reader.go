@@ -2,7 +2,10 @@ package archiver
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
 	"time"
 
 	"github.com/restic/restic/internal/debug"
@@ -19,29 +22,195 @@ type Reader struct {
 
 	Tags     []string
 	Hostname string
+	Labels   map[string]string
+
+	// Time is the time of the snapshot, the current time is used if it is
+	// zero.
+	Time time.Time
+
+	// Parent, if not nil, is recorded as the parent of the snapshot.
+	Parent *restic.ID
+
+	// SaveCanary enables saving a canary blob with the snapshot, see
+	// restic.Canary.
+	SaveCanary bool
+
+	// CheckpointInterval enables writing a checkpoint snapshot with the data
+	// read so far at this interval, so that an interrupted backup of a large
+	// stream can be resumed. The index is saved with each checkpoint.
+	CheckpointInterval time.Duration
+
+	// OnCheckpoint, if set, is called after a checkpoint has been saved with
+	// the number of bytes of the stream it contains.
+	OnCheckpoint func(id restic.ID, offset uint64)
+
+	// Resume is the checkpoint of an interrupted backup of the same stream.
+	// The data saved in the checkpoint is reused and the backup continues at
+	// its offset.
+	Resume *StreamCheckpoint
+
+	// ResumedStream means that the stream starts at the offset of Resume.
+	// Otherwise the stream starts at the beginning and the data which has
+	// already been saved is read and discarded.
+	ResumedStream bool
+}
+
+// StreamCheckpoint is a checkpoint of an interrupted backup of a stream.
+type StreamCheckpoint struct {
+	ID restic.ID
+
+	// Offset is the number of bytes of the stream saved in the checkpoint.
+	Offset uint64
+
+	content restic.IDs
+}
+
+// LoadStreamCheckpoint loads the checkpoint snapshot id of an interrupted
+// backup of a stream saved as the file name.
+func LoadStreamCheckpoint(ctx context.Context, repo restic.Repository, id restic.ID, name string) (*StreamCheckpoint, error) {
+	sn, err := restic.LoadSnapshot(ctx, repo, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !sn.Checkpoint || sn.Tree == nil {
+		return nil, errors.Errorf("snapshot %v is not a checkpoint", id.Str())
+	}
+
+	tree, err := repo.LoadTree(ctx, *sn.Tree)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tree.Nodes) != 1 || tree.Nodes[0].Name != name || tree.Nodes[0].Type != "file" {
+		return nil, errors.Errorf("checkpoint %v does not contain the file %v", id.Str(), name)
+	}
+
+	node := tree.Nodes[0]
+	return &StreamCheckpoint{ID: id, Offset: node.Size, content: node.Content}, nil
+}
+
+// saveTree saves the tree with a single file node for the stream.
+func (r *Reader) saveTree(ctx context.Context, sn *restic.Snapshot, name string, ts time.Time, size uint64, content restic.IDs) (restic.ID, error) {
+	tree := &restic.Tree{
+		Nodes: []*restic.Node{
+			{
+				Name:       name,
+				AccessTime: ts,
+				ModTime:    ts,
+				Type:       "file",
+				Mode:       0644,
+				Size:       size,
+				UID:        sn.UID,
+				GID:        sn.GID,
+				User:       sn.Username,
+				Content:    content,
+			},
+		},
+	}
+	tree.Nodes[0].MetadataDigest = tree.Nodes[0].ComputeMetadataDigest()
+
+	return r.Repository.SaveTree(ctx, tree)
+}
+
+// writeCheckpoint saves a checkpoint snapshot based on sn with the data of
+// the stream saved so far, after flushing the repository and saving the
+// index.
+func (r *Reader) writeCheckpoint(ctx context.Context, sn *restic.Snapshot, name string, size uint64, content restic.IDs) (restic.ID, error) {
+	treeID, err := r.saveTree(ctx, sn, name, time.Now(), size, content)
+	if err != nil {
+		return restic.ID{}, err
+	}
+
+	err = r.Repository.Flush(ctx)
+	if err != nil {
+		return restic.ID{}, err
+	}
+
+	err = r.Repository.SaveIndex(ctx)
+	if err != nil {
+		return restic.ID{}, err
+	}
+
+	cp := *sn
+	cp.Tree = &treeID
+	cp.Checkpoint = true
+
+	return r.Repository.SaveJSONUnpacked(ctx, restic.SnapshotFile, &cp)
+}
+
+// removeCheckpoint removes a checkpoint which is not needed any more.
+func (r *Reader) removeCheckpoint(ctx context.Context, id restic.ID) {
+	h := restic.Handle{Type: restic.SnapshotFile, Name: id.String()}
+	err := r.Repository.Backend().Remove(ctx, h)
+	if err != nil {
+		debug.Log("unable to remove checkpoint %v: %v", id, err)
+		fmt.Fprintf(os.Stderr, "unable to remove checkpoint %v: %v\n", id.Str(), err)
+	}
 }
 
-// Archive reads data from the reader and saves it to the repo.
+// Archive reads data from the reader and saves it to the repo. The data is
+// stored as a single file with the given name in the root directory of the
+// snapshot, the metadata of the file is made up since there is no file in
+// the local file system.
 func (r *Reader) Archive(ctx context.Context, name string, rd io.Reader, p *restic.Progress) (*restic.Snapshot, restic.ID, error) {
 	if name == "" {
 		return nil, restic.ID{}, errors.New("no filename given")
 	}
 
 	debug.Log("start archiving %s", name)
-	sn, err := restic.NewSnapshot([]string{name}, r.Tags, r.Hostname, time.Now())
+	now := time.Now()
+	snTime := r.Time
+	if snTime.IsZero() {
+		snTime = now
+	}
+
+	sn, err := restic.NewSnapshot([]string{name}, r.Tags, r.Hostname, snTime)
 	if err != nil {
 		return nil, restic.ID{}, err
 	}
+	sn.Labels = r.Labels
+	sn.Parent = r.Parent
 
 	p.Start()
 	defer p.Done()
 
 	repo := r.Repository
-	chnker := chunker.New(rd, repo.Config().ChunkerPolynomial)
 
 	ids := restic.IDs{}
 	var fileSize uint64
 
+	// the checkpoint which is replaced by the next one
+	var lastCheckpoint *restic.ID
+
+	if r.Resume != nil {
+		debug.Log("resuming from checkpoint %v at offset %d", r.Resume.ID, r.Resume.Offset)
+		if !r.ResumedStream {
+			n, err := io.CopyN(ioutil.Discard, rd, int64(r.Resume.Offset))
+			if errors.Cause(err) == io.EOF {
+				return nil, restic.ID{}, errors.Errorf("stream ended after %d bytes, before the offset %d of checkpoint %v",
+					n, r.Resume.Offset, r.Resume.ID.Str())
+			}
+			if err != nil {
+				return nil, restic.ID{}, errors.Wrap(err, "Read")
+			}
+		}
+
+		ids = append(ids, r.Resume.content...)
+		fileSize = r.Resume.Offset
+		p.Report(restic.Stat{Bytes: fileSize})
+
+		id := r.Resume.ID
+		lastCheckpoint = &id
+	}
+
+	chnker := chunker.New(rd, repo.Config().ChunkerPolynomial)
+	nextCheckpoint := time.Now().Add(r.CheckpointInterval)
+
+	// blobs saved during this run are not in the index until it is flushed,
+	// remember them so that repeated chunks are only stored once
+	saved := restic.NewIDSet()
+
 	for {
 		chunk, err := chnker.Next(getBuf())
 		if errors.Cause(err) == io.EOF {
@@ -54,11 +223,12 @@ func (r *Reader) Archive(ctx context.Context, name string, rd io.Reader, p *rest
 
 		id := restic.Hash(chunk.Data)
 
-		if !repo.Index().Has(id, restic.DataBlob) {
+		if !saved.Has(id) && !repo.Index().Has(id, restic.DataBlob) {
 			_, err := repo.SaveBlob(ctx, restic.DataBlob, chunk.Data, id)
 			if err != nil {
 				return nil, restic.ID{}, err
 			}
+			saved.Insert(id)
 			debug.Log("saved blob %v (%d bytes)\n", id, chunk.Length)
 		} else {
 			debug.Log("blob %v already saved in the repo\n", id)
@@ -70,32 +240,40 @@ func (r *Reader) Archive(ctx context.Context, name string, rd io.Reader, p *rest
 
 		p.Report(restic.Stat{Bytes: uint64(chunk.Length)})
 		fileSize += uint64(chunk.Length)
-	}
 
-	tree := &restic.Tree{
-		Nodes: []*restic.Node{
-			{
-				Name:       name,
-				AccessTime: time.Now(),
-				ModTime:    time.Now(),
-				Type:       "file",
-				Mode:       0644,
-				Size:       fileSize,
-				UID:        sn.UID,
-				GID:        sn.GID,
-				User:       sn.Username,
-				Content:    ids,
-			},
-		},
+		if r.CheckpointInterval > 0 && time.Now().After(nextCheckpoint) {
+			id, err := r.writeCheckpoint(ctx, sn, name, fileSize, ids)
+			if err != nil {
+				debug.Log("writing checkpoint returned an error: %v", err)
+				fmt.Fprintf(os.Stderr, "error saving checkpoint: %v\n", err)
+			} else {
+				debug.Log("saved checkpoint %v at offset %d", id, fileSize)
+				if lastCheckpoint != nil {
+					r.removeCheckpoint(ctx, *lastCheckpoint)
+				}
+				lastCheckpoint = &id
+				if r.OnCheckpoint != nil {
+					r.OnCheckpoint(id, fileSize)
+				}
+			}
+			nextCheckpoint = time.Now().Add(r.CheckpointInterval)
+		}
 	}
 
-	treeID, err := repo.SaveTree(ctx, tree)
+	treeID, err := r.saveTree(ctx, sn, name, now, fileSize, ids)
 	if err != nil {
 		return nil, restic.ID{}, err
 	}
 	sn.Tree = &treeID
 	debug.Log("tree saved as %v", treeID)
 
+	if r.SaveCanary {
+		sn.Canary, err = restic.SaveCanary(ctx, repo)
+		if err != nil {
+			return nil, restic.ID{}, err
+		}
+	}
+
 	id, err := repo.SaveJSONUnpacked(ctx, restic.SnapshotFile, sn)
 	if err != nil {
 		return nil, restic.ID{}, err
@@ -113,5 +291,9 @@ func (r *Reader) Archive(ctx context.Context, name string, rd io.Reader, p *rest
 		return nil, restic.ID{}, err
 	}
 
+	if lastCheckpoint != nil {
+		r.removeCheckpoint(ctx, *lastCheckpoint)
+	}
+
 	return sn, id, nil
 }
@@ -5,8 +5,10 @@ import (
 	"context"
 	"errors"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"testing"
+	"time"
 
 	"github.com/restic/restic/internal/checker"
 	"github.com/restic/restic/internal/repository"
@@ -204,3 +206,150 @@ func BenchmarkArchiveReader(t *testing.B) {
 		}
 	}
 }
+
+func TestArchiveReaderRepeatedChunks(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	// the same data twice in a row results in the same chunks
+	data, err := ioutil.ReadAll(fakeFile(t, 23, 4*1024*1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(data, data...)
+
+	parent := restic.NewRandomID()
+	ts := time.Unix(1460289341, 0)
+
+	r := &Reader{
+		Repository: repo,
+		Hostname:   "localhost",
+		Time:       ts,
+		Parent:     &parent,
+	}
+
+	sn, _, err := r.Archive(context.TODO(), "fakefile", bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatalf("ArchiveReader() returned error %v", err)
+	}
+
+	if !sn.Time.Equal(ts) {
+		t.Errorf("wrong snapshot time, want %v, got %v", ts, sn.Time)
+	}
+
+	if sn.Parent == nil || !sn.Parent.Equal(parent) {
+		t.Errorf("wrong parent, want %v, got %v", parent, sn.Parent)
+	}
+
+	checkSavedFile(t, repo, *sn.Tree, "fakefile", bytes.NewReader(data))
+
+	blobs := 0
+	for range repo.Index().Each(context.TODO()) {
+		blobs++
+	}
+
+	tree, err := repo.LoadTree(context.TODO(), *sn.Tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// all data blobs plus the tree
+	want := len(restic.NewIDSet(tree.Nodes[0].Content...)) + 1
+	if blobs != want {
+		t.Errorf("wrong number of blobs in the index, want %v, got %v", want, blobs)
+	}
+}
+
+// failingReader returns an error after n bytes have been read from rd.
+type failingReader struct {
+	rd io.Reader
+	n  int
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, errors.New("stream interrupted")
+	}
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	n, err := r.rd.Read(p)
+	r.n -= n
+	return n, err
+}
+
+func TestArchiveReaderResume(t *testing.T) {
+	data, err := ioutil.ReadAll(fakeFile(t, 23, 8*1024*1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, resumed := range []bool{false, true} {
+		repo, cleanup := repository.TestRepository(t)
+
+		r := &Reader{
+			Repository:         repo,
+			Hostname:           "localhost",
+			CheckpointInterval: time.Nanosecond,
+		}
+
+		var checkpoints int
+		r.OnCheckpoint = func(restic.ID, uint64) { checkpoints++ }
+
+		_, _, err := r.Archive(context.TODO(), "fakefile", &failingReader{rd: bytes.NewReader(data), n: len(data) / 2}, nil)
+		if err == nil {
+			t.Fatal("expected error not returned")
+		}
+
+		if checkpoints == 0 {
+			t.Fatal("no checkpoint saved")
+		}
+
+		// only the latest checkpoint is kept
+		if n := countSnapshots(t, repo); n != 1 {
+			t.Fatalf("wrong number of snapshots, want 1, got %v", n)
+		}
+
+		id, err := restic.FindLatestCheckpoint(context.TODO(), repo, []string{"fakefile"}, "localhost")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cp, err := LoadStreamCheckpoint(context.TODO(), repo, id, "fakefile")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if cp.Offset == 0 || cp.Offset > uint64(len(data)/2) {
+			t.Fatalf("invalid checkpoint offset %v", cp.Offset)
+		}
+
+		rd := bytes.NewReader(data)
+		if resumed {
+			rd = bytes.NewReader(data[cp.Offset:])
+		}
+
+		r = &Reader{
+			Repository:    repo,
+			Hostname:      "localhost",
+			Resume:        cp,
+			ResumedStream: resumed,
+		}
+
+		sn, _, err := r.Archive(context.TODO(), "fakefile", rd, nil)
+		if err != nil {
+			t.Fatalf("ArchiveReader() returned error %v", err)
+		}
+
+		checkSavedFile(t, repo, *sn.Tree, "fakefile", bytes.NewReader(data))
+
+		// the checkpoint has been removed
+		if n := countSnapshots(t, repo); n != 1 {
+			t.Errorf("wrong number of snapshots, want 1, got %v", n)
+		}
+
+		// the trees of the checkpoints are not referenced any more and are
+		// removed by prune, so the repository is not checked here
+		cleanup()
+	}
+}
@@ -2,13 +2,16 @@ package archiver
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/sha256"
 	"fmt"
+	"hash"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/restic/restic/internal/errors"
@@ -25,13 +28,33 @@ import (
 const (
 	maxConcurrentBlobs = 32
 	maxConcurrency     = 10
+
+	// maxParallelTargets is the largest number of targets which are archived
+	// in parallel, each with their own pipeline. Larger lists of targets,
+	// e.g. read from a file, are walked by a single pipeline.
+	maxParallelTargets = 16
 )
 
+// PartialTag is added to the tags of a snapshot which does not contain all
+// files because the deadline of the archiver has passed.
+const PartialTag = "partial"
+
 var archiverPrintWarnings = func(path string, fi os.FileInfo, err error) {
 	fmt.Fprintf(os.Stderr, "warning for %v: %v", path, err)
 }
 var archiverAllowAllFiles = func(string, os.FileInfo) bool { return true }
 
+var archiverPrintErrors = func(item string, fi os.FileInfo, err error) error {
+	fmt.Fprintf(os.Stderr, "error for %v: %v\n", item, err)
+	return nil
+}
+
+// ErrorFunc is called for each file or directory which cannot be read. When
+// it returns nil, the item is left out of the snapshot, recorded in its list
+// of errors, and archiving continues. Otherwise the snapshot is aborted and
+// the error is returned by Snapshot.
+type ErrorFunc func(item string, fi os.FileInfo, err error) error
+
 // Archiver is used to backup a set of directories.
 type Archiver struct {
 	repo       restic.Repository
@@ -43,10 +66,109 @@ type Archiver struct {
 	blobToken chan struct{}
 
 	Warn         func(dir string, fi os.FileInfo, err error)
+	Error        ErrorFunc
 	SelectFilter pipe.SelectFunc
 	Excludes     []string
 
 	WithAccessTime bool
+
+	// FS is the file system the files are read from, the local file system
+	// by default.
+	FS fs.FS
+
+	// UseChangeJournal enables consulting the change journal of the file
+	// system, so that directories which have not been modified since the
+	// parent snapshot was taken are not read again.
+	UseChangeJournal bool
+
+	// SkipUnchangedDirs enables reusing the subtree of a directory from the
+	// parent snapshot without reading the directory again, when the metadata
+	// of the directory and of all its entries is unchanged. Files modified
+	// further below such a directory are not noticed, so all directories are
+	// read again when the last snapshot which did so is older than
+	// FullWalkInterval. Zero means no limit.
+	SkipUnchangedDirs bool
+	FullWalkInterval  time.Duration
+
+	// ChangeIgnoreFlags selects metadata which is not compared with the
+	// parent snapshot to decide whether a file or directory has changed.
+	ChangeIgnoreFlags restic.ChangeIgnoreFlags
+
+	// StoreFileHash enables computing the SHA-256 hash of each file which is
+	// read, it is stored in the node.
+	StoreFileHash bool
+
+	// Concurrency is the number of files which are read and chunked at the
+	// same time, the chunks of all files are saved concurrently. Defaults to
+	// 10, zero also means the default.
+	Concurrency uint
+
+	// InlineSize enables storing the content of files of at most this many
+	// bytes in the tree instead of a blob, see restic.Node.Inline. Zero
+	// disables it.
+	InlineSize uint64
+
+	// SaveCanary enables saving a canary blob with known content together
+	// with the snapshot, see restic.Canary.
+	SaveCanary bool
+
+	// CheckpointInterval enables writing a checkpoint snapshot with all files
+	// saved so far at this interval, see restic.Snapshot.Checkpoint. The
+	// checkpoints are removed when the snapshot is complete.
+	CheckpointInterval time.Duration
+
+	// Resume is the checkpoint of an interrupted backup of the same paths.
+	// Files contained in it are not read again, the parent snapshot is still
+	// used for the files which are missing in the checkpoint. The checkpoint
+	// is removed when the snapshot is complete.
+	Resume *restic.ID
+
+	// BeforeSave is called with the new snapshot after all data has been
+	// saved, right before the snapshot itself is saved, so that it can be
+	// amended.
+	BeforeSave func(ctx context.Context, sn *restic.Snapshot) error
+
+	// DedupStats counts the new and already known chunks of the files read,
+	// for each target of the last call to Snapshot.
+	DedupStats *DedupStats
+
+	// Deadline is the time after which no new directories are entered and
+	// no more files are read, files which are being read are finished. The
+	// snapshot then only contains the data saved so far and is tagged with
+	// PartialTag. Zero means no deadline.
+	Deadline time.Time
+
+	// skipped is set to 1 when an item was skipped because the deadline has
+	// passed, it is accessed atomically.
+	skipped int32
+
+	// checkpoint collects the items saved so far by the current call to
+	// Snapshot, when checkpoints are enabled.
+	checkpoint *checkpoint
+
+	// parentTrees is used to look up files in the parent snapshot when
+	// resuming from a checkpoint.
+	parentTrees *parentTrees
+
+	// hardlinks tracks the files with several hard links during the current
+	// call to Snapshot.
+	hardlinks *hardlinks
+
+	// nfs caches which devices are NFS mounts.
+	nfs nfsDevices
+
+	// pendingTrees contains the trees which are being saved in the
+	// background.
+	pendingTrees pendingTrees
+
+	// itemErrors collects the items which could not be read during the
+	// current call to Snapshot.
+	itemErrors struct {
+		sync.Mutex
+		list  []restic.ItemError
+		count int
+		abort error
+	}
 }
 
 // New returns a new archiver.
@@ -60,6 +182,9 @@ func New(repo restic.Repository) *Archiver {
 		}{
 			IDSet: restic.NewIDSet(),
 		},
+		DedupStats:  newDedupStats(nil),
+		FS:          fs.Local{},
+		Concurrency: maxConcurrency,
 	}
 
 	for i := 0; i < maxConcurrentBlobs; i++ {
@@ -67,11 +192,89 @@ func New(repo restic.Repository) *Archiver {
 	}
 
 	arch.Warn = archiverPrintWarnings
+	arch.Error = archiverPrintErrors
 	arch.SelectFilter = archiverAllowAllFiles
 
 	return arch
 }
 
+// deadlinePassed returns true if the deadline has passed. The item path is
+// then recorded as skipped.
+func (arch *Archiver) deadlinePassed(path string) bool {
+	if arch.Deadline.IsZero() || time.Now().Before(arch.Deadline) {
+		return false
+	}
+
+	debug.Log("deadline passed, skipping %v", path)
+	atomic.StoreInt32(&arch.skipped, 1)
+	return true
+}
+
+// selectFunc returns the function selecting the items to walk, which also
+// rejects new directories below the targets once the deadline has passed.
+func (arch *Archiver) selectFunc(targets []string) pipe.SelectFunc {
+	if arch.Deadline.IsZero() {
+		return arch.selectFilter
+	}
+
+	roots := make(map[string]struct{}, len(targets))
+	for _, target := range targets {
+		roots[target] = struct{}{}
+	}
+
+	return func(item string, fi os.FileInfo) bool {
+		if _, ok := roots[item]; !ok && fi.IsDir() && arch.deadlinePassed(item) {
+			return false
+		}
+		return arch.selectFilter(item, fi)
+	}
+}
+
+// error reports that item could not be read to the error function and
+// records it.
+func (arch *Archiver) error(item string, fi os.FileInfo, err error) {
+	abort := arch.Error(item, fi, err)
+
+	arch.itemErrors.Lock()
+	defer arch.itemErrors.Unlock()
+
+	arch.itemErrors.count++
+	if len(arch.itemErrors.list) < restic.MaxItemErrors {
+		arch.itemErrors.list = append(arch.itemErrors.list, restic.ItemError{Path: item, Message: err.Error()})
+	}
+
+	if abort != nil && arch.itemErrors.abort == nil {
+		debug.Log("aborting snapshot after error for %v: %v", item, abort)
+		arch.itemErrors.abort = abort
+	}
+}
+
+// aborted returns the error returned by the error function which aborted the
+// current snapshot, or nil.
+func (arch *Archiver) aborted() error {
+	arch.itemErrors.Lock()
+	defer arch.itemErrors.Unlock()
+
+	return arch.itemErrors.abort
+}
+
+// selectFilter calls SelectFilter until the snapshot is aborted, afterwards
+// all remaining items are rejected, so the walker finishes quickly.
+func (arch *Archiver) selectFilter(item string, fi os.FileInfo) bool {
+	if arch.aborted() != nil {
+		return false
+	}
+
+	// files removed while still open on an NFS client vanish when they are
+	// closed, reading them only produces errors
+	if fs.IsSillyRename(filepath.Base(item)) && arch.onNFS(item, fi) {
+		debug.Log("skipping %v, it has been removed on the NFS mount", item)
+		return false
+	}
+
+	return arch.SelectFilter(item, fi)
+}
+
 // isKnownBlob returns true iff the blob is not yet in the list of known blobs.
 // When the blob is not known, false is returned and the blob is added to the
 // list. This means that the caller false is returned to is responsible to save
@@ -95,33 +298,38 @@ func (arch *Archiver) isKnownBlob(id restic.ID, t restic.BlobType) bool {
 
 // Save stores a blob read from rd in the repository.
 func (arch *Archiver) Save(ctx context.Context, t restic.BlobType, data []byte, id restic.ID) error {
+	_, err := arch.save(ctx, t, data, id)
+	return err
+}
+
+// save stores a blob in the repository and returns true if the blob was not
+// known before.
+func (arch *Archiver) save(ctx context.Context, t restic.BlobType, data []byte, id restic.ID) (bool, error) {
 	debug.Log("Save(%v, %v)\n", t, id)
 
 	if arch.isKnownBlob(id, restic.DataBlob) {
 		debug.Log("blob %v is known\n", id)
-		return nil
+		return false, nil
 	}
 
 	_, err := arch.repo.SaveBlob(ctx, t, data, id)
 	if err != nil {
 		debug.Log("Save(%v, %v): error %v\n", t, id, err)
-		return err
+		return false, err
 	}
 
 	debug.Log("Save(%v, %v): new blob\n", t, id)
-	return nil
+	return true, nil
 }
 
 // SaveTreeJSON stores a tree in the repository.
 func (arch *Archiver) SaveTreeJSON(ctx context.Context, tree *restic.Tree) (restic.ID, error) {
-	data, err := json.Marshal(tree)
+	data, id, err := arch.encodeTree(tree)
 	if err != nil {
-		return restic.ID{}, errors.Wrap(err, "Marshal")
+		return restic.ID{}, err
 	}
-	data = append(data, '\n')
 
 	// check if tree has been saved before
-	id := restic.Hash(data)
 	if arch.isKnownBlob(id, restic.TreeBlob) {
 		return id, nil
 	}
@@ -143,7 +351,14 @@ func (arch *Archiver) reloadFileIfChanged(node *restic.Node, file fs.File) (*res
 		return node, nil
 	}
 
-	arch.Warn(node.Path, fi, errors.New("file has changed"))
+	// NFS clients cache the attributes of files for a while and only fetch
+	// them again when a file is opened, so the modification time reported
+	// before may be outdated
+	if arch.onNFS(node.Path, fi) {
+		debug.Log("attributes of %v on NFS were outdated, using the current ones", node.Path)
+	} else {
+		arch.Warn(node.Path, fi, errors.New("file has changed"))
+	}
 
 	node, err = restic.NodeFromFileInfo(node.Path, fi)
 	if err != nil {
@@ -161,13 +376,22 @@ func (arch *Archiver) reloadFileIfChanged(node *restic.Node, file fs.File) (*res
 type saveResult struct {
 	id    restic.ID
 	bytes uint64
+	added bool
 }
 
 func (arch *Archiver) saveChunk(ctx context.Context, chunk chunker.Chunk, p *restic.Progress, token struct{}, file fs.File, resultChannel chan<- saveResult) {
 	defer freeBuf(chunk.Data)
 
-	id := restic.Hash(chunk.Data)
-	err := arch.Save(ctx, restic.DataBlob, chunk.Data, id)
+	// runs of zero bytes, e.g. in disk images, are cut into chunks of the
+	// same length, so the ID does not need to be computed again
+	var id restic.ID
+	if restic.IsZero(chunk.Data) {
+		id = restic.ZeroBlobID(int(chunk.Length))
+	} else {
+		id = restic.Hash(chunk.Data)
+	}
+
+	added, err := arch.save(ctx, restic.DataBlob, chunk.Data, id)
 	// TODO handle error
 	if err != nil {
 		debug.Log("Save(%v) failed: %v", id, err)
@@ -175,9 +399,15 @@ func (arch *Archiver) saveChunk(ctx context.Context, chunk chunker.Chunk, p *res
 		panic(err)
 	}
 
-	p.Report(restic.Stat{Bytes: uint64(chunk.Length)})
+	stat := restic.Stat{Bytes: uint64(chunk.Length)}
+	if added {
+		stat.Uploaded = uint64(chunk.Length)
+	} else {
+		stat.Deduplicated = uint64(chunk.Length)
+	}
+	p.Report(stat)
 	arch.blobToken <- token
-	resultChannel <- saveResult{id: id, bytes: uint64(chunk.Length)}
+	resultChannel <- saveResult{id: id, bytes: uint64(chunk.Length), added: added}
 }
 
 func waitForResults(resultChannels [](<-chan saveResult)) ([]saveResult, error) {
@@ -209,6 +439,10 @@ func updateNodeContent(node *restic.Node, results []saveResult) error {
 
 	if bytes != node.Size {
 		fmt.Fprintf(os.Stderr, "warning for %v: expected %d bytes, saved %d bytes\n", node.Path, node.Size, bytes)
+
+		// the file has changed while it was read, record the size of the
+		// content which has been saved
+		node.Size = bytes
 	}
 
 	debug.Log("SaveFile(%q): %v blobs\n", node.Path, len(results))
@@ -216,12 +450,52 @@ func updateNodeContent(node *restic.Node, results []saveResult) error {
 	return nil
 }
 
+// readInline reads the content of a small file into node.Inline. It returns
+// false if the file has grown beyond InlineSize in the meantime, the file is
+// rewound then, so that it can be saved as blobs.
+func (arch *Archiver) readInline(node *restic.Node, file fs.File) (bool, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(file, int64(arch.InlineSize)+1))
+	if err != nil {
+		return false, errors.Wrap(err, "ReadAll")
+	}
+
+	if uint64(len(data)) > arch.InlineSize {
+		_, err = file.Seek(0, io.SeekStart)
+		return false, errors.Wrap(err, "Seek")
+	}
+
+	if uint64(len(data)) != node.Size {
+		fmt.Fprintf(os.Stderr, "warning for %v: expected %d bytes, saved %d bytes\n", node.Path, node.Size, len(data))
+		node.Size = uint64(len(data))
+	}
+
+	node.Content = restic.IDs{}
+	if len(data) > 0 {
+		node.Inline = data
+	}
+
+	if arch.StoreFileHash {
+		id := restic.ID(sha256.Sum256(data))
+		node.SHA256 = &id
+	}
+
+	debug.Log("SaveFile(%q): %d bytes stored inline", node.Path, len(data))
+	return true, nil
+}
+
 // SaveFile stores the content of the file on the backend as a Blob by calling
 // Save for each chunk.
 func (arch *Archiver) SaveFile(ctx context.Context, p *restic.Progress, node *restic.Node) (*restic.Node, error) {
-	file, err := fs.Open(node.Path)
+	node, _, err := arch.saveFile(ctx, p, node)
+	return node, err
+}
+
+// saveFile works like SaveFile, and additionally returns the amount of data
+// which was not already stored in the repository.
+func (arch *Archiver) saveFile(ctx context.Context, p *restic.Progress, node *restic.Node) (*restic.Node, uint64, error) {
+	file, err := arch.FS.Open(node.Path)
 	if err != nil {
-		return node, errors.Wrap(err, "Open")
+		return node, 0, errors.Wrap(err, "Open")
 	}
 	defer file.Close()
 
@@ -229,12 +503,47 @@ func (arch *Archiver) SaveFile(ctx context.Context, p *restic.Progress, node *re
 
 	node, err = arch.reloadFileIfChanged(node, file)
 	if err != nil {
-		return node, err
+		return node, 0, err
 	}
 
-	chnker := chunker.New(file, arch.repo.Config().ChunkerPolynomial)
+	p.StartFile(node.Path, node.Size)
+	defer p.DoneFile(node.Path)
+
+	if node.Size > 0 && node.Size <= arch.InlineSize {
+		inlined, err := arch.readInline(node, file)
+		if err != nil {
+			return node, 0, err
+		}
+
+		if inlined {
+			p.ReportFile(node.Path, node.Size)
+			p.Report(restic.Stat{Bytes: node.Size})
+			// the content is stored in the tree, so it is always new data
+			added, err := arch.saveStreams(ctx, p, node)
+			return node, node.Size + added, err
+		}
+	}
+
+	// the holes of sparse files are not read
+	var rd io.Reader = file
+	holes, err := fs.Holes(file, int64(node.Size))
+	if err != nil {
+		debug.Log("unable to find the holes in %v: %v", node.Path, err)
+	}
+	node.Holes = holes
+	if len(holes) > 0 {
+		debug.Log("%v has %d holes", node.Path, len(holes))
+		rd = newHoleReader(file, holes)
+	}
+
+	chnker := chunker.New(rd, arch.repo.Config().ChunkerPolynomial)
 	resultChannels := [](<-chan saveResult){}
 
+	var fileHash hash.Hash
+	if arch.StoreFileHash {
+		fileHash = sha256.New()
+	}
+
 	for {
 		chunk, err := chnker.Next(getBuf())
 		if errors.Cause(err) == io.EOF {
@@ -242,7 +551,14 @@ func (arch *Archiver) SaveFile(ctx context.Context, p *restic.Progress, node *re
 		}
 
 		if err != nil {
-			return node, errors.Wrap(err, "chunker.Next")
+			return node, 0, errors.Wrap(err, "chunker.Next")
+		}
+
+		p.ReportFile(node.Path, uint64(chunk.Length))
+
+		// saveChunk releases the buffer, so hash the data before handing it over
+		if fileHash != nil {
+			fileHash.Write(chunk.Data)
 		}
 
 		resCh := make(chan saveResult, 1)
@@ -252,11 +568,115 @@ func (arch *Archiver) SaveFile(ctx context.Context, p *restic.Progress, node *re
 
 	results, err := waitForResults(resultChannels)
 	if err != nil {
-		return node, err
+		return node, 0, err
 	}
+	var added uint64
+	for _, res := range results {
+		arch.DedupStats.add(node.Path, res.bytes, res.added)
+		if res.added {
+			added += res.bytes
+		}
+	}
+	// the size of a streamed file is only known now
+	if sf, ok := file.(fs.StreamedFile); ok && sf.SizeUnknown() {
+		node.Size = 0
+		for _, res := range results {
+			node.Size += res.bytes
+		}
+	}
+
 	err = updateNodeContent(node, results)
+	if err != nil {
+		return node, added, err
+	}
 
-	return node, err
+	if fileHash != nil {
+		var id restic.ID
+		copy(id[:], fileHash.Sum(nil))
+		node.SHA256 = &id
+	}
+
+	streamsAdded, err := arch.saveStreams(ctx, p, node)
+	return node, added + streamsAdded, err
+}
+
+// saveStreams saves the alternate data streams of the file in node, when the
+// file system supports them. It returns the amount of data which was not
+// already stored in the repository.
+func (arch *Archiver) saveStreams(ctx context.Context, p *restic.Progress, node *restic.Node) (uint64, error) {
+	sfs, ok := arch.FS.(fs.StreamFS)
+	if !ok {
+		return 0, nil
+	}
+
+	names, err := sfs.ListStreams(node.Path)
+	if err != nil {
+		return 0, errors.Wrap(err, "ListStreams")
+	}
+
+	node.Streams = nil
+
+	var added uint64
+	for _, name := range names {
+		stream, n, err := arch.saveStream(ctx, p, node.Path, name)
+		if err != nil {
+			return added, err
+		}
+
+		node.Streams = append(node.Streams, stream)
+		added += n
+	}
+
+	return added, nil
+}
+
+// saveStream stores the content of the alternate data stream name of the
+// file path.
+func (arch *Archiver) saveStream(ctx context.Context, p *restic.Progress, path, name string) (restic.Stream, uint64, error) {
+	debug.Log("save stream %v of %v", name, path)
+
+	file, err := arch.FS.Open(fs.StreamPath(path, name))
+	if err != nil {
+		return restic.Stream{}, 0, errors.Wrap(err, "Open")
+	}
+	defer file.Close()
+
+	chnker := chunker.New(file, arch.repo.Config().ChunkerPolynomial)
+	resultChannels := [](<-chan saveResult){}
+
+	for {
+		chunk, err := chnker.Next(getBuf())
+		if errors.Cause(err) == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return restic.Stream{}, 0, errors.Wrap(err, "chunker.Next")
+		}
+
+		resCh := make(chan saveResult, 1)
+		go arch.saveChunk(ctx, chunk, p, <-arch.blobToken, file, resCh)
+		resultChannels = append(resultChannels, resCh)
+	}
+
+	results, err := waitForResults(resultChannels)
+	if err != nil {
+		return restic.Stream{}, 0, err
+	}
+
+	stream := restic.Stream{Name: name, Content: restic.IDs{}}
+	var added uint64
+	for _, res := range results {
+		stream.Content = append(stream.Content, res.id)
+		stream.Size += res.bytes
+
+		arch.DedupStats.add(path, res.bytes, res.added)
+		if res.added {
+			added += res.bytes
+		}
+	}
+
+	return stream, added, nil
 }
 
 func (arch *Archiver) fileWorker(ctx context.Context, wg *sync.WaitGroup, p *restic.Progress, entCh <-chan pipe.Entry) {
@@ -277,11 +697,16 @@ func (arch *Archiver) fileWorker(ctx context.Context, wg *sync.WaitGroup, p *res
 			// check for errors
 			if e.Error() != nil {
 				debug.Log("job %v has errors: %v", e.Path(), e.Error())
-				// TODO: integrate error reporting
-				fmt.Fprintf(os.Stderr, "error for %v: %v\n", e.Path(), e.Error())
+				arch.error(e.Fullpath(), e.Info(), e.Error())
 				// ignore this file
 				e.Result() <- nil
-				p.Report(restic.Stat{Errors: 1})
+				p.ErrorFile(e.Fullpath(), e.Error())
+				continue
+			}
+
+			// do not read any more files after the snapshot has been aborted
+			if arch.aborted() != nil {
+				e.Result() <- nil
 				continue
 			}
 
@@ -295,6 +720,31 @@ func (arch *Archiver) fileWorker(ctx context.Context, wg *sync.WaitGroup, p *res
 				node.AccessTime = node.ModTime
 			}
 
+			// files which were not saved before the backup was interrupted
+			// are compared with the parent snapshot
+			if e.Node == nil && arch.parentTrees != nil && node.Type == "file" {
+				old := arch.parentTrees.Lookup(ctx, e.Path())
+				if old != nil && old.Type == "file" && !old.IsNewer(e.Fullpath(), e.Info(), arch.ChangeIgnoreFlags) {
+					e.Node = old
+				}
+				if old != nil {
+					e.Parent = old
+				}
+			}
+
+			// reuse the subtree of unchanged dirs
+			if node.Type == "dir" && e.Node != nil {
+				debug.Log("   %v reuse old subtree", e.Path())
+				node.Subtree = e.Node.(*restic.Node).Subtree
+				node.EntriesDigest = e.Node.(*restic.Node).EntriesDigest
+				if arch.checkpoint != nil {
+					arch.checkpoint.add(e.Path(), node)
+				}
+				e.Result() <- node
+				p.Report(restic.Stat{Dirs: 1})
+				continue
+			}
+
 			// try to use old node, if present
 			if e.Node != nil {
 				debug.Log("   %v use old data", e.Path())
@@ -302,7 +752,11 @@ func (arch *Archiver) fileWorker(ctx context.Context, wg *sync.WaitGroup, p *res
 				oldNode := e.Node.(*restic.Node)
 				// check if all content is still available in the repository
 				contentMissing := false
-				for _, blob := range oldNode.Content {
+				blobs := append(restic.IDs{}, oldNode.Content...)
+				for _, stream := range oldNode.Streams {
+					blobs = append(blobs, stream.Content...)
+				}
+				for _, blob := range blobs {
 					if !arch.repo.Index().Has(blob, restic.DataBlob) {
 						debug.Log("   %v not using old data, %v is missing", e.Path(), blob)
 						contentMissing = true
@@ -312,22 +766,60 @@ func (arch *Archiver) fileWorker(ctx context.Context, wg *sync.WaitGroup, p *res
 
 				if !contentMissing {
 					node.Content = oldNode.Content
+					node.Inline = oldNode.Inline
+					node.Streams = oldNode.Streams
+					node.Holes = oldNode.Holes
+					node.SHA256 = oldNode.SHA256
 					debug.Log("   %v content is complete", e.Path())
 				}
 			} else {
 				debug.Log("   %v no old data", e.Path())
 			}
 
+			action := fileAction(e.Parent, node, e.Node != nil)
+
+			// the content of a file with several hard links is only read for
+			// the first link, the others wait for it
+			var link *hardlinkFile
+			if arch.hardlinks != nil && isHardlink(node) {
+				var first bool
+				link, first = arch.hardlinks.claim(node)
+				if !first {
+					if len(node.Content) == 0 && node.Inline == nil {
+						if saved := link.wait(ctx, node); saved != nil {
+							debug.Log("   %v reuse content of another hard link", e.Path())
+							node.Content = saved.Content
+							node.Inline = saved.Inline
+							node.Streams = saved.Streams
+							node.Holes = saved.Holes
+							node.SHA256 = saved.SHA256
+						}
+					}
+					link = nil
+				}
+			}
+
 			// otherwise read file normally
-			if node.Type == "file" && len(node.Content) == 0 {
+			var added uint64
+			if node.Type == "file" && len(node.Content) == 0 && node.Inline == nil {
+				if arch.deadlinePassed(e.Path()) {
+					if link != nil {
+						link.finish(nil)
+					}
+					e.Result() <- nil
+					continue
+				}
+
 				debug.Log("   read and save %v", e.Path())
-				node, err = arch.SaveFile(ctx, p, node)
+				node, added, err = arch.saveFile(ctx, p, node)
 				if err != nil {
-					fmt.Fprintf(os.Stderr, "error for %v: %v\n", node.Path, err)
-					arch.Warn(e.Path(), nil, err)
+					if link != nil {
+						link.finish(nil)
+					}
+					arch.error(e.Fullpath(), e.Info(), err)
 					// ignore this file
 					e.Result() <- nil
-					p.Report(restic.Stat{Errors: 1})
+					p.ErrorFile(node.Path, err)
 					continue
 				}
 			} else {
@@ -335,9 +827,16 @@ func (arch *Archiver) fileWorker(ctx context.Context, wg *sync.WaitGroup, p *res
 				p.Report(restic.Stat{Bytes: node.Size})
 			}
 
+			if link != nil {
+				link.finish(node)
+			}
+
 			debug.Log("   processed %v, %d blobs", e.Path(), len(node.Content))
+			if arch.checkpoint != nil {
+				arch.checkpoint.add(e.Path(), node)
+			}
 			e.Result() <- node
-			p.Report(restic.Stat{Files: 1})
+			p.CompleteFile(node.Path, node.Size, action, added)
 		case <-ctx.Done():
 			// pipeline was cancelled
 			return
@@ -345,7 +844,7 @@ func (arch *Archiver) fileWorker(ctx context.Context, wg *sync.WaitGroup, p *res
 	}
 }
 
-func (arch *Archiver) dirWorker(ctx context.Context, wg *sync.WaitGroup, p *restic.Progress, dirCh <-chan pipe.Dir) {
+func (arch *Archiver) dirWorker(ctx context.Context, wg *sync.WaitGroup, p *restic.Progress, ts *treeSaver, dirCh <-chan pipe.Dir) {
 	debug.Log("start")
 	defer func() {
 		debug.Log("done")
@@ -362,7 +861,7 @@ func (arch *Archiver) dirWorker(ctx context.Context, wg *sync.WaitGroup, p *rest
 
 			// ignore dir nodes with errors
 			if dir.Error() != nil {
-				fmt.Fprintf(os.Stderr, "error walking dir %v: %v\n", dir.Path(), dir.Error())
+				arch.error(dir.Fullpath(), dir.Info(), dir.Error())
 				dir.Result() <- nil
 				p.Report(restic.Stat{Errors: 1})
 				continue
@@ -433,13 +932,28 @@ func (arch *Archiver) dirWorker(ctx context.Context, wg *sync.WaitGroup, p *rest
 				node.Error = err.Error()
 			}
 
-			id, err := arch.SaveTreeJSON(ctx, tree)
+			if arch.SkipUnchangedDirs && dir.Path() != "" {
+				node.EntriesDigest = restic.ComputeEntriesDigest(tree.Nodes)
+			}
+
+			// the directory is only added to the checkpoint when its tree
+			// and all subtrees have been saved
+			var onDone func(restic.ID)
+			if arch.checkpoint != nil {
+				path, cp := dir.Path(), *node
+				onDone = func(id restic.ID) {
+					cp.Subtree = &id
+					arch.checkpoint.add(path, &cp)
+				}
+			}
+
+			id, err := ts.Save(tree, onDone)
 			if err != nil {
 				panic(err)
 			}
 			debug.Log("save tree for %s: %v", dir.Path(), id)
 			if id.IsNull() {
-				panic("invalid null subtree restic.ID return from SaveTreeJSON()")
+				panic("invalid null subtree restic.ID return from treeSaver.Save()")
 			}
 
 			node.Subtree = &id
@@ -460,6 +974,9 @@ func (arch *Archiver) dirWorker(ctx context.Context, wg *sync.WaitGroup, p *rest
 type archivePipe struct {
 	Old <-chan walk.TreeJob
 	New <-chan pipe.Job
+
+	// ignore selects metadata which is not compared with the old files.
+	ignore restic.ChangeIgnoreFlags
 }
 
 func copyJobs(ctx context.Context, in <-chan pipe.Job, out chan<- pipe.Job) {
@@ -495,6 +1012,7 @@ type archiveJob struct {
 	hasOld bool
 	old    walk.TreeJob
 	new    pipe.Job
+	ignore restic.ChangeIgnoreFlags
 }
 
 func (a *archivePipe) compare(ctx context.Context, out chan<- pipe.Job) {
@@ -555,7 +1073,7 @@ func (a *archivePipe) compare(ctx context.Context, out chan<- pipe.Job) {
 			debug.Log("    same filename %q", file1)
 
 			// send job
-			out <- archiveJob{hasOld: true, old: oldJob, new: newJob}.Copy()
+			out <- archiveJob{hasOld: true, old: oldJob, new: newJob, ignore: a.ignore}.Copy()
 			loadOld = true
 			loadNew = true
 			continue
@@ -600,23 +1118,51 @@ func (j archiveJob) Copy() pipe.Job {
 			return j.new
 		}
 
+		e := j.new.(pipe.Entry)
+		e.Parent = j.old.Node
+
 		// if file is newer, return the new job
-		if j.old.Node.IsNewer(j.new.Fullpath(), j.new.Info()) {
+		if j.old.Node.IsNewer(j.new.Fullpath(), j.new.Info(), j.ignore) {
 			debug.Log("   job %v is newer", j.new.Path())
-			return j.new
+			return e
 		}
 
 		debug.Log("   job %v add old data", j.new.Path())
 		// otherwise annotate job with old data
-		e := j.new.(pipe.Entry)
 		e.Node = j.old.Node
 		return e
 	}
 
-	// dirs and other types are just returned
+	// other types are only compared with the old node to report changes
+	if e, ok := j.new.(pipe.Entry); ok && j.old.Node != nil {
+		e.Parent = j.old.Node
+		return e
+	}
+
+	// dirs are just returned
 	return j.new
 }
 
+// fileAction returns how the item node is reported, parent is the node at the
+// same path in the parent snapshot (or nil) and reused is true when the
+// content of the parent node is used for node.
+func fileAction(parent interface{}, node *restic.Node, reused bool) restic.FileAction {
+	old, _ := parent.(*restic.Node)
+	switch {
+	case reused:
+		return restic.FileUnmodified
+	case old == nil:
+		return restic.FileNew
+	case node.Type == "file":
+		// the file is read again because it has been modified
+		return restic.FileChanged
+	case old.Type == node.Type && old.ModTime.Equal(node.ModTime) && old.LinkTarget == node.LinkTarget:
+		return restic.FileUnmodified
+	default:
+		return restic.FileChanged
+	}
+}
+
 const saveIndexTime = 30 * time.Second
 
 // saveIndexes regularly queries the master index for full indexes and saves them.
@@ -668,9 +1214,206 @@ func (p baseNameSlice) Len() int           { return len(p) }
 func (p baseNameSlice) Less(i, j int) bool { return filepath.Base(p[i]) < filepath.Base(p[j]) }
 func (p baseNameSlice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 
+// saveTargets archives the given paths with a separate pipeline and set of
+// workers and returns the node for the top-level tree. The jobs from the
+// parent snapshot are read from old.
+func (arch *Archiver) saveTargets(ctx context.Context, p *restic.Progress, paths []string, old <-chan walk.TreeJob, unchanged pipe.UnchangedFunc) (*restic.Node, error) {
+	jobs := archivePipe{Old: old, ignore: arch.ChangeIgnoreFlags}
+
+	// start walker
+	pipeCh := make(chan pipe.Job)
+	resCh := make(chan pipe.Result, 1)
+	go func() {
+		pipe.WalkUnchangedFS(ctx, arch.FS, paths, arch.selectFunc(paths), unchanged, pipeCh, resCh)
+		debug.Log("pipe.Walk done")
+	}()
+	jobs.New = pipeCh
+
+	ch := make(chan pipe.Job)
+	go jobs.compare(ctx, ch)
+
+	var wg sync.WaitGroup
+	entCh := make(chan pipe.Entry)
+	dirCh := make(chan pipe.Dir)
+
+	// split
+	wg.Add(1)
+	go func() {
+		pipe.Split(ch, dirCh, entCh)
+		debug.Log("split done")
+		close(dirCh)
+		close(entCh)
+		wg.Done()
+	}()
+
+	workers := arch.Concurrency
+	if workers == 0 {
+		workers = maxConcurrency
+	}
+
+	ts := newTreeSaver(ctx, arch, workers)
+
+	// run workers
+	for i := uint(0); i < workers; i++ {
+		wg.Add(2)
+		go arch.fileWorker(ctx, &wg, p, entCh)
+		go arch.dirWorker(ctx, &wg, p, ts, dirCh)
+	}
+
+	// wait for all workers to terminate
+	debug.Log("wait for workers")
+	wg.Wait()
+	debug.Log("workers terminated")
+
+	// wait for the remaining trees to be saved
+	err := ts.wait()
+	debug.Log("tree saver terminated, error %v", err)
+	if err != nil {
+		return nil, err
+	}
+
+	// receive the top-level tree
+	return (<-resCh).(*restic.Node), nil
+}
+
+// parentJobs returns a channel which yields the jobs for the top-level entry
+// name of the parent tree, with the same paths walking the complete parent
+// tree would produce. If parent is nil or does not contain name, the channel
+// is closed right away.
+func (arch *Archiver) parentJobs(ctx context.Context, parent *restic.Tree, name string) <-chan walk.TreeJob {
+	out := make(chan walk.TreeJob)
+
+	var node *restic.Node
+	if parent != nil {
+		for _, n := range parent.Nodes {
+			if n.Name == name {
+				node = n
+				break
+			}
+		}
+	}
+
+	if node == nil {
+		close(out)
+		return out
+	}
+
+	go func() {
+		defer close(out)
+
+		send := func(job walk.TreeJob) bool {
+			select {
+			case out <- job:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		if node.Type == "dir" && node.Subtree != nil {
+			ch := make(chan walk.TreeJob)
+			go walk.Tree(ctx, arch.repo, *node.Subtree, ch)
+			for job := range ch {
+				job.Path = filepath.Join(name, job.Path)
+				if !send(job) {
+					return
+				}
+			}
+		} else if !send(walk.TreeJob{Path: name, Node: node}) {
+			return
+		}
+
+		send(walk.TreeJob{Path: "", Tree: &restic.Tree{Nodes: []*restic.Node{node}}})
+	}()
+
+	return out
+}
+
+// independentTargets returns true if paths can be archived independently of
+// each other, which is the case if there is more than one path, but not more
+// than maxParallelTargets, and the base names are unique.
+func independentTargets(paths []string) bool {
+	if len(paths) < 2 || len(paths) > maxParallelTargets {
+		return false
+	}
+
+	seen := make(map[string]struct{})
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		if filepath.Dir(path) == path {
+			// the root directory is expanded to its entries
+			return false
+		}
+
+		name := filepath.Base(path)
+		if _, ok := seen[name]; ok {
+			return false
+		}
+		seen[name] = struct{}{}
+	}
+
+	return true
+}
+
+// saveTargetsParallel archives each path concurrently with its own pipeline
+// and set of workers, so that a slow target does not hold up the others.
+// Afterwards the top-level trees are merged.
+func (arch *Archiver) saveTargetsParallel(ctx context.Context, p *restic.Progress, paths []string, parent *restic.Tree, unchanged pipe.UnchangedFunc) (*restic.Node, error) {
+	roots := make([]*restic.Node, len(paths))
+	errs := make([]error, len(paths))
+
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		wg.Add(1)
+		go func(i int, path string) {
+			defer wg.Done()
+			old := arch.parentJobs(ctx, parent, filepath.Base(path))
+			roots[i], errs[i] = arch.saveTargets(ctx, p, []string{path}, old, unchanged)
+			debug.Log("target %v done", path)
+		}(i, path)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the top-level trees need to be loaded again
+	err := arch.repo.Flush(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := restic.NewTree()
+	for _, root := range roots {
+		t, err := arch.repo.LoadTree(ctx, *root.Subtree)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, node := range t.Nodes {
+			if err = tree.Insert(node); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	id, err := arch.SaveTreeJSON(ctx, tree)
+	if err != nil {
+		return nil, err
+	}
+
+	return &restic.Node{Subtree: &id}, nil
+}
+
 // Snapshot creates a snapshot of the given paths. If parentrestic.ID is set, this is
 // used to compare the files to the ones archived at the time this snapshot was
 // taken.
+//
+// When several paths with different base names are given, they are archived
+// concurrently, each with its own set of workers.
 func (arch *Archiver) Snapshot(ctx context.Context, p *restic.Progress, paths, tags []string, hostname string, parentID *restic.ID, time time.Time) (*restic.Snapshot, restic.ID, error) {
 	paths = unique(paths)
 	sort.Sort(baseNameSlice(paths))
@@ -679,6 +1422,15 @@ func (arch *Archiver) Snapshot(ctx context.Context, p *restic.Progress, paths, t
 
 	debug.RunHook("Archiver.Snapshot", nil)
 
+	arch.DedupStats = newDedupStats(paths)
+	atomic.StoreInt32(&arch.skipped, 0)
+
+	arch.itemErrors.Lock()
+	arch.itemErrors.list = nil
+	arch.itemErrors.count = 0
+	arch.itemErrors.abort = nil
+	arch.itemErrors.Unlock()
+
 	// signal the whole pipeline to stop
 	var err error
 
@@ -692,60 +1444,95 @@ func (arch *Archiver) Snapshot(ctx context.Context, p *restic.Progress, paths, t
 	}
 	sn.Excludes = arch.Excludes
 
-	jobs := archivePipe{}
-
 	// use parent snapshot (if some was given)
+	var parent *restic.Snapshot
 	if parentID != nil {
 		sn.Parent = parentID
 
 		// load parent snapshot
-		parent, err := restic.LoadSnapshot(ctx, arch.repo, *parentID)
+		parent, err = restic.LoadSnapshot(ctx, arch.repo, *parentID)
 		if err != nil {
 			return nil, restic.ID{}, err
 		}
+	}
 
-		// start walker on old tree
-		ch := make(chan walk.TreeJob)
-		go walk.Tree(ctx, arch.repo, *parent.Tree, ch)
-		jobs.Old = ch
-	} else {
-		// use closed channel
-		ch := make(chan walk.TreeJob)
-		close(ch)
-		jobs.Old = ch
+	// a checkpoint written after the parent snapshot replaces it for the
+	// comparison of the files
+	var resume *restic.Snapshot
+	if arch.Resume != nil {
+		resume, err = restic.LoadSnapshot(ctx, arch.repo, *arch.Resume)
+		if err != nil {
+			return nil, restic.ID{}, err
+		}
+
+		if parent != nil && resume.Time.Before(parent.Time) {
+			debug.Log("checkpoint %v is older than the parent snapshot, ignoring it", arch.Resume.Str())
+			resume = nil
+		}
 	}
 
-	// start walker
-	pipeCh := make(chan pipe.Job)
-	resCh := make(chan pipe.Result, 1)
-	go func() {
-		pipe.Walk(ctx, paths, arch.SelectFilter, pipeCh, resCh)
-		debug.Log("pipe.Walk done")
-	}()
-	jobs.New = pipeCh
+	var changes ChangeSet
+	if arch.UseChangeJournal {
+		changes = arch.changeJournal(sn, parent, paths)
+	}
 
-	ch := make(chan pipe.Job)
-	go jobs.compare(ctx, ch)
+	var skipDirs bool
+	if arch.SkipUnchangedDirs && changes == nil {
+		skipDirs = arch.useLastFullWalk(sn, parent)
+	}
 
-	var wg sync.WaitGroup
-	entCh := make(chan pipe.Entry)
-	dirCh := make(chan pipe.Dir)
+	parallel := independentTargets(paths)
 
-	// split
-	wg.Add(1)
-	go func() {
-		pipe.Split(ch, dirCh, entCh)
-		debug.Log("split done")
-		close(dirCh)
-		close(entCh)
-		wg.Done()
-	}()
+	var (
+		parentTree *restic.Tree
+		unchanged  pipe.UnchangedFunc
+	)
+	if parent != nil && (parallel || changes != nil || resume != nil || skipDirs) {
+		parentTree, err = arch.repo.LoadTree(ctx, *parent.Tree)
+		if err != nil {
+			return nil, restic.ID{}, err
+		}
+	}
 
-	// run workers
-	for i := 0; i < maxConcurrency; i++ {
-		wg.Add(2)
-		go arch.fileWorker(ctx, &wg, p, entCh)
-		go arch.dirWorker(ctx, &wg, p, dirCh)
+	switch {
+	case changes != nil:
+		unchanged = arch.unchangedFunc(ctx, parentTree, changes)
+	case skipDirs:
+		unchanged = arch.skipUnchangedDirsFunc(ctx, parentTree)
+	}
+
+	// the tree the files are compared with
+	var (
+		oldTreeID *restic.ID
+		oldTree   = parentTree
+	)
+	if parent != nil {
+		oldTreeID = parent.Tree
+	}
+
+	arch.parentTrees = nil
+	arch.hardlinks = newHardlinks()
+	if resume != nil {
+		oldTreeID = resume.Tree
+		oldTree, err = arch.repo.LoadTree(ctx, *resume.Tree)
+		if err != nil {
+			return nil, restic.ID{}, err
+		}
+
+		if parentTree != nil {
+			arch.parentTrees = newParentTrees(arch.repo, parentTree)
+		}
+	}
+
+	switch {
+	case parent == nil:
+		sn.ChangeDetection = restic.ChangeDetectionNone
+	case changes != nil:
+		sn.ChangeDetection = restic.ChangeDetectionJournal
+	case skipDirs:
+		sn.ChangeDetection = restic.ChangeDetectionDirs
+	default:
+		sn.ChangeDetection = restic.ChangeDetectionParent
 	}
 
 	// run index saver
@@ -754,15 +1541,59 @@ func (arch *Archiver) Snapshot(ctx context.Context, p *restic.Progress, paths, t
 	wgIndexSaver.Add(1)
 	go arch.saveIndexes(ctx, shutdownCtx, &wgIndexSaver)
 
-	// wait for all workers to terminate
-	debug.Log("wait for workers")
-	wg.Wait()
+	// run checkpoint saver
+	arch.checkpoint = nil
+	var checkpoints restic.IDs
+	if arch.CheckpointInterval > 0 {
+		arch.checkpoint = newCheckpoint()
+		wgIndexSaver.Add(1)
+		go arch.saveCheckpoints(ctx, shutdownCtx, &wgIndexSaver, sn, &checkpoints)
+	}
+
+	var root *restic.Node
+	if parallel {
+		debug.Log("archiving %d targets in parallel", len(paths))
+		root, err = arch.saveTargetsParallel(ctx, p, paths, oldTree, unchanged)
+	} else {
+		// start walker on old tree, or use a closed channel
+		ch := make(chan walk.TreeJob)
+		if oldTreeID != nil {
+			go walk.Tree(ctx, arch.repo, *oldTreeID, ch)
+		} else {
+			close(ch)
+		}
+
+		root, err = arch.saveTargets(ctx, p, paths, ch, unchanged)
+	}
 
-	// stop index saver
+	// stop index and checkpoint saver
 	indexShutdown()
 	wgIndexSaver.Wait()
 
-	debug.Log("workers terminated")
+	if err != nil {
+		return nil, restic.ID{}, err
+	}
+
+	if err = arch.aborted(); err != nil {
+		return nil, restic.ID{}, err
+	}
+
+	arch.itemErrors.Lock()
+	sn.Errors = arch.itemErrors.list
+	sn.ErrorCount = arch.itemErrors.count
+	arch.itemErrors.Unlock()
+
+	if atomic.LoadInt32(&arch.skipped) != 0 {
+		debug.Log("deadline passed, snapshot is partial")
+		sn.AddTags([]string{PartialTag})
+	}
+
+	if arch.SaveCanary {
+		sn.Canary, err = restic.SaveCanary(ctx, arch.repo)
+		if err != nil {
+			return nil, restic.ID{}, err
+		}
+	}
 
 	// flush repository
 	err = arch.repo.Flush(ctx)
@@ -770,8 +1601,6 @@ func (arch *Archiver) Snapshot(ctx context.Context, p *restic.Progress, paths, t
 		return nil, restic.ID{}, err
 	}
 
-	// receive the top-level tree
-	root := (<-resCh).(*restic.Node)
 	debug.Log("root node received: %v", root.Subtree)
 	sn.Tree = root.Subtree
 
@@ -794,6 +1623,13 @@ func (arch *Archiver) Snapshot(ctx context.Context, p *restic.Progress, paths, t
 
 	debug.Log("saved indexes")
 
+	if arch.BeforeSave != nil {
+		err = arch.BeforeSave(ctx, sn)
+		if err != nil {
+			return nil, restic.ID{}, err
+		}
+	}
+
 	// save snapshot
 	id, err := arch.repo.SaveJSONUnpacked(ctx, restic.SnapshotFile, sn)
 	if err != nil {
@@ -802,6 +1638,11 @@ func (arch *Archiver) Snapshot(ctx context.Context, p *restic.Progress, paths, t
 
 	debug.Log("saved snapshot %v", id)
 
+	if arch.Resume != nil {
+		checkpoints = append(checkpoints, *arch.Resume)
+	}
+	arch.removeCheckpoints(ctx, checkpoints)
+
 	return sn, id, nil
 }
 
@@ -816,6 +1657,11 @@ func isRegularFile(fi os.FileInfo) bool {
 // Scan traverses the dirs to collect restic.Stat information while emitting progress
 // information with p.
 func Scan(dirs []string, filter pipe.SelectFunc, p *restic.Progress) (restic.Stat, error) {
+	return ScanFS(fs.Local{}, dirs, filter, p)
+}
+
+// ScanFS works like Scan, but traverses the dirs in fsys.
+func ScanFS(fsys fs.FS, dirs []string, filter pipe.SelectFunc, p *restic.Progress) (restic.Stat, error) {
 	p.Start()
 	defer p.Done()
 
@@ -823,7 +1669,7 @@ func Scan(dirs []string, filter pipe.SelectFunc, p *restic.Progress) (restic.Sta
 
 	for _, dir := range dirs {
 		debug.Log("Start for %v", dir)
-		err := fs.Walk(dir, func(str string, fi os.FileInfo, err error) error {
+		err := fs.WalkFS(fsys, dir, func(str string, fi os.FileInfo, err error) error {
 			// TODO: integrate error reporting
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "error for %v: %v\n", str, err)
@@ -2,10 +2,15 @@ package archiver
 
 import (
 	"context"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/restic/restic/internal/pipe"
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
 	"github.com/restic/restic/internal/walk"
 )
 
@@ -143,3 +148,89 @@ func TestArchivePipe(t *testing.T) {
 		i++
 	}
 }
+
+func TestChangedDirs(t *testing.T) {
+	cd := newChangedDirs(false)
+	cd.AddDir(filepath.FromSlash("/home/user/work"))
+	cd.AddTree(filepath.FromSlash("/home/user/moved"))
+
+	var tests = []struct {
+		dir     string
+		changed bool
+	}{
+		{"/", true},
+		{"/home", true},
+		{"/home/user", true},
+		{"/home/user/work", true},
+		{"/home/user/work/sub", false},
+		{"/home/user/other", false},
+		{"/home/user/moved", true},
+		{"/home/user/moved/sub/dir", true},
+		{"/tmp", false},
+	}
+
+	for _, test := range tests {
+		if cd.Changed(filepath.FromSlash(test.dir)) != test.changed {
+			t.Errorf("Changed(%v) != %v", test.dir, test.changed)
+		}
+	}
+}
+
+func TestUnchangedDirs(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	target := filepath.Join(dir, "target")
+	for _, name := range []string{"a", "b"} {
+		rtest.OK(t, os.MkdirAll(filepath.Join(target, name), 0755))
+		rtest.OK(t, ioutil.WriteFile(filepath.Join(target, name, "file"), []byte("content of "+name), 0644))
+	}
+
+	arch := New(repo)
+	sn, _, err := arch.Snapshot(context.TODO(), nil, []string{target}, nil, "localhost", nil, time.Now())
+	rtest.OK(t, err)
+
+	parent, err := repo.LoadTree(context.TODO(), *sn.Tree)
+	rtest.OK(t, err)
+
+	// modify both dirs, but only report a as changed
+	for _, name := range []string{"a", "b"} {
+		rtest.OK(t, ioutil.WriteFile(filepath.Join(target, name, "file"), []byte("new content of "+name), 0644))
+	}
+
+	changes := newChangedDirs(false)
+	changes.AddDir(filepath.Join(target, "a"))
+
+	old := make(chan walk.TreeJob)
+	go walk.Tree(context.TODO(), repo, *sn.Tree, old)
+
+	root, err := arch.saveTargets(context.TODO(), nil, []string{target}, old, arch.unchangedFunc(context.TODO(), parent, changes))
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Flush(context.TODO()))
+
+	tree, err := repo.LoadTree(context.TODO(), *root.Subtree)
+	rtest.OK(t, err)
+
+	oldTrees := newParentTrees(repo, parent)
+	newTrees := newParentTrees(repo, tree)
+	for _, test := range []struct {
+		name  string
+		equal bool
+	}{
+		{"a", false},
+		{"b", true},
+	} {
+		name := filepath.Join("target", test.name)
+		oldNode, newNode := oldTrees.Lookup(context.TODO(), name), newTrees.Lookup(context.TODO(), name)
+		if oldNode == nil || newNode == nil {
+			t.Fatalf("node %v not found", name)
+		}
+
+		if oldNode.Subtree.Equal(*newNode.Subtree) != test.equal {
+			t.Errorf("subtree of %v: old %v, new %v, want equal: %v", name, oldNode.Subtree.Str(), newNode.Subtree.Str(), test.equal)
+		}
+	}
+}
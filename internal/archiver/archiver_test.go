@@ -3,16 +3,21 @@ package archiver_test
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/restic/restic/internal/archiver"
 	"github.com/restic/restic/internal/checker"
 	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
@@ -369,3 +374,590 @@ func TestArchiveNameCollision(t *testing.T) {
 		t.Fatalf("tree has %d nodes, wanted 2: %v", len(tree.Nodes), tree.Nodes)
 	}
 }
+
+func TestArchiveIndependentTargets(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	for _, name := range []string{"a", "b"} {
+		rtest.OK(t, os.MkdirAll(filepath.Join(dir, name, "sub"), 0755))
+		rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, name, "sub", "file"), []byte("content of "+name), 0644))
+	}
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "c"), []byte("file c"), 0644))
+
+	paths := []string{filepath.Join(dir, "c"), filepath.Join(dir, "b"), filepath.Join(dir, "a")}
+
+	arch := archiver.New(repo)
+	sn, id, err := arch.Snapshot(context.TODO(), nil, paths, nil, "localhost", nil, time.Now())
+	rtest.OK(t, err)
+
+	tree, err := repo.LoadTree(context.TODO(), *sn.Tree)
+	rtest.OK(t, err)
+
+	var names []string
+	for _, node := range tree.Nodes {
+		names = append(names, node.Name)
+	}
+	rtest.Equals(t, []string{"a", "b", "c"}, names)
+
+	// archiving again with the parent snapshot must yield the same tree
+	sn2, _, err := arch.Snapshot(context.TODO(), nil, paths, nil, "localhost", &id, time.Now())
+	rtest.OK(t, err)
+	rtest.Equals(t, *sn.Tree, *sn2.Tree)
+
+	chkr := checker.New(repo)
+
+	hints, errs := chkr.LoadIndex(context.TODO())
+	if len(errs) > 0 {
+		t.Fatalf("expected no errors, got %v: %v", len(errs), errs)
+	}
+
+	if len(hints) > 0 {
+		t.Errorf("expected no hints, got %v: %v", len(hints), hints)
+	}
+
+	errChan := make(chan error)
+	go chkr.Structure(context.TODO(), errChan)
+
+	for err := range errChan {
+		rtest.OK(t, err)
+	}
+}
+
+func TestArchiveConcurrency(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	for i := 0; i < 20; i++ {
+		sub := filepath.Join(dir, fmt.Sprintf("dir%d", i%4))
+		rtest.OK(t, os.MkdirAll(sub, 0755))
+		data := rtest.Random(i, 100*1024*(i+1))
+		rtest.OK(t, ioutil.WriteFile(filepath.Join(sub, fmt.Sprintf("file%d", i)), data, 0644))
+	}
+
+	var trees restic.IDs
+	for _, n := range []uint{1, 3, 16} {
+		arch := archiver.New(repo)
+		arch.Concurrency = n
+		sn, _, err := arch.Snapshot(context.TODO(), nil, []string{dir}, nil, "localhost", nil, time.Now())
+		rtest.OK(t, err)
+		trees = append(trees, *sn.Tree)
+	}
+
+	for _, id := range trees[1:] {
+		rtest.Equals(t, trees[0], id)
+	}
+}
+
+func TestArchiveFileHash(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	data := rtest.Random(23, 5*1024*1024)
+	filename := filepath.Join(dir, "file")
+	rtest.OK(t, ioutil.WriteFile(filename, data, 0644))
+
+	loadNode := func(sn *restic.Snapshot) *restic.Node {
+		tree, err := repo.LoadTree(context.TODO(), *sn.Tree)
+		rtest.OK(t, err)
+		rtest.Equals(t, 1, len(tree.Nodes))
+		return tree.Nodes[0]
+	}
+
+	arch := archiver.New(repo)
+	sn, _, err := arch.Snapshot(context.TODO(), nil, []string{filename}, nil, "localhost", nil, time.Now())
+	rtest.OK(t, err)
+	rtest.Assert(t, loadNode(sn).SHA256 == nil, "hash stored without StoreFileHash")
+
+	arch.StoreFileHash = true
+	sn, id, err := arch.Snapshot(context.TODO(), nil, []string{filename}, nil, "localhost", nil, time.Now())
+	rtest.OK(t, err)
+
+	want := restic.ID(sha256.Sum256(data))
+	node := loadNode(sn)
+	rtest.Assert(t, node.SHA256 != nil, "no hash stored")
+	rtest.Equals(t, want, *node.SHA256)
+
+	// the hash is kept for unchanged files
+	sn, _, err = arch.Snapshot(context.TODO(), nil, []string{filename}, nil, "localhost", &id, time.Now())
+	rtest.OK(t, err)
+	node = loadNode(sn)
+	rtest.Assert(t, node.SHA256 != nil, "hash of unchanged file not kept")
+	rtest.Equals(t, want, *node.SHA256)
+}
+
+func TestArchiveInline(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	small := []byte("small file")
+	large := rtest.Random(23, 300)
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "large"), large, 0644))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "small"), small, 0644))
+
+	loadNodes := func(sn *restic.Snapshot) []*restic.Node {
+		tree, err := repo.LoadTree(context.TODO(), *sn.Tree)
+		rtest.OK(t, err)
+		tree, err = repo.LoadTree(context.TODO(), *tree.Nodes[0].Subtree)
+		rtest.OK(t, err)
+		rtest.Equals(t, 2, len(tree.Nodes))
+		return tree.Nodes
+	}
+
+	arch := archiver.New(repo)
+	arch.InlineSize = 256
+	sn, id, err := arch.Snapshot(context.TODO(), nil, []string{dir}, nil, "localhost", nil, time.Now())
+	rtest.OK(t, err)
+
+	nodes := loadNodes(sn)
+	rtest.Equals(t, 1, len(nodes[0].Content))
+	rtest.Assert(t, nodes[0].Inline == nil, "content of large file stored inline")
+	rtest.Equals(t, 0, len(nodes[1].Content))
+	rtest.Equals(t, small, nodes[1].Inline)
+
+	var buf bytes.Buffer
+	rtest.OK(t, nodes[1].WriteContentRange(context.TODO(), repo, 0, -1, &buf))
+	rtest.Equals(t, small, buf.Bytes())
+
+	// the content is kept for unchanged files
+	sn, _, err = arch.Snapshot(context.TODO(), nil, []string{dir}, nil, "localhost", &id, time.Now())
+	rtest.OK(t, err)
+	rtest.Equals(t, small, loadNodes(sn)[1].Inline)
+}
+
+func TestArchiveSkipUnchangedDirs(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	rtest.OK(t, os.MkdirAll(filepath.Join(dir, "a", "b"), 0755))
+	rtest.OK(t, os.MkdirAll(filepath.Join(dir, "c"), 0755))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "a", "b", "file"), []byte("foo"), 0644))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "c", "file"), []byte("bar"), 0644))
+
+	dump := func(sn *restic.Snapshot, item string) string {
+		var node *restic.Node
+		id := *sn.Tree
+		for _, name := range append([]string{filepath.Base(dir)}, strings.Split(item, "/")...) {
+			tree, err := repo.LoadTree(context.TODO(), id)
+			rtest.OK(t, err)
+			node = tree.Find(name)
+			rtest.Assert(t, node != nil, "%v not found", item)
+			if node.Subtree != nil {
+				id = *node.Subtree
+			}
+		}
+
+		var buf bytes.Buffer
+		rtest.OK(t, node.WriteContentRange(context.TODO(), repo, 0, -1, &buf))
+		return buf.String()
+	}
+
+	arch := archiver.New(repo)
+	arch.SkipUnchangedDirs = true
+
+	start := time.Now()
+	sn, id, err := arch.Snapshot(context.TODO(), nil, []string{dir}, nil, "localhost", nil, start)
+	rtest.OK(t, err)
+	rtest.Assert(t, sn.LastFullWalk != nil && sn.LastFullWalk.Equal(start), "wrong time of the last full walk %v", sn.LastFullWalk)
+
+	// a new file is noticed, a file modified in a subdirectory of an
+	// unchanged directory is not
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "a", "b", "file"), []byte("modified"), 0644))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "c", "new"), []byte("new"), 0644))
+
+	sn, id, err = arch.Snapshot(context.TODO(), nil, []string{dir}, nil, "localhost", &id, start.Add(time.Hour))
+	rtest.OK(t, err)
+	rtest.Equals(t, restic.ChangeDetectionDirs, sn.ChangeDetection)
+	rtest.Assert(t, sn.LastFullWalk.Equal(start), "time of the last full walk not kept")
+	rtest.Equals(t, "foo", dump(sn, "a/b/file"))
+	rtest.Equals(t, "new", dump(sn, "c/new"))
+
+	// all directories are read again after the full walk interval
+	arch.FullWalkInterval = 24 * time.Hour
+	sn, _, err = arch.Snapshot(context.TODO(), nil, []string{dir}, nil, "localhost", &id, start.Add(25*time.Hour))
+	rtest.OK(t, err)
+	rtest.Equals(t, restic.ChangeDetectionParent, sn.ChangeDetection)
+	rtest.Equals(t, "modified", dump(sn, "a/b/file"))
+}
+
+func TestArchiveDedupStats(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	data := rtest.Random(23, 3*1024*1024)
+	other := rtest.Random(42, 2*1024*1024)
+
+	dirA, dirB := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	rtest.OK(t, os.Mkdir(dirA, 0755))
+	rtest.OK(t, os.Mkdir(dirB, 0755))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dirA, "file"), data, 0644))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dirB, "copy"), data, 0644))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dirB, "other"), other, 0644))
+
+	arch := archiver.New(repo)
+	_, _, err := arch.Snapshot(context.TODO(), nil, []string{dirA}, nil, "localhost", nil, time.Now())
+	rtest.OK(t, err)
+
+	total := arch.DedupStats.Total()
+	rtest.Equals(t, uint64(len(data)), total.NewBytes)
+	rtest.Equals(t, uint64(0), total.KnownBytes)
+
+	_, _, err = arch.Snapshot(context.TODO(), nil, []string{dirA, dirB}, nil, "localhost", nil, time.Now())
+	rtest.OK(t, err)
+
+	dirs := arch.DedupStats.Dirs()
+	rtest.Equals(t, 2, len(dirs))
+
+	rtest.Equals(t, dirA, dirs[0].Path)
+	rtest.Equals(t, uint64(0), dirs[0].NewBytes)
+	rtest.Equals(t, uint64(len(data)), dirs[0].KnownBytes)
+
+	rtest.Equals(t, dirB, dirs[1].Path)
+	rtest.Equals(t, uint64(len(other)), dirs[1].NewBytes)
+	rtest.Equals(t, uint64(len(data)), dirs[1].KnownBytes)
+	rtest.Assert(t, dirs[1].NewChunks > 0 && dirs[1].KnownChunks > 0,
+		"unexpected chunk counts %+v", dirs[1].DedupCounter)
+}
+
+func TestArchiveHardlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hard links are not recorded on Windows")
+	}
+
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	data := rtest.Random(23, 3*1024*1024)
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "file"), data, 0644))
+	rtest.OK(t, os.Link(filepath.Join(dir, "file"), filepath.Join(dir, "link1")))
+	rtest.OK(t, os.Link(filepath.Join(dir, "file"), filepath.Join(dir, "link2")))
+
+	arch := archiver.New(repo)
+	sn, _, err := arch.Snapshot(context.TODO(), nil, []string{dir}, nil, "localhost", nil, time.Now())
+	rtest.OK(t, err)
+
+	// the content is only read for one of the links
+	total := arch.DedupStats.Total()
+	rtest.Equals(t, uint64(len(data)), total.NewBytes)
+	rtest.Equals(t, uint64(0), total.KnownBytes)
+
+	tree, err := repo.LoadTree(context.TODO(), *sn.Tree)
+	rtest.OK(t, err)
+	for tree.Nodes[0].Type == "dir" && len(tree.Nodes) == 1 {
+		tree, err = repo.LoadTree(context.TODO(), *tree.Nodes[0].Subtree)
+		rtest.OK(t, err)
+	}
+
+	rtest.Equals(t, 3, len(tree.Nodes))
+	first := tree.Nodes[0]
+	for _, node := range tree.Nodes {
+		rtest.Equals(t, uint64(3), node.Links)
+		rtest.Equals(t, first.Inode, node.Inode)
+		rtest.Equals(t, first.DeviceID, node.DeviceID)
+		rtest.Equals(t, first.Content, node.Content)
+	}
+}
+
+func TestArchiveFileActions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks is not supported on windows")
+	}
+
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	for _, name := range []string{"a", "b"} {
+		rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, name), []byte("content of "+name), 0644))
+	}
+	rtest.OK(t, os.Symlink("a", filepath.Join(dir, "link")))
+
+	actions := func(parent *restic.ID) (map[string]restic.FileAction, restic.Stat, *restic.ID) {
+		result := make(map[string]restic.FileAction)
+		var stat restic.Stat
+
+		p := restic.NewProgress()
+		p.OnFile = func(ev restic.FileEvent) {
+			if ev.Type == restic.FileEventDone {
+				result[filepath.Base(ev.Path)] = ev.Action
+			}
+		}
+		p.OnUpdate = func(s restic.Stat, d time.Duration, ticker bool) {}
+		p.OnDone = func(s restic.Stat, d time.Duration, ticker bool) {
+			stat = s
+		}
+
+		arch := archiver.New(repo)
+		_, id, err := arch.Snapshot(context.TODO(), p, []string{dir}, nil, "localhost", parent, time.Now())
+		rtest.OK(t, err)
+		return result, stat, &id
+	}
+
+	result, stat, id := actions(nil)
+	rtest.Equals(t, map[string]restic.FileAction{
+		"a":    restic.FileNew,
+		"b":    restic.FileNew,
+		"link": restic.FileNew,
+	}, result)
+	rtest.Equals(t, uint64(3), stat.FilesNew)
+
+	// modify a file and add a new one
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "a"), []byte("new content of a"), 0644))
+	mtime := time.Now().Add(time.Hour)
+	rtest.OK(t, os.Chtimes(filepath.Join(dir, "a"), mtime, mtime))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "c"), []byte("content of c"), 0644))
+
+	result, stat, _ = actions(id)
+	rtest.Equals(t, map[string]restic.FileAction{
+		"a":    restic.FileChanged,
+		"b":    restic.FileUnmodified,
+		"c":    restic.FileNew,
+		"link": restic.FileUnmodified,
+	}, result)
+	rtest.Equals(t, uint64(1), stat.FilesNew)
+	rtest.Equals(t, uint64(1), stat.FilesChanged)
+	rtest.Equals(t, uint64(2), stat.FilesUnmodified)
+}
+
+func TestArchiveDeadline(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	target := filepath.Join(dir, "target")
+	rtest.OK(t, os.MkdirAll(filepath.Join(target, "sub"), 0755))
+	for _, name := range []string{"a", "b", filepath.Join("sub", "c")} {
+		rtest.OK(t, ioutil.WriteFile(filepath.Join(target, name), []byte("content of "+name), 0644))
+	}
+
+	names := func(sn *restic.Snapshot) []string {
+		tree, err := repo.LoadTree(context.TODO(), *sn.Tree)
+		rtest.OK(t, err)
+		rtest.Equals(t, 1, len(tree.Nodes))
+
+		tree, err = repo.LoadTree(context.TODO(), *tree.Nodes[0].Subtree)
+		rtest.OK(t, err)
+
+		var names []string
+		for _, node := range tree.Nodes {
+			names = append(names, node.Name)
+		}
+		return names
+	}
+
+	arch := archiver.New(repo)
+	sn, id, err := arch.Snapshot(context.TODO(), nil, []string{target}, nil, "localhost", nil, time.Now())
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"a", "b", "sub"}, names(sn))
+
+	// modify a file and add a new one
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(target, "a"), []byte("new content of a"), 0644))
+	mtime := time.Now().Add(time.Hour)
+	rtest.OK(t, os.Chtimes(filepath.Join(target, "a"), mtime, mtime))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(target, "d"), []byte("content of d"), 0644))
+
+	// after the deadline, only unchanged files are kept
+	arch.Deadline = time.Now().Add(-time.Second)
+	sn, id, err = arch.Snapshot(context.TODO(), nil, []string{target}, nil, "localhost", &id, time.Now())
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"b"}, names(sn))
+	rtest.Assert(t, sn.HasTags([]string{archiver.PartialTag}), "partial snapshot is not tagged: %v", sn.Tags)
+
+	// the next backup continues with the remaining files
+	arch.Deadline = time.Time{}
+	sn, _, err = arch.Snapshot(context.TODO(), nil, []string{target}, nil, "localhost", &id, time.Now())
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"a", "b", "d", "sub"}, names(sn))
+	rtest.Assert(t, !sn.HasTags([]string{archiver.PartialTag}), "complete snapshot is tagged: %v", sn.Tags)
+}
+
+func TestArchiveResume(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	data1 := rtest.Random(23, 2*1024*1024)
+	data2 := rtest.Random(42, 1024*1024)
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "file1"), data1, 0644))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "file2"), data2, 0644))
+
+	arch := archiver.New(repo)
+	sn, _, err := arch.Snapshot(context.TODO(), nil, []string{dir}, nil, "localhost", nil, time.Now())
+	rtest.OK(t, err)
+
+	// pretend that the backup was interrupted after the checkpoint was saved
+	sn.Checkpoint = true
+	cpID, err := repo.SaveJSONUnpacked(context.TODO(), restic.SnapshotFile, sn)
+	rtest.OK(t, err)
+
+	data2 = rtest.Random(43, 1024*1024)
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "file2"), data2, 0644))
+	rtest.OK(t, os.Chtimes(filepath.Join(dir, "file2"), time.Now().Add(time.Hour), time.Now().Add(time.Hour)))
+
+	arch = archiver.New(repo)
+	arch.Resume = &cpID
+	_, _, err = arch.Snapshot(context.TODO(), nil, []string{dir}, nil, "localhost", nil, time.Now())
+	rtest.OK(t, err)
+
+	// only the modified file is read again
+	total := arch.DedupStats.Total()
+	rtest.Equals(t, uint64(len(data2)), total.NewBytes)
+	rtest.Equals(t, uint64(0), total.KnownBytes)
+
+	// the checkpoint has been removed
+	_, err = restic.FindLatestCheckpoint(context.TODO(), repo, []string{dir}, "localhost")
+	rtest.Equals(t, restic.ErrNoSnapshotFound, err)
+}
+
+// failingFS returns an error when one of the files in fail is opened.
+type failingFS struct {
+	fs.Local
+	fail map[string]struct{}
+}
+
+func (f failingFS) Open(name string) (fs.File, error) {
+	if _, ok := f.fail[filepath.Base(name)]; ok {
+		return nil, errors.New("injected error")
+	}
+	return f.Local.Open(name)
+}
+
+func TestArchiveErrors(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	for _, name := range []string{"file1", "file2", "file3"} {
+		rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+	}
+
+	arch := archiver.New(repo)
+	arch.FS = failingFS{fail: map[string]struct{}{"file2": {}}}
+
+	var reported []string
+	arch.Error = func(item string, fi os.FileInfo, err error) error {
+		reported = append(reported, item)
+		return nil
+	}
+
+	// the file is left out and recorded in the snapshot
+	sn, _, err := arch.Snapshot(context.TODO(), nil, []string{dir}, nil, "localhost", nil, time.Now())
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{filepath.Join(dir, "file2")}, reported)
+	rtest.Equals(t, 1, sn.ErrorCount)
+	rtest.Equals(t, filepath.Join(dir, "file2"), sn.Errors[0].Path)
+
+	tree, err := repo.LoadTree(context.TODO(), *sn.Tree)
+	rtest.OK(t, err)
+	tree, err = repo.LoadTree(context.TODO(), *tree.Nodes[0].Subtree)
+	rtest.OK(t, err)
+	rtest.Equals(t, 2, len(tree.Nodes))
+
+	// the error function aborts the snapshot
+	abort := errors.New("abort")
+	arch.Error = func(item string, fi os.FileInfo, err error) error {
+		return abort
+	}
+
+	_, _, err = arch.Snapshot(context.TODO(), nil, []string{dir}, nil, "localhost", nil, time.Now())
+	rtest.Assert(t, err == abort, "wrong error returned, want %v, got %v", abort, err)
+}
+
+// streamFS emulates alternate data streams, the streams of a file are read
+// from files named "file:stream" in dir.
+type streamFS struct {
+	fs.Local
+	dir     string
+	streams map[string][]string
+}
+
+func (f streamFS) ListStreams(name string) ([]string, error) {
+	return f.streams[filepath.Base(name)], nil
+}
+
+func (f streamFS) Open(name string) (fs.File, error) {
+	if strings.Contains(filepath.Base(name), ":") {
+		return f.Local.Open(filepath.Join(f.dir, filepath.Base(name)))
+	}
+	return f.Local.Open(name)
+}
+
+func TestArchiveStreams(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	streamDir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	data := []byte("content of the main stream")
+	stream := rtest.Random(23, 3*1024*1024)
+	filename := filepath.Join(dir, "file")
+	rtest.OK(t, ioutil.WriteFile(filename, data, 0644))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(streamDir, "file:Zone.Identifier"), stream, 0644))
+
+	loadNode := func(sn *restic.Snapshot) *restic.Node {
+		tree, err := repo.LoadTree(context.TODO(), *sn.Tree)
+		rtest.OK(t, err)
+		rtest.Equals(t, 1, len(tree.Nodes))
+		return tree.Nodes[0]
+	}
+
+	arch := archiver.New(repo)
+	arch.FS = streamFS{dir: streamDir, streams: map[string][]string{"file": {"Zone.Identifier"}}}
+	sn, id, err := arch.Snapshot(context.TODO(), nil, []string{filename}, nil, "localhost", nil, time.Now())
+	rtest.OK(t, err)
+
+	node := loadNode(sn)
+	rtest.Equals(t, uint64(len(data)), node.Size)
+	rtest.Equals(t, 1, len(node.Streams))
+	rtest.Equals(t, "Zone.Identifier", node.Streams[0].Name)
+	rtest.Equals(t, uint64(len(stream)), node.Streams[0].Size)
+
+	var buf bytes.Buffer
+	rtest.OK(t, restic.Node{Content: node.Streams[0].Content}.WriteContentRange(context.TODO(), repo, 0, -1, &buf))
+	rtest.Equals(t, stream, buf.Bytes())
+
+	// the blobs of the stream are used by the snapshot
+	blobs := restic.NewBlobSet()
+	rtest.OK(t, restic.FindUsedBlobs(context.TODO(), repo, *sn.Tree, blobs, restic.NewBlobSet()))
+	for _, id := range node.Streams[0].Content {
+		rtest.Assert(t, blobs.Has(restic.BlobHandle{ID: id, Type: restic.DataBlob}), "blob %v of the stream is not used", id.Str())
+	}
+
+	// the streams are kept for unchanged files
+	sn, _, err = arch.Snapshot(context.TODO(), nil, []string{filename}, nil, "localhost", &id, time.Now())
+	rtest.OK(t, err)
+	rtest.Equals(t, node.Streams, loadNode(sn).Streams)
+}
@@ -0,0 +1,304 @@
+package archiver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/pipe"
+	"github.com/restic/restic/internal/restic"
+)
+
+// ChangeSet records which directories were modified since a previous
+// snapshot was taken.
+type ChangeSet interface {
+	// Changed returns true if the directory dir (an absolute path), one of
+	// its entries or anything below it has been modified.
+	Changed(dir string) bool
+}
+
+// changedDirs is a ChangeSet built from a list of modified directories.
+type changedDirs struct {
+	// dirs contains all directories with modified entries and their parent
+	// directories.
+	dirs map[string]struct{}
+	// trees contains directories whose complete subtree needs to be read
+	// again, e.g. because they have been moved.
+	trees map[string]struct{}
+	// foldCase is set for file systems with case-insensitive paths.
+	foldCase bool
+}
+
+func newChangedDirs(foldCase bool) *changedDirs {
+	return &changedDirs{
+		dirs:     make(map[string]struct{}),
+		trees:    make(map[string]struct{}),
+		foldCase: foldCase,
+	}
+}
+
+func (cd *changedDirs) clean(dir string) string {
+	dir = filepath.Clean(dir)
+	if cd.foldCase {
+		dir = strings.ToLower(dir)
+	}
+	return dir
+}
+
+// AddDir records that an entry of dir has been modified.
+func (cd *changedDirs) AddDir(dir string) {
+	dir = cd.clean(dir)
+	for {
+		if _, ok := cd.dirs[dir]; ok {
+			return
+		}
+		cd.dirs[dir] = struct{}{}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return
+		}
+		dir = parent
+	}
+}
+
+// AddTree records that dir and everything below it needs to be read again.
+func (cd *changedDirs) AddTree(dir string) {
+	cd.AddDir(dir)
+	cd.trees[cd.clean(dir)] = struct{}{}
+}
+
+// Changed returns true if dir or anything below it has been modified.
+func (cd *changedDirs) Changed(dir string) bool {
+	dir = cd.clean(dir)
+	if _, ok := cd.dirs[dir]; ok {
+		return true
+	}
+
+	for {
+		if _, ok := cd.trees[dir]; ok {
+			return true
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false
+		}
+		dir = parent
+	}
+}
+
+// parentTrees looks up nodes in the tree of the parent snapshot by path and
+// caches the trees loaded so far.
+type parentTrees struct {
+	repo restic.Repository
+
+	m     sync.Mutex
+	trees map[string]*restic.Tree
+}
+
+func newParentTrees(repo restic.Repository, root *restic.Tree) *parentTrees {
+	return &parentTrees{
+		repo:  repo,
+		trees: map[string]*restic.Tree{"": root},
+	}
+}
+
+// Lookup returns the node for relpath, which is relative to the root of the
+// snapshot. If relpath does not exist in the parent snapshot, nil is returned.
+func (pt *parentTrees) Lookup(ctx context.Context, relpath string) *restic.Node {
+	pt.m.Lock()
+	defer pt.m.Unlock()
+
+	var (
+		dir  string
+		node *restic.Node
+	)
+
+	for _, name := range strings.Split(filepath.Clean(relpath), string(filepath.Separator)) {
+		tree, ok := pt.trees[dir]
+		if !ok {
+			if node == nil || node.Type != "dir" || node.Subtree == nil {
+				return nil
+			}
+
+			var err error
+			tree, err = pt.repo.LoadTree(ctx, *node.Subtree)
+			if err != nil {
+				debug.Log("unable to load tree %v: %v", node.Subtree.Str(), err)
+				return nil
+			}
+			pt.trees[dir] = tree
+		}
+
+		node = tree.Find(name)
+		if node == nil {
+			return nil
+		}
+		dir = filepath.Join(dir, name)
+	}
+
+	return node
+}
+
+// unchangedFunc returns a function for the pipe walker which reports the
+// node from the parent snapshot for all directories that have not been
+// modified according to changes, so that their subtree is reused without
+// reading the directory again.
+func (arch *Archiver) unchangedFunc(ctx context.Context, parent *restic.Tree, changes ChangeSet) pipe.UnchangedFunc {
+	trees := newParentTrees(arch.repo, parent)
+
+	return func(relpath, dir string, fi os.FileInfo) interface{} {
+		abs, err := filepath.Abs(dir)
+		if err != nil || changes.Changed(abs) {
+			return nil
+		}
+
+		node := trees.Lookup(ctx, relpath)
+		if node == nil || node.Type != "dir" || node.Subtree == nil {
+			return nil
+		}
+
+		debug.Log("reusing subtree %v for unchanged dir %v", node.Subtree.Str(), dir)
+		return node
+	}
+}
+
+// useLastFullWalk returns true if unchanged directories can be skipped when
+// comparing with parent, and records the time of the last snapshot which
+// read all directories in sn.
+func (arch *Archiver) useLastFullWalk(sn, parent *restic.Snapshot) bool {
+	if parent != nil && parent.LastFullWalk != nil &&
+		(arch.FullWalkInterval <= 0 || sn.Time.Sub(*parent.LastFullWalk) < arch.FullWalkInterval) {
+		sn.LastFullWalk = parent.LastFullWalk
+		return true
+	}
+
+	if parent != nil && parent.LastFullWalk != nil {
+		fmt.Fprintf(os.Stderr, "last snapshot which read all directories is older than %v, reading all directories\n", arch.FullWalkInterval)
+	}
+
+	t := sn.Time
+	sn.LastFullWalk = &t
+	return false
+}
+
+// skipUnchangedDirsFunc returns a function for the pipe walker which reports
+// the node from the parent snapshot for all directories whose metadata and
+// entries match it, so that their subtree is reused without reading it.
+func (arch *Archiver) skipUnchangedDirsFunc(ctx context.Context, parent *restic.Tree) pipe.UnchangedFunc {
+	trees := newParentTrees(arch.repo, parent)
+
+	return func(relpath, dir string, fi os.FileInfo) interface{} {
+		old := trees.Lookup(ctx, relpath)
+		if old == nil || old.Type != "dir" || old.Subtree == nil || old.EntriesDigest == "" {
+			return nil
+		}
+
+		node, err := restic.NodeFromFileInfo(dir, fi)
+		if err != nil || !node.ModTime.Equal(old.ModTime) {
+			return nil
+		}
+
+		if arch.ChangeIgnoreFlags&restic.ChangeIgnoreInode == 0 && node.Inode != old.Inode {
+			return nil
+		}
+
+		if arch.ChangeIgnoreFlags&restic.ChangeIgnoreCtime == 0 && !node.ChangeTime.Equal(old.ChangeTime) {
+			return nil
+		}
+
+		digest, err := arch.entriesDigest(dir)
+		if err != nil || digest != old.EntriesDigest {
+			debug.Log("entries of %v have changed", dir)
+			return nil
+		}
+
+		debug.Log("reusing subtree %v for unchanged dir %v", old.Subtree.Str(), dir)
+		return old
+	}
+}
+
+// entriesDigest returns the digest of the entries of dir which are not
+// excluded, without descending into subdirectories.
+func (arch *Archiver) entriesDigest(dir string) (string, error) {
+	names, err := arch.FS.ReadDirNames(dir)
+	if err != nil {
+		return "", err
+	}
+
+	nodes := make([]*restic.Node, 0, len(names))
+	for _, name := range names {
+		item := filepath.Join(dir, name)
+		fi, err := arch.FS.Lstat(item)
+		if err != nil {
+			return "", err
+		}
+
+		if !arch.selectFilter(item, fi) {
+			continue
+		}
+
+		node, err := restic.NodeFromFileInfo(item, fi)
+		if err != nil {
+			return "", err
+		}
+		nodes = append(nodes, node)
+	}
+
+	return restic.ComputeEntriesDigest(nodes), nil
+}
+
+// changeJournal records the current position of the change journal in sn and
+// returns the directories modified since the parent snapshot was taken. When
+// the change journal cannot be used, nil is returned and all directories are
+// read as usual.
+func (arch *Archiver) changeJournal(sn, parent *restic.Snapshot, paths []string) ChangeSet {
+	positions, err := journalPositions(paths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "change journal not available: %v\n", err)
+		return nil
+	}
+	sn.Journals = positions
+
+	if parent == nil {
+		return nil
+	}
+
+	if len(parent.Journals) == 0 {
+		debug.Log("parent snapshot has no journal positions")
+		return nil
+	}
+
+	if !sameExcludes(parent.Excludes, arch.Excludes) {
+		fmt.Fprintf(os.Stderr, "exclude patterns differ from the parent snapshot, reading all directories\n")
+		return nil
+	}
+
+	changes, err := journalChanges(parent.Journals, paths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to use change journal, reading all directories: %v\n", err)
+		return nil
+	}
+
+	return changes
+}
+
+// sameExcludes returns true if both lists of exclude patterns are equal.
+func sameExcludes(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
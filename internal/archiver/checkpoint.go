@@ -0,0 +1,192 @@
+package archiver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+)
+
+// checkpoint collects the nodes of all files and directories which have been
+// saved completely during a backup, so that a partial snapshot can be
+// written while the backup is still running.
+type checkpoint struct {
+	m    sync.Mutex
+	root *checkpointDir
+}
+
+// checkpointDir is a directory which has not been saved completely yet.
+type checkpointDir struct {
+	// nodes contains the files and directories which are complete.
+	nodes map[string]*restic.Node
+	// dirs contains the directories which are still being processed.
+	dirs map[string]*checkpointDir
+}
+
+func newCheckpointDir() *checkpointDir {
+	return &checkpointDir{
+		nodes: make(map[string]*restic.Node),
+		dirs:  make(map[string]*checkpointDir),
+	}
+}
+
+func newCheckpoint() *checkpoint {
+	return &checkpoint{root: newCheckpointDir()}
+}
+
+// add records that the item at path (relative to the root of the snapshot) is
+// complete. For a directory, the entries recorded before are replaced by the
+// node.
+func (c *checkpoint) add(path string, node *restic.Node) {
+	if path == "" || path == "." {
+		return
+	}
+
+	n := *node
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	dir := c.root
+	names := strings.Split(filepath.Clean(path), string(filepath.Separator))
+	for _, name := range names[:len(names)-1] {
+		sub, ok := dir.dirs[name]
+		if !ok {
+			sub = newCheckpointDir()
+			dir.dirs[name] = sub
+		}
+		dir = sub
+	}
+
+	name := names[len(names)-1]
+	delete(dir.dirs, name)
+	dir.nodes[name] = &n
+}
+
+// saveTree saves the tree for dir and all incomplete subdirectories. The
+// lock must be held by the caller. It returns a null ID if dir does not
+// contain anything.
+func (c *checkpoint) saveTree(ctx context.Context, arch *Archiver, dir *checkpointDir) (restic.ID, error) {
+	tree := restic.NewTree()
+
+	for name, node := range dir.nodes {
+		n := *node
+		n.Name = name
+		if err := tree.Insert(&n); err != nil {
+			return restic.ID{}, err
+		}
+	}
+
+	for name, sub := range dir.dirs {
+		id, err := c.saveTree(ctx, arch, sub)
+		if err != nil {
+			return restic.ID{}, err
+		}
+
+		if id.IsNull() {
+			continue
+		}
+
+		node := &restic.Node{
+			Name:    name,
+			Type:    "dir",
+			Mode:    os.ModeDir | 0700,
+			Subtree: &id,
+		}
+		if err = tree.Insert(node); err != nil {
+			return restic.ID{}, err
+		}
+	}
+
+	if len(tree.Nodes) == 0 {
+		return restic.ID{}, nil
+	}
+
+	return arch.SaveTreeJSON(ctx, tree)
+}
+
+// writeCheckpoint saves the tree for the items completed so far, flushes the
+// repository and saves a checkpoint snapshot based on sn. When nothing has
+// been completed yet, a null ID is returned.
+func (arch *Archiver) writeCheckpoint(ctx context.Context, sn *restic.Snapshot) (restic.ID, error) {
+	arch.checkpoint.m.Lock()
+	id, err := arch.checkpoint.saveTree(ctx, arch, arch.checkpoint.root)
+	arch.checkpoint.m.Unlock()
+
+	if err != nil || id.IsNull() {
+		return restic.ID{}, err
+	}
+
+	// all blobs referenced by the tree are stored in packs which are not in
+	// use, so flushing writes them to the backend
+	err = arch.repo.Flush(ctx)
+	if err != nil {
+		return restic.ID{}, err
+	}
+
+	err = arch.repo.SaveIndex(ctx)
+	if err != nil {
+		return restic.ID{}, err
+	}
+
+	cp := *sn
+	cp.Tree = &id
+	cp.Checkpoint = true
+	cp.Journals = nil
+	cp.Canary = nil
+	cp.Summary = nil
+
+	return arch.repo.SaveJSONUnpacked(ctx, restic.SnapshotFile, &cp)
+}
+
+// saveCheckpoints regularly writes a checkpoint snapshot based on sn until
+// shutdownCtx is cancelled. The IDs of all checkpoints are appended to ids.
+func (arch *Archiver) saveCheckpoints(ctx, shutdownCtx context.Context, wg *sync.WaitGroup, sn *restic.Snapshot, ids *restic.IDs) {
+	defer wg.Done()
+
+	ticker := time.NewTicker(arch.CheckpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-shutdownCtx.Done():
+			return
+		case <-ticker.C:
+			debug.Log("writing checkpoint")
+			id, err := arch.writeCheckpoint(ctx, sn)
+			if err != nil {
+				debug.Log("writing checkpoint returned an error: %v", err)
+				fmt.Fprintf(os.Stderr, "error saving checkpoint: %v\n", err)
+				continue
+			}
+
+			if id.IsNull() {
+				continue
+			}
+
+			debug.Log("saved checkpoint %v", id)
+			*ids = append(*ids, id)
+		}
+	}
+}
+
+// removeCheckpoints removes the checkpoint snapshots ids, which are not needed
+// any more when the backup is complete.
+func (arch *Archiver) removeCheckpoints(ctx context.Context, ids restic.IDs) {
+	for _, id := range ids {
+		h := restic.Handle{Type: restic.SnapshotFile, Name: id.String()}
+		err := arch.repo.Backend().Remove(ctx, h)
+		if err != nil {
+			debug.Log("unable to remove checkpoint %v: %v", id, err)
+			fmt.Fprintf(os.Stderr, "unable to remove checkpoint %v: %v\n", id.Str(), err)
+		}
+	}
+}
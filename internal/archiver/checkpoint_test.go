@@ -0,0 +1,72 @@
+package archiver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestCheckpointTree(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	arch := New(repo)
+	arch.checkpoint = newCheckpoint()
+
+	file := func(name string, seed int) *restic.Node {
+		data := rtest.Random(seed, 100)
+		id := restic.Hash(data)
+		rtest.OK(t, arch.Save(context.TODO(), restic.DataBlob, data, id))
+		return &restic.Node{Name: name, Type: "file", Size: 100, Content: restic.IDs{id}}
+	}
+
+	sub := restic.NewTree()
+	rtest.OK(t, sub.Insert(file("file1", 1)))
+	rtest.OK(t, sub.Insert(file("file2", 2)))
+	subID, err := arch.SaveTreeJSON(context.TODO(), sub)
+	rtest.OK(t, err)
+
+	// the entries of a complete directory are replaced by its node
+	arch.checkpoint.add("target/complete/file1", sub.Nodes[0])
+	arch.checkpoint.add("target/complete/file2", sub.Nodes[1])
+	arch.checkpoint.add("target/complete", &restic.Node{Name: "complete", Type: "dir", Subtree: &subID})
+	arch.checkpoint.add("target/partial/file3", file("file3", 3))
+
+	sn, err := restic.NewSnapshot([]string{"/home/user/target"}, nil, "localhost", time.Now())
+	rtest.OK(t, err)
+
+	id, err := arch.writeCheckpoint(context.TODO(), sn)
+	rtest.OK(t, err)
+
+	cp, err := restic.LoadSnapshot(context.TODO(), repo, id)
+	rtest.OK(t, err)
+	rtest.Assert(t, cp.Checkpoint, "snapshot %v is not marked as checkpoint", id.Str())
+
+	root, err := repo.LoadTree(context.TODO(), *cp.Tree)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(root.Nodes))
+
+	target, err := repo.LoadTree(context.TODO(), *root.Nodes[0].Subtree)
+	rtest.OK(t, err)
+	rtest.Equals(t, 2, len(target.Nodes))
+	rtest.Equals(t, "complete", target.Nodes[0].Name)
+	rtest.Equals(t, subID, *target.Nodes[0].Subtree)
+	rtest.Equals(t, "partial", target.Nodes[1].Name)
+
+	partial, err := repo.LoadTree(context.TODO(), *target.Nodes[1].Subtree)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(partial.Nodes))
+	rtest.Equals(t, "file3", partial.Nodes[0].Name)
+
+	// checkpoints are not returned as the latest snapshot
+	_, err = restic.FindLatestSnapshot(context.TODO(), repo, sn.Paths, nil, "localhost")
+	rtest.Equals(t, restic.ErrNoSnapshotFound, err)
+
+	latest, err := restic.FindLatestCheckpoint(context.TODO(), repo, sn.Paths, "localhost")
+	rtest.OK(t, err)
+	rtest.Equals(t, id, latest)
+}
@@ -0,0 +1,108 @@
+package archiver
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/restic/restic/internal/fs"
+)
+
+// DedupCounter counts the chunks of the files read during a backup, split
+// into chunks which have been added to the repository and chunks which were
+// already stored there.
+type DedupCounter struct {
+	NewChunks   uint64
+	NewBytes    uint64
+	KnownChunks uint64
+	KnownBytes  uint64
+}
+
+func (c *DedupCounter) add(other DedupCounter) {
+	c.NewChunks += other.NewChunks
+	c.NewBytes += other.NewBytes
+	c.KnownChunks += other.KnownChunks
+	c.KnownBytes += other.KnownBytes
+}
+
+// DedupStats collects a DedupCounter for each target of a backup.
+type DedupStats struct {
+	m       sync.Mutex
+	targets []string
+	dirs    map[string]*DedupCounter
+}
+
+// DedupDir is the DedupCounter of a single backup target.
+type DedupDir struct {
+	Path string
+	DedupCounter
+}
+
+func newDedupStats(targets []string) *DedupStats {
+	return &DedupStats{
+		targets: targets,
+		dirs:    make(map[string]*DedupCounter),
+	}
+}
+
+// target returns the backup target which contains path. If path is contained
+// in several targets, the most specific one is returned.
+func (s *DedupStats) target(path string) string {
+	var target string
+	for _, t := range s.targets {
+		if fs.HasPathPrefix(t, path) && len(t) > len(target) {
+			target = t
+		}
+	}
+	return target
+}
+
+// add records a chunk of the file path with the given size.
+func (s *DedupStats) add(path string, bytes uint64, added bool) {
+	target := s.target(path)
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	c, ok := s.dirs[target]
+	if !ok {
+		c = &DedupCounter{}
+		s.dirs[target] = c
+	}
+
+	if added {
+		c.NewChunks++
+		c.NewBytes += bytes
+	} else {
+		c.KnownChunks++
+		c.KnownBytes += bytes
+	}
+}
+
+// Total returns the sum of the counters of all targets.
+func (s *DedupStats) Total() DedupCounter {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	var total DedupCounter
+	for _, c := range s.dirs {
+		total.add(*c)
+	}
+	return total
+}
+
+// Dirs returns the counters of all targets from which files have been read,
+// sorted by path.
+func (s *DedupStats) Dirs() []DedupDir {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	dirs := make([]DedupDir, 0, len(s.dirs))
+	for path, c := range s.dirs {
+		dirs = append(dirs, DedupDir{Path: path, DedupCounter: *c})
+	}
+
+	sort.Slice(dirs, func(i, j int) bool {
+		return dirs[i].Path < dirs[j].Path
+	})
+	return dirs
+}
@@ -0,0 +1,81 @@
+package archiver
+
+import (
+	"context"
+	"sync"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// hardlinks tracks the files with several hard links during a backup, so
+// that the content of such a file is only read once. The nodes of all links
+// share the inode and device ID, which the restorer uses to create the links
+// again.
+type hardlinks struct {
+	m     sync.Mutex
+	files map[hardlinkKey]*hardlinkFile
+}
+
+type hardlinkKey struct {
+	inode, device uint64
+}
+
+// hardlinkFile is a file for which the first link is being saved. done is
+// closed when node has been set, node is nil if the file could not be saved.
+type hardlinkFile struct {
+	done chan struct{}
+	node *restic.Node
+}
+
+func newHardlinks() *hardlinks {
+	return &hardlinks{files: make(map[hardlinkKey]*hardlinkFile)}
+}
+
+// claim returns the entry for the file node is a link to. If first is true,
+// no other link of the file has been seen before and the caller must call
+// finish when the node has been saved.
+func (h *hardlinks) claim(node *restic.Node) (f *hardlinkFile, first bool) {
+	key := hardlinkKey{inode: node.Inode, device: node.DeviceID}
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	f, ok := h.files[key]
+	if ok {
+		return f, false
+	}
+
+	f = &hardlinkFile{done: make(chan struct{})}
+	h.files[key] = f
+	return f, true
+}
+
+// finish records the saved node for the file, nil means that it could not be
+// saved and the other links need to be read.
+func (f *hardlinkFile) finish(node *restic.Node) {
+	f.node = node
+	close(f.done)
+}
+
+// wait returns the node saved for the first link of the file. It returns nil
+// if the first link could not be saved or the file has been modified in the
+// meantime, the content needs to be read again then.
+func (f *hardlinkFile) wait(ctx context.Context, node *restic.Node) *restic.Node {
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+		return nil
+	}
+
+	saved := f.node
+	if saved == nil || saved.Size != node.Size || !saved.ModTime.Equal(node.ModTime) {
+		return nil
+	}
+
+	return saved
+}
+
+// isHardlink returns true if node is a file with several hard links.
+func isHardlink(node *restic.Node) bool {
+	return node.Type == "file" && node.Links > 1 && node.Inode != 0
+}
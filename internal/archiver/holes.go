@@ -0,0 +1,63 @@
+package archiver
+
+import (
+	"io"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+)
+
+// holeReader reads a sparse file. The holes in the file are returned as zero
+// bytes without reading them from the file.
+type holeReader struct {
+	f     fs.File
+	holes []fs.Hole
+	pos   int64
+	seek  bool
+}
+
+func newHoleReader(f fs.File, holes []fs.Hole) *holeReader {
+	return &holeReader{f: f, holes: holes}
+}
+
+func (r *holeReader) Read(p []byte) (int, error) {
+	for len(r.holes) > 0 && r.holes[0].End() <= r.pos {
+		r.holes = r.holes[1:]
+	}
+
+	if len(r.holes) > 0 {
+		h := r.holes[0]
+
+		if h.Offset <= r.pos {
+			n := len(p)
+			if rest := h.End() - r.pos; rest < int64(n) {
+				n = int(rest)
+			}
+
+			for i := range p[:n] {
+				p[i] = 0
+			}
+
+			r.pos += int64(n)
+			r.seek = true
+			return n, nil
+		}
+
+		if rest := h.Offset - r.pos; rest < int64(len(p)) {
+			p = p[:rest]
+		}
+	}
+
+	// continue reading the data after a hole
+	if r.seek {
+		_, err := r.f.Seek(r.pos, io.SeekStart)
+		if err != nil {
+			return 0, errors.Wrap(err, "Seek")
+		}
+		r.seek = false
+	}
+
+	n, err := r.f.Read(p)
+	r.pos += int64(n)
+	return n, err
+}
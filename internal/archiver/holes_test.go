@@ -0,0 +1,40 @@
+package archiver
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/restic/restic/internal/fs"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestHoleReader(t *testing.T) {
+	data := rtest.Random(23, 5000)
+
+	f, err := ioutil.TempFile("", "restic-test-holes-")
+	rtest.OK(t, err)
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+
+	_, err = f.Write(data)
+	rtest.OK(t, err)
+	_, err = f.Seek(0, 0)
+	rtest.OK(t, err)
+
+	holes := []fs.Hole{{Offset: 0, Length: 100}, {Offset: 1000, Length: 2000}, {Offset: 4900, Length: 100}}
+
+	want := append([]byte{}, data...)
+	for _, h := range holes {
+		for i := h.Offset; i < h.End(); i++ {
+			want[i] = 0
+		}
+	}
+
+	buf, err := ioutil.ReadAll(newHoleReader(f, holes))
+	rtest.OK(t, err)
+	rtest.Assert(t, bytes.Equal(want, buf), "wrong data returned, want %d bytes, got %d bytes", len(want), len(buf))
+}
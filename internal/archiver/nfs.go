@@ -0,0 +1,56 @@
+package archiver
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/fs"
+)
+
+// nfsDevices remembers for each device whether it is an NFS mount, so that
+// the file system type only needs to be looked up once per device.
+type nfsDevices struct {
+	m       sync.Mutex
+	devices map[uint64]bool
+}
+
+// onNFS returns true if the item with the FileInfo fi is stored on an NFS
+// mount of the local file system.
+func (arch *Archiver) onNFS(item string, fi os.FileInfo) bool {
+	if _, ok := arch.FS.(fs.Local); !ok || fi == nil {
+		return false
+	}
+
+	dev, err := fs.DeviceID(fi)
+	if err != nil {
+		return false
+	}
+
+	arch.nfs.m.Lock()
+	defer arch.nfs.m.Unlock()
+
+	nfs, ok := arch.nfs.devices[dev]
+	if !ok {
+		// the file itself may be gone already, its directory is on the
+		// same device unless item is a mount point
+		dir := item
+		if !fi.IsDir() {
+			dir = filepath.Dir(item)
+		}
+
+		nfs, err = fs.IsNFS(dir)
+		if err != nil {
+			debug.Log("unable to find the file system type of %v: %v", dir, err)
+			return false
+		}
+
+		if arch.nfs.devices == nil {
+			arch.nfs.devices = make(map[uint64]bool)
+		}
+		arch.nfs.devices[dev] = nfs
+	}
+
+	return nfs
+}
@@ -0,0 +1,84 @@
+package archiver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/pipe"
+	"github.com/restic/restic/internal/restic"
+)
+
+// Scanner traverses the targets of a backup and counts the directories,
+// files and bytes which will be processed. In contrast to ScanFS, it is meant
+// to run concurrently with the archiver, so that the backup does not need to
+// wait until all targets have been traversed.
+type Scanner struct {
+	FS           fs.FS
+	SelectFilter pipe.SelectFunc
+
+	// Result is called with the accumulated statistics for each item found.
+	// When the scan is complete, it is called once more with done set to
+	// true. It is not called concurrently.
+	Result func(item string, s restic.Stat, done bool)
+}
+
+// NewScanner initializes a new Scanner which traverses fsys.
+func NewScanner(fsys fs.FS) *Scanner {
+	return &Scanner{
+		FS:           fsys,
+		SelectFilter: func(item string, fi os.FileInfo) bool { return true },
+		Result:       func(item string, s restic.Stat, done bool) {},
+	}
+}
+
+// Scan traverses the targets. Errors for single items are ignored, the
+// archiver reports them when it reads the items. When ctx is cancelled, Scan
+// returns early without calling Result with done set to true.
+func (s *Scanner) Scan(ctx context.Context, targets []string) error {
+	var stat restic.Stat
+
+	for _, target := range targets {
+		debug.Log("start scan for %v", target)
+		err := fs.WalkFS(s.FS, target, func(item string, fi os.FileInfo, err error) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			if err != nil || fi == nil {
+				debug.Log("error for %v: %v", item, err)
+				return nil
+			}
+
+			if !s.SelectFilter(item, fi) {
+				if fi.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if fi.IsDir() {
+				stat.Dirs++
+			} else {
+				stat.Files++
+				if isRegularFile(fi) {
+					stat.Bytes += uint64(fi.Size())
+				}
+			}
+
+			s.Result(item, stat, false)
+			return nil
+		})
+
+		debug.Log("scan for %v done, err: %v", target, err)
+		if err != nil {
+			return errors.Wrap(err, "fs.Walk")
+		}
+	}
+
+	s.Result("", stat, true)
+	return nil
+}
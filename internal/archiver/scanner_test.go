@@ -0,0 +1,73 @@
+package archiver_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestScanner(t *testing.T) {
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	rtest.OK(t, os.MkdirAll(filepath.Join(dir, "sub", "excluded"), 0755))
+	files := map[string]string{
+		"a":                                   "content of a",
+		filepath.Join("sub", "b"):             "b",
+		filepath.Join("sub", "excluded", "c"): "content of c",
+	}
+	for name, data := range files {
+		rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644))
+	}
+
+	sc := archiver.NewScanner(fs.Local{})
+	sc.SelectFilter = func(item string, fi os.FileInfo) bool {
+		return filepath.Base(item) != "excluded"
+	}
+
+	var (
+		result restic.Stat
+		items  int
+		done   bool
+	)
+	sc.Result = func(item string, s restic.Stat, d bool) {
+		if done {
+			t.Errorf("Result called after the scan was done")
+		}
+		if !d {
+			items++
+		}
+		result, done = s, d
+	}
+
+	rtest.OK(t, sc.Scan(context.TODO(), []string{dir}))
+
+	rtest.Assert(t, done, "last call to Result did not report the scan as done")
+	rtest.Equals(t, restic.Stat{Dirs: 2, Files: 2, Bytes: 13}, result)
+	rtest.Equals(t, 4, items)
+}
+
+func TestScannerCancel(t *testing.T) {
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "a"), []byte("a"), 0644))
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+
+	sc := archiver.NewScanner(fs.Local{})
+	sc.Result = func(item string, s restic.Stat, done bool) {
+		t.Errorf("Result called for a cancelled scan")
+	}
+
+	err := sc.Scan(ctx, []string{dir})
+	rtest.Assert(t, err != nil, "expected error for cancelled scan")
+}
@@ -0,0 +1,174 @@
+package archiver
+
+import (
+	"context"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+)
+
+// futureTree is a tree which is being saved in the background. The ID of the
+// tree is known right away, done is closed when the tree and all trees of its
+// subdirectories are stored in the repository.
+type futureTree struct {
+	id       restic.ID
+	data     []byte
+	children []*futureTree
+	done     chan struct{}
+	onDone   []func(restic.ID)
+}
+
+// pendingTrees contains the trees which are being saved by a treeSaver,
+// indexed by their ID. Trees with the same content, which are submitted by
+// several directories or several tree savers, share the same futureTree.
+type pendingTrees struct {
+	sync.Mutex
+	m map[restic.ID]*futureTree
+}
+
+// treeSaver saves the trees of directories in the background. Directory
+// workers pass on the node of a directory as soon as the ID of its tree is
+// known, so that the parent directory does not wait until a pack of tree
+// blobs has been uploaded, and the upload of trees overlaps with the upload
+// of data.
+type treeSaver struct {
+	arch *Archiver
+	jobs chan *futureTree
+	wg   sync.WaitGroup
+
+	m   sync.Mutex
+	err error
+}
+
+// newTreeSaver starts workers goroutines saving trees for arch. The tree
+// saver must be stopped with wait.
+func newTreeSaver(ctx context.Context, arch *Archiver, workers uint) *treeSaver {
+	ts := &treeSaver{
+		arch: arch,
+		jobs: make(chan *futureTree),
+	}
+
+	for i := uint(0); i < workers; i++ {
+		ts.wg.Add(1)
+		go ts.worker(ctx)
+	}
+
+	return ts
+}
+
+// encodeTree returns the JSON representation of the tree and its ID.
+func (arch *Archiver) encodeTree(tree *restic.Tree) ([]byte, restic.ID, error) {
+	for _, node := range tree.Nodes {
+		node.MetadataDigest = node.ComputeMetadataDigest()
+	}
+
+	data, err := restic.EncodeTree(tree)
+	if err != nil {
+		return nil, restic.ID{}, err
+	}
+
+	return data, restic.Hash(data), nil
+}
+
+// Save serializes the tree and schedules it to be saved, the returned ID is
+// valid right away. The trees of subdirectories which are still being saved
+// by any tree saver are waited for before the tree is considered done.
+// onDone, if not nil, is called with the ID once the tree is done.
+func (ts *treeSaver) Save(tree *restic.Tree, onDone func(restic.ID)) (restic.ID, error) {
+	data, id, err := ts.arch.encodeTree(tree)
+	if err != nil {
+		return restic.ID{}, err
+	}
+
+	pending := &ts.arch.pendingTrees
+
+	pending.Lock()
+	if f, ok := pending.m[id]; ok {
+		if onDone != nil {
+			f.onDone = append(f.onDone, onDone)
+		}
+		pending.Unlock()
+		debug.Log("tree %v is already being saved", id.Str())
+		return id, nil
+	}
+
+	f := &futureTree{
+		id:   id,
+		data: data,
+		done: make(chan struct{}),
+	}
+	if onDone != nil {
+		f.onDone = append(f.onDone, onDone)
+	}
+
+	for _, node := range tree.Nodes {
+		if node.Type != "dir" || node.Subtree == nil {
+			continue
+		}
+
+		if child, ok := pending.m[*node.Subtree]; ok {
+			f.children = append(f.children, child)
+		}
+	}
+
+	if pending.m == nil {
+		pending.m = make(map[restic.ID]*futureTree)
+	}
+	pending.m[id] = f
+	pending.Unlock()
+
+	ts.jobs <- f
+	return id, nil
+}
+
+// worker saves the trees received from the jobs channel until it is closed.
+// Subtrees are always submitted before their parent, so the children a tree
+// waits for are already being saved by other workers.
+func (ts *treeSaver) worker(ctx context.Context) {
+	defer ts.wg.Done()
+
+	for f := range ts.jobs {
+		if !ts.arch.isKnownBlob(f.id, restic.TreeBlob) {
+			_, err := ts.arch.repo.SaveBlob(ctx, restic.TreeBlob, f.data, f.id)
+			if err != nil {
+				debug.Log("saving tree %v failed: %v", f.id.Str(), err)
+				ts.m.Lock()
+				if ts.err == nil {
+					ts.err = err
+				}
+				ts.m.Unlock()
+			}
+		}
+
+		for _, child := range f.children {
+			<-child.done
+		}
+
+		pending := &ts.arch.pendingTrees
+		pending.Lock()
+		delete(pending.m, f.id)
+		onDone := f.onDone
+		pending.Unlock()
+
+		f.data = nil
+		f.children = nil
+		close(f.done)
+
+		for _, fn := range onDone {
+			fn(f.id)
+		}
+	}
+}
+
+// wait stops the tree saver after all trees submitted so far have been saved
+// and returns the first error which occurred. Save must not be called
+// afterwards.
+func (ts *treeSaver) wait() error {
+	close(ts.jobs)
+	ts.wg.Wait()
+
+	ts.m.Lock()
+	defer ts.m.Unlock()
+	return ts.err
+}
@@ -0,0 +1,61 @@
+package archiver
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestTreeSaver(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	arch := New(repo)
+	ts := newTreeSaver(context.TODO(), arch, 2)
+
+	var (
+		m    sync.Mutex
+		done []restic.ID
+	)
+	onDone := func(id restic.ID) {
+		m.Lock()
+		done = append(done, id)
+		m.Unlock()
+	}
+
+	sub := restic.NewTree()
+	rtest.OK(t, sub.Insert(&restic.Node{Name: "file", Type: "file"}))
+	subID, err := ts.Save(sub, onDone)
+	rtest.OK(t, err)
+
+	root := restic.NewTree()
+	rtest.OK(t, root.Insert(&restic.Node{Name: "sub", Type: "dir", Subtree: &subID}))
+	rootID, err := ts.Save(root, onDone)
+	rtest.OK(t, err)
+
+	// a tree with the same content is only saved once
+	sameID, err := ts.Save(root, onDone)
+	rtest.OK(t, err)
+	rtest.Equals(t, rootID, sameID)
+
+	rtest.OK(t, ts.wait())
+
+	rtest.Equals(t, 3, len(done))
+	rtest.Equals(t, subID, done[0])
+	rtest.Equals(t, rootID, done[1])
+	rtest.Equals(t, rootID, done[2])
+	rtest.Equals(t, 0, len(arch.pendingTrees.m))
+
+	rtest.OK(t, repo.Flush(context.TODO()))
+
+	tree, err := repo.LoadTree(context.TODO(), rootID)
+	rtest.OK(t, err)
+	rtest.Equals(t, subID, *tree.Nodes[0].Subtree)
+
+	_, err = repo.LoadTree(context.TODO(), subID)
+	rtest.OK(t, err)
+}
@@ -0,0 +1,20 @@
+// +build !windows
+
+package archiver
+
+import (
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// journalPositions returns the current position of the change journal for
+// all volumes the paths are located on.
+func journalPositions(paths []string) ([]restic.JournalPosition, error) {
+	return nil, errors.New("change journal is not supported on this platform")
+}
+
+// journalChanges returns the directories modified since the positions old
+// were recorded.
+func journalChanges(old []restic.JournalPosition, paths []string) (ChangeSet, error) {
+	return nil, errors.New("change journal is not supported on this platform")
+}
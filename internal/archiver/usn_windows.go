@@ -0,0 +1,328 @@
+package archiver
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"golang.org/x/sys/windows"
+)
+
+const (
+	fsctlQueryUSNJournal = 0x000900f4
+	fsctlReadUSNJournal  = 0x000900bb
+
+	fileAttributeDirectory = 0x10
+	usnReasonRenameNewName = 0x00002000
+
+	// usnRecordHeaderSize is the size of USN_RECORD_V2 without the file name.
+	usnRecordHeaderSize = 60
+)
+
+var (
+	modkernel32                   = windows.NewLazySystemDLL("kernel32.dll")
+	procOpenFileByID              = modkernel32.NewProc("OpenFileById")
+	procGetFinalPathNameByHandleW = modkernel32.NewProc("GetFinalPathNameByHandleW")
+)
+
+// usnJournalData is USN_JOURNAL_DATA_V0.
+type usnJournalData struct {
+	UsnJournalID    uint64
+	FirstUsn        int64
+	NextUsn         int64
+	LowestValidUsn  int64
+	MaxUsn          int64
+	MaximumSize     uint64
+	AllocationDelta uint64
+}
+
+// readUSNJournalData is READ_USN_JOURNAL_DATA_V0.
+type readUSNJournalData struct {
+	StartUsn          int64
+	ReasonMask        uint32
+	ReturnOnlyOnClose uint32
+	Timeout           uint64
+	BytesToWaitFor    uint64
+	UsnJournalID      uint64
+}
+
+// fileIDDescriptor is FILE_ID_DESCRIPTOR with the type FileIdType.
+type fileIDDescriptor struct {
+	Size   uint32
+	Type   uint32
+	FileID uint64
+	_      [8]byte
+}
+
+// volumes returns the sorted list of volumes the paths are located on.
+func volumes(paths []string) ([]string, error) {
+	seen := make(map[string]struct{})
+	var vols []string
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "Abs")
+		}
+
+		vol := strings.ToUpper(filepath.VolumeName(abs))
+		if len(vol) != 2 || vol[1] != ':' {
+			return nil, errors.Errorf("no change journal available for %v", path)
+		}
+
+		if _, ok := seen[vol]; !ok {
+			seen[vol] = struct{}{}
+			vols = append(vols, vol)
+		}
+	}
+
+	return vols, nil
+}
+
+// openVolume opens the volume vol (e.g. "C:"), which requires administrator
+// privileges.
+func openVolume(vol string) (windows.Handle, error) {
+	name, err := windows.UTF16PtrFromString(`\\.\` + vol)
+	if err != nil {
+		return windows.InvalidHandle, err
+	}
+
+	h, err := windows.CreateFile(name, windows.GENERIC_READ,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE, nil, windows.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return windows.InvalidHandle, errors.Wrapf(err, "open volume %v", vol)
+	}
+
+	return h, nil
+}
+
+func queryJournal(h windows.Handle) (usnJournalData, error) {
+	var data usnJournalData
+	var n uint32
+	err := windows.DeviceIoControl(h, fsctlQueryUSNJournal, nil, 0,
+		(*byte)(unsafe.Pointer(&data)), uint32(unsafe.Sizeof(data)), &n, nil)
+	if err != nil {
+		return data, errors.Wrap(err, "query USN journal")
+	}
+
+	return data, nil
+}
+
+// journalPositions returns the current position of the change journal for
+// all volumes the paths are located on.
+func journalPositions(paths []string) ([]restic.JournalPosition, error) {
+	vols, err := volumes(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	var positions []restic.JournalPosition
+	for _, vol := range vols {
+		h, err := openVolume(vol)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := queryJournal(h)
+		_ = windows.CloseHandle(h)
+		if err != nil {
+			return nil, err
+		}
+
+		positions = append(positions, restic.JournalPosition{
+			Volume:    vol,
+			JournalID: data.UsnJournalID,
+			USN:       data.NextUsn,
+		})
+	}
+
+	return positions, nil
+}
+
+// journalChanges returns the directories modified since the positions old
+// were recorded.
+func journalChanges(old []restic.JournalPosition, paths []string) (ChangeSet, error) {
+	vols, err := volumes(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := newChangedDirs(true)
+	for _, vol := range vols {
+		var pos *restic.JournalPosition
+		for i := range old {
+			if strings.EqualFold(old[i].Volume, vol) {
+				pos = &old[i]
+				break
+			}
+		}
+
+		if pos == nil {
+			return nil, errors.Errorf("no journal position recorded for volume %v", vol)
+		}
+
+		err = readVolumeChanges(vol, *pos, changes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return changes, nil
+}
+
+// readVolumeChanges adds all directories on vol modified since pos to changes.
+func readVolumeChanges(vol string, pos restic.JournalPosition, changes *changedDirs) error {
+	h, err := openVolume(vol)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(h)
+
+	data, err := queryJournal(h)
+	if err != nil {
+		return err
+	}
+
+	if data.UsnJournalID != pos.JournalID {
+		return errors.Errorf("change journal of volume %v has been recreated", vol)
+	}
+
+	if pos.USN < data.LowestValidUsn {
+		return errors.Errorf("change journal of volume %v does not go back far enough", vol)
+	}
+
+	paths := make(map[uint64]string)
+	resolve := func(ref uint64) (string, bool) {
+		if p, ok := paths[ref]; ok {
+			return p, p != ""
+		}
+
+		p, err := pathByFileID(h, ref)
+		if err != nil {
+			// The directory does not exist any more. Its removal is
+			// recorded in the journal as well, which marks its parent
+			// directory as modified.
+			debug.Log("unable to resolve file ID %x: %v", ref, err)
+		}
+		paths[ref] = p
+		return p, p != ""
+	}
+
+	var records int
+	err = readJournal(h, data.UsnJournalID, pos.USN, data.NextUsn, func(parentRef uint64, name string, reason, attr uint32) {
+		records++
+
+		parent, ok := resolve(parentRef)
+		if !ok {
+			return
+		}
+
+		changes.AddDir(parent)
+
+		// the contents of a directory moved to a new place are not known
+		if attr&fileAttributeDirectory != 0 && reason&usnReasonRenameNewName != 0 {
+			changes.AddTree(filepath.Join(parent, name))
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	debug.Log("read %d records from the change journal of %v", records, vol)
+	return nil
+}
+
+// readJournal calls fn for each record in the journal between start and end.
+func readJournal(h windows.Handle, journalID uint64, start, end int64, fn func(parentRef uint64, name string, reason, attr uint32)) error {
+	buf := make([]byte, 64*1024)
+	req := readUSNJournalData{
+		StartUsn:     start,
+		ReasonMask:   0xffffffff,
+		UsnJournalID: journalID,
+	}
+
+	for req.StartUsn < end {
+		var n uint32
+		err := windows.DeviceIoControl(h, fsctlReadUSNJournal,
+			(*byte)(unsafe.Pointer(&req)), uint32(unsafe.Sizeof(req)),
+			&buf[0], uint32(len(buf)), &n, nil)
+		if err != nil {
+			return errors.Wrap(err, "read USN journal")
+		}
+
+		if n < 8 {
+			return nil
+		}
+
+		next := int64(binary.LittleEndian.Uint64(buf))
+		for rec := buf[8:n]; len(rec) >= usnRecordHeaderSize; {
+			length := binary.LittleEndian.Uint32(rec)
+			if length < usnRecordHeaderSize || int(length) > len(rec) {
+				return errors.New("invalid USN record")
+			}
+
+			if major := binary.LittleEndian.Uint16(rec[4:]); major != 2 {
+				return errors.Errorf("unsupported USN record version %d", major)
+			}
+
+			parentRef := binary.LittleEndian.Uint64(rec[16:])
+			reason := binary.LittleEndian.Uint32(rec[40:])
+			attr := binary.LittleEndian.Uint32(rec[52:])
+			nameLen := int(binary.LittleEndian.Uint16(rec[56:]))
+			nameOff := int(binary.LittleEndian.Uint16(rec[58:]))
+			if nameOff+nameLen > int(length) {
+				return errors.New("invalid USN record")
+			}
+
+			name := make([]uint16, nameLen/2)
+			for i := range name {
+				name[i] = binary.LittleEndian.Uint16(rec[nameOff+2*i:])
+			}
+
+			fn(parentRef, string(utf16.Decode(name)), reason, attr)
+			rec = rec[length:]
+		}
+
+		if next == req.StartUsn {
+			return nil
+		}
+		req.StartUsn = next
+	}
+
+	return nil
+}
+
+// pathByFileID returns the path of the file with the ID ref on the volume h.
+func pathByFileID(h windows.Handle, ref uint64) (string, error) {
+	desc := fileIDDescriptor{FileID: ref}
+	desc.Size = uint32(unsafe.Sizeof(desc))
+
+	r, _, err := procOpenFileByID.Call(uintptr(h), uintptr(unsafe.Pointer(&desc)), 0,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
+		0, windows.FILE_FLAG_BACKUP_SEMANTICS)
+	f := windows.Handle(r)
+	if f == windows.InvalidHandle {
+		return "", errors.Wrap(err, "OpenFileById")
+	}
+	defer windows.CloseHandle(f)
+
+	buf := make([]uint16, syscall.MAX_PATH)
+	for {
+		r, _, err = procGetFinalPathNameByHandleW.Call(uintptr(f), uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)), 0)
+		if r == 0 {
+			return "", errors.Wrap(err, "GetFinalPathNameByHandle")
+		}
+
+		if int(r) < len(buf) {
+			break
+		}
+		buf = make([]uint16, r)
+	}
+
+	return strings.TrimPrefix(windows.UTF16ToString(buf), `\\?\`), nil
+}
@@ -0,0 +1,106 @@
+package archive_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/backend/archive"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testFiles() map[restic.Handle][]byte {
+	files := make(map[restic.Handle][]byte)
+	files[restic.Handle{Type: restic.ConfigFile}] = []byte("the repository config")
+	for i, tpe := range []restic.FileType{restic.DataFile, restic.DataFile, restic.IndexFile, restic.SnapshotFile, restic.KeyFile} {
+		data := rtest.Random(23+i, 100+i*1000)
+		files[restic.Handle{Type: tpe, Name: restic.Hash(data).String()}] = data
+	}
+	return files
+}
+
+func saveFiles(t testing.TB, wr *archive.Writer, files map[restic.Handle][]byte) {
+	for h, data := range files {
+		rtest.OK(t, wr.Save(context.TODO(), h, restic.NewByteReader(data)))
+	}
+	rtest.OK(t, wr.Close())
+}
+
+func checkArchive(t testing.TB, filename string, files map[restic.Handle][]byte) {
+	be, err := archive.Open(filename)
+	rtest.OK(t, err)
+	defer be.Close()
+
+	for h, data := range files {
+		fi, err := be.Stat(context.TODO(), h)
+		rtest.OK(t, err)
+		rtest.Equals(t, int64(len(data)), fi.Size)
+
+		var buf []byte
+		err = be.Load(context.TODO(), h, 10, 5, func(rd io.Reader) (ierr error) {
+			buf, ierr = ioutil.ReadAll(rd)
+			return ierr
+		})
+		rtest.OK(t, err)
+
+		if !bytes.Equal(buf, data[5:15]) {
+			t.Errorf("wrong data returned for %v", h)
+		}
+	}
+
+	var snapshots int
+	rtest.OK(t, be.List(context.TODO(), restic.SnapshotFile, func(fi restic.FileInfo) error {
+		snapshots++
+		return nil
+	}))
+	rtest.Equals(t, 1, snapshots)
+
+	_, err = be.Stat(context.TODO(), restic.Handle{Type: restic.LockFile, Name: "foo"})
+	rtest.Assert(t, be.IsNotExist(err), "expected not found error, got %v", err)
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	files := testFiles()
+
+	filename := filepath.Join(dir, "archive.tar")
+	f, err := os.Create(filename)
+	rtest.OK(t, err)
+
+	saveFiles(t, archive.Create(f), files)
+	rtest.OK(t, f.Close())
+
+	checkArchive(t, filename, files)
+}
+
+func TestArchiveVolumes(t *testing.T) {
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	files := testFiles()
+
+	const maxSize = 8 * 1024
+	filename := filepath.Join(dir, "archive.tar")
+	wr, err := archive.CreateVolumes(filename, maxSize)
+	rtest.OK(t, err)
+	saveFiles(t, wr, files)
+
+	volumes, err := filepath.Glob(filename + ".*")
+	rtest.OK(t, err)
+	rtest.Assert(t, len(volumes) > 1, "expected several volumes, got %v", volumes)
+
+	for _, vol := range volumes {
+		fi, err := os.Stat(vol)
+		rtest.OK(t, err)
+		rtest.Assert(t, fi.Size() <= maxSize, "volume %v is too large: %d bytes", vol, fi.Size())
+	}
+
+	checkArchive(t, filename, files)
+}
@@ -0,0 +1,3 @@
+// Package archive implements repository storage in a tar archive, which can
+// be used to move snapshots to offline media.
+package archive
@@ -0,0 +1,271 @@
+package archive
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// make sure that *Reader implements restic.Backend
+var _ restic.Backend = &Reader{}
+
+var errNotFound = errors.New("not found")
+
+var errReadOnly = errors.New("archive is read-only")
+
+// archiveTypes maps the directory names within an archive to file types.
+var archiveTypes = map[string]restic.FileType{
+	"data":      restic.DataFile,
+	"snapshots": restic.SnapshotFile,
+	"index":     restic.IndexFile,
+	"keys":      restic.KeyFile,
+	"stats":     restic.StatsFile,
+}
+
+// entry is the position of a file within the archive.
+type entry struct {
+	vol    int
+	offset int64
+	size   int64
+}
+
+// Reader is a read-only backend which accesses the files within a tar
+// archive written by Writer.
+type Reader struct {
+	filename string
+	vols     []*os.File
+	files    map[restic.Handle]entry
+}
+
+// Open returns a backend to access the files in the archive filename, which
+// is either a tar archive or the volume index of an archive split into
+// volumes.
+func Open(filename string) (*Reader, error) {
+	be := &Reader{
+		filename: filename,
+		files:    make(map[restic.Handle]entry),
+	}
+
+	idx, ok, err := readVolumeIndex(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		err = be.openVolumes(idx)
+	} else {
+		err = be.scan(filename)
+	}
+
+	if err != nil {
+		_ = be.Close()
+		return nil, err
+	}
+
+	debug.Log("found %d files in %d volumes of archive %v", len(be.files), len(be.vols), filename)
+	return be, nil
+}
+
+// openVolumes opens all volumes listed in idx, which are expected in the
+// same directory as the index.
+func (be *Reader) openVolumes(idx volumeIndex) error {
+	dir := filepath.Dir(be.filename)
+	for i, vol := range idx.Volumes {
+		f, err := fs.OpenFile(filepath.Join(dir, vol.Name), os.O_RDONLY, 0)
+		if err != nil {
+			return errors.Wrap(err, "Open")
+		}
+		be.vols = append(be.vols, f)
+
+		for _, file := range vol.Files {
+			h, ok := parseName(file.Path)
+			if !ok {
+				debug.Log("ignoring unknown file %v in volume %v", file.Path, vol.Name)
+				continue
+			}
+
+			be.files[h] = entry{vol: i, offset: file.Offset, size: file.Size}
+		}
+	}
+
+	return nil
+}
+
+// scan reads the list of files from the tar archive filename.
+func (be *Reader) scan(filename string) error {
+	f, err := fs.OpenFile(filename, os.O_RDONLY, 0)
+	if err != nil {
+		return errors.Wrap(err, "Open")
+	}
+	be.vols = append(be.vols, f)
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return errors.Wrap(err, "Next")
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		h, ok := parseName(hdr.Name)
+		if !ok {
+			debug.Log("ignoring unknown file %v in archive", hdr.Name)
+			continue
+		}
+
+		// the tar reader does not read ahead, so the data starts at the
+		// current position
+		offset, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return errors.Wrap(err, "Seek")
+		}
+
+		be.files[h] = entry{offset: offset, size: hdr.Size}
+	}
+}
+
+// parseName returns the handle for the file name within an archive.
+func parseName(name string) (restic.Handle, bool) {
+	name = path.Clean(name)
+	if name == "config" {
+		return restic.Handle{Type: restic.ConfigFile}, true
+	}
+
+	dir := name
+	if i := strings.Index(name, "/"); i >= 0 {
+		dir = name[:i]
+	}
+
+	t, ok := archiveTypes[dir]
+	if !ok || dir == name {
+		return restic.Handle{}, false
+	}
+
+	return restic.Handle{Type: t, Name: path.Base(name)}, true
+}
+
+// Location returns the file name of the archive.
+func (be *Reader) Location() string {
+	return be.filename
+}
+
+// Test returns whether a file exists in the archive.
+func (be *Reader) Test(ctx context.Context, h restic.Handle) (bool, error) {
+	_, ok := be.files[normalize(h)]
+	return ok, nil
+}
+
+// Save is not supported.
+func (be *Reader) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	return errReadOnly
+}
+
+// Load runs fn with a reader that yields the contents of the file at h at the
+// given offset.
+func (be *Reader) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	return backend.DefaultLoad(ctx, h, length, offset, be.openReader, fn)
+}
+
+func (be *Reader) openReader(ctx context.Context, h restic.Handle, length int, offset int64) (io.ReadCloser, error) {
+	if err := h.Valid(); err != nil {
+		return nil, err
+	}
+
+	if offset < 0 {
+		return nil, errors.New("offset is negative")
+	}
+
+	e, ok := be.files[normalize(h)]
+	if !ok {
+		return nil, errNotFound
+	}
+
+	if offset > e.size {
+		return nil, errors.New("offset beyond end of file")
+	}
+
+	size := e.size - offset
+	if length > 0 && int64(length) < size {
+		size = int64(length)
+	}
+
+	return ioutil.NopCloser(io.NewSectionReader(be.vols[e.vol], e.offset+offset, size)), nil
+}
+
+// Stat returns information about a file in the archive.
+func (be *Reader) Stat(ctx context.Context, h restic.Handle) (restic.FileInfo, error) {
+	if err := h.Valid(); err != nil {
+		return restic.FileInfo{}, err
+	}
+
+	e, ok := be.files[normalize(h)]
+	if !ok {
+		return restic.FileInfo{}, errNotFound
+	}
+
+	return restic.FileInfo{Size: e.size, Name: h.Name}, nil
+}
+
+// List runs fn for each file of type t in the archive.
+func (be *Reader) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
+	for h, e := range be.files {
+		if h.Type != t {
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		err := fn(restic.FileInfo{Name: h.Name, Size: e.size})
+		if err != nil {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
+
+// IsNotExist returns true if the file does not exist.
+func (be *Reader) IsNotExist(err error) bool {
+	return errors.Cause(err) == errNotFound
+}
+
+// Remove is not supported.
+func (be *Reader) Remove(ctx context.Context, h restic.Handle) error {
+	return errReadOnly
+}
+
+// Delete is not supported.
+func (be *Reader) Delete(ctx context.Context) error {
+	return errReadOnly
+}
+
+// Close closes the archive.
+func (be *Reader) Close() error {
+	var firstErr error
+	for _, f := range be.vols {
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = errors.Wrap(err, "Close")
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,72 @@
+package archive
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+)
+
+// blockSize is the size of a block in a tar archive.
+const blockSize = 512
+
+// volumeIndex lists the files within each volume of an archive, so that an
+// archive can be opened without reading all volumes.
+type volumeIndex struct {
+	Volumes []volume `json:"volumes"`
+}
+
+// volume is a single tar archive.
+type volume struct {
+	Name  string       `json:"name"`
+	Files []volumeFile `json:"files"`
+}
+
+// volumeFile is the position of a file within a volume.
+type volumeFile struct {
+	Path   string `json:"path"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+}
+
+// current returns the volume written last.
+func (idx *volumeIndex) current() *volume {
+	return &idx.Volumes[len(idx.Volumes)-1]
+}
+
+func writeVolumeIndex(filename string, idx volumeIndex) error {
+	buf, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "MarshalIndent")
+	}
+
+	return errors.Wrap(ioutil.WriteFile(filename, buf, 0600), "WriteFile")
+}
+
+// readVolumeIndex loads the volume index from filename. If the file is not a
+// volume index (but e.g. a tar archive), false is returned.
+func readVolumeIndex(filename string) (volumeIndex, bool, error) {
+	var idx volumeIndex
+
+	f, err := fs.OpenFile(filename, os.O_RDONLY, 0)
+	if err != nil {
+		return idx, false, errors.Wrap(err, "Open")
+	}
+	defer f.Close()
+
+	rd := bufio.NewReader(f)
+	start, err := rd.Peek(1)
+	if err != nil || start[0] != '{' {
+		return idx, false, nil
+	}
+
+	err = json.NewDecoder(rd).Decode(&idx)
+	if err != nil {
+		return idx, false, errors.Wrap(err, "Decode")
+	}
+
+	return idx, true, nil
+}
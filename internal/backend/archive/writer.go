@@ -0,0 +1,297 @@
+package archive
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// make sure that *Writer implements restic.Backend
+var _ restic.Backend = &Writer{}
+
+var errWriteOnly = errors.New("archive is write-only")
+
+// layout is used for the names of the files within an archive.
+var layout = &backend.DefaultLayout{Join: path.Join}
+
+// countingWriter counts the bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// Writer is a write-only backend which stores all files in a tar archive,
+// using the same layout as the local backend. Files are written in the order
+// they are saved, so the archive can be written to a pipe or a tape.
+type Writer struct {
+	m     sync.Mutex
+	tw    *tar.Writer
+	cw    *countingWriter
+	files map[restic.Handle]int64
+
+	// name, maxSize and vol are only set when the archive is split into
+	// volumes, index records the contents of all volumes.
+	name    string
+	maxSize int64
+	vol     *os.File
+	index   volumeIndex
+}
+
+// Create returns a new backend which writes a tar archive to w. Close must be
+// called to complete the archive, w is not closed.
+func Create(w io.Writer) *Writer {
+	be := &Writer{
+		files: make(map[restic.Handle]int64),
+	}
+	be.startVolume("", w)
+	return be
+}
+
+// CreateVolumes returns a new backend which splits the archive into volumes
+// of at most maxSize bytes, each of them a complete tar archive. The volumes
+// are named after the file name with a sequence number appended, e.g.
+// "backup.tar.000". When the backend is closed, the volume index is written
+// to the file name itself, it needs to be passed to Open to read the archive.
+func CreateVolumes(name string, maxSize int64) (*Writer, error) {
+	be := &Writer{
+		files:   make(map[restic.Handle]int64),
+		name:    name,
+		maxSize: maxSize,
+	}
+
+	err := be.nextVolume()
+	if err != nil {
+		return nil, err
+	}
+
+	return be, nil
+}
+
+func (be *Writer) startVolume(name string, w io.Writer) {
+	be.cw = &countingWriter{w: w}
+	be.tw = tar.NewWriter(be.cw)
+	be.index.Volumes = append(be.index.Volumes, volume{Name: name})
+}
+
+// nextVolume completes the current volume and starts a new one.
+func (be *Writer) nextVolume() error {
+	if err := be.closeVolume(); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s.%03d", be.name, len(be.index.Volumes))
+	debug.Log("start volume %v", name)
+
+	f, err := fs.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrap(err, "OpenFile")
+	}
+
+	be.vol = f
+	be.startVolume(filepath.Base(name), f)
+	return nil
+}
+
+// closeVolume completes the current volume, if any.
+func (be *Writer) closeVolume() error {
+	if be.tw == nil {
+		return nil
+	}
+
+	err := be.tw.Close()
+	if err != nil {
+		return errors.Wrap(err, "Close")
+	}
+
+	if be.vol != nil {
+		err = be.vol.Close()
+		be.vol = nil
+		if err != nil {
+			return errors.Wrap(err, "Close")
+		}
+	}
+
+	be.tw = nil
+	return nil
+}
+
+// full returns true if a file with size bytes does not fit into the current
+// volume any more.
+func (be *Writer) full(size int64) bool {
+	if be.maxSize <= 0 || len(be.index.current().Files) == 0 {
+		return false
+	}
+
+	// the file needs a header and is padded to the block size, the end of
+	// the archive is marked by two empty blocks
+	need := blockSize + (size+blockSize-1)/blockSize*blockSize + 2*blockSize
+	return be.cw.n+need > be.maxSize
+}
+
+// Location returns a description of the backend.
+func (be *Writer) Location() string {
+	return "archive"
+}
+
+func normalize(h restic.Handle) restic.Handle {
+	if h.Type == restic.ConfigFile {
+		h.Name = ""
+	}
+	return h
+}
+
+// Test returns whether a file has been saved to the archive.
+func (be *Writer) Test(ctx context.Context, h restic.Handle) (bool, error) {
+	be.m.Lock()
+	defer be.m.Unlock()
+
+	_, ok := be.files[normalize(h)]
+	return ok, nil
+}
+
+// Save appends the data from rd to the archive.
+func (be *Writer) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	if err := h.Valid(); err != nil {
+		return err
+	}
+
+	be.m.Lock()
+	defer be.m.Unlock()
+
+	if _, ok := be.files[normalize(h)]; ok {
+		return errors.New("file already exists")
+	}
+
+	debug.Log("Save %v (%d bytes)", h, rd.Length())
+
+	if be.full(rd.Length()) {
+		if err := be.nextVolume(); err != nil {
+			return err
+		}
+	}
+
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     layout.Filename(h),
+		Mode:     0600,
+		Size:     rd.Length(),
+		ModTime:  time.Now(),
+	}
+
+	err := be.tw.WriteHeader(hdr)
+	if err != nil {
+		return errors.Wrap(err, "WriteHeader")
+	}
+
+	// the header has been written completely, so the data starts here
+	offset := be.cw.n
+
+	n, err := io.Copy(be.tw, rd)
+	if err != nil {
+		return errors.Wrap(err, "Copy")
+	}
+
+	if n != rd.Length() {
+		return errors.Errorf("wrote %d bytes instead of the expected %d bytes", n, rd.Length())
+	}
+
+	be.files[normalize(h)] = n
+
+	vol := be.index.current()
+	vol.Files = append(vol.Files, volumeFile{Path: hdr.Name, Offset: offset, Size: n})
+	return nil
+}
+
+// Load is not supported.
+func (be *Writer) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	return errWriteOnly
+}
+
+// Stat returns information about a file saved to the archive.
+func (be *Writer) Stat(ctx context.Context, h restic.Handle) (restic.FileInfo, error) {
+	be.m.Lock()
+	defer be.m.Unlock()
+
+	size, ok := be.files[normalize(h)]
+	if !ok {
+		return restic.FileInfo{}, errNotFound
+	}
+
+	return restic.FileInfo{Size: size, Name: h.Name}, nil
+}
+
+// List runs fn for all files of type t saved to the archive.
+func (be *Writer) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
+	var entries []restic.FileInfo
+
+	be.m.Lock()
+	for h, size := range be.files {
+		if h.Type == t {
+			entries = append(entries, restic.FileInfo{Name: h.Name, Size: size})
+		}
+	}
+	be.m.Unlock()
+
+	for _, fi := range entries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err := fn(fi); err != nil {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
+
+// IsNotExist returns true if the file does not exist.
+func (be *Writer) IsNotExist(err error) bool {
+	return errors.Cause(err) == errNotFound
+}
+
+// Remove is not supported.
+func (be *Writer) Remove(ctx context.Context, h restic.Handle) error {
+	return errWriteOnly
+}
+
+// Delete is not supported.
+func (be *Writer) Delete(ctx context.Context) error {
+	return errWriteOnly
+}
+
+// Close completes the archive. For archives split into volumes, the volume
+// index is written.
+func (be *Writer) Close() error {
+	be.m.Lock()
+	defer be.m.Unlock()
+
+	err := be.closeVolume()
+	if err != nil {
+		return err
+	}
+
+	if be.name == "" {
+		return nil
+	}
+
+	return writeVolumeIndex(be.name, be.index)
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/storage"
 	"github.com/restic/restic/internal/backend"
@@ -31,6 +32,9 @@ const defaultListMaxItems = 5000
 // make sure that *Backend implements backend.Backend
 var _ restic.Backend = &Backend{}
 
+// make sure that *Backend implements restic.Renamer
+var _ restic.Renamer = &Backend{}
+
 func open(cfg Config, rt http.RoundTripper) (*Backend, error) {
 	debug.Log("open, config %#v", cfg)
 
@@ -250,6 +254,37 @@ func (be *Backend) Remove(ctx context.Context, h restic.Handle) error {
 	return errors.Wrap(err, "client.RemoveObject")
 }
 
+// Rename moves the file from to the handle to. The blob is copied on the
+// server and removed afterwards, its content is not transferred.
+func (be *Backend) Rename(ctx context.Context, from, to restic.Handle) error {
+	debug.Log("Rename %v to %v", from, to)
+	if err := to.Valid(); err != nil {
+		return err
+	}
+
+	src := be.container.GetBlobReference(be.Filename(from))
+	dst := be.container.GetBlobReference(be.Filename(to))
+
+	// the copy fails if the destination blob already exists
+	opts := &storage.CopyOptions{
+		Destiny: storage.CopyOptionsConditions{IfNoneMatch: "*"},
+	}
+
+	be.sem.GetToken()
+	err := dst.Copy(src.GetURL(), opts)
+	be.sem.ReleaseToken()
+
+	if err != nil {
+		return errors.Wrap(err, "blob.Copy")
+	}
+
+	be.sem.GetToken()
+	_, err = src.DeleteIfExists(nil)
+	be.sem.ReleaseToken()
+
+	return errors.Wrap(err, "blob.DeleteIfExists")
+}
+
 // List runs fn for each file in the backend which has the type t. When an
 // error occurs (or fn returns an error), List stops and returns it.
 func (be *Backend) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
@@ -285,8 +320,9 @@ func (be *Backend) List(ctx context.Context, t restic.FileType, fn func(restic.F
 			}
 
 			fi := restic.FileInfo{
-				Name: path.Base(m),
-				Size: item.Properties.ContentLength,
+				Name:    path.Base(m),
+				Size:    item.Properties.ContentLength,
+				ModTime: time.Time(item.Properties.LastModified),
 			}
 
 			if ctx.Err() != nil {
@@ -327,7 +363,11 @@ func (be *Backend) Delete(ctx context.Context) error {
 		restic.KeyFile,
 		restic.LockFile,
 		restic.SnapshotFile,
-		restic.IndexFile}
+		restic.IndexFile,
+		restic.StatsFile,
+		restic.TrashFile,
+		restic.LedgerFile,
+		restic.NewConfigFile}
 
 	for _, t := range alltypes {
 		err := be.removeKeys(ctx, t)
@@ -2,6 +2,8 @@ package b2
 
 import (
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"io"
 	"net/http"
 	"path"
@@ -44,6 +46,10 @@ func newClient(ctx context.Context, cfg Config, rt http.RoundTripper) (*b2.Clien
 func Open(ctx context.Context, cfg Config, rt http.RoundTripper) (restic.Backend, error) {
 	debug.Log("cfg %#v", cfg)
 
+	if err := checkPartSize(cfg.PartSize); err != nil {
+		return nil, err
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
@@ -82,6 +88,10 @@ func Open(ctx context.Context, cfg Config, rt http.RoundTripper) (restic.Backend
 func Create(ctx context.Context, cfg Config, rt http.RoundTripper) (restic.Backend, error) {
 	debug.Log("cfg %#v", cfg)
 
+	if err := checkPartSize(cfg.PartSize); err != nil {
+		return nil, err
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
@@ -171,7 +181,12 @@ func (be *b2Backend) openReader(ctx context.Context, h restic.Handle, length int
 
 	if offset == 0 && length == 0 {
 		rd := obj.NewReader(ctx)
-		return be.sem.ReleaseTokenOnClose(rd, cancel), nil
+
+		// compare the SHA1 hash the service stores for the file when all
+		// data has been read
+		return backend.VerifyReadCloser(be.sem.ReleaseTokenOnClose(rd, cancel), name, sha1.New(), func() ([]byte, error) {
+			return be.sha1Sum(ctx, obj)
+		}), nil
 	}
 
 	// pass a negative length to NewRangeReader so that the remainder of the
@@ -184,6 +199,26 @@ func (be *b2Backend) openReader(ctx context.Context, h restic.Handle, length int
 	return be.sem.ReleaseTokenOnClose(rd, cancel), nil
 }
 
+// sha1Sum returns the SHA1 hash reported by the service for obj. For large
+// files, the service does not know the hash, in this case nil is returned.
+func (be *b2Backend) sha1Sum(ctx context.Context, obj *b2.Object) ([]byte, error) {
+	info, err := obj.Attrs(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "Attrs")
+	}
+
+	if info.SHA1 == "" || info.SHA1 == "none" {
+		return nil, nil
+	}
+
+	sum, err := hex.DecodeString(info.SHA1)
+	if err != nil {
+		return nil, errors.Wrap(err, "DecodeString")
+	}
+
+	return sum, nil
+}
+
 // Save stores data in the backend at the handle.
 func (be *b2Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
 	ctx, cancel := context.WithCancel(ctx)
@@ -201,6 +236,13 @@ func (be *b2Backend) Save(ctx context.Context, h restic.Handle, rd restic.Rewind
 	obj := be.bucket.Object(name)
 
 	w := obj.NewWriter(ctx)
+
+	// files larger than the chunk size are uploaded via the large file API,
+	// which retries failed parts individually
+	if be.cfg.PartSize > 0 {
+		w.ChunkSize = int(be.cfg.PartSize) * 1024 * 1024
+	}
+
 	n, err := io.Copy(w, rd)
 	debug.Log("  saved %d bytes, err %v", n, err)
 
@@ -343,7 +385,11 @@ func (be *b2Backend) Delete(ctx context.Context) error {
 		restic.KeyFile,
 		restic.LockFile,
 		restic.SnapshotFile,
-		restic.IndexFile}
+		restic.IndexFile,
+		restic.StatsFile,
+		restic.TrashFile,
+		restic.LedgerFile,
+		restic.NewConfigFile}
 
 	for _, t := range alltypes {
 		err := be.removeKeys(ctx, t)
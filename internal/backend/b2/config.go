@@ -18,6 +18,7 @@ type Config struct {
 	Prefix    string
 
 	Connections uint `option:"connections" help:"set a limit for the number of concurrent connections (default: 5)"`
+	PartSize    uint `option:"part-size" help:"upload files larger than this many MiB in parts using the large file API, between 5 and 4768 (default: 100)"`
 }
 
 // NewConfig returns a new config with default options applied.
@@ -31,6 +32,22 @@ func init() {
 	options.Register("b2", Config{})
 }
 
+// minPartSize and maxPartSize are the limits for the size of the parts of a
+// large file in MiB. Only the last part of a file may be smaller.
+const (
+	minPartSize = 5
+	maxPartSize = 4768
+)
+
+// checkPartSize returns an error if size is not accepted by B2 as the size of
+// a part in MiB. Zero selects the default part size.
+func checkPartSize(size uint) error {
+	if size != 0 && (size < minPartSize || size > maxPartSize) {
+		return errors.Errorf("invalid part size %d MiB, must be between %d and %d MiB", size, minPartSize, maxPartSize)
+	}
+	return nil
+}
+
 var bucketName = regexp.MustCompile("^[a-zA-Z0-9-]+$")
 
 // checkBucketName tests the bucket name against the rules at
@@ -90,3 +90,28 @@ func TestInvalidConfig(t *testing.T) {
 		})
 	}
 }
+
+var partSizeTests = []struct {
+	size  uint
+	valid bool
+}{
+	{0, true},
+	{1, false},
+	{4, false},
+	{5, true},
+	{100, true},
+	{4768, true},
+	{4769, false},
+}
+
+func TestCheckPartSize(t *testing.T) {
+	for _, test := range partSizeTests {
+		err := checkPartSize(test.size)
+		if test.valid && err != nil {
+			t.Errorf("part size %d: unexpected error: %v", test.size, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("part size %d: expected error not found", test.size)
+		}
+	}
+}
@@ -124,7 +124,7 @@ func (be *RetryBackend) List(ctx context.Context, t restic.FileType, fn func(res
 	var innerErr error                  // remember when fn returned an error, so we can return that to the caller
 
 	err := be.retry(listCtx, fmt.Sprintf("List(%v)", t), func() error {
-		return be.Backend.List(ctx, t, func(fi restic.FileInfo) error {
+		err := be.Backend.List(ctx, t, func(fi restic.FileInfo) error {
 			if _, ok := listed[fi.Name]; ok {
 				return nil
 			}
@@ -137,6 +137,12 @@ func (be *RetryBackend) List(ctx context.Context, t restic.FileType, fn func(res
 			}
 			return innerErr
 		})
+		if err != nil && innerErr == nil && be.Backend.IsNotExist(err) {
+			// a directory which does not exist won't appear by retrying, e.g.
+			// for file types which were added after the repository was created
+			return backoff.Permanent(err)
+		}
+		return err
 	})
 
 	// the error fn returned takes precedence
@@ -146,3 +152,25 @@ func (be *RetryBackend) List(ctx context.Context, t restic.FileType, fn func(res
 
 	return err
 }
+
+// Rename moves a file to another handle in the wrapped backend. If it does
+// not implement restic.Renamer, restic.ErrRenameUnsupported is returned.
+func (be *RetryBackend) Rename(ctx context.Context, from, to restic.Handle) error {
+	rn, ok := be.Backend.(restic.Renamer)
+	if !ok {
+		return restic.ErrRenameUnsupported
+	}
+
+	return rn.Rename(ctx, from, to)
+}
+
+// ListVersion returns the list version reported by the wrapped backend. If it
+// does not implement restic.ListVersioner, the empty string is returned.
+func (be *RetryBackend) ListVersion(ctx context.Context, t restic.FileType) (string, error) {
+	lv, ok := be.Backend.(restic.ListVersioner)
+	if !ok {
+		return "", nil
+	}
+
+	return lv.ListVersion(ctx, t)
+}
@@ -185,6 +185,38 @@ func TestBackendListRetryErrorBackend(t *testing.T) {
 	test.Equals(t, names[:2], listed)
 }
 
+func TestBackendListRetryNotExist(t *testing.T) {
+	var ErrNotExist = errors.New("directory does not exist")
+
+	retries := 0
+	be := &mock.Backend{
+		ListFn: func(ctx context.Context, tpe restic.FileType, fn func(restic.FileInfo) error) error {
+			retries++
+			return ErrNotExist
+		},
+		IsNotExistFn: func(err error) bool {
+			return err == ErrNotExist
+		},
+	}
+
+	retryBackend := RetryBackend{
+		MaxTries: 5,
+		Backend:  be,
+	}
+
+	err := retryBackend.List(context.TODO(), restic.DataFile, func(fi restic.FileInfo) error {
+		return nil
+	})
+
+	if err != ErrNotExist {
+		t.Fatalf("wrong error returned, want %v, got %v", ErrNotExist, err)
+	}
+
+	if retries != 1 {
+		t.Fatalf("List was called %d times, wanted 1", retries)
+	}
+}
+
 // failingReader returns an error after reading limit number of bytes
 type failingReader struct {
 	data  []byte
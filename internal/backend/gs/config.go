@@ -17,6 +17,7 @@ type Config struct {
 	Prefix      string
 
 	Connections uint `option:"connections" help:"set a limit for the number of concurrent connections (default: 20)"`
+	ChunkSize   uint `option:"chunk-size" help:"upload files larger than this many MiB with resumable uploads in chunks of this size, maximum 2047 (default: 64)"`
 }
 
 // NewConfig returns a new Config with the default values filled in.
@@ -30,6 +31,19 @@ func init() {
 	options.Register("gs", Config{})
 }
 
+// maxChunkSize is the largest chunk size in MiB, the size in bytes must fit
+// into an int on 32 bit platforms.
+const maxChunkSize = 2047
+
+// checkChunkSize returns an error if size is not a valid chunk size in MiB.
+// Zero selects the default chunk size.
+func checkChunkSize(size uint) error {
+	if size > maxChunkSize {
+		return errors.Errorf("invalid chunk size %d MiB, must be at most %d MiB", size, maxChunkSize)
+	}
+	return nil
+}
+
 // ParseConfig parses the string s and extracts the gcs config. The
 // supported configuration format is gs:bucketName:/[prefix].
 func ParseConfig(s string) (interface{}, error) {
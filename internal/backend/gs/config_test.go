@@ -38,3 +38,26 @@ func TestParseConfig(t *testing.T) {
 		}
 	}
 }
+
+var chunkSizeTests = []struct {
+	size  uint
+	valid bool
+}{
+	{0, true},
+	{1, true},
+	{64, true},
+	{2047, true},
+	{2048, false},
+}
+
+func TestCheckChunkSize(t *testing.T) {
+	for _, test := range chunkSizeTests {
+		err := checkChunkSize(test.size)
+		if test.valid && err != nil {
+			t.Errorf("chunk size %d: unexpected error: %v", test.size, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("chunk size %d: expected error not found", test.size)
+		}
+	}
+}
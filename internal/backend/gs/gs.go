@@ -3,12 +3,15 @@ package gs
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"net/http"
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/restic/restic/internal/backend"
@@ -37,12 +40,16 @@ type Backend struct {
 	bucketName   string
 	prefix       string
 	listMaxItems int
+	chunkSize    int64
 	backend.Layout
 }
 
 // Ensure that *Backend implements restic.Backend.
 var _ restic.Backend = &Backend{}
 
+// Ensure that *Backend implements restic.Renamer.
+var _ restic.Renamer = &Backend{}
+
 func getStorageService(jsonKeyPath string, rt http.RoundTripper) (*storage.Service, error) {
 
 	raw, err := ioutil.ReadFile(jsonKeyPath)
@@ -77,9 +84,18 @@ func getStorageService(jsonKeyPath string, rt http.RoundTripper) (*storage.Servi
 
 const defaultListMaxItems = 1000
 
+// defaultChunkSize is the chunk size used for resumable uploads when no chunk
+// size has been configured. Files up to this size are uploaded in a single
+// request.
+const defaultChunkSize = 64 * 1024 * 1024
+
 func open(cfg Config, rt http.RoundTripper) (*Backend, error) {
 	debug.Log("open, config %#v", cfg)
 
+	if err := checkChunkSize(cfg.ChunkSize); err != nil {
+		return nil, err
+	}
+
 	service, err := getStorageService(cfg.JSONKeyPath, rt)
 	if err != nil {
 		return nil, errors.Wrap(err, "getStorageService")
@@ -101,6 +117,11 @@ func open(cfg Config, rt http.RoundTripper) (*Backend, error) {
 			Join: path.Join,
 		},
 		listMaxItems: defaultListMaxItems,
+		chunkSize:    defaultChunkSize,
+	}
+
+	if cfg.ChunkSize > 0 {
+		be.chunkSize = int64(cfg.ChunkSize) * 1024 * 1024
 	}
 
 	return be, nil
@@ -220,12 +241,10 @@ func (be *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindRe
 
 	debug.Log("InsertObject(%v, %v)", be.bucketName, objName)
 
-	// Set chunk size to zero to disable resumable uploads.
+	// Set chunk size to zero to disable resumable uploads for small files.
 	//
-	// With a non-zero chunk size (the default is
-	// googleapi.DefaultUploadChunkSize, 8MB), Insert will buffer data from
-	// rd in chunks of this size so it can upload these chunks in
-	// individual requests.
+	// With a non-zero chunk size, Insert will buffer data from rd in chunks
+	// of this size so it can upload these chunks in individual requests.
 	//
 	// This chunking allows the library to automatically handle network
 	// interruptions and re-upload only the last chunk rather than the full
@@ -244,13 +263,26 @@ func (be *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindRe
 	// in better rate limiting behavior.
 	//
 	// restic typically writes small blobs (4MB-30MB), so the resumable
-	// uploads are not providing significant benefit anyways.
+	// uploads are only used for files larger than the chunk size, where
+	// restarting the whole upload after an interruption is expensive.
 	cs := googleapi.ChunkSize(0)
+	if int64(rd.Length()) > be.chunkSize {
+		cs = googleapi.ChunkSize(int(be.chunkSize))
+	}
+
+	// compute the CRC32C checksum of the data, the service verifies it
+	// before the object is created
+	sum, err := backend.HashRewindReader(rd, crc32.New(crc32c))
+	if err != nil {
+		be.sem.ReleaseToken()
+		return err
+	}
 
 	info, err := be.service.Objects.Insert(be.bucketName,
 		&storage.Object{
-			Name: objName,
-			Size: uint64(rd.Length()),
+			Name:   objName,
+			Size:   uint64(rd.Length()),
+			Crc32c: base64.StdEncoding.EncodeToString(sum),
 		}).Media(rd, cs).Do()
 
 	be.sem.ReleaseToken()
@@ -261,7 +293,37 @@ func (be *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindRe
 	}
 
 	debug.Log("%v -> %v bytes", objName, info.Size)
-	return nil
+
+	remote, err := base64.StdEncoding.DecodeString(info.Crc32c)
+	if err != nil {
+		return errors.Wrap(err, "DecodeString")
+	}
+
+	return backend.CheckSum(objName, sum, remote)
+}
+
+// crc32c is the table for the CRC32C checksum used by GCS.
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// hashHeaderCRC32C extracts the CRC32C checksum from the X-Goog-Hash header of
+// a response. If no checksum is present, nil is returned.
+func hashHeaderCRC32C(header http.Header) ([]byte, error) {
+	for _, value := range header["X-Goog-Hash"] {
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if !strings.HasPrefix(item, "crc32c=") {
+				continue
+			}
+
+			sum, err := base64.StdEncoding.DecodeString(item[len("crc32c="):])
+			if err != nil {
+				return nil, errors.Wrap(err, "DecodeString")
+			}
+			return sum, nil
+		}
+	}
+
+	return nil, nil
 }
 
 // wrapReader wraps an io.ReadCloser to run an additional function on Close.
@@ -316,7 +378,7 @@ func (be *Backend) openReader(ctx context.Context, h restic.Handle, length int,
 		return nil, err
 	}
 
-	closeRd := wrapReader{
+	var closeRd io.ReadCloser = wrapReader{
 		ReadCloser: res.Body,
 		f: func() {
 			debug.Log("Close()")
@@ -324,6 +386,13 @@ func (be *Backend) openReader(ctx context.Context, h restic.Handle, length int,
 		},
 	}
 
+	// the service only reports the checksum when the whole file is read
+	if offset == 0 && length == 0 {
+		closeRd = backend.VerifyReadCloser(closeRd, objName, crc32.New(crc32c), func() ([]byte, error) {
+			return hashHeaderCRC32C(res.Header)
+		})
+	}
+
 	return closeRd, err
 }
 
@@ -379,6 +448,44 @@ func (be *Backend) Remove(ctx context.Context, h restic.Handle) error {
 	return errors.Wrap(err, "client.RemoveObject")
 }
 
+// Rename moves the file from to the handle to. The object is rewritten on the
+// server and removed afterwards, its content is not transferred.
+func (be *Backend) Rename(ctx context.Context, from, to restic.Handle) error {
+	debug.Log("Rename %v to %v", from, to)
+	if err := to.Valid(); err != nil {
+		return err
+	}
+
+	oldname, newname := be.Filename(from), be.Filename(to)
+
+	be.sem.GetToken()
+	defer be.sem.ReleaseToken()
+
+	// large objects may need several calls, generation 0 makes the rewrite
+	// fail if the destination object already exists
+	var token string
+	for {
+		call := be.service.Objects.Rewrite(be.bucketName, oldname, be.bucketName, newname, &storage.Object{}).
+			IfGenerationMatch(0).Context(ctx)
+		if token != "" {
+			call = call.RewriteToken(token)
+		}
+
+		res, err := call.Do()
+		if err != nil {
+			return errors.Wrap(err, "service.Objects.Rewrite")
+		}
+
+		if res.Done {
+			break
+		}
+		token = res.RewriteToken
+	}
+
+	err := be.service.Objects.Delete(be.bucketName, oldname).Do()
+	return errors.Wrap(err, "service.Objects.Delete")
+}
+
 // List runs fn for each file in the backend which has the type t. When an
 // error occurs (or fn returns an error), List stops and returns it.
 func (be *Backend) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
@@ -417,8 +524,13 @@ func (be *Backend) List(ctx context.Context, t restic.FileType, fn func(restic.F
 			}
 
 			fi := restic.FileInfo{
-				Name: path.Base(m),
-				Size: int64(item.Size),
+				Name:         path.Base(m),
+				Size:         int64(item.Size),
+				StorageClass: item.StorageClass,
+			}
+
+			if t, err := time.Parse(time.RFC3339, item.Updated); err == nil {
+				fi.ModTime = t
 			}
 
 			err := fn(fi)
@@ -454,7 +566,11 @@ func (be *Backend) Delete(ctx context.Context) error {
 		restic.KeyFile,
 		restic.LockFile,
 		restic.SnapshotFile,
-		restic.IndexFile}
+		restic.IndexFile,
+		restic.StatsFile,
+		restic.TrashFile,
+		restic.LedgerFile,
+		restic.NewConfigFile}
 
 	for _, t := range alltypes {
 		err := be.removeKeys(ctx, t)
@@ -13,6 +13,7 @@ import (
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
+	"golang.org/x/net/http2"
 )
 
 // TransportOptions collects various options which can be set for an HTTP based
@@ -109,6 +110,14 @@ func Transport(opts TransportOptions) (http.RoundTripper, error) {
 		tr.TLSClientConfig.RootCAs = pool
 	}
 
+	// use HTTP/2 for servers which support it, then all concurrent requests
+	// are sent over a single connection without waiting for each other, and
+	// no round trips are wasted on setting up additional connections
+	err := http2.ConfigureTransport(tr)
+	if err != nil {
+		return nil, errors.Wrap(err, "ConfigureTransport")
+	}
+
 	// wrap in the debug round tripper (if active)
 	return debug.RoundTripper(tr), nil
 }
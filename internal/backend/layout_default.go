@@ -16,11 +16,15 @@ type DefaultLayout struct {
 }
 
 var defaultLayoutPaths = map[restic.FileType]string{
-	restic.DataFile:     "data",
-	restic.SnapshotFile: "snapshots",
-	restic.IndexFile:    "index",
-	restic.LockFile:     "locks",
-	restic.KeyFile:      "keys",
+	restic.DataFile:      "data",
+	restic.SnapshotFile:  "snapshots",
+	restic.IndexFile:     "index",
+	restic.LockFile:      "locks",
+	restic.KeyFile:       "keys",
+	restic.StatsFile:     "stats",
+	restic.TrashFile:     "trash",
+	restic.LedgerFile:    "ledger",
+	restic.NewConfigFile: "newconfig",
 }
 
 func (l *DefaultLayout) String() string {
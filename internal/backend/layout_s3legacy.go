@@ -11,11 +11,15 @@ type S3LegacyLayout struct {
 }
 
 var s3LayoutPaths = map[restic.FileType]string{
-	restic.DataFile:     "data",
-	restic.SnapshotFile: "snapshot",
-	restic.IndexFile:    "index",
-	restic.LockFile:     "lock",
-	restic.KeyFile:      "key",
+	restic.DataFile:      "data",
+	restic.SnapshotFile:  "snapshot",
+	restic.IndexFile:     "index",
+	restic.LockFile:      "lock",
+	restic.KeyFile:       "key",
+	restic.StatsFile:     "stats",
+	restic.TrashFile:     "trash",
+	restic.LedgerFile:    "ledger",
+	restic.NewConfigFile: "newconfig",
 }
 
 func (l *S3LegacyLayout) String() string {
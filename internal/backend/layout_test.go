@@ -110,6 +110,10 @@ func TestDefaultLayout(t *testing.T) {
 			filepath.Join(tempdir, "index"),
 			filepath.Join(tempdir, "locks"),
 			filepath.Join(tempdir, "keys"),
+			filepath.Join(tempdir, "stats"),
+			filepath.Join(tempdir, "trash"),
+			filepath.Join(tempdir, "ledger"),
+			filepath.Join(tempdir, "newconfig"),
 		}
 
 		for i := 0; i < 256; i++ {
@@ -187,6 +191,10 @@ func TestRESTLayout(t *testing.T) {
 			filepath.Join(path, "index"),
 			filepath.Join(path, "locks"),
 			filepath.Join(path, "keys"),
+			filepath.Join(path, "stats"),
+			filepath.Join(path, "trash"),
+			filepath.Join(path, "ledger"),
+			filepath.Join(path, "newconfig"),
 		}
 
 		sort.Sort(sort.StringSlice(want))
@@ -333,6 +341,10 @@ func TestS3LegacyLayout(t *testing.T) {
 			filepath.Join(path, "index"),
 			filepath.Join(path, "lock"),
 			filepath.Join(path, "key"),
+			filepath.Join(path, "stats"),
+			filepath.Join(path, "trash"),
+			filepath.Join(path, "ledger"),
+			filepath.Join(path, "newconfig"),
 		}
 
 		sort.Sort(sort.StringSlice(want))
@@ -2,9 +2,11 @@ package local
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
@@ -23,6 +25,12 @@ type Local struct {
 // ensure statically that *Local implements restic.Backend.
 var _ restic.Backend = &Local{}
 
+// ensure statically that *Local implements restic.ListVersioner.
+var _ restic.ListVersioner = &Local{}
+
+// ensure statically that *Local implements restic.Renamer.
+var _ restic.Renamer = &Local{}
+
 const defaultLayout = "default"
 
 // dirExists returns true if the name exists and is a directory.
@@ -225,6 +233,34 @@ func (b *Local) Remove(ctx context.Context, h restic.Handle) error {
 	return fs.Remove(fn)
 }
 
+// Rename moves the file from to the handle to.
+func (b *Local) Rename(ctx context.Context, from, to restic.Handle) error {
+	debug.Log("Rename %v to %v", from, to)
+	if err := to.Valid(); err != nil {
+		return err
+	}
+
+	oldname, newname := b.Filename(from), b.Filename(to)
+
+	// os.Rename replaces existing files, Save never does
+	if _, err := fs.Lstat(newname); err == nil {
+		return errors.Errorf("rename %v: file %v already exists", from, to)
+	}
+
+	err := fs.Rename(oldname, newname)
+	if b.IsNotExist(err) {
+		// error is probably caused by a missing directory, try to create it
+		mkdirErr := os.MkdirAll(filepath.Dir(newname), backend.Modes.Dir)
+		if mkdirErr != nil {
+			debug.Log("error creating dir %v: %v", filepath.Dir(newname), mkdirErr)
+		} else {
+			err = fs.Rename(oldname, newname)
+		}
+	}
+
+	return errors.Wrap(err, "Rename")
+}
+
 func isFile(fi os.FileInfo) bool {
 	return fi.Mode()&(os.ModeType|os.ModeCharDevice) == 0
 }
@@ -256,8 +292,9 @@ func (b *Local) List(ctx context.Context, t restic.FileType, fn func(restic.File
 		debug.Log("send %v\n", filepath.Base(path))
 
 		rfi := restic.FileInfo{
-			Name: filepath.Base(path),
-			Size: fi.Size(),
+			Name:    filepath.Base(path),
+			Size:    fi.Size(),
+			ModTime: fi.ModTime(),
 		}
 
 		if ctx.Err() != nil {
@@ -273,6 +310,33 @@ func (b *Local) List(ctx context.Context, t restic.FileType, fn func(restic.File
 	})
 }
 
+// listVersionMinAge is the minimal age of a directory modification time to be
+// used as a list version. Some filesystems only store the modification time
+// with a coarse resolution, so several changes within a short time may not be
+// reflected.
+const listVersionMinAge = 2 * time.Second
+
+// ListVersion returns a version for the list of files of type t, derived
+// from the modification time of the directory the files are stored in.
+func (b *Local) ListVersion(ctx context.Context, t restic.FileType) (string, error) {
+	basedir, subdirs := b.Basedir(t)
+	if subdirs {
+		// files in subdirectories don't change the modification time of basedir
+		return "", nil
+	}
+
+	fi, err := fs.Stat(basedir)
+	if err != nil {
+		return "", errors.Wrap(err, "Stat")
+	}
+
+	if time.Since(fi.ModTime()) < listVersionMinAge {
+		return "", nil
+	}
+
+	return fmt.Sprintf("%d", fi.ModTime().UnixNano()), nil
+}
+
 // Delete removes the repository and all files.
 func (b *Local) Delete(ctx context.Context) error {
 	debug.Log("Delete()")
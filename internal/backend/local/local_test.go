@@ -1,6 +1,7 @@
 package local_test
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -134,3 +135,39 @@ func TestOpenNotExistingDirectory(t *testing.T) {
 	removeAll(t, filepath.Join(dir, "data"))
 	empty(t, dir)
 }
+
+func TestRename(t *testing.T) {
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	be, err := local.Create(local.Config{Path: filepath.Join(dir, "repo")})
+	rtest.OK(t, err)
+	defer func() {
+		rtest.OK(t, be.Close())
+	}()
+
+	ctx := context.TODO()
+	from := restic.Handle{Type: restic.DataFile, Name: "0123456789abcdef"}
+	to := restic.Handle{Type: restic.TrashFile, Name: "1539600000.data.0123456789abcdef"}
+	other := restic.Handle{Type: restic.DataFile, Name: "fedcba9876543210"}
+
+	rtest.OK(t, be.Save(ctx, from, restic.NewByteReader([]byte("foo"))))
+	rtest.OK(t, be.Save(ctx, other, restic.NewByteReader([]byte("bar"))))
+
+	rtest.OK(t, be.Rename(ctx, from, to))
+
+	found, err := be.Test(ctx, from)
+	rtest.OK(t, err)
+	rtest.Assert(t, !found, "file %v still present after rename", from)
+
+	buf, err := ioutil.ReadFile(be.Filename(to))
+	rtest.OK(t, err)
+	rtest.Equals(t, "foo", string(buf))
+
+	// existing files are never replaced
+	rtest.Assert(t, be.Rename(ctx, other, to) != nil, "existing file was replaced")
+
+	buf, err = ioutil.ReadFile(be.Filename(to))
+	rtest.OK(t, err)
+	rtest.Equals(t, "foo", string(buf))
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/restic/restic/internal/backend/b2"
 	"github.com/restic/restic/internal/backend/local"
+	"github.com/restic/restic/internal/backend/mem"
 	"github.com/restic/restic/internal/backend/rest"
 	"github.com/restic/restic/internal/backend/s3"
 	"github.com/restic/restic/internal/backend/sftp"
@@ -299,6 +300,20 @@ var parseTests = []struct {
 			},
 		},
 	},
+	{
+		"mem:",
+		Location{Scheme: "mem",
+			Config: mem.Config{},
+		},
+	},
+	{
+		"mem:test",
+		Location{Scheme: "mem",
+			Config: mem.Config{
+				Name: "test",
+			},
+		},
+	},
 }
 
 func TestParse(t *testing.T) {
@@ -0,0 +1,35 @@
+package mem
+
+import (
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/options"
+)
+
+// Config holds all information needed to open a memory backend.
+type Config struct {
+	// Name identifies the backend within the process, opening the same name
+	// again returns the same data.
+	Name string
+
+	Size     string `option:"size" help:"limit for the total size of all files, e.g. 500M (default: unlimited)"`
+	Snapshot string `option:"snapshot" help:"load the data from this file and save it there when restic exits"`
+
+	// MaxSize is the limit in bytes, parsed from Size. Zero means unlimited.
+	MaxSize uint64
+}
+
+func init() {
+	options.Register("mem", Config{})
+}
+
+// ParseConfig parses the string s and extracts the memory backend config.
+// The supported format is mem:name, the name may be empty.
+func ParseConfig(s string) (interface{}, error) {
+	if !strings.HasPrefix(s, "mem:") {
+		return nil, errors.New(`invalid format, prefix "mem" not found`)
+	}
+
+	return Config{Name: s[4:]}, nil
+}
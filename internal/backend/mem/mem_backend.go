@@ -21,11 +21,15 @@ var _ restic.Backend = &MemoryBackend{}
 
 var errNotFound = errors.New("not found")
 
-// MemoryBackend is a mock backend that uses a map for storing all data in
-// memory. This should only be used for tests.
+// MemoryBackend is a backend that uses a map for storing all data in memory.
+// It is meant for tests and quick experiments.
 type MemoryBackend struct {
 	data memMap
+	size uint64
 	m    sync.Mutex
+
+	cfg   Config
+	dirty bool
 }
 
 // New returns a new backend that saves all data in a map in memory.
@@ -39,6 +43,58 @@ func New() *MemoryBackend {
 	return be
 }
 
+// registry contains all backends opened by name in this process.
+var registry = struct {
+	sync.Mutex
+	backends map[string]*MemoryBackend
+}{backends: make(map[string]*MemoryBackend)}
+
+// Open returns the memory backend with the name in cfg. If no such backend
+// has been opened in this process before, it is loaded from cfg.Snapshot (if
+// set) or starts out empty.
+func Open(cfg Config) (*MemoryBackend, error) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if be, ok := registry.backends[cfg.Name]; ok {
+		be.m.Lock()
+		be.cfg = cfg
+		be.m.Unlock()
+		return be, nil
+	}
+
+	be := New()
+	be.cfg = cfg
+	if cfg.Snapshot != "" {
+		err := be.loadSnapshot(cfg.Snapshot)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	registry.backends[cfg.Name] = be
+	return be, nil
+}
+
+// Create returns a memory backend for a new repository with the name in cfg.
+func Create(cfg Config) (*MemoryBackend, error) {
+	be, err := Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := be.Test(context.TODO(), restic.Handle{Type: restic.ConfigFile})
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		return nil, errors.New("config file already exists")
+	}
+
+	return be, nil
+}
+
 // Test returns whether a file exists.
 func (be *MemoryBackend) Test(ctx context.Context, h restic.Handle) (bool, error) {
 	be.m.Lock()
@@ -80,7 +136,13 @@ func (be *MemoryBackend) Save(ctx context.Context, h restic.Handle, rd restic.Re
 		return err
 	}
 
+	if be.cfg.MaxSize > 0 && be.size+uint64(len(buf)) > be.cfg.MaxSize {
+		return errors.Errorf("memory backend is full, %d bytes of %d used", be.size, be.cfg.MaxSize)
+	}
+
 	be.data[h] = buf
+	be.size += uint64(len(buf))
+	be.dirty = true
 	debug.Log("saved %v bytes at %v", len(buf), h)
 
 	return nil
@@ -157,11 +219,14 @@ func (be *MemoryBackend) Remove(ctx context.Context, h restic.Handle) error {
 
 	debug.Log("Remove %v", h)
 
-	if _, ok := be.data[h]; !ok {
+	buf, ok := be.data[h]
+	if !ok {
 		return errNotFound
 	}
 
 	delete(be.data, h)
+	be.size -= uint64(len(buf))
+	be.dirty = true
 
 	return nil
 }
@@ -205,6 +270,9 @@ func (be *MemoryBackend) List(ctx context.Context, t restic.FileType, fn func(re
 
 // Location returns the location of the backend (RAM).
 func (be *MemoryBackend) Location() string {
+	if be.cfg.Name != "" {
+		return "mem:" + be.cfg.Name
+	}
 	return "RAM"
 }
 
@@ -214,10 +282,26 @@ func (be *MemoryBackend) Delete(ctx context.Context) error {
 	defer be.m.Unlock()
 
 	be.data = make(memMap)
+	be.size = 0
+	be.dirty = true
 	return nil
 }
 
-// Close closes the backend.
+// Close closes the backend. If a snapshot file is configured and the data
+// has been modified, it is written to the file.
 func (be *MemoryBackend) Close() error {
+	be.m.Lock()
+	defer be.m.Unlock()
+
+	if be.cfg.Snapshot == "" || !be.dirty {
+		return nil
+	}
+
+	err := be.saveSnapshot(be.cfg.Snapshot)
+	if err != nil {
+		return err
+	}
+
+	be.dirty = false
 	return nil
 }
@@ -2,13 +2,18 @@ package mem_test
 
 import (
 	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 
+	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/backend/mem"
 	"github.com/restic/restic/internal/backend/test"
+	rtest "github.com/restic/restic/internal/test"
 )
 
 type memConfig struct {
@@ -64,3 +69,61 @@ func TestSuiteBackendMem(t *testing.T) {
 func BenchmarkSuiteBackendMem(t *testing.B) {
 	newTestSuite().RunBenchmarks(t)
 }
+
+func TestMemSnapshot(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	ctx := context.TODO()
+	cfg := mem.Config{
+		Name:     "snapshot-test",
+		Snapshot: filepath.Join(tempdir, "repo.tar"),
+		MaxSize:  100,
+	}
+
+	be, err := mem.Create(cfg)
+	rtest.OK(t, err)
+
+	files := map[restic.Handle][]byte{
+		{Type: restic.ConfigFile}:                 []byte("config"),
+		{Type: restic.DataFile, Name: "abcdef"}:   []byte("data"),
+		{Type: restic.SnapshotFile, Name: "1234"}: []byte("snapshot"),
+	}
+	for h, buf := range files {
+		rtest.OK(t, be.Save(ctx, h, restic.NewByteReader(buf)))
+	}
+	rtest.OK(t, be.Save(ctx, restic.Handle{Type: restic.LockFile, Name: "1111"}, restic.NewByteReader([]byte("lock"))))
+
+	err = be.Save(ctx, restic.Handle{Type: restic.DataFile, Name: "large"}, restic.NewByteReader(make([]byte, 100)))
+	rtest.Assert(t, err != nil, "size limit was not enforced")
+
+	rtest.OK(t, be.Close())
+
+	_, err = mem.Create(cfg)
+	rtest.Assert(t, err != nil, "repository was created twice")
+
+	// load the snapshot into a new backend
+	cfg.Name = "snapshot-test2"
+	be2, err := mem.Open(cfg)
+	rtest.OK(t, err)
+
+	for h, buf := range files {
+		data, err := backend.LoadAll(ctx, be2, h)
+		rtest.OK(t, err)
+		rtest.Equals(t, buf, data)
+	}
+
+	ok, err := be2.Test(ctx, restic.Handle{Type: restic.LockFile, Name: "1111"})
+	rtest.OK(t, err)
+	rtest.Assert(t, !ok, "lock file was saved in the snapshot")
+
+	// the snapshot can be used as a repository for the local backend
+	dir := filepath.Join(tempdir, "extracted")
+	rtest.OK(t, os.Mkdir(dir, 0700))
+	rtest.SetupTarTestFixture(t, dir, cfg.Snapshot)
+	data, err := ioutil.ReadFile(filepath.Join(dir, "data", "ab", "abcdef"))
+	rtest.OK(t, err)
+	rtest.Equals(t, []byte("data"), data)
+	_, err = os.Stat(filepath.Join(dir, "locks"))
+	rtest.OK(t, err)
+}
@@ -0,0 +1,177 @@
+package mem
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// snapshotLayout is used for the names of the files in a snapshot, so that
+// extracting it yields a repository for the local backend.
+var snapshotLayout = &backend.DefaultLayout{Join: path.Join}
+
+// snapshotTypes contains all file types stored in a snapshot. Lock files are
+// left out, they are stale as soon as the process has exited.
+var snapshotTypes = []restic.FileType{
+	restic.DataFile, restic.KeyFile, restic.SnapshotFile, restic.IndexFile,
+	restic.StatsFile, restic.TrashFile, restic.LedgerFile, restic.NewConfigFile,
+}
+
+// parseSnapshotName returns the handle for a file name in a snapshot.
+func parseSnapshotName(name string) (restic.Handle, error) {
+	if name == snapshotLayout.Filename(restic.Handle{Type: restic.ConfigFile}) {
+		return restic.Handle{Type: restic.ConfigFile}, nil
+	}
+
+	dir := strings.SplitN(name, "/", 2)[0]
+	for _, t := range snapshotTypes {
+		if basedir, _ := snapshotLayout.Basedir(t); basedir == dir {
+			return restic.Handle{Type: t, Name: path.Base(name)}, nil
+		}
+	}
+
+	return restic.Handle{}, errors.Errorf("unknown file %q", name)
+}
+
+// loadSnapshot reads all files from the tar archive filename into be. A
+// missing file is not an error.
+func (be *MemoryBackend) loadSnapshot(filename string) error {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		debug.Log("snapshot %v does not exist yet", filename)
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "Open")
+	}
+	defer f.Close()
+
+	be.m.Lock()
+	defer be.m.Unlock()
+
+	rd := tar.NewReader(f)
+	for {
+		hdr, err := rd.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrapf(err, "reading snapshot %v", filename)
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		h, err := parseSnapshotName(hdr.Name)
+		if err != nil {
+			return errors.Wrapf(err, "reading snapshot %v", filename)
+		}
+
+		buf, err := ioutil.ReadAll(rd)
+		if err != nil {
+			return errors.Wrapf(err, "reading snapshot %v", filename)
+		}
+
+		be.data[h] = buf
+		be.size += uint64(len(buf))
+	}
+
+	debug.Log("loaded %d files from snapshot %v", len(be.data), filename)
+	return nil
+}
+
+// saveSnapshot writes all files except locks as a tar archive to filename.
+// The archive is written to a temporary file first and then renamed, so an
+// existing snapshot is not damaged if writing fails. The caller must hold
+// be.m.
+func (be *MemoryBackend) saveSnapshot(filename string) error {
+	var handles []restic.Handle
+	for h := range be.data {
+		if h.Type != restic.LockFile {
+			handles = append(handles, h)
+		}
+	}
+	sort.Slice(handles, func(i, j int) bool {
+		return snapshotLayout.Filename(handles[i]) < snapshotLayout.Filename(handles[j])
+	})
+
+	f, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp-")
+	if err != nil {
+		return errors.Wrap(err, "TempFile")
+	}
+
+	err = writeSnapshot(f, be.data, handles)
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return errors.Wrapf(err, "writing snapshot %v", filename)
+	}
+
+	err = f.Close()
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return errors.Wrap(err, "Close")
+	}
+
+	debug.Log("saved %d files to snapshot %v", len(handles), filename)
+	return errors.Wrap(os.Rename(f.Name(), filename), "Rename")
+}
+
+func writeSnapshot(f *os.File, data memMap, handles []restic.Handle) error {
+	wr := tar.NewWriter(f)
+	now := time.Now().Truncate(time.Second)
+
+	// add all directories, so that the extracted archive can be used with
+	// the local backend
+	dirs := snapshotLayout.Paths()
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		err := wr.WriteHeader(&tar.Header{
+			Name:     dir + "/",
+			Typeflag: tar.TypeDir,
+			Mode:     int64(backend.Modes.Dir),
+			ModTime:  now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, h := range handles {
+		buf := data[h]
+		err := wr.WriteHeader(&tar.Header{
+			Name:     snapshotLayout.Filename(h),
+			Typeflag: tar.TypeReg,
+			Mode:     int64(backend.Modes.File),
+			Size:     int64(len(buf)),
+			ModTime:  now,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = wr.Write(buf)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := wr.Close()
+	if err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
@@ -10,7 +10,12 @@ import (
 
 // Config contains all configuration necessary to connect to a REST server.
 type Config struct {
-	URL         *url.URL
+	URL *url.URL
+
+	// Mirrors contains the URLs of other servers which provide the same
+	// repository, they are used when the server at URL cannot be reached.
+	Mirrors []*url.URL
+
 	Connections uint `option:"connections" help:"set a limit for the number of concurrent connections (default: 5)"`
 }
 
@@ -31,14 +36,42 @@ func ParseConfig(s string) (interface{}, error) {
 		return nil, errors.New("invalid REST backend specification")
 	}
 
-	s = s[5:]
-	u, err := url.Parse(s)
+	cfg := NewConfig()
+	for _, s := range splitURLs(s[5:]) {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, errors.Wrap(err, "url.Parse")
+		}
 
-	if err != nil {
-		return nil, errors.Wrap(err, "url.Parse")
+		if cfg.URL == nil {
+			cfg.URL = u
+			continue
+		}
+
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, errors.Errorf("invalid mirror URL %q, must start with http:// or https://", s)
+		}
+		cfg.Mirrors = append(cfg.Mirrors, u)
 	}
 
-	cfg := NewConfig()
-	cfg.URL = u
 	return cfg, nil
 }
+
+// splitURLs splits s at each comma which is followed by an HTTP or HTTPS URL,
+// so that commas within a URL are kept.
+func splitURLs(s string) (urls []string) {
+	start := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] != ',' {
+			continue
+		}
+
+		rest := s[i+1:]
+		if strings.HasPrefix(rest, "http://") || strings.HasPrefix(rest, "https://") {
+			urls = append(urls, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(urls, s[start:])
+}
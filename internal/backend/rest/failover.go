@@ -0,0 +1,170 @@
+package rest
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// recheckInterval is the time after which a server which has failed is tried
+// again.
+var recheckInterval = time.Minute
+
+// endpoint is one of the servers a repository can be accessed at.
+type endpoint struct {
+	url    *url.URL
+	path   string
+	failed time.Time
+}
+
+// failoverTransport sends requests to the first server which is available.
+// Requests are built for the URL of the first server, and rewritten for the
+// server they are sent to. When a server cannot be reached or reports that it
+// is unavailable, the request is repeated with the next server, and the
+// failed server is skipped until recheckInterval has passed.
+type failoverTransport struct {
+	rt http.RoundTripper
+
+	m         sync.Mutex
+	endpoints []*endpoint
+}
+
+func newFailoverTransport(rt http.RoundTripper, urls ...*url.URL) *failoverTransport {
+	t := &failoverTransport{rt: rt}
+	for _, u := range urls {
+		t.endpoints = append(t.endpoints, &endpoint{
+			url:  u,
+			path: strings.TrimSuffix(u.Path, "/"),
+		})
+	}
+	return t
+}
+
+// order returns the endpoints in the order they should be tried: all servers
+// which have not failed recently in the configured order, then the others,
+// starting with the one which failed first.
+func (t *failoverTransport) order() []*endpoint {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	var healthy, failed []*endpoint
+	for _, ep := range t.endpoints {
+		if ep.failed.IsZero() || time.Since(ep.failed) >= recheckInterval {
+			healthy = append(healthy, ep)
+			continue
+		}
+
+		i := len(failed)
+		for i > 0 && failed[i-1].failed.After(ep.failed) {
+			i--
+		}
+		failed = append(failed, nil)
+		copy(failed[i+1:], failed[i:])
+		failed[i] = ep
+	}
+
+	return append(healthy, failed...)
+}
+
+func (t *failoverTransport) setFailed(ep *endpoint, failed bool) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	if failed {
+		ep.failed = time.Now()
+	} else {
+		ep.failed = time.Time{}
+	}
+}
+
+// rewrite returns a copy of req which is sent to ep.
+func (t *failoverTransport) rewrite(req *http.Request, ep *endpoint) *http.Request {
+	primary := t.endpoints[0]
+
+	u := *req.URL
+	u.Scheme = ep.url.Scheme
+	u.Host = ep.url.Host
+	u.Path = ep.path + strings.TrimPrefix(req.URL.Path, primary.path)
+	u.RawPath = ""
+
+	r := new(http.Request)
+	*r = *req
+	r.URL = &u
+	r.Host = ""
+
+	// without credentials for the mirror, the ones of the first server are used
+	if ep.url.User != nil {
+		r.Header = make(http.Header, len(req.Header))
+		for k, v := range req.Header {
+			r.Header[k] = v
+		}
+
+		pw, _ := ep.url.User.Password()
+		r.SetBasicAuth(ep.url.User.Username(), pw)
+	}
+
+	return r
+}
+
+// isUnavailable returns true if the response indicates that the server (or a
+// proxy in front of it) cannot handle requests at the moment.
+func isUnavailable(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// RoundTrip sends the request to the first available server.
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoints := t.order()
+
+	var resp *http.Response
+	var err error
+	for i, ep := range endpoints {
+		r := t.rewrite(req, ep)
+
+		if i > 0 {
+			if req.Body != nil && req.GetBody == nil {
+				// the body cannot be sent again, return the previous result
+				return resp, err
+			}
+
+			if resp != nil {
+				_, _ = io.Copy(ioutil.Discard, resp.Body)
+				_ = resp.Body.Close()
+			}
+
+			if req.Body != nil {
+				body, gerr := req.GetBody()
+				if gerr != nil {
+					return nil, errors.Wrap(gerr, "GetBody")
+				}
+				r.Body = body
+			}
+		}
+
+		resp, err = t.rt.RoundTrip(r)
+		if req.Context().Err() != nil {
+			return resp, err
+		}
+
+		if err == nil && !isUnavailable(resp) {
+			t.setFailed(ep, false)
+			return resp, nil
+		}
+
+		debug.Log("request %v %v to %v failed, err %v", req.Method, req.URL.Path, ep.url.Host, err)
+		t.setFailed(ep, true)
+	}
+
+	return resp, err
+}
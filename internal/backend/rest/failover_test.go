@@ -0,0 +1,89 @@
+package rest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFailoverTransport(t *testing.T) {
+	var m sync.Mutex
+	var primaryRequests int
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		primaryRequests++
+		m.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+
+	var mirrorRequests []string
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		user, pw, _ := r.BasicAuth()
+
+		m.Lock()
+		mirrorRequests = append(mirrorRequests, r.Method+" "+r.URL.Path+" "+user+":"+pw+" "+string(buf))
+		m.Unlock()
+	}))
+	defer mirror.Close()
+
+	// unreachable server
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	primaryURL, _ := url.Parse(primary.URL + "/repo/")
+	downURL, _ := url.Parse(down.URL + "/repo")
+	mirrorURL, _ := url.Parse(mirror.URL + "/other/repo")
+	mirrorURL.User = url.UserPassword("user", "secret")
+
+	client := &http.Client{Transport: newFailoverTransport(http.DefaultTransport, primaryURL, downURL, mirrorURL)}
+
+	post := func(path string) {
+		resp, err := client.Post(primary.URL+path, "binary/octet-stream", strings.NewReader("data"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status %v", resp.Status)
+		}
+	}
+
+	post("/repo/data/1")
+	post("/repo/data/2")
+
+	if primaryRequests != 1 {
+		t.Errorf("failed server was not skipped, got %d requests", primaryRequests)
+	}
+
+	oldInterval := recheckInterval
+	recheckInterval = 0
+	defer func() {
+		recheckInterval = oldInterval
+	}()
+
+	time.Sleep(time.Millisecond)
+	post("/repo/data/3")
+
+	if primaryRequests != 2 {
+		t.Errorf("failed server was not tried again, got %d requests", primaryRequests)
+	}
+
+	want := []string{
+		"POST /other/repo/data/1 user:secret data",
+		"POST /other/repo/data/2 user:secret data",
+		"POST /other/repo/data/3 user:secret data",
+	}
+	if strings.Join(mirrorRequests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("wrong requests for mirror, want:\n  %v\ngot:\n  %v", want, mirrorRequests)
+	}
+}
@@ -37,6 +37,9 @@ const (
 
 // Open opens the REST backend with the given config.
 func Open(cfg Config, rt http.RoundTripper) (*restBackend, error) {
+	if len(cfg.Mirrors) > 0 {
+		rt = newFailoverTransport(rt, append([]*url.URL{cfg.URL}, cfg.Mirrors...)...)
+	}
 	client := &http.Client{Transport: rt}
 
 	sem, err := backend.NewSemaphore(cfg.Connections)
@@ -121,6 +124,14 @@ func (b *restBackend) Save(ctx context.Context, h restic.Handle, rd restic.Rewin
 	req.Header.Set("Content-Type", "application/octet-stream")
 	req.Header.Set("Accept", contentTypeV2)
 
+	// allow sending the data again to another server
+	req.GetBody = func() (io.ReadCloser, error) {
+		if err := rd.Rewind(); err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(rd), nil
+	}
+
 	// explicitly set the content length, this prevents chunked encoding and
 	// let's the server know what's coming.
 	req.ContentLength = rd.Length()
@@ -444,7 +455,11 @@ func (b *restBackend) Delete(ctx context.Context) error {
 		restic.KeyFile,
 		restic.LockFile,
 		restic.SnapshotFile,
-		restic.IndexFile}
+		restic.IndexFile,
+		restic.StatsFile,
+		restic.TrashFile,
+		restic.LedgerFile,
+		restic.NewConfigFile}
 
 	for _, t := range alltypes {
 		err := b.removeKeys(ctx, t)
@@ -21,6 +21,7 @@ type Config struct {
 
 	Connections uint `option:"connections" help:"set a limit for the number of concurrent connections (default: 5)"`
 	MaxRetries  uint `option:"retries" help:"set the number of retries attempted"`
+	PartSize    uint `option:"part-size" help:"upload files larger than this many MiB in parts using multipart upload minimum 5 (default: 64)"`
 }
 
 // NewConfig returns a new Config with the default values filled in.
@@ -34,6 +35,22 @@ func init() {
 	options.Register("s3", Config{})
 }
 
+// minPartSize and maxPartSize are the limits for the size of the parts of a
+// multipart upload in MiB. Only the last part of an upload may be smaller.
+const (
+	minPartSize = 5
+	maxPartSize = 5 * 1024
+)
+
+// checkPartSize returns an error if size is not accepted by S3 as the size of
+// a part in MiB. Zero selects the default part size.
+func checkPartSize(size uint) error {
+	if size != 0 && (size < minPartSize || size > maxPartSize) {
+		return errors.Errorf("invalid part size %d MiB, must be between %d and %d MiB", size, minPartSize, maxPartSize)
+	}
+	return nil
+}
+
 // ParseConfig parses the string s and extracts the s3 config. The two
 // supported configuration formats are s3://host/bucketname/prefix and
 // s3:host/bucketname/prefix. The host can also be a valid s3 region
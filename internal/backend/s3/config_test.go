@@ -111,3 +111,28 @@ func TestParseConfig(t *testing.T) {
 		}
 	}
 }
+
+var partSizeTests = []struct {
+	size  uint
+	valid bool
+}{
+	{0, true},
+	{1, false},
+	{4, false},
+	{5, true},
+	{64, true},
+	{5 * 1024, true},
+	{5*1024 + 1, false},
+}
+
+func TestCheckPartSize(t *testing.T) {
+	for _, test := range partSizeTests {
+		err := checkPartSize(test.size)
+		if test.valid && err != nil {
+			t.Errorf("part size %d: unexpected error: %v", test.size, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("part size %d: expected error not found", test.size)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package s3
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// inventoryManifest is the manifest.json of an S3 Inventory report.
+type inventoryManifest struct {
+	SourceBucket      string `json:"sourceBucket"`
+	CreationTimestamp string `json:"creationTimestamp"`
+	FileFormat        string `json:"fileFormat"`
+	FileSchema        string `json:"fileSchema"`
+	Files             []struct {
+		Key string `json:"key"`
+	} `json:"files"`
+}
+
+// defaultInventorySchema is used for data files of an inventory which are
+// read without the manifest.
+const defaultInventorySchema = "Bucket, Key, Size"
+
+// Inventory lists the data files of a repository found in an S3 Inventory
+// report.
+type Inventory struct {
+	// Created is the time the report was created, it is zero when the
+	// data files were read without the manifest.
+	Created time.Time
+
+	// DataFiles contains the IDs of the data files.
+	DataFiles restic.IDSet
+}
+
+// ReadInventory reads the S3 Inventory report from the local file name and
+// returns the data files stored below prefix in bucket. name is either the
+// manifest.json of the report or a CSV data file with the columns Bucket, Key
+// and Size, optionally compressed with gzip. The data files listed in a
+// manifest are searched next to it and in the directory "data" next to the
+// directory of the manifest, which is the layout of the report in the
+// destination bucket. Only reports in the CSV format are supported.
+func ReadInventory(name, bucket, prefix string) (*Inventory, error) {
+	inv := &Inventory{DataFiles: restic.NewIDSet()}
+
+	if filepath.Ext(name) != ".json" {
+		err := inv.readCSV(name, defaultInventorySchema, bucket, prefix)
+		if err != nil {
+			return nil, err
+		}
+		return inv, nil
+	}
+
+	buf, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, errors.Wrap(err, "ReadFile")
+	}
+
+	var manifest inventoryManifest
+	err = json.Unmarshal(buf, &manifest)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid manifest %v", name)
+	}
+
+	if !strings.EqualFold(manifest.FileFormat, "CSV") {
+		return nil, errors.Errorf("inventory format %q is not supported, only CSV can be read", manifest.FileFormat)
+	}
+
+	if manifest.SourceBucket != "" && manifest.SourceBucket != bucket {
+		return nil, errors.Errorf("inventory is for bucket %v, not %v", manifest.SourceBucket, bucket)
+	}
+
+	if manifest.CreationTimestamp != "" {
+		ms, err := strconv.ParseInt(manifest.CreationTimestamp, 10, 64)
+		if err != nil {
+			return nil, errors.Errorf("invalid creation timestamp %q in manifest", manifest.CreationTimestamp)
+		}
+		inv.Created = time.Unix(0, ms*int64(time.Millisecond))
+	}
+
+	dir := filepath.Dir(name)
+	for _, file := range manifest.Files {
+		base := path.Base(file.Key)
+		fn := filepath.Join(dir, base)
+		if _, err := os.Stat(fn); os.IsNotExist(err) {
+			fn = filepath.Join(filepath.Dir(dir), "data", base)
+		}
+
+		err = inv.readCSV(fn, manifest.FileSchema, bucket, prefix)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return inv, nil
+}
+
+// readCSV adds the data files listed in the CSV file name with the columns
+// given by schema to inv.
+func (inv *Inventory) readCSV(name, schema, bucket, prefix string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return errors.Wrap(err, "Open")
+	}
+	defer f.Close()
+
+	var rd io.Reader = f
+	if strings.HasSuffix(name, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return errors.Wrapf(err, "%v", name)
+		}
+		defer gz.Close()
+		rd = gz
+	}
+
+	columns := make(map[string]int)
+	for i, col := range strings.Split(schema, ",") {
+		columns[strings.TrimSpace(col)] = i
+	}
+
+	bucketCol, ok1 := columns["Bucket"]
+	keyCol, ok2 := columns["Key"]
+	if !ok1 || !ok2 {
+		return errors.Errorf("inventory schema %q lacks the columns Bucket and Key", schema)
+	}
+
+	// in reports for versioned buckets, only the current versions exist
+	latestCol, hasLatest := columns["IsLatest"]
+	deletedCol, hasDeleted := columns["IsDeleteMarker"]
+
+	dataPrefix := path.Join(prefix, "data") + "/"
+	if prefix == "" {
+		dataPrefix = "data/"
+	}
+
+	r := csv.NewReader(rd)
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "%v", name)
+		}
+
+		if len(rec) != len(columns) {
+			return errors.Errorf("%v: record has %d fields, the schema has %d", name, len(rec), len(columns))
+		}
+
+		if rec[bucketCol] != bucket {
+			continue
+		}
+
+		if (hasLatest && rec[latestCol] != "true") || (hasDeleted && rec[deletedCol] == "true") {
+			continue
+		}
+
+		// keys are URL-encoded in the report
+		key, err := url.QueryUnescape(rec[keyCol])
+		if err != nil {
+			return errors.Errorf("%v: invalid key %q", name, rec[keyCol])
+		}
+
+		if !strings.HasPrefix(key, dataPrefix) {
+			continue
+		}
+
+		id, err := restic.ParseID(path.Base(key))
+		if err != nil {
+			debug.Log("ignoring key %v, not a data file", key)
+			continue
+		}
+
+		inv.DataFiles.Insert(id)
+	}
+}
@@ -0,0 +1,100 @@
+package s3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+const testManifest = `{
+  "sourceBucket": "backups",
+  "destinationBucket": "arn:aws:s3:::inventory",
+  "version": "2016-11-30",
+  "creationTimestamp": "1514944800000",
+  "fileFormat": "CSV",
+  "fileSchema": "Bucket, Key, VersionId, IsLatest, IsDeleteMarker, Size",
+  "files": [
+    {"key": "backups/daily/data/3b3d5fd6.csv.gz", "size": 123, "MD5checksum": "f11166069f1990abeb9c97ace9cdfabc"}
+  ]
+}`
+
+func TestReadInventory(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	ids := restic.IDs{restic.NewRandomID(), restic.NewRandomID(), restic.NewRandomID(), restic.NewRandomID()}
+
+	csv := "" +
+		// packs of the repository in both layouts
+		`"backups","repo%2Fdata%2F` + ids[0].String()[:2] + `%2F` + ids[0].String() + `","","true","false","100"` + "\n" +
+		`"backups","repo/data/` + ids[1].String() + `","","true","false","100"` + "\n" +
+		// an old version and a removed file
+		`"backups","repo/data/` + ids[2].String() + `","v1","false","false","100"` + "\n" +
+		`"backups","repo/data/` + ids[3].String() + `","v2","true","true",""` + "\n" +
+		// other files and repositories
+		`"backups","repo/index/` + ids[2].String() + `","","true","false","100"` + "\n" +
+		`"backups","other/data/` + ids[3].String() + `","","true","false","100"` + "\n" +
+		`"backups","repo/data/README","","true","false","100"` + "\n" +
+		`"others","repo/data/` + ids[3].String() + `","","true","false","100"` + "\n"
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(csv))
+	rtest.OK(t, err)
+	rtest.OK(t, gz.Close())
+
+	// the layout of the report in the destination bucket
+	rtest.OK(t, os.MkdirAll(filepath.Join(tempdir, "2018-01-03T02-00Z"), 0700))
+	rtest.OK(t, os.MkdirAll(filepath.Join(tempdir, "data"), 0700))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(tempdir, "data", "3b3d5fd6.csv.gz"), buf.Bytes(), 0600))
+	manifest := filepath.Join(tempdir, "2018-01-03T02-00Z", "manifest.json")
+	rtest.OK(t, ioutil.WriteFile(manifest, []byte(testManifest), 0600))
+
+	inv, err := ReadInventory(manifest, "backups", "repo")
+	rtest.OK(t, err)
+	rtest.Equals(t, time.Unix(1514944800, 0), inv.Created)
+	rtest.Equals(t, restic.NewIDSet(ids[0], ids[1]), inv.DataFiles)
+
+	_, err = ReadInventory(manifest, "others", "repo")
+	rtest.Assert(t, err != nil, "inventory for another bucket accepted")
+}
+
+func TestReadInventoryCSV(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	id := restic.NewRandomID()
+	csv := `"backups","data/` + id.String()[:2] + `/` + id.String() + `","1024"` + "\n" +
+		`"backups","config","155"` + "\n"
+
+	fn := filepath.Join(tempdir, "inventory.csv")
+	rtest.OK(t, ioutil.WriteFile(fn, []byte(csv), 0600))
+
+	inv, err := ReadInventory(fn, "backups", "")
+	rtest.OK(t, err)
+	rtest.Assert(t, inv.Created.IsZero(), "creation time set for CSV file")
+	rtest.Equals(t, restic.NewIDSet(id), inv.DataFiles)
+
+	// the schema is only known from the manifest
+	rtest.OK(t, ioutil.WriteFile(fn, []byte(`"backups","config"`+"\n"), 0600))
+	_, err = ReadInventory(fn, "backups", "")
+	rtest.Assert(t, err != nil, "record with wrong number of fields accepted")
+}
+
+func TestReadInventoryParquet(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	fn := filepath.Join(tempdir, "manifest.json")
+	rtest.OK(t, ioutil.WriteFile(fn, []byte(`{"sourceBucket": "backups", "fileFormat": "Parquet"}`), 0600))
+
+	_, err := ReadInventory(fn, "backups", "")
+	rtest.Assert(t, err != nil, "Parquet inventory accepted")
+}
@@ -0,0 +1,161 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// multipartServer implements the parts of the S3 API used for multipart
+// uploads. The first attempt to upload the part failPart is rejected.
+type multipartServer struct {
+	failPart int
+
+	m         sync.Mutex
+	failed    bool
+	uploads   map[int]int
+	parts     map[int][]byte
+	object    []byte
+	completed bool
+	aborted   bool
+}
+
+func newMultipartServer(failPart int) *multipartServer {
+	return &multipartServer{
+		failPart: failPart,
+		uploads:  make(map[int]int),
+		parts:    make(map[int][]byte),
+	}
+}
+
+func (srv *multipartServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	srv.m.Lock()
+	defer srv.m.Unlock()
+
+	query := req.URL.Query()
+	_, location := query["location"]
+	_, uploads := query["uploads"]
+
+	switch {
+	case req.Method == "GET" && location:
+		fmt.Fprint(w, `<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/"></LocationConstraint>`)
+
+	case req.Method == "POST" && uploads:
+		fmt.Fprint(w, `<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>key</Key><UploadId>upload</UploadId></InitiateMultipartUploadResult>`)
+
+	case req.Method == "PUT" && query.Get("partNumber") != "":
+		partID, err := strconv.Atoi(query.Get("partNumber"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		buf, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		srv.uploads[partID]++
+
+		sum := md5.Sum(buf)
+		if req.Header.Get("Content-MD5") != base64.StdEncoding.EncodeToString(sum[:]) {
+			http.Error(w, "Content-MD5 does not match", http.StatusBadRequest)
+			return
+		}
+
+		if partID == srv.failPart && !srv.failed {
+			srv.failed = true
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `<Error><Code>BadDigest</Code><Message>injected error</Message></Error>`)
+			return
+		}
+
+		srv.parts[partID] = buf
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+
+	case req.Method == "POST" && query.Get("uploadId") != "":
+		var complete struct {
+			Parts []struct {
+				PartNumber int
+				ETag       string
+			} `xml:"Part"`
+		}
+
+		err := xml.NewDecoder(req.Body).Decode(&complete)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var object []byte
+		for _, part := range complete.Parts {
+			object = append(object, srv.parts[part.PartNumber]...)
+		}
+
+		srv.object = object
+		srv.completed = true
+		fmt.Fprint(w, `<CompleteMultipartUploadResult><Bucket>bucket</Bucket><Key>key</Key><ETag>"etag"</ETag></CompleteMultipartUploadResult>`)
+
+	case req.Method == "DELETE" && query.Get("uploadId") != "":
+		srv.aborted = true
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "not implemented", http.StatusNotImplemented)
+	}
+}
+
+func TestMultipartRetryPart(t *testing.T) {
+	srv := newMultipartServer(2)
+	ts := httptest.NewTLSServer(srv)
+	defer ts.Close()
+
+	cfg := NewConfig()
+	cfg.Endpoint = ts.Listener.Addr().String()
+	cfg.KeyID = "key"
+	cfg.Secret = "secret"
+	cfg.Bucket = "bucket"
+	cfg.Prefix = "restic"
+	cfg.Layout = "default"
+	cfg.PartSize = minPartSize
+
+	be, err := open(cfg, ts.Client().Transport)
+	rtest.OK(t, err)
+
+	// two full parts and a short last part
+	data := rtest.Random(23, 2*minPartSize*1024*1024+1000)
+	h := restic.Handle{Type: restic.DataFile, Name: restic.Hash(data).String()}
+
+	err = be.Save(context.TODO(), h, restic.NewByteReader(data))
+	rtest.OK(t, err)
+
+	rtest.Assert(t, srv.completed, "multipart upload was not completed")
+	rtest.Assert(t, !srv.aborted, "multipart upload was aborted")
+	rtest.Assert(t, bytes.Equal(srv.object, data), "uploaded object does not match the data")
+
+	var partIDs []int
+	for partID := range srv.uploads {
+		partIDs = append(partIDs, partID)
+	}
+	sort.Ints(partIDs)
+	rtest.Equals(t, []int{1, 2, 3}, partIDs)
+
+	rtest.Equals(t, 1, srv.uploads[1])
+	rtest.Equals(t, 2, srv.uploads[2])
+	rtest.Equals(t, 1, srv.uploads[3])
+}
@@ -1,9 +1,12 @@
 package s3
 
 import (
+	"bytes"
 	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
 	"io"
-	"io/ioutil"
 	"net/http"
 	"os"
 	"path"
@@ -14,6 +17,7 @@ import (
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 
+	"github.com/cenkalti/backoff"
 	"github.com/minio/minio-go"
 	"github.com/minio/minio-go/pkg/credentials"
 
@@ -31,11 +35,26 @@ type Backend struct {
 // make sure that *Backend implements backend.Backend
 var _ restic.Backend = &Backend{}
 
+// make sure that *Backend implements restic.Renamer
+var _ restic.Renamer = &Backend{}
+
 const defaultLayout = "default"
 
+// defaultPartSize is the size of the individual parts used for multipart
+// uploads when no part size has been configured.
+const defaultPartSize = 64 * 1024 * 1024
+
+// maxPartTries is the number of times uploading a single part is attempted
+// before the whole multipart upload is aborted.
+const maxPartTries = 5
+
 func open(cfg Config, rt http.RoundTripper) (*Backend, error) {
 	debug.Log("open, config %#v", cfg)
 
+	if err := checkPartSize(cfg.PartSize); err != nil {
+		return nil, err
+	}
+
 	if cfg.MaxRetries > 0 {
 		minio.MaxRetry = int(cfg.MaxRetries)
 	}
@@ -255,14 +274,152 @@ func (be *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindRe
 	opts := minio.PutObjectOptions{}
 	opts.ContentType = "application/octet-stream"
 
+	if int64(rd.Length()) > be.partSize() {
+		return be.saveMultipart(ctx, objName, rd, opts)
+	}
+
+	// compute the MD5 hash of the data, so that the server can detect
+	// corruption during the upload
+	sum, err := backend.HashRewindReader(rd, md5.New())
+	if err != nil {
+		return err
+	}
+
+	meta := map[string]string{"Content-Type": opts.ContentType}
+	core := minio.Core{Client: be.client}
+
+	// Core.PutObject does not accept a context, abort the upload by failing
+	// the next read from the body instead
+	body := contextReader{ctx: ctx, rd: rd}
+
 	debug.Log("PutObject(%v, %v, %v)", be.cfg.Bucket, objName, rd.Length())
-	n, err := be.client.PutObjectWithContext(ctx, be.cfg.Bucket, objName, ioutil.NopCloser(rd), int64(rd.Length()), opts)
+	info, err := core.PutObject(be.cfg.Bucket, objName, body, int64(rd.Length()), base64.StdEncoding.EncodeToString(sum), "", meta)
 
-	debug.Log("%v -> %v bytes, err %#v: %v", objName, n, err, err)
+	debug.Log("%v -> %v bytes, err %#v: %v", objName, info.Size, err, err)
 
+	// the server rejects the upload when the data does not match the
+	// Content-MD5 header, so the ETag does not need to be checked
 	return errors.Wrap(err, "client.PutObject")
 }
 
+// contextReader returns the error of ctx from Read as soon as ctx is
+// cancelled.
+type contextReader struct {
+	ctx context.Context
+	rd  io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.rd.Read(p)
+}
+
+// etagSum returns the MD5 hash contained in the ETag of an object. For objects
+// uploaded with the multipart API the ETag is not the MD5 hash of the content,
+// and neither is it for objects encrypted with SSE-KMS or SSE-C. In this case
+// nil is returned.
+func etagSum(info minio.ObjectInfo) []byte {
+	if info.Metadata.Get("X-Amz-Server-Side-Encryption") == "aws:kms" ||
+		info.Metadata.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm") != "" {
+		return nil
+	}
+
+	etag := strings.Trim(info.ETag, `"`)
+	if len(etag) != 2*md5.Size {
+		return nil
+	}
+
+	sum, err := hex.DecodeString(etag)
+	if err != nil {
+		return nil
+	}
+
+	return sum
+}
+
+// partSize returns the size of the parts used for multipart uploads.
+func (be *Backend) partSize() int64 {
+	if be.cfg.PartSize == 0 {
+		return defaultPartSize
+	}
+	return int64(be.cfg.PartSize) * 1024 * 1024
+}
+
+// saveMultipart uploads the data from rd to objName using the S3 multipart
+// API. Each part is retried individually, so a dropped connection only
+// requires sending the current part again instead of the whole file. When
+// the upload fails, it is aborted so that no orphaned parts are left behind.
+func (be *Backend) saveMultipart(ctx context.Context, objName string, rd restic.RewindReader, opts minio.PutObjectOptions) error {
+	core := minio.Core{Client: be.client}
+
+	debug.Log("NewMultipartUpload(%v, %v, %v)", be.cfg.Bucket, objName, rd.Length())
+	uploadID, err := core.NewMultipartUpload(be.cfg.Bucket, objName, opts)
+	if err != nil {
+		return errors.Wrap(err, "NewMultipartUpload")
+	}
+
+	parts, err := be.uploadParts(ctx, core, objName, uploadID, rd)
+	if err != nil {
+		debug.Log("upload %v failed, aborting: %v", uploadID, err)
+		if aerr := core.AbortMultipartUpload(be.cfg.Bucket, objName, uploadID); aerr != nil {
+			debug.Log("AbortMultipartUpload(%v) returned error: %v", uploadID, aerr)
+		}
+		return err
+	}
+
+	err = core.CompleteMultipartUpload(be.cfg.Bucket, objName, uploadID, parts)
+	debug.Log("%v -> %v parts, err %v", objName, len(parts), err)
+
+	return errors.Wrap(err, "CompleteMultipartUpload")
+}
+
+// uploadParts reads rd in chunks of be.partSize() bytes and uploads each of
+// them as a part of the multipart upload uploadID.
+func (be *Backend) uploadParts(ctx context.Context, core minio.Core, objName, uploadID string, rd io.Reader) ([]minio.CompletePart, error) {
+	buf := make([]byte, be.partSize())
+	var parts []minio.CompletePart
+
+	for partID := 1; ; partID++ {
+		n, err := io.ReadFull(rd, buf)
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, errors.Wrap(err, "ReadFull")
+		}
+
+		data := buf[:n]
+		sum := md5.Sum(data)
+		md5sum := base64.StdEncoding.EncodeToString(sum[:])
+
+		var part minio.ObjectPart
+		err = backoff.RetryNotify(func() error {
+			var err error
+			part, err = core.PutObjectPart(be.cfg.Bucket, objName, uploadID, partID, bytes.NewReader(data), int64(n), md5sum, "")
+			return err
+		},
+			backoff.WithContext(backoff.WithMaxTries(backoff.NewExponentialBackOff(), maxPartTries), ctx),
+			func(err error, d time.Duration) {
+				debug.Log("PutObjectPart(%v, %d) returned error, retrying after %v: %v", uploadID, partID, d, err)
+			},
+		)
+		if err != nil {
+			return nil, errors.Wrapf(err, "PutObjectPart(%d)", partID)
+		}
+
+		parts = append(parts, minio.CompletePart{PartNumber: partID, ETag: part.ETag})
+
+		if n < len(buf) {
+			break
+		}
+	}
+
+	return parts, nil
+}
+
 // wrapReader wraps an io.ReadCloser to run an additional function on Close.
 type wrapReader struct {
 	io.ReadCloser
@@ -319,7 +476,7 @@ func (be *Backend) openReader(ctx context.Context, h restic.Handle, length int,
 		return nil, err
 	}
 
-	closeRd := wrapReader{
+	var closeRd io.ReadCloser = wrapReader{
 		ReadCloser: rd,
 		f: func() {
 			debug.Log("Close()")
@@ -327,6 +484,17 @@ func (be *Backend) openReader(ctx context.Context, h restic.Handle, length int,
 		},
 	}
 
+	// the ETag can only be compared when the whole file is read
+	if offset == 0 && length == 0 {
+		closeRd = backend.VerifyReadCloser(closeRd, objName, md5.New(), func() ([]byte, error) {
+			info, err := rd.Stat()
+			if err != nil {
+				return nil, errors.Wrap(err, "Stat")
+			}
+			return etagSum(info), nil
+		})
+	}
+
 	return closeRd, err
 }
 
@@ -426,8 +594,10 @@ func (be *Backend) List(ctx context.Context, t restic.FileType, fn func(restic.F
 		}
 
 		fi := restic.FileInfo{
-			Name: path.Base(m),
-			Size: obj.Size,
+			Name:         path.Base(m),
+			Size:         obj.Size,
+			ModTime:      obj.LastModified,
+			StorageClass: obj.StorageClass,
 		}
 
 		if ctx.Err() != nil {
@@ -461,7 +631,11 @@ func (be *Backend) Delete(ctx context.Context) error {
 		restic.KeyFile,
 		restic.LockFile,
 		restic.SnapshotFile,
-		restic.IndexFile}
+		restic.IndexFile,
+		restic.StatsFile,
+		restic.TrashFile,
+		restic.LedgerFile,
+		restic.NewConfigFile}
 
 	for _, t := range alltypes {
 		err := be.removeKeys(ctx, t)
@@ -476,9 +650,53 @@ func (be *Backend) Delete(ctx context.Context) error {
 // Close does nothing
 func (be *Backend) Close() error { return nil }
 
-// Rename moves a file based on the new layout l.
-func (be *Backend) Rename(h restic.Handle, l backend.Layout) error {
-	debug.Log("Rename %v to %v", h, l)
+// Rename moves the file from to the handle to. The object is copied on the
+// server and removed afterwards, its content is not transferred.
+func (be *Backend) Rename(ctx context.Context, from, to restic.Handle) error {
+	debug.Log("Rename %v to %v", from, to)
+	if err := to.Valid(); err != nil {
+		return err
+	}
+
+	oldname, newname := be.Filename(from), be.Filename(to)
+
+	// CopyObject replaces existing objects, Save never does
+	be.sem.GetToken()
+	_, err := be.client.StatObject(be.cfg.Bucket, newname, minio.StatObjectOptions{})
+	be.sem.ReleaseToken()
+
+	if err == nil {
+		return errors.Errorf("rename %v: file %v already exists", from, to)
+	}
+	if !be.IsNotExist(err) {
+		return errors.Wrap(err, "client.StatObject")
+	}
+
+	src := minio.NewSourceInfo(be.cfg.Bucket, oldname, nil)
+
+	dst, err := minio.NewDestinationInfo(be.cfg.Bucket, newname, nil, nil)
+	if err != nil {
+		return errors.Wrap(err, "NewDestinationInfo")
+	}
+
+	be.sem.GetToken()
+	err = be.client.CopyObject(dst, src)
+	be.sem.ReleaseToken()
+
+	if err != nil {
+		return errors.Wrap(err, "client.CopyObject")
+	}
+
+	be.sem.GetToken()
+	err = be.client.RemoveObject(be.cfg.Bucket, oldname)
+	be.sem.ReleaseToken()
+
+	return errors.Wrap(err, "client.RemoveObject")
+}
+
+// MoveToLayout moves a file based on the new layout l.
+func (be *Backend) MoveToLayout(h restic.Handle, l backend.Layout) error {
+	debug.Log("MoveToLayout %v to %v", h, l)
 	oldname := be.Filename(h)
 	newname := l.Filename(h)
 
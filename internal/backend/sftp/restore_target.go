@@ -0,0 +1,91 @@
+package sftp
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// TargetFS is a directory on an sftp server that snapshots can be restored
+// to. It implements restic.TargetFS.
+type TargetFS struct {
+	*SFTP
+}
+
+var _ restic.TargetFS = &TargetFS{}
+
+// OpenTargetFS connects to the server as described by cfg and returns the
+// directory cfg.Path as a file system to restore snapshots to. The directory
+// is created if it does not exist.
+func OpenTargetFS(cfg Config) (*TargetFS, error) {
+	debug.Log("open restore target with config %#v", cfg)
+
+	cmd, args, err := buildSSHCommand(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	sftp, err := startClient(cmd, args...)
+	if err != nil {
+		debug.Log("unable to start program: %v", err)
+		return nil, err
+	}
+
+	sftp.Config = cfg
+	sftp.p = cfg.Path
+
+	err = sftp.mkdirAll(cfg.Path, 0700)
+	if err != nil {
+		_ = sftp.Close()
+		return nil, err
+	}
+
+	return &TargetFS{SFTP: sftp}, nil
+}
+
+// Mkdir creates the directory name, an existing directory is not an error.
+func (t *TargetFS) Mkdir(name string, perm os.FileMode) error {
+	p := Join(t.p, name)
+
+	err := t.c.Mkdir(p)
+	if err != nil {
+		fi, serr := t.c.Lstat(p)
+		if serr != nil || !fi.IsDir() {
+			return errors.Wrapf(err, "(%v)", p)
+		}
+	}
+
+	return t.c.Chmod(p, perm)
+}
+
+// Create creates or truncates the file name.
+func (t *TargetFS) Create(name string, perm os.FileMode) (io.WriteCloser, error) {
+	p := Join(t.p, name)
+
+	f, err := t.c.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return nil, errors.Wrapf(err, "(%v)", p)
+	}
+
+	err = f.Chmod(perm)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Symlink creates newname as a symlink to oldname.
+func (t *TargetFS) Symlink(oldname, newname string) error {
+	return t.c.Symlink(oldname, Join(t.p, newname))
+}
+
+// Chtimes sets the access and modification time of name.
+func (t *TargetFS) Chtimes(name string, atime, mtime time.Time) error {
+	return t.c.Chtimes(Join(t.p, name), atime, mtime)
+}
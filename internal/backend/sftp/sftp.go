@@ -33,6 +33,8 @@ type SFTP struct {
 }
 
 var _ restic.Backend = &SFTP{}
+var _ restic.ListVersioner = &SFTP{}
+var _ restic.Renamer = &SFTP{}
 
 const defaultLayout = "default"
 
@@ -312,8 +314,16 @@ func (r *SFTP) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader
 		return errors.Wrap(err, "OpenFile")
 	}
 
+	// set the permissions while the data is written, so that the request
+	// doesn't need a round trip of its own
+	chmodErr := make(chan error, 1)
+	go func() {
+		chmodErr <- f.Chmod(backend.Modes.File)
+	}()
+
 	// save data
-	_, err = io.Copy(f, rd)
+	err = writeData(f, rd)
+	errChmod := <-chmodErr
 	if err != nil {
 		_ = f.Close()
 		return errors.Wrap(err, "Write")
@@ -324,7 +334,42 @@ func (r *SFTP) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader
 		return errors.Wrap(err, "Close")
 	}
 
-	return errors.Wrap(r.c.Chmod(filename, backend.Modes.File), "Chmod")
+	return errors.Wrap(errChmod, "Chmod")
+}
+
+// writeBufferSize is the amount of data passed to the sftp client at once.
+// The client splits it into packets and keeps many write requests in flight,
+// so the time needed for a file does not grow with the number of packets
+// times the round trip time.
+const writeBufferSize = 2 * 1024 * 1024
+
+// writeData writes all data from rd to f. Unlike io.Copy, which reads and
+// sends only 32KiB at a time and waits for an additional empty write at the
+// end, small files are sent with a single request.
+func writeData(f *sftp.File, rd restic.RewindReader) error {
+	size := rd.Length()
+	if size > writeBufferSize || size <= 0 {
+		size = writeBufferSize
+	}
+	buf := make([]byte, size)
+
+	for {
+		n, err := io.ReadFull(rd, buf)
+		if n > 0 {
+			_, werr := f.Write(buf[:n])
+			if werr != nil {
+				return werr
+			}
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
 }
 
 // Load runs fn with a reader that yields the contents of the file at h at the
@@ -356,11 +401,29 @@ func (r *SFTP) openReader(ctx context.Context, h restic.Handle, length int, offs
 		}
 	}
 
+	rd := backgroundCloser{f}
 	if length > 0 {
-		return backend.LimitReadCloser(f, int64(length)), nil
+		return backend.LimitReadCloser(rd, int64(length)), nil
 	}
 
-	return f, nil
+	return rd, nil
+}
+
+// backgroundCloser closes a file which was opened for reading without
+// waiting for the reply of the server. Nothing can go wrong with closing such
+// a file that the caller could handle, but waiting costs a round trip.
+type backgroundCloser struct {
+	*sftp.File
+}
+
+func (f backgroundCloser) Close() error {
+	go func() {
+		err := f.File.Close()
+		if err != nil {
+			debug.Log("Close %v returned error %v", f.Name(), err)
+		}
+	}()
+	return nil
 }
 
 // Stat returns information about a blob.
@@ -411,6 +474,34 @@ func (r *SFTP) Remove(ctx context.Context, h restic.Handle) error {
 	return r.c.Remove(r.Filename(h))
 }
 
+// Rename moves the file from to the handle to.
+func (r *SFTP) Rename(ctx context.Context, from, to restic.Handle) error {
+	debug.Log("Rename(%v, %v)", from, to)
+	if err := r.clientError(); err != nil {
+		return err
+	}
+
+	if err := to.Valid(); err != nil {
+		return err
+	}
+
+	oldname, newname := r.Filename(from), r.Filename(to)
+
+	// the sftp rename (unlike POSIX rename) fails if the target exists
+	err := r.c.Rename(oldname, newname)
+	if r.IsNotExist(err) {
+		// error is probably caused by a missing directory, try to create it
+		mkdirErr := r.mkdirAll(r.Dirname(to), backend.Modes.Dir)
+		if mkdirErr != nil {
+			debug.Log("error creating dir %v: %v", r.Dirname(to), mkdirErr)
+		} else {
+			err = r.c.Rename(oldname, newname)
+		}
+	}
+
+	return errors.Wrap(err, "Rename")
+}
+
 // List runs fn for each file in the backend which has the type t. When an
 // error occurs (or fn returns an error), List stops and returns it.
 func (r *SFTP) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
@@ -440,8 +531,9 @@ func (r *SFTP) List(ctx context.Context, t restic.FileType, fn func(restic.FileI
 		debug.Log("send %v\n", path.Base(walker.Path()))
 
 		rfi := restic.FileInfo{
-			Name: path.Base(walker.Path()),
-			Size: fi.Size(),
+			Name:    path.Base(walker.Path()),
+			Size:    fi.Size(),
+			ModTime: fi.ModTime(),
 		}
 
 		if ctx.Err() != nil {
@@ -461,6 +553,37 @@ func (r *SFTP) List(ctx context.Context, t restic.FileType, fn func(restic.FileI
 	return ctx.Err()
 }
 
+// listVersionMinAge is the minimal age of a directory modification time to be
+// used as a list version. SFTP only transfers the modification time with a
+// resolution of one second, so several changes within this time may not be
+// reflected.
+const listVersionMinAge = 3 * time.Second
+
+// ListVersion returns a version for the list of files of type t, derived
+// from the modification time of the directory the files are stored in.
+func (r *SFTP) ListVersion(ctx context.Context, t restic.FileType) (string, error) {
+	if err := r.clientError(); err != nil {
+		return "", err
+	}
+
+	basedir, subdirs := r.Basedir(t)
+	if subdirs {
+		// files in subdirectories don't change the modification time of basedir
+		return "", nil
+	}
+
+	fi, err := r.c.Stat(basedir)
+	if err != nil {
+		return "", errors.Wrap(err, "Stat")
+	}
+
+	if time.Since(fi.ModTime()) < listVersionMinAge {
+		return "", nil
+	}
+
+	return fmt.Sprintf("%d", fi.ModTime().Unix()), nil
+}
+
 var closeTimeout = 2 * time.Second
 
 // Close closes the sftp connection and terminates the underlying command.
@@ -0,0 +1,205 @@
+package sftp
+
+import (
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+)
+
+// SourceFS reads the files to back up from another host, which only needs to
+// run an sftp server. It implements fs.FS, all names are absolute paths on
+// the server.
+type SourceFS struct {
+	*SFTP
+
+	// attrs caches the attributes which the server returns for all entries
+	// when a directory is read, so that the archiver calling Lstat for each
+	// entry afterwards does not need a round trip per file. An entry is
+	// removed when it is used.
+	m     sync.Mutex
+	attrs map[string]os.FileInfo
+}
+
+var _ fs.FS = &SourceFS{}
+
+// OpenSourceFS connects to the server as described by cfg. The path in cfg is
+// not used.
+func OpenSourceFS(cfg Config) (*SourceFS, error) {
+	debug.Log("open source fs with config %#v", cfg)
+
+	cmd, args, err := buildSSHCommand(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	sftp, err := startClient(cmd, args...)
+	if err != nil {
+		debug.Log("unable to start program: %v", err)
+		return nil, err
+	}
+
+	sftp.Config = cfg
+	return &SourceFS{SFTP: sftp, attrs: make(map[string]os.FileInfo)}, nil
+}
+
+// remoteFileInfo returns the remote metadata in Sys().
+type remoteFileInfo struct {
+	os.FileInfo
+	stat *fs.RemoteStat
+}
+
+func (fi remoteFileInfo) Sys() interface{} { return fi.stat }
+
+// convertError returns an error for which os.IsNotExist works if the server
+// reported that name does not exist.
+func (s *SourceFS) convertError(op, name string, err error) error {
+	if s.IsNotExist(err) {
+		return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return errors.Wrapf(err, "%v(%v)", op, name)
+}
+
+// fileInfo converts the attributes returned by the server for name. The
+// target of a symlink is read from the server.
+func (s *SourceFS) fileInfo(name string, fi os.FileInfo) (os.FileInfo, error) {
+	rs := &fs.RemoteStat{}
+	if st, ok := fi.Sys().(*sftp.FileStat); ok {
+		rs.UID = st.UID
+		rs.GID = st.GID
+		rs.AccessTime = time.Unix(int64(st.Atime), 0)
+	}
+
+	if fi.Mode()&os.ModeSymlink != 0 {
+		target, err := s.c.ReadLink(name)
+		if err != nil {
+			return nil, s.convertError("readlink", name, err)
+		}
+		rs.LinkTarget = target
+	}
+
+	return remoteFileInfo{FileInfo: fi, stat: rs}, nil
+}
+
+// Lstat returns the attributes of name, without following symlinks.
+func (s *SourceFS) Lstat(name string) (os.FileInfo, error) {
+	s.m.Lock()
+	fi, ok := s.attrs[name]
+	delete(s.attrs, name)
+	s.m.Unlock()
+
+	if ok {
+		return fi, nil
+	}
+
+	fi, err := s.c.Lstat(name)
+	if err != nil {
+		return nil, s.convertError("lstat", name, err)
+	}
+
+	return s.fileInfo(name, fi)
+}
+
+// Readlink returns the destination of the symlink name.
+func (s *SourceFS) Readlink(name string) (string, error) {
+	target, err := s.c.ReadLink(name)
+	if err != nil {
+		return "", s.convertError("readlink", name, err)
+	}
+	return target, nil
+}
+
+// readDir reads the directory name, and caches the attributes of all entries
+// for Lstat.
+func (s *SourceFS) readDir(name string) ([]os.FileInfo, error) {
+	list, err := s.c.ReadDir(name)
+	if err != nil {
+		return nil, s.convertError("readdir", name, err)
+	}
+
+	res := make([]os.FileInfo, 0, len(list))
+	for _, fi := range list {
+		if fi.Name() == "." || fi.Name() == ".." {
+			continue
+		}
+
+		filename := path.Join(name, fi.Name())
+		fi, err = s.fileInfo(filename, fi)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, fi)
+
+		s.m.Lock()
+		s.attrs[filename] = fi
+		s.m.Unlock()
+	}
+
+	return res, nil
+}
+
+// ReadDirNames returns the sorted names of the entries of the directory name.
+func (s *SourceFS) ReadDirNames(name string) ([]string, error) {
+	list, err := s.readDir(name)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(list))
+	for _, fi := range list {
+		names = append(names, fi.Name())
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Open opens the file name for reading.
+func (s *SourceFS) Open(name string) (fs.File, error) {
+	f, err := s.c.Open(name)
+	if err != nil {
+		return nil, s.convertError("open", name, err)
+	}
+
+	return &sourceFile{File: f, fs: s, name: name}, nil
+}
+
+// sourceFile is a file opened on the server.
+type sourceFile struct {
+	*sftp.File
+	fs   *SourceFS
+	name string
+}
+
+var _ fs.File = &sourceFile{}
+
+// Fd returns an invalid file descriptor, the file is not a local file.
+func (f *sourceFile) Fd() uintptr {
+	return ^uintptr(0)
+}
+
+// Stat returns the attributes of the open file.
+func (f *sourceFile) Stat() (os.FileInfo, error) {
+	fi, err := f.File.Stat()
+	if err != nil {
+		return nil, f.fs.convertError("stat", f.name, err)
+	}
+	return f.fs.fileInfo(f.name, fi)
+}
+
+// Readdir returns all entries of the directory, n is ignored.
+func (f *sourceFile) Readdir(n int) ([]os.FileInfo, error) {
+	return f.fs.readDir(f.name)
+}
+
+// Readdirnames returns the names of all entries of the directory, n is
+// ignored.
+func (f *sourceFile) Readdirnames(n int) ([]string, error) {
+	return f.fs.ReadDirNames(f.name)
+}
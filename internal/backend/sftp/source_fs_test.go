@@ -0,0 +1,66 @@
+package sftp_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/backend/sftp"
+	"github.com/restic/restic/internal/fs"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestSourceFS(t *testing.T) {
+	if sftpServer == "" {
+		t.Skip("sftp server binary not found")
+	}
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	rtest.OK(t, os.MkdirAll(filepath.Join(tempdir, "dir", "sub"), 0755))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(tempdir, "dir", "file"), []byte("foobar"), 0644))
+	rtest.OK(t, os.Symlink("file", filepath.Join(tempdir, "dir", "link")))
+
+	sfs, err := sftp.OpenSourceFS(sftp.Config{Command: fmt.Sprintf("%q -e", sftpServer)})
+	rtest.OK(t, err)
+	defer func() {
+		rtest.OK(t, sfs.Close())
+	}()
+
+	dir := filepath.Join(tempdir, "dir")
+	names, err := sfs.ReadDirNames(dir)
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"file", "link", "sub"}, names)
+
+	// the attributes are returned from the cache filled by ReadDirNames
+	for _, name := range names {
+		fi, err := sfs.Lstat(filepath.Join(dir, name))
+		rtest.OK(t, err)
+		rtest.Equals(t, name, fi.Name())
+
+		rs, ok := fi.Sys().(*fs.RemoteStat)
+		rtest.Assert(t, ok, "Sys() of %v returned %T", name, fi.Sys())
+		rtest.Equals(t, uint32(os.Getuid()), rs.UID)
+
+		if name == "link" {
+			rtest.Equals(t, "file", rs.LinkTarget)
+		}
+	}
+
+	fi, err := sfs.Lstat(filepath.Join(dir, "file"))
+	rtest.OK(t, err)
+	rtest.Equals(t, int64(6), fi.Size())
+
+	_, err = sfs.Lstat(filepath.Join(dir, "missing"))
+	rtest.Assert(t, os.IsNotExist(err), "wrong error for missing file: %v", err)
+
+	f, err := sfs.Open(filepath.Join(dir, "file"))
+	rtest.OK(t, err)
+	buf, err := ioutil.ReadAll(f)
+	rtest.OK(t, err)
+	rtest.OK(t, f.Close())
+	rtest.Equals(t, []byte("foobar"), buf)
+}
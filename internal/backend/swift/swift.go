@@ -31,6 +31,9 @@ type beSwift struct {
 // ensure statically that *beSwift implements restic.Backend.
 var _ restic.Backend = &beSwift{}
 
+// ensure statically that *beSwift implements restic.Renamer.
+var _ restic.Renamer = &beSwift{}
+
 // Open opens the swift backend at a container in region. The container is
 // created if it does not exist yet.
 func Open(cfg Config, rt http.RoundTripper) (restic.Backend, error) {
@@ -226,6 +229,34 @@ func (be *beSwift) Remove(ctx context.Context, h restic.Handle) error {
 	return errors.Wrap(err, "conn.ObjectDelete")
 }
 
+// Rename moves the file from to the handle to. The object is copied on the
+// server and removed afterwards, its content is not transferred.
+func (be *beSwift) Rename(ctx context.Context, from, to restic.Handle) error {
+	debug.Log("Rename %v to %v", from, to)
+	if err := to.Valid(); err != nil {
+		return err
+	}
+
+	oldname, newname := be.Filename(from), be.Filename(to)
+
+	be.sem.GetToken()
+	defer be.sem.ReleaseToken()
+
+	// ObjectMove replaces existing objects, Save never does
+	switch _, _, err := be.conn.Object(be.container, newname); err {
+	case nil:
+		return errors.Errorf("rename %v: file %v already exists", from, to)
+
+	case swift.ObjectNotFound:
+
+	default:
+		return errors.Wrap(err, "conn.Object")
+	}
+
+	err := be.conn.ObjectMove(be.container, oldname, be.container, newname)
+	return errors.Wrap(err, "conn.ObjectMove")
+}
+
 // List runs fn for each file in the backend which has the type t. When an
 // error occurs (or fn returns an error), List stops and returns it.
 func (be *beSwift) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
@@ -250,8 +281,9 @@ func (be *beSwift) List(ctx context.Context, t restic.FileType, fn func(restic.F
 				}
 
 				fi := restic.FileInfo{
-					Name: m,
-					Size: obj.Bytes,
+					Name:    m,
+					Size:    obj.Bytes,
+					ModTime: obj.LastModified,
 				}
 
 				if ctx.Err() != nil {
@@ -301,7 +333,11 @@ func (be *beSwift) Delete(ctx context.Context) error {
 		restic.KeyFile,
 		restic.LockFile,
 		restic.SnapshotFile,
-		restic.IndexFile}
+		restic.IndexFile,
+		restic.StatsFile,
+		restic.TrashFile,
+		restic.LedgerFile,
+		restic.NewConfigFile}
 
 	for _, t := range alltypes {
 		err := be.removeKeys(ctx, t)
@@ -0,0 +1,141 @@
+package backend
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// listPageSize is the number of files returned by one LIST request of the
+// cloud storage services, further requests are needed for more files.
+const listPageSize = 1000
+
+// UsageBackend counts the requests sent to the backend and the data
+// transferred, see restic.BackendUsage. Each attempt is counted, so it needs
+// to be wrapped by a RetryBackend and not the other way around.
+type UsageBackend struct {
+	restic.Backend
+	location string
+
+	// the counters are accessed atomically
+	uploaded, downloaded           uint64
+	put, get, head, list, deletion uint64
+}
+
+// statically ensure that UsageBackend implements restic.Backend.
+var _ restic.Backend = &UsageBackend{}
+
+// NewUsageBackend wraps be with a backend that counts the requests sent to
+// it. location describes the backend in the usage.
+func NewUsageBackend(be restic.Backend, location string) *UsageBackend {
+	return &UsageBackend{Backend: be, location: location}
+}
+
+// Usage returns the requests and the data transferred so far.
+func (be *UsageBackend) Usage() restic.BackendUsage {
+	return restic.BackendUsage{
+		Location:        be.location,
+		BytesUploaded:   atomic.LoadUint64(&be.uploaded),
+		BytesDownloaded: atomic.LoadUint64(&be.downloaded),
+		PutRequests:     atomic.LoadUint64(&be.put),
+		GetRequests:     atomic.LoadUint64(&be.get),
+		HeadRequests:    atomic.LoadUint64(&be.head),
+		ListRequests:    atomic.LoadUint64(&be.list),
+		DeleteRequests:  atomic.LoadUint64(&be.deletion),
+	}
+}
+
+// countingReader adds the number of bytes read to n.
+type countingReader struct {
+	io.Reader
+	n *uint64
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	atomic.AddUint64(r.n, uint64(n))
+	return n, err
+}
+
+// countingRewindReader adds the number of bytes read to n.
+type countingRewindReader struct {
+	restic.RewindReader
+	n *uint64
+}
+
+func (r countingRewindReader) Read(p []byte) (int, error) {
+	n, err := r.RewindReader.Read(p)
+	atomic.AddUint64(r.n, uint64(n))
+	return n, err
+}
+
+// Save stores the data in the backend under the given handle.
+func (be *UsageBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	atomic.AddUint64(&be.put, 1)
+	return be.Backend.Save(ctx, h, countingRewindReader{RewindReader: rd, n: &be.uploaded})
+}
+
+// Load runs fn with a reader that yields the contents of the file at h.
+func (be *UsageBackend) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	atomic.AddUint64(&be.get, 1)
+	return be.Backend.Load(ctx, h, length, offset, func(rd io.Reader) error {
+		return fn(countingReader{Reader: rd, n: &be.downloaded})
+	})
+}
+
+// Stat returns information about the File identified by h.
+func (be *UsageBackend) Stat(ctx context.Context, h restic.Handle) (restic.FileInfo, error) {
+	atomic.AddUint64(&be.head, 1)
+	return be.Backend.Stat(ctx, h)
+}
+
+// Test returns whether the file h exists.
+func (be *UsageBackend) Test(ctx context.Context, h restic.Handle) (bool, error) {
+	atomic.AddUint64(&be.head, 1)
+	return be.Backend.Test(ctx, h)
+}
+
+// Remove removes the file h.
+func (be *UsageBackend) Remove(ctx context.Context, h restic.Handle) error {
+	atomic.AddUint64(&be.deletion, 1)
+	return be.Backend.Remove(ctx, h)
+}
+
+// List runs fn for each file of type t. One request is counted for each
+// started page of files.
+func (be *UsageBackend) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
+	atomic.AddUint64(&be.list, 1)
+
+	var n uint64
+	return be.Backend.List(ctx, t, func(fi restic.FileInfo) error {
+		n++
+		if n > listPageSize && n%listPageSize == 1 {
+			atomic.AddUint64(&be.list, 1)
+		}
+		return fn(fi)
+	})
+}
+
+// Rename moves a file to another handle in the wrapped backend. If it does
+// not implement restic.Renamer, restic.ErrRenameUnsupported is returned.
+func (be *UsageBackend) Rename(ctx context.Context, from, to restic.Handle) error {
+	rn, ok := be.Backend.(restic.Renamer)
+	if !ok {
+		return restic.ErrRenameUnsupported
+	}
+
+	return rn.Rename(ctx, from, to)
+}
+
+// ListVersion returns the list version reported by the wrapped backend. If it
+// does not implement restic.ListVersioner, the empty string is returned.
+func (be *UsageBackend) ListVersion(ctx context.Context, t restic.FileType) (string, error) {
+	lv, ok := be.Backend.(restic.ListVersioner)
+	if !ok {
+		return "", nil
+	}
+
+	return lv.ListVersion(ctx, t)
+}
@@ -0,0 +1,64 @@
+package backend_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestUsageBackend(t *testing.T) {
+	be := backend.NewUsageBackend(mem.New(), "mem:")
+	ctx := context.TODO()
+
+	data := rtest.Random(23, 5000)
+	for i := 0; i < 1001; i++ {
+		id := restic.Hash([]byte{byte(i), byte(i >> 8)})
+		h := restic.Handle{Type: restic.DataFile, Name: id.String()}
+		rtest.OK(t, be.Save(ctx, h, restic.NewByteReader(data[:i%10])))
+	}
+
+	h := restic.Handle{Type: restic.DataFile, Name: restic.Hash(data).String()}
+	rtest.OK(t, be.Save(ctx, h, restic.NewByteReader(data)))
+
+	rtest.OK(t, be.Load(ctx, h, 100, 10, func(rd io.Reader) error {
+		buf, err := ioutil.ReadAll(rd)
+		if err == nil && !bytes.Equal(data[10:110], buf) {
+			t.Errorf("wrong data returned")
+		}
+		return err
+	}))
+
+	_, err := be.Stat(ctx, h)
+	rtest.OK(t, err)
+	_, err = be.Test(ctx, h)
+	rtest.OK(t, err)
+
+	rtest.OK(t, be.List(ctx, restic.DataFile, func(restic.FileInfo) error {
+		return nil
+	}))
+
+	rtest.OK(t, be.Remove(ctx, h))
+
+	var written uint64
+	for i := 0; i < 1001; i++ {
+		written += uint64(i % 10)
+	}
+
+	rtest.Equals(t, restic.BackendUsage{
+		Location:        "mem:",
+		BytesUploaded:   written + uint64(len(data)),
+		BytesDownloaded: 100,
+		PutRequests:     1002,
+		GetRequests:     1,
+		HeadRequests:    2,
+		ListRequests:    2,
+		DeleteRequests:  1,
+	}, be.Usage())
+}
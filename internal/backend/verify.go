@@ -0,0 +1,110 @@
+package backend
+
+import (
+	"bytes"
+	"hash"
+	"io"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// unlimitedReader is implemented by readers which apply a rate limit to an
+// underlying RewindReader, such as the ones passed to Save() by
+// limiter.LimitBackend.
+type unlimitedReader interface {
+	Unlimited() restic.RewindReader
+}
+
+// HashRewindReader computes the hash h over all data from rd and rewinds rd
+// afterwards, so that the data can be read again. The data is read from below
+// a rate limiter, so that hashing does not count towards the upload limit.
+func HashRewindReader(rd restic.RewindReader, h hash.Hash) ([]byte, error) {
+	if u, ok := rd.(unlimitedReader); ok {
+		rd = u.Unlimited()
+	}
+
+	if err := rd.Rewind(); err != nil {
+		return nil, err
+	}
+
+	if _, err := io.Copy(h, rd); err != nil {
+		return nil, errors.Wrap(err, "Copy")
+	}
+
+	if err := rd.Rewind(); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
+// CheckSum compares the hash sum computed locally to the one reported by the
+// service. It returns an error if they don't match.
+func CheckSum(name string, local, remote []byte) error {
+	if bytes.Equal(local, remote) {
+		return nil
+	}
+
+	return errors.Errorf("hash mismatch for %v: computed %x, service reported %x", name, local, remote)
+}
+
+// verifyReader hashes all data read from the underlying reader and compares
+// the sum to the expected value when EOF is reached.
+type verifyReader struct {
+	io.ReadCloser
+	name     string
+	h        hash.Hash
+	expected func() ([]byte, error)
+	err      error
+}
+
+// VerifyReadCloser returns a reader which computes the hash h over all data
+// read from rd. When rd reports EOF, the function expected is called to get
+// the hash sum the service reported for the file. If it returns nil, the data
+// is not verified. On a mismatch, an error is returned instead of EOF, so that
+// corruption during the transfer is detected and the operation can be retried.
+// When the data is not read completely, nothing is verified.
+func VerifyReadCloser(rd io.ReadCloser, name string, h hash.Hash, expected func() ([]byte, error)) io.ReadCloser {
+	return &verifyReader{
+		ReadCloser: rd,
+		name:       name,
+		h:          h,
+		expected:   expected,
+	}
+}
+
+func (vr *verifyReader) Read(p []byte) (int, error) {
+	if vr.err != nil {
+		return 0, vr.err
+	}
+
+	n, err := vr.ReadCloser.Read(p)
+	vr.h.Write(p[:n])
+
+	if err == io.EOF {
+		// verify returns io.EOF when the data is fine
+		vr.err = vr.verify()
+		return n, vr.err
+	}
+
+	return n, err
+}
+
+// verify compares the hash of all data read to the expected value.
+func (vr *verifyReader) verify() error {
+	want, err := vr.expected()
+	if err != nil {
+		return err
+	}
+
+	if want == nil {
+		return io.EOF
+	}
+
+	if err = CheckSum(vr.name, vr.h.Sum(nil), want); err != nil {
+		return err
+	}
+
+	return io.EOF
+}
@@ -0,0 +1,105 @@
+package backend_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"io/ioutil"
+	"testing"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestVerifyReadCloser(t *testing.T) {
+	data := rtest.Random(23, 500*KiB)
+	sum := md5.Sum(data)
+
+	var tests = []struct {
+		expected []byte
+		valid    bool
+	}{
+		{sum[:], true},
+		{nil, true},
+		{make([]byte, md5.Size), false},
+	}
+
+	for i, test := range tests {
+		rd := backend.VerifyReadCloser(ioutil.NopCloser(bytes.NewReader(data)), "test", md5.New(), func() ([]byte, error) {
+			return test.expected, nil
+		})
+
+		buf, err := ioutil.ReadAll(rd)
+		if test.valid && err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+
+		if !test.valid {
+			if err == nil {
+				t.Errorf("test %d: expected error not found", i)
+			}
+			continue
+		}
+
+		if !bytes.Equal(buf, data) {
+			t.Errorf("test %d: wrong data returned", i)
+		}
+	}
+}
+
+func TestHashRewindReader(t *testing.T) {
+	data := rtest.Random(42, 100*KiB)
+	rd := restic.NewByteReader(data)
+
+	sum, err := backend.HashRewindReader(rd, md5.New())
+	rtest.OK(t, err)
+
+	want := md5.Sum(data)
+	rtest.Equals(t, want[:], sum)
+
+	buf, err := ioutil.ReadAll(rd)
+	rtest.OK(t, err)
+
+	if !bytes.Equal(buf, data) {
+		t.Errorf("reader was not rewound")
+	}
+}
+
+// countingReader counts the bytes read through it, like a rate limiter.
+type countingReader struct {
+	restic.RewindReader
+	rd    *restic.ByteReader
+	count int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.RewindReader.Read(p)
+	c.count += n
+	return n, err
+}
+
+func (c *countingReader) Unlimited() restic.RewindReader {
+	return c.rd
+}
+
+func TestHashRewindReaderUnlimited(t *testing.T) {
+	data := rtest.Random(23, 100*KiB)
+	brd := restic.NewByteReader(data)
+	rd := &countingReader{RewindReader: brd, rd: brd}
+
+	sum, err := backend.HashRewindReader(rd, md5.New())
+	rtest.OK(t, err)
+
+	want := md5.Sum(data)
+	rtest.Equals(t, want[:], sum)
+	rtest.Equals(t, 0, rd.count)
+
+	buf, err := ioutil.ReadAll(rd)
+	rtest.OK(t, err)
+	rtest.Equals(t, len(data), rd.count)
+
+	if !bytes.Equal(buf, data) {
+		t.Errorf("reader was not rewound")
+	}
+}
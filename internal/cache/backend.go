@@ -43,6 +43,24 @@ func (b *Backend) Remove(ctx context.Context, h restic.Handle) error {
 	return b.Cache.Remove(h)
 }
 
+// Rename moves a file to another handle in the backend and removes it from
+// the cache. If the backend does not implement restic.Renamer,
+// restic.ErrRenameUnsupported is returned.
+func (b *Backend) Rename(ctx context.Context, from, to restic.Handle) error {
+	r, ok := b.Backend.(restic.Renamer)
+	if !ok {
+		return restic.ErrRenameUnsupported
+	}
+
+	debug.Log("cache Rename(%v, %v)", from, to)
+	err := r.Rename(ctx, from, to)
+	if err != nil {
+		return err
+	}
+
+	return b.Cache.Remove(from)
+}
+
 var autoCacheTypes = map[restic.FileType]struct{}{
 	restic.IndexFile:    struct{}{},
 	restic.SnapshotFile: struct{}{},
@@ -230,6 +248,60 @@ func (b *Backend) Stat(ctx context.Context, h restic.Handle) (restic.FileInfo, e
 	return fi, err
 }
 
+// List runs fn for each file of type t in the backend. For some file types,
+// the result is stored in the cache and reused as long as the backend reports
+// the same list version, so the backend does not need to be queried again.
+// Only backends which implement restic.ListVersioner (local and sftp) are
+// cached. When the version changes, the complete list is fetched again.
+func (b *Backend) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
+	lv, ok := b.Backend.(restic.ListVersioner)
+	if !ok || !cachedListTypes[t] {
+		return b.Backend.List(ctx, t, fn)
+	}
+
+	version, err := lv.ListVersion(ctx, t)
+	if err != nil {
+		debug.Log("ListVersion(%v) returned error: %v", t, err)
+		version = ""
+	}
+
+	if version == "" {
+		_ = b.Cache.removeList(t)
+		return b.Backend.List(ctx, t, fn)
+	}
+
+	if files, ok := b.Cache.loadList(t, version); ok {
+		debug.Log("List(%v): using cached list with %d files", t, len(files))
+		for _, fi := range files {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			err := fn(fi)
+			if err != nil {
+				return err
+			}
+		}
+		return ctx.Err()
+	}
+
+	var files []restic.FileInfo
+	err = b.Backend.List(ctx, t, func(fi restic.FileInfo) error {
+		files = append(files, fi)
+		return fn(fi)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = b.Cache.saveList(t, version, files)
+	if err != nil {
+		debug.Log("unable to save list for %v in the cache: %v", t, err)
+	}
+
+	return nil
+}
+
 // IsNotExist returns true if the error is caused by a non-existing file.
 func (b *Backend) IsNotExist(err error) bool {
 	return b.Backend.IsNotExist(err)
@@ -112,3 +112,75 @@ func TestBackend(t *testing.T) {
 		t.Errorf("removed file still in cache after stat")
 	}
 }
+
+// listVersionBackend reports a fixed version for all lists.
+type listVersionBackend struct {
+	restic.Backend
+	version string
+}
+
+func (be *listVersionBackend) ListVersion(ctx context.Context, t restic.FileType) (string, error) {
+	return be.version, nil
+}
+
+func listNames(t testing.TB, be restic.Backend, tpe restic.FileType) restic.IDSet {
+	ids := restic.NewIDSet()
+	err := be.List(context.TODO(), tpe, func(fi restic.FileInfo) error {
+		id, err := restic.ParseID(fi.Name)
+		if err != nil {
+			return err
+		}
+		ids.Insert(id)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func TestBackendListCache(t *testing.T) {
+	be := &listVersionBackend{Backend: mem.New(), version: "1"}
+
+	c, cleanup := TestNewCache(t)
+	defer cleanup()
+
+	wbe := c.Wrap(be)
+
+	h1, data := randomData(1024)
+	h1.Type = restic.SnapshotFile
+	save(t, be, h1, data)
+
+	ids := listNames(t, wbe, restic.SnapshotFile)
+	if len(ids) != 1 {
+		t.Fatalf("wrong number of files listed, want 1, got %d", len(ids))
+	}
+
+	// add a file without changing the version, the cached list is used
+	h2, data := randomData(1024)
+	h2.Type = restic.SnapshotFile
+	save(t, be, h2, data)
+
+	ids = listNames(t, wbe, restic.SnapshotFile)
+	if len(ids) != 1 {
+		t.Fatalf("cached list was not used, want 1 file, got %d", len(ids))
+	}
+
+	// with a new version, the backend is listed again
+	be.version = "2"
+	ids = listNames(t, wbe, restic.SnapshotFile)
+	if len(ids) != 2 {
+		t.Fatalf("wrong number of files listed, want 2, got %d", len(ids))
+	}
+
+	// an empty version disables the cache
+	be.version = ""
+	h3, data := randomData(1024)
+	h3.Type = restic.SnapshotFile
+	save(t, be, h3, data)
+
+	ids = listNames(t, wbe, restic.SnapshotFile)
+	if len(ids) != 3 {
+		t.Fatalf("wrong number of files listed, want 3, got %d", len(ids))
+	}
+}
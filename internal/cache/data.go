@@ -0,0 +1,383 @@
+package cache
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// DataCache stores complete data packs on the local disk, so that restoring
+// the same snapshots again does not download them from the backend. The size
+// of the cache is limited, the packs which have not been used for the longest
+// time are removed first. The time a pack was last used is stored as the
+// modification time of the file, so it is kept across runs.
+type DataCache struct {
+	dir     string
+	maxSize int64
+
+	m     sync.Mutex
+	files map[restic.ID]*dataCacheFile
+	size  int64
+
+	// inProgress contains a channel for each pack which is currently
+	// downloaded, it is closed when the download is finished.
+	inProgress map[restic.ID]chan struct{}
+
+	hits, misses int
+	lastUse      time.Time
+}
+
+type dataCacheFile struct {
+	size int64
+	used time.Time
+}
+
+// NewDataCache returns a data cache in dir which holds at most maxSize bytes.
+// Packs which are already stored in dir are used.
+func NewDataCache(dir string, maxSize int64) (*DataCache, error) {
+	if maxSize <= 0 {
+		return nil, errors.New("the size of the data cache must be positive")
+	}
+
+	if err := writeCachedirTag(dir); err != nil {
+		return nil, err
+	}
+
+	c := &DataCache{
+		dir:        dir,
+		maxSize:    maxSize,
+		files:      make(map[restic.ID]*dataCacheFile),
+		inProgress: make(map[restic.ID]chan struct{}),
+	}
+
+	err := filepath.Walk(dir, func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return errors.Wrap(err, "Walk")
+		}
+
+		if !isFile(fi) {
+			return nil
+		}
+
+		// remove leftovers of interrupted downloads
+		if strings.HasSuffix(name, ".tmp") {
+			return fs.Remove(name)
+		}
+
+		id, err := restic.ParseID(filepath.Base(name))
+		if err != nil {
+			return nil
+		}
+
+		c.files[id] = &dataCacheFile{size: fi.Size(), used: fi.ModTime()}
+		c.size += fi.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	debug.Log("data cache at %v contains %d packs, %d bytes", dir, len(c.files), c.size)
+
+	c.m.Lock()
+	c.evict(0)
+	c.m.Unlock()
+
+	return c, nil
+}
+
+func (c *DataCache) filename(id restic.ID) string {
+	name := id.String()
+	return filepath.Join(c.dir, name[:2], name)
+}
+
+// now returns the current time, but always later than the previous call, so
+// that the order in which packs are used is kept with a coarse clock. The
+// lock must be held by the caller.
+func (c *DataCache) now() time.Time {
+	t := time.Now()
+	if !t.After(c.lastUse) {
+		t = c.lastUse.Add(time.Nanosecond)
+	}
+	c.lastUse = t
+	return t
+}
+
+// Stats returns the number of loads which have been served from the cache
+// and the number of packs which have been downloaded.
+func (c *DataCache) Stats() (hits, misses int) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.hits, c.misses
+}
+
+// evict removes the least recently used packs until at least space bytes are
+// free. The lock must be held by the caller.
+func (c *DataCache) evict(space int64) {
+	if c.size+space <= c.maxSize {
+		return
+	}
+
+	ids := make(restic.IDs, 0, len(c.files))
+	for id := range c.files {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return c.files[ids[i]].used.Before(c.files[ids[j]].used)
+	})
+
+	for _, id := range ids {
+		if c.size+space <= c.maxSize {
+			return
+		}
+
+		debug.Log("remove pack %v from the data cache", id.Str())
+		err := fs.Remove(c.filename(id))
+		if err != nil && !os.IsNotExist(errors.Cause(err)) {
+			debug.Log("unable to remove %v: %v", id.Str(), err)
+		}
+
+		c.size -= c.files[id].size
+		delete(c.files, id)
+	}
+}
+
+// open returns the cached file for id and marks it as used, or nil if the
+// pack is not cached.
+func (c *DataCache) open(id restic.ID) fs.File {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	entry, ok := c.files[id]
+	if !ok {
+		return nil
+	}
+
+	f, err := fs.Open(c.filename(id))
+	if err != nil {
+		debug.Log("unable to open cached pack %v: %v", id.Str(), err)
+		c.size -= entry.size
+		delete(c.files, id)
+		return nil
+	}
+
+	entry.used = c.now()
+	_ = fs.Chtimes(c.filename(id), entry.used, entry.used)
+	c.hits++
+
+	return f
+}
+
+// fetch downloads the pack id from be and adds it to the cache. When the
+// pack is already being downloaded, fetch waits until that has finished.
+func (c *DataCache) fetch(ctx context.Context, be restic.Backend, h restic.Handle, id restic.ID) error {
+	c.m.Lock()
+	if _, ok := c.files[id]; ok {
+		c.m.Unlock()
+		return nil
+	}
+
+	if other, ok := c.inProgress[id]; ok {
+		c.m.Unlock()
+		debug.Log("pack %v is already downloaded by somebody else, waiting", id.Str())
+		<-other
+		return nil
+	}
+
+	finish := make(chan struct{})
+	c.inProgress[id] = finish
+	c.misses++
+	c.m.Unlock()
+
+	defer func() {
+		c.m.Lock()
+		delete(c.inProgress, id)
+		c.m.Unlock()
+		close(finish)
+	}()
+
+	filename := c.filename(id)
+	if err := fs.MkdirAll(filepath.Dir(filename), dirMode); err != nil {
+		return err
+	}
+
+	tmpfile := filename + ".tmp"
+	f, err := fs.OpenFile(tmpfile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fileMode)
+	if err != nil {
+		return errors.Wrap(err, "OpenFile")
+	}
+
+	var size int64
+	err = be.Load(ctx, h, 0, 0, func(rd io.Reader) error {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+
+		size, err = io.Copy(f, rd)
+		return err
+	})
+	if err == nil {
+		err = f.Close()
+	} else {
+		_ = f.Close()
+	}
+
+	if err == nil && size > c.maxSize {
+		err = errors.Errorf("pack %v is larger than the data cache", id.Str())
+	}
+
+	if err == nil {
+		err = fs.Rename(tmpfile, filename)
+	}
+
+	if err != nil {
+		_ = fs.Remove(tmpfile)
+		return err
+	}
+
+	c.m.Lock()
+	c.evict(size)
+	c.files[id] = &dataCacheFile{size: size, used: c.now()}
+	c.size += size
+	c.m.Unlock()
+
+	debug.Log("added pack %v (%d bytes) to the data cache", id.Str(), size)
+	return nil
+}
+
+// remove deletes the pack id from the cache.
+func (c *DataCache) remove(id restic.ID) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	entry, ok := c.files[id]
+	if !ok {
+		return
+	}
+
+	_ = fs.Remove(c.filename(id))
+	c.size -= entry.size
+	delete(c.files, id)
+}
+
+// Wrap returns a backend which loads data packs through the cache.
+func (c *DataCache) Wrap(be restic.Backend) restic.Backend {
+	return &dataCacheBackend{Backend: be, c: c}
+}
+
+// dataCacheBackend loads data packs from a DataCache.
+type dataCacheBackend struct {
+	restic.Backend
+	c *DataCache
+}
+
+var _ restic.Backend = &dataCacheBackend{}
+
+// loadCached passes the part of the cached pack id to consumer. It returns
+// false if the pack is not cached.
+func (b *dataCacheBackend) loadCached(id restic.ID, length int, offset int64, consumer func(rd io.Reader) error) (bool, error) {
+	f := b.c.open(id)
+	if f == nil {
+		return false, nil
+	}
+
+	if offset > 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			_ = f.Close()
+			return true, err
+		}
+	}
+
+	var rd io.Reader = f
+	if length > 0 {
+		rd = io.LimitReader(f, int64(length))
+	}
+
+	err := consumer(rd)
+	if err != nil {
+		_ = f.Close()
+		return true, err
+	}
+
+	return true, f.Close()
+}
+
+// Load loads data packs from the cache, downloading the complete pack first
+// when it is not cached yet. Other files are loaded from the backend.
+func (b *dataCacheBackend) Load(ctx context.Context, h restic.Handle, length int, offset int64, consumer func(rd io.Reader) error) error {
+	if h.Type != restic.DataFile {
+		return b.Backend.Load(ctx, h, length, offset, consumer)
+	}
+
+	id, err := restic.ParseID(h.Name)
+	if err != nil {
+		return b.Backend.Load(ctx, h, length, offset, consumer)
+	}
+
+	if ok, err := b.loadCached(id, length, offset, consumer); ok {
+		return err
+	}
+
+	err = b.c.fetch(ctx, b.Backend, h, id)
+	if err == nil {
+		if ok, err := b.loadCached(id, length, offset, consumer); ok {
+			return err
+		}
+	}
+
+	debug.Log("unable to load %v from the data cache (%v), delegating to backend", h, err)
+	return b.Backend.Load(ctx, h, length, offset, consumer)
+}
+
+// Remove deletes a file from the backend and the cache.
+func (b *dataCacheBackend) Remove(ctx context.Context, h restic.Handle) error {
+	err := b.Backend.Remove(ctx, h)
+	if err != nil {
+		return err
+	}
+
+	if h.Type == restic.DataFile {
+		if id, err := restic.ParseID(h.Name); err == nil {
+			b.c.remove(id)
+		}
+	}
+
+	return nil
+}
+
+// Rename moves a file to another handle in the backend and removes it from
+// the cache. If the backend does not implement restic.Renamer,
+// restic.ErrRenameUnsupported is returned.
+func (b *dataCacheBackend) Rename(ctx context.Context, from, to restic.Handle) error {
+	r, ok := b.Backend.(restic.Renamer)
+	if !ok {
+		return restic.ErrRenameUnsupported
+	}
+
+	err := r.Rename(ctx, from, to)
+	if err != nil {
+		return err
+	}
+
+	if from.Type == restic.DataFile {
+		if id, err := restic.ParseID(from.Name); err == nil {
+			b.c.remove(id)
+		}
+	}
+
+	return nil
+}
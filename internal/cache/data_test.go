@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/test"
+)
+
+// countingBackend counts the calls to Load.
+type countingBackend struct {
+	restic.Backend
+
+	m     sync.Mutex
+	loads int
+}
+
+func (be *countingBackend) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	be.m.Lock()
+	be.loads++
+	be.m.Unlock()
+
+	return be.Backend.Load(ctx, h, length, offset, fn)
+}
+
+func loadPart(t testing.TB, be restic.Backend, h restic.Handle, length int, offset int64) []byte {
+	var buf []byte
+	err := be.Load(context.TODO(), h, length, offset, func(rd io.Reader) (err error) {
+		buf, err = ioutil.ReadAll(rd)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+func TestDataCache(t *testing.T) {
+	dir, cleanup := test.TempDir(t)
+	defer cleanup()
+
+	be := &countingBackend{Backend: mem.New()}
+
+	var handles []restic.Handle
+	var packs [][]byte
+	for i := 0; i < 3; i++ {
+		data := test.Random(i, 1000)
+		h := restic.Handle{Type: restic.DataFile, Name: restic.Hash(data).String()}
+		save(t, be, h, data)
+		handles = append(handles, h)
+		packs = append(packs, data)
+	}
+
+	c, err := NewDataCache(dir, 2500)
+	test.OK(t, err)
+	wbe := c.Wrap(be)
+
+	// the complete pack is downloaded once, afterwards all parts are read
+	// from the cache
+	for i := 0; i < 3; i++ {
+		buf := loadPart(t, wbe, handles[0], 50, int64(100*i))
+		test.Assert(t, bytes.Equal(buf, packs[0][100*i:100*i+50]), "wrong data returned for part %d", i)
+	}
+	test.Equals(t, 1, be.loads)
+
+	loadPart(t, wbe, handles[1], 0, 0)
+	test.Equals(t, 2, be.loads)
+
+	// pack 0 has been used least recently and is removed for pack 2
+	loadPart(t, wbe, handles[2], 10, 0)
+	test.Equals(t, 3, be.loads)
+	test.Equals(t, int64(2000), c.size)
+	_, ok := c.files[restic.TestParseID(handles[0].Name)]
+	test.Assert(t, !ok, "pack 0 is still cached")
+
+	// now pack 2 is removed, not pack 1 which has been used before
+	loadPart(t, wbe, handles[1], 10, 0)
+	loadPart(t, wbe, handles[0], 10, 0)
+	test.Equals(t, 4, be.loads)
+	_, ok = c.files[restic.TestParseID(handles[2].Name)]
+	test.Assert(t, !ok, "pack 2 is still cached")
+
+	hits, misses := c.Stats()
+	test.Equals(t, 4, misses)
+	test.Equals(t, 7, hits)
+
+	// the packs are found again by a new cache
+	c, err = NewDataCache(dir, 2500)
+	test.OK(t, err)
+	test.Equals(t, 2, len(c.files))
+	test.Equals(t, int64(2000), c.size)
+
+	wbe = c.Wrap(be)
+	buf := loadPart(t, wbe, handles[1], 0, 0)
+	test.Assert(t, bytes.Equal(buf, packs[1]), "wrong data returned for pack 1")
+	test.Equals(t, 4, be.loads)
+
+	// removing a pack also removes it from the cache
+	remove(t, wbe, handles[1])
+	test.Equals(t, 1, len(c.files))
+	test.Equals(t, int64(1000), c.size)
+
+	// a smaller cache removes packs when it is opened
+	c, err = NewDataCache(dir, 500)
+	test.OK(t, err)
+	test.Equals(t, 0, len(c.files))
+}
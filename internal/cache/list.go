@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// cachedListTypes contains the file types for which the result of listing
+// the files in the backend is cached.
+var cachedListTypes = map[restic.FileType]bool{
+	restic.SnapshotFile: true,
+}
+
+// cachedList is the result of listing all files of a type in the backend,
+// together with the version the backend reported for the list.
+type cachedList struct {
+	Version string            `json:"version"`
+	Files   []restic.FileInfo `json:"files"`
+}
+
+func (c *Cache) listFilename(t restic.FileType) string {
+	return filepath.Join(c.Path, cacheLayoutPaths[t]+".list")
+}
+
+// loadList returns the cached list of files of type t. If no list is cached
+// or the cached list has a different version, false is returned.
+func (c *Cache) loadList(t restic.FileType, version string) ([]restic.FileInfo, bool) {
+	buf, err := ioutil.ReadFile(c.listFilename(t))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			debug.Log("unable to read cached list for %v: %v", t, err)
+		}
+		return nil, false
+	}
+
+	var list cachedList
+	err = json.Unmarshal(buf, &list)
+	if err != nil {
+		debug.Log("unable to decode cached list for %v: %v", t, err)
+		return nil, false
+	}
+
+	if list.Version != version {
+		debug.Log("cached list for %v is outdated (version %q, want %q)", t, list.Version, version)
+		return nil, false
+	}
+
+	return list.Files, true
+}
+
+// saveList stores the list of files of type t in the cache.
+func (c *Cache) saveList(t restic.FileType, version string, files []restic.FileInfo) error {
+	buf, err := json.Marshal(cachedList{Version: version, Files: files})
+	if err != nil {
+		return errors.Wrap(err, "Marshal")
+	}
+
+	filename := c.listFilename(t)
+	tmpfile := filename + ".tmp"
+
+	err = ioutil.WriteFile(tmpfile, buf, fileMode)
+	if err != nil {
+		return errors.Wrap(err, "WriteFile")
+	}
+
+	return fs.Rename(tmpfile, filename)
+}
+
+// removeList deletes the cached list of files of type t.
+func (c *Cache) removeList(t restic.FileType) error {
+	err := fs.Remove(c.listFilename(t))
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// statsDir is the directory within the cache which contains the stats
+// computed for snapshots.
+const statsDir = "stats"
+
+func (c *Cache) statsFilename(id restic.ID) string {
+	return filepath.Join(c.Path, statsDir, id.String())
+}
+
+// LoadStats returns the stats stored for the snapshot with the given id. If
+// none are cached, an error is returned for which IsNotExist returns true.
+func (c *Cache) LoadStats(id restic.ID) ([]byte, error) {
+	buf, err := ioutil.ReadFile(c.statsFilename(id))
+	if os.IsNotExist(err) {
+		return nil, errNoSuchFile{Type: statsDir, Name: id.String()}
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "ReadFile")
+	}
+
+	return buf, nil
+}
+
+// SaveStats stores the stats for the snapshot with the given id.
+func (c *Cache) SaveStats(id restic.ID, buf []byte) error {
+	if err := fs.MkdirAll(filepath.Join(c.Path, statsDir), dirMode); err != nil {
+		return err
+	}
+
+	filename := c.statsFilename(id)
+	tmpfile := filename + ".tmp"
+
+	err := ioutil.WriteFile(tmpfile, buf, fileMode)
+	if err != nil {
+		return errors.Wrap(err, "WriteFile")
+	}
+
+	return fs.Rename(tmpfile, filename)
+}
+
+// ClearStats removes the stats of all snapshots which are not contained in
+// the set valid.
+func (c *Cache) ClearStats(valid restic.IDSet) error {
+	debug.Log("Clearing stats: %v valid snapshots", len(valid))
+
+	entries, err := ioutil.ReadDir(filepath.Join(c.Path, statsDir))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "ReadDir")
+	}
+
+	for _, fi := range entries {
+		id, err := restic.ParseID(fi.Name())
+		if err == nil && valid.Has(id) {
+			continue
+		}
+
+		if err = fs.Remove(filepath.Join(c.Path, statsDir, fi.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -33,6 +33,15 @@ type Checker struct {
 	masterIndex *repository.MasterIndex
 
 	repo restic.Repository
+
+	// CheckMetadata enables additional checks for the trees: the nodes must
+	// be sorted by name and unique, and the size of a file must match the
+	// sum of the sizes of its blobs.
+	CheckMetadata bool
+
+	// OnPackVerified is called by ReadPacks for each pack which has been
+	// read without errors. It is called concurrently.
+	OnPackVerified func(id restic.ID)
 }
 
 // New returns a new checker which runs on repo.
@@ -200,21 +209,68 @@ func (c *Checker) Packs(ctx context.Context, errChan chan<- error) {
 		errChan <- err
 	}
 
+	c.comparePacks(ctx, repoPacks, false, errChan)
+}
+
+// PacksFromList works like Packs, but the packs stored in the repository are
+// taken from list instead of listing the backend, e.g. from an inventory
+// report of the storage service. Since the list may be outdated, packs which
+// are only found in the index or only in the list are looked up in the
+// backend before an error is reported. errChan is closed after all packs have
+// been checked.
+func (c *Checker) PacksFromList(ctx context.Context, list restic.IDSet, errChan chan<- error) {
+	defer close(errChan)
+
+	debug.Log("checking for %d packs against a list of %d packs", len(c.packs), len(list))
+	c.comparePacks(ctx, list, true, errChan)
+}
+
+// comparePacks reports the packs in repoPacks which are not referenced in
+// any index and the packs referenced in the index which are missing in
+// repoPacks. If lookup is set, the existence of such packs is checked in the
+// backend first.
+func (c *Checker) comparePacks(ctx context.Context, repoPacks restic.IDSet, lookup bool, errChan chan<- error) {
+	exists := func(id restic.ID) (bool, error) {
+		return c.repo.Backend().Test(ctx, restic.Handle{Type: restic.DataFile, Name: id.String()})
+	}
+
 	// orphaned: present in the repo but not in c.packs
 	for orphanID := range repoPacks.Sub(c.packs) {
+		err := PackError{ID: orphanID, Orphaned: true, Err: errors.New("not referenced in any index")}
+		if lookup {
+			found, testErr := exists(orphanID)
+			if testErr != nil {
+				err = PackError{ID: orphanID, Err: testErr}
+			} else if !found {
+				debug.Log("pack %v has been removed since the list was created", orphanID)
+				continue
+			}
+		}
+
 		select {
 		case <-ctx.Done():
 			return
-		case errChan <- PackError{ID: orphanID, Orphaned: true, Err: errors.New("not referenced in any index")}:
+		case errChan <- err:
 		}
 	}
 
 	// missing: present in c.packs but not in the repo
 	for missingID := range c.packs.Sub(repoPacks) {
+		err := PackError{ID: missingID, Err: errors.New("does not exist")}
+		if lookup {
+			found, testErr := exists(missingID)
+			if testErr != nil {
+				err = PackError{ID: missingID, Err: testErr}
+			} else if found {
+				debug.Log("pack %v has been added since the list was created", missingID)
+				continue
+			}
+		}
+
 		select {
 		case <-ctx.Done():
 			return
-		case errChan <- PackError{ID: missingID, Err: errors.New("does not exist")}:
+		case errChan <- err:
 		}
 	}
 }
@@ -241,25 +297,33 @@ func (e Error) Error() string {
 	return e.Err.Error()
 }
 
-func loadTreeFromSnapshot(ctx context.Context, repo restic.Repository, id restic.ID) (restic.ID, error) {
+func loadSnapshot(ctx context.Context, repo restic.Repository, id restic.ID) (*restic.Snapshot, error) {
 	sn, err := restic.LoadSnapshot(ctx, repo, id)
 	if err != nil {
 		debug.Log("error loading snapshot %v: %v", id, err)
-		return restic.ID{}, err
+		return nil, err
 	}
 
 	if sn.Tree == nil {
 		debug.Log("snapshot %v has no tree", id)
-		return restic.ID{}, errors.Errorf("snapshot %v has no tree", id)
+		return nil, errors.Errorf("snapshot %v has no tree", id)
 	}
 
-	return *sn.Tree, nil
+	return sn, nil
+}
+
+// canaryRef is the canary blob referenced by a snapshot.
+type canaryRef struct {
+	snapshot restic.ID
+	blob     restic.ID
 }
 
-// loadSnapshotTreeIDs loads all snapshots from backend and returns the tree IDs.
-func loadSnapshotTreeIDs(ctx context.Context, repo restic.Repository) (restic.IDs, []error) {
+// loadSnapshotTreeIDs loads all snapshots from backend and returns the tree IDs
+// and the canary blobs.
+func loadSnapshotTreeIDs(ctx context.Context, repo restic.Repository) (restic.IDs, []canaryRef, []error) {
 	var trees struct {
-		IDs restic.IDs
+		IDs      restic.IDs
+		canaries []canaryRef
 		sync.Mutex
 	}
 
@@ -276,7 +340,7 @@ func loadSnapshotTreeIDs(ctx context.Context, repo restic.Repository) (restic.ID
 
 		debug.Log("load snapshot %v", id)
 
-		treeID, err := loadTreeFromSnapshot(ctx, repo, id)
+		sn, err := loadSnapshot(ctx, repo, id)
 		if err != nil {
 			errs.Lock()
 			errs.errs = append(errs.errs, err)
@@ -284,9 +348,12 @@ func loadSnapshotTreeIDs(ctx context.Context, repo restic.Repository) (restic.ID
 			return nil
 		}
 
-		debug.Log("snapshot %v has tree %v", id, treeID)
+		debug.Log("snapshot %v has tree %v", id, sn.Tree)
 		trees.Lock()
-		trees.IDs = append(trees.IDs, treeID)
+		trees.IDs = append(trees.IDs, *sn.Tree)
+		if sn.Canary != nil {
+			trees.canaries = append(trees.canaries, canaryRef{snapshot: id, blob: sn.Canary.Blob})
+		}
 		trees.Unlock()
 
 		return nil
@@ -297,7 +364,7 @@ func loadSnapshotTreeIDs(ctx context.Context, repo restic.Repository) (restic.ID
 		errs.errs = append(errs.errs, err)
 	}
 
-	return trees.IDs, errs.errs
+	return trees.IDs, trees.canaries, errs.errs
 }
 
 // TreeError collects several errors that occurred while processing a tree.
@@ -516,9 +583,20 @@ func filterTrees(ctx context.Context, backlog restic.IDs, loaderChan chan<- rest
 func (c *Checker) Structure(ctx context.Context, errChan chan<- error) {
 	defer close(errChan)
 
-	trees, errs := loadSnapshotTreeIDs(ctx, c.repo)
+	trees, canaries, errs := loadSnapshotTreeIDs(ctx, c.repo)
 	debug.Log("need to check %d trees from snapshots, %d errs returned", len(trees), len(errs))
 
+	for _, ref := range canaries {
+		c.blobRefs.Lock()
+		c.blobRefs.M[ref.blob]++
+		c.blobRefs.Unlock()
+
+		if !c.blobs.Has(ref.blob) {
+			debug.Log("snapshot %v references canary blob %v which isn't contained in index", ref.snapshot, ref.blob)
+			errs = append(errs, errors.Errorf("snapshot %v: canary blob %v not found in index", ref.snapshot.Str(), ref.blob.Str()))
+		}
+	}
+
 	for _, err := range errs {
 		select {
 		case <-ctx.Done():
@@ -562,6 +640,16 @@ func (c *Checker) checkTree(id restic.ID, tree *restic.Tree) (errs []error) {
 				}
 				blobs = append(blobs, blobID)
 			}
+
+			for _, stream := range node.Streams {
+				for b, blobID := range stream.Content {
+					if blobID.IsNull() {
+						errs = append(errs, Error{TreeID: id, Err: errors.Errorf("file %q stream %q blob %d has null ID", node.Name, stream.Name, b)})
+						continue
+					}
+					blobs = append(blobs, blobID)
+				}
+			}
 		case "dir":
 			if node.Subtree == nil {
 				errs = append(errs, Error{TreeID: id, Err: errors.Errorf("dir node %q has no subtree", node.Name)})
@@ -585,6 +673,10 @@ func (c *Checker) checkTree(id restic.ID, tree *restic.Tree) (errs []error) {
 		}
 	}
 
+	if c.CheckMetadata {
+		errs = append(errs, c.checkTreeMetadata(id, tree)...)
+	}
+
 	for _, blobID := range blobs {
 		c.blobRefs.Lock()
 		c.blobRefs.M[blobID]++
@@ -601,6 +693,44 @@ func (c *Checker) checkTree(id restic.ID, tree *restic.Tree) (errs []error) {
 	return errs
 }
 
+// checkTreeMetadata verifies that the tree is canonical and that the sizes of
+// the files match their content.
+func (c *Checker) checkTreeMetadata(id restic.ID, tree *restic.Tree) (errs []error) {
+	for i, node := range tree.Nodes {
+		if i > 0 {
+			prev := tree.Nodes[i-1].Name
+			switch {
+			case prev == node.Name:
+				errs = append(errs, Error{TreeID: id, Err: errors.Errorf("duplicate node %q", node.Name)})
+			case prev > node.Name:
+				errs = append(errs, Error{TreeID: id, Err: errors.Errorf("nodes are not sorted, %q is stored after %q", node.Name, prev)})
+			}
+		}
+
+		if node.Type != "file" {
+			continue
+		}
+
+		size := uint64(len(node.Inline))
+		complete := true
+		for _, blobID := range node.Content {
+			blobSize, found := c.masterIndex.LookupSize(blobID, restic.DataBlob)
+			if !found {
+				// missing blobs are reported by checkTree
+				complete = false
+				break
+			}
+			size += uint64(blobSize)
+		}
+
+		if complete && size != node.Size {
+			errs = append(errs, Error{TreeID: id, Err: errors.Errorf("file %q: size is %d, but the content has %d bytes", node.Name, node.Size, size)})
+		}
+	}
+
+	return errs
+}
+
 // UnusedBlobs returns all blobs that have never been referenced.
 func (c *Checker) UnusedBlobs() (blobs restic.IDs) {
 	c.blobRefs.Lock()
@@ -649,7 +779,7 @@ func checkPack(ctx context.Context, r restic.Repository, id restic.ID) error {
 		return errors.Errorf("Pack ID does not match, want %v, got %v", id.Str(), hash.Str())
 	}
 
-	blobs, err := pack.List(r.Key(), packfile, size)
+	blobs, err := pack.List(r.Key(), packfile, size, r.Config().Compresses())
 	if err != nil {
 		return err
 	}
@@ -677,14 +807,21 @@ func checkPack(ctx context.Context, r restic.Repository, id restic.ID) error {
 			continue
 		}
 
-		nonce, ciphertext := buf[:r.Key().NonceSize()], buf[r.Key().NonceSize():]
-		plaintext, err := r.Key().Open(ciphertext[:0], nonce, ciphertext, nil)
+		cfg := r.Config()
+		plaintext, err := cfg.Open(r.Key(), buf, cfg.BlobAssociatedData(blob.Type, blob.ID), id)
 		if err != nil {
 			debug.Log("  error decrypting blob %v: %v", blob.ID, err)
 			errs = append(errs, errors.Errorf("blob %v: %v", i, err))
 			continue
 		}
 
+		plaintext, err = repository.DecompressBlob(blob, plaintext, nil)
+		if err != nil {
+			debug.Log("  error decompressing blob %v: %v", blob.ID, err)
+			errs = append(errs, errors.Errorf("blob %v: %v", i, err))
+			continue
+		}
+
 		hash := restic.Hash(plaintext)
 		if !hash.Equal(blob.ID) {
 			debug.Log("  Blob ID does not match, want %v, got %v", blob.ID, hash)
@@ -707,6 +844,12 @@ func (c *Checker) ReadData(ctx context.Context, p *restic.Progress, errChan chan
 
 // ReadPacks loads data from specified packs and checks the integrity.
 func (c *Checker) ReadPacks(ctx context.Context, packs restic.IDSet, p *restic.Progress, errChan chan<- error) {
+	c.ReadPackList(ctx, packs.List(), p, errChan)
+}
+
+// ReadPackList works like ReadPacks, but the packs are read in the given
+// order.
+func (c *Checker) ReadPackList(ctx context.Context, packs restic.IDs, p *restic.Progress, errChan chan<- error) {
 	defer close(errChan)
 
 	p.Start()
@@ -734,6 +877,9 @@ func (c *Checker) ReadPacks(ctx context.Context, packs restic.IDSet, p *restic.P
 				err := checkPack(ctx, c.repo, id)
 				p.Report(restic.Stat{Blobs: 1})
 				if err == nil {
+					if c.OnPackVerified != nil {
+						c.OnPackVerified(id)
+					}
 					continue
 				}
 
@@ -747,7 +893,7 @@ func (c *Checker) ReadPacks(ctx context.Context, packs restic.IDSet, p *restic.P
 	}
 
 	// push packs to ch
-	for pack := range packs {
+	for _, pack := range packs {
 		select {
 		case ch <- pack:
 		case <-ctx.Done():
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"sync"
 	"testing"
 	"time"
 
@@ -68,6 +69,7 @@ func TestCheckRepo(t *testing.T) {
 		t.Errorf("expected no hints, got %v: %v", len(hints), hints)
 	}
 
+	chkr.CheckMetadata = true
 	test.OKs(t, checkPacks(chkr))
 	test.OKs(t, checkStruct(chkr))
 }
@@ -142,6 +144,63 @@ func TestUnreferencedPack(t *testing.T) {
 	}
 }
 
+func TestPacksFromList(t *testing.T) {
+	repodir, cleanup := test.Env(t, checkerTestData)
+	defer cleanup()
+
+	repo := repository.TestOpenLocal(t, repodir)
+
+	list := restic.NewIDSet()
+	test.OK(t, repo.List(context.TODO(), restic.DataFile, func(id restic.ID, size int64) error {
+		list.Insert(id)
+		return nil
+	}))
+
+	// a pack removed after the list was created is missing
+	missing := restic.TestParseID("657f7fb64f6a854fff6fe9279998ee09034901eded4e6db9bcee0e59745bbce6")
+	test.OK(t, repo.Backend().Remove(context.TODO(), restic.Handle{Type: restic.DataFile, Name: missing.String()}))
+	list.Delete(missing)
+
+	// index 3f1a only references pack 60e0
+	orphaned := restic.TestParseID("60e0438dcb978ec6860cc1f8c43da648170ee9129af8f650f876bad19f8f788e")
+	indexHandle := restic.Handle{
+		Type: restic.IndexFile,
+		Name: "3f1abfcb79c6f7d0a3be517d2c83c8562fba64ef2c8e9a3544b4edaf8b5e3b44",
+	}
+	test.OK(t, repo.Backend().Remove(context.TODO(), indexHandle))
+
+	// packs which have been added or removed since the list was created
+	// are not reported
+	for id := range list {
+		if !id.Equal(orphaned) {
+			list.Delete(id)
+			break
+		}
+	}
+	list.Insert(restic.NewRandomID())
+
+	chkr := checker.New(repo)
+	_, errs := chkr.LoadIndex(context.TODO())
+	if len(errs) > 0 {
+		t.Fatalf("expected no errors, got %v: %v", len(errs), errs)
+	}
+
+	errs = collectErrors(context.TODO(), func(ctx context.Context, errChan chan<- error) {
+		chkr.PacksFromList(ctx, list, errChan)
+	})
+
+	found := restic.NewIDSet()
+	for _, err := range errs {
+		perr, ok := err.(checker.PackError)
+		if !ok {
+			t.Fatalf("unexpected error %v", err)
+		}
+		test.Equals(t, perr.ID.Equal(orphaned), perr.Orphaned)
+		found.Insert(perr.ID)
+	}
+	test.Equals(t, restic.NewIDSet(missing, orphaned), found)
+}
+
 func TestUnreferencedBlobs(t *testing.T) {
 	repodir, cleanup := test.Env(t, checkerTestData)
 	defer cleanup()
@@ -366,6 +425,96 @@ func TestCheckerModifiedData(t *testing.T) {
 	}
 }
 
+func TestCheckerPackVerified(t *testing.T) {
+	repodir, cleanup := test.Env(t, checkerTestData)
+	defer cleanup()
+
+	repo := repository.TestOpenLocal(t, repodir)
+
+	chkr := checker.New(repo)
+	_, errs := chkr.LoadIndex(context.TODO())
+	test.OKs(t, errs)
+
+	var m sync.Mutex
+	verified := restic.NewIDSet()
+	chkr.OnPackVerified = func(id restic.ID) {
+		m.Lock()
+		verified.Insert(id)
+		m.Unlock()
+	}
+
+	test.OKs(t, checkData(chkr))
+	test.Equals(t, chkr.GetPacks(), verified)
+}
+
+func TestCheckerMetadata(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	ctx := context.TODO()
+	data := test.Random(23, 1000)
+	blobID, err := repo.SaveBlob(ctx, restic.DataBlob, data, restic.ID{})
+	test.OK(t, err)
+
+	tree := &restic.Tree{Nodes: []*restic.Node{
+		{Name: "b", Type: "file", Size: 1000, Content: restic.IDs{blobID}},
+		{Name: "a", Type: "file", Size: 1000, Content: restic.IDs{blobID}},
+		{Name: "c", Type: "file", Size: 500, Content: restic.IDs{blobID}},
+		{Name: "c", Type: "file", Size: 2000, Content: restic.IDs{blobID, blobID}},
+	}}
+	treeID, err := repo.SaveTree(ctx, tree)
+	test.OK(t, err)
+
+	sn, err := restic.NewSnapshot([]string{"/"}, nil, "localhost", time.Now())
+	test.OK(t, err)
+	sn.Tree = &treeID
+	_, err = repo.SaveJSONUnpacked(ctx, restic.SnapshotFile, sn)
+	test.OK(t, err)
+
+	test.OK(t, repo.Flush(ctx))
+	test.OK(t, repo.SaveIndex(ctx))
+
+	// without the additional checks, the tree is fine
+	chkr := loadChecker(t, repo)
+	test.OKs(t, checkStruct(chkr))
+
+	chkr = loadChecker(t, repo)
+	chkr.CheckMetadata = true
+	errs := checkStruct(chkr)
+	if len(errs) != 1 {
+		t.Fatalf("expected one error, got %v", errs)
+	}
+
+	treeErr, ok := errs[0].(checker.TreeError)
+	if !ok {
+		t.Fatalf("expected a TreeError, got %T: %v", errs[0], errs[0])
+	}
+
+	for _, err := range treeErr.Errors {
+		t.Logf("tree error: %v", err)
+	}
+
+	// "a" is stored after "b", "c" is duplicate and the size of the first
+	// "c" does not match
+	if len(treeErr.Errors) != 3 {
+		t.Fatalf("expected three errors for the tree, got %v", treeErr.Errors)
+	}
+}
+
+func loadChecker(t testing.TB, repo restic.Repository) *checker.Checker {
+	chkr := checker.New(repo)
+	hints, errs := chkr.LoadIndex(context.TODO())
+	if len(errs) > 0 {
+		t.Fatalf("expected no errors, got %v: %v", len(errs), errs)
+	}
+
+	if len(hints) > 0 {
+		t.Errorf("expected no hints, got %v: %v", len(hints), hints)
+	}
+
+	return chkr
+}
+
 func BenchmarkChecker(t *testing.B) {
 	repodir, cleanup := test.Env(t, checkerTestData)
 	defer cleanup()
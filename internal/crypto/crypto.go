@@ -3,7 +3,9 @@ package crypto
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 
@@ -36,6 +38,10 @@ var (
 type Key struct {
 	MACKey        `json:"mac"`
 	EncryptionKey `json:"encrypt"`
+
+	// authOnly is set for keys which only authenticate data, the data is
+	// stored in plaintext.
+	authOnly bool
 }
 
 // EncryptionKey is key used for encryption
@@ -124,6 +130,69 @@ func poly1305Verify(msg []byte, nonce []byte, key *MACKey, mac []byte) bool {
 	return poly1305.Verify(&m, msg, &k)
 }
 
+// additionalDataLabel is used to derive the MAC key for data with additional
+// data from the MAC key.
+const additionalDataLabel = "restic/mac/additional-data"
+
+// additionalDataMACKey returns the MAC key for data with additional data. It
+// is derived from the MAC key, so a MAC computed with additional data is never
+// valid for any data without additional data, and vice versa.
+func (k *Key) additionalDataMACKey() MACKey {
+	// use the masked key, so the result does not depend on whether the MAC
+	// key has been used before
+	r := k.MACKey.R
+	for i := range r {
+		r[i] &= poly1305KeyMask[i]
+	}
+
+	mac := hmac.New(sha256.New, append(k.MACKey.K[:], r[:]...))
+	_, _ = mac.Write([]byte(additionalDataLabel))
+
+	var mk MACKey
+	macKeyFromSlice(&mk, mac.Sum(nil))
+	return mk
+}
+
+// authenticate computes the MAC for buf[:n]. If additionalData is not empty,
+// the MAC covers the ciphertext followed by the first macSize bytes of the
+// SHA-256 hash of the additional data, which are written to buf[n:] for this,
+// and is computed with the key returned by additionalDataMACKey. Without
+// additional data, the MAC is the same as for older versions, which did not
+// support additional data at all.
+func (k *Key) authenticate(buf []byte, n int, nonce, additionalData []byte) []byte {
+	if len(additionalData) == 0 {
+		return poly1305MAC(buf[:n], nonce, &k.MACKey)
+	}
+
+	mk := k.additionalDataMACKey()
+	h := sha256.Sum256(additionalData)
+	copy(buf[n:n+macSize], h[:])
+	return poly1305MAC(buf[:n+macSize], nonce, &mk)
+}
+
+// verify checks the MAC at the end of ciphertext, see authenticate. The MAC
+// is overwritten temporarily to authenticate the additional data, and
+// restored before verify returns.
+func (k *Key) verify(ciphertext, nonce, additionalData []byte) bool {
+	l := len(ciphertext) - macSize
+	ct := ciphertext[:l]
+
+	var mac [macSize]byte
+	copy(mac[:], ciphertext[l:])
+
+	if len(additionalData) == 0 {
+		return poly1305Verify(ct, nonce, &k.MACKey, mac[:])
+	}
+
+	mk := k.additionalDataMACKey()
+	h := sha256.Sum256(additionalData)
+	copy(ciphertext[l:], h[:])
+	ok := poly1305Verify(ciphertext, nonce, &mk, mac[:])
+	copy(ciphertext[l:], mac[:])
+
+	return ok
+}
+
 // NewRandomKey returns new encryption and message authentication keys.
 func NewRandomKey() *Key {
 	k := &Key{}
@@ -147,6 +216,20 @@ func NewRandomKey() *Key {
 	return k
 }
 
+// WithoutEncryption returns a copy of k which only authenticates data and
+// stores it in plaintext. The format (nonce, data, MAC) is the same as for
+// encrypted data, so only the AES-CTR encryption is skipped.
+func (k *Key) WithoutEncryption() *Key {
+	nk := *k
+	nk.authOnly = true
+	return &nk
+}
+
+// Encrypts returns false if k only authenticates data.
+func (k *Key) Encrypts() bool {
+	return !k.authOnly
+}
+
 // NewRandomNonce returns a new random nonce. It panics on error so that the
 // program is safely terminated.
 func NewRandomNonce() []byte {
@@ -288,10 +371,6 @@ func (k *Key) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
 		panic("key is invalid")
 	}
 
-	if len(additionalData) > 0 {
-		panic("additional data is not supported")
-	}
-
 	if len(nonce) != ivSize {
 		panic("incorrect nonce length")
 	}
@@ -302,6 +381,13 @@ func (k *Key) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
 
 	ret, out := sliceForAppend(dst, len(plaintext)+k.Overhead())
 
+	if k.authOnly {
+		copy(out, plaintext)
+		mac := k.authenticate(out, len(plaintext), nonce, additionalData)
+		copy(out[len(plaintext):], mac)
+		return ret
+	}
+
 	c, err := aes.NewCipher(k.EncryptionKey[:])
 	if err != nil {
 		panic(fmt.Sprintf("unable to create cipher: %v", err))
@@ -309,7 +395,7 @@ func (k *Key) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
 	e := cipher.NewCTR(c, nonce)
 	e.XORKeyStream(out, plaintext)
 
-	mac := poly1305MAC(out[:len(plaintext)], nonce, &k.MACKey)
+	mac := k.authenticate(out, len(plaintext), nonce, additionalData)
 	copy(out[len(plaintext):], mac)
 
 	return ret
@@ -325,7 +411,9 @@ func (k *Key) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
 // ciphertext's storage for the decrypted output, use ciphertext[:0] as dst.
 //
 // Even if the function fails, the contents of dst, up to its capacity,
-// may be overwritten.
+// may be overwritten. When additional data is given, the MAC at the end of
+// ciphertext is modified while it is verified, so ciphertext must not be
+// accessed concurrently.
 func (k *Key) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
 	if !k.Valid() {
 		return nil, errors.New("invalid key")
@@ -345,16 +433,20 @@ func (k *Key) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error
 		return nil, errors.Errorf("trying to decrypt invalid data: ciphertext too small")
 	}
 
-	l := len(ciphertext) - macSize
-	ct, mac := ciphertext[:l], ciphertext[l:]
-
 	// verify mac
-	if !poly1305Verify(ct, nonce, &k.MACKey, mac) {
+	if !k.verify(ciphertext, nonce, additionalData) {
 		return nil, ErrUnauthenticated
 	}
 
+	ct := ciphertext[:len(ciphertext)-macSize]
+
 	ret, out := sliceForAppend(dst, len(ct))
 
+	if k.authOnly {
+		copy(out, ct)
+		return ret, nil
+	}
+
 	c, err := aes.NewCipher(k.EncryptionKey[:])
 	if err != nil {
 		panic(fmt.Sprintf("unable to create cipher: %v", err))
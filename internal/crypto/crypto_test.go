@@ -3,6 +3,7 @@ package crypto_test
 import (
 	"bytes"
 	"crypto/rand"
+	"crypto/sha256"
 	"io"
 	"testing"
 
@@ -43,6 +44,61 @@ func TestEncryptDecrypt(t *testing.T) {
 	}
 }
 
+func TestWithoutEncryption(t *testing.T) {
+	k := crypto.NewRandomKey()
+	auth := k.WithoutEncryption()
+	rtest.Assert(t, k.Encrypts(), "original key does not encrypt")
+	rtest.Assert(t, !auth.Encrypts(), "key without encryption encrypts")
+
+	data := rtest.Random(23, 1<<16)
+	nonce := crypto.NewRandomNonce()
+	ciphertext := auth.Seal(nil, nonce, data, nil)
+	rtest.Equals(t, len(data)+crypto.Extension-len(nonce), len(ciphertext))
+	rtest.Equals(t, data, ciphertext[:len(data)])
+
+	plaintext, err := auth.Open(nil, nonce, ciphertext, nil)
+	rtest.OK(t, err)
+	rtest.Equals(t, data, plaintext)
+
+	// the data is still authenticated
+	ciphertext[42] ^= 0x01
+	_, err = auth.Open(nil, nonce, ciphertext, nil)
+	rtest.Assert(t, err == crypto.ErrUnauthenticated, "modified data was not detected, err %v", err)
+}
+
+func TestAdditionalData(t *testing.T) {
+	for _, k := range []*crypto.Key{crypto.NewRandomKey(), crypto.NewRandomKey().WithoutEncryption()} {
+		data := rtest.Random(42, 1<<16)
+		nonce := crypto.NewRandomNonce()
+		ciphertext := k.Seal(nil, nonce, data, []byte("foo"))
+		rtest.Equals(t, len(data)+crypto.Extension-len(nonce), len(ciphertext))
+		orig := append([]byte{}, ciphertext...)
+
+		for _, ad := range [][]byte{nil, []byte("bar")} {
+			_, err := k.Open(nil, nonce, ciphertext, ad)
+			rtest.Assert(t, err == crypto.ErrUnauthenticated, "wrong additional data %q was not detected, err %v", ad, err)
+			rtest.Equals(t, orig, ciphertext)
+		}
+
+		plaintext, err := k.Open(nil, nonce, ciphertext, []byte("foo"))
+		rtest.OK(t, err)
+		rtest.Equals(t, data, plaintext)
+
+		// appending the hash of the additional data to the ciphertext does
+		// not yield valid data without additional data
+		h := sha256.Sum256([]byte("foo"))
+		l := len(ciphertext) - 16
+		forged := append(append(append([]byte{}, ciphertext[:l]...), h[:16]...), ciphertext[l:]...)
+		_, err = k.Open(nil, nonce, forged, nil)
+		rtest.Assert(t, err == crypto.ErrUnauthenticated, "data with additional data was accepted without, err %v", err)
+
+		// data without additional data is not accepted with additional data
+		ciphertext = k.Seal(nil, nonce, data, nil)
+		_, err = k.Open(nil, nonce, ciphertext, []byte("foo"))
+		rtest.Assert(t, err == crypto.ErrUnauthenticated, "missing additional data was not detected, err %v", err)
+	}
+}
+
 func TestSmallBuffer(t *testing.T) {
 	k := crypto.NewRandomKey()
 
@@ -0,0 +1,199 @@
+package fs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// ACL is a POSIX access control list of a file or directory, as shown by
+// getfacl. Default is only used for directories, it is the ACL new files in
+// the directory inherit.
+type ACL struct {
+	Access  []ACLEntry `json:"access,omitempty"`
+	Default []ACLEntry `json:"default,omitempty"`
+}
+
+// ACLEntry is an entry of an ACL. Users and groups are identified by their
+// numeric ID, so the entry is restored with the same IDs as the owner of the
+// file.
+type ACLEntry struct {
+	Tag  ACLTag
+	ID   uint32
+	Perm uint16
+}
+
+// ACLTag is the type of an ACL entry.
+type ACLTag uint16
+
+// The tags of ACL entries, with the values used by Linux.
+const (
+	ACLUserObj  ACLTag = 0x01
+	ACLUser     ACLTag = 0x02
+	ACLGroupObj ACLTag = 0x04
+	ACLGroup    ACLTag = 0x08
+	ACLMask     ACLTag = 0x10
+	ACLOther    ACLTag = 0x20
+)
+
+var aclTagNames = map[ACLTag]string{
+	ACLUserObj:  "user",
+	ACLUser:     "user",
+	ACLGroupObj: "group",
+	ACLGroup:    "group",
+	ACLMask:     "mask",
+	ACLOther:    "other",
+}
+
+// named returns true if entries with tag refer to a user or group by ID.
+func (t ACLTag) named() bool {
+	return t == ACLUser || t == ACLGroup
+}
+
+// String returns the entry in the format of getfacl with numeric IDs, e.g.
+// "user:1000:rw-" or "mask::r-x".
+func (e ACLEntry) String() string {
+	id := ""
+	if e.Tag.named() {
+		id = strconv.FormatUint(uint64(e.ID), 10)
+	}
+
+	perm := []byte("---")
+	if e.Perm&4 != 0 {
+		perm[0] = 'r'
+	}
+	if e.Perm&2 != 0 {
+		perm[1] = 'w'
+	}
+	if e.Perm&1 != 0 {
+		perm[2] = 'x'
+	}
+
+	return fmt.Sprintf("%s:%s:%s", aclTagNames[e.Tag], id, perm)
+}
+
+// MarshalText returns the entry in the format of String.
+func (e ACLEntry) MarshalText() ([]byte, error) {
+	if _, ok := aclTagNames[e.Tag]; !ok {
+		return nil, errors.Errorf("invalid ACL tag %#x", uint16(e.Tag))
+	}
+	return []byte(e.String()), nil
+}
+
+// UnmarshalText parses an entry in the format of String.
+func (e *ACLEntry) UnmarshalText(text []byte) error {
+	parts := strings.Split(string(text), ":")
+	if len(parts) != 3 || len(parts[2]) != 3 {
+		return errors.Errorf("invalid ACL entry %q", text)
+	}
+
+	var entry ACLEntry
+	named := parts[1] != ""
+	switch {
+	case parts[0] == "user" && named:
+		entry.Tag = ACLUser
+	case parts[0] == "user":
+		entry.Tag = ACLUserObj
+	case parts[0] == "group" && named:
+		entry.Tag = ACLGroup
+	case parts[0] == "group":
+		entry.Tag = ACLGroupObj
+	case parts[0] == "mask" && !named:
+		entry.Tag = ACLMask
+	case parts[0] == "other" && !named:
+		entry.Tag = ACLOther
+	default:
+		return errors.Errorf("invalid ACL entry %q", text)
+	}
+
+	if named {
+		id, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil {
+			return errors.Errorf("invalid ID in ACL entry %q", text)
+		}
+		entry.ID = uint32(id)
+	}
+
+	for i, c := range parts[2] {
+		switch {
+		case c == rune("rwx"[i]):
+			entry.Perm |= 4 >> uint(i)
+		case c != '-':
+			return errors.Errorf("invalid permissions in ACL entry %q", text)
+		}
+	}
+
+	*e = entry
+	return nil
+}
+
+const (
+	// aclXattrVersion is the version of the format Linux uses to store ACLs
+	// in extended attributes.
+	aclXattrVersion = 2
+	// aclUndefinedID is stored for entries which do not refer to a user or
+	// group.
+	aclUndefinedID = 0xffffffff
+
+	aclXattrAccess  = "system.posix_acl_access"
+	aclXattrDefault = "system.posix_acl_default"
+)
+
+// IsACLAttribute returns true if the extended attribute name is used by Linux
+// to store an ACL, it is saved as part of the ACL instead.
+func IsACLAttribute(name string) bool {
+	return name == aclXattrAccess || name == aclXattrDefault
+}
+
+// decodeACLXattr parses an ACL in the format stored by Linux in extended
+// attributes: a little-endian version number followed by entries of tag,
+// permissions and ID.
+func decodeACLXattr(buf []byte) ([]ACLEntry, error) {
+	if len(buf) < 4 || (len(buf)-4)%8 != 0 {
+		return nil, errors.Errorf("invalid ACL of %d bytes", len(buf))
+	}
+
+	if v := binary.LittleEndian.Uint32(buf); v != aclXattrVersion {
+		return nil, errors.Errorf("unsupported ACL version %d", v)
+	}
+
+	entries := make([]ACLEntry, 0, (len(buf)-4)/8)
+	for p := buf[4:]; len(p) > 0; p = p[8:] {
+		e := ACLEntry{
+			Tag:  ACLTag(binary.LittleEndian.Uint16(p)),
+			Perm: binary.LittleEndian.Uint16(p[2:]),
+		}
+		if e.Tag.named() {
+			e.ID = binary.LittleEndian.Uint32(p[4:])
+		}
+		if _, ok := aclTagNames[e.Tag]; !ok {
+			return nil, errors.Errorf("invalid ACL tag %#x", uint16(e.Tag))
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// encodeACLXattr returns entries in the format of decodeACLXattr.
+func encodeACLXattr(entries []ACLEntry) []byte {
+	buf := make([]byte, 4+8*len(entries))
+	binary.LittleEndian.PutUint32(buf, aclXattrVersion)
+
+	p := buf[4:]
+	for _, e := range entries {
+		id := uint32(aclUndefinedID)
+		if e.Tag.named() {
+			id = e.ID
+		}
+		binary.LittleEndian.PutUint16(p, uint16(e.Tag))
+		binary.LittleEndian.PutUint16(p[2:], e.Perm)
+		binary.LittleEndian.PutUint32(p[4:], id)
+		p = p[8:]
+	}
+
+	return buf
+}
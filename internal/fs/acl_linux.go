@@ -0,0 +1,64 @@
+package fs
+
+import (
+	"syscall"
+
+	"github.com/pkg/xattr"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// GetACL returns the ACL of the file or directory at path, or nil if it has
+// none besides the permissions in its mode.
+func GetACL(path string) (*ACL, error) {
+	access, err := getACLXattr(path, aclXattrAccess)
+	if err != nil {
+		return nil, err
+	}
+
+	def, err := getACLXattr(path, aclXattrDefault)
+	if err != nil {
+		return nil, err
+	}
+
+	if access == nil && def == nil {
+		return nil, nil
+	}
+
+	return &ACL{Access: access, Default: def}, nil
+}
+
+func getACLXattr(path, name string) ([]ACLEntry, error) {
+	buf, err := xattr.Get(path, name)
+	if e, ok := err.(*xattr.Error); ok && (e.Err == syscall.ENODATA || e.Err == syscall.ENOTSUP) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "GetACL")
+	}
+
+	entries, err := decodeACLXattr(buf)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ACL %v of %v", name, path)
+	}
+	return entries, nil
+}
+
+// SetACL sets the ACL of the file or directory at path.
+func SetACL(path string, acl *ACL) error {
+	if len(acl.Access) > 0 {
+		err := xattr.Set(path, aclXattrAccess, encodeACLXattr(acl.Access))
+		if err != nil {
+			return errors.Wrap(err, "SetACL")
+		}
+	}
+
+	if len(acl.Default) > 0 {
+		err := xattr.Set(path, aclXattrDefault, encodeACLXattr(acl.Default))
+		if err != nil {
+			return errors.Wrap(err, "SetACL")
+		}
+	}
+
+	return nil
+}
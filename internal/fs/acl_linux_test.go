@@ -0,0 +1,54 @@
+package fs
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGetSetACL(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "restic-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer RemoveAll(tempdir)
+
+	filename := filepath.Join(tempdir, "file")
+	if err = ioutil.WriteFile(filename, nil, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	acl, err := GetACL(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acl != nil {
+		t.Fatalf("new file has an ACL: %v", acl)
+	}
+
+	want := &ACL{
+		Access: []ACLEntry{
+			{Tag: ACLUserObj, Perm: 6},
+			{Tag: ACLUser, ID: 4711, Perm: 6},
+			{Tag: ACLGroupObj, Perm: 4},
+			{Tag: ACLMask, Perm: 6},
+			{Tag: ACLOther, Perm: 0},
+		},
+	}
+
+	if err = SetACL(filename, want); err != nil {
+		t.Skipf("unable to set ACL: %v", err)
+	}
+
+	acl, err = GetACL(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acl == nil {
+		t.Skip("ACLs are not supported in the temporary directory")
+	}
+	if !reflect.DeepEqual(want, acl) {
+		t.Fatalf("wrong ACL, want %v, got %v", want, acl)
+	}
+}
@@ -0,0 +1,15 @@
+// +build !linux
+
+package fs
+
+import "github.com/restic/restic/internal/errors"
+
+// GetACL returns nil, reading POSIX ACLs is only supported on Linux.
+func GetACL(path string) (*ACL, error) {
+	return nil, nil
+}
+
+// SetACL returns an error, setting POSIX ACLs is only supported on Linux.
+func SetACL(path string, acl *ACL) error {
+	return errors.Errorf("unable to restore the ACL of %v: POSIX ACLs are not supported on this platform", path)
+}
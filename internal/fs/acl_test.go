@@ -0,0 +1,77 @@
+package fs
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestACLEntryText(t *testing.T) {
+	acl := ACL{
+		Access: []ACLEntry{
+			{Tag: ACLUserObj, Perm: 6},
+			{Tag: ACLUser, ID: 1000, Perm: 4},
+			{Tag: ACLGroupObj, Perm: 4},
+			{Tag: ACLGroup, ID: 0, Perm: 5},
+			{Tag: ACLMask, Perm: 7},
+			{Tag: ACLOther, Perm: 0},
+		},
+	}
+
+	buf, err := json.Marshal(acl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"access":["user::rw-","user:1000:r--","group::r--","group:0:r-x","mask::rwx","other::---"]}`
+	if string(buf) != want {
+		t.Fatalf("wrong JSON, want:\n  %s\ngot:\n  %s", want, buf)
+	}
+
+	var acl2 ACL
+	if err = json.Unmarshal(buf, &acl2); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(acl, acl2) {
+		t.Fatalf("ACL changed after decoding, want %v, got %v", acl, acl2)
+	}
+
+	for _, s := range []string{"user::rw", "mask:1:rwx", "user:x:rwx", "foo::rwx", "other::rxw"} {
+		var e ACLEntry
+		if err := e.UnmarshalText([]byte(s)); err == nil {
+			t.Errorf("invalid entry %q was accepted as %v", s, e)
+		}
+	}
+}
+
+func TestACLXattr(t *testing.T) {
+	entries := []ACLEntry{
+		{Tag: ACLUserObj, Perm: 7},
+		{Tag: ACLUser, ID: 1000, Perm: 6},
+		{Tag: ACLGroupObj, Perm: 5},
+		{Tag: ACLMask, Perm: 7},
+		{Tag: ACLOther, Perm: 5},
+	}
+
+	buf := encodeACLXattr(entries)
+	if len(buf) != 4+8*len(entries) {
+		t.Fatalf("wrong length %d", len(buf))
+	}
+
+	decoded, err := decodeACLXattr(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entries, decoded) {
+		t.Fatalf("wrong entries decoded, want %v, got %v", entries, decoded)
+	}
+
+	if _, err = decodeACLXattr(buf[:len(buf)-1]); err == nil {
+		t.Errorf("truncated ACL was accepted")
+	}
+
+	buf[0] = 1
+	if _, err = decodeACLXattr(buf); err == nil {
+		t.Errorf("ACL with wrong version was accepted")
+	}
+}
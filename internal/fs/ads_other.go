@@ -0,0 +1,12 @@
+// +build !windows
+
+package fs
+
+// StreamsSupported is false, only NTFS files have alternate data streams.
+const StreamsSupported = false
+
+// ListStreams returns nil, alternate data streams are only supported on
+// Windows.
+func ListStreams(name string) ([]string, error) {
+	return nil, nil
+}
@@ -0,0 +1,71 @@
+package fs
+
+import (
+	"sort"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/restic/restic/internal/errors"
+	"golang.org/x/sys/windows"
+)
+
+// StreamsSupported is true, NTFS files can have alternate data streams.
+const StreamsSupported = true
+
+var (
+	modkernel32          = windows.NewLazySystemDLL("kernel32.dll")
+	procFindFirstStreamW = modkernel32.NewProc("FindFirstStreamW")
+	procFindNextStreamW  = modkernel32.NewProc("FindNextStreamW")
+)
+
+const (
+	findStreamInfoStandard = 0
+	errorHandleEOF         = syscall.Errno(38)
+)
+
+// win32FindStreamData is WIN32_FIND_STREAM_DATA.
+type win32FindStreamData struct {
+	StreamSize int64
+	StreamName [syscall.MAX_PATH + 36]uint16
+}
+
+// ListStreams returns the sorted names of the alternate data streams of the
+// file name, without the unnamed main stream.
+func ListStreams(name string) ([]string, error) {
+	p, err := syscall.UTF16PtrFromString(fixpath(name))
+	if err != nil {
+		return nil, errors.Wrap(err, "UTF16PtrFromString")
+	}
+
+	var data win32FindStreamData
+	h, _, err := procFindFirstStreamW.Call(uintptr(unsafe.Pointer(p)), findStreamInfoStandard, uintptr(unsafe.Pointer(&data)), 0)
+	if syscall.Handle(h) == syscall.InvalidHandle {
+		if err == errorHandleEOF {
+			// the file does not have any streams, e.g. a directory
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "FindFirstStreamW")
+	}
+	defer syscall.FindClose(syscall.Handle(h))
+
+	var names []string
+	for {
+		// stream names have the form ":name:$DATA", the main stream is "::$DATA"
+		s := syscall.UTF16ToString(data.StreamName[:])
+		if strings.HasSuffix(s, ":$DATA") && s != "::$DATA" {
+			names = append(names, strings.TrimSuffix(strings.TrimPrefix(s, ":"), ":$DATA"))
+		}
+
+		r, _, err := procFindNextStreamW.Call(h, uintptr(unsafe.Pointer(&data)))
+		if r == 0 {
+			if err == errorHandleEOF {
+				break
+			}
+			return nil, errors.Wrap(err, "FindNextStreamW")
+		}
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
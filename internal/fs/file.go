@@ -94,6 +94,22 @@ func Open(name string) (File, error) {
 	return os.Open(fixpath(name))
 }
 
+// OpenNoAtime opens a file for reading like Open, but where the operating
+// system supports it (O_NOATIME on Linux), the access time of the file is not
+// updated by reading it. Only the owner of a file may use O_NOATIME, for all
+// other files this falls back to Open.
+func OpenNoAtime(name string) (File, error) {
+	if oNoatime == 0 {
+		return Open(name)
+	}
+
+	f, err := os.OpenFile(fixpath(name), os.O_RDONLY|oNoatime, 0)
+	if err != nil && os.IsPermission(err) {
+		return Open(name)
+	}
+	return f, err
+}
+
 // OpenFile is the generalized open call; most users will use Open
 // or Create instead.  It opens the named file with specified flag
 // (O_RDONLY etc.) and perm, (0666 etc.) if applicable.  If successful,
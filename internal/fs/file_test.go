@@ -0,0 +1,95 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOpenNoAtime(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "restic-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer RemoveAll(tempdir)
+
+	filename := filepath.Join(tempdir, "file")
+	want := []byte("foobar")
+	if err := ioutil.WriteFile(filename, want, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := OpenNoAtime(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(buf) != string(want) {
+		t.Errorf("wrong content, want %q, got %q", want, buf)
+	}
+
+	_, err = OpenNoAtime(filepath.Join(tempdir, "missing"))
+	if err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
+
+// wrappedFS hides that the local file system is used, so that WalkFS does not
+// use filepath.Walk.
+type wrappedFS struct {
+	Local
+}
+
+func TestWalkFS(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "restic-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer RemoveAll(tempdir)
+
+	for _, dir := range []string{"a/b", "a/skip/c", "d"} {
+		if err := MkdirAll(filepath.Join(tempdir, dir), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{"a/file", "a/skip/file", "d/file", "top"} {
+		if err := ioutil.WriteFile(filepath.Join(tempdir, file), []byte(file), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	walk := func(fsys FS) []string {
+		var items []string
+		err := WalkFS(fsys, tempdir, func(p string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			items = append(items, p)
+			if fi.Name() == "skip" {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return items
+	}
+
+	want := walk(Local{})
+	got := walk(wrappedFS{})
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("wrong items walked, want:\n  %v\ngot:\n  %v", want, got)
+	}
+}
@@ -0,0 +1,91 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/restic/restic/internal/debug"
+)
+
+// FollowSymlinks is the local file system, but symbolic links are followed:
+// Lstat returns the information about the file a link points to, so that the
+// content of the file or directory is read instead of the link. Links which
+// cannot be resolved, and links to a directory which contains the link
+// itself, which would lead to an endless loop, are returned as links.
+type FollowSymlinks struct {
+	Local
+}
+
+var _ FS = FollowSymlinks{}
+
+// followedFileInfo is the os.FileInfo of the destination of a link, with the
+// name of the link.
+type followedFileInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (fi followedFileInfo) Name() string {
+	return fi.name
+}
+
+// Lstat returns the FileInfo structure describing the named file, or the
+// destination of the named symbolic link.
+func (FollowSymlinks) Lstat(name string) (os.FileInfo, error) {
+	fi, err := Lstat(name)
+	if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		return fi, err
+	}
+
+	target, err := resolveLink(name)
+	if err != nil {
+		debug.Log("unable to resolve link %v: %v", name, err)
+		return fi, nil
+	}
+
+	tfi, err := Stat(target)
+	if err != nil {
+		debug.Log("unable to stat the destination of link %v: %v", name, err)
+		return fi, nil
+	}
+
+	if tfi.IsDir() && isLinkLoop(name, target) {
+		debug.Log("link %v points to %v, which contains the link", name, target)
+		return fi, nil
+	}
+
+	return followedFileInfo{FileInfo: tfi, name: fi.Name()}, nil
+}
+
+// resolveLink returns the absolute path of the destination of the link name
+// without any symbolic links.
+func resolveLink(name string) (string, error) {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.EvalSymlinks(abs)
+}
+
+// isLinkLoop returns true if the directory target, the resolved destination
+// of the link name, is one of the directories name is contained in. The
+// directories are resolved as well, so a loop built from several links is
+// found when the last of them is reached.
+func isLinkLoop(name, target string) bool {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return true
+	}
+
+	for dir := filepath.Dir(abs); ; dir = filepath.Dir(dir) {
+		real, err := filepath.EvalSymlinks(dir)
+		if err == nil && real == target {
+			return true
+		}
+
+		if filepath.Dir(dir) == dir {
+			return false
+		}
+	}
+}
@@ -0,0 +1,74 @@
+//+build !windows
+
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFollowSymlinks(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "restic-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer RemoveAll(tempdir)
+
+	mkdir := func(name string) {
+		if err := os.MkdirAll(filepath.Join(tempdir, name), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := func(target, name string) {
+		if err := os.Symlink(target, filepath.Join(tempdir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mkdir("a/sub")
+	mkdir("b")
+	if err := ioutil.WriteFile(filepath.Join(tempdir, "b", "file"), []byte("foo"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	link("../b/file", "a/file")
+	link("../b", "a/b")
+	link("../a", "b/a")
+	link("..", "a/sub/up")
+	link("missing", "a/dangling")
+
+	var tests = []struct {
+		name string
+		mode os.FileMode
+	}{
+		{"a/file", 0},
+		{"a/b", os.ModeDir},
+		// b/a is a link to a directory which contains a/b, the walk
+		// would return to a/b
+		{"a/b/a", os.ModeSymlink},
+		{"b/a", os.ModeDir},
+		{"b/a/b", os.ModeSymlink},
+		{"a/sub/up", os.ModeSymlink},
+		{"a/dangling", os.ModeSymlink},
+	}
+
+	fsys := FollowSymlinks{}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fi, err := fsys.Lstat(filepath.Join(tempdir, test.name))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if fi.Name() != filepath.Base(test.name) {
+				t.Errorf("wrong name, want %q, got %q", filepath.Base(test.name), fi.Name())
+			}
+
+			if fi.Mode()&os.ModeType != test.mode {
+				t.Errorf("wrong type, want %v, got %v", test.mode, fi.Mode()&os.ModeType)
+			}
+		})
+	}
+}
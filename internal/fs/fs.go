@@ -0,0 +1,167 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// FS is a file system the archiver can read files from, e.g. the local file
+// system or a directory tree on another host.
+type FS interface {
+	// Open opens the file name for reading.
+	Open(name string) (File, error)
+
+	Lstat(name string) (os.FileInfo, error)
+	Readlink(name string) (string, error)
+
+	// ReadDirNames returns the sorted names of the entries of the directory
+	// name.
+	ReadDirNames(name string) ([]string, error)
+}
+
+// StreamFS is implemented by file systems on which files can have alternate
+// data streams (NTFS).
+type StreamFS interface {
+	// ListStreams returns the sorted names of the alternate data streams of
+	// the file name.
+	ListStreams(name string) ([]string, error)
+}
+
+// StreamPath returns the path of the alternate data stream of the file name,
+// which can be opened like a file.
+func StreamPath(name, stream string) string {
+	return name + ":" + stream
+}
+
+// StreamedFile is implemented by files whose size is only known once they
+// have been read completely, e.g. data produced by a program.
+type StreamedFile interface {
+	// SizeUnknown returns true if the size returned by Lstat or Stat is not
+	// the size of the content.
+	SizeUnknown() bool
+}
+
+// RemoteStat is returned by the Sys() method of the os.FileInfo values of a
+// file system on another host. It contains the metadata which is available
+// in addition to the os.FileInfo.
+type RemoteStat struct {
+	UID, GID   uint32
+	AccessTime time.Time
+
+	// LinkTarget is the destination of a symbolic link.
+	LinkTarget string
+}
+
+// Local is the local file system. Files are opened without updating their
+// access time where possible.
+type Local struct{}
+
+var _ FS = Local{}
+var _ StreamFS = Local{}
+
+// Open opens the file name with OpenNoAtime. Stale NFS file handles are
+// retried.
+func (Local) Open(name string) (f File, err error) {
+	err = retryStale(name, func() error {
+		f, err = OpenNoAtime(name)
+		return err
+	})
+	return f, err
+}
+
+// Lstat returns the FileInfo structure describing the named file. Stale NFS
+// file handles are retried.
+func (Local) Lstat(name string) (fi os.FileInfo, err error) {
+	err = retryStale(name, func() error {
+		fi, err = Lstat(name)
+		return err
+	})
+	return fi, err
+}
+
+// Readlink returns the destination of the named symbolic link.
+func (Local) Readlink(name string) (string, error) {
+	return Readlink(name)
+}
+
+// ListStreams returns the sorted names of the alternate data streams of the
+// file name.
+func (Local) ListStreams(name string) ([]string, error) {
+	return ListStreams(name)
+}
+
+// ReadDirNames returns the sorted names of the entries of the directory name.
+// Stale NFS file handles are retried.
+func (Local) ReadDirNames(name string) (names []string, err error) {
+	err = retryStale(name, func() error {
+		f, err := OpenNoAtime(name)
+		if err != nil {
+			return err
+		}
+
+		names, err = f.Readdirnames(-1)
+		_ = f.Close()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// WalkFS works like Walk, but walks the file tree in fsys.
+func WalkFS(fsys FS, root string, walkFn filepath.WalkFunc) error {
+	if _, ok := fsys.(Local); ok {
+		return Walk(root, walkFn)
+	}
+
+	fi, err := fsys.Lstat(root)
+	if err != nil {
+		err = walkFn(root, nil, err)
+	} else {
+		err = walkFS(fsys, root, fi, walkFn)
+	}
+
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+func walkFS(fsys FS, path string, fi os.FileInfo, walkFn filepath.WalkFunc) error {
+	if !fi.IsDir() {
+		return walkFn(path, fi, nil)
+	}
+
+	names, err := fsys.ReadDirNames(path)
+	err1 := walkFn(path, fi, err)
+	if err != nil || err1 != nil {
+		// same as filepath.Walk: if reading the directory failed, walkFn
+		// decides whether to continue
+		return err1
+	}
+
+	for _, name := range names {
+		filename := filepath.Join(path, name)
+		fi, err := fsys.Lstat(filename)
+		if err != nil {
+			if err := walkFn(filename, fi, err); err != nil && err != filepath.SkipDir {
+				return err
+			}
+			continue
+		}
+
+		err = walkFS(fsys, filename, fi, walkFn)
+		if err != nil {
+			if !fi.IsDir() || err != filepath.SkipDir {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
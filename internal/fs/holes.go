@@ -0,0 +1,13 @@
+package fs
+
+// Hole is a range of a sparse file which is not allocated on disk, it reads
+// as zero bytes.
+type Hole struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// End returns the offset of the first byte after the hole.
+func (h Hole) End() int64 {
+	return h.Offset + h.Length
+}
@@ -0,0 +1,56 @@
+// +build linux freebsd
+
+package fs
+
+import (
+	"io"
+	"syscall"
+)
+
+// The values of whence for lseek which find the next data or hole in a file.
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+// Holes returns the holes in the first size bytes of the file f, as reported
+// by lseek with SEEK_HOLE and SEEK_DATA. On file systems which do not support
+// sparse files, the whole file is data and nil is returned. The offset of f is
+// reset to the beginning of the file.
+func Holes(f File, size int64) ([]Hole, error) {
+	if f.Fd() == ^uintptr(0) {
+		// not a local file
+		return nil, nil
+	}
+
+	fd := int(f.Fd())
+
+	var holes []Hole
+	for off := int64(0); off < size; {
+		start, err := syscall.Seek(fd, off, seekHole)
+		if err == syscall.ENXIO || (err == nil && start >= size) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		end, err := syscall.Seek(fd, start, seekData)
+		if err == syscall.ENXIO || (err == nil && end > size) {
+			// the file ends with a hole
+			end = size
+		} else if err != nil {
+			return nil, err
+		}
+
+		holes = append(holes, Hole{Offset: start, Length: end - start})
+		off = end
+	}
+
+	_, err := syscall.Seek(fd, 0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	return holes, nil
+}
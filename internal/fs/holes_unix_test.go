@@ -0,0 +1,67 @@
+// +build linux freebsd
+
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestHoles(t *testing.T) {
+	f, err := ioutil.TempFile("", "restic-test-holes-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+
+	const size = 8 << 20
+	data := make([]byte, 1<<20)
+	for i := range data {
+		data[i] = 1
+	}
+
+	// data at 2 MiB, followed by a hole up to the end of the file
+	if _, err = f.WriteAt(data, 2<<20); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+
+	holes, err := Holes(f, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(holes) == 0 {
+		t.Skip("file system does not report holes")
+	}
+
+	var total int64
+	for _, h := range holes {
+		if h.Offset < 3<<20 && h.End() > 2<<20 {
+			t.Errorf("hole %+v overlaps with the data", h)
+		}
+		total += h.Length
+	}
+
+	if total > size-1<<20 {
+		t.Errorf("holes contain %d bytes, more than the %d bytes which are not data", total, size-1<<20)
+	}
+
+	if last := holes[len(holes)-1]; last.End() != size {
+		t.Errorf("last hole %+v does not extend to the end of the file", last)
+	}
+
+	pos, err := f.Seek(0, os.SEEK_CUR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos != 0 {
+		t.Errorf("offset of the file was not reset, got %d", pos)
+	}
+}
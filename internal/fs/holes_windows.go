@@ -0,0 +1,64 @@
+package fs
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const fsctlQueryAllocatedRanges = 0x000940cf
+
+// fileAllocatedRangeBuffer is FILE_ALLOCATED_RANGE_BUFFER.
+type fileAllocatedRangeBuffer struct {
+	FileOffset int64
+	Length     int64
+}
+
+// Holes returns the holes in the first size bytes of the file f, which are
+// the gaps between the ranges reported by FSCTL_QUERY_ALLOCATED_RANGES. For
+// files which are not sparse, the whole file is allocated and nil is
+// returned.
+func Holes(f File, size int64) ([]Hole, error) {
+	if f.Fd() == ^uintptr(0) {
+		// not a local file
+		return nil, nil
+	}
+
+	h := windows.Handle(f.Fd())
+	query := fileAllocatedRangeBuffer{Length: size}
+	ranges := make([]fileAllocatedRangeBuffer, 64)
+
+	var holes []Hole
+	off := int64(0)
+	for {
+		var n uint32
+		err := windows.DeviceIoControl(h, fsctlQueryAllocatedRanges,
+			(*byte)(unsafe.Pointer(&query)), uint32(unsafe.Sizeof(query)),
+			(*byte)(unsafe.Pointer(&ranges[0])), uint32(len(ranges))*uint32(unsafe.Sizeof(ranges[0])),
+			&n, nil)
+		if err != nil && err != windows.ERROR_MORE_DATA {
+			return nil, err
+		}
+
+		count := int(n / uint32(unsafe.Sizeof(ranges[0])))
+		for _, r := range ranges[:count] {
+			if r.FileOffset > off {
+				holes = append(holes, Hole{Offset: off, Length: r.FileOffset - off})
+			}
+			off = r.FileOffset + r.Length
+		}
+
+		if err == nil || count == 0 {
+			break
+		}
+
+		// continue after the last range returned
+		query = fileAllocatedRangeBuffer{FileOffset: off, Length: size - off}
+	}
+
+	if off < size {
+		holes = append(holes, Hole{Offset: off, Length: size - off})
+	}
+
+	return holes, nil
+}
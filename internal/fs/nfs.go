@@ -0,0 +1,57 @@
+package fs
+
+import (
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// staleRetries is the number of times an operation is retried when it failed
+// because the NFS file handle was stale.
+const staleRetries = 3
+
+// IsSillyRename returns true if name is the name NFS clients give to a file
+// which has been removed while it was still open (".nfs" followed by hex
+// digits). The file disappears when it is closed.
+func IsSillyRename(name string) bool {
+	if !strings.HasPrefix(name, ".nfs") || len(name) < 12 {
+		return false
+	}
+
+	for _, c := range name[4:] {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isStale returns true if err was caused by a stale NFS file handle.
+func isStale(err error) bool {
+	switch e := errors.Cause(err).(type) {
+	case *os.PathError:
+		return e.Err == syscall.ESTALE
+	case *os.SyscallError:
+		return e.Err == syscall.ESTALE
+	case syscall.Errno:
+		return e == syscall.ESTALE
+	}
+	return false
+}
+
+// retryStale runs fn again when it fails because the NFS file handle is
+// stale, which happens when the file has been replaced on the server while
+// the client still has the old handle cached. A new lookup of the path
+// usually succeeds.
+func retryStale(name string, fn func() error) error {
+	err := fn()
+	for i := 0; i < staleRetries && isStale(err); i++ {
+		debug.Log("stale file handle for %v, retrying", name)
+		err = fn()
+	}
+	return err
+}
@@ -0,0 +1,19 @@
+package fs
+
+import "syscall"
+
+// nfsSuperMagic is the file system type of NFS mounts reported by statfs.
+const nfsSuperMagic = 0x6969
+
+// IsNFS returns true if the file name is stored on an NFS mount.
+func IsNFS(name string) (bool, error) {
+	var st syscall.Statfs_t
+	err := retryStale(name, func() error {
+		return syscall.Statfs(fixpath(name), &st)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return st.Type == nfsSuperMagic, nil
+}
@@ -0,0 +1,67 @@
+package fs
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+func TestIsSillyRename(t *testing.T) {
+	var tests = []struct {
+		name string
+		want bool
+	}{
+		{".nfs000000000123456700000001", true},
+		{".nfs1A2B3C4D", true},
+		{".nfs", false},
+		{".nfs1234", false},
+		{".nfsrc", false},
+		{".nfs000000000123456x", false},
+		{"file.nfs00000000", false},
+	}
+
+	for _, test := range tests {
+		if got := IsSillyRename(test.name); got != test.want {
+			t.Errorf("IsSillyRename(%q) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRetryStale(t *testing.T) {
+	stale := &os.PathError{Op: "open", Path: "file", Err: syscall.ESTALE}
+
+	calls := 0
+	err := retryStale("file", func() error {
+		calls++
+		if calls < 3 {
+			return errors.Wrap(stale, "Open")
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("unexpected result after %d calls: %v", calls, err)
+	}
+
+	// the number of retries is limited
+	calls = 0
+	err = retryStale("file", func() error {
+		calls++
+		return stale
+	})
+	if err != stale || calls != staleRetries+1 {
+		t.Errorf("unexpected result after %d calls: %v", calls, err)
+	}
+
+	// other errors are not retried
+	calls = 0
+	notExist := &os.PathError{Op: "open", Path: "file", Err: syscall.ENOENT}
+	err = retryStale("file", func() error {
+		calls++
+		return notExist
+	})
+	if err != notExist || calls != 1 {
+		t.Errorf("unexpected result after %d calls: %v", calls, err)
+	}
+}
@@ -0,0 +1,7 @@
+package fs
+
+import "syscall"
+
+// oNoatime is the flag which prevents updating the access time of a file when
+// reading it.
+const oNoatime = syscall.O_NOATIME
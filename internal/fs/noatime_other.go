@@ -0,0 +1,7 @@
+// +build !linux
+
+package fs
+
+// oNoatime is zero, the operating system has no flag to prevent updating the
+// access time of a file when reading it.
+const oNoatime = 0
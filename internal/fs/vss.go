@@ -0,0 +1,82 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/restic/restic/internal/debug"
+)
+
+// LocalVSS is the local file system, but files are read from a Volume Shadow
+// Copy of each volume, created by NewLocalVSS before the backup starts. All
+// files are therefore read in the state they had at the time the shadow copy
+// was created, and files which are locked by other programs (e.g. databases)
+// can be read as well. Paths are passed in and returned as on the original
+// volume. Files on volumes without a shadow copy are read directly.
+type LocalVSS struct {
+	// snapshots maps the upper case name of a volume (e.g. "C:") to the
+	// device of its shadow copy.
+	snapshots map[string]string
+	cleanup   func() error
+}
+
+var _ FS = &LocalVSS{}
+var _ StreamFS = &LocalVSS{}
+
+// snapshotPath returns the path of name in the shadow copy of its volume.
+func (fs *LocalVSS) snapshotPath(name string) string {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		debug.Log("unable to get the absolute path of %v: %v", name, err)
+		return name
+	}
+
+	vol := filepath.VolumeName(abs)
+	dev, ok := fs.snapshots[strings.ToUpper(vol)]
+	if !ok {
+		return name
+	}
+
+	return dev + abs[len(vol):]
+}
+
+// Open opens the file name in the shadow copy.
+func (fs *LocalVSS) Open(name string) (File, error) {
+	return Local{}.Open(fs.snapshotPath(name))
+}
+
+// Lstat returns the FileInfo structure describing the named file in the
+// shadow copy.
+func (fs *LocalVSS) Lstat(name string) (os.FileInfo, error) {
+	return Local{}.Lstat(fs.snapshotPath(name))
+}
+
+// Readlink returns the destination of the named symbolic link in the shadow
+// copy.
+func (fs *LocalVSS) Readlink(name string) (string, error) {
+	return Local{}.Readlink(fs.snapshotPath(name))
+}
+
+// ListStreams returns the sorted names of the alternate data streams of the
+// file name in the shadow copy.
+func (fs *LocalVSS) ListStreams(name string) ([]string, error) {
+	return Local{}.ListStreams(fs.snapshotPath(name))
+}
+
+// ReadDirNames returns the sorted names of the entries of the directory name
+// in the shadow copy.
+func (fs *LocalVSS) ReadDirNames(name string) ([]string, error) {
+	return Local{}.ReadDirNames(fs.snapshotPath(name))
+}
+
+// Close deletes the shadow copies.
+func (fs *LocalVSS) Close() error {
+	if fs.cleanup == nil {
+		return nil
+	}
+
+	err := fs.cleanup()
+	fs.cleanup = nil
+	return err
+}
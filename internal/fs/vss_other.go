@@ -0,0 +1,10 @@
+// +build !windows
+
+package fs
+
+import "github.com/restic/restic/internal/errors"
+
+// NewLocalVSS returns an error, shadow copies are only available on Windows.
+func NewLocalVSS(paths []string) (*LocalVSS, error) {
+	return nil, errors.New("Volume Shadow Copies are only supported on Windows")
+}
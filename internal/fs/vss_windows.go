@@ -0,0 +1,123 @@
+package fs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// shadowCopy is a Volume Shadow Copy created with the WMI class
+// Win32_ShadowCopy.
+type shadowCopy struct {
+	id     string
+	device string
+}
+
+// powershell runs the script with PowerShell and returns the output.
+func powershell(script string) ([]byte, error) {
+	cmd := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-Command", script)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Errorf("%v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out, nil
+}
+
+// createShadowCopy creates a shadow copy of the volume vol, e.g. "C:".
+func createShadowCopy(vol string) (shadowCopy, error) {
+	script := fmt.Sprintf(`$ErrorActionPreference = "Stop"
+$r = (Get-WmiObject -List Win32_ShadowCopy).Create("%s\", "ClientAccessible")
+if ($r.ReturnValue -ne 0) { throw "Win32_ShadowCopy.Create returned $($r.ReturnValue)" }
+$s = Get-WmiObject Win32_ShadowCopy | Where-Object { $_.ID -eq $r.ShadowID }
+Write-Output $s.ID
+Write-Output $s.DeviceObject`, vol)
+
+	out, err := powershell(script)
+	if err != nil {
+		return shadowCopy{}, errors.Wrapf(err, "create shadow copy of %v", vol)
+	}
+
+	var lines []string
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	if len(lines) != 2 {
+		return shadowCopy{}, errors.Errorf("create shadow copy of %v: unexpected output %q", vol, out)
+	}
+
+	return shadowCopy{id: lines[0], device: lines[1]}, nil
+}
+
+// deleteShadowCopy deletes the shadow copy with the id.
+func deleteShadowCopy(id string) error {
+	script := fmt.Sprintf(`$ErrorActionPreference = "Stop"
+Get-WmiObject Win32_ShadowCopy | Where-Object { $_.ID -eq "%s" } | ForEach-Object { $_.Delete() }`, id)
+
+	_, err := powershell(script)
+	if err != nil {
+		return errors.Wrapf(err, "delete shadow copy %v", id)
+	}
+	return nil
+}
+
+// NewLocalVSS creates a shadow copy of each volume the paths are located on
+// and returns a file system which reads the files from them. This requires
+// administrator privileges. The shadow copies are deleted by Close.
+func NewLocalVSS(paths []string) (*LocalVSS, error) {
+	fs := &LocalVSS{snapshots: make(map[string]string)}
+
+	var created []shadowCopy
+	fs.cleanup = func() error {
+		var firstErr error
+		for _, s := range created {
+			debug.Log("deleting shadow copy %v", s.id)
+			if err := deleteShadowCopy(s.id); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		return firstErr
+	}
+
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			_ = fs.Close()
+			return nil, errors.Wrap(err, "Abs")
+		}
+
+		vol := strings.ToUpper(filepath.VolumeName(abs))
+		if len(vol) != 2 || vol[1] != ':' {
+			_ = fs.Close()
+			return nil, errors.Errorf("no shadow copy can be created for %v", path)
+		}
+
+		if _, ok := fs.snapshots[vol]; ok {
+			continue
+		}
+
+		s, err := createShadowCopy(vol)
+		if err != nil {
+			_ = fs.Close()
+			return nil, err
+		}
+
+		debug.Log("created shadow copy %v of %v at %v", s.id, vol, s.device)
+		created = append(created, s)
+		fs.snapshots[vol] = s.device
+	}
+
+	return fs, nil
+}
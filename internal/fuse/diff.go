@@ -0,0 +1,327 @@
+// +build !openbsd
+// +build !solaris
+// +build !windows
+
+package fuse
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"golang.org/x/net/context"
+
+	"github.com/restic/restic/internal/debug"
+	resticfs "github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// diffSuffix is appended to the name of a snapshot for the file which
+// contains the differences between the snapshot and the local file system.
+const diffSuffix = ".diff"
+
+// diffFile is a read-only file whose content is computed when it is read: it
+// lists the changes in the local file system since the snapshot was made.
+type diffFile struct {
+	root     *Root
+	inode    uint64
+	snapshot *restic.Snapshot
+}
+
+// ensure that *diffFile implements these interfaces
+var _ = fs.NodeOpener(&diffFile{})
+var _ = fs.HandleReadAller(&diffFile{})
+
+func newDiffFile(root *Root, inode uint64, snapshot *restic.Snapshot) *diffFile {
+	return &diffFile{root: root, inode: inode, snapshot: snapshot}
+}
+
+// appendDiffFiles adds an entry for the diff file of each snapshot in names to
+// items, if a directory to compare the snapshots with has been configured.
+func appendDiffFiles(items []fuse.Dirent, root *Root, inode uint64, names map[string]*restic.Snapshot) []fuse.Dirent {
+	if root.cfg.DiffRoot == "" {
+		return items
+	}
+
+	for name := range names {
+		items = append(items, fuse.Dirent{
+			Inode: fs.GenerateDynamicInode(inode, name+diffSuffix),
+			Name:  name + diffSuffix,
+			Type:  fuse.DT_File,
+		})
+	}
+
+	return items
+}
+
+// lookupDiffFile returns the diff file for name, or nil if name does not
+// refer to the diff file of a snapshot in names.
+func lookupDiffFile(root *Root, inode uint64, names map[string]*restic.Snapshot, name string) fs.Node {
+	if root.cfg.DiffRoot == "" || !strings.HasSuffix(name, diffSuffix) {
+		return nil
+	}
+
+	sn, ok := names[strings.TrimSuffix(name, diffSuffix)]
+	if !ok {
+		return nil
+	}
+
+	return newDiffFile(root, fs.GenerateDynamicInode(inode, name), sn)
+}
+
+// Attr returns the attributes of the file. The size is not known before the
+// file is read, so it is reported as zero.
+func (f *diffFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Inode = f.inode
+	a.Mode = 0444
+	a.Uid, a.Gid = f.root.owner(uint32(os.Getuid()), uint32(os.Getgid()))
+	a.Atime = f.snapshot.Time
+	a.Ctime = f.snapshot.Time
+	a.Mtime = f.snapshot.Time
+	a.Nlink = 1
+	return nil
+}
+
+// Open disables the page cache for the file, so that the kernel reads it
+// until EOF regardless of the size reported by Attr, and the differences are
+// computed anew each time the file is opened.
+func (f *diffFile) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	resp.Flags |= fuse.OpenDirectIO
+	return f, nil
+}
+
+// ReadAll returns the differences between the snapshot and the local file
+// system.
+func (f *diffFile) ReadAll(ctx context.Context) ([]byte, error) {
+	debug.Log("diff snapshot %v against %v", f.snapshot.ID().Str(), f.root.cfg.DiffRoot)
+
+	buf := bytes.NewBuffer(nil)
+	err := diffSnapshot(ctx, f.root.repo, buf, f.snapshot, f.root.cfg.DiffRoot)
+	if err != nil {
+		debug.Log("diff failed: %v", err)
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// diffSnapshot writes the differences between the snapshot and the files in
+// the local file system below diffRoot to w, one line per item. The markers
+// are the same as for the "diff" command: "+" for items added since the
+// snapshot was made, "-" for removed items, "M" for modified content, "T"
+// for a changed type and "U" for changed permissions. Items which cannot be
+// compared are marked with "?".
+func diffSnapshot(ctx context.Context, repo restic.Repository, w io.Writer, sn *restic.Snapshot, diffRoot string) error {
+	tree, err := repo.LoadTree(ctx, *sn.Tree)
+	if err != nil {
+		return err
+	}
+
+	// the archiver names the top-level nodes after the last path component
+	// of the backup targets
+	targets := make(map[string]string, len(sn.Paths))
+	for _, p := range sn.Paths {
+		targets[filepath.Base(p)] = filepath.Join(diffRoot, p)
+	}
+
+	d := &differ{ctx: ctx, repo: repo, w: w}
+	for _, node := range tree.Nodes {
+		target, ok := targets[node.Name]
+		if !ok {
+			debug.Log("no target found for top-level node %v", node.Name)
+			continue
+		}
+
+		if err := d.diffNode(path.Join("/", node.Name), node, target); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type differ struct {
+	ctx  context.Context
+	repo restic.Repository
+	w    io.Writer
+}
+
+func (d *differ) printChange(mode, name string, isDir bool) {
+	if isDir && name != "/" {
+		name += "/"
+	}
+	fmt.Fprintf(d.w, "%-5s%v\n", mode, name)
+}
+
+// diffNode compares node from the snapshot with the item at target.
+func (d *differ) diffNode(name string, node *restic.Node, target string) error {
+	if d.ctx.Err() != nil {
+		return d.ctx.Err()
+	}
+
+	fi, err := resticfs.Lstat(target)
+	if os.IsNotExist(err) {
+		return d.printRemoved(name, node)
+	}
+	if err != nil {
+		debug.Log("Lstat(%v) failed: %v", target, err)
+		d.printChange("?", name, node.Type == "dir")
+		return nil
+	}
+
+	// errors for extended attributes etc. do not matter here, the node is
+	// returned nevertheless
+	live, _ := restic.NodeFromFileInfo(target, fi)
+
+	mod := ""
+	if node.Type != live.Type {
+		mod += "T"
+	}
+
+	switch {
+	case node.Type == "file" && live.Type == "file":
+		if node.Size != live.Size || !node.ModTime.Equal(live.ModTime) {
+			mod += "M"
+		}
+	case node.Type == "symlink" && live.Type == "symlink":
+		if node.LinkTarget != live.LinkTarget {
+			mod += "M"
+		}
+	}
+
+	if node.Type == live.Type && node.Mode != live.Mode {
+		mod += "U"
+	}
+
+	if mod != "" {
+		d.printChange(mod, name, live.Type == "dir")
+	}
+
+	if node.Type == "dir" && live.Type == "dir" {
+		return d.diffDir(name, node, target)
+	}
+
+	return nil
+}
+
+// diffDir compares the contents of the directories in the snapshot and the
+// local file system.
+func (d *differ) diffDir(name string, node *restic.Node, target string) error {
+	tree, err := d.repo.LoadTree(d.ctx, *node.Subtree)
+	if err != nil {
+		return err
+	}
+
+	liveNames, err := resticfs.Local{}.ReadDirNames(target)
+	if err != nil {
+		debug.Log("ReadDirNames(%v) failed: %v", target, err)
+		d.printChange("?", name, true)
+		return nil
+	}
+
+	nodes := make(map[string]*restic.Node, len(tree.Nodes))
+	for _, n := range tree.Nodes {
+		nodes[n.Name] = n
+	}
+
+	live := make(map[string]bool, len(liveNames))
+	for _, n := range liveNames {
+		live[n] = true
+	}
+
+	names := make([]string, 0, len(nodes)+len(live))
+	for n := range nodes {
+		names = append(names, n)
+	}
+	for n := range live {
+		if _, ok := nodes[n]; !ok {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		item := path.Join(name, n)
+		sub, inSnapshot := nodes[n]
+
+		var err error
+		switch {
+		case inSnapshot && live[n]:
+			err = d.diffNode(item, sub, filepath.Join(target, n))
+		case inSnapshot:
+			err = d.printRemoved(item, sub)
+		default:
+			err = d.printAdded(item, filepath.Join(target, n))
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// printRemoved prints node and, for a directory, all items below it as
+// removed.
+func (d *differ) printRemoved(name string, node *restic.Node) error {
+	d.printChange("-", name, node.Type == "dir")
+	if node.Type != "dir" {
+		return nil
+	}
+
+	tree, err := d.repo.LoadTree(d.ctx, *node.Subtree)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range tree.Nodes {
+		if err := d.printRemoved(path.Join(name, n.Name), n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// printAdded prints the item at target and, for a directory, all items below
+// it as added.
+func (d *differ) printAdded(name string, target string) error {
+	if d.ctx.Err() != nil {
+		return d.ctx.Err()
+	}
+
+	fi, err := resticfs.Lstat(target)
+	if err != nil {
+		// the item was removed in the meantime
+		debug.Log("Lstat(%v) failed: %v", target, err)
+		return nil
+	}
+
+	d.printChange("+", name, fi.IsDir())
+	if !fi.IsDir() {
+		return nil
+	}
+
+	names, err := resticfs.Local{}.ReadDirNames(target)
+	if err != nil {
+		debug.Log("ReadDirNames(%v) failed: %v", target, err)
+		d.printChange("?", name, true)
+		return nil
+	}
+
+	for _, n := range names {
+		if err := d.printAdded(path.Join(name, n), filepath.Join(target, n)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
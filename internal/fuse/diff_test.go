@@ -0,0 +1,66 @@
+// +build !openbsd
+// +build !solaris
+// +build !windows
+
+package fuse
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/repository"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestFuseDiffSnapshot(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	tempdir, cleanupTemp := rtest.TempDir(t)
+	defer cleanupTemp()
+
+	dir := filepath.Join(tempdir, "data")
+	rtest.OK(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+	for _, name := range []string{"unchanged", "modified", "removed", "chmod", filepath.Join("sub", "file")} {
+		rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+	}
+
+	sn := archiver.TestSnapshot(t, repo, dir, nil)
+
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "modified"), []byte("new content"), 0644))
+	rtest.OK(t, os.Remove(filepath.Join(dir, "removed")))
+	rtest.OK(t, os.Chmod(filepath.Join(dir, "chmod"), 0600))
+	rtest.OK(t, os.RemoveAll(filepath.Join(dir, "sub")))
+	rtest.OK(t, os.MkdirAll(filepath.Join(dir, "new"), 0755))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "new", "file"), []byte("new"), 0644))
+
+	buf := bytes.NewBuffer(nil)
+	rtest.OK(t, diffSnapshot(context.TODO(), repo, buf, sn, "/"))
+
+	want := []string{
+		"U    /data/chmod",
+		"M    /data/modified",
+		"+    /data/new/",
+		"+    /data/new/file",
+		"-    /data/removed",
+		"-    /data/sub/",
+		"-    /data/sub/file",
+	}
+	rtest.Equals(t, strings.Join(want, "\n")+"\n", buf.String())
+
+	// relative to another directory, the whole snapshot has been removed
+	other, cleanupOther := rtest.TempDir(t)
+	defer cleanupOther()
+
+	buf.Reset()
+	rtest.OK(t, diffSnapshot(context.TODO(), repo, buf, sn, other))
+	rtest.Assert(t, strings.HasPrefix(buf.String(), "-    /data/\n"), "unexpected diff %q", buf.String())
+}
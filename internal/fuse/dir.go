@@ -112,12 +112,9 @@ func newDirFromSnapshot(ctx context.Context, root *Root, inode uint64, snapshot
 func (d *dir) Attr(ctx context.Context, a *fuse.Attr) error {
 	debug.Log("called")
 	a.Inode = d.inode
-	a.Mode = os.ModeDir | d.node.Mode
+	a.Mode = d.root.mode(os.ModeDir | d.node.Mode)
 
-	if !d.root.cfg.OwnerIsRoot {
-		a.Uid = d.node.UID
-		a.Gid = d.node.GID
-	}
+	a.Uid, a.Gid = d.root.owner(d.node.UID, d.node.GID)
 	a.Atime = d.node.AccessTime
 	a.Ctime = d.node.ChangeTime
 	a.Mtime = d.node.ModTime
@@ -35,6 +35,11 @@ func newFile(ctx context.Context, root *Root, inode uint64, node *restic.Node) (
 	debug.Log("create new file for %v with %d blobs", node.Name, len(node.Content))
 	var bytes uint64
 	sizes := make([]int, len(node.Content))
+	if node.Inline != nil {
+		// the content stored in the tree is read like a single blob
+		sizes = []int{len(node.Inline)}
+		bytes = uint64(len(node.Inline))
+	}
 	for i, id := range node.Content {
 		size, ok := root.blobSizeCache.Lookup(id)
 		if !ok {
@@ -59,23 +64,20 @@ func newFile(ctx context.Context, root *Root, inode uint64, node *restic.Node) (
 		root:  root,
 		node:  node,
 		sizes: sizes,
-		blobs: make([][]byte, len(node.Content)),
+		blobs: make([][]byte, len(sizes)),
 	}, nil
 }
 
 func (f *file) Attr(ctx context.Context, a *fuse.Attr) error {
 	debug.Log("Attr(%v)", f.node.Name)
 	a.Inode = f.inode
-	a.Mode = f.node.Mode
+	a.Mode = f.root.mode(f.node.Mode)
 	a.Size = f.node.Size
 	a.Blocks = (f.node.Size / blockSize) + 1
 	a.BlockSize = blockSize
 	a.Nlink = uint32(f.node.Links)
 
-	if !f.root.cfg.OwnerIsRoot {
-		a.Uid = f.node.UID
-		a.Gid = f.node.GID
-	}
+	a.Uid, a.Gid = f.root.owner(f.node.UID, f.node.GID)
 	a.Atime = f.node.AccessTime
 	a.Ctime = f.node.ChangeTime
 	a.Mtime = f.node.ModTime
@@ -86,6 +88,10 @@ func (f *file) Attr(ctx context.Context, a *fuse.Attr) error {
 
 func (f *file) getBlobAt(ctx context.Context, i int) (blob []byte, err error) {
 	debug.Log("getBlobAt(%v, %v)", f.node.Name, i)
+	if f.node.Inline != nil {
+		return f.node.Inline, nil
+	}
+
 	if f.blobs[i] != nil {
 		return f.blobs[i], nil
 	}
@@ -110,6 +116,11 @@ func (f *file) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadR
 	debug.Log("Read(%v, %v, %v), file size %v", f.node.Name, req.Size, req.Offset, f.node.Size)
 	offset := req.Offset
 
+	// remember the file in case it is copied to the restore directory
+	if offset == 0 && f.root.recent != nil {
+		f.root.recent.Add(f.node)
+	}
+
 	if uint64(offset) > f.node.Size {
 		debug.Log("Read(%v): offset is greater than file size: %v > %v",
 			f.node.Name, req.Offset, f.node.Size)
@@ -7,6 +7,7 @@ package fuse
 import (
 	"bytes"
 	"math/rand"
+	"os"
 	"testing"
 	"time"
 
@@ -151,3 +152,34 @@ func TestFuseFile(t *testing.T) {
 
 	rtest.OK(t, f.Release(ctx, nil))
 }
+
+func TestFuseOwner(t *testing.T) {
+	node := &restic.Node{
+		Name: "foo",
+		Mode: 0040,
+		UID:  1000,
+		GID:  1001,
+	}
+
+	var tests = []struct {
+		cfg      Config
+		uid, gid uint32
+		mode     os.FileMode
+	}{
+		{Config{}, 1000, 1001, 0040},
+		{Config{OwnerIsRoot: true}, 0, 0, 0040},
+		{Config{OverrideOwner: true, UID: 23, GID: 42}, 23, 42, 0440},
+	}
+
+	for _, test := range tests {
+		root := &Root{cfg: test.cfg}
+		f := &file{root: root, node: node}
+
+		attr := fuse.Attr{}
+		rtest.OK(t, f.Attr(context.TODO(), &attr))
+
+		rtest.Equals(t, test.uid, attr.Uid)
+		rtest.Equals(t, test.gid, attr.Gid)
+		rtest.Equals(t, test.mode, attr.Mode)
+	}
+}
@@ -42,10 +42,7 @@ func (d *MetaDir) Attr(ctx context.Context, attr *fuse.Attr) error {
 	attr.Inode = d.inode
 	attr.Mode = os.ModeDir | 0555
 
-	if !d.root.cfg.OwnerIsRoot {
-		attr.Uid = uint32(os.Getuid())
-		attr.Gid = uint32(os.Getgid())
-	}
+	attr.Uid, attr.Gid = d.root.owner(uint32(os.Getuid()), uint32(os.Getgid()))
 	debug.Log("attr: %v", attr)
 	return nil
 }
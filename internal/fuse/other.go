@@ -28,10 +28,7 @@ func (l *other) Attr(ctx context.Context, a *fuse.Attr) error {
 	a.Inode = l.inode
 	a.Mode = l.node.Mode
 
-	if !l.root.cfg.OwnerIsRoot {
-		a.Uid = l.node.UID
-		a.Gid = l.node.GID
-	}
+	a.Uid, a.Gid = l.root.owner(l.node.UID, l.node.GID)
 	a.Atime = l.node.AccessTime
 	a.Ctime = l.node.ChangeTime
 	a.Mtime = l.node.ModTime
@@ -0,0 +1,439 @@
+// +build !openbsd
+// +build !solaris
+// +build !windows
+
+package fuse
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"golang.org/x/net/context"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// stagingPrefix is prepended to the name of a file while it is being copied
+// into the restore directory.
+const stagingPrefix = ".restic-staging-"
+
+// maxRecentFiles is the number of files read from snapshots which are
+// remembered to be restored when they are copied into the restore directory.
+const maxRecentFiles = 1000
+
+// recentFiles remembers the files which have been read from snapshots
+// recently, so that a copy of a file can be replaced by restoring the file
+// with all its metadata. Several files with the same name, e.g. from
+// different snapshots, are remembered.
+type recentFiles struct {
+	m     sync.Mutex
+	nodes map[string][]*restic.Node
+	order []*restic.Node
+}
+
+func newRecentFiles() *recentFiles {
+	return &recentFiles{nodes: make(map[string][]*restic.Node)}
+}
+
+// Add records that node has been read.
+func (r *recentFiles) Add(node *restic.Node) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	for _, n := range r.nodes[node.Name] {
+		if n == node {
+			return
+		}
+	}
+
+	r.nodes[node.Name] = append(r.nodes[node.Name], node)
+	r.order = append(r.order, node)
+
+	if len(r.order) > maxRecentFiles {
+		r.remove(r.order[0])
+		r.order = r.order[1:]
+	}
+}
+
+// remove forgets node.
+func (r *recentFiles) remove(node *restic.Node) {
+	nodes := r.nodes[node.Name]
+	for i, n := range nodes {
+		if n == node {
+			nodes = append(nodes[:i], nodes[i+1:]...)
+			break
+		}
+	}
+
+	if len(nodes) == 0 {
+		delete(r.nodes, node.Name)
+		return
+	}
+	r.nodes[node.Name] = nodes
+}
+
+// Find returns the files with the given name and size which have been read
+// recently, the most recent one first. The content of the files still needs
+// to be compared with the copy.
+func (r *recentFiles) Find(name string, size uint64) []*restic.Node {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	var nodes []*restic.Node
+	list := r.nodes[name]
+	for i := len(list) - 1; i >= 0; i-- {
+		if list[i].Size == size {
+			nodes = append(nodes, list[i])
+		}
+	}
+	return nodes
+}
+
+// sameContent returns true if the file at path contains exactly the data of
+// node. The file is read in chunks of the sizes of the blobs of node, and
+// each chunk is compared with the ID of the blob.
+func sameContent(repo restic.Repository, path string, node *restic.Node) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	var buf []byte
+	for _, id := range node.Content {
+		size, found := repo.LookupBlobSize(id, restic.DataBlob)
+		if !found {
+			return false, nil
+		}
+
+		if cap(buf) < int(size) {
+			buf = make([]byte, size)
+		}
+		buf = buf[:size]
+
+		_, err = io.ReadFull(f, buf)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		if !restic.Hash(buf).Equal(id) {
+			return false, nil
+		}
+	}
+
+	// the copy must not contain any more data
+	n, err := f.Read(make([]byte, 1))
+	if n > 0 {
+		return false, nil
+	}
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ensure that *restoreDir implements these interfaces
+var _ = fs.HandleReadDirAller(&restoreDir{})
+var _ = fs.NodeStringLookuper(&restoreDir{})
+var _ = fs.NodeCreater(&restoreDir{})
+var _ = fs.NodeMkdirer(&restoreDir{})
+
+// restoreDir is a writable directory which corresponds to a directory in the
+// local file system. Files copied into it from a snapshot are restored
+// there, including their metadata.
+type restoreDir struct {
+	root  *Root
+	inode uint64
+	path  string
+}
+
+func newRestoreDir(root *Root, inode uint64, path string) *restoreDir {
+	return &restoreDir{root: root, inode: inode, path: path}
+}
+
+// Attr returns the attributes for the directory.
+func (d *restoreDir) Attr(ctx context.Context, attr *fuse.Attr) error {
+	fi, err := os.Stat(d.path)
+	if err != nil {
+		return err
+	}
+
+	attr.Inode = d.inode
+	attr.Mode = os.ModeDir | 0755
+	attr.Mtime = fi.ModTime()
+	attr.Uid, attr.Gid = d.root.owner(uint32(os.Getuid()), uint32(os.Getgid()))
+	return nil
+}
+
+// ReadDirAll lists the directory in the local file system.
+func (d *restoreDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	entries, err := ioutil.ReadDir(d.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []fuse.Dirent
+	for _, fi := range entries {
+		typ := fuse.DT_File
+		switch {
+		case strings.HasPrefix(fi.Name(), stagingPrefix):
+			continue
+		case fi.IsDir():
+			typ = fuse.DT_Dir
+		case !fi.Mode().IsRegular():
+			continue
+		}
+
+		ret = append(ret, fuse.Dirent{
+			Inode: fs.GenerateDynamicInode(d.inode, fi.Name()),
+			Name:  fi.Name(),
+			Type:  typ,
+		})
+	}
+
+	return ret, nil
+}
+
+// Lookup returns the file or directory name.
+func (d *restoreDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	if strings.HasPrefix(name, stagingPrefix) {
+		return nil, fuse.ENOENT
+	}
+
+	path := filepath.Join(d.path, name)
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil, fuse.ENOENT
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	inode := fs.GenerateDynamicInode(d.inode, name)
+	switch {
+	case fi.IsDir():
+		return newRestoreDir(d.root, inode, path), nil
+	case fi.Mode().IsRegular():
+		return &restoreFile{root: d.root, inode: inode, path: path}, nil
+	}
+
+	return nil, fuse.ENOENT
+}
+
+// Mkdir creates a directory, e.g. when a directory is copied from a
+// snapshot.
+func (d *restoreDir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error) {
+	path := filepath.Join(d.path, req.Name)
+	debug.Log("Mkdir(%v)", path)
+
+	err := os.Mkdir(path, 0700)
+	if err != nil {
+		return nil, err
+	}
+	chown(path, req.Header)
+
+	return newRestoreDir(d.root, fs.GenerateDynamicInode(d.inode, req.Name), path), nil
+}
+
+// Create creates a new file. The data is written to a staging file first.
+func (d *restoreDir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse) (fs.Node, fs.Handle, error) {
+	path := filepath.Join(d.path, req.Name)
+	staging := filepath.Join(d.path, stagingPrefix+req.Name)
+	debug.Log("Create(%v)", path)
+
+	f, err := os.OpenFile(staging, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	node := &restoreFile{root: d.root, inode: fs.GenerateDynamicInode(d.inode, req.Name), path: path, staging: staging}
+	h := &restoreHandle{node: node, f: f, hdr: req.Header}
+	return node, h, nil
+}
+
+// ensure that *restoreFile implements these interfaces
+var _ = fs.NodeOpener(&restoreFile{})
+var _ = fs.NodeSetattrer(&restoreFile{})
+
+// restoreFile is a file within a restore directory.
+type restoreFile struct {
+	root  *Root
+	inode uint64
+	path  string
+
+	m       sync.Mutex
+	staging string
+}
+
+// current returns the path the data of the file is currently stored at.
+func (f *restoreFile) current() string {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if f.staging != "" {
+		return f.staging
+	}
+	return f.path
+}
+
+// Attr returns the attributes of the file in the local file system.
+func (f *restoreFile) Attr(ctx context.Context, attr *fuse.Attr) error {
+	fi, err := os.Stat(f.current())
+	if err != nil {
+		return err
+	}
+
+	attr.Inode = f.inode
+	attr.Mode = fi.Mode()
+	attr.Size = uint64(fi.Size())
+	attr.Mtime = fi.ModTime()
+	attr.Uid, attr.Gid = f.root.owner(uint32(os.Getuid()), uint32(os.Getgid()))
+	return nil
+}
+
+// Setattr handles changes of the size, other attributes are set when the
+// file is restored.
+func (f *restoreFile) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	if req.Valid.Size() {
+		if err := os.Truncate(f.current(), int64(req.Size)); err != nil {
+			return err
+		}
+	}
+
+	return f.Attr(ctx, &resp.Attr)
+}
+
+// Open opens an existing file, which is written to directly.
+func (f *restoreFile) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	flags := int(req.Flags) &^ (os.O_CREATE | os.O_EXCL)
+	file, err := os.OpenFile(f.current(), flags, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &restoreHandle{node: f, f: file, hdr: req.Header}, nil
+}
+
+// ensure that *restoreHandle implements these interfaces
+var _ = fs.HandleReader(&restoreHandle{})
+var _ = fs.HandleWriter(&restoreHandle{})
+var _ = fs.HandleReleaser(&restoreHandle{})
+
+// restoreHandle is an open file within a restore directory.
+type restoreHandle struct {
+	node *restoreFile
+	f    *os.File
+	hdr  fuse.Header
+}
+
+func (h *restoreHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	buf := make([]byte, req.Size)
+	n, err := h.f.ReadAt(buf, req.Offset)
+	if err != nil && n == 0 && errors.Cause(err) != io.EOF {
+		return err
+	}
+	resp.Data = buf[:n]
+	return nil
+}
+
+func (h *restoreHandle) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	n, err := h.f.WriteAt(req.Data, req.Offset)
+	resp.Size = n
+	return err
+}
+
+// Release closes the file. For a new file, the staging file is replaced by
+// restoring the file from the snapshot it has been copied from. If no file
+// read from a snapshot has exactly the same content, the staging file is used
+// as the file.
+func (h *restoreHandle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	fi, err := h.f.Stat()
+	if err != nil {
+		_ = h.f.Close()
+		return err
+	}
+
+	if err = h.f.Close(); err != nil {
+		return err
+	}
+
+	f := h.node
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if f.staging == "" {
+		return nil
+	}
+
+	staging := f.staging
+	f.staging = ""
+
+	// the copy is only replaced when it is proven to contain the data of the
+	// file from the snapshot, another file with the same name and size must
+	// not overwrite the data
+	var node *restic.Node
+	for _, n := range f.root.recent.Find(filepath.Base(f.path), uint64(fi.Size())) {
+		same, err := sameContent(f.root.repo, staging, n)
+		if err != nil {
+			debug.Log("comparing %v with the snapshot failed: %v", f.path, err)
+			break
+		}
+		if same {
+			node = n
+			break
+		}
+	}
+
+	if node == nil {
+		debug.Log("no source found for %v, keeping the copied data", f.path)
+		err = os.Rename(staging, f.path)
+		if err != nil {
+			return err
+		}
+		chown(f.path, h.hdr)
+		return nil
+	}
+
+	debug.Log("restoring %v from the snapshot", f.path)
+	_ = os.Remove(f.path)
+	err = node.CreateAt(ctx, f.path, f.root.repo, restic.NewHardlinkIndex())
+	if err != nil {
+		debug.Log("restoring %v failed: %v", f.path, err)
+
+		// the data has been copied completely, so use it
+		_ = os.Remove(f.path)
+		if err := os.Rename(staging, f.path); err != nil {
+			return err
+		}
+		chown(f.path, h.hdr)
+		return nil
+	}
+
+	chown(f.path, h.hdr)
+	return os.Remove(staging)
+}
+
+// chown makes the user who sent the request the owner of path. This only
+// works when restic runs as root, errors are ignored.
+func chown(path string, hdr fuse.Header) {
+	if os.Getuid() != 0 {
+		return
+	}
+
+	err := os.Lchown(path, int(hdr.Uid), int(hdr.Gid))
+	if err != nil {
+		debug.Log("Lchown(%v) failed: %v", path, err)
+	}
+}
@@ -0,0 +1,111 @@
+// +build !openbsd
+// +build !solaris
+// +build !windows
+
+package fuse
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+
+	"bazil.org/fuse"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func copyToRestoreDir(t testing.TB, d *restoreDir, name string, data []byte) {
+	_, h, err := d.Create(context.TODO(), &fuse.CreateRequest{Name: name}, &fuse.CreateResponse{})
+	rtest.OK(t, err)
+
+	resp := &fuse.WriteResponse{}
+	rtest.OK(t, h.(*restoreHandle).Write(context.TODO(), &fuse.WriteRequest{Data: data}, resp))
+	rtest.Equals(t, len(data), resp.Size)
+
+	rtest.OK(t, h.(*restoreHandle).Release(context.TODO(), &fuse.ReleaseRequest{}))
+}
+
+func loadNodeContent(t testing.TB, repo restic.Repository, node *restic.Node) []byte {
+	var data []byte
+	for _, id := range node.Content {
+		size, found := repo.LookupBlobSize(id, restic.DataBlob)
+		rtest.Assert(t, found, "blob %v not found", id.Str())
+
+		buf := restic.NewBlobBuffer(int(size))
+		n, err := repo.LoadBlob(context.TODO(), restic.DataBlob, id, buf)
+		rtest.OK(t, err)
+		data = append(data, buf[:n]...)
+	}
+	return data
+}
+
+func TestFuseRestoreDir(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	timestamp, err := time.Parse(time.RFC3339, "2017-01-24T10:42:56+01:00")
+	rtest.OK(t, err)
+	restic.TestCreateSnapshot(t, repo, timestamp, 2, 0)
+
+	sn := loadFirstSnapshot(t, repo)
+	tree := loadTree(t, repo, *sn.Tree)
+
+	var node *restic.Node
+	for _, n := range tree.Nodes {
+		if n.Type == "file" && n.Size > 0 {
+			node = n
+			break
+		}
+	}
+	rtest.Assert(t, node != nil, "no file found in snapshot")
+	node.ModTime = timestamp
+	node.AccessTime = timestamp
+
+	target, cleanupTarget := rtest.TempDir(t)
+	defer cleanupTarget()
+
+	root := &Root{repo: repo, recent: newRecentFiles()}
+	d := newRestoreDir(root, 1, target)
+
+	// a copy of a file read from the snapshot is replaced by restoring it
+	root.recent.Add(node)
+	content := loadNodeContent(t, repo, node)
+	copyToRestoreDir(t, d, node.Name, content)
+
+	fi, err := os.Stat(filepath.Join(target, node.Name))
+	rtest.OK(t, err)
+	rtest.Equals(t, int64(node.Size), fi.Size())
+	rtest.Assert(t, fi.ModTime().Equal(node.ModTime), "wrong modification time %v, want %v", fi.ModTime(), node.ModTime)
+
+	// a different file with the same name and size is not replaced
+	other := filepath.Join(target, "sub")
+	rtest.OK(t, os.Mkdir(other, 0700))
+	data := make([]byte, node.Size)
+	copyToRestoreDir(t, newRestoreDir(root, 2, other), node.Name, data)
+
+	buf, err := ioutil.ReadFile(filepath.Join(other, node.Name))
+	rtest.OK(t, err)
+	rtest.Equals(t, data, buf)
+
+	fi, err = os.Stat(filepath.Join(other, node.Name))
+	rtest.OK(t, err)
+	rtest.Assert(t, !fi.ModTime().Equal(node.ModTime), "copied data has been replaced by the file from the snapshot")
+
+	// other data is kept as it is
+	copyToRestoreDir(t, d, "other", []byte("foobar"))
+
+	buf, err = ioutil.ReadFile(filepath.Join(target, "other"))
+	rtest.OK(t, err)
+	rtest.Equals(t, "foobar", string(buf))
+
+	entries, err := d.ReadDirAll(context.TODO())
+	rtest.OK(t, err)
+	rtest.Equals(t, 3, len(entries))
+}
@@ -5,6 +5,7 @@
 package fuse
 
 import (
+	"os"
 	"time"
 
 	"github.com/restic/restic/internal/debug"
@@ -17,11 +18,28 @@ import (
 
 // Config holds settings for the fuse mount.
 type Config struct {
-	OwnerIsRoot      bool
+	OwnerIsRoot bool
+
+	// OverrideOwner shows all files and directories as owned by UID and
+	// GID, which are given read permission for everything.
+	OverrideOwner bool
+	UID, GID      uint32
+
 	Host             string
 	Tags             []restic.TagList
 	Paths            []string
 	SnapshotTemplate string
+
+	// RestoreTarget is the directory in the local file system files copied
+	// to the directory "restore" in the mount are restored to. If empty, the
+	// directory does not exist.
+	RestoreTarget string
+
+	// DiffRoot is the directory in the local file system snapshots are
+	// compared with in the files "<snapshot>.diff". The paths of the snapshot
+	// are interpreted relative to it, so "/" compares the snapshots with the
+	// current state of the backed up files. If empty, the files do not exist.
+	DiffRoot string
 }
 
 // Root is the root node of the fuse mount of a repository.
@@ -31,6 +49,7 @@ type Root struct {
 	inode         uint64
 	snapshots     restic.Snapshots
 	blobSizeCache *BlobSizeCache
+	recent        *recentFiles
 
 	snCount   int
 	lastCheck time.Time
@@ -53,6 +72,7 @@ func NewRoot(ctx context.Context, repo restic.Repository, cfg Config) (*Root, er
 		inode:         rootInode,
 		cfg:           cfg,
 		blobSizeCache: NewBlobSizeCache(ctx, repo.Index()),
+		recent:        newRecentFiles(),
 	}
 
 	entries := map[string]fs.Node{
@@ -62,11 +82,42 @@ func NewRoot(ctx context.Context, repo restic.Repository, cfg Config) (*Root, er
 		"ids":       NewSnapshotsIDSDir(root, fs.GenerateDynamicInode(root.inode, "ids")),
 	}
 
+	if cfg.RestoreTarget != "" {
+		entries["restore"] = newRestoreDir(root, fs.GenerateDynamicInode(root.inode, "restore"), cfg.RestoreTarget)
+	}
+
 	root.MetaDir = NewMetaDir(root, rootInode, entries)
 
 	return root, nil
 }
 
+// owner returns the user and group ID shown for an item owned by uid and gid.
+func (r *Root) owner(uid, gid uint32) (uint32, uint32) {
+	switch {
+	case r.cfg.OwnerIsRoot:
+		return 0, 0
+	case r.cfg.OverrideOwner:
+		return r.cfg.UID, r.cfg.GID
+	}
+	return uid, gid
+}
+
+// mode returns the mode shown for an item. When the owner is overridden, the
+// owner may read all files and list all directories.
+func (r *Root) mode(mode os.FileMode) os.FileMode {
+	if !r.cfg.OverrideOwner {
+		return mode
+	}
+
+	if mode.IsDir() {
+		return mode | 0500
+	}
+	if mode.IsRegular() {
+		return mode | 0400
+	}
+	return mode
+}
+
 // Root is just there to satisfy fs.Root, it returns itself.
 func (r *Root) Root() (fs.Node, error) {
 	debug.Log("Root()")
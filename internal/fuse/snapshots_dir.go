@@ -168,10 +168,7 @@ func (d *SnapshotsDir) Attr(ctx context.Context, attr *fuse.Attr) error {
 	attr.Inode = d.inode
 	attr.Mode = os.ModeDir | 0555
 
-	if !d.root.cfg.OwnerIsRoot {
-		attr.Uid = uint32(os.Getuid())
-		attr.Gid = uint32(os.Getgid())
-	}
+	attr.Uid, attr.Gid = d.root.owner(uint32(os.Getuid()), uint32(os.Getgid()))
 	debug.Log("attr: %v", attr)
 	return nil
 }
@@ -181,10 +178,7 @@ func (d *SnapshotsIDSDir) Attr(ctx context.Context, attr *fuse.Attr) error {
 	attr.Inode = d.inode
 	attr.Mode = os.ModeDir | 0555
 
-	if !d.root.cfg.OwnerIsRoot {
-		attr.Uid = uint32(os.Getuid())
-		attr.Gid = uint32(os.Getgid())
-	}
+	attr.Uid, attr.Gid = d.root.owner(uint32(os.Getuid()), uint32(os.Getgid()))
 	debug.Log("attr: %v", attr)
 	return nil
 }
@@ -194,10 +188,7 @@ func (d *HostsDir) Attr(ctx context.Context, attr *fuse.Attr) error {
 	attr.Inode = d.inode
 	attr.Mode = os.ModeDir | 0555
 
-	if !d.root.cfg.OwnerIsRoot {
-		attr.Uid = uint32(os.Getuid())
-		attr.Gid = uint32(os.Getgid())
-	}
+	attr.Uid, attr.Gid = d.root.owner(uint32(os.Getuid()), uint32(os.Getgid()))
 	debug.Log("attr: %v", attr)
 	return nil
 }
@@ -207,10 +198,7 @@ func (d *TagsDir) Attr(ctx context.Context, attr *fuse.Attr) error {
 	attr.Inode = d.inode
 	attr.Mode = os.ModeDir | 0555
 
-	if !d.root.cfg.OwnerIsRoot {
-		attr.Uid = uint32(os.Getuid())
-		attr.Gid = uint32(os.Getgid())
-	}
+	attr.Uid, attr.Gid = d.root.owner(uint32(os.Getuid()), uint32(os.Getgid()))
 	debug.Log("attr: %v", attr)
 	return nil
 }
@@ -309,6 +297,8 @@ func (d *SnapshotsDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
 		})
 	}
 
+	items = appendDiffFiles(items, d.root, d.inode, d.names)
+
 	// Latest
 	if d.latest != "" {
 		items = append(items, fuse.Dirent{
@@ -351,6 +341,8 @@ func (d *SnapshotsIDSDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error)
 		})
 	}
 
+	items = appendDiffFiles(items, d.root, d.inode, d.names)
+
 	return items, nil
 }
 
@@ -437,10 +429,7 @@ func (l *snapshotLink) Attr(ctx context.Context, a *fuse.Attr) error {
 	a.Inode = l.inode
 	a.Mode = os.ModeSymlink | 0777
 
-	if !l.root.cfg.OwnerIsRoot {
-		a.Uid = uint32(os.Getuid())
-		a.Gid = uint32(os.Getgid())
-	}
+	a.Uid, a.Gid = l.root.owner(uint32(os.Getuid()), uint32(os.Getgid()))
 	a.Atime = l.snapshot.Time
 	a.Ctime = l.snapshot.Time
 	a.Mtime = l.snapshot.Time
@@ -467,6 +456,10 @@ func (d *SnapshotsDir) Lookup(ctx context.Context, name string) (fs.Node, error)
 			return newDirFromSnapshot(ctx, d.root, fs.GenerateDynamicInode(d.inode, name), sn)
 		}
 
+		if f := lookupDiffFile(d.root, d.inode, d.names, name); f != nil {
+			return f, nil
+		}
+
 		if name == "latest" && d.latest != "" {
 			sn, ok := d.names[d.latest]
 
@@ -500,6 +493,10 @@ func (d *SnapshotsIDSDir) Lookup(ctx context.Context, name string) (fs.Node, err
 			return newDirFromSnapshot(ctx, d.root, fs.GenerateDynamicInode(d.inode, name), sn)
 		}
 
+		if f := lookupDiffFile(d.root, d.inode, d.names, name); f != nil {
+			return f, nil
+		}
+
 		return nil, fuse.ENOENT
 	}
 
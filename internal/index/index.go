@@ -37,7 +37,7 @@ func newIndex() *Index {
 
 // New creates a new index for repo from scratch. InvalidFiles contains all IDs
 // of files  that cannot be listed successfully.
-func New(ctx context.Context, repo restic.Repository, ignorePacks restic.IDSet, p *restic.Progress) (idx *Index, invalidFiles restic.IDs, err error) {
+func New(ctx context.Context, repo list.Lister, ignorePacks restic.IDSet, p *restic.Progress) (idx *Index, invalidFiles restic.IDs, err error) {
 	p.Start()
 	defer p.Done()
 
@@ -82,6 +82,8 @@ type blobJSON struct {
 	Type   restic.BlobType `json:"type"`
 	Offset uint            `json:"offset"`
 	Length uint            `json:"length"`
+
+	UncompressedLength uint `json:"uncompressed_length,omitempty"`
 }
 
 type indexJSON struct {
@@ -137,6 +139,8 @@ func Load(ctx context.Context, repo restic.Repository, p *restic.Progress) (*Ind
 					Type:   blob.Type,
 					Offset: blob.Offset,
 					Length: blob.Length,
+
+					UncompressedLength: blob.UncompressedLength,
 				}
 				entries = append(entries, entry)
 			}
@@ -257,15 +261,19 @@ func (idx *Index) FindBlob(h restic.BlobHandle) (result []Location, err error) {
 	return result, nil
 }
 
-const maxEntries = 3000
+const (
+	maxEntries = 3000
+	maxBlobs   = 50000
+)
 
-// Save writes the complete index to the repo.
+// Save writes the complete index to the repo. The index is split into several
+// files, each holding at most maxEntries packs and about maxBlobs blobs.
 func (idx *Index) Save(ctx context.Context, repo restic.Repository, supersedes restic.IDs) (restic.IDs, error) {
 	debug.Log("pack files: %d\n", len(idx.Packs))
 
 	var indexIDs []restic.ID
 
-	packs := 0
+	packs, blobs := 0, 0
 	jsonIDX := &indexJSON{
 		Supersedes: supersedes,
 		Packs:      make([]packJSON, 0, maxEntries),
@@ -280,6 +288,8 @@ func (idx *Index) Save(ctx context.Context, repo restic.Repository, supersedes r
 				Type:   blob.Type,
 				Offset: blob.Offset,
 				Length: blob.Length,
+
+				UncompressedLength: blob.UncompressedLength,
 			})
 		}
 
@@ -291,7 +301,8 @@ func (idx *Index) Save(ctx context.Context, repo restic.Repository, supersedes r
 		jsonIDX.Packs = append(jsonIDX.Packs, p)
 
 		packs++
-		if packs == maxEntries {
+		blobs += len(b)
+		if packs == maxEntries || blobs >= maxBlobs {
 			id, err := repo.SaveJSONUnpacked(ctx, restic.IndexFile, jsonIDX)
 			if err != nil {
 				return nil, err
@@ -299,7 +310,7 @@ func (idx *Index) Save(ctx context.Context, repo restic.Repository, supersedes r
 			debug.Log("saved new index as %v", id)
 
 			indexIDs = append(indexIDs, id)
-			packs = 0
+			packs, blobs = 0, 0
 			jsonIDX.Packs = jsonIDX.Packs[:0]
 		}
 	}
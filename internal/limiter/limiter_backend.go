@@ -40,6 +40,12 @@ func (l limitedRewindReader) Read(b []byte) (int, error) {
 	return l.limited.Read(b)
 }
 
+// Unlimited returns the underlying reader, which is not rate limited. It is
+// used by backends which need to hash the data before uploading it.
+func (l limitedRewindReader) Unlimited() restic.RewindReader {
+	return l.RewindReader
+}
+
 func (r rateLimitedBackend) Load(ctx context.Context, h restic.Handle, length int, offset int64, consumer func(rd io.Reader) error) error {
 	return r.Backend.Load(ctx, h, length, offset, func(rd io.Reader) error {
 		lrd := limitedReadCloser{
@@ -65,4 +71,26 @@ func (l limitedReadCloser) Close() error {
 	return l.original.Close()
 }
 
+// Rename moves a file to another handle in the wrapped backend. If it does
+// not implement restic.Renamer, restic.ErrRenameUnsupported is returned.
+func (r rateLimitedBackend) Rename(ctx context.Context, from, to restic.Handle) error {
+	rn, ok := r.Backend.(restic.Renamer)
+	if !ok {
+		return restic.ErrRenameUnsupported
+	}
+
+	return rn.Rename(ctx, from, to)
+}
+
+// ListVersion returns the list version reported by the wrapped backend. If it
+// does not implement restic.ListVersioner, the empty string is returned.
+func (r rateLimitedBackend) ListVersion(ctx context.Context, t restic.FileType) (string, error) {
+	lv, ok := r.Backend.(restic.ListVersioner)
+	if !ok {
+		return "", nil
+	}
+
+	return lv.ListVersion(ctx, t)
+}
+
 var _ restic.Backend = (*rateLimitedBackend)(nil)
@@ -0,0 +1,179 @@
+package limiter
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/ratelimit"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// Window is a time of day range with its own rate limit. A window which ends
+// before it starts spans midnight.
+type Window struct {
+	// Start and End are the minutes since midnight.
+	Start, End int
+	// Kb is the rate in KiB/s, zero means unlimited.
+	Kb int
+}
+
+// contains returns true if the minute of the day m is within the window.
+func (w Window) contains(m int) bool {
+	if w.Start <= w.End {
+		return m >= w.Start && m < w.End
+	}
+	return m >= w.Start || m < w.End
+}
+
+func parseTimeOfDay(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, errors.Errorf("invalid time of day %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// ParseSchedule parses a list of windows separated by commas, each of the form
+// "HH:MM-HH:MM=rate" with the rate in KiB/s, e.g. "01:00-06:00=0,12:00-13:00=512".
+func ParseSchedule(s string) ([]Window, error) {
+	var windows []Window
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		eq := strings.Index(item, "=")
+		dash := strings.Index(item, "-")
+		if eq < 0 || dash < 0 || dash > eq {
+			return nil, errors.Errorf("invalid window %q, expected HH:MM-HH:MM=rate", item)
+		}
+
+		start, err := parseTimeOfDay(item[:dash])
+		if err != nil {
+			return nil, err
+		}
+
+		end, err := parseTimeOfDay(item[dash+1 : eq])
+		if err != nil {
+			return nil, err
+		}
+
+		kb, err := strconv.Atoi(item[eq+1:])
+		if err != nil || kb < 0 {
+			return nil, errors.Errorf("invalid rate in window %q", item)
+		}
+
+		windows = append(windows, Window{Start: start, End: end, Kb: kb})
+	}
+
+	return windows, nil
+}
+
+// schedule selects the rate limit for one direction depending on the time of
+// day. The bucket is shared by all readers and replaced when the rate changes.
+type schedule struct {
+	defaultKb int
+	windows   []Window
+
+	m      sync.Mutex
+	kb     int
+	bucket *ratelimit.Bucket
+}
+
+func newSchedule(defaultKb int, windows []Window) *schedule {
+	s := &schedule{defaultKb: defaultKb, windows: windows}
+	s.kb = s.rate(time.Now())
+	s.bucket = newBucket(s.kb)
+	return s
+}
+
+func newBucket(kb int) *ratelimit.Bucket {
+	if kb <= 0 {
+		return nil
+	}
+	return ratelimit.NewBucketWithRate(toByteRate(kb), int64(toByteRate(kb)))
+}
+
+// rate returns the rate in KiB/s at time t. The first window containing t
+// wins, outside of all windows the default rate applies.
+func (s *schedule) rate(t time.Time) int {
+	m := t.Hour()*60 + t.Minute()
+	for _, w := range s.windows {
+		if w.contains(m) {
+			return w.Kb
+		}
+	}
+	return s.defaultKb
+}
+
+// current returns the bucket for the rate at time t, or nil if the rate is
+// unlimited.
+func (s *schedule) current(t time.Time) *ratelimit.Bucket {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if kb := s.rate(t); kb != s.kb {
+		debug.Log("rate limit changed from %d to %d KiB/s", s.kb, kb)
+		s.kb = kb
+		s.bucket = newBucket(kb)
+	}
+
+	return s.bucket
+}
+
+// scheduledReader limits reading from the underlying reader to the rate
+// currently selected by the schedule.
+type scheduledReader struct {
+	r io.Reader
+	s *schedule
+}
+
+func (sr scheduledReader) Read(p []byte) (int, error) {
+	n, err := sr.r.Read(p)
+	if n <= 0 {
+		return n, err
+	}
+
+	if b := sr.s.current(time.Now()); b != nil {
+		b.Wait(int64(n))
+	}
+	return n, err
+}
+
+type scheduledLimiter struct {
+	upstream   *schedule
+	downstream *schedule
+}
+
+// NewScheduledLimiter constructs a Limiter with upload and download rate caps
+// which depend on the time of day. Within a window, the rate of the window is
+// used, otherwise uploadKb and downloadKb apply. The current time is
+// evaluated continuously, so long-running operations switch rates when a
+// window starts or ends.
+func NewScheduledLimiter(uploadKb, downloadKb int, uploadWindows, downloadWindows []Window) Limiter {
+	return scheduledLimiter{
+		upstream:   newSchedule(uploadKb, uploadWindows),
+		downstream: newSchedule(downloadKb, downloadWindows),
+	}
+}
+
+func (l scheduledLimiter) Upstream(r io.Reader) io.Reader {
+	return scheduledReader{r: r, s: l.upstream}
+}
+
+func (l scheduledLimiter) Downstream(r io.Reader) io.Reader {
+	return scheduledReader{r: r, s: l.downstream}
+}
+
+// Transport returns an HTTP transport limited with the limiter l.
+func (l scheduledLimiter) Transport(rt http.RoundTripper) http.RoundTripper {
+	return roundTripper(func(req *http.Request) (*http.Response, error) {
+		return limitRoundTrip(l, rt, req)
+	})
+}
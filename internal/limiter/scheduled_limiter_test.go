@@ -0,0 +1,58 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseSchedule(t *testing.T) {
+	windows, err := ParseSchedule("01:00-06:00=0, 22:30-00:15=512")
+	rtest.OK(t, err)
+	rtest.Equals(t, []Window{
+		{Start: 60, End: 360, Kb: 0},
+		{Start: 22*60 + 30, End: 15, Kb: 512},
+	}, windows)
+
+	for _, s := range []string{"01:00=0", "01:00-06:00", "1-6=0", "01:00-06:00=x", "01:00-06:00=-1", "25:00-06:00=0"} {
+		_, err := ParseSchedule(s)
+		rtest.Assert(t, err != nil, "expected error for schedule %q", s)
+	}
+}
+
+func TestScheduleRate(t *testing.T) {
+	windows, err := ParseSchedule("01:00-06:00=0,22:30-00:15=512")
+	rtest.OK(t, err)
+
+	s := newSchedule(2048, windows)
+
+	var tests = []struct {
+		time string
+		kb   int
+	}{
+		{"00:59", 2048},
+		{"01:00", 0},
+		{"05:59", 0},
+		{"06:00", 2048},
+		{"12:00", 2048},
+		{"22:29", 2048},
+		{"22:30", 512},
+		{"00:14", 512},
+		{"00:15", 2048},
+	}
+
+	for _, test := range tests {
+		tm, err := time.Parse("15:04", test.time)
+		rtest.OK(t, err)
+
+		if kb := s.rate(tm); kb != test.kb {
+			t.Errorf("rate at %v: want %d, got %d", test.time, test.kb, kb)
+		}
+
+		b := s.current(tm)
+		if (b == nil) != (test.kb == 0) {
+			t.Errorf("bucket at %v: want limited %v, got %v", test.time, test.kb != 0, b != nil)
+		}
+	}
+}
@@ -48,7 +48,9 @@ func (rt roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	return rt(req)
 }
 
-func (l staticLimiter) roundTripper(rt http.RoundTripper, req *http.Request) (*http.Response, error) {
+// limitRoundTrip runs the request with rt and limits the request and response
+// bodies with l.
+func limitRoundTrip(l Limiter, rt http.RoundTripper, req *http.Request) (*http.Response, error) {
 	if req.Body != nil {
 		req.Body = limitedReadCloser{
 			limited:  l.Upstream(req.Body),
@@ -71,7 +73,7 @@ func (l staticLimiter) roundTripper(rt http.RoundTripper, req *http.Request) (*h
 // Transport returns an HTTP transport limited with the limiter l.
 func (l staticLimiter) Transport(rt http.RoundTripper) http.RoundTripper {
 	return roundTripper(func(req *http.Request) (*http.Response, error) {
-		return l.roundTripper(rt, req)
+		return limitRoundTrip(l, rt, req)
 	})
 }
 
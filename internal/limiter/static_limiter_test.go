@@ -0,0 +1,54 @@
+package limiter
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestStaticLimiterUnlimited(t *testing.T) {
+	l := NewStaticLimiter(0, 0)
+	rd := bytes.NewReader(nil)
+
+	rtest.Assert(t, l.Upstream(rd) == io.Reader(rd), "upload is limited")
+	rtest.Assert(t, l.Downstream(rd) == io.Reader(rd), "download is limited")
+}
+
+func TestStaticLimiterRate(t *testing.T) {
+	// the bucket holds the data for one second, the remaining half second
+	// needs to be waited for
+	l := NewStaticLimiter(64, 0)
+	data := rtest.Random(23, 96*1024)
+
+	start := time.Now()
+	buf, err := ioutil.ReadAll(l.Upstream(bytes.NewReader(data)))
+	rtest.OK(t, err)
+	rtest.Assert(t, bytes.Equal(data, buf), "wrong data read")
+
+	if d := time.Since(start); d < 300*time.Millisecond {
+		t.Errorf("reading 96 KiB at 64 KiB/s took only %v", d)
+	}
+}
+
+func TestLimitBackend(t *testing.T) {
+	be := LimitBackend(mem.New(), NewStaticLimiter(1024, 1024))
+	data := rtest.Random(23, 100*1024)
+	h := restic.Handle{Type: restic.DataFile, Name: restic.Hash(data).String()}
+
+	rtest.OK(t, be.Save(context.TODO(), h, restic.NewByteReader(data)))
+
+	rtest.OK(t, be.Load(context.TODO(), h, 0, 0, func(rd io.Reader) error {
+		buf, err := ioutil.ReadAll(rd)
+		if err == nil && !bytes.Equal(data, buf) {
+			t.Errorf("wrong data loaded")
+		}
+		return err
+	}))
+}
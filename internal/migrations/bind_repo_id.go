@@ -0,0 +1,331 @@
+package migrations
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+)
+
+func init() {
+	register(&BindRepoID{})
+}
+
+// BindRepoID upgrades a repository to version 2, in which all blobs and files
+// are bound to the repository ID. All pack files, indexes and snapshots are
+// rewritten for this.
+type BindRepoID struct{}
+
+// Check tests whether the migration can be applied.
+func (m *BindRepoID) Check(ctx context.Context, repo restic.Repository) (bool, error) {
+	if _, ok := repo.(*repository.Repository); !ok {
+		debug.Log("repository type %T is not supported", repo)
+		return false, nil
+	}
+
+	if repo.Config().BindsData() {
+		debug.Log("repository version is already %d", repo.Config().Version)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// rewriteFiles saves all files of type t again and removes the old files. The
+// IDs of the files change, so this must only be used for files which are not
+// referenced elsewhere.
+func (m *BindRepoID) rewriteFiles(ctx context.Context, repo *repository.Repository, t restic.FileType) error {
+	var ids restic.IDs
+	err := repo.List(ctx, t, func(id restic.ID, size int64) error {
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		buf, err := repo.LoadAndDecrypt(ctx, t, id)
+		if err != nil {
+			return err
+		}
+
+		newID, err := repo.SaveUnpacked(ctx, t, buf)
+		if err != nil {
+			return err
+		}
+		debug.Log("rewrote %v %v as %v", t, id.Str(), newID.Str())
+
+		err = repo.Backend().Remove(ctx, restic.Handle{Type: t, Name: id.String()})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// snapshotRefs are the fields of a snapshot which contain the IDs of other
+// snapshots.
+var snapshotRefs = []string{"parent", "original"}
+
+// snapshotFile is a snapshot loaded by rewriteSnapshots. The fields are kept
+// as raw JSON, so that fields unknown to this version of restic are preserved.
+type snapshotFile struct {
+	fields map[string]json.RawMessage
+	refs   map[string]restic.ID
+
+	// bound is set for snapshots which have already been rewritten by an
+	// interrupted run of the migration
+	bound bool
+}
+
+// loadSnapshotFile loads the snapshot with the given ID.
+func loadSnapshotFile(ctx context.Context, repo *repository.Repository, id restic.ID) (*snapshotFile, error) {
+	h := restic.Handle{Type: restic.SnapshotFile, Name: id.String()}
+	buf, err := backend.LoadAll(ctx, repo.Backend(), h)
+	if err != nil {
+		return nil, err
+	}
+
+	key := repo.Key()
+	if !restic.Hash(buf).Equal(id) || len(buf) < key.NonceSize() {
+		return nil, errors.Errorf("load %v: invalid data returned", h)
+	}
+
+	sn := &snapshotFile{refs: make(map[string]restic.ID)}
+
+	// rewritten snapshots cannot be opened without additional data
+	nonce, ciphertext := buf[:key.NonceSize()], buf[key.NonceSize():]
+	plaintext, err := key.Open(nil, nonce, ciphertext, nil)
+	if err == crypto.ErrUnauthenticated {
+		sn.bound = true
+		plaintext, err = repo.LoadAndDecrypt(ctx, restic.SnapshotFile, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(plaintext, &sn.fields)
+	if err != nil {
+		return nil, errors.Wrapf(err, "snapshot %v", id.Str())
+	}
+
+	for _, name := range snapshotRefs {
+		raw, ok := sn.fields[name]
+		if !ok || string(raw) == "null" {
+			continue
+		}
+
+		var ref restic.ID
+		err = json.Unmarshal(raw, &ref)
+		if err != nil {
+			return nil, errors.Wrapf(err, "snapshot %v, field %v", id.Str(), name)
+		}
+		sn.refs[name] = ref
+	}
+
+	return sn, nil
+}
+
+// rewriteSnapshots saves all snapshots again and removes the old ones. The
+// IDs of the snapshots change, so the snapshots are rewritten in dependency
+// order and the IDs of their parent and original snapshots are replaced with
+// the new IDs.
+//
+// The old snapshots are removed in reverse order at the end. When the
+// migration is interrupted, the snapshots referenced by the remaining old
+// snapshots therefore still exist, and the snapshots which have already been
+// rewritten are found again by their content.
+func (m *BindRepoID) rewriteSnapshots(ctx context.Context, repo *repository.Repository) error {
+	var ids restic.IDs
+	err := repo.List(ctx, restic.SnapshotFile, func(id restic.ID, size int64) error {
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	snapshots := make(map[restic.ID]*snapshotFile, len(ids))
+	rewritten := make(map[restic.ID]restic.ID)
+	for _, id := range ids {
+		sn, err := loadSnapshotFile(ctx, repo, id)
+		if err != nil {
+			return err
+		}
+		snapshots[id] = sn
+
+		if sn.bound {
+			buf, err := json.Marshal(sn.fields)
+			if err != nil {
+				return err
+			}
+			rewritten[restic.Hash(buf)] = id
+		}
+	}
+
+	// referenced snapshots come first
+	var order restic.IDs
+	visited := restic.NewIDSet()
+	var visit func(id restic.ID)
+	visit = func(id restic.ID) {
+		if visited.Has(id) {
+			return
+		}
+		visited.Insert(id)
+
+		for _, ref := range snapshots[id].refs {
+			if sn, ok := snapshots[ref]; ok && !sn.bound {
+				visit(ref)
+			}
+		}
+		order = append(order, id)
+	}
+
+	for _, id := range ids {
+		if !snapshots[id].bound {
+			visit(id)
+		}
+	}
+
+	newIDs := make(map[restic.ID]restic.ID, len(order))
+	for _, id := range order {
+		sn := snapshots[id]
+		for name, ref := range sn.refs {
+			newID, ok := newIDs[ref]
+			if !ok {
+				continue
+			}
+
+			sn.fields[name], err = json.Marshal(newID)
+			if err != nil {
+				return err
+			}
+		}
+
+		buf, err := json.Marshal(sn.fields)
+		if err != nil {
+			return err
+		}
+
+		if newID, ok := rewritten[restic.Hash(buf)]; ok {
+			debug.Log("snapshot %v has already been rewritten as %v", id.Str(), newID.Str())
+			newIDs[id] = newID
+			continue
+		}
+
+		newID, err := repo.SaveUnpacked(ctx, restic.SnapshotFile, buf)
+		if err != nil {
+			return err
+		}
+		debug.Log("rewrote snapshot %v as %v", id.Str(), newID.Str())
+		newIDs[id] = newID
+	}
+
+	for i := len(order) - 1; i >= 0; i-- {
+		err = repo.Backend().Remove(ctx, restic.Handle{Type: restic.SnapshotFile, Name: order[i].String()})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Apply runs the migration. Until the new config is saved at the very end,
+// the repository contains data with and without additional data, which is
+// accepted by all commands. When the migration is interrupted, it can be run
+// again. The migration itself only accepts data without additional data from
+// the files which exist when it starts.
+func (m *BindRepoID) Apply(ctx context.Context, r restic.Repository) error {
+	repo, ok := r.(*repository.Repository)
+	if !ok {
+		return errors.Errorf("repository type %T is not supported", r)
+	}
+
+	err := repo.LoadIndex(ctx)
+	if err != nil {
+		return err
+	}
+
+	var oldIndexes restic.IDs
+	unbound := restic.NewIDSet()
+	for _, t := range []restic.FileType{restic.IndexFile, restic.SnapshotFile, restic.StatsFile, restic.LockFile} {
+		err = repo.List(ctx, t, func(id restic.ID, size int64) error {
+			if t == restic.IndexFile {
+				oldIndexes = append(oldIndexes, id)
+			}
+			unbound.Insert(id)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	packs := restic.NewIDSet()
+	blobs := restic.NewBlobSet()
+	for pb := range repo.Index().Each(ctx) {
+		packs.Insert(pb.PackID)
+		blobs.Insert(restic.BlobHandle{ID: pb.ID, Type: pb.Type})
+	}
+	unbound.Merge(packs)
+
+	repo.UseAssociatedData(unbound)
+
+	debug.Log("rewrite %d packs with %d blobs", len(packs), len(blobs))
+	obsoletePacks, err := repository.Repack(ctx, repo, packs, blobs, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	// the new index files only contain the new packs
+	err = repo.SaveIndex(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = m.rewriteSnapshots(ctx, repo)
+	if err != nil {
+		return err
+	}
+
+	err = m.rewriteFiles(ctx, repo, restic.StatsFile)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range oldIndexes {
+		err = repo.Backend().Remove(ctx, restic.Handle{Type: restic.IndexFile, Name: id.String()})
+		if err != nil {
+			return err
+		}
+	}
+
+	for id := range obsoletePacks {
+		err = repo.Backend().Remove(ctx, restic.Handle{Type: restic.DataFile, Name: id.String()})
+		if err != nil {
+			return err
+		}
+	}
+
+	cfg := repo.Config()
+	cfg.Version = restic.RepoVersionAssociatedData
+	return repo.SaveConfig(ctx, cfg)
+}
+
+// Name returns the name for this migration.
+func (m *BindRepoID) Name() string {
+	return "bind_repo_id"
+}
+
+// Desc returns a short description what the migration does.
+func (m *BindRepoID) Desc() string {
+	return "bind all data to the repository ID (repository version 2), rewrites all files"
+}
@@ -0,0 +1,81 @@
+package migrations
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// failRemoveBackend fails to remove the n-th snapshot.
+type failRemoveBackend struct {
+	restic.Backend
+	n int
+}
+
+func (be *failRemoveBackend) Remove(ctx context.Context, h restic.Handle) error {
+	if h.Type == restic.SnapshotFile {
+		be.n--
+		if be.n == 0 {
+			return errors.New("injected error")
+		}
+	}
+	return be.Backend.Remove(ctx, h)
+}
+
+func TestBindRepoIDSnapshotRefs(t *testing.T) {
+	be, cleanup := repository.TestBackend(t)
+	defer cleanup()
+
+	fbe := &failRemoveBackend{Backend: be, n: 2}
+	r, _ := repository.TestRepositoryWithBackend(t, fbe)
+	repo := r.(*repository.Repository)
+	ctx := context.TODO()
+
+	tree := restic.NewRandomID()
+	save := func(sn restic.Snapshot) restic.ID {
+		sn.Tree = &tree
+		id, err := repo.SaveJSONUnpacked(ctx, restic.SnapshotFile, sn)
+		rtest.OK(t, err)
+		return id
+	}
+
+	first := time.Unix(1460289341, 0)
+	id1 := save(restic.Snapshot{Time: first})
+	id2 := save(restic.Snapshot{Time: first.Add(time.Hour), Parent: &id1})
+	save(restic.Snapshot{Time: first.Add(2 * time.Hour), Parent: &id2, Original: &id1})
+
+	// the migration is interrupted while removing the old snapshots
+	m := &BindRepoID{}
+	err := m.Apply(ctx, repo)
+	rtest.Assert(t, err != nil, "migration was not interrupted")
+
+	repo = repository.New(be)
+	rtest.OK(t, repo.SearchKey(ctx, rtest.TestPassword, 10))
+	rtest.OK(t, m.Apply(ctx, repo))
+
+	repo = repository.New(be)
+	rtest.OK(t, repo.SearchKey(ctx, rtest.TestPassword, 10))
+	rtest.Equals(t, uint(restic.RepoVersionAssociatedData), repo.Config().Version)
+
+	snapshots, err := restic.LoadAllSnapshots(ctx, repo)
+	rtest.OK(t, err)
+	rtest.Equals(t, 3, len(snapshots))
+
+	ids := make(map[time.Duration]restic.ID)
+	byTime := make(map[time.Duration]*restic.Snapshot)
+	for _, sn := range snapshots {
+		d := sn.Time.Sub(first)
+		ids[d] = *sn.ID()
+		byTime[d] = sn
+	}
+
+	rtest.Assert(t, byTime[0].Parent == nil, "first snapshot has a parent")
+	rtest.Equals(t, ids[0], *byTime[time.Hour].Parent)
+	rtest.Equals(t, ids[time.Hour], *byTime[2*time.Hour].Parent)
+	rtest.Equals(t, ids[0], *byTime[2*time.Hour].Original)
+}
@@ -0,0 +1,57 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+)
+
+func init() {
+	register(&EnableCompression{})
+}
+
+// EnableCompression upgrades a repository from version 2 to version 3, in
+// which new blobs may be compressed. Existing data is not rewritten, it is
+// compressed when it is repacked by prune.
+type EnableCompression struct{}
+
+// Check tests whether the migration can be applied.
+func (m *EnableCompression) Check(ctx context.Context, repo restic.Repository) (bool, error) {
+	if _, ok := repo.(*repository.Repository); !ok {
+		debug.Log("repository type %T is not supported", repo)
+		return false, nil
+	}
+
+	if repo.Config().Version != restic.RepoVersionAssociatedData {
+		debug.Log("repository version is %d, the migration requires version %d",
+			repo.Config().Version, restic.RepoVersionAssociatedData)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Apply runs the migration.
+func (m *EnableCompression) Apply(ctx context.Context, r restic.Repository) error {
+	repo, ok := r.(*repository.Repository)
+	if !ok {
+		return errors.Errorf("repository type %T is not supported", r)
+	}
+
+	cfg := repo.Config()
+	cfg.Version = restic.RepoVersionCompression
+	return repo.SaveConfig(ctx, cfg)
+}
+
+// Name returns the name for this migration.
+func (m *EnableCompression) Name() string {
+	return "enable_compression"
+}
+
+// Desc returns a short description what the migration does.
+func (m *EnableCompression) Desc() string {
+	return "allow compressed blobs (repository version 3), requires version 2"
+}
@@ -64,7 +64,7 @@ func (m *S3Layout) moveFiles(ctx context.Context, be *s3.Backend, l backend.Layo
 		debug.Log("move %v", h)
 
 		return retry(maxErrors, printErr, func() error {
-			return be.Rename(h, l)
+			return be.MoveToLayout(h, l)
 		})
 	})
 
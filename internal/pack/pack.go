@@ -37,10 +37,18 @@ func NewPacker(k *crypto.Key, wr io.Writer) *Packer {
 // Add saves the data read from rd as a new blob to the packer. Returned is the
 // number of bytes written to the pack.
 func (p *Packer) Add(t restic.BlobType, id restic.ID, data []byte) (int, error) {
+	return p.AddCompressed(t, id, data, 0)
+}
+
+// AddCompressed saves data as a new blob to the packer, like Add. The
+// plaintext of the blob was compressed before encryption and has
+// uncompressedLength bytes, which is recorded in the pack header. For blobs
+// which are not compressed, uncompressedLength is zero.
+func (p *Packer) AddCompressed(t restic.BlobType, id restic.ID, data []byte, uncompressedLength uint) (int, error) {
 	p.m.Lock()
 	defer p.m.Unlock()
 
-	c := restic.Blob{Type: t, ID: id}
+	c := restic.Blob{Type: t, ID: id, UncompressedLength: uncompressedLength}
 
 	n, err := p.wr.Write(data)
 	c.Length = uint(n)
@@ -53,6 +61,18 @@ func (p *Packer) Add(t restic.BlobType, id restic.ID, data []byte) (int, error)
 
 var entrySize = uint(binary.Size(restic.BlobType(0)) + binary.Size(uint32(0)) + len(restic.ID{}))
 
+// compressedEntrySize is the size of a header entry for a compressed blob, it
+// additionally contains the uncompressed length.
+var compressedEntrySize = entrySize + uint(binary.Size(uint32(0)))
+
+// header entry types
+const (
+	entryTypeData           = 0
+	entryTypeTree           = 1
+	entryTypeCompressedData = 2
+	entryTypeCompressedTree = 3
+)
+
 // headerEntry is used with encoding/binary to read and write header entries
 type headerEntry struct {
 	Type   uint8
@@ -60,6 +80,15 @@ type headerEntry struct {
 	ID     restic.ID
 }
 
+// compressedHeaderEntry is used with encoding/binary to read and write header
+// entries for compressed blobs.
+type compressedHeaderEntry struct {
+	Type               uint8
+	Length             uint32
+	UncompressedLength uint32
+	ID                 restic.ID
+}
+
 // Finalize writes the header for all added blobs and finalizes the pack.
 // Returned are the number of bytes written, including the header. If the
 // underlying writer implements io.Closer, it is closed.
@@ -94,7 +123,7 @@ func (p *Packer) Finalize() (uint, error) {
 	bytesWritten += uint(hdrBytes)
 
 	// write length
-	err = binary.Write(p.wr, binary.LittleEndian, uint32(restic.CiphertextLength(len(p.blobs)*int(entrySize))))
+	err = binary.Write(p.wr, binary.LittleEndian, uint32(hdrBytes))
 	if err != nil {
 		return 0, errors.Wrap(err, "binary.Write")
 	}
@@ -112,26 +141,40 @@ func (p *Packer) Finalize() (uint, error) {
 // writeHeader constructs and writes the header to wr.
 func (p *Packer) writeHeader(wr io.Writer) (bytesWritten uint, err error) {
 	for _, b := range p.blobs {
-		entry := headerEntry{
-			Length: uint32(b.Length),
-			ID:     b.ID,
-		}
-
+		var tpe uint8
 		switch b.Type {
 		case restic.DataBlob:
-			entry.Type = 0
+			tpe = entryTypeData
 		case restic.TreeBlob:
-			entry.Type = 1
+			tpe = entryTypeTree
 		default:
 			return 0, errors.Errorf("invalid blob type %v", b.Type)
 		}
 
+		var entry interface{}
+		size := entrySize
+		if b.IsCompressed() {
+			entry = compressedHeaderEntry{
+				Type:               tpe + entryTypeCompressedData,
+				Length:             uint32(b.Length),
+				UncompressedLength: uint32(b.UncompressedLength),
+				ID:                 b.ID,
+			}
+			size = compressedEntrySize
+		} else {
+			entry = headerEntry{
+				Type:   tpe,
+				Length: uint32(b.Length),
+				ID:     b.ID,
+			}
+		}
+
 		err := binary.Write(wr, binary.LittleEndian, entry)
 		if err != nil {
 			return bytesWritten, errors.Wrap(err, "binary.Write")
 		}
 
-		bytesWritten += entrySize
+		bytesWritten += size
 	}
 
 	return
@@ -186,8 +229,11 @@ const (
 // readRecords reads up to max records from the underlying ReaderAt, returning
 // the raw header, the total number of records in the header, and any error.
 // If the header contains fewer than max entries, the header is truncated to
-// the appropriate size.
-func readRecords(rd io.ReaderAt, size int64, max int) ([]byte, int, error) {
+// the appropriate size. If compression is set, the header may contain the
+// larger entries for compressed blobs, the number of records is then an upper
+// bound which is always sufficient to read the complete header. Otherwise,
+// the header length must match a whole number of uncompressed entries.
+func readRecords(rd io.ReaderAt, size int64, max int, compression bool) ([]byte, int, error) {
 	var bufsize int
 	bufsize += max * int(entrySize)
 	bufsize += crypto.Extension
@@ -213,7 +259,7 @@ func readRecords(rd io.ReaderAt, size int64, max int) ([]byte, int, error) {
 		err = InvalidFileError{Message: "header length is zero"}
 	case hlen < crypto.Extension:
 		err = InvalidFileError{Message: "header length is too small"}
-	case (hlen-crypto.Extension)%uint32(entrySize) != 0:
+	case !compression && (hlen-crypto.Extension)%uint32(entrySize) != 0:
 		err = InvalidFileError{Message: "header length is invalid"}
 	case int64(hlen) > size-int64(headerLengthSize):
 		err = InvalidFileError{Message: "header is larger than file"}
@@ -224,8 +270,8 @@ func readRecords(rd io.ReaderAt, size int64, max int) ([]byte, int, error) {
 		return nil, 0, errors.Wrap(err, "readHeader")
 	}
 
-	total := (int(hlen) - crypto.Extension) / int(entrySize)
-	if total < max {
+	total := (int(hlen) - crypto.Extension + int(entrySize) - 1) / int(entrySize)
+	if int(hlen) < len(b) {
 		// truncate to the beginning of the pack header
 		b = b[len(b)-int(hlen):]
 	}
@@ -234,8 +280,8 @@ func readRecords(rd io.ReaderAt, size int64, max int) ([]byte, int, error) {
 }
 
 // readHeader reads the header at the end of rd. size is the length of the
-// whole data accessible in rd.
-func readHeader(rd io.ReaderAt, size int64) ([]byte, error) {
+// whole data accessible in rd. compression is passed to readRecords.
+func readHeader(rd io.ReaderAt, size int64, compression bool) ([]byte, error) {
 	debug.Log("size: %v", size)
 	if size < int64(minFileSize) {
 		err := InvalidFileError{Message: "file is too small"}
@@ -246,7 +292,7 @@ func readHeader(rd io.ReaderAt, size int64) ([]byte, error) {
 	// eagerly download eagerEntries header entries as part of header-length request.
 	// only make second request if actual number of entries is greater than eagerEntries
 
-	b, c, err := readRecords(rd, size, eagerEntries)
+	b, c, err := readRecords(rd, size, eagerEntries, compression)
 	if err != nil {
 		return nil, err
 	}
@@ -254,7 +300,7 @@ func readHeader(rd io.ReaderAt, size int64) ([]byte, error) {
 		// eager read sufficed, return what we got
 		return b, nil
 	}
-	b, _, err = readRecords(rd, size, c)
+	b, _, err = readRecords(rd, size, c, compression)
 	if err != nil {
 		return nil, err
 	}
@@ -270,9 +316,11 @@ func (e InvalidFileError) Error() string {
 	return e.Message
 }
 
-// List returns the list of entries found in a pack file.
-func List(k *crypto.Key, rd io.ReaderAt, size int64) (entries []restic.Blob, err error) {
-	buf, err := readHeader(rd, size)
+// List returns the list of entries found in a pack file. Entries for
+// compressed blobs are only accepted if compression is set, which must only
+// be the case for repositories in which blobs may be compressed.
+func List(k *crypto.Key, rd io.ReaderAt, size int64, compression bool) (entries []restic.Blob, err error) {
+	buf, err := readHeader(rd, size, compression)
 	if err != nil {
 		return nil, err
 	}
@@ -292,35 +340,60 @@ func List(k *crypto.Key, rd io.ReaderAt, size int64) (entries []restic.Blob, err
 	entries = make([]restic.Blob, 0, uint(len(buf))/entrySize)
 
 	pos := uint(0)
-	for {
-		e := headerEntry{}
-		err = binary.Read(hdrRd, binary.LittleEndian, &e)
-		if errors.Cause(err) == io.EOF {
-			break
-		}
-
-		if err != nil {
-			return nil, errors.Wrap(err, "binary.Read")
-		}
-
-		entry := restic.Blob{
-			Length: uint(e.Length),
-			ID:     e.ID,
-			Offset: pos,
+	for hdrRd.Len() > 0 {
+		var entry restic.Blob
+		var tpe uint8
+
+		switch buf[len(buf)-hdrRd.Len()] {
+		case entryTypeData, entryTypeTree:
+			e := headerEntry{}
+			err = binary.Read(hdrRd, binary.LittleEndian, &e)
+			if err != nil {
+				return nil, errors.Wrap(err, "binary.Read")
+			}
+
+			tpe = e.Type
+			entry = restic.Blob{
+				Length: uint(e.Length),
+				ID:     e.ID,
+				Offset: pos,
+			}
+		case entryTypeCompressedData, entryTypeCompressedTree:
+			if !compression {
+				return nil, errors.Errorf("compressed blob in a repository without compression")
+			}
+
+			e := compressedHeaderEntry{}
+			err = binary.Read(hdrRd, binary.LittleEndian, &e)
+			if err != nil {
+				return nil, errors.Wrap(err, "binary.Read")
+			}
+
+			if e.UncompressedLength == 0 {
+				return nil, errors.Errorf("invalid uncompressed length for blob %v", e.ID.Str())
+			}
+
+			tpe = e.Type - entryTypeCompressedData
+			entry = restic.Blob{
+				Length:             uint(e.Length),
+				ID:                 e.ID,
+				Offset:             pos,
+				UncompressedLength: uint(e.UncompressedLength),
+			}
+		default:
+			return nil, errors.Errorf("invalid type %d", buf[len(buf)-hdrRd.Len()])
 		}
 
-		switch e.Type {
-		case 0:
+		switch tpe {
+		case entryTypeData:
 			entry.Type = restic.DataBlob
-		case 1:
+		case entryTypeTree:
 			entry.Type = restic.TreeBlob
-		default:
-			return nil, errors.Errorf("invalid type %d", e.Type)
 		}
 
 		entries = append(entries, entry)
 
-		pos += uint(e.Length)
+		pos += entry.Length
 	}
 
 	return entries, nil
@@ -32,7 +32,7 @@ func TestReadHeaderEagerLoad(t *testing.T) {
 
 		rd := &countingReaderAt{delegate: bytes.NewReader(buf.Bytes())}
 
-		header, err := readHeader(rd, int64(buf.Len()))
+		header, err := readHeader(rd, int64(buf.Len()), false)
 		rtest.OK(t, err)
 
 		rtest.Equals(t, expectedHeader, header)
@@ -75,7 +75,7 @@ func TestReadRecords(t *testing.T) {
 
 		rd := bytes.NewReader(buf.Bytes())
 
-		header, count, err := readRecords(rd, int64(rd.Len()), entryCount)
+		header, count, err := readRecords(rd, int64(rd.Len()), entryCount, false)
 		rtest.OK(t, err)
 		rtest.Equals(t, expectedHeader, header)
 		rtest.Equals(t, totalRecords, count)
@@ -108,3 +108,21 @@ func TestReadRecords(t *testing.T) {
 		}
 	}
 }
+
+func TestReadRecordsHeaderLength(t *testing.T) {
+	// the header length is not a multiple of the size of uncompressed entries
+	header := rtest.Random(0, 3*int(compressedEntrySize)+crypto.Extension)
+
+	buf := &bytes.Buffer{}
+	buf.Write(rtest.Random(0, 100))
+	buf.Write(header)
+	_ = binary.Write(buf, binary.LittleEndian, uint32(len(header)))
+	rd := bytes.NewReader(buf.Bytes())
+
+	_, _, err := readRecords(rd, int64(rd.Len()), eagerEntries, false)
+	rtest.Assert(t, err != nil, "invalid header length accepted without compression")
+
+	b, _, err := readRecords(rd, int64(rd.Len()), eagerEntries, true)
+	rtest.OK(t, err)
+	rtest.Equals(t, header, b)
+}
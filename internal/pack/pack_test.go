@@ -63,7 +63,7 @@ func verifyBlobs(t testing.TB, bufs []Buf, k *crypto.Key, rd io.ReaderAt, packSi
 	rtest.Equals(t, uint(written), packSize)
 
 	// read and parse it again
-	entries, err := pack.List(k, rd, int64(packSize))
+	entries, err := pack.List(k, rd, int64(packSize), false)
 	rtest.OK(t, err)
 	rtest.Equals(t, len(entries), len(bufs))
 
@@ -94,6 +94,64 @@ func TestCreatePack(t *testing.T) {
 	verifyBlobs(t, bufs, k, bytes.NewReader(packData), packSize)
 }
 
+func TestCompressedPack(t *testing.T) {
+	k := crypto.NewRandomKey()
+
+	// use more blobs than are read eagerly with the header length
+	var bufs []Buf
+	p := pack.NewPacker(k, nil)
+	for i := 0; i < 40; i++ {
+		b := rtest.Random(i, 100+i*17)
+		id := restic.Hash(b)
+		bufs = append(bufs, Buf{data: b, id: id})
+
+		tpe := restic.DataBlob
+		if i%3 == 0 {
+			tpe = restic.TreeBlob
+		}
+
+		var err error
+		if i%2 == 0 {
+			_, err = p.AddCompressed(tpe, id, b, uint(3*len(b)))
+		} else {
+			_, err = p.Add(tpe, id, b)
+		}
+		rtest.OK(t, err)
+	}
+
+	_, err := p.Finalize()
+	rtest.OK(t, err)
+	packData := p.Writer().(*bytes.Buffer).Bytes()
+
+	// compressed blobs are rejected in repositories without compression
+	_, err = pack.List(k, bytes.NewReader(packData), int64(len(packData)), false)
+	rtest.Assert(t, err != nil, "compressed pack accepted without compression")
+
+	entries, err := pack.List(k, bytes.NewReader(packData), int64(len(packData)), true)
+	rtest.OK(t, err)
+	rtest.Equals(t, len(bufs), len(entries))
+
+	for i, e := range entries {
+		rtest.Equals(t, bufs[i].id, e.ID)
+		rtest.Equals(t, uint(len(bufs[i].data)), e.Length)
+
+		tpe := restic.DataBlob
+		if i%3 == 0 {
+			tpe = restic.TreeBlob
+		}
+		rtest.Equals(t, tpe, e.Type)
+
+		if i%2 == 0 {
+			rtest.Equals(t, uint(3*len(bufs[i].data)), e.UncompressedLength)
+		} else {
+			rtest.Assert(t, !e.IsCompressed(), "blob %d is compressed", i)
+		}
+
+		rtest.Assert(t, bytes.Equal(bufs[i].data, packData[e.Offset:e.Offset+e.Length]),
+			"data for blob %d doesn't match", i)
+	}
+}
+
 var blobTypeJSON = []struct {
 	t   restic.BlobType
 	res string
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"sort"
 
 	"github.com/restic/restic/internal/errors"
 
@@ -34,6 +33,10 @@ type Entry struct {
 	// points to the old node if available, interface{} is used to prevent
 	// circular import
 	Node interface{}
+
+	// Parent points to the node at the same path in the parent snapshot, if
+	// any, even when it cannot be used as Node.
+	Parent interface{}
 }
 
 func (e Entry) Path() string          { return e.path }
@@ -60,18 +63,11 @@ func (e Dir) Result() chan<- Result { return e.result }
 
 // readDirNames reads the directory named by dirname and returns
 // a sorted list of directory entries.
-// taken from filepath/path.go
-func readDirNames(dirname string) ([]string, error) {
-	f, err := fs.Open(dirname)
-	if err != nil {
-		return nil, errors.Wrap(err, "Open")
-	}
-	names, err := f.Readdirnames(-1)
-	_ = f.Close()
+func readDirNames(fsys fs.FS, dirname string) ([]string, error) {
+	names, err := fsys.ReadDirNames(dirname)
 	if err != nil {
 		return nil, errors.Wrap(err, "Readdirnames")
 	}
-	sort.Strings(names)
 	return names, nil
 }
 
@@ -79,7 +75,12 @@ func readDirNames(dirname string) ([]string, error) {
 // dirs). If false is returned, files are ignored and dirs are not even walked.
 type SelectFunc func(item string, fi os.FileInfo) bool
 
-func walk(ctx context.Context, basedir, dir string, selectFunc SelectFunc, jobs chan<- Job, res chan<- Result) (excluded bool) {
+// UnchangedFunc is called for each directory before it is read. When it
+// returns a value other than nil, the directory is not walked. Instead, an
+// Entry for the directory is sent with Node set to the returned value.
+type UnchangedFunc func(relpath, dir string, fi os.FileInfo) interface{}
+
+func walk(ctx context.Context, fsys fs.FS, basedir, dir string, selectFunc SelectFunc, unchanged UnchangedFunc, jobs chan<- Job, res chan<- Result) (excluded bool) {
 	debug.Log("start on %q, basedir %q", dir, basedir)
 
 	relpath, err := filepath.Rel(basedir, dir)
@@ -87,7 +88,7 @@ func walk(ctx context.Context, basedir, dir string, selectFunc SelectFunc, jobs
 		panic(err)
 	}
 
-	info, err := fs.Lstat(dir)
+	info, err := fsys.Lstat(dir)
 	if err != nil {
 		err = errors.Wrap(err, "Lstat")
 		debug.Log("error for %v: %v, res %p", dir, err, res)
@@ -113,8 +114,19 @@ func walk(ctx context.Context, basedir, dir string, selectFunc SelectFunc, jobs
 		return
 	}
 
+	if unchanged != nil {
+		if node := unchanged(relpath, dir, info); node != nil {
+			debug.Log("dir %v is unchanged, sending entry job, res %p", dir, res)
+			select {
+			case jobs <- Entry{info: info, basedir: basedir, path: relpath, result: res, Node: node}:
+			case <-ctx.Done():
+			}
+			return
+		}
+	}
+
 	debug.RunHook("pipe.readdirnames", dir)
-	names, err := readDirNames(dir)
+	names, err := readDirNames(fsys, dir)
 	if err != nil {
 		debug.Log("Readdirnames(%v) returned error: %v, res %p", dir, err, res)
 		select {
@@ -133,7 +145,7 @@ func walk(ctx context.Context, basedir, dir string, selectFunc SelectFunc, jobs
 	for _, name := range names {
 		subpath := filepath.Join(dir, name)
 
-		fi, statErr := fs.Lstat(subpath)
+		fi, statErr := fsys.Lstat(subpath)
 		if !selectFunc(subpath, fi) {
 			debug.Log("file %v excluded by filter", subpath)
 			continue
@@ -157,7 +169,7 @@ func walk(ctx context.Context, basedir, dir string, selectFunc SelectFunc, jobs
 		// between walk and open
 		debug.RunHook("pipe.walk2", filepath.Join(relpath, name))
 
-		walk(ctx, basedir, subpath, selectFunc, jobs, ch)
+		walk(ctx, fsys, basedir, subpath, selectFunc, unchanged, jobs, ch)
 	}
 
 	debug.Log("sending dirjob for %q, basedir %q, res %p", dir, basedir, res)
@@ -172,13 +184,13 @@ func walk(ctx context.Context, basedir, dir string, selectFunc SelectFunc, jobs
 // cleanupPath is used to clean a path. For a normal path, a slice with just
 // the path is returned. For special cases such as "." and "/" the list of
 // names within those paths is returned.
-func cleanupPath(path string) ([]string, error) {
+func cleanupPath(fsys fs.FS, path string) ([]string, error) {
 	path = filepath.Clean(path)
 	if filepath.Dir(path) != path {
 		return []string{path}, nil
 	}
 
-	paths, err := readDirNames(path)
+	paths, err := readDirNames(fsys, path)
 	if err != nil {
 		return nil, err
 	}
@@ -193,10 +205,21 @@ func cleanupPath(path string) ([]string, error) {
 // Walk sends a Job for each file and directory it finds below the paths. When
 // the channel done is closed, processing stops.
 func Walk(ctx context.Context, walkPaths []string, selectFunc SelectFunc, jobs chan<- Job, res chan<- Result) {
+	WalkUnchanged(ctx, walkPaths, selectFunc, nil, jobs, res)
+}
+
+// WalkUnchanged works like Walk, but calls unchanged for each directory to
+// find out whether the directory needs to be walked at all.
+func WalkUnchanged(ctx context.Context, walkPaths []string, selectFunc SelectFunc, unchanged UnchangedFunc, jobs chan<- Job, res chan<- Result) {
+	WalkUnchangedFS(ctx, fs.Local{}, walkPaths, selectFunc, unchanged, jobs, res)
+}
+
+// WalkUnchangedFS works like WalkUnchanged, but reads the paths from fsys.
+func WalkUnchangedFS(ctx context.Context, fsys fs.FS, walkPaths []string, selectFunc SelectFunc, unchanged UnchangedFunc, jobs chan<- Job, res chan<- Result) {
 	var paths []string
 
 	for _, p := range walkPaths {
-		ps, err := cleanupPath(p)
+		ps, err := cleanupPath(fsys, p)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Readdirnames(%v): %v, skipping\n", p, err)
 			debug.Log("Readdirnames(%v) returned error: %v, skipping", p, err)
@@ -216,7 +239,7 @@ func Walk(ctx context.Context, walkPaths []string, selectFunc SelectFunc, jobs c
 	for _, path := range paths {
 		debug.Log("start walker for %v", path)
 		ch := make(chan Result, 1)
-		excluded := walk(ctx, filepath.Dir(path), path, selectFunc, jobs, ch)
+		excluded := walk(ctx, fsys, filepath.Dir(path), path, selectFunc, unchanged, jobs, ch)
 
 		if excluded {
 			debug.Log("walker for %v done, it was excluded by the filter", path)
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"sync"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressionMode selects whether and how hard blobs are compressed before
+// they are encrypted. Compression is only used in repositories which support
+// it, see restic.Config.Compresses.
+type CompressionMode uint
+
+// Compression modes, the default is CompressionAuto.
+const (
+	CompressionAuto CompressionMode = iota
+	CompressionOff
+	CompressionMax
+)
+
+// String returns the name of the compression mode.
+func (m CompressionMode) String() string {
+	switch m {
+	case CompressionAuto:
+		return "auto"
+	case CompressionOff:
+		return "off"
+	case CompressionMax:
+		return "max"
+	}
+	return "invalid"
+}
+
+// ParseCompressionMode returns the compression mode with the given name.
+func ParseCompressionMode(s string) (CompressionMode, error) {
+	switch s {
+	case "auto", "":
+		return CompressionAuto, nil
+	case "off":
+		return CompressionOff, nil
+	case "max":
+		return CompressionMax, nil
+	}
+	return 0, errors.Errorf("unknown compression mode %q, must be auto, off or max", s)
+}
+
+var (
+	encoders    = make(map[CompressionMode]*zstd.Encoder)
+	encodersMu  sync.Mutex
+	decoder     *zstd.Decoder
+	decoderOnce sync.Once
+)
+
+// encoder returns the (shared) zstd encoder for mode. Encoders are safe for
+// concurrent use with EncodeAll.
+func encoder(mode CompressionMode) *zstd.Encoder {
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+
+	if enc, ok := encoders[mode]; ok {
+		return enc
+	}
+
+	level := zstd.SpeedDefault
+	if mode == CompressionMax {
+		level = zstd.SpeedBestCompression
+	}
+
+	// the options cannot fail
+	enc, err := zstd.NewWriter(nil,
+		zstd.WithEncoderLevel(level),
+		zstd.WithEncoderConcurrency(1),
+		zstd.WithEncoderCRC(false),
+		zstd.WithZeroFrames(true))
+	if err != nil {
+		panic(err)
+	}
+
+	encoders[mode] = enc
+	return enc
+}
+
+// compressBlob compresses data with mode and appends the result to buf. The
+// second return value is false if the data is not compressed, either because
+// of mode or because the compressed data would not be smaller.
+func compressBlob(mode CompressionMode, data, buf []byte) ([]byte, bool) {
+	if mode == CompressionOff || len(data) == 0 {
+		return nil, false
+	}
+
+	compressed := encoder(mode).EncodeAll(data, buf[:0])
+	if len(compressed) >= len(data) {
+		return nil, false
+	}
+	return compressed, true
+}
+
+// DecompressBlob returns the content of blob for the decrypted plaintext. For
+// blobs which are not compressed, plaintext is returned unmodified. Otherwise
+// the plaintext is decompressed and appended to buf.
+func DecompressBlob(blob restic.Blob, plaintext, buf []byte) ([]byte, error) {
+	if !blob.IsCompressed() {
+		return plaintext, nil
+	}
+
+	decoderOnce.Do(func() {
+		// the options cannot fail
+		var err error
+		decoder, err = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+		if err != nil {
+			panic(err)
+		}
+	})
+
+	if uint(cap(buf)) < blob.UncompressedLength {
+		buf = make([]byte, 0, blob.UncompressedLength)
+	}
+
+	data, err := decoder.DecodeAll(plaintext, buf[:0])
+	if err != nil {
+		return nil, errors.Errorf("decompressing blob %v failed: %v", blob.ID.Str(), err)
+	}
+
+	if uint(len(data)) != blob.UncompressedLength {
+		return nil, errors.Errorf("decompressing blob %v failed: wrong length, want %d, got %d",
+			blob.ID.Str(), blob.UncompressedLength, len(data))
+	}
+
+	return data, nil
+}
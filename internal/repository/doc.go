@@ -25,4 +25,14 @@
 // contains the ID, type, length and offset for each blob contained in the
 // Pack.
 //
+// Concurrency
+//
+// Several processes may add data to the same repository at the same time, as
+// long as each one holds a non-exclusive lock. Packs and indexes are named by
+// the hash of their content, so concurrent writers never conflict. Within a
+// process, a Repository may be used by several goroutines: blobs are stored in
+// an index which has not been saved yet, and each index is saved exactly once,
+// even if SaveIndex and SaveFullIndex are called concurrently. Operations which
+// remove files from the repository require an exclusive lock.
+//
 package repository
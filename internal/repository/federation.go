@@ -0,0 +1,381 @@
+package repository
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// make sure that *Federation implements restic.Repository
+var _ restic.Repository = &Federation{}
+
+var errFederationReadOnly = errors.New("federated repository is read-only")
+
+// Federation is a read-only repository which combines several repositories,
+// e.g. an archived repository and the one currently in use. Snapshots, trees
+// and data blobs are read from whichever repository contains them, so that
+// commands like ls and restore work transparently across all of them. The
+// first repository is the primary one, its config and key are returned by
+// Config and Key.
+type Federation struct {
+	repos []restic.Repository
+	be    *federatedBackend
+}
+
+// NewFederation returns a federation of repos, which must not be empty.
+func NewFederation(repos ...restic.Repository) *Federation {
+	be := &federatedBackend{}
+	for _, repo := range repos {
+		be.bes = append(be.bes, repo.Backend())
+	}
+
+	return &Federation{repos: repos, be: be}
+}
+
+// repoFor returns the repository which contains the file h. If no repository
+// contains it, the primary repository is returned so that the caller gets
+// the usual error.
+func (f *Federation) repoFor(ctx context.Context, h restic.Handle) (restic.Repository, error) {
+	for _, repo := range f.repos {
+		found, err := repo.Backend().Test(ctx, h)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			return repo, nil
+		}
+	}
+
+	return f.repos[0], nil
+}
+
+// Backend returns a read-only backend which lists the files of all
+// repositories.
+func (f *Federation) Backend() restic.Backend {
+	return f.be
+}
+
+// Key returns the key of the primary repository.
+func (f *Federation) Key() *crypto.Key {
+	return f.repos[0].Key()
+}
+
+// SetIndex is a no-op, the index of a federation always consists of the
+// indexes of the repositories.
+func (f *Federation) SetIndex(restic.Index) {
+	debug.Log("ignoring SetIndex for federated repository")
+}
+
+// Index returns an index which contains the blobs of all repositories.
+func (f *Federation) Index() restic.Index {
+	idx := make(federatedIndex, 0, len(f.repos))
+	for _, repo := range f.repos {
+		idx = append(idx, repo.Index())
+	}
+	return idx
+}
+
+// SaveFullIndex returns an error, a federation is read-only.
+func (f *Federation) SaveFullIndex(context.Context) error {
+	return errFederationReadOnly
+}
+
+// SaveIndex returns an error, a federation is read-only.
+func (f *Federation) SaveIndex(context.Context) error {
+	return errFederationReadOnly
+}
+
+// LoadIndex loads the indexes of all repositories.
+func (f *Federation) LoadIndex(ctx context.Context) error {
+	for _, repo := range f.repos {
+		if err := repo.LoadIndex(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Config returns the config of the primary repository.
+func (f *Federation) Config() restic.Config {
+	return f.repos[0].Config()
+}
+
+// LookupBlobSize returns the size of the blob from the first repository
+// which contains it.
+func (f *Federation) LookupBlobSize(id restic.ID, tpe restic.BlobType) (uint, bool) {
+	for _, repo := range f.repos {
+		if size, found := repo.LookupBlobSize(id, tpe); found {
+			return size, true
+		}
+	}
+	return 0, false
+}
+
+// List calls fn for each file of type t in any of the repositories. Files
+// stored in several repositories are only listed once.
+func (f *Federation) List(ctx context.Context, t restic.FileType, fn func(restic.ID, int64) error) error {
+	seen := restic.NewIDSet()
+	for _, repo := range f.repos {
+		err := repo.List(ctx, t, func(id restic.ID, size int64) error {
+			if seen.Has(id) {
+				return nil
+			}
+			seen.Insert(id)
+			return fn(id, size)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListPack returns the blobs in the pack id from the repository which
+// contains the pack.
+func (f *Federation) ListPack(ctx context.Context, id restic.ID, size int64) ([]restic.Blob, int64, error) {
+	repo, err := f.repoFor(ctx, restic.Handle{Type: restic.DataFile, Name: id.String()})
+	if err != nil {
+		return nil, 0, err
+	}
+	return repo.ListPack(ctx, id, size)
+}
+
+// Flush returns an error, a federation is read-only.
+func (f *Federation) Flush(context.Context) error {
+	return errFederationReadOnly
+}
+
+// SaveUnpacked returns an error, a federation is read-only.
+func (f *Federation) SaveUnpacked(context.Context, restic.FileType, []byte) (restic.ID, error) {
+	return restic.ID{}, errFederationReadOnly
+}
+
+// SaveJSONUnpacked returns an error, a federation is read-only.
+func (f *Federation) SaveJSONUnpacked(context.Context, restic.FileType, interface{}) (restic.ID, error) {
+	return restic.ID{}, errFederationReadOnly
+}
+
+// LoadJSONUnpacked decrypts the file from the repository which contains it
+// and decodes the JSON.
+func (f *Federation) LoadJSONUnpacked(ctx context.Context, t restic.FileType, id restic.ID, item interface{}) error {
+	repo, err := f.repoFor(ctx, restic.Handle{Type: t, Name: id.String()})
+	if err != nil {
+		return err
+	}
+	return repo.LoadJSONUnpacked(ctx, t, id, item)
+}
+
+// LoadAndDecrypt loads and decrypts the file from the repository which
+// contains it.
+func (f *Federation) LoadAndDecrypt(ctx context.Context, t restic.FileType, id restic.ID) ([]byte, error) {
+	repo, err := f.repoFor(ctx, restic.Handle{Type: t, Name: id.String()})
+	if err != nil {
+		return nil, err
+	}
+	return repo.LoadAndDecrypt(ctx, t, id)
+}
+
+// LoadBlob loads the blob from the first repository which contains it. When
+// loading fails, the other repositories containing the blob are tried.
+func (f *Federation) LoadBlob(ctx context.Context, t restic.BlobType, id restic.ID, buf []byte) (int, error) {
+	err := errors.Errorf("id %v not found in repository", id)
+	for _, repo := range f.repos {
+		if !repo.Index().Has(id, t) {
+			continue
+		}
+
+		var n int
+		n, err = repo.LoadBlob(ctx, t, id, buf)
+		if err == nil {
+			return n, nil
+		}
+		debug.Log("loading blob %v from %v failed: %v", id, repo.Backend().Location(), err)
+	}
+	return 0, err
+}
+
+// LoadTree loads the tree from the first repository which contains it.
+func (f *Federation) LoadTree(ctx context.Context, id restic.ID) (*restic.Tree, error) {
+	err := errors.Errorf("tree %v not found in repository", id)
+	for _, repo := range f.repos {
+		if !repo.Index().Has(id, restic.TreeBlob) {
+			continue
+		}
+
+		var tree *restic.Tree
+		tree, err = repo.LoadTree(ctx, id)
+		if err == nil {
+			return tree, nil
+		}
+		debug.Log("loading tree %v from %v failed: %v", id, repo.Backend().Location(), err)
+	}
+	return nil, err
+}
+
+// SaveBlob returns an error, a federation is read-only.
+func (f *Federation) SaveBlob(context.Context, restic.BlobType, []byte, restic.ID) (restic.ID, error) {
+	return restic.ID{}, errFederationReadOnly
+}
+
+// SaveTree returns an error, a federation is read-only.
+func (f *Federation) SaveTree(context.Context, *restic.Tree) (restic.ID, error) {
+	return restic.ID{}, errFederationReadOnly
+}
+
+// federatedIndex combines the indexes of several repositories.
+type federatedIndex []restic.Index
+
+// Has returns true if any of the indexes contains the blob.
+func (idx federatedIndex) Has(id restic.ID, tpe restic.BlobType) bool {
+	for _, i := range idx {
+		if i.Has(id, tpe) {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup returns the locations of the blob in all indexes.
+func (idx federatedIndex) Lookup(id restic.ID, tpe restic.BlobType) (blobs []restic.PackedBlob, found bool) {
+	for _, i := range idx {
+		if pbs, ok := i.Lookup(id, tpe); ok {
+			blobs = append(blobs, pbs...)
+			found = true
+		}
+	}
+	return blobs, found
+}
+
+// Count returns the number of blobs of type t in all indexes.
+func (idx federatedIndex) Count(t restic.BlobType) (n uint) {
+	for _, i := range idx {
+		n += i.Count(t)
+	}
+	return n
+}
+
+// Each returns a channel which yields the blobs of all indexes.
+func (idx federatedIndex) Each(ctx context.Context) <-chan restic.PackedBlob {
+	ch := make(chan restic.PackedBlob)
+	go func() {
+		defer close(ch)
+		for _, i := range idx {
+			for pb := range i.Each(ctx) {
+				select {
+				case <-ctx.Done():
+					return
+				case ch <- pb:
+				}
+			}
+		}
+	}()
+	return ch
+}
+
+// federatedBackend is a read-only backend which combines the backends of
+// the repositories of a federation.
+type federatedBackend struct {
+	bes []restic.Backend
+}
+
+// backendFor returns the first backend which contains the file h, or the
+// first backend if none does.
+func (be *federatedBackend) backendFor(ctx context.Context, h restic.Handle) (restic.Backend, error) {
+	for _, b := range be.bes {
+		found, err := b.Test(ctx, h)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			return b, nil
+		}
+	}
+	return be.bes[0], nil
+}
+
+func (be *federatedBackend) Location() string {
+	locations := make([]string, 0, len(be.bes))
+	for _, b := range be.bes {
+		locations = append(locations, b.Location())
+	}
+	return strings.Join(locations, ", ")
+}
+
+func (be *federatedBackend) Test(ctx context.Context, h restic.Handle) (bool, error) {
+	for _, b := range be.bes {
+		found, err := b.Test(ctx, h)
+		if err != nil || found {
+			return found, err
+		}
+	}
+	return false, nil
+}
+
+func (be *federatedBackend) Remove(ctx context.Context, h restic.Handle) error {
+	return errFederationReadOnly
+}
+
+func (be *federatedBackend) Close() error {
+	var firstErr error
+	for _, b := range be.bes {
+		if err := b.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (be *federatedBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	return errFederationReadOnly
+}
+
+func (be *federatedBackend) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	b, err := be.backendFor(ctx, h)
+	if err != nil {
+		return err
+	}
+	return b.Load(ctx, h, length, offset, fn)
+}
+
+func (be *federatedBackend) Stat(ctx context.Context, h restic.Handle) (restic.FileInfo, error) {
+	b, err := be.backendFor(ctx, h)
+	if err != nil {
+		return restic.FileInfo{}, err
+	}
+	return b.Stat(ctx, h)
+}
+
+func (be *federatedBackend) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
+	seen := make(map[string]struct{})
+	for _, b := range be.bes {
+		err := b.List(ctx, t, func(fi restic.FileInfo) error {
+			if _, ok := seen[fi.Name]; ok {
+				return nil
+			}
+			seen[fi.Name] = struct{}{}
+			return fn(fi)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (be *federatedBackend) IsNotExist(err error) bool {
+	for _, b := range be.bes {
+		if b.IsNotExist(err) {
+			return true
+		}
+	}
+	return false
+}
+
+func (be *federatedBackend) Delete(ctx context.Context) error {
+	return errFederationReadOnly
+}
@@ -0,0 +1,65 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestFederation(t *testing.T) {
+	archived, cleanup := repository.TestRepository(t)
+	defer cleanup()
+	current, cleanup2 := repository.TestRepository(t)
+	defer cleanup2()
+
+	sn1 := restic.TestCreateSnapshot(t, archived, time.Unix(1460289341, 207401672), 2, 0)
+	sn2 := restic.TestCreateSnapshot(t, current, time.Unix(1460289342, 207401672), 2, 0)
+
+	fed := repository.NewFederation(current, archived)
+	rtest.OK(t, fed.LoadIndex(context.TODO()))
+
+	var snapshots restic.IDs
+	rtest.OK(t, fed.List(context.TODO(), restic.SnapshotFile, func(id restic.ID, size int64) error {
+		snapshots = append(snapshots, id)
+		return nil
+	}))
+	rtest.Equals(t, 2, len(snapshots))
+
+	for _, sn := range []*restic.Snapshot{sn1, sn2} {
+		id, err := restic.FindSnapshot(fed, sn.ID().String()[:8])
+		rtest.OK(t, err)
+		rtest.Equals(t, *sn.ID(), id)
+
+		loaded, err := restic.LoadSnapshot(context.TODO(), fed, id)
+		rtest.OK(t, err)
+		rtest.Equals(t, *sn.Tree, *loaded.Tree)
+
+		tree, err := fed.LoadTree(context.TODO(), *loaded.Tree)
+		rtest.OK(t, err)
+
+		for _, node := range tree.Nodes {
+			if node.Type != "file" || len(node.Content) == 0 {
+				continue
+			}
+
+			id := node.Content[0]
+			size, found := fed.LookupBlobSize(id, restic.DataBlob)
+			rtest.Assert(t, found, "blob %v not found", id.Str())
+
+			buf := restic.NewBlobBuffer(int(size))
+			n, err := fed.LoadBlob(context.TODO(), restic.DataBlob, id, buf)
+			rtest.OK(t, err)
+			rtest.Equals(t, id, restic.Hash(buf[:n]))
+		}
+	}
+
+	rtest.Equals(t, archived.Index().Count(restic.DataBlob)+current.Index().Count(restic.DataBlob),
+		fed.Index().Count(restic.DataBlob))
+
+	_, err := fed.SaveBlob(context.TODO(), restic.DataBlob, []byte("foo"), restic.ID{})
+	rtest.Assert(t, err != nil, "saving a blob in a federation did not fail")
+}
@@ -29,6 +29,8 @@ type indexEntry struct {
 	packID restic.ID
 	offset uint
 	length uint
+
+	uncompressedLength uint
 }
 
 // NewIndex returns a new index.
@@ -44,6 +46,8 @@ func (idx *Index) store(blob restic.PackedBlob) {
 		packID: blob.PackID,
 		offset: blob.Offset,
 		length: blob.Length,
+
+		uncompressedLength: blob.UncompressedLength,
 	}
 	h := restic.BlobHandle{ID: blob.ID, Type: blob.Type}
 	idx.pack[h] = append(idx.pack[h], newEntry)
@@ -63,6 +67,10 @@ const (
 	indexMaxBlobs = 2000
 	indexMinAge   = 2 * time.Minute
 	indexMaxAge   = 15 * time.Minute
+
+	// indexMaxEntries bounds the size of a single index file. Once an index
+	// holds this many blobs, new blobs are stored in a new index.
+	indexMaxEntries = 50000
 )
 
 // IndexFull returns true iff the index is "full enough" to be saved as a preliminary index.
@@ -75,6 +83,11 @@ var IndexFull = func(idx *Index) bool {
 	packs := len(idx.pack)
 	age := time.Now().Sub(idx.created)
 
+	if packs >= indexMaxEntries {
+		debug.Log("index %p has reached the maximum number of %d entries", idx, packs)
+		return true
+	}
+
 	if age > indexMaxAge {
 		debug.Log("index %p is old enough", idx, age)
 		return true
@@ -94,6 +107,22 @@ var IndexFull = func(idx *Index) bool {
 	return false
 }
 
+// storeIfWritable stores blob in the index if it is not finalized and has not
+// yet reached the maximum number of entries, and reports whether the blob has
+// been stored. Checking and storing is done atomically, so the index cannot
+// be finalized concurrently by another goroutine in between.
+func (idx *Index) storeIfWritable(blob restic.PackedBlob) bool {
+	idx.m.Lock()
+	defer idx.m.Unlock()
+
+	if idx.final || len(idx.pack) >= indexMaxEntries {
+		return false
+	}
+
+	idx.store(blob)
+	return true
+}
+
 // Store remembers the id and pack in the index. An existing entry will be
 // silently overwritten.
 func (idx *Index) Store(blob restic.PackedBlob) {
@@ -126,6 +155,8 @@ func (idx *Index) Lookup(id restic.ID, tpe restic.BlobType) (blobs []restic.Pack
 					Length: p.length,
 					ID:     id,
 					Offset: p.offset,
+
+					UncompressedLength: p.uncompressedLength,
 				},
 				PackID: p.packID,
 			}
@@ -153,6 +184,8 @@ func (idx *Index) ListPack(id restic.ID) (list []restic.PackedBlob) {
 						Type:   h.Type,
 						Length: entry.length,
 						Offset: entry.offset,
+
+						UncompressedLength: entry.uncompressedLength,
 					},
 					PackID: entry.packID,
 				})
@@ -182,7 +215,7 @@ func (idx *Index) LookupSize(id restic.ID, tpe restic.BlobType) (plaintextLength
 		return 0, found
 	}
 
-	return uint(restic.PlaintextLength(int(blobs[0].Length))), true
+	return blobs[0].DataLength(), true
 }
 
 // Supersedes returns the list of indexes this index supersedes, if any.
@@ -229,6 +262,8 @@ func (idx *Index) Each(ctx context.Context) <-chan restic.PackedBlob {
 						Type:   h.Type,
 						Offset: blob.offset,
 						Length: blob.length,
+
+						UncompressedLength: blob.uncompressedLength,
 					},
 					PackID: blob.packID,
 				}:
@@ -282,6 +317,8 @@ type blobJSON struct {
 	Type   restic.BlobType `json:"type"`
 	Offset uint            `json:"offset"`
 	Length uint            `json:"length"`
+
+	UncompressedLength uint `json:"uncompressed_length,omitempty"`
 }
 
 // generatePackList returns a list of packs.
@@ -320,6 +357,8 @@ func (idx *Index) generatePackList() ([]*packJSON, error) {
 				Type:   h.Type,
 				Offset: blob.offset,
 				Length: blob.length,
+
+				UncompressedLength: blob.uncompressedLength,
 			})
 		}
 	}
@@ -481,6 +520,8 @@ func DecodeIndex(buf []byte) (idx *Index, err error) {
 					ID:     blob.ID,
 					Offset: blob.Offset,
 					Length: blob.Length,
+
+					UncompressedLength: blob.UncompressedLength,
 				},
 				PackID: pack.ID,
 			})
@@ -526,6 +567,8 @@ func DecodeOldIndex(buf []byte) (idx *Index, err error) {
 					ID:     blob.ID,
 					Offset: blob.Offset,
 					Length: blob.Length,
+
+					UncompressedLength: blob.UncompressedLength,
 				},
 				PackID: pack.ID,
 			})
@@ -113,14 +113,15 @@ func (mi *MasterIndex) Remove(index *Index) {
 	}
 }
 
-// Store remembers the id and pack in the index.
+// Store remembers the id and pack in the index. When all indexes which have
+// not been saved yet are full, a new index is started, so that the size of a
+// single index file stays bounded.
 func (mi *MasterIndex) Store(pb restic.PackedBlob) {
 	mi.idxMutex.Lock()
 	defer mi.idxMutex.Unlock()
 
 	for _, idx := range mi.idx {
-		if !idx.Final() {
-			idx.Store(pb)
+		if idx.storeIfWritable(pb) {
 			return
 		}
 	}
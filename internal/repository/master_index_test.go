@@ -56,6 +56,36 @@ func TestMasterIndexLookup(t *testing.T) {
 	rtest.Assert(t, blobs == nil, "Expected no blobs when fetching with a random id")
 }
 
+func TestMasterIndexStoreSplit(t *testing.T) {
+	const blobs = 120000
+
+	mIdx := repository.NewMasterIndex()
+	for i := 0; i < blobs; i++ {
+		mIdx.Store(restic.PackedBlob{
+			PackID: restic.NewRandomID(),
+			Blob: restic.Blob{
+				Type:   restic.DataBlob,
+				ID:     restic.NewRandomID(),
+				Length: 10,
+			},
+		})
+	}
+
+	indexes := mIdx.NotFinalIndexes()
+	if len(indexes) < 2 {
+		t.Fatalf("expected blobs to be split into several indexes, got %d", len(indexes))
+	}
+
+	var n uint
+	for _, idx := range indexes {
+		n += idx.Count(restic.DataBlob)
+	}
+	rtest.Equals(t, uint(blobs), n)
+
+	// all indexes except for the last one are full and can be saved
+	rtest.Equals(t, len(indexes)-1, len(mIdx.FullIndexes()))
+}
+
 func BenchmarkMasterIndexLookupSingleIndex(b *testing.B) {
 	idx1, lookupID := createRandomIndex(rand.New(rand.NewSource(0)))
 
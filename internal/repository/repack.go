@@ -3,7 +3,9 @@ package repository
 import (
 	"context"
 	"fmt"
+	"math"
 	"os"
+	"sort"
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/fs"
@@ -13,103 +15,216 @@ import (
 	"github.com/restic/restic/internal/errors"
 )
 
+// repackBatchSize is the number of packs which are loaded together when
+// repacking with a blob order. The blobs within a batch are written sorted by
+// their position in the order.
+const repackBatchSize = 32
+
 // Repack takes a list of packs together with a list of blobs contained in
 // these packs. Each pack is loaded and the blobs listed in keepBlobs is saved
 // into a new pack. Returned is the list of obsolete packs which can then
 // be removed.
-func Repack(ctx context.Context, repo restic.Repository, packs restic.IDSet, keepBlobs restic.BlobSet, p *restic.Progress) (obsoletePacks restic.IDSet, err error) {
+//
+// If order is not nil, packs are processed sorted by the first position of
+// the blobs to keep, and the blobs are saved sorted by their position, so
+// that blobs which are referenced together end up in the same new packs.
+func Repack(ctx context.Context, repo restic.Repository, packs restic.IDSet, keepBlobs restic.BlobSet, order restic.BlobOrder, p *restic.Progress) (obsoletePacks restic.IDSet, err error) {
 	debug.Log("repacking %d packs while keeping %d blobs", len(packs), len(keepBlobs))
 
-	for packID := range packs {
+	for _, batch := range repackBatches(repo, packs, keepBlobs, order) {
+		err = repackBatch(ctx, repo, batch, keepBlobs, order, p)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := repo.Flush(ctx); err != nil {
+		return nil, err
+	}
+
+	return packs, nil
+}
+
+// repackBatches splits packs into the batches which are repacked together.
+// Without an order, each pack is processed on its own.
+func repackBatches(repo restic.Repository, packs restic.IDSet, keepBlobs restic.BlobSet, order restic.BlobOrder) []restic.IDs {
+	if order == nil {
+		batches := make([]restic.IDs, 0, len(packs))
+		for id := range packs {
+			batches = append(batches, restic.IDs{id})
+		}
+		return batches
+	}
+
+	// find the first position of a blob to keep for each pack
+	first := make(map[restic.ID]int, len(packs))
+	for id := range packs {
+		first[id] = math.MaxInt32
+	}
+
+	for h := range keepBlobs {
+		pos, ok := order.Position(h)
+		if !ok {
+			continue
+		}
+
+		list, _ := repo.Index().Lookup(h.ID, h.Type)
+		for _, pb := range list {
+			if p, ok := first[pb.PackID]; ok && pos < p {
+				first[pb.PackID] = pos
+			}
+		}
+	}
+
+	ids := packs.List()
+	sort.SliceStable(ids, func(i, j int) bool {
+		return first[ids[i]] < first[ids[j]]
+	})
+
+	var batches []restic.IDs
+	for len(ids) > 0 {
+		n := repackBatchSize
+		if n > len(ids) {
+			n = len(ids)
+		}
+		batches = append(batches, ids[:n])
+		ids = ids[n:]
+	}
+
+	return batches
+}
+
+// repackEntry is a blob to keep, together with the temp file it is read from.
+type repackEntry struct {
+	file   *os.File
+	packID restic.ID
+	blob   restic.Blob
+}
+
+// repackBatch loads the packs in batch and saves all blobs contained in
+// keepBlobs, sorted by order if it is not nil. Saved blobs are removed from
+// keepBlobs.
+func repackBatch(ctx context.Context, repo restic.Repository, batch restic.IDs, keepBlobs restic.BlobSet, order restic.BlobOrder, p *restic.Progress) (err error) {
+	var tempfiles []*os.File
+	defer func() {
+		for _, f := range tempfiles {
+			cerr := f.Close()
+			if cerr != nil && err == nil {
+				err = errors.Wrap(cerr, "Close")
+			}
+
+			rerr := fs.RemoveIfExists(f.Name())
+			if rerr != nil && err == nil {
+				err = errors.Wrap(rerr, "Remove")
+			}
+		}
+	}()
+
+	var entries []repackEntry
+	for _, packID := range batch {
 		// load the complete pack into a temp file
 		h := restic.Handle{Type: restic.DataFile, Name: packID.String()}
 
 		tempfile, hash, packLength, err := DownloadAndHash(ctx, repo, h)
 		if err != nil {
-			return nil, errors.Wrap(err, "Repack")
+			return errors.Wrap(err, "Repack")
 		}
+		tempfiles = append(tempfiles, tempfile)
 
 		debug.Log("pack %v loaded (%d bytes), hash %v", packID, packLength, hash)
 
 		if !packID.Equal(hash) {
-			return nil, errors.Errorf("hash does not match id: want %v, got %v", packID, hash)
+			return errors.Errorf("hash does not match id: want %v, got %v", packID, hash)
 		}
 
 		_, err = tempfile.Seek(0, 0)
 		if err != nil {
-			return nil, errors.Wrap(err, "Seek")
+			return errors.Wrap(err, "Seek")
 		}
 
-		blobs, err := pack.List(repo.Key(), tempfile, packLength)
+		blobs, err := pack.List(repo.Key(), tempfile, packLength, repo.Config().Compresses())
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		debug.Log("processing pack %v, blobs: %v", packID, len(blobs))
-		var buf []byte
-		for _, entry := range blobs {
-			h := restic.BlobHandle{ID: entry.ID, Type: entry.Type}
-			if !keepBlobs.Has(h) {
-				continue
-			}
-
-			debug.Log("  process blob %v", h)
+		for _, blob := range blobs {
+			entries = append(entries, repackEntry{file: tempfile, packID: packID, blob: blob})
+		}
+	}
 
-			buf = buf[:]
-			if uint(len(buf)) < entry.Length {
-				buf = make([]byte, entry.Length)
+	if order != nil {
+		position := func(e repackEntry) int {
+			pos, ok := order.Position(restic.BlobHandle{ID: e.blob.ID, Type: e.blob.Type})
+			if !ok {
+				return math.MaxInt32
 			}
-			buf = buf[:entry.Length]
+			return pos
+		}
 
-			n, err := tempfile.ReadAt(buf, int64(entry.Offset))
-			if err != nil {
-				return nil, errors.Wrap(err, "ReadAt")
-			}
+		sort.SliceStable(entries, func(i, j int) bool {
+			return position(entries[i]) < position(entries[j])
+		})
+	}
 
-			if n != len(buf) {
-				return nil, errors.Errorf("read blob %v from %v: not enough bytes read, want %v, got %v",
-					h, tempfile.Name(), len(buf), n)
-			}
+	var buf []byte
+	for _, e := range entries {
+		entry := e.blob
+		h := restic.BlobHandle{ID: entry.ID, Type: entry.Type}
+		if !keepBlobs.Has(h) {
+			continue
+		}
 
-			nonce, ciphertext := buf[:repo.Key().NonceSize()], buf[repo.Key().NonceSize():]
-			plaintext, err := repo.Key().Open(ciphertext[:0], nonce, ciphertext, nil)
-			if err != nil {
-				return nil, err
-			}
+		debug.Log("  process blob %v", h)
 
-			id := restic.Hash(plaintext)
-			if !id.Equal(entry.ID) {
-				debug.Log("read blob %v/%v from %v: wrong data returned, hash is %v",
-					h.Type, h.ID, tempfile.Name(), id)
-				fmt.Fprintf(os.Stderr, "read blob %v from %v: wrong data returned, hash is %v",
-					h, tempfile.Name(), id)
-			}
+		buf = buf[:]
+		if uint(len(buf)) < entry.Length {
+			buf = make([]byte, entry.Length)
+		}
+		buf = buf[:entry.Length]
 
-			_, err = repo.SaveBlob(ctx, entry.Type, plaintext, entry.ID)
-			if err != nil {
-				return nil, err
-			}
+		n, err := e.file.ReadAt(buf, int64(entry.Offset))
+		if err != nil {
+			return errors.Wrap(err, "ReadAt")
+		}
 
-			debug.Log("  saved blob %v", entry.ID)
+		if n != len(buf) {
+			return errors.Errorf("read blob %v from %v: not enough bytes read, want %v, got %v",
+				h, e.file.Name(), len(buf), n)
+		}
 
-			keepBlobs.Delete(h)
+		cfg := repo.Config()
+		plaintext, err := cfg.Open(repo.Key(), buf, cfg.BlobAssociatedData(entry.Type, entry.ID), e.packID)
+		if err != nil {
+			return err
 		}
 
-		if err = tempfile.Close(); err != nil {
-			return nil, errors.Wrap(err, "Close")
+		plaintext, err = DecompressBlob(entry, plaintext, nil)
+		if err != nil {
+			return err
 		}
 
-		if err = fs.RemoveIfExists(tempfile.Name()); err != nil {
-			return nil, errors.Wrap(err, "Remove")
+		id := restic.Hash(plaintext)
+		if !id.Equal(entry.ID) {
+			debug.Log("read blob %v/%v from %v: wrong data returned, hash is %v",
+				h.Type, h.ID, e.file.Name(), id)
+			fmt.Fprintf(os.Stderr, "read blob %v from %v: wrong data returned, hash is %v",
+				h, e.file.Name(), id)
 		}
-		if p != nil {
-			p.Report(restic.Stat{Blobs: 1})
+
+		_, err = repo.SaveBlob(ctx, entry.Type, plaintext, entry.ID)
+		if err != nil {
+			return err
 		}
+
+		debug.Log("  saved blob %v", entry.ID)
+
+		keepBlobs.Delete(h)
 	}
 
-	if err := repo.Flush(ctx); err != nil {
-		return nil, err
+	if p != nil {
+		p.Report(restic.Stat{Blobs: uint64(len(batch))})
 	}
 
-	return packs, nil
+	return nil
 }
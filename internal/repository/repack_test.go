@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"math/rand"
+	"sort"
 	"testing"
 
 	"github.com/restic/restic/internal/index"
@@ -136,7 +137,7 @@ func findPacksForBlobs(t *testing.T, repo restic.Repository, blobs restic.BlobSe
 }
 
 func repack(t *testing.T, repo restic.Repository, packs restic.IDSet, blobs restic.BlobSet) {
-	repackedBlobs, err := repository.Repack(context.TODO(), repo, packs, blobs, nil)
+	repackedBlobs, err := repository.Repack(context.TODO(), repo, packs, blobs, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -251,3 +252,80 @@ func TestRepack(t *testing.T) {
 		}
 	}
 }
+
+func TestRepackOrdered(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	seed := rand.Int63()
+	rand.Seed(seed)
+	t.Logf("rand seed is %v", seed)
+
+	// use few enough blobs so that all packs are repacked in a single batch
+	createRandomBlobs(t, repo, 30, 0.7)
+	saveIndex(t, repo)
+
+	keepBlobs, removeBlobs := selectBlobs(t, repo, 0.8)
+	packs := findPacksForBlobs(t, repo, keepBlobs)
+	packs.Merge(findPacksForBlobs(t, repo, removeBlobs))
+
+	// assign random positions to the blobs to keep
+	var list []restic.BlobHandle
+	for h := range keepBlobs {
+		list = append(list, h)
+	}
+
+	order := restic.NewBlobOrder()
+	for _, i := range rand.Perm(len(list)) {
+		order.Insert(list[i])
+	}
+
+	keep := restic.NewBlobSet()
+	keep.Merge(keepBlobs)
+
+	obsoletePacks, err := repository.Repack(context.TODO(), repo, packs, keep, order, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id := range obsoletePacks {
+		err = repo.Backend().Remove(context.TODO(), restic.Handle{Type: restic.DataFile, Name: id.String()})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rebuildIndex(t, repo)
+	reloadIndex(t, repo)
+
+	// within each new pack, blobs must be stored sorted by their position
+	err = repo.List(context.TODO(), restic.DataFile, func(id restic.ID, size int64) error {
+		entries, _, err := repo.ListPack(context.TODO(), id, size)
+		if err != nil {
+			return err
+		}
+
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Offset < entries[j].Offset
+		})
+
+		last := -1
+		for _, entry := range entries {
+			pos, ok := order.Position(restic.BlobHandle{ID: entry.ID, Type: entry.Type})
+			if !ok {
+				t.Errorf("pack %v contains blob %v which should have been removed", id.Str(), entry.ID.Str())
+				continue
+			}
+
+			if pos < last {
+				t.Errorf("pack %v: blob %v at position %d stored after position %d", id.Str(), entry.ID.Str(), pos, last)
+			}
+			last = pos
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sync"
 
 	"github.com/restic/restic/internal/cache"
 	"github.com/restic/restic/internal/errors"
@@ -19,6 +20,8 @@ import (
 	"github.com/restic/restic/internal/crypto"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/pack"
+
+	"github.com/restic/chunker"
 )
 
 // Repository is used to access a repository in a backend.
@@ -26,12 +29,35 @@ type Repository struct {
 	be      restic.Backend
 	cfg     restic.Config
 	key     *crypto.Key
+	master  *crypto.Key
 	keyName string
 	idx     *MasterIndex
 	restic.Cache
 
 	treePM *packerManager
 	dataPM *packerManager
+
+	// bindData is set when new data is bound to the repository ID
+	bindData bool
+
+	// compression selects how blobs are compressed in repositories which
+	// support it
+	compression CompressionMode
+
+	// sealGuard is set when the backend has been wrapped in a sealedBackend
+	sealGuard bool
+
+	revIdx     *ReverseIndex
+	revIdxOnce sync.Once
+
+	// saveIndexMutex ensures that an index is only saved once, even if
+	// SaveIndex and SaveFullIndex are called concurrently
+	saveIndexMutex sync.Mutex
+
+	// packerMutex is held for reading while a blob is added to a packer and
+	// the packer is saved, so that Flush can wait until all blobs saved so
+	// far are in packs which are not in use by another goroutine.
+	packerMutex sync.RWMutex
 }
 
 // New returns a new repository with backend be.
@@ -61,6 +87,13 @@ func (r *Repository) UseCache(c restic.Cache) {
 	r.be = c.Wrap(r.be)
 }
 
+// UseDataCache loads data packs through the cache c, so that they are only
+// downloaded once.
+func (r *Repository) UseDataCache(c *cache.DataCache) {
+	debug.Log("using data cache")
+	r.be = c.Wrap(r.be)
+}
+
 // PrefixLength returns the number of bytes required so that all prefixes of
 // all IDs of type t are unique.
 func (r *Repository) PrefixLength(t restic.FileType) (int, error) {
@@ -83,8 +116,7 @@ func (r *Repository) LoadAndDecrypt(ctx context.Context, t restic.FileType, id r
 		return nil, errors.Errorf("load %v: invalid data returned", h)
 	}
 
-	nonce, ciphertext := buf[:r.key.NonceSize()], buf[r.key.NonceSize():]
-	plaintext, err := r.key.Open(ciphertext[:0], nonce, ciphertext, nil)
+	plaintext, err := r.cfg.Open(r.fileKey(t), buf, r.cfg.FileAssociatedData(t), id)
 	if err != nil {
 		return nil, err
 	}
@@ -114,7 +146,7 @@ func (r *Repository) sortCachedPacks(blobs []restic.PackedBlob) []restic.PackedB
 
 // loadBlob tries to load and decrypt content identified by t and id from a
 // pack from the backend, the result is stored in plaintextBuf, which must be
-// large enough to hold the complete blob.
+// large enough to hold the complete blob. Compressed blobs are decompressed.
 func (r *Repository) loadBlob(ctx context.Context, id restic.ID, t restic.BlobType, plaintextBuf []byte) (int, error) {
 	debug.Log("load %v with id %v (buf len %v, cap %d)", t, id, len(plaintextBuf), cap(plaintextBuf))
 
@@ -143,6 +175,10 @@ func (r *Repository) loadBlob(ctx context.Context, id restic.ID, t restic.BlobTy
 			return 0, errors.Errorf("buffer is too small: %v < %v", cap(plaintextBuf), blob.Length)
 		}
 
+		if uint(cap(plaintextBuf)) < blob.DataLength() {
+			return 0, errors.Errorf("buffer is too small: %v < %v", cap(plaintextBuf), blob.DataLength())
+		}
+
 		plaintextBuf = plaintextBuf[:blob.Length]
 
 		n, err := restic.ReadAt(ctx, r.be, h, int64(blob.Offset), plaintextBuf)
@@ -160,13 +196,18 @@ func (r *Repository) loadBlob(ctx context.Context, id restic.ID, t restic.BlobTy
 		}
 
 		// decrypt
-		nonce, ciphertext := plaintextBuf[:r.key.NonceSize()], plaintextBuf[r.key.NonceSize():]
-		plaintext, err := r.key.Open(ciphertext[:0], nonce, ciphertext, nil)
+		plaintext, err := r.cfg.Open(r.key, plaintextBuf, r.cfg.BlobAssociatedData(t, id), blob.PackID)
 		if err != nil {
 			lastError = errors.Errorf("decrypting blob %v failed: %v", id, err)
 			continue
 		}
 
+		plaintext, err = DecompressBlob(blob.Blob, plaintext, nil)
+		if err != nil {
+			lastError = err
+			continue
+		}
+
 		// check hash
 		if !restic.Hash(plaintext).Equal(id) {
 			lastError = errors.Errorf("blob %v returned invalid hash", id)
@@ -174,7 +215,8 @@ func (r *Repository) loadBlob(ctx context.Context, id restic.ID, t restic.BlobTy
 		}
 
 		// move decrypted data to the start of the provided buffer
-		copy(plaintextBuf[0:], plaintext)
+		plaintextBuf = plaintextBuf[:len(plaintext)]
+		copy(plaintextBuf, plaintext)
 		return len(plaintext), nil
 	}
 
@@ -212,6 +254,20 @@ func (r *Repository) SaveAndEncrypt(ctx context.Context, t restic.BlobType, data
 
 	debug.Log("save id %v (%v, %d bytes)", id, t, len(data))
 
+	// compress the blob if the repository supports it, the uncompressed
+	// length is recorded in the pack header and the index
+	var uncompressedLength uint
+	if r.cfg.Compresses() {
+		compressBuf := getBuf()
+		defer freeBuf(compressBuf)
+
+		if compressed, ok := compressBlob(r.compression, data, compressBuf); ok {
+			debug.Log("compressed %d bytes to %d bytes", len(data), len(compressed))
+			uncompressedLength = uint(len(data))
+			data = compressed
+		}
+	}
+
 	// get buf from the pool
 	ciphertext := getBuf()
 	defer freeBuf(ciphertext)
@@ -221,7 +277,7 @@ func (r *Repository) SaveAndEncrypt(ctx context.Context, t restic.BlobType, data
 	ciphertext = append(ciphertext, nonce...)
 
 	// encrypt blob
-	ciphertext = r.key.Seal(ciphertext, nonce, data, nil)
+	ciphertext = r.key.Seal(ciphertext, nonce, data, r.blobAssociatedData(t, *id))
 
 	// find suitable packer and add blob
 	var pm *packerManager
@@ -235,13 +291,16 @@ func (r *Repository) SaveAndEncrypt(ctx context.Context, t restic.BlobType, data
 		panic(fmt.Sprintf("invalid type: %v", t))
 	}
 
+	r.packerMutex.RLock()
+	defer r.packerMutex.RUnlock()
+
 	packer, err := pm.findPacker()
 	if err != nil {
 		return restic.ID{}, err
 	}
 
 	// save ciphertext
-	_, err = packer.Add(t, *id, ciphertext)
+	_, err = packer.AddCompressed(t, *id, ciphertext, uncompressedLength)
 	if err != nil {
 		return restic.ID{}, err
 	}
@@ -277,7 +336,7 @@ func (r *Repository) SaveUnpacked(ctx context.Context, t restic.FileType, p []by
 	nonce := crypto.NewRandomNonce()
 	ciphertext = append(ciphertext, nonce...)
 
-	ciphertext = r.key.Seal(ciphertext, nonce, p, nil)
+	ciphertext = r.fileKey(t).Seal(ciphertext, nonce, p, r.fileAssociatedData(t))
 
 	id = restic.Hash(ciphertext)
 	h := restic.Handle{Type: t, Name: id.String()}
@@ -292,8 +351,13 @@ func (r *Repository) SaveUnpacked(ctx context.Context, t restic.FileType, p []by
 	return id, nil
 }
 
-// Flush saves all remaining packs.
+// Flush saves all remaining packs and all indexes which are full. It waits
+// until the blobs which are currently saved concurrently have been added to a
+// pack, so afterwards all blobs saved before the call are stored in the backend.
 func (r *Repository) Flush(ctx context.Context) error {
+	r.packerMutex.Lock()
+	defer r.packerMutex.Unlock()
+
 	pms := []struct {
 		t  restic.BlobType
 		pm *packerManager
@@ -317,7 +381,9 @@ func (r *Repository) Flush(ctx context.Context) error {
 		p.pm.pm.Unlock()
 	}
 
-	return nil
+	// append the indexes which are full now, so that the final SaveIndex only
+	// needs to write the blobs added since then
+	return r.SaveFullIndex(ctx)
 }
 
 // Backend returns the backend for the repository.
@@ -347,9 +413,18 @@ func SaveIndex(ctx context.Context, repo restic.Repository, index *Index) (resti
 	return repo.SaveUnpacked(ctx, restic.IndexFile, buf.Bytes())
 }
 
-// saveIndex saves all indexes in the backend.
+// saveIndex saves all indexes in the backend. Indexes which have been saved
+// in the meantime by a concurrent call are skipped.
 func (r *Repository) saveIndex(ctx context.Context, indexes ...*Index) error {
+	r.saveIndexMutex.Lock()
+	defer r.saveIndexMutex.Unlock()
+
 	for i, idx := range indexes {
+		if idx.Final() {
+			debug.Log("index %d has already been saved", i)
+			continue
+		}
+
 		debug.Log("Saving index %d", i)
 
 		sid, err := SaveIndex(ctx, r, idx)
@@ -357,6 +432,11 @@ func (r *Repository) saveIndex(ctx context.Context, indexes ...*Index) error {
 			return err
 		}
 
+		err = idx.SetID(sid)
+		if err != nil {
+			return err
+		}
+
 		debug.Log("Saved index %d as %v", i, sid)
 	}
 
@@ -482,20 +562,226 @@ func (r *Repository) SearchKey(ctx context.Context, password string, maxKeys int
 		return err
 	}
 
-	r.key = key.master
-	r.dataPM.key = key.master
-	r.treePM.key = key.master
+	r.setKey(key.master, restic.Config{})
 	r.keyName = key.Name()
-	r.cfg, err = restic.LoadConfig(ctx, r)
+	cfg, err := r.loadConfig(ctx)
 	if err != nil {
 		return errors.Fatalf("config cannot be loaded: %v", err)
 	}
+	r.setKey(key.master, cfg)
 	return nil
 }
 
+// setKey configures the repository to use the master key and the config
+// cfg. For repositories without encryption, everything except the config
+// is only authenticated.
+func (r *Repository) setKey(master *crypto.Key, cfg restic.Config) {
+	key := master
+	if cfg.Encryption == restic.EncryptionNone {
+		key = master.WithoutEncryption()
+	}
+
+	r.cfg = cfg
+	r.bindData = cfg.BindsData()
+	if cfg.Seal != nil && !r.sealGuard {
+		// the guard checks the current config, so it keeps working when the
+		// backend is wrapped afterwards, e.g. by the cache
+		r.be = &sealedBackend{Backend: r.be, repo: r}
+		r.sealGuard = true
+	}
+	r.master = master
+	r.key = key
+	r.dataPM.key = key
+	r.treePM.key = key
+}
+
+// fileKey returns the key used for files of type t. The config is always
+// encrypted, so that it can be read before it is known whether the other
+// files are.
+func (r *Repository) fileKey(t restic.FileType) *crypto.Key {
+	if t == restic.ConfigFile || t == restic.NewConfigFile {
+		return r.master
+	}
+	return r.key
+}
+
+// blobAssociatedData returns the additional data for new blobs, or nil if the
+// data is not bound to the repository.
+func (r *Repository) blobAssociatedData(t restic.BlobType, id restic.ID) []byte {
+	if !r.bindData {
+		return nil
+	}
+	return r.cfg.BlobAssociatedData(t, id)
+}
+
+// fileAssociatedData returns the additional data for new files of type t, or
+// nil if the data is not bound to the repository.
+func (r *Repository) fileAssociatedData(t restic.FileType) []byte {
+	if !r.bindData {
+		return nil
+	}
+	return r.cfg.FileAssociatedData(t)
+}
+
+// SetCompression sets the compression mode for blobs which are saved from now
+// on. It has no effect for repositories which do not support compression.
+func (r *Repository) SetCompression(mode CompressionMode) {
+	r.compression = mode
+}
+
+// UseAssociatedData binds all data which is saved from now on to the
+// repository ID, like in repositories of version 2. This is used to migrate
+// older repositories. Data without additional data is then only accepted
+// from the files in unbound, which must contain all files of the repository
+// which are read during the migration, including the packs.
+func (r *Repository) UseAssociatedData(unbound restic.IDSet) {
+	r.bindData = true
+	r.cfg.SetUnbound(unbound)
+}
+
+// SaveConfig replaces the config of the repository with cfg. The backends do
+// not support overwriting files, so cfg is saved as a new config and read back
+// first. Only then the old config is removed and cfg saved in its place. When
+// this is interrupted after the old config has been removed, the new config
+// is used when the repository is opened the next time, see loadConfig.
+func (r *Repository) SaveConfig(ctx context.Context, cfg restic.Config) error {
+	// new configs left over from an earlier attempt have never replaced the
+	// config, they are outdated now
+	ids, err := r.newConfigs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		err = r.be.Remove(ctx, restic.Handle{Type: restic.NewConfigFile, Name: id.String()})
+		if err != nil {
+			return err
+		}
+	}
+
+	id, err := r.SaveJSONUnpacked(ctx, restic.NewConfigFile, cfg)
+	if err != nil {
+		return err
+	}
+
+	saved, err := restic.LoadNewConfig(ctx, r, id)
+	if err != nil {
+		return errors.Wrap(err, "unable to read back new config")
+	}
+	if !sameConfig(saved, cfg) {
+		return errors.New("new config read back does not match")
+	}
+
+	err = r.be.Remove(ctx, restic.Handle{Type: restic.ConfigFile})
+	if err != nil {
+		return err
+	}
+
+	_, err = r.SaveJSONUnpacked(ctx, restic.ConfigFile, cfg)
+	if err != nil {
+		return errors.Errorf("unable to save config, the new config %v is used instead: %v", id.Str(), err)
+	}
+
+	r.setKey(r.master, cfg)
+	return r.be.Remove(ctx, restic.Handle{Type: restic.NewConfigFile, Name: id.String()})
+}
+
+// sameConfig returns true if both configs are saved in the same way. Times are
+// compared without their monotonic clock reading, which is not saved.
+func sameConfig(a, b restic.Config) bool {
+	bufA, errA := json.Marshal(a)
+	bufB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(bufA, bufB)
+}
+
+// newConfigs returns the IDs of all new configs saved by SaveConfig.
+func (r *Repository) newConfigs(ctx context.Context) (restic.IDs, error) {
+	var ids restic.IDs
+	err := r.be.List(ctx, restic.NewConfigFile, func(fi restic.FileInfo) error {
+		id, err := restic.ParseID(fi.Name)
+		if err != nil {
+			debug.Log("unable to parse %v as an ID", fi.Name)
+			return nil
+		}
+		ids = append(ids, id)
+		return nil
+	})
+	return ids, err
+}
+
+// loadConfig loads the config of the repository. When it is missing because
+// SaveConfig was interrupted after removing the old config, the new config
+// is returned instead and saved as the config, if possible.
+func (r *Repository) loadConfig(ctx context.Context) (restic.Config, error) {
+	cfg, err := restic.LoadConfig(ctx, r)
+	if err == nil {
+		return cfg, nil
+	}
+
+	found, terr := r.be.Test(ctx, restic.Handle{Type: restic.ConfigFile})
+	if terr != nil || found {
+		return restic.Config{}, err
+	}
+
+	ids, lerr := r.newConfigs(ctx)
+	if lerr != nil || len(ids) != 1 {
+		debug.Log("config is missing, found new configs %v, err %v", ids, lerr)
+		return restic.Config{}, err
+	}
+
+	cfg, err = restic.LoadNewConfig(ctx, r, ids[0])
+	if err != nil {
+		return restic.Config{}, err
+	}
+
+	debug.Log("config is missing, using new config %v", ids[0])
+	_, err = r.SaveJSONUnpacked(ctx, restic.ConfigFile, cfg)
+	if err == nil {
+		err = r.be.Remove(ctx, restic.Handle{Type: restic.NewConfigFile, Name: ids[0].String()})
+	}
+	if err != nil {
+		debug.Log("unable to replace the config: %v", err)
+	}
+
+	return cfg, nil
+}
+
+// HasNewConfig returns true if be contains a new config saved by SaveConfig,
+// which is used when the config itself is missing.
+func HasNewConfig(ctx context.Context, be restic.Backend) (bool, error) {
+	found := false
+	err := be.List(ctx, restic.NewConfigFile, func(restic.FileInfo) error {
+		found = true
+		return nil
+	})
+	return found, err
+}
+
 // Init creates a new master key with the supplied password, initializes and
-// saves the repository config.
-func (r *Repository) Init(ctx context.Context, password string) error {
+// saves the repository config. When chunkerPolynomial is not nil, it is used
+// instead of a random polynomial.
+func (r *Repository) Init(ctx context.Context, password string, chunkerPolynomial *chunker.Pol) error {
+	return r.InitVersion(ctx, restic.RepoVersion, password, chunkerPolynomial, "")
+}
+
+// InitWithoutEncryption works like Init, but the data in the new repository
+// is only authenticated and stored in plaintext. Only the keys and the config
+// are encrypted. The repository is created with restic.RepoVersionNoEncryption.
+func (r *Repository) InitWithoutEncryption(ctx context.Context, password string, chunkerPolynomial *chunker.Pol) error {
+	return r.InitVersion(ctx, restic.RepoVersionNoEncryption, password, chunkerPolynomial, restic.EncryptionNone)
+}
+
+// InitVersion works like Init, but creates a repository of the given version.
+// With encryption set to restic.EncryptionNone, the data is only
+// authenticated, which requires at least restic.RepoVersionNoEncryption.
+func (r *Repository) InitVersion(ctx context.Context, version uint, password string, chunkerPolynomial *chunker.Pol, encryption string) error {
+	if version < restic.RepoVersion || version > restic.MaxRepoVersion {
+		return errors.Errorf("unsupported repository version %d", version)
+	}
+
+	if encryption == restic.EncryptionNone && version < restic.RepoVersionNoEncryption {
+		return errors.Errorf("repositories without encryption require at least version %d", restic.RepoVersionNoEncryption)
+	}
+
 	has, err := r.be.Test(ctx, restic.Handle{Type: restic.ConfigFile})
 	if err != nil {
 		return err
@@ -508,6 +794,15 @@ func (r *Repository) Init(ctx context.Context, password string) error {
 	if err != nil {
 		return err
 	}
+	cfg.Encryption = encryption
+	cfg.Version = version
+
+	if chunkerPolynomial != nil {
+		if !chunkerPolynomial.Irreducible() {
+			return errors.New("invalid chunker polynomial, not irreducible")
+		}
+		cfg.ChunkerPolynomial = *chunkerPolynomial
+	}
 
 	return r.init(ctx, password, cfg)
 }
@@ -520,16 +815,14 @@ func (r *Repository) init(ctx context.Context, password string, cfg restic.Confi
 		return err
 	}
 
-	r.key = key.master
-	r.dataPM.key = key.master
-	r.treePM.key = key.master
+	r.setKey(key.master, cfg)
 	r.keyName = key.Name()
-	r.cfg = cfg
 	_, err = r.SaveJSONUnpacked(ctx, restic.ConfigFile, cfg)
 	return err
 }
 
-// Key returns the current master key.
+// Key returns the key used for the data in the repository. For repositories
+// without encryption, this key only authenticates the data.
 func (r *Repository) Key() *crypto.Key {
 	return r.key
 }
@@ -556,7 +849,7 @@ func (r *Repository) List(ctx context.Context, t restic.FileType, fn func(restic
 func (r *Repository) ListPack(ctx context.Context, id restic.ID, size int64) ([]restic.Blob, int64, error) {
 	h := restic.Handle{Type: restic.DataFile, Name: id.String()}
 
-	blobs, err := pack.List(r.Key(), restic.ReaderAt(r.Backend(), h), size)
+	blobs, err := pack.List(r.Key(), restic.ReaderAt(r.Backend(), h), size, r.Config().Compresses())
 	if err != nil {
 		return nil, 0, err
 	}
@@ -641,15 +934,11 @@ func (r *Repository) LoadTree(ctx context.Context, id restic.ID) (*restic.Tree,
 // checked against the index. The tree is only stored when the index does not
 // contain the ID.
 func (r *Repository) SaveTree(ctx context.Context, t *restic.Tree) (restic.ID, error) {
-	buf, err := json.Marshal(t)
+	buf, err := restic.EncodeTree(t)
 	if err != nil {
-		return restic.ID{}, errors.Wrap(err, "MarshalJSON")
+		return restic.ID{}, err
 	}
 
-	// append a newline so that the data is always consistent (json.Encoder
-	// adds a newline after each object)
-	buf = append(buf, '\n')
-
 	id := restic.Hash(buf)
 	if r.idx.Has(id, restic.TreeBlob) {
 		return id, nil
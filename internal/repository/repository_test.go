@@ -4,13 +4,19 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/checker"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/pack"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
@@ -392,3 +398,363 @@ func TestRepositoryIncrementalIndex(t *testing.T) {
 		}
 	}
 }
+
+// TestRepositoryConcurrentWriters simulates several processes which back up
+// into the same repository at the same time. Each one holds a non-exclusive
+// lock, saves blobs and writes full indexes in the background, like the
+// archiver does.
+func TestRepositoryConcurrentWriters(t *testing.T) {
+	be, cleanup := repository.TestBackend(t)
+	defer cleanup()
+
+	repository.TestRepositoryWithBackend(t, be)
+	restic.TestSetLockTimeout(t, 5*time.Millisecond)
+
+	oldIndexFull := repository.IndexFull
+	repository.IndexFull = func(*repository.Index) bool { return true }
+	defer func() {
+		repository.IndexFull = oldIndexFull
+	}()
+
+	const writers = 4
+	ctx := context.TODO()
+
+	var locks []*restic.Lock
+	repos := make([]*repository.Repository, writers)
+	for i := range repos {
+		repos[i] = repository.New(be)
+		rtest.OK(t, repos[i].SearchKey(ctx, rtest.TestPassword, 10))
+
+		lock, err := restic.NewLock(ctx, repos[i])
+		rtest.OK(t, err)
+		locks = append(locks, lock)
+	}
+
+	_, err := restic.NewExclusiveLock(ctx, repos[0])
+	rtest.Assert(t, restic.IsAlreadyLocked(err), "expected exclusive lock to fail, got %v", err)
+
+	ids := make([]restic.IDs, writers)
+	var wg sync.WaitGroup
+	for i, repo := range repos {
+		wg.Add(1)
+		go func(i int, repo *repository.Repository) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(int64(i)))
+
+			done := make(chan struct{})
+			var bg sync.WaitGroup
+			bg.Add(1)
+			go func() {
+				defer bg.Done()
+				for {
+					select {
+					case <-done:
+						return
+					default:
+					}
+
+					if err := repo.SaveFullIndex(ctx); err != nil {
+						t.Errorf("SaveFullIndex: %v", err)
+						return
+					}
+				}
+			}()
+
+			for j := 0; j < 100; j++ {
+				buf := make([]byte, rnd.Intn(1<<14)+1)
+				_, _ = io.ReadFull(rnd, buf)
+
+				id, err := repo.SaveBlob(ctx, restic.DataBlob, buf, restic.ID{})
+				if err != nil {
+					t.Errorf("SaveBlob: %v", err)
+					break
+				}
+				ids[i] = append(ids[i], id)
+
+				if j%10 == 0 {
+					if err := repo.Flush(ctx); err != nil {
+						t.Errorf("Flush: %v", err)
+						break
+					}
+				}
+			}
+
+			close(done)
+			bg.Wait()
+
+			if err := repo.Flush(ctx); err != nil {
+				t.Errorf("Flush: %v", err)
+			}
+			if err := repo.SaveIndex(ctx); err != nil {
+				t.Errorf("SaveIndex: %v", err)
+			}
+		}(i, repo)
+	}
+	wg.Wait()
+
+	for _, lock := range locks {
+		rtest.OK(t, lock.Unlock())
+	}
+
+	if t.Failed() {
+		return
+	}
+
+	repo := repository.New(be)
+	rtest.OK(t, repo.SearchKey(ctx, rtest.TestPassword, 10))
+	rtest.OK(t, repo.LoadIndex(ctx))
+
+	for _, list := range ids {
+		for _, id := range list {
+			size, found := repo.LookupBlobSize(id, restic.DataBlob)
+			rtest.Assert(t, found, "blob %v not found in the index", id.Str())
+
+			buf := restic.NewBlobBuffer(int(size))
+			n, err := repo.LoadBlob(ctx, restic.DataBlob, id, buf)
+			rtest.OK(t, err)
+			rtest.Equals(t, id, restic.Hash(buf[:n]))
+		}
+	}
+
+	// each pack must be listed in exactly one index
+	packs := restic.NewIDSet()
+	err = repo.List(ctx, restic.IndexFile, func(id restic.ID, size int64) error {
+		idx, err := repository.LoadIndex(ctx, repo, id)
+		rtest.OK(t, err)
+
+		for packID := range idx.Packs() {
+			rtest.Assert(t, !packs.Has(packID), "pack %v listed in more than one index", packID.Str())
+			packs.Insert(packID)
+		}
+		return nil
+	})
+	rtest.OK(t, err)
+}
+
+func TestRepositoryBindData(t *testing.T) {
+	be, cleanup := repository.TestBackend(t)
+	defer cleanup()
+
+	r, _ := repository.TestRepositoryWithBackend(t, be)
+	repo := r.(*repository.Repository)
+
+	cfg := repo.Config()
+	cfg.Version = restic.RepoVersionAssociatedData
+	rtest.OK(t, repo.SaveConfig(context.TODO(), cfg))
+
+	data := rtest.Random(23, 1000)
+	id, err := repo.SaveBlob(context.TODO(), restic.DataBlob, data, restic.ID{})
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Flush(context.TODO()))
+
+	buf := restic.NewBlobBuffer(len(data))
+	n, err := repo.LoadBlob(context.TODO(), restic.DataBlob, id, buf)
+	rtest.OK(t, err)
+	rtest.Equals(t, data, buf[:n])
+
+	// pretend the data was copied from a repository with a different ID
+	cfg.ID = restic.NewRandomID().String()
+	rtest.OK(t, repo.SaveConfig(context.TODO(), cfg))
+
+	_, err = repo.LoadBlob(context.TODO(), restic.DataBlob, id, buf)
+	rtest.Assert(t, err != nil, "blob of another repository was accepted")
+
+	repo2 := repository.New(be)
+	rtest.OK(t, repo2.SearchKey(context.TODO(), rtest.TestPassword, 10))
+	rtest.Equals(t, cfg, repo2.Config())
+
+	// index files which cannot be loaded are ignored
+	rtest.OK(t, repo2.LoadIndex(context.TODO()))
+	rtest.Assert(t, !repo2.Index().Has(id, restic.DataBlob), "index of another repository was accepted")
+}
+
+func TestRepositoryUnbound(t *testing.T) {
+	be, cleanup := repository.TestBackend(t)
+	defer cleanup()
+
+	r, _ := repository.TestRepositoryWithBackend(t, be)
+	repo := r.(*repository.Repository)
+	ctx := context.TODO()
+
+	data := []byte("foobar")
+	listed, err := repo.SaveUnpacked(ctx, restic.SnapshotFile, data)
+	rtest.OK(t, err)
+	unlisted, err := repo.SaveUnpacked(ctx, restic.SnapshotFile, data)
+	rtest.OK(t, err)
+
+	repo.UseAssociatedData(restic.NewIDSet(listed))
+	bound, err := repo.SaveUnpacked(ctx, restic.SnapshotFile, data)
+	rtest.OK(t, err)
+
+	for _, id := range []restic.ID{listed, bound} {
+		buf, err := repo.LoadAndDecrypt(ctx, restic.SnapshotFile, id)
+		rtest.OK(t, err)
+		rtest.Equals(t, data, buf)
+	}
+
+	_, err = repo.LoadAndDecrypt(ctx, restic.SnapshotFile, unlisted)
+	rtest.Assert(t, err != nil, "file without additional data was accepted although it is not listed")
+
+	// without a running migration, all files are accepted
+	repo2 := repository.New(be)
+	rtest.OK(t, repo2.SearchKey(ctx, rtest.TestPassword, 10))
+	for _, id := range []restic.ID{listed, unlisted, bound} {
+		buf, err := repo2.LoadAndDecrypt(ctx, restic.SnapshotFile, id)
+		rtest.OK(t, err)
+		rtest.Equals(t, data, buf)
+	}
+}
+
+// failConfigBackend fails to save the config while fail is set.
+type failConfigBackend struct {
+	restic.Backend
+	fail bool
+}
+
+func (be *failConfigBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	if be.fail && h.Type == restic.ConfigFile {
+		return errors.New("injected error")
+	}
+	return be.Backend.Save(ctx, h, rd)
+}
+
+func TestRepositorySaveConfigInterrupted(t *testing.T) {
+	be, cleanup := repository.TestBackend(t)
+	defer cleanup()
+
+	fbe := &failConfigBackend{Backend: be}
+	r, _ := repository.TestRepositoryWithBackend(t, fbe)
+	repo := r.(*repository.Repository)
+	ctx := context.TODO()
+
+	cfg := repo.Config()
+	cfg.Version = restic.RepoVersionAssociatedData
+
+	fbe.fail = true
+	err := repo.SaveConfig(ctx, cfg)
+	rtest.Assert(t, err != nil, "saving the config did not fail")
+
+	// the old config is gone, but the new one is still there
+	found, err := be.Test(ctx, restic.Handle{Type: restic.ConfigFile})
+	rtest.OK(t, err)
+	rtest.Assert(t, !found, "config was not removed")
+	found, err = repository.HasNewConfig(ctx, be)
+	rtest.OK(t, err)
+	rtest.Assert(t, found, "new config not found")
+
+	// opening the repository uses the new config and moves it into place
+	fbe.fail = false
+	repo2 := repository.New(fbe)
+	rtest.OK(t, repo2.SearchKey(ctx, rtest.TestPassword, 10))
+	rtest.Equals(t, cfg, repo2.Config())
+
+	found, err = be.Test(ctx, restic.Handle{Type: restic.ConfigFile})
+	rtest.OK(t, err)
+	rtest.Assert(t, found, "config was not restored")
+	found, err = repository.HasNewConfig(ctx, be)
+	rtest.OK(t, err)
+	rtest.Assert(t, !found, "new config was not removed")
+
+	// a new config which never replaced the config is ignored and removed
+	cfg2 := cfg
+	cfg2.ID = restic.NewRandomID().String()
+	_, err = repo2.SaveJSONUnpacked(ctx, restic.NewConfigFile, cfg2)
+	rtest.OK(t, err)
+
+	repo3 := repository.New(be)
+	rtest.OK(t, repo3.SearchKey(ctx, rtest.TestPassword, 10))
+	rtest.Equals(t, cfg, repo3.Config())
+
+	cfg.Encryption = ""
+	rtest.OK(t, repo3.SaveConfig(ctx, cfg))
+	found, err = repository.HasNewConfig(ctx, be)
+	rtest.OK(t, err)
+	rtest.Assert(t, !found, "outdated new config was not removed")
+}
+
+func TestRepositoryCompression(t *testing.T) {
+	be, cleanup := repository.TestBackend(t)
+	defer cleanup()
+
+	r, _ := repository.TestRepositoryWithBackend(t, be)
+	repo := r.(*repository.Repository)
+
+	cfg := repo.Config()
+	cfg.Version = restic.RepoVersionCompression
+	rtest.OK(t, repo.SaveConfig(context.TODO(), cfg))
+
+	compressible := bytes.Repeat([]byte("restic compresses data "), 4000)
+	random := rtest.Random(23, 64*1024)
+
+	var ids restic.IDs
+	for _, data := range [][]byte{compressible, random} {
+		id, err := repo.SaveBlob(context.TODO(), restic.DataBlob, data, restic.ID{})
+		rtest.OK(t, err)
+		ids = append(ids, id)
+	}
+
+	repo.SetCompression(repository.CompressionOff)
+	data := bytes.Repeat([]byte("uncompressed "), 1000)
+	id, err := repo.SaveBlob(context.TODO(), restic.DataBlob, data, restic.ID{})
+	rtest.OK(t, err)
+	ids = append(ids, id)
+
+	rtest.OK(t, repo.Flush(context.TODO()))
+	rtest.OK(t, repo.SaveIndex(context.TODO()))
+
+	// reload the index and the pack headers from the backend
+	repo2 := repository.New(be)
+	rtest.OK(t, repo2.SearchKey(context.TODO(), rtest.TestPassword, 10))
+	rtest.OK(t, repo2.LoadIndex(context.TODO()))
+
+	for i, want := range [][]byte{compressible, random, data} {
+		blobs, found := repo2.Index().Lookup(ids[i], restic.DataBlob)
+		rtest.Assert(t, found, "blob %d not found", i)
+		rtest.Equals(t, i == 0, blobs[0].IsCompressed())
+		if i == 0 {
+			rtest.Assert(t, blobs[0].Length < uint(len(want)), "compressed blob is not smaller")
+		}
+
+		size, found := repo2.LookupBlobSize(ids[i], restic.DataBlob)
+		rtest.Assert(t, found, "blob %d not found", i)
+		rtest.Equals(t, uint(len(want)), size)
+
+		buf := restic.NewBlobBuffer(int(size))
+		n, err := repo2.LoadBlob(context.TODO(), restic.DataBlob, ids[i], buf)
+		rtest.OK(t, err)
+		rtest.Assert(t, bytes.Equal(want, buf[:n]), "wrong data returned for blob %d", i)
+
+		h := restic.Handle{Type: restic.DataFile, Name: blobs[0].PackID.String()}
+		fi, err := be.Stat(context.TODO(), h)
+		rtest.OK(t, err)
+		entries, err := pack.List(repo2.Key(), restic.ReaderAt(be, h), fi.Size, true)
+		rtest.OK(t, err)
+		for _, e := range entries {
+			if e.ID.Equal(ids[i]) {
+				rtest.Equals(t, blobs[0].Blob, e)
+			}
+		}
+	}
+
+}
+
+func TestRepositoryCompressionCheck(t *testing.T) {
+	r, cleanup := repository.TestRepository(t)
+	defer cleanup()
+	repo := r.(*repository.Repository)
+
+	cfg := repo.Config()
+	cfg.Version = restic.RepoVersionCompression
+	rtest.OK(t, repo.SaveConfig(context.TODO(), cfg))
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+	for i := 0; i < 5; i++ {
+		err := ioutil.WriteFile(filepath.Join(tempdir, fmt.Sprintf("file%d", i)), bytes.Repeat([]byte{byte(i)}, 100000), 0644)
+		rtest.OK(t, err)
+	}
+
+	repo.SetCompression(repository.CompressionMax)
+	archiver.TestSnapshot(t, repo, tempdir, nil)
+	checker.TestCheckRepo(t, repo)
+}
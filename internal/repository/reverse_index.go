@@ -0,0 +1,243 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/restic/restic/internal/cache"
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/list"
+	"github.com/restic/restic/internal/restic"
+)
+
+// reverseIndexFile is the name of the file in the cache directory of the
+// repository the reverse index is saved to.
+const reverseIndexFile = "reverse-index"
+
+// ReverseIndex maps pack files to the blobs they contain, and blobs to the
+// pack files they are stored in. The contents of a pack file never change, so
+// once the header of a pack has been read, the list of blobs can be reused
+// until the pack is removed. The reverse index is saved in the local cache, so
+// that maintenance operations do not need to read the headers of all pack
+// files again for each run.
+type ReverseIndex struct {
+	m     sync.Mutex
+	packs map[restic.ID]reversePack
+	blobs map[restic.BlobHandle]restic.IDs // built on demand from packs
+}
+
+type reversePack struct {
+	size  int64
+	blobs []restic.Blob
+}
+
+// NewReverseIndex returns a new, empty reverse index.
+func NewReverseIndex() *ReverseIndex {
+	return &ReverseIndex{
+		packs: make(map[restic.ID]reversePack),
+	}
+}
+
+// AddPack remembers that the pack id with the given size contains blobs.
+func (ri *ReverseIndex) AddPack(id restic.ID, size int64, blobs []restic.Blob) {
+	ri.m.Lock()
+	defer ri.m.Unlock()
+
+	ri.packs[id] = reversePack{size: size, blobs: blobs}
+	ri.blobs = nil
+}
+
+// ListPack returns the blobs stored in the pack id and the size of the pack.
+// If the pack is unknown, ok is false.
+func (ri *ReverseIndex) ListPack(id restic.ID) (blobs []restic.Blob, size int64, ok bool) {
+	ri.m.Lock()
+	defer ri.m.Unlock()
+
+	p, ok := ri.packs[id]
+	return p.blobs, p.size, ok
+}
+
+// Lookup returns the IDs of all packs which contain the blob h.
+func (ri *ReverseIndex) Lookup(h restic.BlobHandle) restic.IDs {
+	ri.m.Lock()
+	defer ri.m.Unlock()
+
+	if ri.blobs == nil {
+		ri.blobs = make(map[restic.BlobHandle]restic.IDs)
+		for id, p := range ri.packs {
+			for _, blob := range p.blobs {
+				bh := restic.BlobHandle{ID: blob.ID, Type: blob.Type}
+				ri.blobs[bh] = append(ri.blobs[bh], id)
+			}
+		}
+	}
+
+	return ri.blobs[h]
+}
+
+// Len returns the number of packs in the reverse index.
+func (ri *ReverseIndex) Len() int {
+	ri.m.Lock()
+	defer ri.m.Unlock()
+
+	return len(ri.packs)
+}
+
+// Retain removes all packs from the reverse index which are not contained in
+// packs.
+func (ri *ReverseIndex) Retain(packs restic.IDSet) {
+	ri.m.Lock()
+	defer ri.m.Unlock()
+
+	for id := range ri.packs {
+		if !packs.Has(id) {
+			delete(ri.packs, id)
+			ri.blobs = nil
+		}
+	}
+}
+
+// Lister returns a list.Lister which answers ListPack from the reverse index
+// and only reads the header of packs which are not known yet. The contents
+// of these packs are added to the reverse index.
+func (ri *ReverseIndex) Lister(l list.Lister) list.Lister {
+	return reverseIndexLister{Lister: l, ri: ri}
+}
+
+type reverseIndexLister struct {
+	list.Lister
+	ri *ReverseIndex
+}
+
+func (l reverseIndexLister) ListPack(ctx context.Context, id restic.ID, size int64) ([]restic.Blob, int64, error) {
+	blobs, packSize, ok := l.ri.ListPack(id)
+	if ok && packSize == size {
+		return blobs, packSize, nil
+	}
+
+	blobs, packSize, err := l.Lister.ListPack(ctx, id, size)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	l.ri.AddPack(id, packSize, blobs)
+	return blobs, packSize, nil
+}
+
+type reversePackJSON struct {
+	ID    restic.ID     `json:"id"`
+	Size  int64         `json:"size"`
+	Blobs []restic.Blob `json:"blobs"`
+}
+
+// ReverseIndex returns the reverse index of the repository. On the first
+// call, it is loaded from the cache. If there is no cache or the reverse index
+// cannot be loaded, an empty reverse index is returned.
+func (r *Repository) ReverseIndex() *ReverseIndex {
+	r.revIdxOnce.Do(func() {
+		r.revIdx = NewReverseIndex()
+
+		filename := r.reverseIndexFilename()
+		if filename == "" {
+			return
+		}
+
+		err := r.loadReverseIndex(filename, r.revIdx)
+		if err != nil && !os.IsNotExist(errors.Cause(err)) {
+			debug.Log("unable to load reverse index from %v: %v", filename, err)
+		}
+	})
+
+	return r.revIdx
+}
+
+// reverseIndexFilename returns the path of the reverse index in the cache, or
+// the empty string if no cache is used.
+func (r *Repository) reverseIndexFilename() string {
+	c, ok := r.Cache.(*cache.Cache)
+	if !ok {
+		return ""
+	}
+	return filepath.Join(c.Path, reverseIndexFile)
+}
+
+func (r *Repository) loadReverseIndex(filename string, ri *ReverseIndex) error {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return errors.Wrap(err, "ReadFile")
+	}
+
+	if len(buf) < r.key.NonceSize() {
+		return errors.New("reverse index is too short")
+	}
+
+	nonce, ciphertext := buf[:r.key.NonceSize()], buf[r.key.NonceSize():]
+	plaintext, err := r.key.Open(ciphertext[:0], nonce, ciphertext, nil)
+	if err != nil {
+		return err
+	}
+
+	var packs []reversePackJSON
+	err = json.Unmarshal(plaintext, &packs)
+	if err != nil {
+		return errors.Wrap(err, "Unmarshal")
+	}
+
+	for _, p := range packs {
+		ri.AddPack(p.ID, p.Size, p.Blobs)
+	}
+
+	debug.Log("loaded reverse index with %d packs", len(packs))
+	return nil
+}
+
+// SaveReverseIndex saves the reverse index in the cache, encrypted with the
+// key of the repository. Nothing is done if no cache is used.
+func (r *Repository) SaveReverseIndex() error {
+	filename := r.reverseIndexFilename()
+	if filename == "" || r.revIdx == nil {
+		return nil
+	}
+
+	ri := r.revIdx
+	ri.m.Lock()
+	packs := make([]reversePackJSON, 0, len(ri.packs))
+	for id, p := range ri.packs {
+		packs = append(packs, reversePackJSON{ID: id, Size: p.size, Blobs: p.blobs})
+	}
+	ri.m.Unlock()
+
+	plaintext, err := json.Marshal(packs)
+	if err != nil {
+		return errors.Wrap(err, "Marshal")
+	}
+
+	nonce := crypto.NewRandomNonce()
+	ciphertext := make([]byte, 0, len(nonce)+len(plaintext)+r.key.Overhead())
+	ciphertext = append(ciphertext, nonce...)
+	ciphertext = r.key.Seal(ciphertext, nonce, plaintext, nil)
+
+	// write to a temporary file first, so that a concurrent reader never sees
+	// a partially written reverse index
+	tmpfile := filename + ".tmp"
+	err = ioutil.WriteFile(tmpfile, ciphertext, 0600)
+	if err != nil {
+		return errors.Wrap(err, "WriteFile")
+	}
+
+	err = fs.Rename(tmpfile, filename)
+	if err != nil {
+		_ = fs.Remove(tmpfile)
+		return errors.Wrap(err, "Rename")
+	}
+
+	debug.Log("saved reverse index with %d packs to %v", len(packs), filename)
+	return nil
+}
@@ -0,0 +1,93 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/restic/restic/internal/cache"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+type countingLister struct {
+	packs map[restic.ID][]restic.Blob
+	calls int
+}
+
+func (l *countingLister) List(ctx context.Context, t restic.FileType, fn func(restic.ID, int64) error) error {
+	for id := range l.packs {
+		if err := fn(id, 100); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *countingLister) ListPack(ctx context.Context, id restic.ID, size int64) ([]restic.Blob, int64, error) {
+	l.calls++
+	return l.packs[id], size, nil
+}
+
+func TestReverseIndexLister(t *testing.T) {
+	blob := restic.Blob{Type: restic.DataBlob, ID: restic.NewRandomID(), Length: 23}
+	pack1, pack2 := restic.NewRandomID(), restic.NewRandomID()
+
+	l := &countingLister{packs: map[restic.ID][]restic.Blob{
+		pack1: {blob},
+		pack2: {blob, {Type: restic.TreeBlob, ID: restic.NewRandomID(), Offset: 23, Length: 42}},
+	}}
+
+	ri := repository.NewReverseIndex()
+	lister := ri.Lister(l)
+
+	for i := 0; i < 2; i++ {
+		for id, blobs := range l.packs {
+			list, size, err := lister.ListPack(context.TODO(), id, 100)
+			rtest.OK(t, err)
+			rtest.Equals(t, int64(100), size)
+			rtest.Equals(t, blobs, list)
+		}
+	}
+
+	// the headers are only read once
+	rtest.Equals(t, 2, l.calls)
+
+	// a pack with a different size is read again
+	_, _, err := lister.ListPack(context.TODO(), pack1, 99)
+	rtest.OK(t, err)
+	rtest.Equals(t, 3, l.calls)
+
+	packs := ri.Lookup(restic.BlobHandle{ID: blob.ID, Type: blob.Type})
+	rtest.Equals(t, 2, len(packs))
+
+	ri.Retain(restic.NewIDSet(pack2))
+	rtest.Equals(t, 1, ri.Len())
+	rtest.Equals(t, restic.IDs{pack2}, ri.Lookup(restic.BlobHandle{ID: blob.ID, Type: blob.Type}))
+}
+
+func TestReverseIndexSaveLoad(t *testing.T) {
+	be, cleanup := repository.TestBackend(t)
+	defer cleanup()
+
+	c, cleanupCache := cache.TestNewCache(t)
+	defer cleanupCache()
+
+	r, _ := repository.TestRepositoryWithBackend(t, be)
+	repo := r.(*repository.Repository)
+	repo.UseCache(c)
+
+	packID := restic.NewRandomID()
+	blobs := []restic.Blob{{Type: restic.DataBlob, ID: restic.NewRandomID(), Length: 23}}
+	repo.ReverseIndex().AddPack(packID, 123, blobs)
+	rtest.OK(t, repo.SaveReverseIndex())
+
+	repo2 := repository.New(be)
+	rtest.OK(t, repo2.SearchKey(context.TODO(), rtest.TestPassword, 10))
+	repo2.UseCache(c)
+
+	list, size, ok := repo2.ReverseIndex().ListPack(packID)
+	rtest.Assert(t, ok, "pack %v not found in the loaded reverse index", packID.Str())
+	rtest.Equals(t, int64(123), size)
+	rtest.Equals(t, blobs, list)
+}
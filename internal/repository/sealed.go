@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// ErrRepositorySealed is returned when a sealed repository would be modified.
+var ErrRepositorySealed = errors.New("repository is sealed")
+
+// sealedBackend rejects saving and removing files while the config of the
+// repository contains a seal. Locks, keys and the config itself can still be
+// changed, so that the repository can be read and unsealed again.
+type sealedBackend struct {
+	restic.Backend
+	repo *Repository
+}
+
+// statically ensure that sealedBackend implements restic.Backend.
+var _ restic.Backend = &sealedBackend{}
+
+func (be *sealedBackend) check(h restic.Handle) error {
+	if be.repo.cfg.Seal == nil {
+		return nil
+	}
+
+	switch h.Type {
+	case restic.LockFile, restic.KeyFile, restic.ConfigFile, restic.NewConfigFile:
+		return nil
+	}
+
+	return errors.Wrapf(ErrRepositorySealed, "unable to modify %v", h)
+}
+
+// Save stores the data in the backend under the given handle, unless the
+// repository is sealed.
+func (be *sealedBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	if err := be.check(h); err != nil {
+		return err
+	}
+	return be.Backend.Save(ctx, h, rd)
+}
+
+// Remove removes the file with the given handle, unless the repository is
+// sealed.
+func (be *sealedBackend) Remove(ctx context.Context, h restic.Handle) error {
+	if err := be.check(h); err != nil {
+		return err
+	}
+	return be.Backend.Remove(ctx, h)
+}
+
+// Rename moves a file to another handle, unless the repository is sealed. If
+// the wrapped backend does not implement restic.Renamer,
+// restic.ErrRenameUnsupported is returned.
+func (be *sealedBackend) Rename(ctx context.Context, from, to restic.Handle) error {
+	r, ok := be.Backend.(restic.Renamer)
+	if !ok {
+		return restic.ErrRenameUnsupported
+	}
+
+	if err := be.check(from); err != nil {
+		return err
+	}
+	if err := be.check(to); err != nil {
+		return err
+	}
+	return r.Rename(ctx, from, to)
+}
+
+// ListVersion returns the list version reported by the wrapped backend. If it
+// does not implement restic.ListVersioner, the empty string is returned.
+func (be *sealedBackend) ListVersion(ctx context.Context, t restic.FileType) (string, error) {
+	lv, ok := be.Backend.(restic.ListVersioner)
+	if !ok {
+		return "", nil
+	}
+
+	return lv.ListVersion(ctx, t)
+}
@@ -0,0 +1,59 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestSealedRepository(t *testing.T) {
+	be, cleanup := repository.TestBackend(t)
+	defer cleanup()
+
+	r, _ := repository.TestRepositoryWithBackend(t, be)
+	repo := r.(*repository.Repository)
+	ctx := context.TODO()
+
+	restic.TestCreateSnapshot(t, repo, time.Unix(1460289341, 207401672), 2, 0)
+
+	manifest, err := restic.NewSealManifest(ctx, repo.Backend())
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, manifest.Snapshots.Count)
+	rtest.Assert(t, manifest.Data.Count > 0, "no data files in manifest")
+
+	cfg := repo.Config()
+	cfg.Seal = &restic.Seal{Time: time.Now(), Manifest: manifest}
+	rtest.OK(t, repo.SaveConfig(ctx, cfg))
+
+	_, err = repo.SaveJSONUnpacked(ctx, restic.SnapshotFile, restic.Snapshot{Time: time.Now()})
+	rtest.Assert(t, errors.Cause(err) == repository.ErrRepositorySealed, "wrong error for saving a snapshot: %v", err)
+
+	// locks are still possible, also for a repository opened afterwards
+	repo2 := repository.New(be)
+	rtest.OK(t, repo2.SearchKey(ctx, rtest.TestPassword, 10))
+	lock, err := restic.NewLock(ctx, repo2)
+	rtest.OK(t, err)
+	rtest.OK(t, lock.Unlock())
+
+	err = repo2.Backend().Remove(ctx, restic.Handle{Type: restic.IndexFile, Name: restic.NewRandomID().String()})
+	rtest.Assert(t, errors.Cause(err) == repository.ErrRepositorySealed, "wrong error for removing a file: %v", err)
+
+	// the manifest is unchanged by the failed attempts
+	m, err := restic.NewSealManifest(ctx, repo2.Backend())
+	rtest.OK(t, err)
+	rtest.Equals(t, manifest, m)
+
+	cfg.Seal = nil
+	rtest.OK(t, repo2.SaveConfig(ctx, cfg))
+	restic.TestCreateSnapshot(t, repo2, time.Unix(1460289342, 207401672), 2, 0)
+
+	m, err = restic.NewSealManifest(ctx, repo2.Backend())
+	rtest.OK(t, err)
+	rtest.Equals(t, 2, m.Snapshots.Count)
+	rtest.Assert(t, m.Snapshots.Hash != manifest.Snapshots.Hash, "hash of snapshots did not change")
+}
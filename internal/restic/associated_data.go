@@ -0,0 +1,59 @@
+package restic
+
+import (
+	"github.com/restic/restic/internal/crypto"
+)
+
+// BindsData returns true if all blobs and files in the repository are bound to
+// the repository ID. Data which has been moved from a different repository
+// with the same key is then rejected.
+func (c Config) BindsData() bool {
+	return c.Version >= RepoVersionAssociatedData
+}
+
+// BlobAssociatedData returns the additional data which is authenticated
+// together with the blob id of type t in repositories which bind their data.
+// The blob cannot be moved to a different repository, and cannot be passed off
+// as a blob with a different type or ID.
+func (c Config) BlobAssociatedData(t BlobType, id ID) []byte {
+	return []byte("restic/blob/" + c.ID + "/" + t.String() + "/" + id.String())
+}
+
+// FileAssociatedData returns the additional data which is authenticated
+// together with files of type t, e.g. snapshots and indexes. The config is
+// read before the ID of the repository is known, so nothing is returned for
+// it and for a new config.
+func (c Config) FileAssociatedData(t FileType) []byte {
+	if t == ConfigFile || t == NewConfigFile {
+		return nil
+	}
+	return []byte("restic/file/" + c.ID + "/" + string(t))
+}
+
+// SetUnbound is used while a repository is migrated to bind its data. Only
+// the files in ids, which have been listed when the migration started, are
+// then accepted without additional data, see Open.
+func (c *Config) SetUnbound(ids IDSet) {
+	c.unbound = &ids
+}
+
+// Open authenticates and decrypts buf, which contains the nonce followed by
+// the ciphertext. The plaintext is stored in buf after the nonce. The data
+// has been read from the file with the given ID, for blobs this is the pack
+// file. In repositories which bind their data, additionalData must match the
+// data which was passed to Seal. Older repositories may contain data with and
+// without additional data after an interrupted migration, so both are
+// accepted there. While the migration is running, data without additional
+// data is only accepted from the files passed to SetUnbound.
+func (c Config) Open(key *crypto.Key, buf, additionalData []byte, file ID) ([]byte, error) {
+	nonce, ciphertext := buf[:key.NonceSize()], buf[key.NonceSize():]
+	if c.BindsData() || (c.unbound != nil && !(*c.unbound).Has(file)) {
+		return key.Open(ciphertext[:0], nonce, ciphertext, additionalData)
+	}
+
+	plaintext, err := key.Open(ciphertext[:0], nonce, ciphertext, nil)
+	if err == crypto.ErrUnauthenticated && len(additionalData) > 0 {
+		plaintext, err = key.Open(ciphertext[:0], nonce, ciphertext, additionalData)
+	}
+	return plaintext, err
+}
@@ -3,6 +3,9 @@ package restic
 import (
 	"context"
 	"io"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
 )
 
 // Backend is used to store and access data.
@@ -58,4 +61,32 @@ type Backend interface {
 type FileInfo struct {
 	Size int64
 	Name string
+
+	// ModTime and StorageClass are only set by List for backends which
+	// report them, otherwise they are the zero value.
+	ModTime      time.Time
+	StorageClass string
+}
+
+// ListVersioner is implemented by backends which can cheaply report a version
+// for the list of files of a type. The version changes whenever a file of the
+// type is added or removed, so a listing can be cached and reused as long as
+// the version stays the same. An empty version means that the listing must
+// not be cached.
+type ListVersioner interface {
+	ListVersion(ctx context.Context, t FileType) (string, error)
+}
+
+// ErrRenameUnsupported is returned by Renamer.Rename when the underlying
+// backend cannot rename files.
+var ErrRenameUnsupported = errors.New("renaming files is not supported by the backend")
+
+// Renamer is implemented by backends which can move a file to another handle
+// without transferring its content, e.g. by renaming it in a file system.
+// Backends which wrap another backend implement it as well and return
+// ErrRenameUnsupported if the wrapped backend does not.
+type Renamer interface {
+	// Rename moves the file from to the handle to. It fails if a file with
+	// the handle to already exists.
+	Rename(ctx context.Context, from, to Handle) error
 }
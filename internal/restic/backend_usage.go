@@ -0,0 +1,26 @@
+package restic
+
+// BackendUsage counts the requests sent to a backend and the data
+// transferred, so that the costs of an operation can be attributed on
+// storage providers which bill for requests and egress.
+type BackendUsage struct {
+	// Location describes the backend, without passwords.
+	Location string `json:"location"`
+
+	BytesUploaded   uint64 `json:"bytes_uploaded"`
+	BytesDownloaded uint64 `json:"bytes_downloaded"`
+
+	// Requests by class: PUT for saving files, GET for loading them, HEAD
+	// for Stat and Test, LIST for listing files and DELETE for removing
+	// them. A LIST request returns at most 1000 files.
+	PutRequests    uint64 `json:"put_requests"`
+	GetRequests    uint64 `json:"get_requests"`
+	HeadRequests   uint64 `json:"head_requests"`
+	ListRequests   uint64 `json:"list_requests"`
+	DeleteRequests uint64 `json:"delete_requests"`
+}
+
+// Requests returns the number of requests of all classes.
+func (u BackendUsage) Requests() uint64 {
+	return u.PutRequests + u.GetRequests + u.HeadRequests + u.ListRequests + u.DeleteRequests
+}
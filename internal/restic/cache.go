@@ -34,4 +34,13 @@ type Cache interface {
 
 	// Has returns true if the file is cached.
 	Has(Handle) bool
+
+	// LoadStats returns the stats stored for the snapshot with the given id.
+	LoadStats(id ID) ([]byte, error)
+
+	// SaveStats stores the stats for the snapshot with the given id.
+	SaveStats(id ID, buf []byte) error
+
+	// ClearStats removes the stats of all snapshots not contained in the set.
+	ClearStats(valid IDSet) error
 }
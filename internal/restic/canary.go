@@ -0,0 +1,82 @@
+package restic
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// DefaultCanarySize is the size of the content of a canary in bytes.
+const DefaultCanarySize = 64 * 1024
+
+// Canary is a small data blob with known content which is saved together with
+// a snapshot. Loading it again and comparing it to the expected content tests
+// the whole path the data of a backup takes: encryption, upload, download and
+// decryption.
+//
+// The blob is referenced by the snapshot only, it is not part of the tree.
+type Canary struct {
+	// Seed is used to generate the content, it is chosen randomly for each
+	// snapshot so that the blob is uploaded every time.
+	Seed ID   `json:"seed"`
+	Size uint `json:"size"`
+	Blob ID   `json:"blob"`
+}
+
+// CanaryContent returns the content of a canary for seed, which is the SHA-256
+// hash of seed and a counter, repeated until size bytes are filled.
+func CanaryContent(seed ID, size uint) []byte {
+	buf := make([]byte, 0, size+sha256.Size)
+
+	var block [len(seed) + 8]byte
+	copy(block[:], seed[:])
+	for i := uint64(0); uint(len(buf)) < size; i++ {
+		binary.LittleEndian.PutUint64(block[len(seed):], i)
+		sum := sha256.Sum256(block[:])
+		buf = append(buf, sum[:]...)
+	}
+
+	return buf[:size]
+}
+
+// SaveCanary saves a new canary with a random seed in repo. The blob is not
+// flushed.
+func SaveCanary(ctx context.Context, repo Repository) (*Canary, error) {
+	c := &Canary{
+		Seed: NewRandomID(),
+		Size: DefaultCanarySize,
+	}
+
+	buf := CanaryContent(c.Seed, c.Size)
+	id, err := repo.SaveBlob(ctx, DataBlob, buf, Hash(buf))
+	if err != nil {
+		return nil, err
+	}
+
+	c.Blob = id
+	return c, nil
+}
+
+// VerifyCanary loads the blob of c from repo and compares it to the expected
+// content.
+func VerifyCanary(ctx context.Context, repo Repository, c *Canary) error {
+	want := CanaryContent(c.Seed, c.Size)
+	if id := Hash(want); id != c.Blob {
+		return errors.Errorf("canary blob %v does not match the content for seed %v", c.Blob.Str(), c.Seed.Str())
+	}
+
+	buf := make([]byte, CiphertextLength(int(c.Size)))
+	n, err := repo.LoadBlob(ctx, DataBlob, c.Blob, buf)
+	if err != nil {
+		return errors.Wrapf(err, "unable to load canary blob %v", c.Blob.Str())
+	}
+
+	if !bytes.Equal(buf[:n], want) {
+		return errors.Errorf("canary blob %v has wrong content", c.Blob.Str())
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package restic_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestCanaryContent(t *testing.T) {
+	seed := restic.NewRandomID()
+
+	buf := restic.CanaryContent(seed, 1000)
+	rtest.Equals(t, 1000, len(buf))
+	rtest.Assert(t, bytes.Equal(buf, restic.CanaryContent(seed, 1000)),
+		"content for the same seed differs")
+	rtest.Assert(t, !bytes.Equal(buf, restic.CanaryContent(restic.NewRandomID(), 1000)),
+		"content for different seeds is the same")
+}
+
+func TestCanary(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	c, err := restic.SaveCanary(context.TODO(), repo)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Flush(context.TODO()))
+
+	rtest.OK(t, restic.VerifyCanary(context.TODO(), repo, c))
+
+	wrongSeed := *c
+	wrongSeed.Seed = restic.NewRandomID()
+	rtest.Assert(t, restic.VerifyCanary(context.TODO(), repo, &wrongSeed) != nil,
+		"no error returned for a canary with a different seed")
+
+	missing := *c
+	missing.Size--
+	missing.Blob = restic.Hash(restic.CanaryContent(missing.Seed, missing.Size))
+	rtest.Assert(t, restic.VerifyCanary(context.TODO(), repo, &missing) != nil,
+		"no error returned for a canary whose blob is not in the repository")
+}
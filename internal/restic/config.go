@@ -16,12 +16,52 @@ type Config struct {
 	Version           uint        `json:"version"`
 	ID                string      `json:"id"`
 	ChunkerPolynomial chunker.Pol `json:"chunker_polynomial"`
+
+	// Encryption is empty for repositories which encrypt all data, or
+	// EncryptionNone if the data is only authenticated.
+	Encryption string `json:"encryption,omitempty"`
+
+	// Seal is set when the repository has been sealed and must not be
+	// modified any more.
+	Seal *Seal `json:"seal,omitempty"`
+
+	// unbound contains the files which may have been saved without
+	// additional data while the repository is migrated, see SetUnbound. A
+	// pointer is used, so that configs can still be compared.
+	unbound *IDSet
 }
 
+// EncryptionNone is set in the config of a repository where the data is
+// stored in plaintext, only the config and the keys are encrypted.
+const EncryptionNone = "none"
+
 // RepoVersion is the version that is written to the config when a repository
 // is newly created with Init().
 const RepoVersion = 1
 
+// RepoVersionAssociatedData is the first repository version in which all
+// blobs and files are bound to the repository ID, see BlobAssociatedData.
+const RepoVersionAssociatedData = 2
+
+// RepoVersionCompression is the first repository version in which data and
+// tree blobs may be compressed with zstd before they are encrypted. It also
+// binds the data like RepoVersionAssociatedData.
+const RepoVersionCompression = 3
+
+// MaxRepoVersion is the highest repository version which is supported.
+const MaxRepoVersion = RepoVersionCompression
+
+// RepoVersionNoEncryption is the lowest repository version which may store
+// the data without encryption, see EncryptionNone. Versions of restic which
+// do not know the field Encryption only accept version 1, so they refuse to
+// open the repository instead of decrypting plaintext data.
+const RepoVersionNoEncryption = RepoVersionAssociatedData
+
+// Compresses returns true if blobs may be stored compressed in the repository.
+func (c Config) Compresses() bool {
+	return c.Version >= RepoVersionCompression
+}
+
 // JSONUnpackedLoader loads unpacked JSON.
 type JSONUnpackedLoader interface {
 	LoadJSONUnpacked(context.Context, FileType, ID, interface{}) error
@@ -59,16 +99,26 @@ func TestCreateConfig(t testing.TB, pol chunker.Pol) (cfg Config) {
 
 // LoadConfig returns loads, checks and returns the config for a repository.
 func LoadConfig(ctx context.Context, r JSONUnpackedLoader) (Config, error) {
+	return loadConfig(ctx, r, ConfigFile, ID{})
+}
+
+// LoadNewConfig loads and checks the new config with the given ID, which is
+// saved before the config of a repository is replaced.
+func LoadNewConfig(ctx context.Context, r JSONUnpackedLoader, id ID) (Config, error) {
+	return loadConfig(ctx, r, NewConfigFile, id)
+}
+
+func loadConfig(ctx context.Context, r JSONUnpackedLoader, t FileType, id ID) (Config, error) {
 	var (
 		cfg Config
 	)
 
-	err := r.LoadJSONUnpacked(ctx, ConfigFile, ID{}, &cfg)
+	err := r.LoadJSONUnpacked(ctx, t, id, &cfg)
 	if err != nil {
 		return Config{}, err
 	}
 
-	if cfg.Version != RepoVersion {
+	if cfg.Version < RepoVersion || cfg.Version > MaxRepoVersion {
 		return Config{}, errors.New("unsupported repository version")
 	}
 
@@ -76,5 +126,13 @@ func LoadConfig(ctx context.Context, r JSONUnpackedLoader) (Config, error) {
 		return Config{}, errors.New("invalid chunker polynomial")
 	}
 
+	if cfg.Encryption != "" && cfg.Encryption != EncryptionNone {
+		return Config{}, errors.Errorf("unsupported encryption %q", cfg.Encryption)
+	}
+
+	if cfg.Encryption == EncryptionNone && cfg.Version < RepoVersionNoEncryption {
+		return Config{}, errors.Errorf("repository version %d does not support encryption %q", cfg.Version, cfg.Encryption)
+	}
+
 	return cfg, nil
 }
@@ -53,3 +53,34 @@ func TestConfig(t *testing.T) {
 	rtest.Assert(t, cfg1 == cfg2,
 		"configs aren't equal: %v != %v", cfg1, cfg2)
 }
+
+func TestConfigEncryptionVersion(t *testing.T) {
+	cfg, err := restic.CreateConfig()
+	rtest.OK(t, err)
+	cfg.Encryption = restic.EncryptionNone
+
+	load := func(ctx context.Context, tpe restic.FileType, id restic.ID, arg interface{}) error {
+		*arg.(*restic.Config) = cfg
+		return nil
+	}
+
+	var tests = []struct {
+		version uint
+		valid   bool
+	}{
+		{restic.RepoVersion, false},
+		{restic.RepoVersionNoEncryption, true},
+		{restic.MaxRepoVersion, true},
+	}
+
+	for _, test := range tests {
+		cfg.Version = test.version
+		_, err := restic.LoadConfig(context.TODO(), loader(load))
+		if test.valid && err != nil {
+			t.Errorf("version %d: unexpected error: %v", test.version, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("version %d: expected error not found", test.version)
+		}
+	}
+}
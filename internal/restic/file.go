@@ -11,12 +11,16 @@ type FileType string
 
 // These are the different data types a backend can store.
 const (
-	DataFile     FileType = "data"
-	KeyFile               = "key"
-	LockFile              = "lock"
-	SnapshotFile          = "snapshot"
-	IndexFile             = "index"
-	ConfigFile            = "config"
+	DataFile      FileType = "data"
+	KeyFile                = "key"
+	LockFile               = "lock"
+	SnapshotFile           = "snapshot"
+	IndexFile              = "index"
+	ConfigFile             = "config"
+	StatsFile              = "stats"
+	TrashFile              = "trash"
+	LedgerFile             = "ledger"
+	NewConfigFile          = "newconfig"
 )
 
 // Handle is used to store and access data in a backend.
@@ -46,6 +50,10 @@ func (h Handle) Valid() error {
 	case SnapshotFile:
 	case IndexFile:
 	case ConfigFile:
+	case StatsFile:
+	case TrashFile:
+	case LedgerFile:
+	case NewConfigFile:
 	default:
 		return errors.Errorf("invalid Type %q", h.Type)
 	}
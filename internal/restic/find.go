@@ -6,7 +6,16 @@ import "context"
 // blobs) to the set blobs. The tree blobs in the `seen` BlobSet will not be visited
 // again.
 func FindUsedBlobs(ctx context.Context, repo Repository, treeID ID, blobs BlobSet, seen BlobSet) error {
-	blobs.Insert(BlobHandle{ID: treeID, Type: TreeBlob})
+	return FindUsedBlobsOrdered(ctx, repo, treeID, blobs, seen, nil)
+}
+
+// FindUsedBlobsOrdered works like FindUsedBlobs, but additionally records in
+// order the sequence in which the blobs are referenced. If order is nil, it is
+// ignored.
+func FindUsedBlobsOrdered(ctx context.Context, repo Repository, treeID ID, blobs BlobSet, seen BlobSet, order BlobOrder) error {
+	h := BlobHandle{ID: treeID, Type: TreeBlob}
+	blobs.Insert(h)
+	order.Insert(h)
 
 	tree, err := repo.LoadTree(ctx, treeID)
 	if err != nil {
@@ -17,7 +26,16 @@ func FindUsedBlobs(ctx context.Context, repo Repository, treeID ID, blobs BlobSe
 		switch node.Type {
 		case "file":
 			for _, blob := range node.Content {
-				blobs.Insert(BlobHandle{ID: blob, Type: DataBlob})
+				h := BlobHandle{ID: blob, Type: DataBlob}
+				blobs.Insert(h)
+				order.Insert(h)
+			}
+			for _, stream := range node.Streams {
+				for _, blob := range stream.Content {
+					h := BlobHandle{ID: blob, Type: DataBlob}
+					blobs.Insert(h)
+					order.Insert(h)
+				}
 			}
 		case "dir":
 			subtreeID := *node.Subtree
@@ -28,7 +46,7 @@ func FindUsedBlobs(ctx context.Context, repo Repository, treeID ID, blobs BlobSe
 
 			seen.Insert(h)
 
-			err := FindUsedBlobs(ctx, repo, subtreeID, blobs, seen)
+			err := FindUsedBlobsOrdered(ctx, repo, subtreeID, blobs, seen, order)
 			if err != nil {
 				return err
 			}
@@ -37,3 +55,32 @@ func FindUsedBlobs(ctx context.Context, repo Repository, treeID ID, blobs BlobSe
 
 	return nil
 }
+
+// BlobOrder records the position at which each blob was referenced first
+// while traversing trees. Blobs which belong to the same file or directory
+// get adjacent positions, so storing blobs sorted by their position keeps
+// data which is restored together close to each other.
+type BlobOrder map[BlobHandle]int
+
+// NewBlobOrder returns a new, empty BlobOrder.
+func NewBlobOrder() BlobOrder {
+	return make(BlobOrder)
+}
+
+// Insert appends h to the order, unless it has been seen before. Calling
+// Insert on a nil BlobOrder does nothing.
+func (o BlobOrder) Insert(h BlobHandle) {
+	if o == nil {
+		return
+	}
+
+	if _, ok := o[h]; !ok {
+		o[h] = len(o)
+	}
+}
+
+// Position returns the position of h and whether h is contained in the order.
+func (o BlobOrder) Position(h BlobHandle) (int, bool) {
+	pos, ok := o[h]
+	return pos, ok
+}
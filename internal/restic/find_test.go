@@ -118,6 +118,43 @@ func TestFindUsedBlobs(t *testing.T) {
 	}
 }
 
+func TestFindUsedBlobsOrdered(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	sn := restic.TestCreateSnapshot(t, repo, findTestTime, findTestDepth, 0)
+
+	usedBlobs := restic.NewBlobSet()
+	order := restic.NewBlobOrder()
+	err := restic.FindUsedBlobsOrdered(context.TODO(), repo, *sn.Tree, usedBlobs, restic.NewBlobSet(), order)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(order) != len(usedBlobs) {
+		t.Fatalf("wrong number of blobs in order, want %d, got %d", len(usedBlobs), len(order))
+	}
+
+	pos, ok := order.Position(restic.BlobHandle{ID: *sn.Tree, Type: restic.TreeBlob})
+	if !ok || pos != 0 {
+		t.Errorf("root tree has wrong position %v (found %v), want 0", pos, ok)
+	}
+
+	seen := make(map[int]bool)
+	for h := range usedBlobs {
+		pos, ok := order.Position(h)
+		if !ok {
+			t.Errorf("blob %v not contained in order", h)
+			continue
+		}
+
+		if pos < 0 || pos >= len(order) || seen[pos] {
+			t.Errorf("invalid or duplicate position %d for blob %v", pos, h)
+		}
+		seen[pos] = true
+	}
+}
+
 func BenchmarkFindUsedBlobs(b *testing.B) {
 	repo, cleanup := repository.TestRepository(b)
 	defer cleanup()
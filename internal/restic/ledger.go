@@ -0,0 +1,157 @@
+package restic
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// Ledger records when each pack file was last read and verified completely,
+// e.g. by "check --read-data". It is saved in the repository, so that the
+// data can be verified progressively over several runs.
+type Ledger struct {
+	verified map[ID]time.Time
+}
+
+// ledgerFile is the format of a ledger saved in the repository.
+type ledgerFile struct {
+	Time  time.Time     `json:"time"`
+	Packs []ledgerEntry `json:"packs"`
+}
+
+type ledgerEntry struct {
+	ID       ID        `json:"id"`
+	Verified time.Time `json:"verified"`
+}
+
+// NewLedger returns an empty ledger.
+func NewLedger() *Ledger {
+	return &Ledger{verified: make(map[ID]time.Time)}
+}
+
+// Verified records that pack id has been verified at t. An earlier time does
+// not replace a later one.
+func (l *Ledger) Verified(id ID, t time.Time) {
+	if last, ok := l.verified[id]; ok && !t.After(last) {
+		return
+	}
+	l.verified[id] = t
+}
+
+// LastVerified returns when pack id has been verified the last time.
+func (l *Ledger) LastVerified(id ID) (t time.Time, ok bool) {
+	t, ok = l.verified[id]
+	return t, ok
+}
+
+// Order sorts packs so that the packs which have never been verified come
+// first, followed by the packs which have been verified the longest time ago.
+func (l *Ledger) Order(packs IDs) {
+	sort.SliceStable(packs, func(i, j int) bool {
+		ti, oki := l.verified[packs[i]]
+		tj, okj := l.verified[packs[j]]
+		if oki != okj {
+			return !oki
+		}
+		return ti.Before(tj)
+	})
+}
+
+// LedgerCoverage describes how much of the data in a repository has been
+// verified.
+type LedgerCoverage struct {
+	Packs    int
+	Verified int
+	// Oldest is the time of the oldest verification of a pack. When all
+	// packs have been verified, all data was verified since this time.
+	Oldest time.Time
+}
+
+// Coverage returns the coverage of the ledger for the packs in the repository.
+func (l *Ledger) Coverage(packs IDSet) LedgerCoverage {
+	c := LedgerCoverage{Packs: len(packs)}
+	for id := range packs {
+		t, ok := l.verified[id]
+		if !ok {
+			continue
+		}
+
+		c.Verified++
+		if c.Oldest.IsZero() || t.Before(c.Oldest) {
+			c.Oldest = t
+		}
+	}
+	return c
+}
+
+// LoadLedger loads all ledgers saved in the repository and merges them. The
+// IDs of the files are returned, so that they can be removed when the merged
+// ledger has been saved.
+func LoadLedger(ctx context.Context, repo Repository) (*Ledger, IDs, error) {
+	l := NewLedger()
+
+	var ids IDs
+	err := repo.List(ctx, LedgerFile, func(id ID, size int64) error {
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil && repo.Backend().IsNotExist(err) {
+		// the ledger directory is only created with the first ledger
+		debug.Log("no ledger found: %v", err)
+		return l, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, id := range ids {
+		var f ledgerFile
+		err = repo.LoadJSONUnpacked(ctx, LedgerFile, id, &f)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "ledger %v", id.Str())
+		}
+
+		for _, e := range f.Packs {
+			l.Verified(e.ID, e.Verified)
+		}
+	}
+
+	return l, ids, nil
+}
+
+// SaveLedger saves the entries of the ledger for the packs in the repository
+// and removes the ledger files in obsolete, which have been merged into it.
+func SaveLedger(ctx context.Context, repo Repository, l *Ledger, packs IDSet, obsolete IDs) (ID, error) {
+	f := ledgerFile{Time: time.Now()}
+	for id, t := range l.verified {
+		if packs.Has(id) {
+			f.Packs = append(f.Packs, ledgerEntry{ID: id, Verified: t})
+		}
+	}
+
+	sort.Slice(f.Packs, func(i, j int) bool {
+		return bytes.Compare(f.Packs[i].ID[:], f.Packs[j].ID[:]) < 0
+	})
+
+	id, err := repo.SaveJSONUnpacked(ctx, LedgerFile, f)
+	if err != nil {
+		return ID{}, err
+	}
+
+	for _, old := range obsolete {
+		if old.Equal(id) {
+			continue
+		}
+
+		err = repo.Backend().Remove(ctx, Handle{Type: LedgerFile, Name: old.String()})
+		if err != nil {
+			return id, err
+		}
+	}
+
+	return id, nil
+}
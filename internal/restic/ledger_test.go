@@ -0,0 +1,73 @@
+package restic_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestLedgerOrder(t *testing.T) {
+	now := time.Now()
+	ids := restic.IDs{restic.NewRandomID(), restic.NewRandomID(), restic.NewRandomID(), restic.NewRandomID()}
+
+	l := restic.NewLedger()
+	l.Verified(ids[0], now.Add(-time.Hour))
+	l.Verified(ids[1], now.Add(-48*time.Hour))
+	l.Verified(ids[3], now)
+	// an earlier verification does not replace a later one
+	l.Verified(ids[3], now.Add(-72*time.Hour))
+
+	packs := append(restic.IDs{}, ids...)
+	l.Order(packs)
+	rtest.Equals(t, restic.IDs{ids[2], ids[1], ids[0], ids[3]}, packs)
+
+	c := l.Coverage(restic.NewIDSet(ids...))
+	rtest.Equals(t, 4, c.Packs)
+	rtest.Equals(t, 3, c.Verified)
+	rtest.Assert(t, c.Oldest.Equal(now.Add(-48*time.Hour)), "wrong oldest verification %v", c.Oldest)
+}
+
+func TestLedgerSaveLoad(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	ctx := context.TODO()
+
+	l, obsolete, err := restic.LoadLedger(ctx, repo)
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(obsolete))
+
+	now := time.Now().Round(time.Second)
+	ids := restic.IDs{restic.NewRandomID(), restic.NewRandomID(), restic.NewRandomID()}
+	for _, id := range ids {
+		l.Verified(id, now)
+	}
+
+	// the entry for a pack which no longer exists is dropped
+	_, err = restic.SaveLedger(ctx, repo, l, restic.NewIDSet(ids[0], ids[1]), obsolete)
+	rtest.OK(t, err)
+
+	l, obsolete, err = restic.LoadLedger(ctx, repo)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(obsolete))
+
+	_, ok := l.LastVerified(ids[2])
+	rtest.Assert(t, !ok, "entry for removed pack was saved")
+
+	l.Verified(ids[1], now.Add(time.Hour))
+	_, err = restic.SaveLedger(ctx, repo, l, restic.NewIDSet(ids...), obsolete)
+	rtest.OK(t, err)
+
+	l, obsolete, err = restic.LoadLedger(ctx, repo)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(obsolete))
+
+	last, ok := l.LastVerified(ids[0])
+	rtest.Assert(t, ok && last.Equal(now), "wrong time for pack %v: %v", ids[0].Str(), last)
+	last, ok = l.LastVerified(ids[1])
+	rtest.Assert(t, ok && last.Equal(now.Add(time.Hour)), "wrong time for pack %v: %v", ids[1].Str(), last)
+}
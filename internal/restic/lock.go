@@ -218,23 +218,28 @@ func (l *Lock) Stale() bool {
 }
 
 // Refresh refreshes the lock by creating a new file in the backend with a new
-// timestamp. Afterwards the old lock is removed.
+// timestamp. Afterwards the old lock is removed. If the old lock has been
+// removed by another process in the meantime, for example because it was
+// considered stale, the new lock is kept but an error is returned: another
+// process may have held an exclusive lock in between.
 func (l *Lock) Refresh(ctx context.Context) error {
 	debug.Log("refreshing lock %v", l.lockID)
+	l.Time = time.Now()
 	id, err := l.createLock(ctx)
 	if err != nil {
 		return err
 	}
 
-	err = l.repo.Backend().Remove(context.TODO(), Handle{Type: LockFile, Name: l.lockID.String()})
-	if err != nil {
-		return err
-	}
-
-	debug.Log("new lock ID %v", id)
+	oldID := l.lockID
 	l.lockID = &id
+	debug.Log("new lock ID %v", id)
+
+	err = l.repo.Backend().Remove(context.TODO(), Handle{Type: LockFile, Name: oldID.String()})
+	if err != nil && l.repo.Backend().IsNotExist(err) {
+		return errors.Errorf("lock %v has been removed by another process", oldID.Str())
+	}
 
-	return nil
+	return err
 }
 
 func (l Lock) String() string {
@@ -256,3 +256,31 @@ func TestLockRefresh(t *testing.T) {
 		"expected a new ID after lock refresh, got the same")
 	rtest.OK(t, lock.Unlock())
 }
+
+func TestLockRefreshRemoved(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	lock, err := restic.NewLock(context.TODO(), repo)
+	rtest.OK(t, err)
+
+	// another process removes the lock, e.g. because it was considered stale
+	rtest.OK(t, restic.RemoveAllLocks(context.TODO(), repo))
+
+	err = lock.Refresh(context.TODO())
+	rtest.Assert(t, err != nil, "expected an error for a lock removed by another process")
+
+	// the refreshed lock is held again
+	var n int
+	err = repo.List(context.TODO(), restic.LockFile, func(id restic.ID, size int64) error {
+		n++
+		l, err := restic.LoadLock(context.TODO(), repo, id)
+		rtest.OK(t, err)
+		rtest.Assert(t, time.Since(l.Time) < time.Minute, "refreshed lock has an old timestamp %v", l.Time)
+		return nil
+	})
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, n)
+
+	rtest.OK(t, lock.Unlock())
+}
@@ -0,0 +1,85 @@
+package restic
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// ManifestEntry describes an item in the manifest of a snapshot.
+type ManifestEntry struct {
+	Path    string      `json:"path"`
+	Type    string      `json:"type"`
+	Size    uint64      `json:"size"`
+	Mode    os.FileMode `json:"mode"`
+	ModTime time.Time   `json:"mtime"`
+	// SHA256 is the hex encoded hash of the content, it is only set for files.
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// FileHash returns the SHA-256 hash of the content of the file. When the hash
+// has been stored during backup it is returned directly, otherwise it is
+// computed from the data stored in the repository.
+func (node Node) FileHash(ctx context.Context, repo Repository) ([]byte, error) {
+	if node.SHA256 != nil {
+		return node.SHA256[:], nil
+	}
+
+	h := sha256.New()
+	err := node.WriteContentRange(ctx, repo, 0, -1, h)
+	if err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// WalkManifest calls fn for all items below the tree in the order they are
+// stored, directories come before their content. The path of an item is the
+// slash-separated path below prefix.
+func WalkManifest(ctx context.Context, repo Repository, treeID ID, prefix string, fn func(ManifestEntry) error) error {
+	tree, err := repo.LoadTree(ctx, treeID)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range tree.Nodes {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		entry := ManifestEntry{
+			Path:    path.Join(prefix, node.Name),
+			Type:    node.Type,
+			Size:    node.Size,
+			Mode:    node.Mode,
+			ModTime: node.ModTime,
+		}
+
+		if node.Type == "file" {
+			hash, err := node.FileHash(ctx, repo)
+			if err != nil {
+				return errors.Wrapf(err, "hash %v", entry.Path)
+			}
+			entry.SHA256 = hex.EncodeToString(hash)
+		}
+
+		err = fn(entry)
+		if err != nil {
+			return err
+		}
+
+		if node.Type == "dir" && node.Subtree != nil {
+			err = WalkManifest(ctx, repo, *node.Subtree, entry.Path, fn)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
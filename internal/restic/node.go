@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/user"
+	"reflect"
 	"strconv"
 	"sync"
 	"syscall"
@@ -26,6 +28,14 @@ type ExtendedAttribute struct {
 	Value []byte `json:"value"`
 }
 
+// Stream is an alternate data stream of a file on NTFS, stored alongside the
+// main content of the file.
+type Stream struct {
+	Name    string `json:"name"`
+	Size    uint64 `json:"size"`
+	Content IDs    `json:"content"`
+}
+
 // Node is a file, directory or other item in a backup.
 type Node struct {
 	Name               string              `json:"name"`
@@ -44,9 +54,32 @@ type Node struct {
 	Links              uint64              `json:"links,omitempty"`
 	LinkTarget         string              `json:"linktarget,omitempty"`
 	ExtendedAttributes []ExtendedAttribute `json:"extended_attributes,omitempty"`
+	ACL                *fs.ACL             `json:"acl,omitempty"`
 	Device             uint64              `json:"device,omitempty"` // in case of Type == "dev", stat.st_rdev
 	Content            IDs                 `json:"content"`
 	Subtree            *ID                 `json:"subtree,omitempty"`
+	// Inline is the content of a small file, which is stored in the tree
+	// instead of a blob when requested during backup. Content is empty
+	// then.
+	Inline []byte `json:"inline,omitempty"`
+	// Holes are the ranges of a sparse file which are not allocated on
+	// disk, they are restored as holes again. The content contains zero
+	// bytes for them.
+	Holes []fs.Hole `json:"holes,omitempty"`
+	// Streams are the alternate data streams of a file on NTFS, sorted by
+	// name.
+	Streams []Stream `json:"streams,omitempty"`
+	// SHA256 is the hash of the whole content of a file, it is only stored
+	// when requested during backup.
+	SHA256 *ID `json:"sha256,omitempty"`
+	// MetadataDigest is a short digest of the metadata of the node, see
+	// ComputeMetadataDigest. It is missing for nodes saved by older
+	// versions of restic.
+	MetadataDigest string `json:"meta_digest,omitempty"`
+	// EntriesDigest is a short digest of the metadata of the entries of a
+	// directory, see ComputeEntriesDigest. It is only stored when
+	// unchanged directories may be skipped during backup.
+	EntriesDigest string `json:"entries_digest,omitempty"`
 
 	Error string `json:"error,omitempty"`
 
@@ -208,17 +241,34 @@ func (node Node) restoreMetadata(path string) error {
 		}
 	}
 
+	if node.ACL != nil {
+		if err := fs.SetACL(path, node.ACL); err != nil {
+			debug.Log("error restoring ACL for %v: %v", path, err)
+			if firsterr == nil {
+				firsterr = err
+			}
+		}
+	}
+
 	return firsterr
 }
 
+// restoreExtendedAttributes sets the extended attributes of the node on path.
+// When an attribute cannot be set, e.g. one in the trusted namespace for users
+// other than root, the remaining attributes are still restored and the first
+// error is returned.
 func (node Node) restoreExtendedAttributes(path string) error {
+	var firsterr error
 	for _, attr := range node.ExtendedAttributes {
 		err := Setxattr(path, attr.Name, attr.Value)
 		if err != nil {
-			return err
+			debug.Log("unable to restore extended attribute %v for %v: %v", attr.Name, path, err)
+			if firsterr == nil {
+				firsterr = err
+			}
 		}
 	}
-	return nil
+	return firsterr
 }
 
 func (node Node) RestoreTimestamps(path string) error {
@@ -249,14 +299,17 @@ func (node Node) createDirAt(path string) error {
 
 func (node Node) createFileAt(ctx context.Context, path string, repo Repository, idx *HardlinkIndex) error {
 	if node.Links > 1 && idx.Has(node.Inode, node.DeviceID) {
-		if err := fs.Remove(path); !os.IsNotExist(err) {
+		if err := fs.Remove(path); err != nil && !os.IsNotExist(err) {
 			return errors.Wrap(err, "RemoveCreateHardlink")
 		}
 		err := fs.Link(idx.GetFilename(node.Inode, node.DeviceID), path)
-		if err != nil {
-			return errors.Wrap(err, "CreateHardlink")
+		if err == nil {
+			return nil
 		}
-		return nil
+
+		// the target file system may not support hard links, write the
+		// content again then
+		debug.Log("unable to create hard link %v, restoring a copy: %v", path, err)
 	}
 
 	f, err := fs.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
@@ -275,6 +328,10 @@ func (node Node) createFileAt(ctx context.Context, path string, repo Repository,
 		return errors.Wrap(closeErr, "Close")
 	}
 
+	if err = node.restoreStreams(ctx, path, repo); err != nil {
+		return err
+	}
+
 	if node.Links > 1 {
 		idx.Add(node.Inode, node.DeviceID, path)
 	}
@@ -282,14 +339,118 @@ func (node Node) createFileAt(ctx context.Context, path string, repo Repository,
 	return nil
 }
 
+// restoreStreams writes the alternate data streams of the file at path. On
+// platforms without alternate data streams, they are skipped.
+func (node Node) restoreStreams(ctx context.Context, path string, repo Repository) error {
+	if !fs.StreamsSupported {
+		if len(node.Streams) > 0 {
+			debug.Log("skipping %d alternate data streams of %v", len(node.Streams), path)
+		}
+		return nil
+	}
+
+	for _, stream := range node.Streams {
+		f, err := fs.OpenFile(fs.StreamPath(path, stream.Name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return errors.Wrap(err, "OpenFile")
+		}
+
+		err = Node{Content: stream.Content}.WriteContentRange(ctx, repo, 0, -1, f)
+		closeErr := f.Close()
+
+		if err != nil {
+			return err
+		}
+
+		if closeErr != nil {
+			return errors.Wrap(closeErr, "Close")
+		}
+	}
+
+	return nil
+}
+
+// writeNodeContent writes the content of the file to f, which must be empty.
+// Blobs which only contain zero bytes and the holes of the original file are
+// left as holes in the file.
 func (node Node) writeNodeContent(ctx context.Context, repo Repository, f *os.File) error {
-	var buf []byte
+	sf := &sparseFile{f: f, holes: node.Holes}
+	err := node.WriteContentRange(ctx, repo, 0, -1, sf)
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrap(sf.Finish(), "Truncate")
+}
+
+// WriteContentRange writes length bytes of the content of the file, starting
+// at offset, to w. Only the blobs which overlap with the range are loaded from
+// the repository. A negative length writes everything up to the end of the
+// file, a range exceeding the end of the file is truncated.
+func (node Node) WriteContentRange(ctx context.Context, repo Repository, offset, length int64, w io.Writer) error {
+	if offset < 0 {
+		return errors.Errorf("invalid offset %d", offset)
+	}
+
+	var (
+		buf []byte
+		pos int64
+	)
+
+	if node.Inline != nil {
+		if offset >= int64(len(node.Inline)) {
+			return nil
+		}
+
+		data := node.Inline[offset:]
+		if length >= 0 && int64(len(data)) > length {
+			data = data[:length]
+		}
+
+		_, err := w.Write(data)
+		return errors.Wrap(err, "Write")
+	}
+
+	// the IDs of the blobs which only contain zero bytes, they are not
+	// loaded again when w can leave holes
+	hw, _ := w.(holeWriter)
+	zero := NewIDSet()
+
 	for _, id := range node.Content {
+		if length == 0 {
+			break
+		}
+
 		size, found := repo.LookupBlobSize(id, DataBlob)
 		if !found {
 			return errors.Errorf("id %v not found in repository", id)
 		}
 
+		// skip blobs before the range without loading them
+		if pos+int64(size) <= offset {
+			pos += int64(size)
+			continue
+		}
+
+		if hw != nil && zero.Has(id) {
+			n := int64(size)
+			if offset > pos {
+				n -= offset - pos
+			}
+			if length >= 0 && n > length {
+				n = length
+			}
+			pos += int64(size)
+			if length > 0 {
+				length -= n
+			}
+
+			if err := hw.WriteHole(n); err != nil {
+				return errors.Wrap(err, "WriteHole")
+			}
+			continue
+		}
+
 		buf = buf[:cap(buf)]
 		if len(buf) < CiphertextLength(int(size)) {
 			buf = NewBlobBuffer(int(size))
@@ -299,9 +460,29 @@ func (node Node) writeNodeContent(ctx context.Context, repo Repository, f *os.Fi
 		if err != nil {
 			return err
 		}
-		buf = buf[:n]
+		data := buf[:n]
 
-		_, err = f.Write(buf)
+		if offset > pos {
+			data = data[offset-pos:]
+		}
+		pos += int64(n)
+
+		if length >= 0 && int64(len(data)) > length {
+			data = data[:length]
+		}
+		if length > 0 {
+			length -= int64(len(data))
+		}
+
+		if hw != nil && IsZero(buf[:n]) {
+			zero.Insert(id)
+			if err := hw.WriteHole(int64(len(data))); err != nil {
+				return errors.Wrap(err, "WriteHole")
+			}
+			continue
+		}
+
+		_, err = w.Write(data)
 		if err != nil {
 			return errors.Wrap(err, "Write")
 		}
@@ -430,6 +611,15 @@ func (node Node) Equals(other Node) bool {
 	if !node.sameExtendedAttributes(other) {
 		return false
 	}
+	if !reflect.DeepEqual(node.ACL, other.ACL) {
+		return false
+	}
+	if !reflect.DeepEqual(node.Streams, other.Streams) {
+		return false
+	}
+	if !reflect.DeepEqual(node.Holes, other.Holes) {
+		return false
+	}
 	if node.Subtree != nil {
 		if other.Subtree == nil {
 			return false
@@ -443,6 +633,19 @@ func (node Node) Equals(other Node) bool {
 			return false
 		}
 	}
+	if node.SHA256 != nil {
+		if other.SHA256 == nil {
+			return false
+		}
+
+		if !node.SHA256.Equal(*other.SHA256) {
+			return false
+		}
+	} else {
+		if other.SHA256 != nil {
+			return false
+		}
+	}
 	if node.Error != other.Error {
 		return false
 	}
@@ -451,6 +654,10 @@ func (node Node) Equals(other Node) bool {
 }
 
 func (node Node) sameContent(other Node) bool {
+	if !bytes.Equal(node.Inline, other.Inline) {
+		return false
+	}
+
 	if node.Content == nil {
 		return other.Content == nil
 	}
@@ -517,8 +724,24 @@ func (node Node) sameExtendedAttributes(other Node) bool {
 	return true
 }
 
+// ChangeIgnoreFlags select metadata which IsNewer does not compare.
+type ChangeIgnoreFlags uint
+
+const (
+	// ChangeIgnoreCtime ignores the change time, for file systems which
+	// update it although neither the content nor the metadata changed.
+	ChangeIgnoreCtime ChangeIgnoreFlags = 1 << iota
+
+	// ChangeIgnoreInode ignores the inode, for file systems on which inode
+	// numbers are not stable, e.g. FUSE and some network file systems.
+	ChangeIgnoreInode
+)
+
 // IsNewer returns true of the file has been updated since the last Stat().
-func (node *Node) IsNewer(path string, fi os.FileInfo) bool {
+// The modification time, size, change time and inode are compared, except
+// for the metadata selected by ignore. Only the modification time and size
+// are available for files on other hosts.
+func (node *Node) IsNewer(path string, fi os.FileInfo, ignore ChangeIgnoreFlags) bool {
 	if node.Type != "file" {
 		debug.Log("node %v is newer: not file", path)
 		return true
@@ -545,8 +768,8 @@ func (node *Node) IsNewer(path string, fi os.FileInfo) bool {
 	inode := extendedStat.ino()
 
 	if !node.ModTime.Equal(fi.ModTime()) ||
-		!node.ChangeTime.Equal(changeTime(extendedStat)) ||
-		node.Inode != uint64(inode) ||
+		(ignore&ChangeIgnoreCtime == 0 && !node.ChangeTime.Equal(changeTime(extendedStat))) ||
+		(ignore&ChangeIgnoreInode == 0 && node.Inode != uint64(inode)) ||
 		node.Size != size {
 		debug.Log("node %v is newer: timestamp, size or inode changed", path)
 		return true
@@ -633,6 +856,11 @@ func lookupGroup(gid string) (string, error) {
 }
 
 func (node *Node) fillExtra(path string, fi os.FileInfo) error {
+	if rs, ok := fi.Sys().(*fs.RemoteStat); ok && rs != nil {
+		node.fillRemote(rs)
+		return nil
+	}
+
 	stat, ok := toStatT(fi.Sys())
 	if !ok {
 		return nil
@@ -676,9 +904,35 @@ func (node *Node) fillExtra(path string, fi os.FileInfo) error {
 		return err
 	}
 
+	if node.Type != "symlink" {
+		node.ACL, err = fs.GetACL(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "can not obtain ACL for %v: %v\n", path, err)
+		}
+	}
+
 	return nil
 }
 
+// fillRemote sets the metadata available for a file on another host. User
+// and group names are not resolved, as the local user database does not
+// apply there.
+func (node *Node) fillRemote(rs *fs.RemoteStat) {
+	node.UID = rs.UID
+	node.GID = rs.GID
+	node.AccessTime = rs.AccessTime
+	node.ChangeTime = node.ModTime
+
+	switch node.Type {
+	case "file", "symlink":
+		node.Links = 1
+	}
+
+	if node.Type == "symlink" {
+		node.LinkTarget = rs.LinkTarget
+	}
+}
+
 func (node *Node) fillExtendedAttributes(path string) error {
 	if node.Type == "symlink" {
 		return nil
@@ -692,9 +946,14 @@ func (node *Node) fillExtendedAttributes(path string) error {
 
 	node.ExtendedAttributes = make([]ExtendedAttribute, 0, len(xattrs))
 	for _, attr := range xattrs {
+		if fs.IsACLAttribute(attr) {
+			// saved in node.ACL
+			continue
+		}
+
 		attrVal, err := Getxattr(path, attr)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "can not obtain extended attribute %v for %v:\n", attr, path)
+			fmt.Fprintf(os.Stderr, "can not obtain extended attribute %v for %v: %v\n", attr, path, err)
 			continue
 		}
 		attr := ExtendedAttribute{
@@ -0,0 +1,152 @@
+package restic
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+
+	"github.com/restic/restic/internal/fs"
+)
+
+// nodeMetadata contains the metadata of a node which is covered by the
+// metadata digest. Timestamps are stored as nanoseconds, so that the same
+// instant in different time zones results in the same digest.
+type nodeMetadata struct {
+	Type               string              `json:"type"`
+	Mode               os.FileMode         `json:"mode"`
+	ModTime            int64               `json:"mtime"`
+	AccessTime         int64               `json:"atime"`
+	ChangeTime         int64               `json:"ctime"`
+	UID                uint32              `json:"uid"`
+	GID                uint32              `json:"gid"`
+	User               string              `json:"user"`
+	Group              string              `json:"group"`
+	Inode              uint64              `json:"inode"`
+	DeviceID           uint64              `json:"device_id"`
+	Size               uint64              `json:"size"`
+	Links              uint64              `json:"links"`
+	LinkTarget         string              `json:"linktarget"`
+	Device             uint64              `json:"device"`
+	ExtendedAttributes []ExtendedAttribute `json:"extended_attributes"`
+	ACL                *fs.ACL             `json:"acl,omitempty"`
+}
+
+// metadataDigestSize is the number of bytes of the SHA-256 hash which are
+// kept for the metadata digest.
+const metadataDigestSize = 8
+
+// ComputeMetadataDigest returns a short digest of the metadata of the node,
+// i.e. everything except for the name and the content. Two nodes with the
+// same digest have the same metadata.
+func (node Node) ComputeMetadataDigest() string {
+	return node.metadataDigest(true)
+}
+
+// HasValidMetadataDigest returns true if the metadata digest stored in the
+// node matches its metadata. Earlier versions computed the digest of nodes
+// without extended attributes for a null list instead of an empty one, such
+// digests are accepted as well.
+func (node Node) HasValidMetadataDigest() bool {
+	if node.MetadataDigest == node.ComputeMetadataDigest() {
+		return true
+	}
+
+	return node.ExtendedAttributes == nil && node.MetadataDigest == node.metadataDigest(false)
+}
+
+// metadataDigest computes the metadata digest of the node. If emptyXattrs is
+// set, a missing list of extended attributes is hashed as an empty list.
+func (node Node) metadataDigest(emptyXattrs bool) string {
+	md := nodeMetadata{
+		Type:               node.Type,
+		Mode:               node.Mode,
+		ModTime:            node.ModTime.UnixNano(),
+		AccessTime:         node.AccessTime.UnixNano(),
+		ChangeTime:         node.ChangeTime.UnixNano(),
+		UID:                node.UID,
+		GID:                node.GID,
+		User:               node.User,
+		Group:              node.Group,
+		Inode:              node.Inode,
+		DeviceID:           node.DeviceID,
+		Size:               node.Size,
+		Links:              node.Links,
+		LinkTarget:         node.LinkTarget,
+		Device:             node.Device,
+		ExtendedAttributes: node.ExtendedAttributes,
+		ACL:                node.ACL,
+	}
+
+	// the archiver sets an empty list when a file has no extended attributes,
+	// which is omitted in the tree and decoded as nil, the digest must be the
+	// same for both
+	if emptyXattrs && md.ExtendedAttributes == nil {
+		md.ExtendedAttributes = []ExtendedAttribute{}
+	}
+
+	buf, err := json.Marshal(md)
+	if err != nil {
+		// cannot happen, all fields can be marshalled
+		panic(err)
+	}
+
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:metadataDigestSize])
+}
+
+// SameMetadata returns true if node and other have the same metadata. When
+// both nodes contain the same metadata digest, the fields are not compared.
+// Otherwise the digests are recomputed from the metadata fields, so nodes
+// with digests saved by different versions are still detected as equal.
+func (node Node) SameMetadata(other Node) bool {
+	if node.MetadataDigest != "" && other.MetadataDigest != "" &&
+		node.MetadataDigest == other.MetadataDigest {
+		return true
+	}
+
+	return node.ComputeMetadataDigest() == other.ComputeMetadataDigest()
+}
+
+// entryMetadata contains the metadata of a directory entry which is covered
+// by the entries digest. Files whose content is modified get a new
+// modification time, and a new change time when the metadata changes.
+type entryMetadata struct {
+	Name       string      `json:"name"`
+	Type       string      `json:"type"`
+	Mode       os.FileMode `json:"mode"`
+	ModTime    int64       `json:"mtime"`
+	ChangeTime int64       `json:"ctime"`
+	Inode      uint64      `json:"inode"`
+	DeviceID   uint64      `json:"device_id"`
+	Size       uint64      `json:"size"`
+}
+
+// ComputeEntriesDigest returns a short digest of the names and the metadata
+// of nodes, the entries of a directory sorted by name. When the digest still
+// matches the current entries of the directory, none of them has been added,
+// removed or modified.
+func ComputeEntriesDigest(nodes []*Node) string {
+	entries := make([]entryMetadata, 0, len(nodes))
+	for _, node := range nodes {
+		entries = append(entries, entryMetadata{
+			Name:       node.Name,
+			Type:       node.Type,
+			Mode:       node.Mode,
+			ModTime:    node.ModTime.UnixNano(),
+			ChangeTime: node.ChangeTime.UnixNano(),
+			Inode:      node.Inode,
+			DeviceID:   node.DeviceID,
+			Size:       node.Size,
+		})
+	}
+
+	buf, err := json.Marshal(entries)
+	if err != nil {
+		// cannot happen, all fields can be marshalled
+		panic(err)
+	}
+
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:metadataDigestSize])
+}
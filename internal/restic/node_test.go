@@ -1,6 +1,7 @@
 package restic_test
 
 import (
+	"bytes"
 	"context"
 	"io/ioutil"
 	"os"
@@ -9,6 +10,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
 )
@@ -245,3 +248,199 @@ func AssertFsTimeEqual(t *testing.T, label string, nodeType string, t1 time.Time
 
 	rtest.Assert(t, equal, "%s: %s doesn't match (%v != %v)", label, nodeType, t1, t2)
 }
+
+func TestNodeWriteContentRange(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	var (
+		node = restic.Node{Name: "file", Type: "file"}
+		data []byte
+	)
+
+	for i, size := range []int{1000, 50, 3000} {
+		buf := rtest.Random(i, size)
+		id, err := repo.SaveBlob(context.TODO(), restic.DataBlob, buf, restic.ID{})
+		rtest.OK(t, err)
+
+		node.Content = append(node.Content, id)
+		data = append(data, buf...)
+	}
+	node.Size = uint64(len(data))
+	rtest.OK(t, repo.Flush(context.TODO()))
+
+	var tests = []struct {
+		offset, length int64
+		want           []byte
+	}{
+		{0, -1, data},
+		{0, 10, data[:10]},
+		{999, 2, data[999:1001]},
+		{1000, 50, data[1000:1050]},
+		{1020, 1000, data[1020:2020]},
+		{4000, -1, data[4000:]},
+		{4000, 100, data[4000:]},
+		{5000, -1, nil},
+		{10, 0, nil},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		err := node.WriteContentRange(context.TODO(), repo, test.offset, test.length, &buf)
+		rtest.OK(t, err)
+
+		if !bytes.Equal(buf.Bytes(), test.want) {
+			t.Errorf("offset %d, length %d: wrong data returned, want %d bytes, got %d bytes",
+				test.offset, test.length, len(test.want), buf.Len())
+		}
+	}
+}
+
+func TestNodeWriteContentRangeInline(t *testing.T) {
+	data := []byte("content stored in the tree")
+	node := restic.Node{Name: "file", Type: "file", Content: restic.IDs{}, Inline: data, Size: uint64(len(data))}
+
+	var tests = []struct {
+		offset, length int64
+		want           []byte
+	}{
+		{0, -1, data},
+		{0, 7, data[:7]},
+		{8, 6, data[8:14]},
+		{8, 100, data[8:]},
+		{100, -1, nil},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		err := node.WriteContentRange(context.TODO(), nil, test.offset, test.length, &buf)
+		rtest.OK(t, err)
+
+		if !bytes.Equal(buf.Bytes(), test.want) {
+			t.Errorf("offset %d, length %d: wrong data returned, want %q, got %q",
+				test.offset, test.length, test.want, buf.Bytes())
+		}
+	}
+}
+
+func TestNodeRestoreSparse(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	tempdir, cleanupTemp := rtest.TempDir(t)
+	defer cleanupTemp()
+
+	var (
+		node = restic.Node{Name: "file", Type: "file", Mode: 0600}
+		data []byte
+	)
+
+	for _, buf := range [][]byte{
+		rtest.Random(23, 1000),
+		make([]byte, 4096),
+		make([]byte, 4096),
+		rtest.Random(42, 100),
+		make([]byte, 4096),
+	} {
+		id, err := repo.SaveBlob(context.TODO(), restic.DataBlob, buf, restic.ID{})
+		rtest.OK(t, err)
+
+		node.Content = append(node.Content, id)
+		data = append(data, buf...)
+	}
+	node.Size = uint64(len(data))
+	rtest.OK(t, repo.Flush(context.TODO()))
+
+	filename := filepath.Join(tempdir, "file")
+	rtest.OK(t, node.CreateAt(context.TODO(), filename, repo, restic.NewHardlinkIndex()))
+
+	buf, err := ioutil.ReadFile(filename)
+	rtest.OK(t, err)
+	rtest.Assert(t, bytes.Equal(buf, data), "wrong data restored, want %d bytes, got %d bytes", len(data), len(buf))
+}
+
+func TestNodeMetadataDigest(t *testing.T) {
+	node := restic.Node{
+		Name:    "foo",
+		Type:    "file",
+		Mode:    0644,
+		ModTime: parseTime("2015-05-14 21:07:23.111"),
+		UID:     1000,
+		GID:     100,
+		Content: restic.IDs{restic.NewRandomID()},
+	}
+	digest := node.ComputeMetadataDigest()
+	rtest.Equals(t, 16, len(digest))
+
+	// name, content and time zone do not change the digest
+	other := node
+	other.Name = "bar"
+	other.Content = restic.IDs{restic.NewRandomID()}
+	other.ModTime = node.ModTime.In(time.FixedZone("test", 3600))
+	rtest.Equals(t, digest, other.ComputeMetadataDigest())
+
+	// an empty list of extended attributes is omitted in the tree and decoded
+	// as nil, it must not change the digest
+	other.ExtendedAttributes = []restic.ExtendedAttribute{}
+	rtest.Equals(t, digest, other.ComputeMetadataDigest())
+
+	modify := []func(*restic.Node){
+		func(n *restic.Node) { n.Mode = 0600 },
+		func(n *restic.Node) { n.UID = 0 },
+		func(n *restic.Node) { n.Group = "users" },
+		func(n *restic.Node) { n.ModTime = n.ModTime.Add(time.Second) },
+		func(n *restic.Node) {
+			n.ExtendedAttributes = []restic.ExtendedAttribute{{Name: "user.foo", Value: []byte("bar")}}
+		},
+		func(n *restic.Node) {
+			n.ACL = &fs.ACL{Access: []fs.ACLEntry{{Tag: fs.ACLUser, ID: 1000, Perm: 4}}}
+		},
+	}
+
+	for i, fn := range modify {
+		other := node
+		fn(&other)
+		if other.ComputeMetadataDigest() == digest {
+			t.Errorf("test %d: digest did not change", i)
+		}
+		if node.SameMetadata(other) {
+			t.Errorf("test %d: SameMetadata returned true without digests", i)
+		}
+
+		node.MetadataDigest = digest
+		other.MetadataDigest = other.ComputeMetadataDigest()
+		if node.SameMetadata(other) {
+			t.Errorf("test %d: SameMetadata returned true with digests", i)
+		}
+		node.MetadataDigest = ""
+	}
+}
+
+func TestNodeMetadataDigestNullXattrs(t *testing.T) {
+	node := restic.Node{
+		Name:    "foo",
+		Type:    "file",
+		Mode:    0644,
+		ModTime: parseTime("2015-05-14 21:07:23.111"),
+		UID:     1000,
+		GID:     100,
+	}
+	rtest.Equals(t, "24e2938b8a6ceb47", node.ComputeMetadataDigest())
+
+	// digest computed for a null list of extended attributes
+	legacy := node
+	legacy.MetadataDigest = "711e710ba8136520"
+	rtest.Assert(t, legacy.HasValidMetadataDigest(), "digest for null extended attributes is not accepted")
+
+	current := node
+	current.MetadataDigest = node.ComputeMetadataDigest()
+	rtest.Assert(t, current.HasValidMetadataDigest(), "current digest is not accepted")
+	rtest.Assert(t, legacy.SameMetadata(current), "nodes with both digest forms differ")
+
+	// the legacy form is only valid for nodes without extended attributes
+	legacy.ExtendedAttributes = []restic.ExtendedAttribute{}
+	rtest.Assert(t, !legacy.HasValidMetadataDigest(), "digest for null extended attributes accepted for an empty list")
+
+	legacy.MetadataDigest = "0000"
+	rtest.Assert(t, !legacy.HasValidMetadataDigest(), "invalid digest accepted")
+}
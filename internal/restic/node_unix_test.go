@@ -3,11 +3,15 @@
 package restic
 
 import (
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"runtime"
 	"syscall"
 	"testing"
 	"time"
+
+	rtest "github.com/restic/restic/internal/test"
 )
 
 func stat(t testing.TB, filename string) (fi os.FileInfo, ok bool) {
@@ -133,3 +137,88 @@ func TestNodeFromFileInfo(t *testing.T) {
 		})
 	}
 }
+
+func TestNodeExtendedAttributes(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("test depends on the names of extended attributes on Linux")
+	}
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	src := filepath.Join(tempdir, "src")
+	rtest.OK(t, ioutil.WriteFile(src, []byte("foo"), 0600))
+
+	err := Setxattr(src, "user.restic", []byte("bar"))
+	if err != nil {
+		t.Skipf("unable to set extended attribute: %v", err)
+	}
+	names, err := Listxattr(src)
+	rtest.OK(t, err)
+	if len(names) == 0 {
+		t.Skip("extended attributes are not supported in the temporary directory")
+	}
+
+	fi, err := os.Lstat(src)
+	rtest.OK(t, err)
+	node, err := NodeFromFileInfo(src, fi)
+	rtest.OK(t, err)
+	rtest.Equals(t, []byte("bar"), node.GetExtendedAttribute("user.restic"))
+
+	dst := filepath.Join(tempdir, "dst")
+	rtest.OK(t, ioutil.WriteFile(dst, nil, 0600))
+
+	// an attribute which cannot be set does not prevent restoring the others
+	node.ExtendedAttributes = append([]ExtendedAttribute{{Name: "", Value: []byte("invalid")}}, node.ExtendedAttributes...)
+	err = node.restoreExtendedAttributes(dst)
+	rtest.Assert(t, err != nil, "invalid extended attribute was restored")
+
+	value, err := Getxattr(dst, "user.restic")
+	rtest.OK(t, err)
+	rtest.Equals(t, []byte("bar"), value)
+}
+
+func TestNodeIsNewerCtime(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	filename := filepath.Join(tempdir, "file")
+	rtest.OK(t, ioutil.WriteFile(filename, []byte("content"), 0644))
+
+	fi, err := os.Lstat(filename)
+	rtest.OK(t, err)
+	node, err := NodeFromFileInfo(filename, fi)
+	rtest.OK(t, err)
+
+	rtest.Assert(t, !node.IsNewer(filename, fi, 0), "unmodified file is newer")
+
+	// changing the mode updates the change time, but not the modification time
+	time.Sleep(20 * time.Millisecond)
+	rtest.OK(t, os.Chmod(filename, 0600))
+
+	fi, err = os.Lstat(filename)
+	rtest.OK(t, err)
+	rtest.Equals(t, node.ModTime, fi.ModTime())
+
+	rtest.Assert(t, node.IsNewer(filename, fi, 0), "file with new ctime is not newer")
+	rtest.Assert(t, !node.IsNewer(filename, fi, ChangeIgnoreCtime), "file is newer although ctime is ignored")
+}
+
+func TestNodeIsNewerInode(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	filename := filepath.Join(tempdir, "file")
+	rtest.OK(t, ioutil.WriteFile(filename, []byte("content"), 0644))
+
+	fi, err := os.Lstat(filename)
+	rtest.OK(t, err)
+	node, err := NodeFromFileInfo(filename, fi)
+	rtest.OK(t, err)
+
+	// the file system assigned a new inode number, e.g. after a remount
+	node.Inode++
+
+	rtest.Assert(t, node.IsNewer(filename, fi, 0), "file with new inode is not newer")
+	rtest.Assert(t, !node.IsNewer(filename, fi, ChangeIgnoreInode), "file is newer although the inode is ignored")
+}
@@ -3,6 +3,7 @@ package restic
 import (
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
@@ -33,7 +34,12 @@ type Progress struct {
 	OnStart  func()
 	OnUpdate ProgressFunc
 	OnDone   ProgressFunc
-	fnM      sync.Mutex
+
+	// OnFile is called for each FileEvent, it may be nil. Like OnUpdate, it
+	// is not called concurrently.
+	OnFile func(FileEvent)
+
+	fnM sync.Mutex
 
 	cur        Stat
 	curM       sync.Mutex
@@ -44,17 +50,84 @@ type Progress struct {
 	d          time.Duration
 	lastUpdate time.Time
 
+	files  map[string]*FileProgress
+	filesM sync.Mutex
+
 	running bool
 }
 
+// FileProgress describes a file which is currently being read.
+type FileProgress struct {
+	Path  string
+	Size  uint64
+	Bytes uint64
+	Start time.Time
+}
+
 // Stat captures newly done parts of the operation.
 type Stat struct {
-	Files  uint64
-	Dirs   uint64
-	Bytes  uint64
-	Trees  uint64
-	Blobs  uint64
-	Errors uint64
+	Files uint64
+	Dirs  uint64
+	Bytes uint64
+	Trees uint64
+	// Uploaded is the amount of new data which was not already stored in
+	// the repository.
+	Uploaded uint64
+	// Deduplicated is the amount of data which has been read, but was
+	// already stored in the repository.
+	Deduplicated uint64
+	Blobs        uint64
+	Errors       uint64
+
+	// FilesNew, FilesChanged and FilesUnmodified count the files by the
+	// FileAction reported for them.
+	FilesNew        uint64
+	FilesChanged    uint64
+	FilesUnmodified uint64
+}
+
+// FileAction describes how a file has been handled.
+type FileAction string
+
+// Values for FileAction.
+const (
+	// FileNew is a file which was not contained in the parent snapshot.
+	FileNew FileAction = "new"
+
+	// FileChanged is a file which was contained in the parent snapshot and
+	// has been read again because it was modified.
+	FileChanged FileAction = "changed"
+
+	// FileUnmodified is a file whose content was taken from the parent
+	// snapshot.
+	FileUnmodified FileAction = "unmodified"
+)
+
+// Types of a FileEvent.
+const (
+	FileEventStart    = "start"
+	FileEventProgress = "progress"
+	FileEventError    = "error"
+	FileEventDone     = "done"
+)
+
+// FileEvent describes a change in the state of a single file, see the
+// FileEvent* constants for the types.
+type FileEvent struct {
+	Type string
+	Path string
+
+	// Size is the size of the file, Bytes the amount of data read so far.
+	Size  uint64
+	Bytes uint64
+
+	// Action and Added (the amount of data which was not already stored in
+	// the repository) are only set for FileEventDone.
+	Action FileAction
+	Added  uint64
+
+	// Err is only set for FileEventError.
+	Err error
 }
 
 // ProgressFunc is used to report progress back to the user.
@@ -73,6 +146,16 @@ func NewProgress() *Progress {
 	return &Progress{d: d}
 }
 
+// SetInterval makes the progress reporter call OnUpdate at least every d
+// interval, even when stdout is not a terminal. It must be called before
+// Start.
+func (p *Progress) SetInterval(d time.Duration) {
+	if p == nil {
+		return
+	}
+	p.d = d
+}
+
 // Start resets and runs the progress reporter.
 func (p *Progress) Start() {
 	if p == nil || p.running {
@@ -109,6 +192,123 @@ func (p *Progress) Reset() {
 	p.curM.Lock()
 	p.cur = Stat{}
 	p.curM.Unlock()
+
+	p.filesM.Lock()
+	p.files = make(map[string]*FileProgress)
+	p.filesM.Unlock()
+}
+
+// StartFile records that the file at path with the given size is being read.
+func (p *Progress) StartFile(path string, size uint64) {
+	if p == nil || !p.running {
+		return
+	}
+
+	p.filesM.Lock()
+	p.files[path] = &FileProgress{Path: path, Size: size, Start: time.Now()}
+	p.filesM.Unlock()
+
+	p.fileEvent(FileEvent{Type: FileEventStart, Path: path, Size: size})
+}
+
+// ReportFile adds bytes to the amount of data read from the file at path.
+func (p *Progress) ReportFile(path string, bytes uint64) {
+	if p == nil || !p.running {
+		return
+	}
+
+	p.filesM.Lock()
+	f, ok := p.files[path]
+	if !ok {
+		p.filesM.Unlock()
+		return
+	}
+	f.Bytes += bytes
+	ev := FileEvent{Type: FileEventProgress, Path: path, Size: f.Size, Bytes: f.Bytes}
+	p.filesM.Unlock()
+
+	p.fileEvent(ev)
+}
+
+// ErrorFile reports that the file at path could not be saved because of err,
+// which is counted in Stat.Errors.
+func (p *Progress) ErrorFile(path string, err error) {
+	if p == nil {
+		return
+	}
+
+	p.Report(Stat{Errors: 1})
+	p.fileEvent(FileEvent{Type: FileEventError, Path: path, Err: err})
+}
+
+// CompleteFile reports that the file at path with the given size has been
+// saved, added is the amount of data which was not already stored in the
+// repository. The file is counted according to action.
+func (p *Progress) CompleteFile(path string, size uint64, action FileAction, added uint64) {
+	if p == nil {
+		return
+	}
+
+	s := Stat{Files: 1}
+	switch action {
+	case FileNew:
+		s.FilesNew = 1
+	case FileChanged:
+		s.FilesChanged = 1
+	case FileUnmodified:
+		s.FilesUnmodified = 1
+	}
+	p.Report(s)
+
+	p.fileEvent(FileEvent{
+		Type:   FileEventDone,
+		Path:   path,
+		Size:   size,
+		Bytes:  size,
+		Action: action,
+		Added:  added,
+	})
+}
+
+func (p *Progress) fileEvent(ev FileEvent) {
+	if p.OnFile == nil {
+		return
+	}
+
+	p.fnM.Lock()
+	p.OnFile(ev)
+	p.fnM.Unlock()
+}
+
+// DoneFile records that the file at path has been read completely.
+func (p *Progress) DoneFile(path string) {
+	if p == nil || !p.running {
+		return
+	}
+
+	p.filesM.Lock()
+	delete(p.files, path)
+	p.filesM.Unlock()
+}
+
+// ActiveFiles returns the files which are currently being read, ordered by
+// the time reading started.
+func (p *Progress) ActiveFiles() []FileProgress {
+	if p == nil {
+		return nil
+	}
+
+	p.filesM.Lock()
+	files := make([]FileProgress, 0, len(p.files))
+	for _, f := range p.files {
+		files = append(files, *f)
+	}
+	p.filesM.Unlock()
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Start.Before(files[j].Start)
+	})
+	return files
 }
 
 // Report adds the statistics from s to the current state and tries to report
@@ -204,11 +404,16 @@ func (p *Progress) Done() {
 // Add accumulates other into s.
 func (s *Stat) Add(other Stat) {
 	s.Bytes += other.Bytes
+	s.Uploaded += other.Uploaded
+	s.Deduplicated += other.Deduplicated
 	s.Dirs += other.Dirs
 	s.Files += other.Files
 	s.Trees += other.Trees
 	s.Blobs += other.Blobs
 	s.Errors += other.Errors
+	s.FilesNew += other.FilesNew
+	s.FilesChanged += other.FilesChanged
+	s.FilesUnmodified += other.FilesUnmodified
 }
 
 func (s Stat) String() string {
@@ -0,0 +1,88 @@
+package restic_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestProgressActiveFiles(t *testing.T) {
+	p := restic.NewProgress()
+	p.Start()
+	defer p.Done()
+
+	p.StartFile("foo", 100)
+	p.StartFile("bar", 200)
+	p.ReportFile("foo", 30)
+	p.ReportFile("foo", 20)
+	p.ReportFile("baz", 10)
+
+	files := p.ActiveFiles()
+	rtest.Equals(t, 2, len(files))
+
+	for _, f := range files {
+		switch f.Path {
+		case "foo":
+			rtest.Equals(t, uint64(100), f.Size)
+			rtest.Equals(t, uint64(50), f.Bytes)
+		case "bar":
+			rtest.Equals(t, uint64(200), f.Size)
+			rtest.Equals(t, uint64(0), f.Bytes)
+		default:
+			t.Errorf("unexpected file %v", f.Path)
+		}
+	}
+
+	p.DoneFile("foo")
+	files = p.ActiveFiles()
+	rtest.Equals(t, 1, len(files))
+	rtest.Equals(t, "bar", files[0].Path)
+
+	var nilProgress *restic.Progress
+	nilProgress.StartFile("foo", 1)
+	nilProgress.ReportFile("foo", 1)
+	nilProgress.DoneFile("foo")
+	rtest.Equals(t, 0, len(nilProgress.ActiveFiles()))
+}
+
+func TestProgressFileEvents(t *testing.T) {
+	var events []restic.FileEvent
+	var final restic.Stat
+
+	p := restic.NewProgress()
+	p.OnFile = func(ev restic.FileEvent) {
+		events = append(events, ev)
+	}
+	p.OnUpdate = func(s restic.Stat, d time.Duration, ticker bool) {}
+	p.OnDone = func(s restic.Stat, d time.Duration, ticker bool) {
+		final = s
+	}
+	p.Start()
+
+	testErr := errors.New("test error")
+
+	p.StartFile("foo", 100)
+	p.ReportFile("foo", 60)
+	p.ReportFile("foo", 40)
+	p.DoneFile("foo")
+	p.CompleteFile("foo", 100, restic.FileChanged, 60)
+	p.CompleteFile("bar", 10, restic.FileUnmodified, 0)
+	p.ReportFile("baz", 10)
+	p.ErrorFile("baz", testErr)
+	p.Done()
+
+	want := []restic.FileEvent{
+		{Type: restic.FileEventStart, Path: "foo", Size: 100},
+		{Type: restic.FileEventProgress, Path: "foo", Size: 100, Bytes: 60},
+		{Type: restic.FileEventProgress, Path: "foo", Size: 100, Bytes: 100},
+		{Type: restic.FileEventDone, Path: "foo", Size: 100, Bytes: 100, Action: restic.FileChanged, Added: 60},
+		{Type: restic.FileEventDone, Path: "bar", Size: 10, Bytes: 10, Action: restic.FileUnmodified},
+		{Type: restic.FileEventError, Path: "baz", Err: testErr},
+	}
+	rtest.Equals(t, want, events)
+
+	rtest.Equals(t, restic.Stat{Files: 2, Errors: 1, FilesChanged: 1, FilesUnmodified: 1}, final)
+}
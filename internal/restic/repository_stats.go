@@ -0,0 +1,141 @@
+package restic
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// RepositoryStats describes the size of a repository at one point in time. A
+// record is saved in the repository after each backup and prune, so that the
+// growth of the repository can be followed.
+type RepositoryStats struct {
+	Time    time.Time `json:"time"`
+	Command string    `json:"command"`
+
+	// TotalSize is the size of all pack files in the backend.
+	TotalSize uint64 `json:"total_size"`
+	PackCount uint64 `json:"pack_count"`
+
+	DataBlobs uint64 `json:"data_blobs"`
+	TreeBlobs uint64 `json:"tree_blobs"`
+	// BlobSize is the size of all unique blobs before encryption.
+	BlobSize uint64 `json:"blob_size"`
+
+	SnapshotCount uint64 `json:"snapshot_count"`
+	// RestoreSize is the sum of the restore sizes of all snapshots, it is
+	// only computed when the cache is used.
+	RestoreSize uint64 `json:"restore_size,omitempty"`
+	// DedupRatio is RestoreSize divided by BlobSize.
+	DedupRatio float64 `json:"dedup_ratio,omitempty"`
+}
+
+// ComputeRepositoryStats returns the current stats of the repository, the
+// index must be loaded. The restore size of the snapshots is only computed
+// when c is not nil, since the stats of each snapshot are cached there and do
+// not need to be computed again for each record.
+func ComputeRepositoryStats(ctx context.Context, repo Repository, c Cache, command string) (RepositoryStats, error) {
+	stats := RepositoryStats{
+		Time:    time.Now(),
+		Command: command,
+	}
+
+	err := repo.List(ctx, DataFile, func(id ID, size int64) error {
+		stats.PackCount++
+		stats.TotalSize += uint64(size)
+		return nil
+	})
+	if err != nil {
+		return RepositoryStats{}, err
+	}
+
+	blobs := NewBlobSet()
+	for pb := range repo.Index().Each(ctx) {
+		h := BlobHandle{ID: pb.ID, Type: pb.Type}
+		if blobs.Has(h) {
+			continue
+		}
+		blobs.Insert(h)
+
+		switch pb.Type {
+		case DataBlob:
+			stats.DataBlobs++
+		case TreeBlob:
+			stats.TreeBlobs++
+		}
+		stats.BlobSize += uint64(pb.DataLength())
+	}
+
+	if ctx.Err() != nil {
+		return RepositoryStats{}, ctx.Err()
+	}
+
+	err = ForAllSnapshots(ctx, repo, func(id ID, sn *Snapshot, err error) error {
+		if err != nil {
+			return errors.Errorf("Error loading snapshot %v: %v", id.Str(), err)
+		}
+
+		stats.SnapshotCount++
+		if c == nil {
+			return nil
+		}
+
+		s, err := LoadSnapshotStats(ctx, repo, c, id, sn)
+		if err != nil {
+			return err
+		}
+		stats.RestoreSize += s.TotalSize
+		return nil
+	})
+	if err != nil {
+		return RepositoryStats{}, err
+	}
+
+	if stats.RestoreSize > 0 && stats.BlobSize > 0 {
+		stats.DedupRatio = float64(stats.RestoreSize) / float64(stats.BlobSize)
+	}
+
+	return stats, nil
+}
+
+// SaveRepositoryStats stores stats as a new record in the repository.
+func SaveRepositoryStats(ctx context.Context, repo Repository, stats RepositoryStats) (ID, error) {
+	return repo.SaveJSONUnpacked(ctx, StatsFile, stats)
+}
+
+// LoadRepositoryStats returns all records saved in the repository, oldest
+// first.
+func LoadRepositoryStats(ctx context.Context, repo Repository) ([]RepositoryStats, error) {
+	var ids IDs
+	err := repo.List(ctx, StatsFile, func(id ID, size int64) error {
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil && repo.Backend().IsNotExist(err) {
+		// the stats directory is only created with the first record
+		debug.Log("no stats found: %v", err)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]RepositoryStats, 0, len(ids))
+	for _, id := range ids {
+		var stats RepositoryStats
+		err = repo.LoadJSONUnpacked(ctx, StatsFile, id, &stats)
+		if err != nil {
+			return nil, errors.Wrapf(err, "stats %v", id.Str())
+		}
+		list = append(list, stats)
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Time.Before(list[j].Time)
+	})
+
+	return list, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/restic/restic/internal/errors"
 
@@ -18,6 +19,26 @@ type Restorer struct {
 
 	Error        func(dir string, node *Node, err error) error
 	SelectFilter func(item string, dstpath string, node *Node) (selectedForRestore bool, childMayBeSelected bool)
+
+	// Harden enables checks for restoring snapshots from less-trusted
+	// sources: no symlink below the target directory is followed, so that
+	// files cannot be written outside of it.
+	Harden bool
+
+	// Sandbox additionally resolves all paths relative to the target
+	// directory with openat2(RESOLVE_BENEATH), which also protects against
+	// symlinks created concurrently by other processes. It is only supported
+	// on Linux and implies Harden.
+	Sandbox bool
+
+	// Scan, if not nil, is called for each restored file before it is put
+	// into place, files which are not accepted are not restored. Files
+	// with the verdict ScanQuarantine are moved below QuarantineDir, if set.
+	Scan          ScanFunc
+	QuarantineDir string
+
+	dst     string
+	sandbox *restoreSandbox
 }
 
 var restorerAbortOnAllErrors = func(str string, node *Node, err error) error { return err }
@@ -98,25 +119,39 @@ func (res *Restorer) restoreTo(ctx context.Context, target, location string, tre
 			if err != nil {
 				return err
 			}
-
-			// Restore directory timestamp at the end. If we would do it earlier, restoring files within
-			// the directory would overwrite the timestamp of the directory they are in.
-			err = node.RestoreTimestamps(nodeTarget)
-			if err != nil {
-				return err
-			}
 		}
 	}
 
 	return nil
 }
 
-func (res *Restorer) restoreNodeTo(ctx context.Context, node *Node, target, location string, idx *HardlinkIndex) error {
+func (res *Restorer) restoreNodeTo(ctx context.Context, node *Node, target, location string, idx *HardlinkIndex) (err error) {
 	debug.Log("%v %v %v", node.Name, target, location)
 
-	err := node.CreateAt(ctx, target, res.repo, idx)
+	path, done, err := res.prepareTarget(target, node)
 	if err != nil {
-		debug.Log("node.CreateAt(%s) error %v", target, err)
+		debug.Log("prepareTarget(%s) error %v", target, err)
+		return res.Error(location, node, err)
+	}
+	defer func() {
+		derr := done()
+		if derr != nil && err == nil {
+			debug.Log("finishing %v failed: %v", target, derr)
+			err = res.Error(location, node, derr)
+		}
+	}()
+
+	// files are scanned before they are put into place, except further hard
+	// links to a file which has already been accepted
+	createPath := path
+	scan := res.Scan != nil && node.Type == "file" && !(node.Links > 1 && idx.Has(node.Inode, node.DeviceID))
+	if scan {
+		createPath = scanTempPath(path)
+	}
+
+	err = node.CreateAt(ctx, createPath, res.repo, idx)
+	if err != nil {
+		debug.Log("node.CreateAt(%s) error %v", createPath, err)
 	}
 
 	// Did it fail because of ENOENT?
@@ -124,9 +159,22 @@ func (res *Restorer) restoreNodeTo(ctx context.Context, node *Node, target, loca
 		debug.Log("create intermediate paths")
 
 		// Create parent directories and retry
-		err = fs.MkdirAll(filepath.Dir(target), 0700)
+		err = fs.MkdirAll(filepath.Dir(createPath), 0700)
 		if err == nil || os.IsExist(errors.Cause(err)) {
-			err = node.CreateAt(ctx, target, res.repo, idx)
+			err = node.CreateAt(ctx, createPath, res.repo, idx)
+		}
+	}
+
+	if scan {
+		if err != nil {
+			// incomplete files are not left behind
+			_ = fs.Remove(createPath)
+			return res.Error(location, node, err)
+		}
+
+		err = res.scanFile(ctx, node, createPath, path, location, idx)
+		if err != nil {
+			return res.Error(location, node, err)
 		}
 	}
 
@@ -138,6 +186,62 @@ func (res *Restorer) restoreNodeTo(ctx context.Context, node *Node, target, loca
 		}
 	}
 
+	if path != target && node.Type == "file" && node.Links > 1 {
+		// the sandbox path is only valid until done is called, further
+		// hardlinks need to use the path in the target directory
+		idx.Remove(node.Inode, node.DeviceID)
+		idx.Add(node.Inode, node.DeviceID, target)
+	}
+
+	// Restore directory timestamp at the end. If we would do it earlier, restoring files within
+	// the directory would overwrite the timestamp of the directory they are in.
+	return node.RestoreTimestamps(path)
+}
+
+// prepareTarget returns the path at which node is to be created instead of
+// target. In hardened mode, an error is returned when the path would follow a
+// symlink. The function done must be called when the node has been restored.
+func (res *Restorer) prepareTarget(target string, node *Node) (path string, done func() error, err error) {
+	if res.sandbox != nil {
+		return res.sandbox.prepare(res.dst, target, node)
+	}
+
+	if res.Harden {
+		err = checkNoSymlinks(res.dst, target, node)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	return target, func() error { return nil }, nil
+}
+
+// checkNoSymlinks returns an error if one of the directories between dst and
+// target is a symlink, or if target is a symlink and node is not. Directories
+// which do not exist yet are created by the restorer.
+func checkNoSymlinks(dst, target string, node *Node) error {
+	rel, err := filepath.Rel(dst, target)
+	if err != nil {
+		return errors.Wrap(err, "Rel")
+	}
+
+	p := dst
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		p = filepath.Join(p, name)
+
+		fi, err := fs.Lstat(p)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "Lstat")
+		}
+
+		if fi.Mode()&os.ModeSymlink != 0 && (p != target || node.Type != "symlink") {
+			return errors.Errorf("refusing to follow symlink %v", p)
+		}
+	}
+
 	return nil
 }
 
@@ -152,6 +256,18 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) error {
 		}
 	}
 
+	res.dst = dst
+	if res.Sandbox {
+		res.sandbox, err = openRestoreSandbox(dst)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = res.sandbox.Close()
+			res.sandbox = nil
+		}()
+	}
+
 	idx := NewHardlinkIndex()
 	return res.restoreTo(ctx, dst, string(filepath.Separator), *res.sn.Tree, idx)
 }
@@ -0,0 +1,365 @@
+package restic
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+)
+
+// ArchiveFormat is the format of an archive written by RestoreToArchive.
+type ArchiveFormat string
+
+// These are the supported archive formats.
+const (
+	ArchiveTar ArchiveFormat = "tar"
+	ArchiveZip ArchiveFormat = "zip"
+)
+
+// RestoreToArchive writes the selected files and directories of the snapshot
+// to w as an archive in the given format. Before an item is added,
+// res.SelectFilter is called with the path of the item in the archive as the
+// destination.
+//
+// The archive is written as a stream: items are added in the order of the
+// trees in the snapshot, which is sorted by name, so the same snapshot always
+// results in the same archive. Only one blob is held in memory at a time. When
+// the data of a file cannot be loaded, res.Error is called; if it returns
+// nil, the missing data is replaced by zeroes in tar archives, so that the
+// remaining items can still be extracted from the stream.
+func (res *Restorer) RestoreToArchive(ctx context.Context, w io.Writer, format ArchiveFormat) error {
+	var a RestoreTarget
+	switch format {
+	case ArchiveTar:
+		a = newTarArchive(w, res.repo)
+	case ArchiveZip:
+		a = newZipArchive(w, res.repo)
+	default:
+		return errors.Errorf("unknown archive format %q", format)
+	}
+
+	return res.RestoreToTarget(ctx, a)
+}
+
+// RestoreToTarget adds the selected files and directories of the snapshot to
+// t and closes it afterwards. Before an item is added, res.SelectFilter is
+// called with the slash-separated path of the item in the target as the
+// destination.
+func (res *Restorer) RestoreToTarget(ctx context.Context, t RestoreTarget) error {
+	err := res.targetTree(ctx, t, string(filepath.Separator), *res.sn.Tree)
+	if err != nil {
+		return err
+	}
+
+	return t.Close()
+}
+
+// targetTree adds the nodes of the tree to the target. In contrast to
+// restoreTo, directories are added before their content, so that programs
+// reading an archive create them with the right metadata.
+func (res *Restorer) targetTree(ctx context.Context, t RestoreTarget, location string, treeID ID) error {
+	debug.Log("%v %v", location, treeID)
+	tree, err := res.repo.LoadTree(ctx, treeID)
+	if err != nil {
+		debug.Log("error loading tree %v: %v", treeID, err)
+		return res.Error(location, nil, err)
+	}
+
+	for _, node := range tree.Nodes {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// ensure that the node name does not contain anything that refers to a
+		// top-level directory.
+		nodeName := filepath.Base(filepath.Join(string(filepath.Separator), node.Name))
+		if nodeName != node.Name {
+			debug.Log("node %q has invalid name %q", node.Name, nodeName)
+			err := res.Error(location, node, errors.New("node has invalid name"))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		nodeLocation := filepath.Join(location, nodeName)
+		name := strings.TrimPrefix(filepath.ToSlash(nodeLocation), "/")
+
+		selectedForRestore, childMayBeSelected := res.SelectFilter(nodeLocation, name, node)
+		debug.Log("SelectFilter returned %v %v", selectedForRestore, childMayBeSelected)
+
+		if selectedForRestore {
+			err = t.Add(ctx, name, node)
+			if err != nil {
+				debug.Log("error adding %v: %v", name, err)
+				err = res.Error(nodeLocation, node, err)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if node.Type == "dir" && childMayBeSelected {
+			if node.Subtree == nil {
+				return errors.Errorf("Dir without subtree in tree %v", treeID.Str())
+			}
+
+			err = res.targetTree(ctx, t, nodeLocation, *node.Subtree)
+			if err != nil {
+				err = res.Error(nodeLocation, node, err)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// contentSize returns the size of the data stored for node in the
+// repository, which is the number of bytes WriteContentRange writes.
+func contentSize(repo Repository, node *Node) (int64, error) {
+	size := int64(len(node.Inline))
+	for _, id := range node.Content {
+		n, found := repo.LookupBlobSize(id, DataBlob)
+		if !found {
+			return 0, errors.Errorf("id %v not found in repository", id)
+		}
+		size += int64(n)
+	}
+	return size, nil
+}
+
+// archiveMode returns the permission bits of mode in the Unix format.
+func archiveMode(mode os.FileMode) int64 {
+	m := int64(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		m |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		m |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		m |= 01000
+	}
+	return m
+}
+
+// deviceNumbers splits a device number into the major and minor number, it
+// uses the encoding of Linux.
+func deviceNumbers(dev uint64) (major, minor int64) {
+	major = int64((dev>>8)&0xfff | (dev>>32)&^0xfff)
+	minor = int64(dev&0xff | (dev>>12)&^0xff)
+	return major, minor
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// zeroReader returns an infinite stream of zero bytes.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// tarArchive writes a POSIX tar archive in the pax format, which keeps
+// ownership, timestamps, extended attributes and hard links.
+type tarArchive struct {
+	tw    *tar.Writer
+	repo  Repository
+	links *HardlinkIndex
+}
+
+func newTarArchive(w io.Writer, repo Repository) *tarArchive {
+	return &tarArchive{
+		tw:    tar.NewWriter(w),
+		repo:  repo,
+		links: NewHardlinkIndex(),
+	}
+}
+
+// Add stores node in the archive.
+func (a *tarArchive) Add(ctx context.Context, name string, node *Node) error {
+	hdr := &tar.Header{
+		Name:       name,
+		Mode:       archiveMode(node.Mode),
+		Uid:        int(node.UID),
+		Gid:        int(node.GID),
+		Uname:      node.User,
+		Gname:      node.Group,
+		ModTime:    node.ModTime,
+		AccessTime: node.AccessTime,
+		ChangeTime: node.ChangeTime,
+		Format:     tar.FormatPAX,
+	}
+
+	if len(node.ExtendedAttributes) > 0 {
+		hdr.PAXRecords = make(map[string]string, len(node.ExtendedAttributes))
+		for _, attr := range node.ExtendedAttributes {
+			hdr.PAXRecords["SCHILY.xattr."+attr.Name] = string(attr.Value)
+		}
+	}
+
+	if node.ACL != nil {
+		if hdr.PAXRecords == nil {
+			hdr.PAXRecords = make(map[string]string, 2)
+		}
+		if len(node.ACL.Access) > 0 {
+			hdr.PAXRecords["SCHILY.acl.access"] = formatACLEntries(node.ACL.Access)
+		}
+		if len(node.ACL.Default) > 0 {
+			hdr.PAXRecords["SCHILY.acl.default"] = formatACLEntries(node.ACL.Default)
+		}
+	}
+
+	switch node.Type {
+	case "file":
+		if node.Links > 1 {
+			if a.links.Has(node.Inode, node.DeviceID) {
+				hdr.Typeflag = tar.TypeLink
+				hdr.Linkname = a.links.GetFilename(node.Inode, node.DeviceID)
+				return errors.Wrap(a.tw.WriteHeader(hdr), "WriteHeader")
+			}
+			a.links.Add(node.Inode, node.DeviceID, name)
+		}
+
+		size, err := contentSize(a.repo, node)
+		if err != nil {
+			return err
+		}
+
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = size
+		err = a.tw.WriteHeader(hdr)
+		if err != nil {
+			return errors.Wrap(err, "WriteHeader")
+		}
+
+		cw := &countingWriter{w: a.tw}
+		err = node.WriteContentRange(ctx, a.repo, 0, -1, cw)
+		if err != nil && cw.n < size {
+			// the header announces size bytes, fill the rest of the file
+			// with zeroes, so that the archive stays valid and the following
+			// items can still be extracted
+			debug.Log("pad %v with %d bytes: %v", name, size-cw.n, err)
+			_, perr := io.CopyN(a.tw, zeroReader{}, size-cw.n)
+			if perr != nil {
+				return errors.Wrap(perr, "Write")
+			}
+		}
+		return err
+	case "dir":
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name += "/"
+	case "symlink":
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = node.LinkTarget
+	case "dev":
+		hdr.Typeflag = tar.TypeBlock
+		hdr.Devmajor, hdr.Devminor = deviceNumbers(node.Device)
+	case "chardev":
+		hdr.Typeflag = tar.TypeChar
+		hdr.Devmajor, hdr.Devminor = deviceNumbers(node.Device)
+	case "fifo":
+		hdr.Typeflag = tar.TypeFifo
+	default:
+		return errors.Errorf("unable to add node type %q to a tar archive", node.Type)
+	}
+
+	return errors.Wrap(a.tw.WriteHeader(hdr), "WriteHeader")
+}
+
+// Close writes the end of the archive.
+func (a *tarArchive) Close() error {
+	return errors.Wrap(a.tw.Close(), "Close")
+}
+
+// zipArchive writes a zip archive. The format has no place for ownership,
+// extended attributes and hard links, hard linked files are stored once for
+// each name.
+type zipArchive struct {
+	zw   *zip.Writer
+	repo Repository
+}
+
+func newZipArchive(w io.Writer, repo Repository) *zipArchive {
+	return &zipArchive{
+		zw:   zip.NewWriter(w),
+		repo: repo,
+	}
+}
+
+// Add stores node in the archive.
+func (a *zipArchive) Add(ctx context.Context, name string, node *Node) error {
+	hdr := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: node.ModTime,
+	}
+
+	mode := node.Mode &^ os.ModeType
+	switch node.Type {
+	case "file":
+	case "dir":
+		hdr.Name += "/"
+		hdr.Method = zip.Store
+		mode |= os.ModeDir
+	case "symlink":
+		hdr.Method = zip.Store
+		mode |= os.ModeSymlink
+	default:
+		return errors.Errorf("unable to add node type %q to a zip archive", node.Type)
+	}
+	hdr.SetMode(mode)
+
+	w, err := a.zw.CreateHeader(hdr)
+	if err != nil {
+		return errors.Wrap(err, "CreateHeader")
+	}
+
+	switch node.Type {
+	case "file":
+		return node.WriteContentRange(ctx, a.repo, 0, -1, w)
+	case "symlink":
+		// symlinks are stored with the target as content
+		_, err = io.WriteString(w, node.LinkTarget)
+		return errors.Wrap(err, "Write")
+	}
+
+	return nil
+}
+
+// Close writes the end of the archive.
+func (a *zipArchive) Close() error {
+	return errors.Wrap(a.zw.Close(), "Close")
+}
+
+// formatACLEntries returns the entries in the format tar uses for ACLs.
+func formatACLEntries(entries []fs.ACLEntry) string {
+	list := make([]string, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, e.String())
+	}
+	return strings.Join(list, ",")
+}
@@ -0,0 +1,206 @@
+// +build linux,!mips,!mipsle,!mips64,!mips64le
+
+package restic
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	sysOpenat2 = 437
+
+	resolveNoMagiclinks = 0x02
+	resolveNoSymlinks   = 0x04
+	resolveBeneath      = 0x08
+)
+
+// openHow is struct open_how, the argument of openat2.
+type openHow struct {
+	flags   uint64
+	mode    uint64
+	resolve uint64
+}
+
+// openBeneath opens the directory name below the directory dirfd. Neither
+// symlinks nor ".." components leaving dirfd are followed.
+func openBeneath(dirfd int, name string) (int, error) {
+	p, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return -1, err
+	}
+
+	how := openHow{
+		flags:   unix.O_PATH | unix.O_DIRECTORY | unix.O_CLOEXEC,
+		resolve: resolveBeneath | resolveNoSymlinks | resolveNoMagiclinks,
+	}
+
+	fd, _, e := syscall.Syscall6(sysOpenat2, uintptr(dirfd), uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(&how)), unsafe.Sizeof(how), 0, 0)
+	if e != 0 {
+		return -1, e
+	}
+	return int(fd), nil
+}
+
+// restoreSandbox creates all nodes relative to a file descriptor for the
+// target directory, so that no path can leave it.
+type restoreSandbox struct {
+	root int
+}
+
+func openRestoreSandbox(dst string) (*restoreSandbox, error) {
+	err := fs.MkdirAll(dst, 0700)
+	if err != nil {
+		return nil, errors.Wrap(err, "MkdirAll")
+	}
+
+	root, err := unix.Open(dst, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "Open")
+	}
+
+	// check that openat2 and /proc are available
+	fd, err := openBeneath(root, ".")
+	if err == nil {
+		_, err = fs.Lstat(fmt.Sprintf("/proc/self/fd/%d", fd))
+		_ = unix.Close(fd)
+	}
+	if err != nil {
+		_ = unix.Close(root)
+		return nil, errors.Errorf("the restore sandbox requires Linux 5.6 or newer and /proc: %v", err)
+	}
+
+	return &restoreSandbox{root: root}, nil
+}
+
+// prepare creates the parent directories of target below dst and returns a
+// path at which node is to be created. The path refers to directories by
+// their file descriptors, which are closed by done. For items other than
+// directories, done moves the node to target.
+func (s *restoreSandbox) prepare(dst, target string, node *Node) (path string, done func() error, err error) {
+	rel, err := filepath.Rel(dst, filepath.Dir(target))
+	if err != nil {
+		return "", nil, errors.Wrap(err, "Rel")
+	}
+
+	fd, err := openBeneath(s.root, ".")
+	if err != nil {
+		return "", nil, errors.Wrap(err, "openat2")
+	}
+
+	if rel != "." {
+		for _, name := range strings.Split(rel, string(filepath.Separator)) {
+			err = unix.Mkdirat(fd, name, 0700)
+			if err != nil && err != unix.EEXIST {
+				_ = unix.Close(fd)
+				return "", nil, errors.Wrap(err, "Mkdirat")
+			}
+
+			next, err := openBeneath(fd, name)
+			_ = unix.Close(fd)
+			if err == unix.ELOOP || err == unix.EXDEV {
+				return "", nil, errors.Errorf("refusing to follow symlink %v", filepath.Join(dst, rel))
+			}
+			if err != nil {
+				return "", nil, errors.Wrap(err, "openat2")
+			}
+			fd = next
+		}
+	}
+
+	var st unix.Stat_t
+	err = unix.Fstatat(fd, node.Name, &st, unix.AT_SYMLINK_NOFOLLOW)
+	if err == nil && st.Mode&unix.S_IFMT == unix.S_IFLNK && node.Type != "symlink" {
+		_ = unix.Close(fd)
+		return "", nil, errors.Errorf("refusing to follow symlink %v", target)
+	}
+
+	if node.Type == "dir" {
+		return s.prepareDir(fd, target, node)
+	}
+	return s.prepareItem(fd, target, node)
+}
+
+// prepareDir creates the directory for node in the directory fd, opens it
+// without following symlinks and returns a path which refers to the
+// directory by its own file descriptor.
+func (s *restoreSandbox) prepareDir(fd int, target string, node *Node) (path string, done func() error, err error) {
+	err = unix.Mkdirat(fd, node.Name, 0700)
+	if err != nil && err != unix.EEXIST {
+		_ = unix.Close(fd)
+		return "", nil, errors.Wrap(err, "Mkdirat")
+	}
+
+	dir, err := openBeneath(fd, node.Name)
+	_ = unix.Close(fd)
+	if err == unix.ELOOP || err == unix.EXDEV {
+		return "", nil, errors.Errorf("refusing to follow symlink %v", target)
+	}
+	if err != nil {
+		return "", nil, errors.Wrap(err, "openat2")
+	}
+
+	done = func() error {
+		return errors.Wrap(unix.Close(dir), "Close")
+	}
+
+	// the trailing "." makes functions which do not follow symlinks, such as
+	// lchown, operate on the directory instead of the link in /proc
+	return fmt.Sprintf("/proc/self/fd/%d/.", dir), done, nil
+}
+
+// prepareItem creates a private temporary directory in the directory fd and
+// returns a path for node in it. Nobody else can create a symlink there, so
+// the node and its metadata are restored without following any symlink. The
+// function done then moves the node into place with renameat, which replaces
+// an existing entry instead of following it.
+func (s *restoreSandbox) prepareItem(fd int, target string, node *Node) (path string, done func() error, err error) {
+	id := NewRandomID()
+	tmpName := fmt.Sprintf(".restic-sandbox-%s", id.Str())
+	err = unix.Mkdirat(fd, tmpName, 0700)
+	if err != nil {
+		_ = unix.Close(fd)
+		return "", nil, errors.Wrap(err, "Mkdirat")
+	}
+
+	tmp, err := openBeneath(fd, tmpName)
+	if err != nil {
+		_ = unix.Unlinkat(fd, tmpName, unix.AT_REMOVEDIR)
+		_ = unix.Close(fd)
+		return "", nil, errors.Wrap(err, "openat2")
+	}
+
+	done = func() error {
+		err := unix.Renameat(tmp, node.Name, fd, node.Name)
+		if err == unix.ENOENT {
+			// the node has not been created, e.g. because of an error
+			err = nil
+		}
+		if err != nil {
+			err = errors.Wrap(err, "Renameat")
+			_ = unix.Unlinkat(tmp, node.Name, 0)
+		}
+
+		if rerr := unix.Unlinkat(fd, tmpName, unix.AT_REMOVEDIR); rerr != nil {
+			debug.Log("unable to remove temporary directory for %v: %v", target, rerr)
+		}
+		_ = unix.Close(tmp)
+		_ = unix.Close(fd)
+		return err
+	}
+
+	return fmt.Sprintf("/proc/self/fd/%d/%s", tmp, node.Name), done, nil
+}
+
+// Close releases the file descriptor for the target directory.
+func (s *restoreSandbox) Close() error {
+	return unix.Close(s.root)
+}
@@ -0,0 +1,57 @@
+// +build linux,!mips,!mipsle,!mips64,!mips64le
+
+package restic
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRestoreSandboxConcurrentSymlink(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	dst := filepath.Join(tempdir, "target")
+	outside := filepath.Join(tempdir, "outside")
+	rtest.OK(t, ioutil.WriteFile(outside, []byte("foobar"), 0600))
+
+	s, err := openRestoreSandbox(dst)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer func() {
+		rtest.OK(t, s.Close())
+	}()
+
+	target := filepath.Join(dst, "dir", "file")
+	path, done, err := s.prepare(dst, target, &Node{Name: "file", Type: "file"})
+	rtest.OK(t, err)
+
+	// a symlink is created by another process after the checks
+	rtest.OK(t, os.Symlink(outside, target))
+
+	rtest.OK(t, ioutil.WriteFile(path, []byte("restored"), 0600))
+	rtest.OK(t, os.Chmod(path, 0644))
+	rtest.OK(t, done())
+
+	buf, err := ioutil.ReadFile(outside)
+	rtest.OK(t, err)
+	rtest.Equals(t, "foobar", string(buf))
+
+	fi, err := os.Lstat(target)
+	rtest.OK(t, err)
+	rtest.Assert(t, fi.Mode().IsRegular(), "symlink was not replaced, mode is %v", fi.Mode())
+
+	buf, err = ioutil.ReadFile(target)
+	rtest.OK(t, err)
+	rtest.Equals(t, "restored", string(buf))
+
+	// the temporary directory has been removed
+	entries, err := ioutil.ReadDir(filepath.Dir(target))
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(entries))
+}
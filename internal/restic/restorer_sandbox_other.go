@@ -0,0 +1,21 @@
+// +build !linux mips mipsle mips64 mips64le
+
+package restic
+
+import "github.com/restic/restic/internal/errors"
+
+// restoreSandbox is not supported on this platform.
+type restoreSandbox struct{}
+
+func openRestoreSandbox(dst string) (*restoreSandbox, error) {
+	return nil, errors.Fatal("the restore sandbox is only supported on Linux")
+}
+
+func (s *restoreSandbox) prepare(dst, target string, node *Node) (string, func() error, error) {
+	return "", nil, errors.New("the restore sandbox is not supported")
+}
+
+// Close does nothing.
+func (s *restoreSandbox) Close() error {
+	return nil
+}
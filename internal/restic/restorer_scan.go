@@ -0,0 +1,88 @@
+package restic
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+)
+
+// ScanVerdict is the decision of a ScanFunc about a restored file.
+type ScanVerdict int
+
+// Values for ScanVerdict.
+const (
+	// ScanAccept puts the file into place.
+	ScanAccept ScanVerdict = iota
+	// ScanReject removes the file.
+	ScanReject
+	// ScanQuarantine moves the file to the quarantine directory, or removes
+	// it if there is none.
+	ScanQuarantine
+)
+
+// ScanFunc inspects a restored file before it is put into place, e.g. with a
+// malware scanner. location is the path of the file in the snapshot, path is
+// the temporary file it has been restored to. When an error is returned, the
+// file is removed.
+type ScanFunc func(ctx context.Context, location, path string) (verdict ScanVerdict, reason string, err error)
+
+// scanTempPath returns the path of the temporary file a file is restored to
+// before it is scanned and renamed to path.
+func scanTempPath(path string) string {
+	return filepath.Join(filepath.Dir(path), ".restic-scan-"+filepath.Base(path))
+}
+
+// scanFile passes the file restored to tmp to res.Scan and renames it to path
+// if it is accepted. Otherwise the file is removed or moved to the quarantine
+// directory, and an error describing the verdict is returned.
+func (res *Restorer) scanFile(ctx context.Context, node *Node, tmp, path, location string, idx *HardlinkIndex) error {
+	verdict, reason, err := res.Scan(ctx, location, tmp)
+	if err != nil {
+		debug.Log("scanning %v failed: %v", location, err)
+		err = errors.Errorf("scan failed, file not restored: %v", err)
+		verdict = ScanReject
+	}
+
+	// further hard links to the file must use the final path, or restore the
+	// content again if the file is not put into place
+	if node.Links > 1 {
+		idx.Remove(node.Inode, node.DeviceID)
+	}
+
+	if verdict == ScanAccept {
+		if err := fs.Rename(tmp, path); err != nil {
+			_ = fs.Remove(tmp)
+			return errors.Wrap(err, "Rename")
+		}
+
+		if node.Links > 1 {
+			idx.Add(node.Inode, node.DeviceID, path)
+		}
+		return nil
+	}
+
+	if verdict == ScanQuarantine && res.QuarantineDir != "" {
+		dst := filepath.Join(res.QuarantineDir, location)
+		merr := fs.MkdirAll(filepath.Dir(dst), 0700)
+		if merr == nil {
+			merr = fs.Rename(tmp, dst)
+		}
+		if merr == nil {
+			return errors.Errorf("quarantined as %v: %v", dst, reason)
+		}
+		debug.Log("moving %v to quarantine failed: %v", location, merr)
+	}
+
+	if rerr := fs.Remove(tmp); rerr != nil && !os.IsNotExist(rerr) {
+		debug.Log("removing %v failed: %v", tmp, rerr)
+	}
+
+	if err != nil {
+		return err
+	}
+	return errors.Errorf("rejected by the scanner, file not restored: %v", reason)
+}
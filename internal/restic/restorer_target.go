@@ -0,0 +1,153 @@
+package restic
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// RestoreTarget receives the items of a snapshot from RestoreToTarget,
+// instead of restoring them to a directory in the local file system.
+type RestoreTarget interface {
+	// Add stores node at name, which is the slash-separated path of the
+	// item relative to the root of the target. Directories are added before
+	// their content.
+	Add(ctx context.Context, name string, node *Node) error
+
+	// Close is called after all items have been added.
+	Close() error
+}
+
+// TargetFS is a writable file system, e.g. a directory on another host, that
+// a snapshot can be restored to with NewFSTarget. All names are
+// slash-separated and relative to the root of the file system.
+type TargetFS interface {
+	// Mkdir creates a directory. It must not return an error if the
+	// directory exists already.
+	Mkdir(name string, perm os.FileMode) error
+
+	// Create creates or truncates the file name and returns a writer for
+	// the content.
+	Create(name string, perm os.FileMode) (io.WriteCloser, error)
+
+	Symlink(oldname, newname string) error
+	Chtimes(name string, atime, mtime time.Time) error
+}
+
+// fsTarget restores files, directories and symlinks to a TargetFS. The
+// owner, extended attributes and hard links are not restored, hard linked
+// files are stored once for each name.
+type fsTarget struct {
+	fs   TargetFS
+	repo Repository
+
+	// dirs contains the directories whose timestamps are set in Close,
+	// after their content has been restored
+	dirs []fsTargetDir
+
+	// created contains all directories which exist in the file system
+	created map[string]struct{}
+}
+
+type fsTargetDir struct {
+	name         string
+	atime, mtime time.Time
+}
+
+// NewFSTarget returns a RestoreTarget which writes to fs.
+func NewFSTarget(repo Repository, fs TargetFS) RestoreTarget {
+	return &fsTarget{fs: fs, repo: repo, created: make(map[string]struct{})}
+}
+
+// mkdirParents creates the parent directories of name which have not been
+// restored, e.g. because they were not selected by the include patterns.
+func (t *fsTarget) mkdirParents(name string) error {
+	dir := path.Dir(name)
+	if dir == "." {
+		return nil
+	}
+
+	if _, ok := t.created[dir]; ok {
+		return nil
+	}
+
+	p := ""
+	for _, item := range strings.Split(dir, "/") {
+		p = path.Join(p, item)
+		if _, ok := t.created[p]; ok {
+			continue
+		}
+
+		err := t.fs.Mkdir(p, 0700)
+		if err != nil {
+			return errors.Wrap(err, "Mkdir")
+		}
+		t.created[p] = struct{}{}
+	}
+
+	return nil
+}
+
+// Add creates node in the file system.
+func (t *fsTarget) Add(ctx context.Context, name string, node *Node) error {
+	debug.Log("add %v", name)
+
+	err := t.mkdirParents(name)
+	if err != nil {
+		return err
+	}
+
+	switch node.Type {
+	case "dir":
+		err = t.fs.Mkdir(name, node.Mode.Perm())
+		if err != nil {
+			return errors.Wrap(err, "Mkdir")
+		}
+		t.created[name] = struct{}{}
+		t.dirs = append(t.dirs, fsTargetDir{name: name, atime: node.AccessTime, mtime: node.ModTime})
+		return nil
+	case "file":
+		w, err := t.fs.Create(name, node.Mode.Perm())
+		if err != nil {
+			return errors.Wrap(err, "Create")
+		}
+
+		err = node.WriteContentRange(ctx, t.repo, 0, -1, w)
+		if err != nil {
+			_ = w.Close()
+			return err
+		}
+
+		err = w.Close()
+		if err != nil {
+			return errors.Wrap(err, "Close")
+		}
+
+		return errors.Wrap(t.fs.Chtimes(name, node.AccessTime, node.ModTime), "Chtimes")
+	case "symlink":
+		return errors.Wrap(t.fs.Symlink(node.LinkTarget, name), "Symlink")
+	}
+
+	return errors.Errorf("unable to restore node type %q to this target", node.Type)
+}
+
+// Close sets the timestamps of all directories, starting with the innermost
+// ones.
+func (t *fsTarget) Close() error {
+	for i := len(t.dirs) - 1; i >= 0; i-- {
+		dir := t.dirs[i]
+		err := t.fs.Chtimes(dir.name, dir.atime, dir.mtime)
+		if err != nil {
+			return errors.Wrap(err, "Chtimes")
+		}
+	}
+	t.dirs = nil
+
+	return nil
+}
@@ -1,15 +1,22 @@
 package restic_test
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bytes"
 	"context"
+	"io"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
@@ -443,3 +450,447 @@ func TestRestorerRelative(t *testing.T) {
 		})
 	}
 }
+
+func TestRestorerArchive(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	_, id := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"top": File{"toplevel file"},
+			"dir": Dir{
+				Nodes: map[string]Node{
+					"file": File{"file in dir"},
+					"subdir": Dir{
+						Nodes: map[string]Node{
+							"file": File{"file in subdir"},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	want := map[string]string{
+		"dir/":            "",
+		"dir/file":        "file in dir",
+		"dir/subdir/":     "",
+		"dir/subdir/file": "file in subdir",
+		"top":             "toplevel file",
+	}
+
+	readTar := func(t *testing.T, data []byte) map[string]string {
+		files := make(map[string]string)
+		tr := tar.NewReader(bytes.NewReader(data))
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if hdr.Uid != os.Getuid() {
+				t.Errorf("%v: wrong uid, want %v, got %v", hdr.Name, os.Getuid(), hdr.Uid)
+			}
+
+			buf, err := ioutil.ReadAll(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[hdr.Name] = string(buf)
+		}
+		return files
+	}
+
+	readZip := func(t *testing.T, data []byte) map[string]string {
+		files := make(map[string]string)
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range zr.File {
+			rd, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf, err := ioutil.ReadAll(rd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rtest.OK(t, rd.Close())
+			files[f.Name] = string(buf)
+		}
+		return files
+	}
+
+	var tests = []struct {
+		format restic.ArchiveFormat
+		read   func(*testing.T, []byte) map[string]string
+	}{
+		{restic.ArchiveTar, readTar},
+		{restic.ArchiveZip, readZip},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.format), func(t *testing.T) {
+			res, err := restic.NewRestorer(repo, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			err = res.RestoreToArchive(context.TODO(), &buf, test.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			files := test.read(t, buf.Bytes())
+			if !reflect.DeepEqual(files, want) {
+				t.Errorf("wrong archive content, want:\n  %v\ngot:\n  %v", want, files)
+			}
+		})
+	}
+
+	res, err := restic.NewRestorer(repo, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = res.RestoreToArchive(context.TODO(), ioutil.Discard, "rar")
+	if err == nil {
+		t.Errorf("expected an error for an unknown archive format")
+	}
+}
+
+// failingRepo returns an error when the blob fail is loaded.
+type failingRepo struct {
+	restic.Repository
+	fail restic.ID
+}
+
+func (r failingRepo) LoadBlob(ctx context.Context, t restic.BlobType, id restic.ID, buf []byte) (int, error) {
+	if id.Equal(r.fail) {
+		return 0, errors.New("blob is damaged")
+	}
+	return r.Repository.LoadBlob(ctx, t, id, buf)
+}
+
+func TestRestorerArchiveLoadError(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	_, id := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"a": File{"damaged file"},
+			"b": File{"intact file"},
+		},
+	})
+
+	res, err := restic.NewRestorer(failingRepo{Repository: repo, fail: restic.Hash([]byte("damaged file"))}, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var errs []string
+	res.Error = func(dir string, node *restic.Node, err error) error {
+		errs = append(errs, dir)
+		return nil
+	}
+
+	var buf bytes.Buffer
+	err = res.RestoreToArchive(context.TODO(), &buf, restic.ArchiveTar)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"a": strings.Repeat("\x00", len("damaged file")),
+		"b": "intact file",
+	}
+
+	files := make(map[string]string)
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[hdr.Name] = string(data)
+	}
+
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("wrong archive content, want:\n  %q\ngot:\n  %q", want, files)
+	}
+
+	if len(errs) != 1 {
+		t.Errorf("expected one error, got %v", errs)
+	}
+}
+
+// memTargetFS stores the restored items in a map, directories have a
+// trailing slash.
+type memTargetFS struct {
+	items map[string]string
+	times map[string]time.Time
+}
+
+func (fs *memTargetFS) Mkdir(name string, perm os.FileMode) error {
+	fs.items[name+"/"] = ""
+	return nil
+}
+
+type memTargetFile struct {
+	bytes.Buffer
+	fs   *memTargetFS
+	name string
+}
+
+func (f *memTargetFile) Close() error {
+	f.fs.items[f.name] = f.String()
+	return nil
+}
+
+func (fs *memTargetFS) Create(name string, perm os.FileMode) (io.WriteCloser, error) {
+	if _, ok := fs.items[path.Dir(name)+"/"]; !ok && path.Dir(name) != "." {
+		return nil, errors.Errorf("parent directory of %v does not exist", name)
+	}
+	return &memTargetFile{fs: fs, name: name}, nil
+}
+
+func (fs *memTargetFS) Symlink(oldname, newname string) error {
+	fs.items[newname] = "-> " + oldname
+	return nil
+}
+
+func (fs *memTargetFS) Chtimes(name string, atime, mtime time.Time) error {
+	fs.times[name] = mtime
+	return nil
+}
+
+func TestRestorerTarget(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	_, id := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"top": File{"toplevel file"},
+			"dir": Dir{
+				Nodes: map[string]Node{
+					"file": File{"file in dir"},
+					"subdir": Dir{
+						Nodes: map[string]Node{
+							"file": File{"file in subdir"},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	var tests = []struct {
+		include string
+		want    map[string]string
+	}{
+		{
+			want: map[string]string{
+				"dir/":            "",
+				"dir/file":        "file in dir",
+				"dir/subdir/":     "",
+				"dir/subdir/file": "file in subdir",
+				"top":             "toplevel file",
+			},
+		},
+		{
+			include: "/dir/subdir/file",
+			want: map[string]string{
+				"dir/":            "",
+				"dir/subdir/":     "",
+				"dir/subdir/file": "file in subdir",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			res, err := restic.NewRestorer(repo, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.include != "" {
+				res.SelectFilter = func(item string, dstpath string, node *restic.Node) (bool, bool) {
+					return item == test.include, strings.HasPrefix(test.include, item+"/")
+				}
+			}
+
+			fs := &memTargetFS{items: make(map[string]string), times: make(map[string]time.Time)}
+			err = res.RestoreToTarget(context.TODO(), restic.NewFSTarget(repo, fs))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(fs.items, test.want) {
+				t.Errorf("wrong content, want:\n  %v\ngot:\n  %v", test.want, fs.items)
+			}
+
+			if _, ok := fs.times["dir/subdir/file"]; !ok {
+				t.Errorf("timestamps of dir/subdir/file were not restored")
+			}
+		})
+	}
+}
+
+func TestRestorerHarden(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks are not restored on Windows")
+	}
+
+	var tests = []struct {
+		harden, sandbox bool
+	}{
+		{harden: true},
+		{sandbox: true},
+	}
+
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			if test.sandbox && runtime.GOOS != "linux" {
+				t.Skip("the sandbox is only supported on Linux")
+			}
+
+			repo, cleanup := repository.TestRepository(t)
+			defer cleanup()
+
+			_, id := saveSnapshot(t, repo, Snapshot{
+				Nodes: map[string]Node{
+					"foo": File{"content: foo\n"},
+					"dirtest": Dir{
+						Nodes: map[string]Node{
+							"file": File{"content: file\n"},
+						},
+					},
+				},
+			})
+
+			res, err := restic.NewRestorer(repo, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Harden = test.harden
+			res.Sandbox = test.sandbox
+
+			tempdir, cleanup := rtest.TempDir(t)
+			defer cleanup()
+
+			// a symlink in the target directory points outside of it
+			target := filepath.Join(tempdir, "target")
+			outside := filepath.Join(tempdir, "outside")
+			rtest.OK(t, fs.Mkdir(target, 0700))
+			rtest.OK(t, fs.Mkdir(outside, 0700))
+			rtest.OK(t, fs.Symlink(outside, filepath.Join(target, "dirtest")))
+
+			var errs []string
+			res.Error = func(dir string, node *restic.Node, err error) error {
+				t.Logf("restore returned error for %q in dir %v: %v", node.Name, dir, err)
+				errs = append(errs, toSlash(dir))
+				return nil
+			}
+
+			err = res.RestoreTo(context.TODO(), target)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rtest.Equals(t, []string{"/dirtest/file", "/dirtest"}, errs)
+
+			_, err = os.Stat(filepath.Join(outside, "file"))
+			rtest.Assert(t, os.IsNotExist(err), "file outside of the target directory was written: %v", err)
+
+			data, err := ioutil.ReadFile(filepath.Join(target, "foo"))
+			rtest.OK(t, err)
+			rtest.Equals(t, "content: foo\n", string(data))
+		})
+	}
+}
+
+func TestRestorerScan(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	_, id := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"clean": File{"content: clean\n"},
+			"dir": Dir{
+				Nodes: map[string]Node{
+					"infected": File{"content: EICAR\n"},
+					"broken":   File{"content: broken\n"},
+				},
+			},
+		},
+	})
+
+	res, err := restic.NewRestorer(repo, id)
+	rtest.OK(t, err)
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	target := filepath.Join(tempdir, "target")
+	res.QuarantineDir = filepath.Join(tempdir, "quarantine")
+
+	var scanned []string
+	res.Scan = func(ctx context.Context, location, path string) (restic.ScanVerdict, string, error) {
+		scanned = append(scanned, toSlash(location))
+
+		// the file is not in place yet
+		_, err := os.Lstat(filepath.Join(target, location))
+		rtest.Assert(t, os.IsNotExist(err), "file %v is in place before the scan", location)
+
+		data, err := ioutil.ReadFile(path)
+		rtest.OK(t, err)
+
+		switch {
+		case strings.Contains(string(data), "EICAR"):
+			return restic.ScanQuarantine, "test signature found", nil
+		case strings.Contains(string(data), "broken"):
+			return restic.ScanAccept, "", errors.New("scanner failed")
+		}
+		return restic.ScanAccept, "", nil
+	}
+
+	errs := make(map[string]string)
+	res.Error = func(dir string, node *restic.Node, err error) error {
+		errs[toSlash(dir)] = err.Error()
+		return nil
+	}
+
+	rtest.OK(t, res.RestoreTo(context.TODO(), target))
+
+	rtest.Equals(t, []string{"/clean", "/dir/broken", "/dir/infected"}, scanned)
+	rtest.Equals(t, 2, len(errs))
+	rtest.Assert(t, strings.Contains(errs["/dir/infected"], "test signature found"), "unexpected error %v", errs["/dir/infected"])
+	rtest.Assert(t, strings.Contains(errs["/dir/broken"], "scanner failed"), "unexpected error %v", errs["/dir/broken"])
+
+	data, err := ioutil.ReadFile(filepath.Join(target, "clean"))
+	rtest.OK(t, err)
+	rtest.Equals(t, "content: clean\n", string(data))
+
+	data, err = ioutil.ReadFile(filepath.Join(res.QuarantineDir, "dir", "infected"))
+	rtest.OK(t, err)
+	rtest.Equals(t, "content: EICAR\n", string(data))
+
+	// only the accepted file is left in the target directory
+	entries, err := ioutil.ReadDir(filepath.Join(target, "dir"))
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(entries))
+}
@@ -0,0 +1,111 @@
+package restic
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/user"
+	"sort"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+)
+
+// Seal is recorded in the config of a repository which has been sealed, e.g.
+// because it contains a finished archive. A sealed repository cannot be
+// modified, only locks, keys and the config can be changed.
+type Seal struct {
+	Time     time.Time    `json:"time"`
+	Hostname string       `json:"hostname,omitempty"`
+	Username string       `json:"username,omitempty"`
+	Manifest SealManifest `json:"manifest"`
+}
+
+// SealManifest describes the files in a repository at the time it was sealed.
+type SealManifest struct {
+	Snapshots SealedFiles `json:"snapshots"`
+	Index     SealedFiles `json:"index"`
+	Data      SealedFiles `json:"data"`
+}
+
+// SealedFiles describes the files of one type in a sealed repository. The
+// hash is computed over the sorted names and sizes of the files, since the
+// names are the hashes of the content, it covers the content as well.
+type SealedFiles struct {
+	Count int    `json:"count"`
+	Size  uint64 `json:"size"`
+	Hash  ID     `json:"hash"`
+}
+
+// NewSeal returns a seal for the files currently in the backend, recording
+// the current time, host and user.
+func NewSeal(ctx context.Context, be Lister) (*Seal, error) {
+	m, err := NewSealManifest(ctx, be)
+	if err != nil {
+		return nil, err
+	}
+
+	seal := &Seal{Time: time.Now(), Manifest: m}
+
+	seal.Hostname, err = os.Hostname()
+	if err != nil {
+		debug.Log("unable to get the hostname: %v", err)
+	}
+
+	usr, err := user.Current()
+	if err != nil {
+		debug.Log("unable to get the current user: %v", err)
+	} else {
+		seal.Username = usr.Username
+	}
+
+	return seal, nil
+}
+
+// NewSealManifest lists the snapshots, index and data files in the backend
+// and returns the manifest describing them.
+func NewSealManifest(ctx context.Context, be Lister) (m SealManifest, err error) {
+	m.Snapshots, err = listSealedFiles(ctx, be, SnapshotFile)
+	if err != nil {
+		return SealManifest{}, err
+	}
+
+	m.Index, err = listSealedFiles(ctx, be, IndexFile)
+	if err != nil {
+		return SealManifest{}, err
+	}
+
+	m.Data, err = listSealedFiles(ctx, be, DataFile)
+	if err != nil {
+		return SealManifest{}, err
+	}
+
+	return m, nil
+}
+
+func listSealedFiles(ctx context.Context, be Lister, t FileType) (SealedFiles, error) {
+	var files []FileInfo
+	err := be.List(ctx, t, func(fi FileInfo) error {
+		files = append(files, fi)
+		return nil
+	})
+	if err != nil {
+		return SealedFiles{}, err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+
+	var sf SealedFiles
+	h := sha256.New()
+	for _, fi := range files {
+		sf.Count++
+		sf.Size += uint64(fi.Size)
+		_, _ = fmt.Fprintf(h, "%s %d\n", fi.Name, fi.Size)
+	}
+	sf.Hash = IDFromHash(h.Sum(nil))
+
+	return sf, nil
+}
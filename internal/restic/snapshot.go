@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os/user"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/restic/restic/internal/debug"
@@ -24,9 +25,103 @@ type Snapshot struct {
 	Tags     []string  `json:"tags,omitempty"`
 	Original *ID       `json:"original,omitempty"`
 
+	// ChangeDetection records how unchanged files were detected, see the
+	// ChangeDetection* constants. The parent used is stored in Parent.
+	ChangeDetection string `json:"change_detection,omitempty"`
+
+	// Journals records the position of the change journal for each volume
+	// at the time the snapshot was started.
+	Journals []JournalPosition `json:"journals,omitempty"`
+
+	// LastFullWalk is the time of the last snapshot in the chain of parents
+	// which read all directories, it is only set when unchanged directories
+	// may be skipped.
+	LastFullWalk *time.Time `json:"last_full_walk,omitempty"`
+
+	// Summary describes the changes compared to the parent snapshot.
+	Summary *SnapshotSummary `json:"summary,omitempty"`
+
+	// Labels are values recorded when the snapshot was created, such as the
+	// output of probe commands run by the backup command.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Canary is a blob with known content saved with the snapshot, it is
+	// verified by the check command.
+	Canary *Canary `json:"canary,omitempty"`
+
+	// Checkpoint is set for a partial snapshot written while a backup is
+	// running, so that an interrupted backup can be resumed. It is removed
+	// when the backup is complete.
+	Checkpoint bool `json:"checkpoint,omitempty"`
+
+	// Pinned protects the snapshot from being removed by the forget command,
+	// regardless of the policy. It is set and cleared by the pin and unpin
+	// commands.
+	Pinned bool `json:"pinned,omitempty"`
+
+	// Errors lists the files and directories which could not be read and
+	// are missing in the snapshot, at most MaxItemErrors. ErrorCount is the
+	// total number of such items.
+	Errors     []ItemError `json:"errors,omitempty"`
+	ErrorCount int         `json:"error_count,omitempty"`
+
 	id *ID // plaintext ID, used during restore
 }
 
+// MaxItemErrors is the maximum number of errors listed in a snapshot.
+const MaxItemErrors = 1000
+
+// ItemError describes a file or directory which could not be saved in a
+// snapshot.
+type ItemError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// SnapshotSummary counts the items which have been added, removed or changed
+// compared to the parent snapshot, and the amount of data referenced by the
+// snapshot which was not referenced by the parent.
+type SnapshotSummary struct {
+	FilesNew     int    `json:"files_new"`
+	FilesRemoved int    `json:"files_removed"`
+	FilesChanged int    `json:"files_changed"`
+	DirsNew      int    `json:"dirs_new"`
+	DirsRemoved  int    `json:"dirs_removed"`
+	DataAdded    uint64 `json:"data_added"`
+
+	// BackendUsage lists the requests sent to the backends by the backup
+	// until the snapshot was saved.
+	BackendUsage []BackendUsage `json:"backend_usage,omitempty"`
+}
+
+// Values for Snapshot.ChangeDetection.
+const (
+	// ChangeDetectionNone means that all files were read, because no parent
+	// snapshot was used.
+	ChangeDetectionNone = "none"
+
+	// ChangeDetectionParent means that files whose metadata matches the
+	// parent snapshot were not read again.
+	ChangeDetectionParent = "parent"
+
+	// ChangeDetectionJournal means that only the files reported by the change
+	// journal since the parent snapshot were read.
+	ChangeDetectionJournal = "journal"
+
+	// ChangeDetectionDirs means that directories whose metadata and entries
+	// match the parent snapshot were not read again, see
+	// Node.EntriesDigest.
+	ChangeDetectionDirs = "dirs"
+)
+
+// JournalPosition is a position in the change journal of a volume, such as
+// the NTFS USN journal.
+type JournalPosition struct {
+	Volume    string `json:"volume"`
+	JournalID uint64 `json:"journal_id"`
+	USN       int64  `json:"usn"`
+}
+
 // NewSnapshot returns an initialized snapshot struct for the current user and
 // time.
 func NewSnapshot(paths []string, tags []string, hostname string, time time.Time) (*Snapshot, error) {
@@ -62,10 +157,94 @@ func LoadSnapshot(ctx context.Context, repo Repository, id ID) (*Snapshot, error
 	return sn, nil
 }
 
+// loadSnapshotWorkers is the number of snapshots which are loaded in parallel.
+const loadSnapshotWorkers = 8
+
+// ForAllSnapshots loads all snapshots in the repository in parallel and calls
+// fn for each of them. When a snapshot cannot be loaded, fn is called with the
+// error instead. The function fn is called serially in the same Goroutine
+// ForAllSnapshots was called from, in no particular order. If fn returns an
+// error, processing stops and the error is returned.
+func ForAllSnapshots(ctx context.Context, repo Repository, fn func(ID, *Snapshot, error) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		id  ID
+		sn  *Snapshot
+		err error
+	}
+
+	ids := make(chan ID)
+	results := make(chan result)
+
+	var (
+		listErr error
+		listWg  sync.WaitGroup
+	)
+
+	listWg.Add(1)
+	go func() {
+		defer listWg.Done()
+		defer close(ids)
+
+		listErr = repo.List(ctx, SnapshotFile, func(id ID, size int64) error {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case ids <- id:
+				return nil
+			}
+		})
+	}()
+
+	var workerWg sync.WaitGroup
+	for i := 0; i < loadSnapshotWorkers; i++ {
+		workerWg.Add(1)
+		go func() {
+			defer workerWg.Done()
+
+			for id := range ids {
+				sn, err := LoadSnapshot(ctx, repo, id)
+				select {
+				case <-ctx.Done():
+					return
+				case results <- result{id: id, sn: sn, err: err}:
+				}
+			}
+		}()
+	}
+
+	go func() {
+		workerWg.Wait()
+		close(results)
+	}()
+
+	var err error
+	for res := range results {
+		// drain the channel after an error so that all workers terminate
+		if err != nil {
+			continue
+		}
+
+		err = fn(res.id, res.sn, res.err)
+		if err != nil {
+			cancel()
+		}
+	}
+
+	listWg.Wait()
+
+	if err != nil {
+		return err
+	}
+
+	return listErr
+}
+
 // LoadAllSnapshots returns a list of all snapshots in the repo.
 func LoadAllSnapshots(ctx context.Context, repo Repository) (snapshots []*Snapshot, err error) {
-	err = repo.List(ctx, SnapshotFile, func(id ID, size int64) error {
-		sn, err := LoadSnapshot(ctx, repo, id)
+	err = ForAllSnapshots(ctx, repo, func(id ID, sn *Snapshot, err error) error {
 		if err != nil {
 			return err
 		}
@@ -13,15 +13,25 @@ import (
 var ErrNoSnapshotFound = errors.New("no snapshot found")
 
 // FindLatestSnapshot finds latest snapshot with optional target/directory, tags and hostname filters.
+// Checkpoints of running or interrupted backups are ignored.
 func FindLatestSnapshot(ctx context.Context, repo Repository, targets []string, tagLists []TagList, hostname string) (ID, error) {
+	return findLatest(ctx, repo, targets, tagLists, hostname, false)
+}
+
+// FindLatestCheckpoint finds the latest checkpoint written by a backup of
+// targets on hostname, see Snapshot.Checkpoint.
+func FindLatestCheckpoint(ctx context.Context, repo Repository, targets []string, hostname string) (ID, error) {
+	return findLatest(ctx, repo, targets, []TagList{}, hostname, true)
+}
+
+func findLatest(ctx context.Context, repo Repository, targets []string, tagLists []TagList, hostname string, checkpoint bool) (ID, error) {
 	var (
 		latest   time.Time
 		latestID ID
 		found    bool
 	)
 
-	err := repo.List(ctx, SnapshotFile, func(snapshotID ID, size int64) error {
-		snapshot, err := LoadSnapshot(ctx, repo, snapshotID)
+	err := ForAllSnapshots(ctx, repo, func(snapshotID ID, snapshot *Snapshot, err error) error {
 		if err != nil {
 			return errors.Errorf("Error loading snapshot %v: %v", snapshotID.Str(), err)
 		}
@@ -29,6 +39,10 @@ func FindLatestSnapshot(ctx context.Context, repo Repository, targets []string,
 			return nil
 		}
 
+		if snapshot.Checkpoint != checkpoint {
+			return nil
+		}
+
 		if !snapshot.HasTagList(tagLists) {
 			return nil
 		}
@@ -72,8 +86,7 @@ func FindSnapshot(repo Repository, s string) (ID, error) {
 func FindFilteredSnapshots(ctx context.Context, repo Repository, host string, tags []TagList, paths []string) (Snapshots, error) {
 	results := make(Snapshots, 0, 20)
 
-	err := repo.List(ctx, SnapshotFile, func(id ID, size int64) error {
-		sn, err := LoadSnapshot(ctx, repo, id)
+	err := ForAllSnapshots(ctx, repo, func(id ID, sn *Snapshot, err error) error {
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "could not load snapshot %v: %v\n", id.Str(), err)
 			return nil
@@ -1,8 +1,10 @@
 package restic
 
 import (
+	"fmt"
 	"reflect"
 	"sort"
+	"strconv"
 	"time"
 )
 
@@ -64,60 +66,134 @@ func always(d time.Time, nr int) int {
 	return nr
 }
 
+// policyRule is one of the counted rules of an ExpirePolicy. Snapshots are
+// sorted into buckets by the function bucket, the most recent snapshot of each
+// of the last count buckets is kept.
+type policyRule struct {
+	name   string
+	count  int
+	bucket func(d time.Time, nr int) int
+	label  func(d time.Time, nr int) string
+}
+
+func (p ExpirePolicy) rules() []policyRule {
+	return []policyRule{
+		{"last", p.Last, always, func(d time.Time, nr int) string { return strconv.Itoa(nr + 1) }},
+		{"hourly", p.Hourly, ymdh, func(d time.Time, _ int) string { return d.Format("2006-01-02 15h") }},
+		{"daily", p.Daily, ymd, func(d time.Time, _ int) string { return d.Format("2006-01-02") }},
+		{"weekly", p.Weekly, yw, func(d time.Time, _ int) string {
+			year, week := d.ISOWeek()
+			return fmt.Sprintf("%04d-W%02d", year, week)
+		}},
+		{"monthly", p.Monthly, ym, func(d time.Time, _ int) string { return d.Format("2006-01") }},
+		{"yearly", p.Yearly, y, func(d time.Time, _ int) string { return d.Format("2006") }},
+	}
+}
+
+// KeepReason describes how the policy has decided on a snapshot.
+type KeepReason struct {
+	Snapshot *Snapshot `json:"snapshot"`
+
+	// Matches lists the rules which keep the snapshot, e.g. "daily",
+	// "tag [foo, bar]" or "pinned". The snapshot is removed if the list is
+	// empty.
+	Matches []string `json:"matches"`
+
+	// Buckets contains the bucket the snapshot was sorted into for each
+	// configured rule, e.g. "daily": "2018-10-14", regardless of whether the
+	// rule keeps the snapshot.
+	Buckets map[string]string `json:"buckets"`
+}
+
+// Keep returns true if the snapshot is kept.
+func (r KeepReason) Keep() bool {
+	return len(r.Matches) > 0
+}
+
 // ApplyPolicy returns the snapshots from list that are to be kept and removed
 // according to the policy p. list is sorted in the process.
 func ApplyPolicy(list Snapshots, p ExpirePolicy) (keep, remove Snapshots) {
+	keep, remove, _ = ApplyPolicyReasons(list, p)
+	return keep, remove
+}
+
+// ApplyPolicyReasons works like ApplyPolicy, and additionally returns the
+// reasons for the decision on each snapshot, in the order of the sorted list.
+func ApplyPolicyReasons(list Snapshots, p ExpirePolicy) (keep, remove Snapshots, reasons []KeepReason) {
 	sort.Sort(list)
 
 	if p.Empty() {
-		return list, remove
+		return list, remove, nil
 	}
 
 	if len(list) == 0 {
-		return list, remove
+		return list, remove, nil
 	}
 
-	var buckets = [6]struct {
-		Count  int
-		bucker func(d time.Time, nr int) int
-		Last   int
-	}{
-		{p.Last, always, -1},
-		{p.Hourly, ymdh, -1},
-		{p.Daily, ymd, -1},
-		{p.Weekly, yw, -1},
-		{p.Monthly, ym, -1},
-		{p.Yearly, y, -1},
+	rules := p.rules()
+	last := make([]int, len(rules))
+	left := make([]int, len(rules))
+	for i, r := range rules {
+		last[i] = -1
+		left[i] = r.count
 	}
 
 	for nr, cur := range list {
-		var keepSnap bool
+		reason := KeepReason{
+			Snapshot: cur,
+			Matches:  []string{},
+			Buckets:  make(map[string]string),
+		}
+
+		// Pinned snapshots are always kept.
+		if cur.Pinned {
+			reason.Matches = append(reason.Matches, "pinned")
+		}
 
 		// Tags are handled specially as they are not counted.
 		for _, l := range p.Tags {
 			if cur.HasTags(l) {
-				keepSnap = true
+				reason.Matches = append(reason.Matches, "tag "+l.String())
 			}
 		}
 
 		// Now update the other buckets and see if they have some counts left.
-		for i, b := range buckets {
-			if b.Count > 0 {
-				val := b.bucker(cur.Time, nr)
-				if val != b.Last {
-					keepSnap = true
-					buckets[i].Last = val
-					buckets[i].Count--
-				}
+		for i, r := range rules {
+			if r.count <= 0 {
+				continue
+			}
+
+			reason.Buckets[r.name] = r.label(cur.Time, nr)
+			val := r.bucket(cur.Time, nr)
+			if left[i] > 0 && val != last[i] {
+				reason.Matches = append(reason.Matches, r.name)
+				last[i] = val
+				left[i]--
 			}
 		}
 
-		if keepSnap {
+		if reason.Keep() {
 			keep = append(keep, cur)
 		} else {
 			remove = append(remove, cur)
 		}
+		reasons = append(reasons, reason)
+	}
+
+	return keep, remove, reasons
+}
+
+// KeepAtLeast moves the most recent snapshots from remove to keep until keep
+// contains at least n snapshots or remove is empty. Both lists are sorted in
+// the process.
+func KeepAtLeast(keep, remove Snapshots, n int) (Snapshots, Snapshots) {
+	sort.Sort(remove)
+
+	for len(keep) < n && len(remove) > 0 {
+		keep = append(keep, remove[0])
+		remove = remove[1:]
 	}
 
+	sort.Sort(keep)
 	return keep, remove
 }
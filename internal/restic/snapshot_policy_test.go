@@ -229,3 +229,115 @@ func TestApplyPolicy(t *testing.T) {
 		}
 	}
 }
+
+func TestKeepAtLeast(t *testing.T) {
+	var tests = []struct {
+		keep, remove int
+		n            int
+		wantKeep     int
+	}{
+		{0, 5, 3, 3},
+		{2, 5, 3, 3},
+		{4, 5, 3, 4},
+		{0, 2, 3, 2},
+		{0, 0, 3, 0},
+		{1, 5, 0, 1},
+	}
+
+	for i, test := range tests {
+		var list restic.Snapshots
+		for j := 0; j < test.keep+test.remove; j++ {
+			list = append(list, &restic.Snapshot{Time: parseTimeUTC("2016-01-01 10:00:00").Add(time.Duration(j) * time.Hour)})
+		}
+
+		// keep the oldest snapshots, so that the most recent ones are moved
+		keep := append(restic.Snapshots{}, list[:test.keep]...)
+		remove := append(restic.Snapshots{}, list[test.keep:]...)
+
+		keep, remove = restic.KeepAtLeast(keep, remove, test.n)
+		if len(keep) != test.wantKeep {
+			t.Errorf("test %d: wrong number of snapshots kept, want %d, got %d", i, test.wantKeep, len(keep))
+		}
+
+		if len(keep)+len(remove) != len(list) {
+			t.Errorf("test %d: snapshots lost, want %d, got %d", i, len(list), len(keep)+len(remove))
+		}
+
+		// all moved snapshots must be newer than the ones still removed
+		for _, sn := range remove {
+			for _, k := range keep[:len(keep)-test.keep] {
+				if sn.Time.After(k.Time) {
+					t.Errorf("test %d: snapshot %v removed, but older snapshot %v kept", i, sn.Time, k.Time)
+				}
+			}
+		}
+	}
+}
+
+func TestApplyPolicyReasons(t *testing.T) {
+	list := restic.Snapshots{
+		{Time: parseTimeUTC("2016-01-18 12:02:03")},
+		{Time: parseTimeUTC("2016-01-12 21:08:03")},
+		{Time: parseTimeUTC("2016-01-12 21:02:03")},
+		{Time: parseTimeUTC("2016-01-09 21:02:03"), Tags: []string{"foo"}},
+		{Time: parseTimeUTC("2015-12-30 21:02:03")},
+	}
+
+	p := restic.ExpirePolicy{Daily: 2, Weekly: 1, Tags: []restic.TagList{{"foo"}}}
+	keep, remove, reasons := restic.ApplyPolicyReasons(list, p)
+
+	if len(keep) != 3 || len(remove) != 2 {
+		t.Fatalf("wrong number of snapshots kept/removed: %d/%d", len(keep), len(remove))
+	}
+
+	var tests = []struct {
+		matches []string
+		buckets map[string]string
+	}{
+		{[]string{"daily", "weekly"}, map[string]string{"daily": "2016-01-18", "weekly": "2016-W03"}},
+		{[]string{"daily"}, map[string]string{"daily": "2016-01-12", "weekly": "2016-W02"}},
+		{[]string{}, map[string]string{"daily": "2016-01-12", "weekly": "2016-W02"}},
+		{[]string{"tag [foo]"}, map[string]string{"daily": "2016-01-09", "weekly": "2016-W01"}},
+		{[]string{}, map[string]string{"daily": "2015-12-30", "weekly": "2015-W53"}},
+	}
+
+	if len(reasons) != len(tests) {
+		t.Fatalf("wrong number of reasons, want %d, got %d", len(tests), len(reasons))
+	}
+
+	for i, test := range tests {
+		r := reasons[i]
+		if r.Snapshot != list[i] {
+			t.Errorf("reason %d: wrong snapshot %v", i, r.Snapshot.Time)
+		}
+		if !reflect.DeepEqual(r.Matches, test.matches) {
+			t.Errorf("reason %d: wrong matches, want %v, got %v", i, test.matches, r.Matches)
+		}
+		if !reflect.DeepEqual(r.Buckets, test.buckets) {
+			t.Errorf("reason %d: wrong buckets, want %v, got %v", i, test.buckets, r.Buckets)
+		}
+	}
+}
+
+func TestApplyPolicyPinned(t *testing.T) {
+	list := restic.Snapshots{
+		{Time: parseTimeUTC("2016-01-18 12:02:03")},
+		{Time: parseTimeUTC("2016-01-12 21:08:03")},
+		{Time: parseTimeUTC("2015-12-30 21:02:03"), Pinned: true},
+		{Time: parseTimeUTC("2015-11-22 10:20:30")},
+	}
+
+	keep, remove, reasons := restic.ApplyPolicyReasons(list, restic.ExpirePolicy{Last: 1})
+
+	if len(keep) != 2 || len(remove) != 2 {
+		t.Fatalf("wrong number of snapshots kept/removed: %d/%d", len(keep), len(remove))
+	}
+
+	if keep[1] != list[2] {
+		t.Errorf("pinned snapshot %v was not kept", list[2].Time)
+	}
+
+	if !reflect.DeepEqual(reasons[2].Matches, []string{"pinned"}) {
+		t.Errorf("wrong matches for pinned snapshot, want [pinned], got %v", reasons[2].Matches)
+	}
+}
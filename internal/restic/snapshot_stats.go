@@ -0,0 +1,240 @@
+package restic
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// SnapshotStats contains the size and number of files and directories which
+// are restored for a snapshot.
+type SnapshotStats struct {
+	TotalSize      uint64 `json:"total_size"`
+	TotalFileCount uint64 `json:"total_file_count"`
+	TotalDirCount  uint64 `json:"total_dir_count"`
+}
+
+// ComputeSnapshotStats walks the tree with the given ID and returns the
+// stats for all files and directories contained in it.
+func ComputeSnapshotStats(ctx context.Context, repo Repository, treeID ID) (stats SnapshotStats, err error) {
+	err = computeStats(ctx, repo, treeID, &stats)
+	return stats, err
+}
+
+func computeStats(ctx context.Context, repo Repository, treeID ID, stats *SnapshotStats) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	tree, err := repo.LoadTree(ctx, treeID)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range tree.Nodes {
+		switch node.Type {
+		case "file":
+			stats.TotalFileCount++
+			stats.TotalSize += node.Size
+		case "dir":
+			stats.TotalDirCount++
+			if node.Subtree == nil {
+				return errors.Errorf("dir node %v has no subtree", node.Name)
+			}
+
+			err = computeStats(ctx, repo, *node.Subtree, stats)
+			if err != nil {
+				return err
+			}
+		default:
+			stats.TotalFileCount++
+		}
+	}
+
+	return nil
+}
+
+// LoadSnapshotStats returns the stats for the snapshot sn with the given id.
+// Snapshots never change, so if c is not nil, the stats are taken from the
+// cache when available. Otherwise they are computed and saved to the cache.
+// The cached stats are encrypted with the repository key.
+func LoadSnapshotStats(ctx context.Context, repo Repository, c Cache, id ID, sn *Snapshot) (SnapshotStats, error) {
+	if c != nil {
+		stats, err := loadCachedStats(repo.Key(), c, id)
+		if err == nil {
+			return stats, nil
+		}
+
+		if !c.IsNotExist(err) {
+			debug.Log("unable to load cached stats for %v: %v", id.Str(), err)
+		}
+	}
+
+	stats, err := ComputeSnapshotStats(ctx, repo, *sn.Tree)
+	if err != nil {
+		return SnapshotStats{}, err
+	}
+
+	if c != nil {
+		err = saveCachedStats(repo.Key(), c, id, stats)
+		if err != nil {
+			debug.Log("unable to save stats for %v to the cache: %v", id.Str(), err)
+		}
+	}
+
+	return stats, nil
+}
+
+func loadCachedStats(key *crypto.Key, c Cache, id ID) (stats SnapshotStats, err error) {
+	buf, err := c.LoadStats(id)
+	if err != nil {
+		return SnapshotStats{}, err
+	}
+
+	if len(buf) < key.NonceSize() {
+		return SnapshotStats{}, errors.New("cached stats are too short")
+	}
+
+	nonce, ciphertext := buf[:key.NonceSize()], buf[key.NonceSize():]
+	plaintext, err := key.Open(ciphertext[:0], nonce, ciphertext, nil)
+	if err != nil {
+		return SnapshotStats{}, err
+	}
+
+	err = json.Unmarshal(plaintext, &stats)
+	if err != nil {
+		return SnapshotStats{}, errors.Wrap(err, "Unmarshal")
+	}
+
+	return stats, nil
+}
+
+func saveCachedStats(key *crypto.Key, c Cache, id ID, stats SnapshotStats) error {
+	plaintext, err := json.Marshal(stats)
+	if err != nil {
+		return errors.Wrap(err, "Marshal")
+	}
+
+	nonce := crypto.NewRandomNonce()
+	ciphertext := make([]byte, 0, len(nonce)+len(plaintext)+key.Overhead())
+	ciphertext = append(ciphertext, nonce...)
+	ciphertext = key.Seal(ciphertext, nonce, plaintext, nil)
+
+	return c.SaveStats(id, ciphertext)
+}
+
+// PathStats describes the space used by a top-level entry of a snapshot. The
+// unique size is the size of all blobs which are referenced only by this
+// entry, so it's the amount of data the entry adds to the snapshot after
+// deduplication. The shared size is the size of all blobs which are also
+// referenced by other entries of the snapshot.
+type PathStats struct {
+	Path       string `json:"path"`
+	TotalSize  uint64 `json:"total_size"`
+	UniqueSize uint64 `json:"unique_size"`
+	SharedSize uint64 `json:"shared_size"`
+}
+
+// pathStatsWorkers is the number of top-level entries processed in parallel.
+const pathStatsWorkers = 8
+
+// ComputePathStats returns the stats for all entries of the tree with the
+// given ID, in the order of the tree. The subtrees are walked in parallel.
+func ComputePathStats(ctx context.Context, repo Repository, treeID ID) ([]PathStats, error) {
+	tree, err := repo.LoadTree(ctx, treeID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]PathStats, len(tree.Nodes))
+	blobs := make([]BlobSet, len(tree.Nodes))
+
+	g, ctx := errgroup.WithContext(ctx)
+	ch := make(chan int)
+
+	for i := 0; i < pathStatsWorkers; i++ {
+		g.Go(func() error {
+			for i := range ch {
+				node := tree.Nodes[i]
+				stats[i].Path = node.Name
+				blobs[i] = NewBlobSet()
+
+				switch node.Type {
+				case "file":
+					stats[i].TotalSize = node.Size
+					for _, id := range node.Content {
+						blobs[i].Insert(BlobHandle{ID: id, Type: DataBlob})
+					}
+					for _, stream := range node.Streams {
+						for _, id := range stream.Content {
+							blobs[i].Insert(BlobHandle{ID: id, Type: DataBlob})
+						}
+					}
+				case "dir":
+					if node.Subtree == nil {
+						return errors.Errorf("dir node %v has no subtree", node.Name)
+					}
+
+					s, err := ComputeSnapshotStats(ctx, repo, *node.Subtree)
+					if err != nil {
+						return err
+					}
+					stats[i].TotalSize = s.TotalSize
+
+					err = FindUsedBlobs(ctx, repo, *node.Subtree, blobs[i], NewBlobSet())
+					if err != nil {
+						return err
+					}
+				}
+			}
+
+			return nil
+		})
+	}
+
+	g.Go(func() error {
+		defer close(ch)
+		for i := range tree.Nodes {
+			select {
+			case ch <- i:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		return nil
+	})
+
+	if err = g.Wait(); err != nil {
+		return nil, err
+	}
+
+	// count how many entries reference each blob
+	refs := make(map[BlobHandle]int)
+	for _, set := range blobs {
+		for h := range set {
+			refs[h]++
+		}
+	}
+
+	for i, set := range blobs {
+		for h := range set {
+			size, found := repo.LookupBlobSize(h.ID, h.Type)
+			if !found {
+				return nil, errors.Errorf("blob %v not found in index", h)
+			}
+
+			if refs[h] > 1 {
+				stats[i].SharedSize += uint64(size)
+			} else {
+				stats[i].UniqueSize += uint64(size)
+			}
+		}
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,97 @@
+package restic_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/restic/restic/internal/cache"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestLoadSnapshotStats(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	c, cleanupCache := cache.TestNewCache(t)
+	defer cleanupCache()
+
+	sn := restic.TestCreateSnapshot(t, repo, findTestTime, 2, 0)
+	id := *sn.ID()
+
+	want, err := restic.ComputeSnapshotStats(context.TODO(), repo, *sn.Tree)
+	rtest.OK(t, err)
+
+	if want.TotalFileCount == 0 || want.TotalDirCount == 0 || want.TotalSize == 0 {
+		t.Fatalf("invalid stats computed: %+v", want)
+	}
+
+	_, err = c.LoadStats(id)
+	rtest.Assert(t, c.IsNotExist(err), "expected no cached stats, got error %v", err)
+
+	stats, err := restic.LoadSnapshotStats(context.TODO(), repo, c, id, sn)
+	rtest.OK(t, err)
+	rtest.Equals(t, want, stats)
+
+	// the stats must be cached and encrypted now
+	buf, err := c.LoadStats(id)
+	rtest.OK(t, err)
+	rtest.Assert(t, len(buf) > repo.Key().NonceSize(), "cached stats are too short")
+
+	stats, err = restic.LoadSnapshotStats(context.TODO(), repo, c, id, sn)
+	rtest.OK(t, err)
+	rtest.Equals(t, want, stats)
+
+	// corrupted stats must be ignored and recomputed
+	rtest.OK(t, c.SaveStats(id, []byte("invalid")))
+	stats, err = restic.LoadSnapshotStats(context.TODO(), repo, c, id, sn)
+	rtest.OK(t, err)
+	rtest.Equals(t, want, stats)
+
+	// stats for snapshots which do not exist any more are removed
+	rtest.OK(t, c.ClearStats(restic.NewIDSet()))
+	_, err = c.LoadStats(id)
+	rtest.Assert(t, c.IsNotExist(err), "expected stats to be removed, got error %v", err)
+}
+
+func TestComputePathStats(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	sn := restic.TestCreateSnapshot(t, repo, findTestTime, 2, 0)
+
+	total, err := restic.ComputeSnapshotStats(context.TODO(), repo, *sn.Tree)
+	rtest.OK(t, err)
+
+	stats, err := restic.ComputePathStats(context.TODO(), repo, *sn.Tree)
+	rtest.OK(t, err)
+
+	var sum, stored uint64
+	for _, s := range stats {
+		sum += s.TotalSize
+		stored += s.UniqueSize + s.SharedSize
+	}
+	rtest.Equals(t, total.TotalSize, sum)
+	rtest.Assert(t, stored > 0, "no stored data found")
+
+	// two directories referencing the same subtree share all data
+	tree := restic.NewTree()
+	for _, name := range []string{"a", "b"} {
+		rtest.OK(t, tree.Insert(&restic.Node{Name: name, Type: "dir", Subtree: sn.Tree}))
+	}
+
+	root, err := repo.SaveTree(context.TODO(), tree)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Flush(context.TODO()))
+
+	stats, err = restic.ComputePathStats(context.TODO(), repo, root)
+	rtest.OK(t, err)
+	rtest.Equals(t, 2, len(stats))
+
+	for _, s := range stats {
+		rtest.Equals(t, total.TotalSize, s.TotalSize)
+		rtest.Equals(t, uint64(0), s.UniqueSize)
+		rtest.Assert(t, s.SharedSize > 0, "entry %v has no shared data", s.Path)
+	}
+}
@@ -1,9 +1,12 @@
 package restic_test
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
+	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
 )
@@ -14,3 +17,32 @@ func TestNewSnapshot(t *testing.T) {
 	_, err := restic.NewSnapshot(paths, nil, "foo", time.Now())
 	rtest.OK(t, err)
 }
+
+func TestForAllSnapshots(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	const numSnapshots = 20
+	for i := 0; i < numSnapshots; i++ {
+		restic.TestCreateSnapshot(t, repo, time.Unix(1460289341+int64(i), 0), 1, 0)
+	}
+
+	seen := restic.NewIDSet()
+	err := restic.ForAllSnapshots(context.TODO(), repo, func(id restic.ID, sn *restic.Snapshot, err error) error {
+		rtest.OK(t, err)
+		rtest.Equals(t, id, *sn.ID())
+		seen.Insert(id)
+		return nil
+	})
+	rtest.OK(t, err)
+	rtest.Equals(t, numSnapshots, len(seen))
+
+	errStop := errors.New("stop")
+	calls := 0
+	err = restic.ForAllSnapshots(context.TODO(), repo, func(id restic.ID, sn *restic.Snapshot, err error) error {
+		calls++
+		return errStop
+	})
+	rtest.Equals(t, errStop, err)
+	rtest.Equals(t, 1, calls)
+}
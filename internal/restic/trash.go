@@ -0,0 +1,161 @@
+package restic
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// TrashEntry is a file which has been moved to the trash.
+type TrashEntry struct {
+	// Name is the name of the file in the trash.
+	Name string
+	// Handle describes the file before it was moved to the trash.
+	Handle  Handle
+	Deleted time.Time
+	Size    int64
+}
+
+// trashName returns the name for the file h in the trash. The name contains
+// the time of the deletion and the original type and name of the file, so
+// that the trash can be listed without loading any file.
+func trashName(h Handle, deleted time.Time) string {
+	return fmt.Sprintf("%d.%s.%s", deleted.Unix(), h.Type, h.Name)
+}
+
+// ParseTrashName parses the name of a file in the trash.
+func ParseTrashName(name string) (TrashEntry, error) {
+	data := strings.SplitN(name, ".", 3)
+	if len(data) != 3 {
+		return TrashEntry{}, errors.Errorf("invalid trash file name %q", name)
+	}
+
+	sec, err := strconv.ParseInt(data[0], 10, 64)
+	if err != nil {
+		return TrashEntry{}, errors.Errorf("invalid trash file name %q", name)
+	}
+
+	h := Handle{Type: FileType(data[1]), Name: data[2]}
+	if h.Type == TrashFile || h.Type == ConfigFile || h.Type == NewConfigFile || h.Valid() != nil {
+		return TrashEntry{}, errors.Errorf("invalid trash file name %q", name)
+	}
+
+	return TrashEntry{
+		Name:    name,
+		Handle:  h,
+		Deleted: time.Unix(sec, 0),
+	}, nil
+}
+
+// loadFile returns the content of the file h.
+func loadFile(ctx context.Context, be Backend, h Handle) ([]byte, error) {
+	var buf []byte
+	err := be.Load(ctx, h, 0, 0, func(rd io.Reader) error {
+		var wr bytes.Buffer
+		_, err := io.Copy(&wr, rd)
+		buf = wr.Bytes()
+		return err
+	})
+	return buf, err
+}
+
+// moveFile moves the file from to the handle to. Backends which implement
+// Renamer rename the file. Otherwise, if allowCopy is set, the file is
+// downloaded, uploaded again and removed afterwards, else
+// ErrRenameUnsupported is returned.
+func moveFile(ctx context.Context, be Backend, from, to Handle, allowCopy bool) error {
+	if r, ok := be.(Renamer); ok {
+		err := r.Rename(ctx, from, to)
+		if errors.Cause(err) != ErrRenameUnsupported {
+			return err
+		}
+	}
+
+	if !allowCopy {
+		return ErrRenameUnsupported
+	}
+	debug.Log("rename is not supported, copying %v", from)
+
+	buf, err := loadFile(ctx, be, from)
+	if err != nil {
+		return err
+	}
+
+	err = be.Save(ctx, to, NewByteReader(buf))
+	if err != nil {
+		return err
+	}
+
+	return be.Remove(ctx, from)
+}
+
+// MoveToTrash moves the file h to the trash, from where it is removed by
+// PurgeTrash later. If the backend cannot rename files, the file is only
+// copied into the trash when allowCopy is set, otherwise an error with the
+// cause ErrRenameUnsupported is returned and the file is left in place.
+func MoveToTrash(ctx context.Context, be Backend, h Handle, allowCopy bool) error {
+	if h.Type == TrashFile || h.Type == ConfigFile || h.Type == NewConfigFile {
+		return errors.Errorf("unable to move %v to the trash", h)
+	}
+
+	to := Handle{Type: TrashFile, Name: trashName(h, time.Now())}
+	debug.Log("move %v to %v", h, to)
+
+	err := moveFile(ctx, be, h, to, allowCopy)
+	if err != nil {
+		return errors.Wrapf(err, "move %v to the trash", h)
+	}
+	return nil
+}
+
+// RestoreFromTrash moves the file e back from the trash to its original
+// location. Files are copied back if the backend cannot rename them.
+func RestoreFromTrash(ctx context.Context, be Backend, e TrashEntry) error {
+	from := Handle{Type: TrashFile, Name: e.Name}
+	debug.Log("move %v back to %v", from, e.Handle)
+
+	err := moveFile(ctx, be, from, e.Handle, true)
+	if err != nil {
+		return errors.Wrapf(err, "restore %v from the trash", e.Handle)
+	}
+	return nil
+}
+
+// ListTrash returns all files in the trash, oldest first.
+func ListTrash(ctx context.Context, be Backend) ([]TrashEntry, error) {
+	var list []TrashEntry
+	err := be.List(ctx, TrashFile, func(fi FileInfo) error {
+		e, err := ParseTrashName(fi.Name)
+		if err != nil {
+			debug.Log("skip %v: %v", fi.Name, err)
+			return nil
+		}
+
+		e.Size = fi.Size
+		list = append(list, e)
+		return nil
+	})
+	if err != nil && be.IsNotExist(err) {
+		// the trash directory is only created when the first file is moved
+		// there
+		debug.Log("no trash found: %v", err)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Deleted.Before(list[j].Deleted)
+	})
+
+	return list, nil
+}
@@ -0,0 +1,127 @@
+package restic_test
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/backend/local"
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestMoveToTrash(t *testing.T) {
+	be := mem.New()
+	ctx := context.TODO()
+
+	data := []byte("snapshot data")
+	id := restic.Hash(data)
+	h := restic.Handle{Type: restic.SnapshotFile, Name: id.String()}
+	rtest.OK(t, be.Save(ctx, h, restic.NewByteReader(data)))
+
+	list, err := restic.ListTrash(ctx, be)
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(list))
+
+	// the mem backend cannot rename files, so they are only copied on request
+	err = restic.MoveToTrash(ctx, be, h, false)
+	rtest.Assert(t, errors.Cause(err) == restic.ErrRenameUnsupported, "unexpected error %v", err)
+
+	found, err := be.Test(ctx, h)
+	rtest.OK(t, err)
+	rtest.Assert(t, found, "file removed although it was not copied to the trash")
+
+	start := time.Now().Add(-time.Second)
+	rtest.OK(t, restic.MoveToTrash(ctx, be, h, true))
+
+	found, err = be.Test(ctx, h)
+	rtest.OK(t, err)
+	rtest.Assert(t, !found, "file still present after moving it to the trash")
+
+	list, err = restic.ListTrash(ctx, be)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(list))
+
+	e := list[0]
+	rtest.Equals(t, h, e.Handle)
+	rtest.Equals(t, int64(len(data)), e.Size)
+	rtest.Assert(t, !e.Deleted.Before(start.Truncate(time.Second)), "wrong deletion time %v", e.Deleted)
+
+	rtest.Assert(t, restic.MoveToTrash(ctx, be, restic.Handle{Type: restic.ConfigFile}, true) != nil,
+		"config moved to the trash")
+
+	rtest.OK(t, restic.RestoreFromTrash(ctx, be, e))
+
+	found, err = be.Test(ctx, h)
+	rtest.OK(t, err)
+	rtest.Assert(t, found, "file not restored from the trash")
+
+	list, err = restic.ListTrash(ctx, be)
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(list))
+}
+
+// noLoadBackend fails when a file is loaded.
+type noLoadBackend struct {
+	*local.Local
+}
+
+func (be noLoadBackend) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	return errors.Errorf("unexpected Load(%v)", h)
+}
+
+func TestMoveToTrashRename(t *testing.T) {
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	lbe, err := local.Create(local.Config{Path: filepath.Join(dir, "repo")})
+	rtest.OK(t, err)
+	defer func() {
+		rtest.OK(t, lbe.Close())
+	}()
+	be := noLoadBackend{lbe}
+	ctx := context.TODO()
+
+	data := []byte("pack data")
+	id := restic.Hash(data)
+	h := restic.Handle{Type: restic.DataFile, Name: id.String()}
+	rtest.OK(t, be.Save(ctx, h, restic.NewByteReader(data)))
+
+	// the file is renamed, so it is never loaded
+	rtest.OK(t, restic.MoveToTrash(ctx, be, h, false))
+
+	list, err := restic.ListTrash(ctx, be)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(list))
+	rtest.Equals(t, h, list[0].Handle)
+
+	rtest.OK(t, restic.RestoreFromTrash(ctx, be, list[0]))
+
+	found, err := be.Test(ctx, h)
+	rtest.OK(t, err)
+	rtest.Assert(t, found, "file not restored from the trash")
+}
+
+func TestParseTrashName(t *testing.T) {
+	e, err := restic.ParseTrashName("1539600000.data.0123456789abcdef")
+	rtest.OK(t, err)
+	rtest.Equals(t, restic.Handle{Type: restic.DataFile, Name: "0123456789abcdef"}, e.Handle)
+	rtest.Equals(t, int64(1539600000), e.Deleted.Unix())
+
+	for _, name := range []string{
+		"",
+		"1539600000.data",
+		"x.data.0123",
+		"1539600000.foo.0123",
+		"1539600000.trash.0123",
+		"1539600000.data.",
+	} {
+		if _, err := restic.ParseTrashName(name); err == nil {
+			t.Errorf("%q: expected an error", name)
+		}
+	}
+}
@@ -71,6 +71,13 @@ func (t Tree) binarySearch(name string) (int, *Node, error) {
 	return pos, nil, errors.New("named node not found")
 }
 
+// Find returns the node with the given name. If the tree does not contain such
+// a node, nil is returned.
+func (t Tree) Find(name string) *Node {
+	_, node, _ := t.binarySearch(name)
+	return node
+}
+
 // Sort sorts the nodes by name.
 func (t *Tree) Sort() {
 	list := Nodes(t.Nodes)
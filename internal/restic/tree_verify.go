@@ -0,0 +1,197 @@
+package restic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// TreeMismatch describes a tree whose stored form differs from the form this
+// version of restic produces for the same nodes.
+type TreeMismatch struct {
+	// ID is the ID of the stored tree.
+	ID ID
+	// Computed is the ID recomputed from the nodes of the tree.
+	Computed ID
+	// Reason describes the difference.
+	Reason string
+}
+
+func (m TreeMismatch) String() string {
+	return fmt.Sprintf("tree %v (recomputed as %v): %v", m.ID.Str(), m.Computed.Str(), m.Reason)
+}
+
+// EncodeTree returns the canonical form of the tree t, which is hashed to
+// get the ID of the tree.
+func EncodeTree(t *Tree) ([]byte, error) {
+	buf, err := json.Marshal(t)
+	if err != nil {
+		return nil, errors.Wrap(err, "MarshalJSON")
+	}
+
+	// append a newline so that the data is always consistent (json.Encoder
+	// adds a newline after each object)
+	return append(buf, '\n'), nil
+}
+
+// TreeVerifier recomputes the canonical form and the IDs of trees from the
+// nodes they contain, independently of the stored data. Subtrees are
+// recomputed first and their recomputed IDs are used in the parent, so the
+// recomputed ID of the root tree of a snapshot only matches the stored one
+// if all trees below it are encoded exactly as this version of restic would
+// encode them. Each tree is only verified once.
+type TreeVerifier struct {
+	repo     Repository
+	computed map[ID]ID
+
+	// Mismatches contains all trees found so far whose recomputed form
+	// differs from the stored one.
+	Mismatches []TreeMismatch
+}
+
+// NewTreeVerifier returns a new TreeVerifier for the trees in repo.
+func NewTreeVerifier(repo Repository) *TreeVerifier {
+	return &TreeVerifier{
+		repo:     repo,
+		computed: make(map[ID]ID),
+	}
+}
+
+// Verified returns the number of trees which have been verified so far.
+func (v *TreeVerifier) Verified() int {
+	return len(v.computed)
+}
+
+// Verify recomputes the tree id and all trees below it and returns the
+// recomputed ID of the tree. Differences are recorded in v.Mismatches, an
+// error is only returned when a tree cannot be loaded or decoded.
+func (v *TreeVerifier) Verify(ctx context.Context, id ID) (ID, error) {
+	if computed, ok := v.computed[id]; ok {
+		return computed, nil
+	}
+
+	if ctx.Err() != nil {
+		return ID{}, ctx.Err()
+	}
+
+	size, found := v.repo.LookupBlobSize(id, TreeBlob)
+	if !found {
+		return ID{}, errors.Errorf("tree %v not found in repository", id.Str())
+	}
+
+	buf := NewBlobBuffer(int(size))
+	n, err := v.repo.LoadBlob(ctx, TreeBlob, id, buf)
+	if err != nil {
+		return ID{}, err
+	}
+	buf = buf[:n]
+
+	tree := &Tree{}
+	err = json.Unmarshal(buf, tree)
+	if err != nil {
+		return ID{}, errors.Wrapf(err, "decoding tree %v", id.Str())
+	}
+
+	// nodes are looked up with a binary search, the archiver saves them
+	// sorted by name
+	var reasons []string
+	byName := func(i, j int) bool { return tree.Nodes[i].Name < tree.Nodes[j].Name }
+	if !sort.SliceIsSorted(tree.Nodes, byName) {
+		reasons = append(reasons, "nodes are not sorted by name")
+		sort.SliceStable(tree.Nodes, byName)
+	}
+
+	for _, node := range tree.Nodes {
+		if node.MetadataDigest != "" && !node.HasValidMetadataDigest() {
+			reasons = append(reasons, fmt.Sprintf("metadata digest of %q differs", node.Name))
+			node.MetadataDigest = node.ComputeMetadataDigest()
+		}
+
+		if node.Type != "dir" {
+			continue
+		}
+
+		if node.Subtree == nil {
+			reasons = append(reasons, fmt.Sprintf("directory %q has no subtree", node.Name))
+			continue
+		}
+
+		subtree, err := v.Verify(ctx, *node.Subtree)
+		if err != nil {
+			return ID{}, err
+		}
+
+		if !subtree.Equal(*node.Subtree) {
+			reasons = append(reasons, fmt.Sprintf("subtree of %q differs", node.Name))
+			node.Subtree = &subtree
+		}
+	}
+
+	canonical, err := EncodeTree(tree)
+	if err != nil {
+		return ID{}, errors.Wrapf(err, "encoding tree %v", id.Str())
+	}
+	computed := Hash(canonical)
+
+	if len(reasons) == 0 && !bytes.Equal(buf, canonical) {
+		reasons = append(reasons, describeTreeDifference(buf, canonical)...)
+	}
+
+	if len(reasons) > 0 {
+		debug.Log("tree %v is recomputed as %v: %v", id, computed, reasons)
+		for _, reason := range reasons {
+			v.Mismatches = append(v.Mismatches, TreeMismatch{ID: id, Computed: computed, Reason: reason})
+		}
+	}
+
+	v.computed[id] = computed
+	return computed, nil
+}
+
+// describeTreeDifference explains why the stored tree differs from its
+// canonical form. Fields which are unknown to this version of restic are
+// listed, otherwise the position of the first difference is returned.
+func describeTreeDifference(stored, canonical []byte) []string {
+	type rawTree struct {
+		Nodes []map[string]json.RawMessage `json:"nodes"`
+	}
+
+	var s, c rawTree
+	errS := json.Unmarshal(stored, &s)
+	errC := json.Unmarshal(canonical, &c)
+
+	var reasons []string
+	if errS == nil && errC == nil && len(s.Nodes) == len(c.Nodes) {
+		for i, node := range s.Nodes {
+			var unknown []string
+			for field := range node {
+				if _, ok := c.Nodes[i][field]; !ok {
+					unknown = append(unknown, field)
+				}
+			}
+			if len(unknown) == 0 {
+				continue
+			}
+
+			sort.Strings(unknown)
+			var name string
+			_ = json.Unmarshal(node["name"], &name)
+			reasons = append(reasons, fmt.Sprintf("node %q contains fields unknown to this version: %v", name, unknown))
+		}
+	}
+
+	if len(reasons) > 0 {
+		return reasons
+	}
+
+	pos := 0
+	for pos < len(stored) && pos < len(canonical) && stored[pos] == canonical[pos] {
+		pos++
+	}
+	return []string{fmt.Sprintf("encoding differs from byte %d on", pos)}
+}
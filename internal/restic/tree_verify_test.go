@@ -0,0 +1,128 @@
+package restic_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestTreeVerifierCanonical(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	dir := createTempDir(t)
+	defer func() {
+		if rtest.TestCleanupTempDirs {
+			rtest.RemoveAll(t, dir)
+		}
+	}()
+
+	sn := archiver.TestSnapshot(t, repo, dir, nil)
+
+	v := restic.NewTreeVerifier(repo)
+	id, err := v.Verify(context.TODO(), *sn.Tree)
+	rtest.OK(t, err)
+	rtest.Assert(t, len(v.Mismatches) == 0, "unexpected mismatches: %v", v.Mismatches)
+	rtest.Equals(t, *sn.Tree, id)
+	rtest.Assert(t, v.Verified() > 1, "only %d trees verified", v.Verified())
+}
+
+func saveRawTree(t testing.TB, repo restic.Repository, data []byte) restic.ID {
+	id, err := repo.SaveBlob(context.TODO(), restic.TreeBlob, data, restic.ID{})
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Flush(context.TODO()))
+	return id
+}
+
+func encodeTestTree(t testing.TB, nodes ...*restic.Node) []byte {
+	data, err := restic.EncodeTree(&restic.Tree{Nodes: nodes})
+	rtest.OK(t, err)
+	return data
+}
+
+func TestTreeVerifierMismatch(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	file := &restic.Node{Name: "file", Type: "file", ModTime: time.Unix(1460289341, 0)}
+	canonical := encodeTestTree(t, file)
+
+	var tests = []struct {
+		name   string
+		data   []byte
+		reason string
+	}{
+		{
+			name:   "unknown field",
+			data:   bytes.Replace(canonical, []byte(`"name":"file",`), []byte(`"name":"file","future":1,`), 1),
+			reason: `node "file" contains fields unknown to this version: [future]`,
+		},
+		{
+			name:   "whitespace",
+			data:   bytes.Replace(canonical, []byte(`{"nodes":`), []byte(`{"nodes": `), 1),
+			reason: "encoding differs from byte 9 on",
+		},
+		{
+			name: "unsorted",
+			data: encodeTestTree(t,
+				&restic.Node{Name: "b", Type: "file"},
+				&restic.Node{Name: "a", Type: "file"}),
+			reason: "nodes are not sorted by name",
+		},
+		{
+			name:   "metadata digest",
+			data:   encodeTestTree(t, &restic.Node{Name: "file", Type: "file", MetadataDigest: "0000"}),
+			reason: `metadata digest of "file" differs`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id := saveRawTree(t, repo, test.data)
+
+			v := restic.NewTreeVerifier(repo)
+			computed, err := v.Verify(context.TODO(), id)
+			rtest.OK(t, err)
+
+			rtest.Assert(t, !computed.Equal(id), "recomputed ID is the stored ID")
+			rtest.Equals(t, 1, len(v.Mismatches))
+			rtest.Equals(t, id, v.Mismatches[0].ID)
+			rtest.Equals(t, computed, v.Mismatches[0].Computed)
+			rtest.Equals(t, test.reason, v.Mismatches[0].Reason)
+		})
+	}
+}
+
+func TestTreeVerifierSubtree(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	file := &restic.Node{Name: "file", Type: "file"}
+	canonical := encodeTestTree(t, file)
+	subtree := saveRawTree(t, repo, append([]byte(" "), canonical...))
+
+	dir := &restic.Node{Name: "dir", Type: "dir", Subtree: &subtree}
+	root := saveRawTree(t, repo, encodeTestTree(t, dir))
+
+	v := restic.NewTreeVerifier(repo)
+	computed, err := v.Verify(context.TODO(), root)
+	rtest.OK(t, err)
+
+	// the subtree is recomputed from its nodes and used in the root tree
+	recomputedSubtree := restic.Hash(canonical)
+	dir.Subtree = &recomputedSubtree
+	rtest.Equals(t, restic.Hash(encodeTestTree(t, dir)), computed)
+
+	rtest.Equals(t, 2, len(v.Mismatches))
+	rtest.Equals(t, subtree, v.Mismatches[0].ID)
+	rtest.Equals(t, root, v.Mismatches[1].ID)
+	rtest.Assert(t, strings.Contains(v.Mismatches[1].Reason, `subtree of "dir" differs`),
+		"unexpected reason %q", v.Mismatches[1].Reason)
+}
@@ -0,0 +1,113 @@
+package restic
+
+import (
+	"os"
+	"sync"
+
+	"github.com/restic/restic/internal/fs"
+)
+
+// IsZero returns true if all bytes in buf are zero.
+func IsZero(buf []byte) bool {
+	for _, b := range buf {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+var zeroBlobs struct {
+	sync.Mutex
+	ids map[int]ID
+}
+
+// ZeroBlobID returns the ID of a blob which consists of size zero bytes. The
+// chunker cuts runs of zero bytes into chunks of the same length, so a few
+// sizes are used for all zero chunks of a backup and the IDs are only
+// computed once.
+func ZeroBlobID(size int) ID {
+	zeroBlobs.Lock()
+	defer zeroBlobs.Unlock()
+
+	if id, ok := zeroBlobs.ids[size]; ok {
+		return id
+	}
+
+	if zeroBlobs.ids == nil {
+		zeroBlobs.ids = make(map[int]ID)
+	}
+
+	id := Hash(make([]byte, size))
+	zeroBlobs.ids[size] = id
+	return id
+}
+
+// holeWriter is implemented by writers which can skip over a run of zero
+// bytes instead of writing them.
+type holeWriter interface {
+	WriteHole(n int64) error
+}
+
+// sparseFile writes a file sequentially, the runs of zero bytes passed to
+// WriteHole are left as holes in the file. Zero bytes passed to Write which
+// fall into one of the holes are skipped as well.
+type sparseFile struct {
+	f     *os.File
+	pos   int64
+	holes []fs.Hole
+}
+
+func (s *sparseFile) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n, hole := s.nextRange(len(p))
+		if !hole || !IsZero(p[:n]) {
+			_, err := s.f.WriteAt(p[:n], s.pos)
+			if err != nil {
+				return written, err
+			}
+		}
+
+		s.pos += int64(n)
+		written += n
+		p = p[n:]
+	}
+
+	return written, nil
+}
+
+// nextRange returns the length of the next part of at most max bytes which is
+// either completely within a hole or outside of all holes.
+func (s *sparseFile) nextRange(max int) (int, bool) {
+	for len(s.holes) > 0 && s.holes[0].End() <= s.pos {
+		s.holes = s.holes[1:]
+	}
+
+	if len(s.holes) == 0 {
+		return max, false
+	}
+
+	h := s.holes[0]
+	if h.Offset > s.pos {
+		if n := h.Offset - s.pos; n < int64(max) {
+			return int(n), false
+		}
+		return max, false
+	}
+
+	if n := h.End() - s.pos; n < int64(max) {
+		return int(n), true
+	}
+	return max, true
+}
+
+func (s *sparseFile) WriteHole(n int64) error {
+	s.pos += n
+	return nil
+}
+
+// Finish sets the size of the file, which is needed when it ends with a hole.
+func (s *sparseFile) Finish() error {
+	return s.f.Truncate(s.pos)
+}
@@ -0,0 +1,75 @@
+package restic
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/restic/restic/internal/fs"
+)
+
+func TestIsZero(t *testing.T) {
+	buf := make([]byte, 1000)
+	if !IsZero(buf) {
+		t.Errorf("buffer with zero bytes not detected")
+	}
+
+	buf[999] = 1
+	if IsZero(buf) {
+		t.Errorf("buffer with non-zero byte detected as zero")
+	}
+
+	if !IsZero(nil) {
+		t.Errorf("empty buffer not detected")
+	}
+}
+
+func TestZeroBlobID(t *testing.T) {
+	for _, size := range []int{0, 1, 512 * 1024} {
+		want := Hash(make([]byte, size))
+		for i := 0; i < 2; i++ {
+			if id := ZeroBlobID(size); id != want {
+				t.Errorf("wrong ID for %d zero bytes, want %v, got %v", size, want.Str(), id.Str())
+			}
+		}
+	}
+}
+
+func TestSparseFileHoles(t *testing.T) {
+	f, err := ioutil.TempFile("", "restic-test-sparse-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+
+	data := make([]byte, 3000)
+	for i := range data[:1000] {
+		data[i] = 1
+	}
+	// non-zero bytes within a hole are still written
+	data[2500] = 2
+
+	sf := &sparseFile{f: f, holes: []fs.Hole{{Offset: 500, Length: 1000}, {Offset: 2000, Length: 1000}}}
+	for _, part := range [][]byte{data[:700], data[700:2100], data[2100:]} {
+		if _, err := sf.Write(part); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := sf.Finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(buf, data) {
+		t.Errorf("wrong data written, want %d bytes, got %d bytes", len(data), len(buf))
+	}
+}
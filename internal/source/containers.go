@@ -0,0 +1,333 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+func init() {
+	Register(Plugin{
+		Name:        "containers",
+		Description: "export systemd-nspawn images and LXD instances",
+		New:         newContainers,
+	})
+}
+
+// containerTypes are the kinds of containers the containers source can save.
+var containerTypes = []string{"lxd", "nspawn"}
+
+// containers saves an export of each systemd-nspawn image and LXD instance,
+// as created by "machinectl export-tar" and "lxc export". The exports are
+// streamed into the repository without being stored on the local disk.
+type containers struct {
+	types  []string
+	freeze bool
+
+	m     sync.Mutex
+	names map[string][]string
+}
+
+// newContainers creates the containers source. The options are "types", a
+// comma-separated list of the kinds of containers to save (default: all for
+// which the management program is installed), and "freeze", which freezes a
+// running nspawn container while it is exported.
+func newContainers(options map[string]string) (Source, error) {
+	c := &containers{names: make(map[string][]string)}
+
+	for key, value := range options {
+		switch key {
+		case "types":
+			for _, t := range strings.Split(value, ",") {
+				t = strings.TrimSpace(t)
+				if t == "" {
+					continue
+				}
+
+				i := sort.SearchStrings(containerTypes, t)
+				if i == len(containerTypes) || containerTypes[i] != t {
+					return nil, errors.Errorf("unknown container type %q", t)
+				}
+				c.types = append(c.types, t)
+			}
+		case "freeze":
+			freeze, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, errors.Errorf("invalid value %q for option freeze", value)
+			}
+			c.freeze = freeze
+		default:
+			return nil, errors.Errorf("unknown option %q", key)
+		}
+	}
+
+	if c.types == nil {
+		for _, t := range containerTypes {
+			if _, err := exec.LookPath(containerProgram(t)); err == nil {
+				c.types = append(c.types, t)
+			}
+		}
+
+		if c.types == nil {
+			return nil, errors.New("neither machinectl nor lxc were found")
+		}
+	}
+
+	return c, nil
+}
+
+// containerProgram returns the name of the program which manages the
+// containers of type t.
+func containerProgram(t string) string {
+	if t == "nspawn" {
+		return "machinectl"
+	}
+	return "lxc"
+}
+
+// output runs the program and returns its output.
+func output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Errorf("%v %v: %v: %s", name, strings.Join(args, " "), err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out, nil
+}
+
+// parseImages returns the names and types of the images listed by
+// "machinectl list-images --no-legend". Hidden images, e.g. ".host", are
+// skipped.
+func parseImages(out []byte) map[string]string {
+	images := make(map[string]string)
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], ".") {
+			continue
+		}
+		images[fields[0]] = fields[1]
+	}
+	return images
+}
+
+// parseInstances returns the names of the instances listed by
+// "lxc list --format csv --columns n".
+func parseInstances(out []byte) []string {
+	var names []string
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		if name := strings.TrimSpace(sc.Text()); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Items returns an item for the export of each container.
+func (c *containers) Items(ctx context.Context) ([]Item, error) {
+	now := time.Now()
+	var items []Item
+
+	add := func(t, name, ext string) {
+		items = append(items, Item{
+			Path:    t + "/" + name + ext,
+			Mode:    0600,
+			ModTime: now,
+			Size:    -1,
+		})
+
+		c.m.Lock()
+		c.names[t] = append(c.names[t], name)
+		c.m.Unlock()
+	}
+
+	for _, t := range c.types {
+		switch t {
+		case "nspawn":
+			out, err := output(ctx, "machinectl", "list-images", "--no-legend", "--no-pager")
+			if err != nil {
+				return nil, err
+			}
+
+			for name, typ := range parseImages(out) {
+				if typ == "raw" {
+					add(t, name, ".raw")
+				} else {
+					add(t, name, ".tar")
+				}
+			}
+		case "lxd":
+			out, err := output(ctx, "lxc", "list", "--format", "csv", "--columns", "n")
+			if err != nil {
+				return nil, err
+			}
+
+			for _, name := range parseInstances(out) {
+				add(t, name, ".tar.gz")
+			}
+		}
+	}
+
+	debug.Log("found %d containers", len(items))
+	return items, nil
+}
+
+// Open starts exporting the container.
+func (c *containers) Open(ctx context.Context, item Item) (io.ReadCloser, error) {
+	parts := strings.SplitN(item.Path, "/", 2)
+	if len(parts) != 2 {
+		return nil, errors.Errorf("invalid item %v", item.Path)
+	}
+
+	var (
+		cmd  *exec.Cmd
+		unit string
+	)
+
+	switch t, file := parts[0], parts[1]; {
+	case t == "nspawn" && strings.HasSuffix(file, ".raw"):
+		cmd = exec.CommandContext(ctx, "machinectl", "export-raw", strings.TrimSuffix(file, ".raw"))
+	case t == "nspawn":
+		name := strings.TrimSuffix(file, ".tar")
+		cmd = exec.CommandContext(ctx, "machinectl", "export-tar", name)
+		unit = "systemd-nspawn@" + name + ".service"
+	case t == "lxd":
+		cmd = exec.CommandContext(ctx, "lxc", "--quiet", "export", strings.TrimSuffix(file, ".tar.gz"), "/dev/stdout")
+	default:
+		return nil, errors.Errorf("invalid item %v", item.Path)
+	}
+
+	// a running container is frozen, so that its files do not change while
+	// they are exported
+	var thaw func()
+	if c.freeze && unit != "" {
+		if _, err := output(ctx, "systemctl", "is-active", "--quiet", unit); err == nil {
+			if _, err := output(ctx, "systemctl", "freeze", unit); err != nil {
+				return nil, err
+			}
+			thaw = func() {
+				if _, err := output(context.Background(), "systemctl", "thaw", unit); err != nil {
+					debug.Log("thawing %v failed: %v", unit, err)
+				}
+			}
+		}
+	}
+
+	rd, err := startCommand(cmd)
+	if err != nil {
+		if thaw != nil {
+			thaw()
+		}
+		return nil, err
+	}
+	rd.done = thaw
+
+	return rd, nil
+}
+
+// Metadata returns the names of the containers in the labels
+// "containers.lxd" and "containers.nspawn".
+func (c *containers) Metadata(ctx context.Context) (map[string]string, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	labels := make(map[string]string)
+	for t, names := range c.names {
+		sorted := append([]string(nil), names...)
+		sort.Strings(sorted)
+		labels["containers."+t] = strings.Join(sorted, ",")
+	}
+	return labels, nil
+}
+
+// Close does nothing, the exports do not leave anything behind.
+func (c *containers) Close() error {
+	return nil
+}
+
+// commandReader returns the output of a program. The exit status of the
+// program is checked at the end of the output, so that an incomplete export
+// is not taken for the complete data.
+type commandReader struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr bytes.Buffer
+	waited bool
+
+	// done, if not nil, is called when the program has exited.
+	done func()
+}
+
+func startCommand(cmd *exec.Cmd) (*commandReader, error) {
+	rd := &commandReader{cmd: cmd}
+	cmd.Stderr = &rd.stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, errors.Wrap(err, "StdoutPipe")
+	}
+	rd.stdout = stdout
+
+	debug.Log("running %v", cmd.Args)
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Wrapf(err, "start %v", cmd.Path)
+	}
+
+	return rd, nil
+}
+
+// wait waits for the program to exit and returns an error if it failed.
+func (rd *commandReader) wait() error {
+	if rd.waited {
+		return nil
+	}
+	rd.waited = true
+
+	err := rd.cmd.Wait()
+	if rd.done != nil {
+		rd.done()
+	}
+
+	if err != nil {
+		return errors.Errorf("%v: %v: %s", strings.Join(rd.cmd.Args, " "), err, bytes.TrimSpace(rd.stderr.Bytes()))
+	}
+	return nil
+}
+
+func (rd *commandReader) Read(p []byte) (int, error) {
+	n, err := rd.stdout.Read(p)
+	if err == io.EOF {
+		if werr := rd.wait(); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// Close stops the program if it is still running.
+func (rd *commandReader) Close() error {
+	if rd.waited {
+		return nil
+	}
+
+	if rd.cmd.Process != nil {
+		_ = rd.cmd.Process.Signal(os.Kill)
+	}
+	_ = rd.wait()
+	return nil
+}
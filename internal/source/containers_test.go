@@ -0,0 +1,34 @@
+package source
+
+import (
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseImages(t *testing.T) {
+	out := []byte(`.host  directory no  n/a      n/a                           n/a
+debian directory no  1.2G     Thu 2026-10-15 10:00:00 CEST  Thu 2026-10-15 11:00:00 CEST
+fedora raw       no  2.0G     Thu 2026-10-15 10:00:00 CEST  Thu 2026-10-15 11:00:00 CEST
+`)
+
+	rtest.Equals(t, map[string]string{"debian": "directory", "fedora": "raw"}, parseImages(out))
+}
+
+func TestParseInstances(t *testing.T) {
+	rtest.Equals(t, []string{"web", "db"}, parseInstances([]byte("web\ndb\n\n")))
+}
+
+func TestContainersOptions(t *testing.T) {
+	src, err := newContainers(map[string]string{"types": "nspawn", "freeze": "true"})
+	rtest.OK(t, err)
+	c := src.(*containers)
+	rtest.Equals(t, []string{"nspawn"}, c.types)
+	rtest.Assert(t, c.freeze, "freeze is not set")
+
+	_, err = newContainers(map[string]string{"types": "docker"})
+	rtest.Assert(t, err != nil, "no error for unknown type")
+
+	_, err = newContainers(map[string]string{"foo": "bar"})
+	rtest.Assert(t, err != nil, "no error for unknown option")
+}
@@ -0,0 +1,4 @@
+// Package source contains sources which provide the data of applications,
+// such as virtual machines, containers or databases, as a tree of virtual
+// files that the archiver can save like files in a file system.
+package source
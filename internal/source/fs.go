@@ -0,0 +1,319 @@
+package source
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+)
+
+// entry is an item in the tree of an FS.
+type entry struct {
+	// path is the absolute path of the item in the FS.
+	path string
+	item Item
+
+	// names contains the sorted names of the entries of a directory.
+	names []string
+}
+
+// FS presents the items of a source as a read-only file system for the
+// archiver. All items are located below the directory "/" + name.
+type FS struct {
+	ctx     context.Context
+	src     Source
+	entries map[string]*entry
+}
+
+var _ fs.FS = &FS{}
+
+// NewFS loads the list of items from src and returns a file system with them
+// below the directory "/" + name. The file system must be closed, which also
+// closes src.
+func NewFS(ctx context.Context, name string, src Source) (*FS, error) {
+	items, err := src.Items(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fsys := &FS{
+		ctx:     ctx,
+		src:     src,
+		entries: make(map[string]*entry),
+	}
+
+	now := time.Now()
+	fsys.entries["/"] = &entry{path: "/", item: Item{Mode: os.ModeDir | 0755, ModTime: now}}
+
+	for _, item := range items {
+		if !validPath(item.Path) {
+			return nil, errors.Errorf("source %v: invalid path %q", name, item.Path)
+		}
+
+		p := path.Join("/", name, item.Path)
+		if err := fsys.add(p, item, now); err != nil {
+			return nil, errors.Errorf("source %v: %v", name, err)
+		}
+	}
+
+	// the root directory of the source exists even if it has no items
+	if _, ok := fsys.entries["/"+name]; !ok {
+		if err := fsys.add("/"+name, Item{Mode: os.ModeDir | 0755, ModTime: now}, now); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, e := range fsys.entries {
+		sort.Strings(e.names)
+	}
+
+	debug.Log("source %v has %d items", name, len(items))
+	return fsys, nil
+}
+
+// validPath returns true if p is a relative path which does not leave the
+// root directory of the source.
+func validPath(p string) bool {
+	if p == "" || strings.HasPrefix(p, "/") {
+		return false
+	}
+
+	for _, name := range strings.Split(p, "/") {
+		if name == ".." {
+			return false
+		}
+	}
+
+	return path.Clean(p) != "."
+}
+
+// add inserts the item into the tree at p, and creates the directories it is
+// located in.
+func (fsys *FS) add(p string, item Item, now time.Time) error {
+	if e, ok := fsys.entries[p]; ok {
+		// a directory may have been created for an item located in it
+		if !e.item.Mode.IsDir() || !item.Mode.IsDir() {
+			return errors.Errorf("duplicate item %v", p)
+		}
+		e.item = item
+		return nil
+	}
+
+	dir := path.Dir(p)
+	parent, ok := fsys.entries[dir]
+	if !ok {
+		err := fsys.add(dir, Item{Mode: os.ModeDir | 0755, ModTime: now}, now)
+		if err != nil {
+			return err
+		}
+		parent = fsys.entries[dir]
+	}
+
+	if !parent.item.Mode.IsDir() {
+		return errors.Errorf("%v is not a directory", dir)
+	}
+
+	parent.names = append(parent.names, path.Base(p))
+	fsys.entries[p] = &entry{path: p, item: item}
+	return nil
+}
+
+func (fsys *FS) lookup(op, name string) (*entry, error) {
+	e, ok := fsys.entries[path.Clean(name)]
+	if !ok {
+		return nil, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return e, nil
+}
+
+// Lstat returns the attributes of the item name.
+func (fsys *FS) Lstat(name string) (os.FileInfo, error) {
+	e, err := fsys.lookup("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	return newFileInfo(e), nil
+}
+
+// Readlink returns the destination of the symlink name.
+func (fsys *FS) Readlink(name string) (string, error) {
+	e, err := fsys.lookup("readlink", name)
+	if err != nil {
+		return "", err
+	}
+
+	if e.item.Mode&os.ModeSymlink == 0 {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: errors.New("not a symlink")}
+	}
+	return e.item.LinkTarget, nil
+}
+
+// ReadDirNames returns the sorted names of the entries of the directory name.
+func (fsys *FS) ReadDirNames(name string) ([]string, error) {
+	e, err := fsys.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !e.item.Mode.IsDir() {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return append([]string(nil), e.names...), nil
+}
+
+// Open opens the item name. The content of a file is requested from the
+// source when it is read for the first time.
+func (fsys *FS) Open(name string) (fs.File, error) {
+	e, err := fsys.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &file{fs: fsys, entry: e}, nil
+}
+
+// Metadata returns the information about the application provided by the
+// source.
+func (fsys *FS) Metadata() (map[string]string, error) {
+	return fsys.src.Metadata(fsys.ctx)
+}
+
+// Close closes the source.
+func (fsys *FS) Close() error {
+	return fsys.src.Close()
+}
+
+// fileInfo describes an item.
+type fileInfo struct {
+	name string
+	item Item
+	stat *fs.RemoteStat
+}
+
+func newFileInfo(e *entry) fileInfo {
+	return fileInfo{
+		name: path.Base(e.path),
+		item: e.item,
+		stat: &fs.RemoteStat{AccessTime: e.item.ModTime, LinkTarget: e.item.LinkTarget},
+	}
+}
+
+func (fi fileInfo) Name() string       { return fi.name }
+func (fi fileInfo) Mode() os.FileMode  { return fi.item.Mode }
+func (fi fileInfo) ModTime() time.Time { return fi.item.ModTime }
+func (fi fileInfo) IsDir() bool        { return fi.item.Mode.IsDir() }
+func (fi fileInfo) Sys() interface{}   { return fi.stat }
+
+// Size returns the size of a file, or zero if it is not known.
+func (fi fileInfo) Size() int64 {
+	if fi.item.Size < 0 {
+		return 0
+	}
+	return fi.item.Size
+}
+
+// file is an opened item.
+type file struct {
+	fs    *FS
+	entry *entry
+
+	rd  io.ReadCloser
+	pos int64
+}
+
+var _ fs.File = &file{}
+var _ fs.StreamedFile = &file{}
+
+func (f *file) Read(p []byte) (int, error) {
+	if !f.entry.item.Mode.IsRegular() {
+		return 0, &os.PathError{Op: "read", Path: f.entry.path, Err: errors.New("not a file")}
+	}
+
+	if f.rd == nil {
+		rd, err := f.fs.src.Open(f.fs.ctx, f.entry.item)
+		if err != nil {
+			return 0, err
+		}
+		f.rd = rd
+	}
+
+	n, err := f.rd.Read(p)
+	f.pos += int64(n)
+	return n, err
+}
+
+func (f *file) Write(p []byte) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: f.entry.path, Err: errors.New("read-only file system")}
+}
+
+// Seek returns the current position, or starts reading the content from the
+// beginning again. Other positions are not supported.
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	switch {
+	case offset == 0 && whence == io.SeekCurrent:
+		return f.pos, nil
+	case offset == 0 && whence == io.SeekStart:
+		err := f.Close()
+		f.pos = 0
+		return 0, err
+	}
+
+	return f.pos, &os.PathError{Op: "seek", Path: f.entry.path, Err: errors.New("not supported")}
+}
+
+// Close closes the reader returned by the source.
+func (f *file) Close() error {
+	if f.rd == nil {
+		return nil
+	}
+
+	err := f.rd.Close()
+	f.rd = nil
+	return err
+}
+
+// Fd returns an invalid file descriptor, the file is not a local file.
+func (f *file) Fd() uintptr {
+	return ^uintptr(0)
+}
+
+func (f *file) Stat() (os.FileInfo, error) {
+	return newFileInfo(f.entry), nil
+}
+
+// SizeUnknown returns true if the size of the content is only known after
+// it has been read.
+func (f *file) SizeUnknown() bool {
+	return f.entry.item.Size < 0
+}
+
+// Readdir returns all entries of the directory, n is ignored.
+func (f *file) Readdir(n int) ([]os.FileInfo, error) {
+	names, err := f.Readdirnames(n)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]os.FileInfo, 0, len(names))
+	for _, name := range names {
+		fi, err := f.fs.Lstat(path.Join(f.entry.path, name))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, fi)
+	}
+	return list, nil
+}
+
+// Readdirnames returns the names of all entries of the directory, n is
+// ignored.
+func (f *file) Readdirnames(n int) ([]string, error) {
+	return f.fs.ReadDirNames(f.entry.path)
+}
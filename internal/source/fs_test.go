@@ -0,0 +1,166 @@
+package source_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/source"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// memSource provides files from memory.
+type memSource struct {
+	items []source.Item
+	data  map[string][]byte
+	opens int
+}
+
+func (s *memSource) Items(ctx context.Context) ([]source.Item, error) {
+	return s.items, nil
+}
+
+func (s *memSource) Open(ctx context.Context, item source.Item) (io.ReadCloser, error) {
+	s.opens++
+	return ioutil.NopCloser(bytes.NewReader(s.data[item.Path])), nil
+}
+
+func (s *memSource) Metadata(ctx context.Context) (map[string]string, error) {
+	return map[string]string{"version": "1.0"}, nil
+}
+
+func (s *memSource) Close() error {
+	return nil
+}
+
+func newMemSource() *memSource {
+	ts := time.Unix(1460289341, 0)
+	return &memSource{
+		items: []source.Item{
+			{Path: "db/dump.sql", Mode: 0600, ModTime: ts, Size: -1},
+			{Path: "db/config", Mode: 0644, ModTime: ts, Size: 6},
+			{Path: "current", Mode: os.ModeSymlink | 0777, ModTime: ts, LinkTarget: "db"},
+		},
+		data: map[string][]byte{
+			"db/dump.sql": rtest.Random(23, 3*1024*1024),
+			"db/config":   []byte("a = 1\n"),
+		},
+	}
+}
+
+func TestFS(t *testing.T) {
+	src := newMemSource()
+	fsys, err := source.NewFS(context.TODO(), "app", src)
+	rtest.OK(t, err)
+	defer fsys.Close()
+
+	names, err := fsys.ReadDirNames("/")
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"app"}, names)
+
+	names, err = fsys.ReadDirNames("/app")
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"current", "db"}, names)
+
+	names, err = fsys.ReadDirNames("/app/db")
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"config", "dump.sql"}, names)
+
+	fi, err := fsys.Lstat("/app/db")
+	rtest.OK(t, err)
+	rtest.Assert(t, fi.IsDir(), "/app/db is not a directory")
+
+	target, err := fsys.Readlink("/app/current")
+	rtest.OK(t, err)
+	rtest.Equals(t, "db", target)
+
+	_, err = fsys.Lstat("/app/missing")
+	rtest.Assert(t, os.IsNotExist(err), "unexpected error %v", err)
+
+	// the size of the dump is unknown
+	fi, err = fsys.Lstat("/app/db/dump.sql")
+	rtest.OK(t, err)
+	rtest.Equals(t, int64(0), fi.Size())
+
+	f, err := fsys.Open("/app/db/dump.sql")
+	rtest.OK(t, err)
+	rtest.Assert(t, f.(fs.StreamedFile).SizeUnknown(), "size of the dump is known")
+
+	buf, err := ioutil.ReadAll(f)
+	rtest.OK(t, err)
+	rtest.Assert(t, bytes.Equal(src.data["db/dump.sql"], buf), "wrong content read")
+
+	// seeking to the start reads the content again
+	_, err = f.Seek(0, io.SeekStart)
+	rtest.OK(t, err)
+	buf, err = ioutil.ReadAll(f)
+	rtest.OK(t, err)
+	rtest.Assert(t, bytes.Equal(src.data["db/dump.sql"], buf), "wrong content read")
+	rtest.Equals(t, 2, src.opens)
+	rtest.OK(t, f.Close())
+
+	meta, err := fsys.Metadata()
+	rtest.OK(t, err)
+	rtest.Equals(t, "1.0", meta["version"])
+}
+
+func TestFSInvalidItems(t *testing.T) {
+	var tests = [][]source.Item{
+		{{Path: "../etc/passwd"}},
+		{{Path: "/etc/passwd"}},
+		{{Path: ""}},
+		{{Path: "file"}, {Path: "file"}},
+		{{Path: "file"}, {Path: "file/sub"}},
+	}
+
+	for _, items := range tests {
+		_, err := source.NewFS(context.TODO(), "app", &memSource{items: items})
+		rtest.Assert(t, err != nil, "no error for %v", items)
+	}
+}
+
+func TestFSArchive(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	src := newMemSource()
+	fsys, err := source.NewFS(context.TODO(), "app", src)
+	rtest.OK(t, err)
+	defer fsys.Close()
+
+	arch := archiver.New(repo)
+	arch.FS = fsys
+	sn, _, err := arch.Snapshot(context.TODO(), nil, []string{"/app"}, nil, "localhost", nil, time.Now())
+	rtest.OK(t, err)
+
+	tree, err := repo.LoadTree(context.TODO(), *sn.Tree)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(tree.Nodes))
+	rtest.Equals(t, "app", tree.Nodes[0].Name)
+
+	tree, err = repo.LoadTree(context.TODO(), *tree.Nodes[0].Subtree)
+	rtest.OK(t, err)
+	rtest.Equals(t, 2, len(tree.Nodes))
+	rtest.Equals(t, "db", tree.Nodes[0].LinkTarget)
+
+	tree, err = repo.LoadTree(context.TODO(), *tree.Nodes[1].Subtree)
+	rtest.OK(t, err)
+	rtest.Equals(t, 2, len(tree.Nodes))
+
+	for _, node := range tree.Nodes {
+		want := src.data["db/"+node.Name]
+		rtest.Equals(t, uint64(len(want)), node.Size)
+
+		var buf bytes.Buffer
+		rtest.OK(t, node.WriteContentRange(context.TODO(), repo, 0, -1, &buf))
+		rtest.Assert(t, bytes.Equal(want, buf.Bytes()), "wrong content for %v", node.Name)
+	}
+
+}
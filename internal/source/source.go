@@ -0,0 +1,92 @@
+package source
+
+import (
+	"context"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// Item is a file, directory or symlink provided by a source.
+type Item struct {
+	// Path is the slash-separated path of the item below the root of the
+	// source, e.g. "lxd/web.tar.gz".
+	Path string
+
+	// Mode contains the type and the permissions of the item.
+	Mode    os.FileMode
+	ModTime time.Time
+
+	// Size is the size of the content of a file, or -1 if it is only known
+	// once the content has been read, e.g. when it is produced by a program.
+	Size int64
+
+	// LinkTarget is the destination of a symlink.
+	LinkTarget string
+}
+
+// Source provides the data of an application as a tree of items. Directories
+// which contain items do not need to be returned explicitly.
+type Source interface {
+	// Items returns all items of the source. It is called once when the
+	// backup starts, so the source can take a consistent snapshot of the
+	// application here.
+	Items(ctx context.Context) ([]Item, error)
+
+	// Open returns the content of the file item. It may be called several
+	// times for an item, each reader returns the content from the start.
+	Open(ctx context.Context, item Item) (io.ReadCloser, error)
+
+	// Metadata returns information about the application, e.g. its version,
+	// which is stored in the labels of the snapshot.
+	Metadata(ctx context.Context) (map[string]string, error)
+
+	// Close releases all resources of the source, e.g. removes a snapshot of
+	// the application created by Items.
+	Close() error
+}
+
+// Plugin creates sources of one kind.
+type Plugin struct {
+	Name        string
+	Description string
+
+	// New returns a source configured by the options given by the user.
+	New func(options map[string]string) (Source, error)
+}
+
+var plugins = make(map[string]Plugin)
+
+// Register makes a plugin available under its name. It panics if the name is
+// already used.
+func Register(p Plugin) {
+	if _, ok := plugins[p.Name]; ok {
+		panic("source plugin " + p.Name + " registered twice")
+	}
+	plugins[p.Name] = p
+}
+
+// All returns all registered plugins, sorted by name.
+func All() []Plugin {
+	list := make([]Plugin, 0, len(plugins))
+	for _, p := range plugins {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// New returns a source created by the plugin name.
+func New(name string, options map[string]string) (Source, error) {
+	p, ok := plugins[name]
+	if !ok {
+		return nil, errors.Errorf("unknown source %q", name)
+	}
+
+	return p.New(options)
+}
@@ -0,0 +1,3 @@
+// Package status implements a server which streams the progress of a running
+// operation as JSON messages to clients connected to a unix socket.
+package status
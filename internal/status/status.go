@@ -0,0 +1,201 @@
+package status
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// writeTimeout limits how long a slow client may block sending an event.
+const writeTimeout = 5 * time.Second
+
+// Event is sent to all clients, one JSON document per line.
+type Event struct {
+	Type    string    `json:"type"`
+	Command string    `json:"command"`
+	Time    time.Time `json:"time"`
+
+	SecondsElapsed   uint64  `json:"seconds_elapsed"`
+	SecondsRemaining uint64  `json:"seconds_remaining,omitempty"`
+	PercentDone      float64 `json:"percent_done"`
+
+	TotalFiles uint64 `json:"total_files"`
+	FilesDone  uint64 `json:"files_done"`
+	TotalBytes uint64 `json:"total_bytes"`
+	BytesDone  uint64 `json:"bytes_done"`
+	BytesAdded uint64 `json:"bytes_added"`
+	ErrorCount uint64 `json:"error_count"`
+
+	FilesNew          uint64 `json:"files_new,omitempty"`
+	FilesChanged      uint64 `json:"files_changed,omitempty"`
+	FilesUnmodified   uint64 `json:"files_unmodified,omitempty"`
+	BytesDeduplicated uint64 `json:"bytes_deduplicated,omitempty"`
+
+	CurrentFiles []string `json:"current_files,omitempty"`
+
+	// Path and Action are set for events which describe a single file.
+	Path   string `json:"path,omitempty"`
+	Action string `json:"action,omitempty"`
+
+	Message string `json:"message,omitempty"`
+}
+
+// Server accepts connections on a unix socket and sends events to all
+// connected clients. A nil Server discards all events.
+type Server struct {
+	filename string
+	listener net.Listener
+
+	m       sync.Mutex
+	clients map[net.Conn]struct{}
+	last    []byte
+	closed  bool
+}
+
+// Listen creates the unix socket filename and starts accepting clients. A
+// stale socket left behind by a process which has exited is replaced, any
+// other existing file is an error.
+func Listen(filename string) (*Server, error) {
+	if fi, err := os.Lstat(filename); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, errors.Errorf("status socket %v already exists and is not a socket", filename)
+		}
+
+		conn, err := net.Dial("unix", filename)
+		if err == nil {
+			_ = conn.Close()
+			return nil, errors.Errorf("status socket %v is in use by another process", filename)
+		}
+
+		debug.Log("removing stale socket %v", filename)
+		if err = os.Remove(filename); err != nil {
+			return nil, errors.Wrap(err, "Remove")
+		}
+	}
+
+	l, err := net.Listen("unix", filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "Listen")
+	}
+
+	s := &Server{
+		filename: filename,
+		listener: l,
+		clients:  make(map[net.Conn]struct{}),
+	}
+
+	go s.accept()
+	return s, nil
+}
+
+func (s *Server) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			debug.Log("Accept() returned %v", err)
+			return
+		}
+
+		debug.Log("new client %v", conn.RemoteAddr())
+
+		s.m.Lock()
+		if s.closed {
+			s.m.Unlock()
+			_ = conn.Close()
+			return
+		}
+
+		// new clients get the most recent event right away
+		if s.last != nil && !s.write(conn, s.last) {
+			s.m.Unlock()
+			continue
+		}
+		s.clients[conn] = struct{}{}
+		s.m.Unlock()
+	}
+}
+
+// write sends buf to the client, which is closed on error. It returns false
+// if the client has been closed.
+func (s *Server) write(conn net.Conn, buf []byte) bool {
+	_ = conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := conn.Write(buf)
+	if err != nil {
+		debug.Log("removing client %v: %v", conn.RemoteAddr(), err)
+		_ = conn.Close()
+		return false
+	}
+	return true
+}
+
+// Send encodes ev and sends it to all clients. Clients which cannot receive
+// the event are disconnected.
+func (s *Server) Send(ev Event) {
+	if s == nil {
+		return
+	}
+
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+
+	buf, err := json.Marshal(ev)
+	if err != nil {
+		debug.Log("Marshal() returned %v", err)
+		return
+	}
+	buf = append(buf, '\n')
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	// events for single files are not repeated for new clients
+	if ev.Path == "" {
+		s.last = buf
+	}
+	for conn := range s.clients {
+		if !s.write(conn, buf) {
+			delete(s.clients, conn)
+		}
+	}
+}
+
+// Close disconnects all clients and removes the socket.
+func (s *Server) Close() error {
+	if s == nil {
+		return nil
+	}
+
+	s.m.Lock()
+	if s.closed {
+		s.m.Unlock()
+		return nil
+	}
+	s.closed = true
+	for conn := range s.clients {
+		_ = conn.Close()
+	}
+	s.clients = nil
+	s.m.Unlock()
+
+	err := s.listener.Close()
+	if err != nil {
+		return errors.Wrap(err, "Close")
+	}
+
+	// the socket file is removed when the listener is closed, but make sure
+	// it does not stay around
+	if err = os.Remove(s.filename); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "Remove")
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package status_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/status"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func readEvent(t testing.TB, rd *bufio.Reader) status.Event {
+	line, err := rd.ReadBytes('\n')
+	rtest.OK(t, err)
+
+	var ev status.Event
+	rtest.OK(t, json.Unmarshal(line, &ev))
+	return ev
+}
+
+func TestServer(t *testing.T) {
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	filename := filepath.Join(dir, "status.sock")
+	srv, err := status.Listen(filename)
+	rtest.OK(t, err)
+	defer srv.Close()
+
+	_, err = status.Listen(filename)
+	rtest.Assert(t, err != nil, "expected error for socket in use")
+
+	srv.Send(status.Event{Type: "status", Command: "backup", FilesDone: 1})
+	srv.Send(status.Event{Type: "file_done", Command: "backup", Path: "/foo", Action: "new"})
+
+	conn, err := net.Dial("unix", filename)
+	rtest.OK(t, err)
+	defer conn.Close()
+	rtest.OK(t, conn.SetReadDeadline(time.Now().Add(10*time.Second)))
+	rd := bufio.NewReader(conn)
+
+	// a new client receives the last event first, except for file events
+	ev := readEvent(t, rd)
+	rtest.Equals(t, "status", ev.Type)
+	rtest.Equals(t, "backup", ev.Command)
+	rtest.Equals(t, uint64(1), ev.FilesDone)
+
+	srv.Send(status.Event{Type: "summary", Command: "backup", FilesDone: 2})
+	ev = readEvent(t, rd)
+	rtest.Equals(t, "summary", ev.Type)
+	rtest.Equals(t, uint64(2), ev.FilesDone)
+
+	rtest.OK(t, srv.Close())
+	_, err = rd.ReadBytes('\n')
+	rtest.Assert(t, err != nil, "expected error after close")
+
+	var nilServer *status.Server
+	nilServer.Send(status.Event{})
+	rtest.OK(t, nilServer.Close())
+}
+
+func TestListenExistingFile(t *testing.T) {
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	filename := filepath.Join(dir, "notes.txt")
+	rtest.OK(t, ioutil.WriteFile(filename, []byte("foobar"), 0600))
+
+	_, err := status.Listen(filename)
+	rtest.Assert(t, err != nil, "existing file was replaced by the socket")
+
+	buf, err := ioutil.ReadFile(filename)
+	rtest.OK(t, err)
+	rtest.Equals(t, "foobar", string(buf))
+}